@@ -0,0 +1,160 @@
+package blockchain
+
+import "errors"
+
+// ErrNoAddressIndex is returned by GetAddressHistory when the address
+// index is disabled
+var ErrNoAddressIndex = errors.New("address index is disabled")
+
+// AddressTx is a main chain transaction paying or spending from an
+// address, with what it did to the address's balance
+type AddressTx struct {
+	TxHash    Hash   `json:"tx_hash"`
+	BlockHash Hash   `json:"block_hash"`
+	Height    int    `json:"height"`
+	Received  uint64 `json:"received"` // Paid to the address
+	Sent      uint64 `json:"sent"`     // Spent from the address's outputs
+}
+
+// addressIndex lists the transactions touching each output script of the
+// main chain, oldest first
+type addressIndex struct {
+	history map[string][]AddressTx
+}
+
+// EnableAddressIndex builds the address index from the main chain and
+// keeps it there as blocks are connected and disconnected
+func (bc *Blockchain) EnableAddressIndex() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	idx := &addressIndex{history: make(map[string][]AddressTx)}
+	for height, block := range bc.blocks {
+		idx.connect(block, bc.undo[block.Hash], height)
+	}
+	bc.addrIndex = idx
+}
+
+// connect adds the transactions of a block connected at height, whose
+// spent outputs are in undo
+func (idx *addressIndex) connect(block *Block, undo *BlockUndo, height int) {
+	var spent []SpentOutput
+	if undo != nil {
+		spent = undo.Spent
+	}
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		entries := make(map[string]*AddressTx)
+		var order []string
+		entry := func(script []byte) *AddressTx {
+			e, ok := entries[string(script)]
+			if !ok {
+				e = &AddressTx{TxHash: tx.Hash, BlockHash: block.Hash, Height: height}
+				entries[string(script)] = e
+				order = append(order, string(script))
+			}
+			return e
+		}
+
+		if !tx.IsCoinbase() {
+			// The undo data lists spent outputs in input order
+			for _, in := range tx.Inputs {
+				if len(spent) > 0 && spent[0].TxHash == in.PrevTxHash && spent[0].Index == in.PrevTxIndex {
+					entry(spent[0].Output.Script).Sent += spent[0].Output.Value
+					spent = spent[1:]
+				}
+			}
+		}
+		for _, out := range tx.Outputs {
+			entry(out.Script).Received += out.Value
+		}
+		for _, script := range order {
+			idx.history[script] = append(idx.history[script], *entries[script])
+		}
+	}
+}
+
+// disconnect removes the transactions of the tip block being disconnected
+func (idx *addressIndex) disconnect(block *Block, undo *BlockUndo) {
+	scripts := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Outputs {
+			scripts[string(out.Script)] = true
+		}
+	}
+	if undo != nil {
+		for _, spent := range undo.Spent {
+			scripts[string(spent.Output.Script)] = true
+		}
+	}
+	// The tip's entries are the last of each address it touched
+	for script := range scripts {
+		history := idx.history[script]
+		for len(history) > 0 && history[len(history)-1].BlockHash == block.Hash {
+			history = history[:len(history)-1]
+		}
+		if len(history) == 0 {
+			delete(idx.history, script)
+		} else {
+			idx.history[script] = history
+		}
+	}
+}
+
+// GetAddressHistory returns a page of the main chain transactions paying
+// or spending from address, newest first, with the number of them. Pages
+// count from 0.
+func (bc *Blockchain) GetAddressHistory(address []byte, page, limit int) ([]AddressTx, int, error) {
+	if page < 0 || limit < 1 {
+		return nil, 0, errors.New("invalid page or limit")
+	}
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.addrIndex == nil {
+		return nil, 0, ErrNoAddressIndex
+	}
+	history := bc.addrIndex.history[string(address)]
+	txs := make([]AddressTx, 0, limit)
+	for i := len(history) - 1 - page*limit; i >= 0 && len(txs) < limit; i-- {
+		txs = append(txs, history[i])
+	}
+	return txs, len(history), nil
+}
+
+// UsedScripts returns which of scripts main chain outputs have paid,
+// directly or time-locked, as wallets tell used addresses from fresh
+// ones. It reads the address index when enabled and the chain otherwise.
+func (bc *Blockchain) UsedScripts(scripts [][]byte) map[string]bool {
+	wanted := make(map[string]bool, len(scripts))
+	for _, script := range scripts {
+		wanted[string(script)] = true
+	}
+	used := make(map[string]bool)
+	check := func(script []byte) {
+		if _, inner, ok := ParseTimeLockScript(script); ok {
+			script = inner
+		}
+		if wanted[string(script)] {
+			used[string(script)] = true
+		}
+	}
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if bc.addrIndex != nil {
+		for script := range bc.addrIndex.history {
+			check([]byte(script))
+		}
+		return used
+	}
+	for _, block := range bc.blocks {
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				check(out.Script)
+			}
+		}
+	}
+	return used
+}
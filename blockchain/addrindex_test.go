@@ -0,0 +1,65 @@
+package blockchain
+
+import "testing"
+
+func TestAddressIndex(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	var coinbases []*Transaction
+	for i := 0; i < 3; i++ {
+		block, err := bc.GenerateBlock([]byte("alice"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbases = append(coinbases, &block.Transactions[0])
+	}
+	if _, _, err := bc.GetAddressHistory([]byte("alice"), 0, 10); err != ErrNoAddressIndex {
+		t.Fatalf("GetAddressHistory without an index err = %v", err)
+	}
+	bc.EnableAddressIndex()
+
+	// Blocks connected after enabling are indexed too
+	reward := coinbases[0].Outputs[0].Value
+	spend := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbases[0].Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: reward / 2, Script: []byte("bob")}, {Value: reward / 4, Script: []byte("alice")}},
+	)
+	bc.addToMempool(spend)
+	block, err := bc.GenerateBlock([]byte("carol"), [][32]byte{spend.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, total, err := bc.GetAddressHistory([]byte("alice"), 0, 10)
+	if err != nil || total != 4 || len(history) != 4 {
+		t.Fatalf("alice's history = %d of %d, %v; want 4", len(history), total, err)
+	}
+	if history[0].TxHash != spend.Hash || history[0].Height != 4 || history[0].Sent != reward || history[0].Received != reward/4 {
+		t.Errorf("newest entry = %+v", history[0])
+	}
+	if history[3].TxHash != coinbases[0].Hash || history[3].Received != reward {
+		t.Errorf("oldest entry = %+v", history[3])
+	}
+	if page, _, _ := bc.GetAddressHistory([]byte("alice"), 1, 3); len(page) != 1 || page[0].TxHash != coinbases[0].Hash {
+		t.Errorf("second page = %+v", page)
+	}
+	if page, _, _ := bc.GetAddressHistory([]byte("alice"), 2, 3); len(page) != 0 {
+		t.Errorf("page past the end = %+v", page)
+	}
+	if history, total, _ := bc.GetAddressHistory([]byte("bob"), 0, 10); total != 1 || history[0].Received != reward/2 {
+		t.Errorf("bob's history = %+v", history)
+	}
+
+	// Disconnecting the block drops its entries
+	if err := bc.InvalidateBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := bc.GetAddressHistory([]byte("alice"), 0, 10); total != 3 {
+		t.Errorf("alice has %d transactions after the disconnect, want 3", total)
+	}
+	if _, total, _ := bc.GetAddressHistory([]byte("bob"), 0, 10); total != 0 {
+		t.Errorf("bob has %d transactions after the disconnect, want 0", total)
+	}
+	if _, _, err := bc.GetAddressHistory([]byte("alice"), -1, 10); err == nil {
+		t.Error("negative page accepted")
+	}
+}
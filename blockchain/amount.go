@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// CoinDecimals is the number of decimal places of one coin; a base unit
+// is 10^-CoinDecimals coins
+const CoinDecimals = 8
+
+// Amount is a quantity of coins in base units. All balances, rewards and
+// fees are Amounts so that arithmetic on them is exact.
+type Amount int64
+
+const (
+	// BaseUnit is the smallest amount
+	BaseUnit Amount = 1
+
+	// Coin is one whole coin
+	Coin Amount = 100000000
+
+	// MaxAmount is the maximum supply in base units
+	MaxAmount = MaximumSupply * Coin
+)
+
+var errInvalidAmount = errors.New("invalid amount")
+
+// ParseAmount parses a decimal number of coins such as "12", "0.5" or
+// "-0.00000001" into an Amount. More decimals than CoinDecimals and
+// amounts beyond MaxAmount are rejected rather than rounded.
+func ParseAmount(s string) (Amount, error) {
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(text, "-")
+
+	whole, frac, _ := strings.Cut(text, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w %q", errInvalidAmount, s)
+	}
+	if len(frac) > CoinDecimals {
+		return 0, fmt.Errorf("%w %q: more than %d decimals", errInvalidAmount, s, CoinDecimals)
+	}
+	for _, part := range []string{whole, frac} {
+		if strings.Trim(part, "0123456789") != "" {
+			return 0, fmt.Errorf("%w %q", errInvalidAmount, s)
+		}
+	}
+
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", CoinDecimals-len(frac)), "0")
+	if digits == "" {
+		return 0, nil
+	}
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || Amount(units) > MaxAmount {
+		return 0, fmt.Errorf("%w %q: exceeds the maximum supply", errInvalidAmount, s)
+	}
+	if negative {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+// String formats the amount as a decimal number of coins without trailing
+// zeros, e.g. "0.01" or "50"
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-a)
+	}
+	coin := uint64(Coin)
+	frac := strings.TrimRight(fmt.Sprintf("%0*d", CoinDecimals, units%coin), "0")
+	if frac == "" {
+		return fmt.Sprintf("%s%d", sign, units/coin)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, units/coin, frac)
+}
+
+// Set implements flag.Value, taking a number of coins
+func (a *Amount) Set(s string) error {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// MulDiv returns a*num/den truncated toward zero, without overflowing in
+// between. It splits amounts proportionally, e.g. a block reward by shares.
+func (a Amount) MulDiv(num, den int64) Amount {
+	product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(num))
+	return Amount(product.Quo(product, big.NewInt(den)).Int64())
+}
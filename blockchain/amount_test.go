@@ -0,0 +1,73 @@
+package blockchain
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1", Coin, false},
+		{"0.01", Coin / 100, false},
+		{"12.5", 12*Coin + Coin/2, false},
+		{".5", Coin / 2, false},
+		{"3.", 3 * Coin, false},
+		{"0.00000001", BaseUnit, false},
+		{"-0.00000001", -BaseUnit, false},
+		{" 7 ", 7 * Coin, false},
+		{"1000000", MaxAmount, false},
+		{"0.000000001", 0, true},
+		{"1000000.00000001", 0, true},
+		{"99999999999999999999", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"1e8", 0, true},
+		{"1.2.3", 0, true},
+		{"+1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0"},
+		{Coin, "1"},
+		{Coin / 100, "0.01"},
+		{BaseUnit, "0.00000001"},
+		{-(Coin + Coin/2), "-1.5"},
+		{MaxAmount, "1000000"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+		if back, err := ParseAmount(tt.want); err != nil || back != tt.in {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d", tt.want, back, err, tt.in)
+		}
+	}
+}
+
+func TestAmountMulDiv(t *testing.T) {
+	reward := 50 * Coin
+	// Would overflow int64 if multiplied first
+	if got := reward.MulDiv(1<<40, 3<<40); got != reward/3 {
+		t.Errorf("MulDiv = %d, want %d", got, reward/3)
+	}
+	if got := Amount(10).MulDiv(1, 3); got != 3 {
+		t.Errorf("MulDiv rounded to %d, want 3", got)
+	}
+}
@@ -0,0 +1,27 @@
+package blockchain
+
+import (
+	"math/rand"
+	"time"
+)
+
+// nextBackoff returns the delay before the next retry after one of d:
+// min for the first retry, then doubling up to max
+func nextBackoff(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d *= 2; d > max {
+		return max
+	}
+	return d
+}
+
+// withJitter adds up to half of d at random, so that nodes which lost a
+// peer together don't all retry it at once
+func withJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(int64(d/2)+1))
+}
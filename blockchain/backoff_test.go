@@ -0,0 +1,32 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	var got []time.Duration
+	d := time.Duration(0)
+	for i := 0; i < 6; i++ {
+		d = nextBackoff(d, time.Second, 10*time.Second)
+		got = append(got, d)
+	}
+	want := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i := range want {
+		if got[i] != want[i]*time.Second {
+			t.Fatalf("backoffs = %v, want %v seconds", got, want)
+		}
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := withJitter(time.Minute); d < time.Minute || d > 90*time.Second {
+			t.Fatalf("withJitter(1m) = %v", d)
+		}
+	}
+	if d := withJitter(0); d != 0 {
+		t.Errorf("withJitter(0) = %v", d)
+	}
+}
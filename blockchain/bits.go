@@ -0,0 +1,172 @@
+package blockchain
+
+import (
+	"crypto/subtle"
+	"math/big"
+)
+
+// oneLsh256 is 2^256, the size of the hash space
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToTarget decodes a compact "bits" value into the target it
+// represents. The high byte is the length of the target in bytes and the
+// low 23 bits are its most significant digits; bit 23 is a sign bit. A
+// negative or zero target is returned as is and is never met by a hash.
+func CompactToTarget(bits uint32) *big.Int {
+	mantissa := bits & 0x007fffff
+	negative := bits&0x00800000 != 0
+	exponent := uint(bits >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		target = big.NewInt(int64(mantissa >> (8 * (3 - exponent))))
+	} else {
+		target = new(big.Int).Lsh(big.NewInt(int64(mantissa)), 8*(exponent-3))
+	}
+	if negative {
+		target.Neg(target)
+	}
+	return target
+}
+
+// TargetToCompact encodes a target as compact "bits". Digits beyond the
+// 23-bit mantissa are truncated, so the encoded target is never easier
+// than the original.
+func TargetToCompact(target *big.Int) uint32 {
+	if target == nil || target.Sign() == 0 {
+		return 0
+	}
+
+	exponent := uint(len(target.Bytes()))
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(new(big.Int).Abs(target).Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(new(big.Int).Abs(target), 8*(exponent-3)).Uint64())
+	}
+
+	// The mantissa's top bit is the sign bit, so shift a byte into the
+	// exponent instead of setting it
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	bits := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		bits |= 0x00800000
+	}
+	return bits
+}
+
+// DifficultyToTarget returns the target a hash must stay below to meet
+// difficulty: 2^256 / difficulty. Non-positive difficulties have no target
+// and yield zero.
+func DifficultyToTarget(difficulty *big.Int) *big.Int {
+	if difficulty == nil || difficulty.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Div(oneLsh256, difficulty)
+}
+
+// TargetToDifficulty is the inverse of DifficultyToTarget
+func TargetToDifficulty(target *big.Int) *big.Int {
+	if target == nil || target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Div(oneLsh256, target)
+}
+
+// DifficultyToCompact encodes a difficulty as compact bits. Because the
+// target is truncated, the encoded difficulty is at least difficulty.
+func DifficultyToCompact(difficulty *big.Int) uint32 {
+	return TargetToCompact(DifficultyToTarget(difficulty))
+}
+
+// CompactToDifficulty decodes compact bits into a difficulty
+func CompactToDifficulty(bits uint32) *big.Int {
+	return TargetToDifficulty(CompactToTarget(bits))
+}
+
+// HashMeetsTarget reports whether hash, read as a big-endian number, is
+// below target
+func HashMeetsTarget(hash [32]byte, target *big.Int) bool {
+	if target == nil || target.Sign() <= 0 {
+		return false
+	}
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) < 0
+}
+
+// HashDifficulty returns the difficulty a hash achieves, the highest whose
+// target it meets: 2^256 / (hash+1), with the hash read as a big-endian
+// number
+func HashDifficulty(hash []byte) *big.Int {
+	h := new(big.Int).SetBytes(hash)
+	return h.Div(oneLsh256, h.Add(h, big.NewInt(1)))
+}
+
+// Target returns the target the block's hash must stay below
+func (b *Block) Target() *big.Int {
+	return CompactToTarget(b.Bits)
+}
+
+// Difficulty returns the difficulty encoded by the block's bits
+func (b *Block) Difficulty() *big.Int {
+	return CompactToDifficulty(b.Bits)
+}
+
+// Difficulty returns the difficulty encoded by the header's bits
+func (h *BlockHeader) Difficulty() *big.Int {
+	return CompactToDifficulty(h.Bits)
+}
+
+// HashTarget is a target as a 32-byte big-endian number, precomputed so
+// share checks compare bytes instead of building big.Ints per hash
+type HashTarget [32]byte
+
+// NewHashTarget converts a target. Non-positive targets become zero, which
+// no hash meets; targets of 2^256 or more saturate at 2^256-1.
+func NewHashTarget(target *big.Int) HashTarget {
+	var t HashTarget
+	if target == nil || target.Sign() <= 0 {
+		return t
+	}
+	if target.BitLen() > 256 {
+		for i := range t {
+			t[i] = 0xFF
+		}
+		return t
+	}
+	target.FillBytes(t[:])
+	return t
+}
+
+// DifficultyHashTarget returns the HashTarget of a difficulty
+func DifficultyHashTarget(difficulty *big.Int) HashTarget {
+	return NewHashTarget(DifficultyToTarget(difficulty))
+}
+
+// Met reports whether hash, read as a big-endian number, is below the
+// target. Every byte is compared, so the time taken doesn't depend on the
+// hash; hashes that aren't 32 bytes never meet it.
+func (t *HashTarget) Met(hash []byte) bool {
+	if len(hash) != len(t) {
+		return false
+	}
+	less, decided := 0, 0
+	for i := range t {
+		h, g := int(hash[i]), int(t[i])
+		lt := subtle.ConstantTimeLessOrEq(h+1, g)
+		gt := subtle.ConstantTimeLessOrEq(g+1, h)
+		less |= lt &^ decided
+		decided |= lt | gt
+	}
+	return less == 1
+}
+
+// MeetsDifficulty reports whether hash meets difficulty. Callers checking
+// many hashes against one difficulty should keep its HashTarget instead.
+func MeetsDifficulty(hash []byte, difficulty *big.Int) bool {
+	target := DifficultyHashTarget(difficulty)
+	return target.Met(hash)
+}
@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		bits   uint32
+		target string
+	}{
+		{0x00000000, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02123456, "1234"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x05009234, "92340000"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x20123456, "1234560000000000000000000000000000000000000000000000000000000000"},
+	}
+	for _, test := range tests {
+		want, _ := new(big.Int).SetString(test.target, 16)
+		if got := CompactToTarget(test.bits); got.Cmp(want) != 0 {
+			t.Errorf("CompactToTarget(%08x) = %x, want %x", test.bits, got, want)
+		}
+	}
+
+	// Encoding normalizes the mantissa, so check it on canonical values
+	for _, bits := range []uint32{0x01120000, 0x02123400, 0x03123456, 0x05009234, 0x1d00ffff, 0x20123456} {
+		if got := TargetToCompact(CompactToTarget(bits)); got != bits {
+			t.Errorf("TargetToCompact(CompactToTarget(%08x)) = %08x", bits, got)
+		}
+	}
+}
+
+func TestCompactSign(t *testing.T) {
+	if target := CompactToTarget(0x04923456); target.Sign() >= 0 {
+		t.Errorf("sign bit decoded as %v", target)
+	}
+	if bits := TargetToCompact(big.NewInt(-0x12345600)); bits != 0x04923456 {
+		t.Errorf("TargetToCompact(negative) = %08x", bits)
+	}
+	if HashMeetsTarget([32]byte{}, CompactToTarget(0x04923456)) {
+		t.Error("negative target met")
+	}
+}
+
+func TestDifficultyCompact(t *testing.T) {
+	for _, difficulty := range []*big.Int{
+		big.NewInt(1),
+		big.NewInt(1000),
+		big.NewInt(1000000),
+		new(big.Int).Lsh(big.NewInt(1), 240),
+		new(big.Int).Lsh(big.NewInt(3), 200),
+	} {
+		bits := DifficultyToCompact(difficulty)
+		// Truncating the target may only make the encoded difficulty harder
+		if got := CompactToDifficulty(bits); got.Cmp(difficulty) < 0 {
+			t.Errorf("difficulty %v encoded as %08x decodes to easier %v", difficulty, bits, got)
+		}
+		if CompactToTarget(bits).Cmp(DifficultyToTarget(difficulty)) > 0 {
+			t.Errorf("difficulty %v encoded as %08x has an easier target", difficulty, bits)
+		}
+	}
+
+	if bits := DifficultyToCompact(big.NewInt(0)); bits != 0 {
+		t.Errorf("DifficultyToCompact(0) = %08x", bits)
+	}
+}
+
+func TestBlockBits(t *testing.T) {
+	block := NewBlock(1, [32]byte{}, big.NewInt(16))
+	if block.Bits != 0x20100000 {
+		t.Fatalf("bits = %08x", block.Bits)
+	}
+	block.Mine()
+	if !block.ValidatePoW() || block.Hash[0] >= 0x10 {
+		t.Fatalf("mined hash %x does not meet target %x", block.Hash, block.Target())
+	}
+
+	// The bits are part of the hashed header
+	hash := block.CalculateHash()
+	block.Bits = DifficultyToCompact(big.NewInt(1))
+	if block.CalculateHash() == hash {
+		t.Error("changing bits did not change the hash")
+	}
+}
+
+func TestHashTargetMet(t *testing.T) {
+	target := NewHashTarget(big.NewInt(0x1234))
+	hash := func(hi, lo byte) []byte {
+		h := make([]byte, 32)
+		h[30], h[31] = hi, lo
+		return h
+	}
+
+	tests := []struct {
+		name string
+		hash []byte
+		want bool
+	}{
+		{"zero", make([]byte, 32), true},
+		{"just below", hash(0x12, 0x33), true},
+		{"lower high byte", hash(0x11, 0xFF), true},
+		{"equal", hash(0x12, 0x34), false},
+		{"just above", hash(0x12, 0x35), false},
+		{"higher leading byte", append([]byte{1}, make([]byte, 31)...), false},
+		{"short", []byte{0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := target.Met(tt.hash); got != tt.want {
+				t.Errorf("Met = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashTargetBounds(t *testing.T) {
+	zero := NewHashTarget(big.NewInt(-5))
+	if zero.Met(make([]byte, 32)) {
+		t.Error("non-positive target met")
+	}
+	if MeetsDifficulty(make([]byte, 32), big.NewInt(0)) {
+		t.Error("zero difficulty met")
+	}
+
+	// Difficulty 1 is the whole hash space
+	max := make([]byte, 32)
+	for i := range max {
+		max[i] = 0xFF
+	}
+	max[31] = 0xFE
+	if !MeetsDifficulty(max, big.NewInt(1)) {
+		t.Error("difficulty 1 not met")
+	}
+
+	// A difficulty met exactly as HashMeetsTarget does
+	difficulty := big.NewInt(1000)
+	var h [32]byte
+	h[2] = 0x41
+	if got, want := MeetsDifficulty(h[:], difficulty), HashMeetsTarget(h, DifficultyToTarget(difficulty)); got != want {
+		t.Errorf("MeetsDifficulty = %v, HashMeetsTarget = %v", got, want)
+	}
+}
+
+func TestHashDifficulty(t *testing.T) {
+	for _, difficulty := range []int64{2, 3, 1000, 123456789} {
+		target := DifficultyToTarget(big.NewInt(difficulty))
+
+		// The hash just below the target achieves the difficulty exactly
+		var hash [32]byte
+		new(big.Int).Sub(target, big.NewInt(1)).FillBytes(hash[:])
+		if got := HashDifficulty(hash[:]); got.Int64() != difficulty {
+			t.Errorf("HashDifficulty(target-1) = %v, want %d", got, difficulty)
+		}
+		if !MeetsDifficulty(hash[:], big.NewInt(difficulty)) || MeetsDifficulty(hash[:], big.NewInt(difficulty+1)) {
+			t.Errorf("hash achieving %d doesn't meet exactly it", difficulty)
+		}
+	}
+
+	if got := HashDifficulty(make([]byte, 32)); got.Cmp(oneLsh256) != 0 {
+		t.Errorf("HashDifficulty(0) = %x, want 2^256", got)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"time"
 )
 
@@ -11,11 +15,11 @@ import (
 type Block struct {
 	Version    uint32
 	Timestamp  int64
-	PrevHash   [32]byte
-	MerkleRoot [32]byte
-	Difficulty *big.Int
+	PrevHash   Hash
+	MerkleRoot Hash
+	Bits       uint32 // Compact encoding of the target
 	Nonce      uint32
-	Hash       [32]byte
+	Hash       Hash
 	Transactions []Transaction
 }
 
@@ -25,13 +29,27 @@ func NewBlock(version uint32, prevHash [32]byte, difficulty *big.Int) *Block {
 		Version:    version,
 		Timestamp:  time.Now().Unix(),
 		PrevHash:   prevHash,
-		Difficulty: difficulty,
+		Bits:       DifficultyToCompact(difficulty),
 		Nonce:      0,
 	}
 }
 
-// CalculateHash calculates the SHA-256 hash of the block header
-func (b *Block) CalculateHash() [32]byte {
+// Clone returns a deep copy of the block that shares no memory with it,
+// so one goroutine may modify the copy while others read the original
+func (b *Block) Clone() *Block {
+	clone := *b
+	if b.Transactions != nil {
+		clone.Transactions = make([]Transaction, len(b.Transactions))
+		for i := range b.Transactions {
+			clone.Transactions[i] = *b.Transactions[i].Clone()
+		}
+	}
+	return &clone
+}
+
+// EncodeHeader returns the serialized block header, whose SHA-256 hash is
+// the block hash
+func (b *Block) EncodeHeader() []byte {
 	header := bytes.NewBuffer(nil)
 	
 	// Write block header fields
@@ -39,21 +57,109 @@ func (b *Block) CalculateHash() [32]byte {
 	binary.Write(header, binary.LittleEndian, b.Timestamp)
 	header.Write(b.PrevHash[:])
 	header.Write(b.MerkleRoot[:])
-	binary.Write(header, binary.LittleEndian, b.Difficulty.Bytes())
+	binary.Write(header, binary.LittleEndian, b.Bits)
 	binary.Write(header, binary.LittleEndian, b.Nonce)
 	
-	return sha256.Sum256(header.Bytes())
+	return header.Bytes()
+}
+
+// headerSize is the size of an encoded block header
+const headerSize = 4 + 8 + HashSize + HashSize + 4 + 4
+
+// Encode returns the raw binary encoding of the block: the header, then
+// the number of transactions and each transaction prefixed by its length
+func (b *Block) Encode() []byte {
+	buf := bytes.NewBuffer(b.EncodeHeader())
+	binary.Write(buf, binary.LittleEndian, uint32(len(b.Transactions)))
+	for i := range b.Transactions {
+		raw := b.Transactions[i].Encode()
+		binary.Write(buf, binary.LittleEndian, uint32(len(raw)))
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+// DecodeBlock parses a block from its raw binary encoding
+func DecodeBlock(data []byte) (*Block, error) {
+	r := bytes.NewReader(data)
+	b := &Block{}
+
+	if err := binary.Read(r, binary.LittleEndian, &b.Version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &b.Timestamp); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, b.PrevHash[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, b.MerkleRoot[:]); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &b.Bits); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &b.Nonce); err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	if int(count) > r.Len()/4 {
+		return nil, errors.New("transaction count out of range")
+	}
+	b.Transactions = make([]Transaction, count)
+	for i := range b.Transactions {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if int(n) > r.Len() {
+			return nil, errors.New("transaction length out of range")
+		}
+		raw := make([]byte, n)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, err
+		}
+		tx, err := DecodeTransaction(raw)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		b.Transactions[i] = *tx
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after block")
+	}
+
+	b.Hash = b.CalculateHash()
+	return b, nil
+}
+
+// CalculateHash calculates the SHA-256 hash of the block header
+func (b *Block) CalculateHash() [32]byte {
+	return sha256.Sum256(b.EncodeHeader())
+}
+
+// Size returns the encoded size of the block in bytes: the header fields
+// as hashed by CalculateHash plus the raw encoding of every transaction
+func (b *Block) Size() int {
+	size := headerSize
+	for i := range b.Transactions {
+		size += len(b.Transactions[i].Encode())
+	}
+	return size
 }
 
 // Mine performs proof-of-work mining on the block
 func (b *Block) Mine() {
-	target := new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), b.Difficulty)
+	target := b.Target()
 	
 	for {
 		hash := b.CalculateHash()
-		hashInt := new(big.Int).SetBytes(hash[:])
 		
-		if hashInt.Cmp(target) == -1 {
+		if HashMeetsTarget(hash, target) {
 			b.Hash = hash
 			return
 		}
@@ -63,9 +169,7 @@ func (b *Block) Mine() {
 
 // ValidatePoW validates the proof-of-work for this block
 func (b *Block) ValidatePoW() bool {
-	target := new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), b.Difficulty)
-	hashInt := new(big.Int).SetBytes(b.Hash[:])
-	return hashInt.Cmp(target) == -1
+	return HashMeetsTarget(b.Hash, b.Target())
 }
 
 // CalculateMerkleRoot calculates the Merkle root of the block's transactions
@@ -74,25 +178,80 @@ func (b *Block) CalculateMerkleRoot() [32]byte {
 		return [32]byte{}
 	}
 
-	var hashes [][]byte
-	for _, tx := range b.Transactions {
-		hashes = append(hashes, tx.Hash[:])
+	// Leaves are copied out of the transactions; slicing a range variable
+	// would give every leaf the last transaction's hash
+	level := make([][32]byte, len(b.Transactions))
+	for i := range b.Transactions {
+		level[i] = b.Transactions[i].Hash
 	}
 
-	for len(hashes) > 1 {
-		if len(hashes)%2 != 0 {
-			hashes = append(hashes, hashes[len(hashes)-1])
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
 		}
 
-		var nextLevel [][]byte
-		for i := 0; i < len(hashes); i += 2 {
-			hash := sha256.Sum256(append(hashes[i], hashes[i+1]...))
-			nextLevel = append(nextLevel, hash[:])
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = merkleParent(level[2*i], level[2*i+1])
 		}
-		hashes = nextLevel
+		level = next
 	}
+	return level[0]
+}
+
+// MerkleProof returns the branch proving a transaction is in the block:
+// the sibling of each node on the path from the transaction up the merkle
+// tree, and the transaction's position, whose bits tell which side each
+// sibling is on. See VerifyMerkleProof.
+func (b *Block) MerkleProof(txHash [32]byte) ([][32]byte, int, error) {
+	index := -1
+	level := make([][32]byte, len(b.Transactions))
+	for i := range b.Transactions {
+		level[i] = b.Transactions[i].Hash
+		if level[i] == txHash && index < 0 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, 0, errors.New("transaction not in block")
+	}
+
+	branch := make([][32]byte, 0)
+	for pos := index; len(level) > 1; pos /= 2 {
+		// An odd node out is paired with itself, as in CalculateMerkleRoot
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = merkleParent(level[2*i], level[2*i+1])
+		}
+		level = next
+	}
+	return branch, index, nil
+}
+
+// VerifyMerkleProof checks a branch from Block.MerkleProof proves the
+// transaction at index is under a block's merkle root, so a light client
+// holding only the header can check a transaction was mined
+func VerifyMerkleProof(txHash [32]byte, branch [][32]byte, index int, root [32]byte) bool {
+	if index < 0 {
+		return false
+	}
+	hash := txHash
+	for _, sibling := range branch {
+		if index%2 == 0 {
+			hash = merkleParent(hash, sibling)
+		} else {
+			hash = merkleParent(sibling, hash)
+		}
+		index /= 2
+	}
+	return index == 0 && hash == root
+}
 
-	var root [32]byte
-	copy(root[:], hashes[0])
-	return root
+// merkleParent returns the merkle tree node above two others
+func merkleParent(left, right [32]byte) [32]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
 }
@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBlockClone(t *testing.T) {
+	block := NewBlock(1, [32]byte{7}, big.NewInt(1))
+	block.Transactions = []Transaction{*CreateCoinbase(50, []byte("miner"))}
+	block.MerkleRoot = block.CalculateMerkleRoot()
+	block.Hash = block.CalculateHash()
+
+	clone := block.Clone()
+	if clone.CalculateHash() != block.Hash || clone.CalculateMerkleRoot() != block.MerkleRoot {
+		t.Fatal("clone differs from the original")
+	}
+
+	clone.Nonce++
+	clone.Transactions[0].Outputs[0].Value = 1
+	clone.Transactions[0].Outputs[0].Script[0] = 'X'
+	clone.Transactions = append(clone.Transactions, Transaction{})
+	if block.CalculateHash() != block.Hash {
+		t.Error("modifying the clone's header changed the original")
+	}
+	if out := block.Transactions[0].Outputs[0]; out.Value != 50 || string(out.Script) != "miner" || len(block.Transactions) != 1 {
+		t.Error("modifying the clone's transactions changed the original")
+	}
+
+	if (&Block{}).Clone().Transactions != nil {
+		t.Error("nil transactions cloned as non-nil")
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for count := 1; count <= 7; count++ {
+		block := &Block{}
+		for i := 0; i < count; i++ {
+			tx := CreateCoinbase(uint64(i+1), []byte("miner"))
+			block.Transactions = append(block.Transactions, *tx)
+		}
+		root := block.CalculateMerkleRoot()
+
+		for i := range block.Transactions {
+			hash := block.Transactions[i].Hash
+			branch, index, err := block.MerkleProof(hash)
+			if err != nil || index != i {
+				t.Fatalf("%d transactions: MerkleProof(%d) index %d, %v", count, i, index, err)
+			}
+			if !VerifyMerkleProof(hash, branch, index, root) {
+				t.Errorf("%d transactions: proof of %d does not verify", count, i)
+			}
+			if VerifyMerkleProof(hash, branch, index, [32]byte{1}) {
+				t.Errorf("%d transactions: proof of %d verifies under another root", count, i)
+			}
+			if index^1 < count && VerifyMerkleProof(hash, branch, index^1, root) {
+				t.Errorf("%d transactions: proof of %d verifies at another position", count, i)
+			}
+			if len(branch) > 0 {
+				tampered := append([][32]byte{}, branch...)
+				tampered[0][0] ^= 1
+				if VerifyMerkleProof(hash, tampered, index, root) {
+					t.Errorf("%d transactions: tampered proof of %d verifies", count, i)
+				}
+			}
+		}
+	}
+
+	if _, _, err := (&Block{}).MerkleProof([32]byte{1}); err == nil {
+		t.Error("proof of a missing transaction")
+	}
+}
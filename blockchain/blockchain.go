@@ -5,6 +5,7 @@ import (
 	"errors"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,14 +17,61 @@ type Blockchain struct {
 	blocks     []*Block
 	mempool    []*Transaction
 	difficulty *big.Int
+	params     *ChainParams
+	timeSource *TimeSource
+	sideBlocks map[[32]byte]*Block     // Known blocks not on the main chain
+	index      map[[32]byte]*blockNode // Height and chain work of every known block
+	undo       map[[32]byte]*BlockUndo // Unwind records of main chain blocks
+	utxos      *utxoSet                // Unspent outputs of the main chain
+	orphans    *orphanPool             // Blocks waiting for their parent
+	invalid    map[[32]byte]bool       // Blocks marked invalid by InvalidateBlock
+	headers    map[[32]byte][32]byte   // Parents of validated headers up to the last checkpoint, see ProcessHeaders
+	assumed    map[[32]byte]bool       // Unconnected ancestors of a validated checkpoint header
+	policy     Policy                  // Mempool acceptance and relay rules
 	mu         sync.RWMutex
+	status     atomic.Pointer[chainStatus] // Tip and mempool snapshot, see Height
+
+	mempoolSpends   map[outpoint]*Transaction // Mempool transaction spending each output
+	mempoolBytes    int                       // Encoded size of the mempool transactions
+	mempoolEvicted  uint64    // Transactions evicted from the full mempool
+	evictionFeeRate Amount    // Minimum fee rate set by the last eviction
+	evictionFeeTime time.Time // and when, see mempoolMinFeeRate
+
+	txIndex   *txIndex      // Main chain transaction locations, nil unless enabled
+	addrIndex *addressIndex // Transactions by address, nil unless enabled
+
+	notificationsMu sync.RWMutex
+	notifications   []NotificationCallback
 }
 
-// NewBlockchain creates a new blockchain with genesis block
+// NewBlockchain creates a new mainnet blockchain with genesis block
 func NewBlockchain() *Blockchain {
+	return NewBlockchainWithParams(&MainNetParams)
+}
+
+// NewBlockchainWithParams creates a new blockchain for the given network
+func NewBlockchainWithParams(params *ChainParams) *Blockchain {
+	difficulty := params.Consensus.InitialDifficulty
+	if difficulty == nil {
+		difficulty = InitialDifficulty
+	}
+
 	bc := &Blockchain{
-		difficulty: InitialDifficulty,
+		difficulty: difficulty,
+		params:     params,
+		timeSource: NewTimeSource(),
+		sideBlocks: make(map[[32]byte]*Block),
+		index:      make(map[[32]byte]*blockNode),
+		undo:       make(map[[32]byte]*BlockUndo),
+		utxos:      newUTXOSet(),
+		orphans:    newOrphanPool(),
+		invalid:    make(map[[32]byte]bool),
+		headers:    make(map[[32]byte][32]byte),
+		assumed:    make(map[[32]byte]bool),
+		policy:     DefaultPolicy(),
 		mempool:    make([]*Transaction, 0),
+
+		mempoolSpends: make(map[outpoint]*Transaction),
 	}
 	
 	// Create genesis block
@@ -32,23 +80,41 @@ func NewBlockchain() *Blockchain {
 	genesis.Mine()
 	
 	bc.blocks = append(bc.blocks, genesis)
+	for i := range genesis.Transactions {
+		bc.utxos.addTx(&genesis.Transactions[i], 0)
+	}
+	bc.indexBlock(genesis)
+	bc.publishStatus()
 	return bc
 }
 
 // AddBlock mines and adds a new block to the chain
 func (bc *Blockchain) AddBlock(transactions []*Transaction) error {
+	block, err := bc.addBlock(transactions)
+	if err != nil {
+		return err
+	}
+
+	bc.sendNotification(NTBlockConnected, block)
+	return nil
+}
+
+// addBlock mines and connects a new block. Subscribers are notified by the
+// caller once the chain lock has been released.
+func (bc *Blockchain) addBlock(transactions []*Transaction) (*Block, error) {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 	
 	if len(bc.blocks) == 0 {
-		return errors.New("blockchain not initialized")
+		return nil, errors.New("blockchain not initialized")
 	}
 	
 	prevBlock := bc.blocks[len(bc.blocks)-1]
 	newBlock := NewBlock(1, prevBlock.Hash, bc.difficulty)
+	newBlock.Timestamp = bc.nextBlockTime()
 	
 	// Add coinbase transaction first
-	coinbase := CreateCoinbase(CalculateBlockReward(len(bc.blocks)), []byte{})
+	coinbase := bc.newCoinbase(len(bc.blocks), 0, []byte{})
 	newBlock.Transactions = append(newBlock.Transactions, coinbase)
 	
 	// Add other transactions
@@ -57,93 +123,122 @@ func (bc *Blockchain) AddBlock(transactions []*Transaction) error {
 	// Calculate merkle root
 	newBlock.MerkleRoot = newBlock.CalculateMerkleRoot()
 	
+	// Inputs must exist and be signed, and value must be conserved
+	if err := bc.checkBlockTransactions(newBlock, len(bc.blocks), bc.utxos); err != nil {
+		return nil, err
+	}
+	
 	// Mine the block
 	newBlock.Mine()
 	
 	// Validate the block
 	if !newBlock.ValidatePoW() {
-		return errors.New("invalid proof of work")
+		return nil, errors.New("invalid proof of work")
 	}
 	
-	bc.blocks = append(bc.blocks, newBlock)
-	
-	// Remove added transactions from mempool
-	bc.removeFromMempool(transactions)
+	bc.connectBlock(newBlock)
+	bc.publishStatus()
 	
-	return nil
+	return newBlock, nil
 }
 
-// AddTransaction adds a transaction to the mempool
+// AddTransaction validates a transaction against the main chain and the
+// mempool, as checkMempoolTx, and adds it to the mempool
 func (bc *Blockchain) AddTransaction(tx *Transaction) error {
 	if tx == nil {
 		return errors.New("transaction cannot be nil")
 	}
 	
 	bc.mu.Lock()
-	defer bc.mu.Unlock()
 	
-	// Verify transaction
-	if !tx.IsCoinbase() {
-		// Add verification logic here
-		// - Check if inputs exist and are unspent
-		// - Verify signatures
-		// - Check if total input value >= total output value
+	if err := bc.checkMempoolTx(tx); err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+
+	// Local relay policy; block validation doesn't apply it
+	if err := bc.checkPolicy(tx); err != nil {
+		bc.mu.Unlock()
+		return err
 	}
 	
-	bc.mempool = append(bc.mempool, tx)
+	bc.addToMempool(tx)
+	for _, evicted := range bc.trimMempool(time.Now()) {
+		if evicted == tx {
+			bc.publishStatus()
+			bc.mu.Unlock()
+			return policyErrorf("mempool full")
+		}
+	}
+	bc.publishStatus()
+	bc.mu.Unlock()
+
+	bc.sendNotification(NTTxAccepted, tx)
 	return nil
 }
 
-// GetBalance returns the balance for a given address
+// GetBalance returns the value of the unspent main chain outputs paying
+// address
 func (bc *Blockchain) GetBalance(address []byte) uint64 {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	
+
 	var balance uint64
-	spentOutputs := make(map[string]bool)
-	
-	// Iterate through all blocks
+	for _, utxo := range bc.utxos.forScript(address) {
+		balance += utxo.Output.Value
+	}
+	return balance
+}
+
+// FindTxOutput returns an output of a transaction on the main chain
+func (bc *Blockchain) FindTxOutput(txHash [32]byte, index uint32) (*TxOutput, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.findTxOutput(txHash, index)
+}
+
+// findTxOutput implements FindTxOutput; the caller must hold bc.mu.
+// Unspent outputs are found in the UTXO set, spent ones by a scan of the
+// chain.
+func (bc *Blockchain) findTxOutput(txHash [32]byte, index uint32) (*TxOutput, bool) {
+	if utxo, ok := bc.utxos.get(outpoint{txHash, index}); ok {
+		out := utxo.Output
+		return &out, true
+	}
 	for _, block := range bc.blocks {
 		for _, tx := range block.Transactions {
-			// Check outputs
-			for i, out := range tx.Outputs {
-				if bytes.Equal(out.Script, address) {
-					key := fmt.Sprintf("%x:%d", tx.Hash, i)
-					if !spentOutputs[key] {
-						balance += out.Value
-					}
-				}
-			}
-			
-			// Mark spent outputs
-			if !tx.IsCoinbase() {
-				for _, in := range tx.Inputs {
-					if bytes.Equal(in.Script, address) {
-						key := fmt.Sprintf("%x:%d", in.PrevTxHash, in.PrevTxIndex)
-						spentOutputs[key] = true
-					}
+			if tx.Hash == txHash {
+				if int(index) >= len(tx.Outputs) {
+					return nil, false
 				}
+				out := tx.Outputs[index]
+				return &out, true
 			}
 		}
 	}
-	
-	return balance
+	return nil, false
 }
 
-// CalculateBlockReward calculates the mining reward for a given block height
-func CalculateBlockReward(height int) uint64 {
-	// Initial reward is 0.01 AIM
-	initialReward := uint64(1000000) // 0.01 AIM in smallest unit
-	
-	// Halving every 210,000 blocks (approximately 4 years with 1-minute blocks)
-	halvings := height / 210000
-	
-	if halvings >= 64 {
-		return 0
+// SpendableOutput is an unspent transaction output
+type SpendableOutput struct {
+	TxHash Hash
+	Index  uint32
+	Value  uint64
+}
+
+// FindSpendableOutputs returns the unspent outputs paying script, oldest
+// first, leaving out any already spent by a transaction in the mempool
+func (bc *Blockchain) FindSpendableOutputs(script []byte) []SpendableOutput {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	outputs := make([]SpendableOutput, 0)
+	for _, utxo := range bc.utxos.forScript(script) {
+		if bc.mempoolSpends[outpoint{utxo.TxHash, utxo.Index}] == nil {
+			outputs = append(outputs, SpendableOutput{TxHash: utxo.TxHash, Index: utxo.Index, Value: utxo.Output.Value})
+		}
 	}
-	
-	// Right shift to implement halving
-	return initialReward >> uint(halvings)
+	return outputs
 }
 
 // removeFromMempool removes the given transactions from the mempool
@@ -157,6 +252,11 @@ func (bc *Blockchain) removeFromMempool(transactions []*Transaction) {
 	for _, tx := range bc.mempool {
 		if !txMap[tx.Hash] {
 			newMempool = append(newMempool, tx)
+			continue
+		}
+		bc.mempoolBytes -= len(tx.Encode())
+		for _, in := range tx.Inputs {
+			delete(bc.mempoolSpends, outpoint{in.PrevTxHash, in.PrevTxIndex})
 		}
 	}
 	
@@ -174,6 +274,40 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.blocks[len(bc.blocks)-1]
 }
 
+// GetBlocks returns the main chain, genesis first. The slice is a copy;
+// the blocks themselves are shared and must not be modified.
+func (bc *Blockchain) GetBlocks() []*Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	blocks := make([]*Block, len(bc.blocks))
+	copy(blocks, bc.blocks)
+	return blocks
+}
+
+// Params returns the chain parameters the blockchain was created with
+func (bc *Blockchain) Params() *ChainParams {
+	return bc.params
+}
+
+// InitialDifficulty returns the difficulty the chain starts at, which is
+// also the floor for pool share difficulty
+func (bc *Blockchain) InitialDifficulty() *big.Int {
+	return new(big.Int).Set(bc.difficulty)
+}
+
+// TimeSource returns the network-adjusted time source
+func (bc *Blockchain) TimeSource() *TimeSource {
+	return bc.timeSource
+}
+
+// GetHeight returns the height of the chain tip
+func (bc *Blockchain) GetHeight() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return len(bc.blocks) - 1
+}
+
 // ValidateChain validates the entire blockchain
 func (bc *Blockchain) ValidateChain() bool {
 	bc.mu.RLock()
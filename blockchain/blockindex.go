@@ -0,0 +1,79 @@
+package blockchain
+
+import "math/big"
+
+// blockNode is the block index entry of a known block, on the main chain
+// or a side branch
+type blockNode struct {
+	height    int
+	chainWork *big.Int // Cumulative work of the chain ending in the block
+}
+
+// indexBlock adds a block whose parent is already indexed, or the genesis
+// block, to the block index and returns its entry; the caller must hold
+// bc.mu for writing
+func (bc *Blockchain) indexBlock(block *Block) *blockNode {
+	if node, ok := bc.index[block.Hash]; ok {
+		return node
+	}
+
+	node := &blockNode{chainWork: CalcWork(block.Bits)}
+	if parent, ok := bc.index[block.PrevHash]; ok {
+		node.height = parent.height + 1
+		node.chainWork.Add(node.chainWork, parent.chainWork)
+	}
+	bc.index[block.Hash] = node
+	return node
+}
+
+// tipWork returns the cumulative work of the main chain; the caller must
+// hold bc.mu
+func (bc *Blockchain) tipWork() *big.Int {
+	return bc.index[bc.blocks[len(bc.blocks)-1].Hash].chainWork
+}
+
+// ChainWork returns the cumulative work of the chain ending in a known
+// block
+func (bc *Blockchain) ChainWork(hash [32]byte) (*big.Int, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	node, ok := bc.index[hash]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).Set(node.chainWork), true
+}
+
+// BlockInfo describes a known block for block explorers and RPCs
+type BlockInfo struct {
+	Block     *Block
+	Height    int
+	ChainWork *big.Int
+	MainChain bool     // False for side branch blocks
+	NextHash  [32]byte // Successor on the main chain, zero at the tip or off it
+}
+
+// GetBlockInfo returns a known block with its index entry. The block is
+// shared and must not be modified.
+func (bc *Blockchain) GetBlockInfo(hash [32]byte) (*BlockInfo, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	node, ok := bc.index[hash]
+	if !ok {
+		return nil, ErrUnknownBlock
+	}
+	info := &BlockInfo{Height: node.height, ChainWork: new(big.Int).Set(node.chainWork)}
+	if height := bc.mainChainHeight(hash); height >= 0 {
+		info.Block, info.MainChain = bc.blocks[height], true
+		if height+1 < len(bc.blocks) {
+			info.NextHash = bc.blocks[height+1].Hash
+		}
+	} else if block := bc.sideBlocks[hash]; block != nil {
+		info.Block = block
+	} else {
+		return nil, ErrUnknownBlock
+	}
+	return info, nil
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestChainWorkSelectsMostWork(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	unit := CalcWork(genesis.Bits)
+
+	// Main chain genesis-a1-a2-a3 at the chain difficulty
+	parent := genesis
+	for _, tag := range []string{"a1", "a2", "a3"} {
+		block := mineTestBlock(bc, parent, tag)
+		if err := bc.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		parent = block
+	}
+	work, ok := bc.ChainWork(parent.Hash)
+	if !ok || work.Cmp(new(big.Int).Mul(unit, big.NewInt(4))) != 0 {
+		t.Fatalf("chain work of a3 = %v, want 4 blocks of %v", work, unit)
+	}
+
+	// A shorter branch genesis-b1-b2 at four times the difficulty has more
+	// work and becomes the main chain
+	hard := new(big.Int).Mul(bc.requiredDifficulty(), big.NewInt(4))
+	parent = genesis
+	var b2 *Block
+	for _, tag := range []string{"b1", "b2"} {
+		block := NewBlock(1, parent.Hash, hard)
+		block.Timestamp = parent.Timestamp + 60
+		block.Transactions = []Transaction{*CreateCoinbase(0, []byte(tag))}
+		block.MerkleRoot = block.CalculateMerkleRoot()
+		block.Mine()
+		if err := bc.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		parent, b2 = block, block
+	}
+	if bc.TipHash() != b2.Hash || bc.Height() != 2 {
+		t.Fatalf("tip at height %d is not b2", bc.Height())
+	}
+
+	info, err := bc.GetBlockInfo(b2.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.MainChain || info.Height != 2 || info.ChainWork.Cmp(work) <= 0 {
+		t.Errorf("b2 info = %+v", info)
+	}
+	info, err = bc.GetBlockInfo(genesis.Hash)
+	if err != nil || info.NextHash == ([32]byte{}) {
+		t.Errorf("genesis info = %+v, %v", info, err)
+	}
+	// The old main chain is still indexed as a side branch
+	if info, err := bc.GetBlockInfo(sideBlockByTag(t, bc, "a3")); err != nil || info.MainChain || info.Height != 3 {
+		t.Errorf("a3 info = %+v, %v", info, err)
+	}
+	if _, err := bc.GetBlockInfo([32]byte{1}); err != ErrUnknownBlock {
+		t.Errorf("unknown block err = %v", err)
+	}
+}
+
+// sideBlockByTag finds the side block whose coinbase pays tag
+func sideBlockByTag(t *testing.T, bc *Blockchain, tag string) [32]byte {
+	t.Helper()
+	for hash, block := range bc.sideBlocks {
+		if string(block.Transactions[0].Outputs[0].Script) == tag {
+			return hash
+		}
+	}
+	t.Fatalf("no side block %s", tag)
+	return [32]byte{}
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A bootstrap file holds the main chain after genesis, oldest first, as
+// records of the bootstrap magic, the block's length and the encoded
+// block. Nodes that can't reach peers import one to sync.
+
+// bootstrapMagic starts every record of a bootstrap file
+var bootstrapMagic = [4]byte{'A', 'L', 'R', 'B'}
+
+// maxBootstrapRecord bounds the length of a block read from a bootstrap
+// file
+const maxBootstrapRecord = 32 << 20
+
+// ExportBootstrap writes the main chain after genesis to w as a bootstrap
+// file, returning the number of blocks written
+func (bc *Blockchain) ExportBootstrap(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	blocks := bc.GetBlocks()
+	for _, block := range blocks[1:] {
+		raw := block.Encode()
+		bw.Write(bootstrapMagic[:])
+		binary.Write(bw, binary.LittleEndian, uint32(len(raw)))
+		if _, err := bw.Write(raw); err != nil {
+			return 0, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return len(blocks) - 1, nil
+}
+
+// ImportBootstrap reads a bootstrap file from r, validating and connecting
+// each block as a block from a peer would be. Blocks already in the chain
+// are skipped, so a file may be imported again or overlap the chain.
+// progress, if not nil, is called with the height after each block. It
+// returns the number of blocks connected, and stops at the first block
+// that fails to decode or validate.
+func (bc *Blockchain) ImportBootstrap(r io.Reader, progress func(height int)) (int, error) {
+	br := bufio.NewReader(r)
+	imported := 0
+	for record := 0; ; record++ {
+		var magic [4]byte
+		if _, err := io.ReadFull(br, magic[:]); err == io.EOF {
+			return imported, nil
+		} else if err != nil {
+			return imported, fmt.Errorf("record %d: %v", record, err)
+		}
+		if magic != bootstrapMagic {
+			return imported, fmt.Errorf("record %d: not a bootstrap file", record)
+		}
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return imported, fmt.Errorf("record %d: %v", record, err)
+		}
+		if n > maxBootstrapRecord {
+			return imported, fmt.Errorf("record %d: block of %d bytes is too large", record, n)
+		}
+		raw := make([]byte, n)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return imported, fmt.Errorf("record %d: %v", record, err)
+		}
+		block, err := DecodeBlock(raw)
+		if err != nil {
+			return imported, fmt.Errorf("record %d: %v", record, err)
+		}
+
+		err = bc.ProcessBlock(block)
+		if errors.Is(err, ErrDuplicateBlock) {
+			continue
+		} else if err != nil {
+			return imported, fmt.Errorf("block %x: %v", block.Hash, err)
+		}
+		imported++
+		if progress != nil {
+			progress(bc.GetHeight())
+		}
+	}
+}
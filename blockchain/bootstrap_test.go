@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlockEncodeRoundTrip(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	block, err := bc.GenerateBlock([]byte("miner"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBlock(block.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != block.Hash || len(decoded.Transactions) != 1 ||
+		decoded.Transactions[0].Hash != block.Transactions[0].Hash {
+		t.Errorf("round trip changed the block")
+	}
+
+	raw := block.Encode()
+	for _, bad := range [][]byte{raw[:headerSize], raw[:len(raw)-1], append(raw, 0)} {
+		if _, err := DecodeBlock(bad); err == nil {
+			t.Errorf("decoded a block of %d bytes", len(bad))
+		}
+	}
+}
+
+func TestBootstrapImport(t *testing.T) {
+	source := NewBlockchainWithParams(&RegTestParams)
+	for i := 0; i < 5; i++ {
+		if _, err := source.GenerateBlock([]byte("miner"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var file bytes.Buffer
+	if n, err := source.ExportBootstrap(&file); err != nil || n != 5 {
+		t.Fatalf("ExportBootstrap = %d, %v", n, err)
+	}
+
+	bc := NewBlockchainWithParams(&RegTestParams)
+	var heights []int
+	n, err := bc.ImportBootstrap(bytes.NewReader(file.Bytes()), func(height int) {
+		heights = append(heights, height)
+	})
+	if err != nil || n != 5 || len(heights) != 5 || heights[4] != 5 {
+		t.Fatalf("ImportBootstrap = %d, %v, heights %v", n, err, heights)
+	}
+	if bc.TipHash() != source.TipHash() {
+		t.Error("imported chain has a different tip")
+	}
+
+	// Importing again skips the known blocks
+	if n, err := bc.ImportBootstrap(bytes.NewReader(file.Bytes()), nil); err != nil || n != 0 {
+		t.Errorf("reimport = %d, %v", n, err)
+	}
+
+	// A corrupted block stops the import after the blocks before it
+	corrupt := append([]byte(nil), file.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0xFF
+	fresh := NewBlockchainWithParams(&RegTestParams)
+	if n, err := fresh.ImportBootstrap(bytes.NewReader(corrupt), nil); err == nil || n != 4 {
+		t.Errorf("corrupt import = %d, %v", n, err)
+	}
+
+	if _, err := fresh.ImportBootstrap(bytes.NewReader([]byte("not a bootstrap file")), nil); err == nil {
+		t.Error("imported a file without the bootstrap magic")
+	}
+}
@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Checkpoint pins a known-good block hash at a given height
+type Checkpoint struct {
+	Height int      `json:"height"`
+	Hash   [32]byte `json:"hash"`
+}
+
+// ChainParams defines the network-specific parameters of a chain
+type ChainParams struct {
+	Name        string `json:"name"`
+	DefaultPort int    `json:"default_port"`
+
+	// Seeds are peers, as host or host:port, to connect to when none are
+	// configured
+	Seeds []string `json:"seeds,omitempty"`
+
+	// Checkpoints are hardcoded known-good blocks. Blocks and headers
+	// contradicting one are rejected, as are forks below the last, and
+	// signatures up to the last are not verified.
+	Checkpoints []Checkpoint `json:"checkpoints"`
+
+	// MinimumChainWork is the cumulative work a header chain must reach
+	// before the node will download its blocks
+	MinimumChainWork *big.Int `json:"minimum_chain_work"`
+
+	// MaxHeadersPerMsg is the maximum number of headers in a single message
+	MaxHeadersPerMsg int `json:"max_headers_per_msg"`
+
+	// MaxHeadersPerMinute limits how many unsolicited or low-work headers
+	// a single peer may send
+	MaxHeadersPerMinute int `json:"max_headers_per_minute"`
+
+	// Consensus holds the proof-of-work rules of the chain
+	Consensus ConsensusParams `json:"consensus"`
+
+	// InitialSubsidy is the block subsidy before the first halving
+	InitialSubsidy Amount `json:"initial_subsidy"`
+
+	// HalvingInterval is the number of blocks between subsidy halvings
+	HalvingInterval int `json:"halving_interval"`
+
+	// MaxSupply caps the total subsidy ever issued
+	MaxSupply Amount `json:"max_supply"`
+
+	// MaxBlockSize is the largest valid block in bytes, DefaultMaxBlockSize
+	// if unset
+	MaxBlockSize int `json:"max_block_size,omitempty"`
+
+	// Treasury, if set, is a development fund every coinbase must pay
+	Treasury *TreasuryParams `json:"treasury,omitempty"`
+
+	// HDCoinType is the coin type of wallets' BIP 44 derivation paths,
+	// m/44'/<coin type>'/<account>'
+	HDCoinType uint32 `json:"hd_coin_type,omitempty"`
+
+	// MineBlocksOnDemand allows GenerateBlock, for test networks whose
+	// difficulty is low enough to mine blocks instantly
+	MineBlocksOnDemand bool `json:"mine_blocks_on_demand,omitempty"`
+}
+
+// DefaultMaxBlockSize is the largest valid block, in bytes, of chains whose
+// parameters set no limit
+const DefaultMaxBlockSize = 2000000
+
+// mainNetMinimumChainWork is the work of 10,000 blocks at the minimum
+// consensus difficulty. Raise it to the chain's actual work with each
+// release.
+var mainNetMinimumChainWork = new(big.Int).Mul(CalcWork(DifficultyToCompact(DefaultConsensusParams.MinimumDifficulty)), big.NewInt(10000))
+
+// MainNetParams are the parameters for the main Alerim network
+var MainNetParams = ChainParams{
+	Name:                "mainnet",
+	DefaultPort:         9000,
+	Checkpoints:         []Checkpoint{},
+	MinimumChainWork:    mainNetMinimumChainWork,
+	MaxHeadersPerMsg:    2000,
+	MaxHeadersPerMinute: 20000,
+	Consensus:           DefaultConsensusParams,
+	InitialSubsidy:      InitialBlockReward,
+	HalvingInterval:     210000, // About 4 years at one block a minute
+	MaxSupply:           MaxAmount,
+	HDCoinType:          1033,
+}
+
+// RegTestParams are the parameters for regression testing: a private
+// chain at difficulty 2 whose blocks are mined on demand. At difficulty 1
+// every hash would meet the target but blocks would carry no work, and
+// fork choice by chain work needs some.
+var RegTestParams = ChainParams{
+	Name:                "regtest",
+	DefaultPort:         19000,
+	Checkpoints:         []Checkpoint{},
+	MinimumChainWork:    big.NewInt(0),
+	MaxHeadersPerMsg:    2000,
+	MaxHeadersPerMinute: 20000,
+	Consensus: ConsensusParams{
+		Algorithm:         "sha256",
+		MinimumDifficulty: big.NewInt(2),
+		InitialDifficulty: big.NewInt(2),
+	},
+	InitialSubsidy:     InitialBlockReward,
+	HalvingInterval:    150, // Short enough for tests to cross halvings
+	MaxSupply:          MaxAmount,
+	HDCoinType:         1, // As SLIP-0044 has test networks use
+	MineBlocksOnDemand: true,
+}
+
+// networkParams maps network names to their parameters
+var networkParams = map[string]*ChainParams{
+	MainNetParams.Name: &MainNetParams,
+	RegTestParams.Name: &RegTestParams,
+}
+
+// ParamsForNetwork returns the built-in parameters of a named network
+func ParamsForNetwork(name string) (*ChainParams, bool) {
+	params, ok := networkParams[name]
+	return params, ok
+}
+
+// BlockSizeLimit returns the largest valid block in bytes
+func (p *ChainParams) BlockSizeLimit() int {
+	if p.MaxBlockSize == 0 {
+		return DefaultMaxBlockSize
+	}
+	return p.MaxBlockSize
+}
+
+// LastCheckpoint returns the highest checkpoint, or nil if there are none
+func (p *ChainParams) LastCheckpoint() *Checkpoint {
+	if len(p.Checkpoints) == 0 {
+		return nil
+	}
+
+	last := &p.Checkpoints[0]
+	for i := range p.Checkpoints {
+		if p.Checkpoints[i].Height > last.Height {
+			last = &p.Checkpoints[i]
+		}
+	}
+	return last
+}
+
+// WithCheckpoints returns a copy of the parameters with extra checkpoints,
+// such as those an operator configures. An extra checkpoint may repeat a
+// built-in one but not contradict it.
+func (p *ChainParams) WithCheckpoints(extra []Checkpoint) (*ChainParams, error) {
+	merged := *p
+	merged.Checkpoints = append([]Checkpoint(nil), p.Checkpoints...)
+	for _, cp := range extra {
+		if cp.Height <= 0 {
+			return nil, fmt.Errorf("invalid checkpoint height %d", cp.Height)
+		}
+		if existing := merged.CheckpointAt(cp.Height); existing != nil {
+			if existing.Hash != cp.Hash {
+				return nil, fmt.Errorf("checkpoint at height %d contradicts %x", cp.Height, existing.Hash)
+			}
+			continue
+		}
+		merged.Checkpoints = append(merged.Checkpoints, cp)
+	}
+	return &merged, nil
+}
+
+// CheckpointAt returns the checkpoint at the given height, if any
+func (p *ChainParams) CheckpointAt(height int) *Checkpoint {
+	for i := range p.Checkpoints {
+		if p.Checkpoints[i].Height == height {
+			return &p.Checkpoints[i]
+		}
+	}
+	return nil
+}
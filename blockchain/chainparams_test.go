@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestWithCheckpoints(t *testing.T) {
+	params := RegTestParams
+	params.Checkpoints = []Checkpoint{{Height: 10, Hash: [32]byte{1}}}
+
+	merged, err := params.WithCheckpoints([]Checkpoint{{Height: 10, Hash: [32]byte{1}}, {Height: 20, Hash: [32]byte{2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Checkpoints) != 2 || merged.LastCheckpoint().Height != 20 {
+		t.Errorf("merged checkpoints = %v", merged.Checkpoints)
+	}
+	if len(params.Checkpoints) != 1 {
+		t.Error("WithCheckpoints changed the original parameters")
+	}
+
+	for _, extra := range [][]Checkpoint{
+		{{Height: 10, Hash: [32]byte{3}}},
+		{{Height: 0, Hash: [32]byte{3}}},
+	} {
+		if _, err := params.WithCheckpoints(extra); err == nil {
+			t.Errorf("WithCheckpoints(%v) accepted", extra)
+		}
+	}
+}
+
+func TestCheckpointRejectsBlock(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	a1 := mineTestBlock(bc, genesis, "a1")
+	bc.params.Checkpoints = []Checkpoint{{Height: 1, Hash: a1.Hash}}
+
+	if err := bc.ProcessBlock(mineTestBlock(bc, genesis, "b1")); err == nil {
+		t.Error("block contradicting a checkpoint accepted")
+	}
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Errorf("checkpointed block rejected: %v", err)
+	}
+}
+
+func TestCheckpointSkipsSignatures(t *testing.T) {
+	_, script := newTestKey(t)
+	params := RegTestParams
+	bc := NewBlockchainWithParams(&params)
+	genesis := bc.GetLatestBlock()
+
+	mine := func(parent *Block, txs ...Transaction) *Block {
+		block := NewBlock(1, parent.Hash, bc.requiredDifficulty())
+		block.Timestamp = parent.Timestamp + 60
+		block.Transactions = append([]Transaction{*CreateCoinbase(uint64(params.BlockSubsidy(1)), script)}, txs...)
+		block.MerkleRoot = block.CalculateMerkleRoot()
+		block.Mine()
+		return block
+	}
+	b1 := mine(genesis)
+	// Spends b1's coinbase, which pays a key, without a signature
+	unsigned := NewTransaction(
+		[]TxInput{{PrevTxHash: b1.Transactions[0].Hash, Sequence: finalSequence}},
+		[]TxOutput{{Value: 1000, Script: []byte("payee")}},
+	)
+	b2 := mine(b1, *unsigned)
+	b3 := mine(b2)
+
+	if err := bc.ProcessBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ProcessBlock(b2); err == nil {
+		t.Fatal("unsigned spend accepted above the checkpoints")
+	}
+	params.Checkpoints = []Checkpoint{{Height: 3, Hash: b3.Hash}}
+	if err := bc.ProcessBlock(b2); err == nil {
+		t.Fatal("unsigned spend accepted below a checkpoint whose header is unknown")
+	}
+	if _, err := bc.ProcessHeaders([]BlockHeader{b2.Header(), b3.Header()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ProcessBlock(b2); err != nil {
+		t.Errorf("ancestor of a validated checkpoint rejected: %v", err)
+	}
+	if err := bc.ProcessBlock(b3); err != nil {
+		t.Errorf("checkpointed block rejected: %v", err)
+	}
+}
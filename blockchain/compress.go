@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EncodingGzip is the payload encoding of gzip-compressed messages. A
+// compressed payload is a JSON string of the base64 of the gzipped JSON.
+const EncodingGzip = "gzip"
+
+// compressThreshold is the smallest payload worth compressing
+const compressThreshold = 1024
+
+// maxDecompressedPayload bounds a decompressed payload, so a small message
+// can't expand without limit
+const maxDecompressedPayload = 32 << 20
+
+// compressPayload compresses a JSON payload
+func compressPayload(payload json.RawMessage) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(buf.Bytes())
+}
+
+// decompressPayload returns the JSON payload of a message with the given
+// encoding
+func decompressPayload(encoding string, payload json.RawMessage) (json.RawMessage, error) {
+	switch encoding {
+	case "":
+		return payload, nil
+	case EncodingGzip:
+	default:
+		return nil, fmt.Errorf("unknown payload encoding %q", encoding)
+	}
+
+	var compressed []byte
+	if err := json.Unmarshal(payload, &compressed); err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, maxDecompressedPayload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedPayload {
+		return nil, errors.New("decompressed payload too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompressPayload(t *testing.T) {
+	payload := json.RawMessage(`{"data":"` + strings.Repeat("ab", 4096) + `"}`)
+	compressed, err := compressPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(payload) {
+		t.Errorf("compressed %d bytes to %d", len(payload), len(compressed))
+	}
+	got, err := decompressPayload(EncodingGzip, compressed)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("decompressPayload = %.40s, %v", got, err)
+	}
+
+	if got, err := decompressPayload("", payload); err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("plain payload changed: %v", err)
+	}
+	if _, err := decompressPayload("zstd", compressed); err == nil {
+		t.Error("decoded an unknown encoding")
+	}
+	if _, err := decompressPayload(EncodingGzip, json.RawMessage(`"bm90IGd6aXA="`)); err == nil {
+		t.Error("decoded a payload that isn't gzip")
+	}
+
+	// A payload that expands past the limit is refused
+	huge, err := compressPayload(bytes.Repeat([]byte{' '}, maxDecompressedPayload+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompressPayload(EncodingGzip, huge); err == nil {
+		t.Error("decompressed a payload past the limit")
+	}
+}
@@ -15,8 +15,9 @@ const (
 	// BlockTime is the target time between blocks
 	BlockTime = 60 * time.Second
 	
-	// InitialBlockReward is the reward for mining a block
-	InitialBlockReward = 0.01
+	// InitialBlockReward is the main network's block subsidy before the
+	// first halving: 0.01 AIM. See ChainParams.BlockSubsidy.
+	InitialBlockReward = Coin / 100
 	
 	// MaximumSupply is the maximum number of coins that can exist
 	MaximumSupply = 1000000
@@ -36,7 +37,7 @@ var (
 	GenesisBlock = Block{
 		Version:    1,
 		Timestamp:  1640995200, // 2022-01-01 00:00:00 UTC
-		Difficulty: InitialDifficulty,
+		Bits:       DifficultyToCompact(InitialDifficulty),
 		Nonce:      0,
 		PrevHash:   [32]byte{},
 	}
@@ -44,13 +45,15 @@ var (
 
 // ConsensusParams contains the parameters for the consensus algorithm
 type ConsensusParams struct {
-	Algorithm           string
-	MergeminingEnabled bool
-	MinimumDifficulty  *big.Int
+	Algorithm          string   `json:"algorithm"`
+	MergeminingEnabled bool     `json:"mergemining_enabled"`
+	MinimumDifficulty  *big.Int `json:"minimum_difficulty"`
+	InitialDifficulty  *big.Int `json:"initial_difficulty,omitempty"`
 }
 
 var DefaultConsensusParams = ConsensusParams{
 	Algorithm:           "sha256",
 	MergeminingEnabled: true,
 	MinimumDifficulty:  big.NewInt(1000),
+	InitialDifficulty:  InitialDifficulty,
 }
@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// JSON encodings shared by every API and persisted type: amounts are
+// strings of base units, so clients never lose precision to floating
+// point, and hashes are fixed-length lowercase hex without a 0x prefix.
+// Decoding also accepts the encodings written by earlier versions, plain
+// numbers and arrays of bytes, so existing data files still load.
+
+// HashSize is the size of a hash in bytes
+const HashSize = 32
+
+// Hash is a SHA-256 hash of a block header or transaction
+type Hash [HashSize]byte
+
+// MarshalJSON encodes the hash as 64 hex digits
+func (h Hash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h[:]))
+}
+
+// UnmarshalJSON decodes a hash from hex, or from an array of bytes
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var bytes []int
+		if json.Unmarshal(data, &bytes) != nil || len(bytes) != HashSize {
+			return fmt.Errorf("invalid hash %s", data)
+		}
+		for i, b := range bytes {
+			if b < 0 || b > 0xFF {
+				return fmt.Errorf("invalid hash %s", data)
+			}
+			h[i] = byte(b)
+		}
+		return nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != HashSize {
+		return fmt.Errorf("invalid hash %q: want %d hex digits", s, 2*HashSize)
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// MarshalJSON encodes the amount as a string of base units
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(a), 10))
+}
+
+// UnmarshalJSON decodes an amount from a string of base units, or from a
+// number of base units
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	units, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w %s: want a whole number of base units", errInvalidAmount, data)
+	}
+	*a = Amount(units)
+	return nil
+}
+
+// txOutputJSON is the encoding of a transaction output, with its value as
+// an Amount
+type txOutputJSON struct {
+	Value  Amount `json:"Value"`
+	Script []byte `json:"Script"`
+}
+
+// MarshalJSON encodes the output's value as an amount
+func (o TxOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(txOutputJSON{Value: Amount(o.Value), Script: o.Script})
+}
+
+// UnmarshalJSON decodes an output whose value is an amount
+func (o *TxOutput) UnmarshalJSON(data []byte) error {
+	var v txOutputJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Value < 0 {
+		return fmt.Errorf("%w: negative output value", errInvalidAmount)
+	}
+	o.Value, o.Script = uint64(v.Value), v.Script
+	return nil
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{`"150000000"`, 150000000, false},
+		{`"-1"`, -1, false},
+		{`150000000`, 150000000, false}, // Written by earlier versions
+		{`"1.5"`, 0, true},
+		{`1.5`, 0, true},
+		{`"lots"`, 0, true},
+		{`null`, 0, true},
+	}
+	for _, tt := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Fee   Amount `json:"fee"`
+		Empty Amount `json:"empty,omitempty"`
+	}{Fee: 2 * Coin})
+	if err != nil || string(data) != `{"fee":"200000000"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
+
+func TestHashJSON(t *testing.T) {
+	var h Hash
+	h[0], h[31] = 0xAB, 0x01
+	data, err := json.Marshal(h)
+	want := `"ab` + strings.Repeat("0", 60) + `01"`
+	if err != nil || string(data) != want {
+		t.Fatalf("Marshal = %s, %v, want %s", data, err, want)
+	}
+
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{want, false},
+		{`[171` + strings.Repeat(",0", 30) + `,1]`, false}, // Written by earlier versions
+		{`"AB` + strings.Repeat("0", 60) + `01"`, false},
+		{`"0xab` + strings.Repeat("0", 60) + `01"`, true},
+		{`"ab01"`, true},
+		{`[1,2,3]`, true},
+	}
+	for _, tt := range tests {
+		var got Hash
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v", tt.in, err)
+			continue
+		}
+		if !tt.wantErr && got != h {
+			t.Errorf("Unmarshal(%s) = %x, want %x", tt.in, got, h)
+		}
+	}
+}
+
+func TestTransactionJSONRoundTrip(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: Hash{1}, PrevTxIndex: 2, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 5 * uint64(Coin), Script: []byte("alice")}},
+	)
+	tx.Hash = tx.CalculateHash()
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Value":"500000000"`) {
+		t.Errorf("output value not encoded as an amount: %s", data)
+	}
+	var decoded Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CalculateHash() != tx.Hash || decoded.Hash != tx.Hash {
+		t.Errorf("round trip changed the transaction: %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Value":"-1","Script":null}`), &TxOutput{}); err == nil {
+		t.Error("decoded a negative output value")
+	}
+}
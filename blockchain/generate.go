@@ -0,0 +1,75 @@
+package blockchain
+
+import "errors"
+
+var (
+	// ErrMiningOnDemandDisabled is returned by GenerateBlock on networks
+	// that don't mine blocks on demand
+	ErrMiningOnDemandDisabled = errors.New("network does not mine blocks on demand")
+
+	// ErrNotInMempool is returned by GenerateBlock for a transaction that
+	// isn't in the mempool
+	ErrNotInMempool = errors.New("transaction not in mempool")
+)
+
+// GenerateBlock mines a block on the tip paying the subsidy and fees to
+// coinbaseScript and connects it. With txids nil the block takes mempool
+// transactions as NewBlockTemplate does; otherwise it holds exactly the
+// listed mempool transactions, in order, and fails if any of them doesn't
+// fit. The block is mined under the chain lock, so only networks with
+// MineBlocksOnDemand allow it.
+func (bc *Blockchain) GenerateBlock(coinbaseScript []byte, txids [][32]byte) (*Block, error) {
+	if !bc.params.MineBlocksOnDemand {
+		return nil, ErrMiningOnDemandDisabled
+	}
+
+	bc.mu.Lock()
+	block, notifications, err := bc.generateBlock(coinbaseScript, txids)
+	bc.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range notifications {
+		bc.sendNotification(n.Type, n.Data)
+	}
+	return block, nil
+}
+
+// generateBlock implements GenerateBlock; the caller must hold bc.mu
+func (bc *Blockchain) generateBlock(coinbaseScript []byte, txids [][32]byte) (*Block, []*Notification, error) {
+	candidates, strict := bc.mempool, false
+	if txids != nil {
+		candidates, strict = make([]*Transaction, 0, len(txids)), true
+		for _, txid := range txids {
+			tx := bc.mempoolTx(txid)
+			if tx == nil {
+				return nil, nil, ErrNotInMempool
+			}
+			candidates = append(candidates, tx)
+		}
+	}
+
+	block, err := bc.newBlockTemplate(coinbaseScript, candidates, strict)
+	if err != nil {
+		return nil, nil, err
+	}
+	block.Mine()
+
+	notifications, err := bc.processBlock(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, notifications, nil
+}
+
+// mempoolTx returns the mempool transaction with the given hash, or nil;
+// the caller must hold bc.mu
+func (bc *Blockchain) mempoolTx(hash [32]byte) *Transaction {
+	for _, tx := range bc.mempool {
+		if tx.Hash == hash {
+			return tx
+		}
+	}
+	return nil
+}
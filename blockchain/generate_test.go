@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateBlock(t *testing.T) {
+	if _, err := newTestChain().GenerateBlock([]byte("miner"), nil); err != ErrMiningOnDemandDisabled {
+		t.Fatalf("mainnet generated a block: %v", err)
+	}
+
+	bc := NewBlockchainWithParams(&RegTestParams)
+	var coinbases [][32]byte
+	for i := 1; i <= 3; i++ {
+		block, err := bc.GenerateBlock([]byte("miner"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bc.Height() != i || bc.TipHash() != block.Hash {
+			t.Fatalf("block %d not connected", i)
+		}
+		coinbase := block.Transactions[0]
+		if !bytes.Equal(coinbase.Outputs[0].Script, []byte("miner")) {
+			t.Errorf("block %d pays %q", i, coinbase.Outputs[0].Script)
+		}
+		coinbases = append(coinbases, coinbase.Hash)
+	}
+	if coinbases[0] == coinbases[1] || coinbases[1] == coinbases[2] {
+		t.Error("coinbases at different heights share a hash")
+	}
+
+	// Only the listed mempool transactions are mined
+	spend := func(prev [32]byte) *Transaction {
+		return NewTransaction(
+			[]TxInput{{PrevTxHash: prev, Sequence: 0xFFFFFFFF}},
+			[]TxOutput{{Value: 1, Script: []byte("payee")}},
+		)
+	}
+	first, second := spend(coinbases[0]), spend(coinbases[1])
+	bc.addToMempool(first, second)
+	block, err := bc.GenerateBlock([]byte("miner"), [][32]byte{second.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].Hash != second.Hash {
+		t.Errorf("block has %d transactions, want the coinbase and the listed one", len(block.Transactions))
+	}
+	if bc.MempoolSize() != 1 {
+		t.Errorf("mempool has %d transactions, want 1", bc.MempoolSize())
+	}
+
+	if _, err := bc.GenerateBlock([]byte("miner"), [][32]byte{second.Hash}); err != ErrNotInMempool {
+		t.Errorf("mined transaction still listed: %v", err)
+	}
+	bc.addToMempool(spend([32]byte{9}))
+	if _, err := bc.GenerateBlock([]byte("miner"), [][32]byte{bc.mempool[1].Hash}); err == nil {
+		t.Error("unspendable transaction mined")
+	}
+
+	// Without a list every mempool transaction that fits is mined
+	block, err = bc.GenerateBlock([]byte("miner"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].Hash != first.Hash {
+		t.Errorf("block has %d transactions, want the coinbase and the spendable one", len(block.Transactions))
+	}
+}
@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Wallets derive their keys from a seed as in BIP 32, over P-256 as
+// SLIP-0010 specifies, so a seed restores every key of the wallet. Keys are
+// found at derivation paths such as m/44'/1033'/0'/0/5, where ' marks
+// hardened indexes, whose keys can't be derived from the parent public key.
+
+// HardenedKeyStart is the first hardened child index
+const HardenedKeyStart = 0x80000000
+
+// Bounds on seed lengths, in bytes
+const (
+	MinSeedSize = 16
+	MaxSeedSize = 64
+)
+
+// slip10Curve is the SLIP-0010 HMAC key of P-256 master keys
+var slip10Curve = []byte("Nist256p1 seed")
+
+// ErrHardenedPublic is returned when deriving a hardened child from an
+// extended public key
+var ErrHardenedPublic = errors.New("can't derive a hardened child from a public key")
+
+// ExtendedKey is a key that derives child keys: a private key, or only its
+// public key, with a chain code
+type ExtendedKey struct {
+	private   *ecdsa.PrivateKey // Nil for an extended public key
+	public    *ecdsa.PublicKey
+	chainCode [32]byte
+}
+
+// NewMasterKey returns the master key of a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < MinSeedSize || len(seed) > MaxSeedSize {
+		return nil, fmt.Errorf("seed must be %d to %d bytes", MinSeedSize, MaxSeedSize)
+	}
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, slip10Curve)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		d := new(big.Int).SetBytes(sum[:32])
+		if d.Sign() > 0 && d.Cmp(curveOrder) < 0 {
+			return newPrivateExtendedKey(d, sum[32:]), nil
+		}
+		data = sum
+	}
+}
+
+// MnemonicSeed returns the seed of a BIP 39 mnemonic and passphrase. The
+// words aren't checked against the BIP 39 word list.
+func MnemonicSeed(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+// newPrivateExtendedKey returns the extended key of scalar d
+func newPrivateExtendedKey(d *big.Int, chainCode []byte) *ExtendedKey {
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = elliptic.P256()
+	key.X, key.Y = key.Curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	k := &ExtendedKey{private: key, public: &key.PublicKey}
+	copy(k.chainCode[:], chainCode)
+	return k
+}
+
+// Child derives the child key at index i. Extended public keys only
+// derive public keys, at indexes below HardenedKeyStart.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	hardened := i >= HardenedKeyStart
+	if hardened && k.private == nil {
+		return nil, ErrHardenedPublic
+	}
+	var data []byte
+	if hardened {
+		data = append([]byte{0}, k.private.D.FillBytes(make([]byte, 32))...)
+	} else {
+		data = elliptic.MarshalCompressed(elliptic.P256(), k.public.X, k.public.Y)
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	curve := elliptic.P256()
+	for {
+		mac := hmac.New(sha512.New, k.chainCode[:])
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+		if il.Cmp(curveOrder) < 0 {
+			if k.private != nil {
+				d := il.Add(il, k.private.D)
+				d.Mod(d, curveOrder)
+				if d.Sign() > 0 {
+					return newPrivateExtendedKey(d, chainCode), nil
+				}
+			} else {
+				x, y := curve.ScalarBaseMult(sum[:32])
+				x, y = curve.Add(x, y, k.public.X, k.public.Y)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					child := &ExtendedKey{public: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}
+					copy(child.chainCode[:], chainCode)
+					return child, nil
+				}
+			}
+		}
+		// Invalid keys, with odds below 2^-127, are skipped as SLIP-0010
+		// specifies
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, chainCode...), i)
+	}
+}
+
+// Derive derives the key at a path relative to k
+func (k *ExtendedKey) Derive(path DerivationPath) (*ExtendedKey, error) {
+	key := k
+	for _, i := range path {
+		var err error
+		if key, err = key.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Public returns the extended public key of k
+func (k *ExtendedKey) Public() *ExtendedKey {
+	return &ExtendedKey{public: k.public, chainCode: k.chainCode}
+}
+
+// PublicKey returns the public key
+func (k *ExtendedKey) PublicKey() *ecdsa.PublicKey {
+	return k.public
+}
+
+// PrivateKey returns the private key, or nil for an extended public key
+func (k *ExtendedKey) PrivateKey() *ecdsa.PrivateKey {
+	return k.private
+}
+
+// EncodePublic returns the extended public key in hex: the chain code
+// followed by the compressed public key
+func (k *ExtendedKey) EncodePublic() string {
+	return hex.EncodeToString(append(k.chainCode[:], elliptic.MarshalCompressed(elliptic.P256(), k.public.X, k.public.Y)...))
+}
+
+// DecodeExtendedPublicKey decodes an extended public key in the format of
+// EncodePublic
+func DecodeExtendedPublicKey(s string) (*ExtendedKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != 32+33 {
+		return nil, errors.New("invalid extended public key")
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data[32:])
+	if x == nil {
+		return nil, errors.New("invalid extended public key")
+	}
+	k := &ExtendedKey{public: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}
+	copy(k.chainCode[:], data[:32])
+	return k, nil
+}
+
+// DerivationPath is a sequence of child indexes from a master key
+type DerivationPath []uint32
+
+// ParseDerivationPath parses a path such as m/44'/1033'/0', with ' or h
+// marking hardened indexes
+func ParseDerivationPath(s string) (DerivationPath, error) {
+	parts := strings.Split(s, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q doesn't start at m", s)
+	}
+	path := DerivationPath{}
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		i, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || i >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid index %q in derivation path %q", part, s)
+		}
+		if hardened {
+			i += HardenedKeyStart
+		}
+		path = append(path, uint32(i))
+	}
+	return path, nil
+}
+
+// String formats the path as ParseDerivationPath takes it, with '
+// marking hardened indexes
+func (p DerivationPath) String() string {
+	s := "m"
+	for _, i := range p {
+		if i >= HardenedKeyStart {
+			s += fmt.Sprintf("/%d'", i-HardenedKeyStart)
+		} else {
+			s += fmt.Sprintf("/%d", i)
+		}
+	}
+	return s
+}
+
+// Child returns the path of child i
+func (p DerivationPath) Child(i uint32) DerivationPath {
+	return append(append(DerivationPath{}, p...), i)
+}
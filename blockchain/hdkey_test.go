@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"testing"
+)
+
+func TestExtendedKeySLIP10(t *testing.T) {
+	// SLIP-0010 test vector 1 for nist256p1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path      string
+		chainCode string
+		private   string
+		public    string
+	}{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+			"0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+			"0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+		{"m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129",
+			"03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+	}
+	for _, tt := range tests {
+		path, err := ParseDerivationPath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public := elliptic.MarshalCompressed(elliptic.P256(), key.public.X, key.public.Y)
+		if got := hex.EncodeToString(key.chainCode[:]); got != tt.chainCode {
+			t.Errorf("%s: chain code = %s, want %s", tt.path, got, tt.chainCode)
+		}
+		if got := hex.EncodeToString(key.private.D.FillBytes(make([]byte, 32))); got != tt.private {
+			t.Errorf("%s: private key = %s, want %s", tt.path, got, tt.private)
+		}
+		if got := hex.EncodeToString(public); got != tt.public {
+			t.Errorf("%s: public key = %s, want %s", tt.path, got, tt.public)
+		}
+	}
+}
+
+func TestExtendedPublicKeyDerivation(t *testing.T) {
+	// BIP 39 test vector, with passphrase TREZOR
+	seed := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon  about", "TREZOR")
+	if got := hex.EncodeToString(seed); got != "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" {
+		t.Fatalf("mnemonic seed = %s", got)
+	}
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountPath, _ := ParseDerivationPath("m/44h/1033'/0'")
+	account, err := master.Derive(accountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := DecodeExtendedPublicKey(account.Public().EncodePublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Public derivation finds the keys of private derivation
+	path := DerivationPath{0, 7}
+	private, _ := account.Derive(path)
+	public, err := xpub.Derive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.PrivateKey() != nil || !public.PublicKey().Equal(private.PublicKey()) {
+		t.Error("public derivation differs from private derivation")
+	}
+	if _, err := xpub.Child(HardenedKeyStart); err != ErrHardenedPublic {
+		t.Errorf("hardened child of a public key: %v", err)
+	}
+	if got := accountPath.Child(1).String(); got != "m/44'/1033'/0'/1" {
+		t.Errorf("path = %s", got)
+	}
+
+	for _, s := range []string{"44'/0'", "m/x", "m/2147483648", "m/1''"} {
+		if _, err := ParseDerivationPath(s); err == nil {
+			t.Errorf("derivation path %q accepted", s)
+		}
+	}
+	if _, err := NewMasterKey(make([]byte, MinSeedSize-1)); err == nil {
+		t.Error("short seed accepted")
+	}
+}
@@ -0,0 +1,269 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrHeadersNotConnected is returned when a header batch does not
+	// build on any block we know about
+	ErrHeadersNotConnected = errors.New("headers do not connect to known chain")
+
+	// ErrForkBelowCheckpoint is returned when a header chain forks off the
+	// main chain at or below the last checkpoint
+	ErrForkBelowCheckpoint = errors.New("header chain forks below last checkpoint")
+
+	// ErrInsufficientChainWork is returned when a header chain does not
+	// reach the minimum chain work
+	ErrInsufficientChainWork = errors.New("header chain has insufficient work")
+)
+
+// BlockHeader contains the proof-of-work relevant fields of a block
+type BlockHeader struct {
+	Version    uint32 `json:"version"`
+	Timestamp  int64  `json:"timestamp"`
+	PrevHash   Hash   `json:"prev_hash"`
+	MerkleRoot Hash   `json:"merkle_root"`
+	Bits       uint32 `json:"bits"`
+	Nonce      uint32 `json:"nonce"`
+	Hash       Hash   `json:"hash"`
+}
+
+// Header returns the header of the block
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Version:    b.Version,
+		Timestamp:  b.Timestamp,
+		PrevHash:   b.PrevHash,
+		MerkleRoot: b.MerkleRoot,
+		Bits:       b.Bits,
+		Nonce:      b.Nonce,
+		Hash:       b.Hash,
+	}
+}
+
+// toBlock returns a transaction-less block carrying the header fields
+func (h *BlockHeader) toBlock() *Block {
+	return &Block{
+		Version:    h.Version,
+		Timestamp:  h.Timestamp,
+		PrevHash:   h.PrevHash,
+		MerkleRoot: h.MerkleRoot,
+		Bits:       h.Bits,
+		Nonce:      h.Nonce,
+		Hash:       h.Hash,
+	}
+}
+
+// CalcWork returns the expected number of hashes needed to find a block
+// at the given compact bits: 2^256 / (target + 1)
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToTarget(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	return target.Div(oneLsh256, target.Add(target, big.NewInt(1)))
+}
+
+// HeaderSyncResult describes the outcome of processing a batch of headers
+type HeaderSyncResult struct {
+	ForkHeight int      // Height of the last main-chain block the headers build on
+	TipHeight  int      // Height of the last header in the batch
+	TipHash    [32]byte // Hash of the last header in the batch
+	ChainWork  *big.Int // Cumulative work of the chain ending in the last header
+}
+
+// ProcessHeaders validates a batch of headers received during header sync.
+// Headers must be contiguous, connect to the main chain, carry valid proof
+// of work, agree with all checkpoints and not fork below the last
+// checkpoint. A chain whose cumulative work is below the minimum chain work
+// is reported with ErrInsufficientChainWork so callers don't download it.
+func (bc *Blockchain) ProcessHeaders(headers []BlockHeader) (*HeaderSyncResult, error) {
+	if len(headers) == 0 {
+		return nil, errors.New("empty headers message")
+	}
+	if len(headers) > bc.params.MaxHeadersPerMsg {
+		return nil, fmt.Errorf("too many headers: %d > %d", len(headers), bc.params.MaxHeadersPerMsg)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	// Find the block the first header builds on
+	forkHeight := -1
+	for i := len(bc.blocks) - 1; i >= 0; i-- {
+		if bc.blocks[i].Hash == headers[0].PrevHash {
+			forkHeight = i
+			break
+		}
+	}
+	if forkHeight < 0 {
+		return nil, ErrHeadersNotConnected
+	}
+
+	// Reject reorgs that would rewrite history below the last checkpoint
+	if cp := bc.params.LastCheckpoint(); cp != nil && forkHeight < cp.Height && forkHeight < len(bc.blocks)-1 {
+		return nil, ErrForkBelowCheckpoint
+	}
+
+	chainWork := new(big.Int).Set(bc.index[bc.blocks[forkHeight].Hash].chainWork)
+
+	prevHash := headers[0].PrevHash
+	height := forkHeight
+	for i := range headers {
+		header := &headers[i]
+		height++
+
+		if header.PrevHash != prevHash {
+			return nil, fmt.Errorf("header %d does not connect to previous header", i)
+		}
+		if err := bc.checkHeaderDifficulty(header); err != nil {
+			return nil, fmt.Errorf("header %d: %v", i, err)
+		}
+
+		block := header.toBlock()
+		if block.CalculateHash() != header.Hash || !block.ValidatePoW() {
+			return nil, fmt.Errorf("header %d has invalid proof of work", i)
+		}
+
+		if cp := bc.params.CheckpointAt(height); cp != nil && cp.Hash != header.Hash {
+			return nil, fmt.Errorf("header at height %d contradicts checkpoint", height)
+		}
+		bc.recordHeader(header, height)
+
+		chainWork.Add(chainWork, CalcWork(header.Bits))
+		prevHash = header.Hash
+	}
+
+	result := &HeaderSyncResult{
+		ForkHeight: forkHeight,
+		TipHeight:  height,
+		TipHash:    prevHash,
+		ChainWork:  chainWork,
+	}
+
+	if chainWork.Cmp(bc.params.MinimumChainWork) < 0 {
+		return result, ErrInsufficientChainWork
+	}
+
+	return result, nil
+}
+
+// recordHeader remembers a validated header up to the last checkpoint.
+// Once the header chain reaches a checkpoint, the unconnected blocks it
+// passes through are assumed valid, and checkBlockTransactions skips their
+// signatures. The caller must hold bc.mu for writing.
+func (bc *Blockchain) recordHeader(header *BlockHeader, height int) {
+	if last := bc.params.LastCheckpoint(); last == nil || height > last.Height {
+		return
+	}
+	bc.headers[header.Hash] = header.PrevHash
+	if cp := bc.params.CheckpointAt(height); cp == nil || cp.Hash != header.Hash {
+		return
+	}
+	for hash := header.Hash; !bc.assumed[hash]; {
+		parent, ok := bc.headers[hash]
+		if !ok {
+			return
+		}
+		bc.assumed[hash] = true
+		hash = parent
+	}
+}
+
+// assumedValid reports whether the signatures of a block connected at
+// height need no verifying: it is a checkpoint, or an ancestor of a
+// checkpoint header already validated. The caller must hold bc.mu.
+func (bc *Blockchain) assumedValid(block *Block, height int) bool {
+	if cp := bc.params.CheckpointAt(height); cp != nil && cp.Hash == block.Hash {
+		return true
+	}
+	return bc.assumed[block.Hash]
+}
+
+// requiredDifficulty returns the difficulty a block must carry. The chain
+// does not retarget yet, so every block carries the chain difficulty.
+func (bc *Blockchain) requiredDifficulty() *big.Int {
+	return bc.difficulty
+}
+
+// checkHeaderDifficulty rejects headers whose claimed target is easier than
+// the consensus minimum difficulty or the chain's required difficulty allow.
+// Without this a peer could claim difficulty 1, whose target makes any hash
+// valid. Targets are compared after compact encoding, the precision blocks
+// carry them at.
+func (bc *Blockchain) checkHeaderDifficulty(header *BlockHeader) error {
+	target := CompactToTarget(header.Bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("invalid bits %08x", header.Bits)
+	}
+	if min := bc.params.Consensus.MinimumDifficulty; min != nil && target.Cmp(CompactToTarget(DifficultyToCompact(min))) > 0 {
+		return fmt.Errorf("difficulty %v below consensus minimum %v", header.Difficulty(), min)
+	}
+	if required := bc.requiredDifficulty(); target.Cmp(CompactToTarget(DifficultyToCompact(required))) > 0 {
+		return fmt.Errorf("difficulty %v below required %v", header.Difficulty(), required)
+	}
+	return nil
+}
+
+// GetHeaders returns up to max headers following the first locator hash
+// found in the main chain. An empty or unknown locator starts after genesis.
+func (bc *Blockchain) GetHeaders(locator [][32]byte, max int) []BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	headers := make([]BlockHeader, 0)
+	for i := bc.locate(locator) + 1; i < len(bc.blocks) && len(headers) < max; i++ {
+		headers = append(headers, bc.blocks[i].Header())
+	}
+	return headers
+}
+
+// GetBlocksAfter returns up to max main-chain blocks following the first
+// locator hash found, like GetHeaders. The blocks are shared and must not
+// be modified.
+func (bc *Blockchain) GetBlocksAfter(locator [][32]byte, max int) []*Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	blocks := make([]*Block, 0)
+	for i := bc.locate(locator) + 1; i < len(bc.blocks) && len(blocks) < max; i++ {
+		blocks = append(blocks, bc.blocks[i])
+	}
+	return blocks
+}
+
+// locate returns the main-chain height of the first locator hash found, or
+// 0 for genesis if none is; the caller must hold bc.mu
+func (bc *Blockchain) locate(locator [][32]byte) int {
+	for _, hash := range locator {
+		for i := len(bc.blocks) - 1; i >= 0; i-- {
+			if bc.blocks[i].Hash == hash {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// BlockLocator returns a list of main-chain hashes from the tip backwards,
+// dense at first and exponentially sparser, ending with the genesis block
+func (bc *Blockchain) BlockLocator() [][32]byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	locator := make([][32]byte, 0)
+	step := 1
+	for i := len(bc.blocks) - 1; i > 0; i -= step {
+		locator = append(locator, bc.blocks[i].Hash)
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	if len(bc.blocks) > 0 {
+		locator = append(locator, bc.blocks[0].Hash)
+	}
+	return locator
+}
@@ -0,0 +1,35 @@
+package blockchain
+
+import "testing"
+
+func TestGetBlocksAfter(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	for i := 0; i < 4; i++ {
+		if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks := bc.GetBlocks()
+
+	tests := []struct {
+		locator [][32]byte
+		max     int
+		first   int
+		count   int
+	}{
+		{nil, 10, 1, 4},
+		{[][32]byte{blocks[2].Hash}, 10, 3, 2},
+		{[][32]byte{{9}, blocks[1].Hash}, 2, 2, 2},
+		{[][32]byte{blocks[4].Hash}, 10, 0, 0},
+	}
+	for _, tt := range tests {
+		got := bc.GetBlocksAfter(tt.locator, tt.max)
+		if len(got) != tt.count {
+			t.Errorf("GetBlocksAfter(%x) returned %d blocks, want %d", tt.locator, len(got), tt.count)
+			continue
+		}
+		if tt.count > 0 && got[0] != blocks[tt.first] {
+			t.Errorf("GetBlocksAfter(%x) starts at the wrong block", tt.locator)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package blockchain
+
+import (
+	"errors"
+	"log"
+	"math/big"
+)
+
+var (
+	// ErrUnknownBlock is returned for a block hash the chain doesn't know
+	ErrUnknownBlock = errors.New("block not found")
+
+	// ErrInvalidAncestor is returned for a block that builds on a block
+	// marked invalid
+	ErrInvalidAncestor = errors.New("block builds on an invalid block")
+)
+
+// InvalidateBlock marks a block and all its descendants invalid, as if it
+// had failed validation. If the block is on the main chain, the chain is
+// rolled back to its parent and then switches to the known branch with the
+// most work that doesn't include it. Subscribers are notified as for any
+// reorganization. The genesis block can't be invalidated.
+func (bc *Blockchain) InvalidateBlock(hash [32]byte) error {
+	bc.mu.Lock()
+	notifications, err := bc.invalidateBlock(hash)
+	bc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		bc.sendNotification(n.Type, n.Data)
+	}
+	return nil
+}
+
+// invalidateBlock marks a block invalid; the caller must hold bc.mu
+func (bc *Blockchain) invalidateBlock(hash [32]byte) ([]*Notification, error) {
+	height := bc.mainChainHeight(hash)
+	if height == 0 {
+		return nil, errors.New("cannot invalidate the genesis block")
+	}
+	if height < 0 && bc.sideBlocks[hash] == nil {
+		return nil, ErrUnknownBlock
+	}
+
+	bc.invalid[hash] = true
+	if height < 0 {
+		bc.markDescendantsInvalid()
+		return nil, nil
+	}
+
+	for _, b := range bc.blocks[height+1:] {
+		bc.invalid[b.Hash] = true
+	}
+	bc.markDescendantsInvalid()
+
+	// Every main chain block from height on is gone, so any valid branch
+	// with more work than the blocks below it wins
+	forkHeight, branch := bc.validBestBranch(height - 1)
+	if branch == nil {
+		forkHeight = height - 1
+	}
+	return bc.reorganize(forkHeight, branch), nil
+}
+
+// ReconsiderBlock removes the invalid mark from a block, its ancestors and
+// its descendants, undoing InvalidateBlock, and switches to its branch if
+// that now has the most work.
+func (bc *Blockchain) ReconsiderBlock(hash [32]byte) error {
+	bc.mu.Lock()
+	notifications, err := bc.reconsiderBlock(hash)
+	bc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		bc.sendNotification(n.Type, n.Data)
+	}
+	return nil
+}
+
+// reconsiderBlock clears invalid marks; the caller must hold bc.mu
+func (bc *Blockchain) reconsiderBlock(hash [32]byte) ([]*Notification, error) {
+	if bc.mainChainHeight(hash) < 0 && bc.sideBlocks[hash] == nil {
+		return nil, ErrUnknownBlock
+	}
+
+	for b := bc.sideBlocks[hash]; b != nil; b = bc.sideBlocks[b.PrevHash] {
+		delete(bc.invalid, b.Hash)
+	}
+	delete(bc.invalid, hash)
+	for h, b := range bc.sideBlocks {
+		if bc.isDescendant(b, hash) {
+			delete(bc.invalid, h)
+		}
+	}
+
+	forkHeight, branch := bc.validBestBranch(len(bc.blocks) - 1)
+	if branch == nil {
+		return nil, nil
+	}
+	return bc.reorganize(forkHeight, branch), nil
+}
+
+// IsInvalid reports whether a block has been marked invalid
+func (bc *Blockchain) IsInvalid(hash [32]byte) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.invalid[hash]
+}
+
+// markDescendantsInvalid marks every side block building on an invalid
+// block invalid; the caller must hold bc.mu
+func (bc *Blockchain) markDescendantsInvalid() {
+	for marked := true; marked; {
+		marked = false
+		for hash, b := range bc.sideBlocks {
+			if !bc.invalid[hash] && bc.invalid[b.PrevHash] {
+				bc.invalid[hash] = true
+				marked = true
+			}
+		}
+	}
+}
+
+// isDescendant reports whether side block b builds on ancestor; the
+// caller must hold bc.mu
+func (bc *Blockchain) isDescendant(b *Block, ancestor [32]byte) bool {
+	for ; b != nil; b = bc.sideBlocks[b.PrevHash] {
+		if b.Hash == ancestor || b.PrevHash == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// bestBranch returns the valid side branch with the most work beyond the
+// main chain up to limit, and the height it forks off at. Main chain
+// blocks above limit are treated as gone. It returns a nil branch if no
+// side branch has more work; the caller must hold bc.mu.
+func (bc *Blockchain) bestBranch(limit int) (int, []*Block) {
+	bestFork, bestGain := -1, big.NewInt(0)
+	var best []*Block
+
+	for hash := range bc.sideBlocks {
+		if bc.invalid[hash] {
+			continue
+		}
+
+		branch := []*Block{bc.sideBlocks[hash]}
+		forkHeight := bc.mainChainHeight(branch[0].PrevHash)
+		for forkHeight < 0 {
+			parent := bc.sideBlocks[branch[0].PrevHash]
+			if parent == nil || bc.invalid[parent.Hash] {
+				break
+			}
+			branch = append([]*Block{parent}, branch...)
+			forkHeight = bc.mainChainHeight(parent.PrevHash)
+		}
+		if forkHeight < 0 || forkHeight > limit {
+			continue
+		}
+		if cp := bc.params.LastCheckpoint(); cp != nil && forkHeight < cp.Height {
+			continue
+		}
+
+		gain := new(big.Int).Sub(bc.index[hash].chainWork, bc.index[bc.blocks[limit].Hash].chainWork)
+		if gain.Cmp(bestGain) > 0 {
+			bestFork, bestGain, best = forkHeight, gain, branch
+		}
+	}
+	return bestFork, best
+}
+
+// validBestBranch returns bestBranch(limit) once its blocks pass
+// checkBranch. Branches that fail are marked invalid and the next best is
+// tried. The caller must hold bc.mu for writing.
+func (bc *Blockchain) validBestBranch(limit int) (int, []*Block) {
+	for {
+		forkHeight, branch := bc.bestBranch(limit)
+		if branch == nil {
+			return forkHeight, nil
+		}
+		if err := bc.checkBranch(forkHeight, branch); err != nil {
+			log.Printf("Not switching to invalid branch: %v", err)
+			continue
+		}
+		return forkHeight, branch
+	}
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// mineTestBlock mines a block on parent whose coinbase pays tag
+func mineTestBlock(bc *Blockchain, parent *Block, tag string) *Block {
+	block := NewBlock(1, parent.Hash, bc.requiredDifficulty())
+	block.Timestamp = parent.Timestamp + 60
+	block.Transactions = []Transaction{*CreateCoinbase(uint64(bc.params.BlockSubsidy(1)), []byte(tag))}
+	block.MerkleRoot = block.CalculateMerkleRoot()
+	block.Mine()
+	return block
+}
+
+func TestInvalidateAndReconsiderBlock(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+
+	// Main chain genesis-a1-a2, side branch genesis-b1
+	a1 := mineTestBlock(bc, genesis, "a1")
+	a2 := mineTestBlock(bc, a1, "a2")
+	b1 := mineTestBlock(bc, genesis, "b1")
+	for _, b := range []*Block{a1, a2, b1} {
+		if err := bc.ProcessBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tip := bc.GetLatestBlock(); tip.Hash != a2.Hash {
+		t.Fatalf("tip = %x, want a2", tip.Hash)
+	}
+
+	var disconnected, connected int
+	bc.Subscribe(func(n *Notification) {
+		switch n.Type {
+		case NTBlockDisconnected:
+			disconnected++
+		case NTBlockConnected:
+			connected++
+		}
+	})
+
+	if err := bc.InvalidateBlock(a1.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if tip := bc.GetLatestBlock(); tip.Hash != b1.Hash {
+		t.Fatalf("after invalidate tip = %x, want b1", tip.Hash)
+	}
+	if disconnected != 2 || connected != 1 {
+		t.Errorf("notified %d disconnects and %d connects, want 2 and 1", disconnected, connected)
+	}
+	if !bc.IsInvalid(a1.Hash) || !bc.IsInvalid(a2.Hash) {
+		t.Error("invalidated block or its descendant not marked invalid")
+	}
+
+	// Blocks building on an invalid block are refused
+	a3 := mineTestBlock(bc, a2, "a3")
+	if err := bc.ProcessBlock(a3); err != ErrInvalidAncestor {
+		t.Errorf("block on invalid branch: err = %v, want ErrInvalidAncestor", err)
+	}
+
+	if err := bc.ReconsiderBlock(a1.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if bc.IsInvalid(a1.Hash) || bc.IsInvalid(a2.Hash) || bc.IsInvalid(a3.Hash) {
+		t.Error("reconsidered blocks still marked invalid")
+	}
+	// The refused a3 was kept, so its branch is the heaviest now
+	if tip := bc.GetLatestBlock(); tip.Hash != a3.Hash {
+		t.Fatalf("after reconsider tip = %x, want a3", tip.Hash)
+	}
+}
+
+func TestInvalidateBlockWithoutAlternative(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	a1 := mineTestBlock(bc, genesis, "a1")
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bc.InvalidateBlock(a1.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if bc.GetHeight() != 0 {
+		t.Errorf("height = %d, want 0", bc.GetHeight())
+	}
+
+	if err := bc.InvalidateBlock(genesis.Hash); err == nil {
+		t.Error("invalidated the genesis block")
+	}
+	if err := bc.InvalidateBlock([32]byte{1}); err != ErrUnknownBlock {
+		t.Errorf("unknown block: err = %v, want ErrUnknownBlock", err)
+	}
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// MedianTimeBlocks is the number of blocks whose median timestamp, the
+	// median time past, a new block's timestamp must exceed
+	MedianTimeBlocks = 11
+
+	// MaxFutureBlockTime is how far ahead of the network-adjusted time a
+	// block's timestamp may be
+	MaxFutureBlockTime = 2 * time.Hour
+)
+
+// medianTimePast returns the median timestamp of the MedianTimeBlocks
+// blocks ending in a known block, or of all of them near genesis, and 0
+// for an unknown block. The caller must hold bc.mu.
+func (bc *Blockchain) medianTimePast(hash [32]byte) int64 {
+	times := make([]int64, 0, MedianTimeBlocks)
+	for len(times) < MedianTimeBlocks {
+		if height := bc.mainChainHeight(hash); height >= 0 {
+			// A main chain block's ancestors are all on the main chain
+			for ; height >= 0 && len(times) < MedianTimeBlocks; height-- {
+				times = append(times, bc.blocks[height].Timestamp)
+			}
+			break
+		}
+		block := bc.sideBlocks[hash]
+		if block == nil {
+			break
+		}
+		times = append(times, block.Timestamp)
+		hash = block.PrevHash
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// MedianTimePast returns the median time past of the chain tip, which the
+// next block's timestamp must exceed
+func (bc *Blockchain) MedianTimePast() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.medianTimePast(bc.blocks[len(bc.blocks)-1].Hash)
+}
+
+// checkBlockTime checks that a block's timestamp is after the median time
+// past of its parent and at most MaxFutureBlockTime ahead of the
+// network-adjusted time, so miners can't skew it to manipulate difficulty
+// or lock times. A block from too far in the future may be valid later and
+// is not marked invalid. The caller must hold bc.mu.
+func (bc *Blockchain) checkBlockTime(block *Block) error {
+	if mtp := bc.medianTimePast(block.PrevHash); block.Timestamp <= mtp {
+		return fmt.Errorf("block time %d is not after the median time past %d", block.Timestamp, mtp)
+	}
+	if max := bc.timeSource.AdjustedTime().Add(MaxFutureBlockTime).Unix(); block.Timestamp > max {
+		return fmt.Errorf("block time %d is more than %v in the future", block.Timestamp, MaxFutureBlockTime)
+	}
+	return nil
+}
+
+// nextBlockTime returns the timestamp of a block built on the tip now: the
+// network-adjusted time, or just after the median time past if that is
+// later. The caller must hold bc.mu.
+func (bc *Blockchain) nextBlockTime() int64 {
+	now := bc.timeSource.AdjustedTime().Unix()
+	if mtp := bc.medianTimePast(bc.blocks[len(bc.blocks)-1].Hash); now <= mtp {
+		return mtp + 1
+	}
+	return now
+}
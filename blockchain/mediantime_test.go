@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedianTimePast(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	if mtp := bc.MedianTimePast(); mtp != genesis.Timestamp {
+		t.Errorf("median time past of genesis = %d, want %d", mtp, genesis.Timestamp)
+	}
+
+	// Blocks a minute apart, the last 11 from genesis+60s to genesis+660s
+	tip := genesis
+	for i := 0; i < 15; i++ {
+		tip = mineTestBlock(bc, tip, "a")
+		if err := bc.ProcessBlock(tip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtp := bc.MedianTimePast()
+	if want := tip.Timestamp - 5*60; mtp != want {
+		t.Errorf("median time past = %d, want %d", mtp, want)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		ok        bool
+	}{
+		{"at median time past", mtp, false},
+		{"after median time past", mtp + 1, true},
+		{"too far in the future", bc.TimeSource().AdjustedTime().Add(MaxFutureBlockTime + time.Minute).Unix(), false},
+	}
+	for _, tt := range tests {
+		block := mineTestBlock(bc, tip, tt.name)
+		block.Timestamp = tt.timestamp
+		block.Mine()
+		err := bc.ProcessBlock(block)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: ProcessBlock err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestBlockTemplateAfterMedianTimePast(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	// Blocks mined on demand share timestamps, so the median catches up
+	// with the clock and templates must move past it
+	for i := 0; i < 2*MedianTimeBlocks; i++ {
+		if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+			t.Fatalf("block %d: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// mempoolMinFeeHalfLife is how long it takes the fee rate raised by
+// mempool evictions to fall by half, back towards the relay minimum
+const mempoolMinFeeHalfLife = 12 * time.Hour
+
+// MempoolInfo describes the mempool and its limits
+type MempoolInfo struct {
+	Size       int    `json:"size"`
+	Bytes      int    `json:"bytes"`
+	MaxSize    int    `json:"max_size"`
+	MaxBytes   int    `json:"max_bytes"`
+	MinFeeRate Amount `json:"min_fee_rate"` // Per 1000 bytes, to enter the mempool
+	Evicted    uint64 `json:"evicted"`      // Transactions evicted since start
+}
+
+// MempoolInfo returns the mempool's size, limits and minimum fee rate
+func (bc *Blockchain) MempoolInfo() MempoolInfo {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return MempoolInfo{
+		Size:       len(bc.mempool),
+		Bytes:      bc.mempoolBytes,
+		MaxSize:    bc.policy.MaxMempoolTxs,
+		MaxBytes:   bc.policy.MaxMempoolSize,
+		MinFeeRate: bc.mempoolMinFeeRate(time.Now()),
+		Evicted:    bc.mempoolEvicted,
+	}
+}
+
+// addToMempool appends transactions to the mempool; the caller must hold
+// bc.mu
+func (bc *Blockchain) addToMempool(txs ...*Transaction) {
+	for _, tx := range txs {
+		bc.mempool = append(bc.mempool, tx)
+		bc.mempoolBytes += len(tx.Encode())
+		for _, in := range tx.Inputs {
+			bc.mempoolSpends[outpoint{in.PrevTxHash, in.PrevTxIndex}] = tx
+		}
+	}
+}
+
+// mempoolDescendants returns tx and the mempool transactions spending its
+// outputs, directly or through others; the caller must hold bc.mu
+func (bc *Blockchain) mempoolDescendants(tx *Transaction) []*Transaction {
+	found := map[Hash]bool{tx.Hash: true}
+	descendants := []*Transaction{tx}
+	for i := 0; i < len(descendants); i++ {
+		for j := range descendants[i].Outputs {
+			child := bc.mempoolSpends[outpoint{descendants[i].Hash, uint32(j)}]
+			if child != nil && !found[child.Hash] {
+				found[child.Hash] = true
+				descendants = append(descendants, child)
+			}
+		}
+	}
+	return descendants
+}
+
+// mempoolConflicts returns the mempool transactions spending an output a
+// transaction of block spends, other than the block's own transactions,
+// with their descendants; the caller must hold bc.mu
+func (bc *Blockchain) mempoolConflicts(block *Block) []*Transaction {
+	var conflicts []*Transaction
+	for _, tx := range blockTransactions(block) {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			spender := bc.mempoolSpends[outpoint{in.PrevTxHash, in.PrevTxIndex}]
+			if spender != nil && spender.Hash != tx.Hash {
+				conflicts = append(conflicts, bc.mempoolDescendants(spender)...)
+			}
+		}
+	}
+	return conflicts
+}
+
+// mempoolMinFeeRate returns the fee rate, per 1000 bytes, a transaction
+// needs to enter the mempool: the relay minimum, or more while the mempool
+// is full. Each eviction raises it above the evicted transaction's rate,
+// from where it decays with mempoolMinFeeHalfLife. The caller must hold
+// bc.mu.
+func (bc *Blockchain) mempoolMinFeeRate(now time.Time) Amount {
+	rate := bc.policy.MinRelayFeeRate
+	if bc.evictionFeeRate > rate {
+		halvings := float64(now.Sub(bc.evictionFeeTime)) / float64(mempoolMinFeeHalfLife)
+		if decayed := Amount(float64(bc.evictionFeeRate) * math.Pow(0.5, halvings)); decayed > rate {
+			rate = decayed
+		}
+	}
+	return rate
+}
+
+// trimMempool evicts the lowest fee rate transactions, with the mempool
+// transactions spending their outputs, until the mempool is within the
+// policy's limits. It returns the evicted transactions; the caller must
+// hold bc.mu.
+func (bc *Blockchain) trimMempool(now time.Time) []*Transaction {
+	count, size := len(bc.mempool), bc.mempoolBytes
+	if count <= bc.policy.MaxMempoolTxs && size <= bc.policy.MaxMempoolSize {
+		return nil
+	}
+
+	ranked := prioritizeTransactions(bc.mempool, bc.utxos)
+	evicted := make(map[Hash]bool)
+	var removed []*Transaction
+	for i := len(ranked) - 1; i >= 0; i-- {
+		if count <= bc.policy.MaxMempoolTxs && size <= bc.policy.MaxMempoolSize {
+			break
+		}
+		worst := ranked[i]
+		if evicted[worst.tx.Hash] {
+			continue
+		}
+		for _, tx := range bc.mempoolDescendants(worst.tx) {
+			if !evicted[tx.Hash] {
+				evicted[tx.Hash] = true
+				removed = append(removed, tx)
+				count--
+				size -= len(tx.Encode())
+			}
+		}
+		// Transactions paying no more than the evicted one would only
+		// replace it, so the mempool minimum rises above its rate
+		if rate := worst.rate + bc.policy.MinRelayFeeRate; rate > bc.mempoolMinFeeRate(now) {
+			bc.evictionFeeRate, bc.evictionFeeTime = rate, now
+		}
+	}
+
+	bc.removeFromMempool(removed)
+	bc.mempoolEvicted += uint64(len(removed))
+	log.Printf("Mempool full: evicted %d transactions, minimum fee rate now %s", len(removed), bc.mempoolMinFeeRate(now))
+	return removed
+}
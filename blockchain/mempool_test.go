@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMempoolEviction(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	funding, err := bc.GenerateBlock([]byte("funds"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "funds" and "payee" are no keys, so the spends need no signatures
+	split := NewTransaction(
+		[]TxInput{{PrevTxHash: funding.Transactions[0].Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 100000, Script: []byte("funds")}, {Value: 100000, Script: []byte("funds")}, {Value: 100000, Script: []byte("funds")}},
+	)
+	bc.addToMempool(split)
+	if _, err := bc.GenerateBlock([]byte("miner"), [][32]byte{split.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	spend := func(prev Hash, index uint32, value uint64) *Transaction {
+		return NewTransaction(
+			[]TxInput{{PrevTxHash: prev, PrevTxIndex: index, Sequence: 0xFFFFFFFF}},
+			[]TxOutput{{Value: value, Script: []byte("payee")}},
+		)
+	}
+
+	policy := bc.Policy()
+	policy.MaxMempoolTxs = 2
+	if err := bc.SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	parent := spend(split.Hash, 0, 98000)
+	child := spend(parent.Hash, 0, 78000) // Pays more than its parent
+	better := spend(split.Hash, 1, 90000)
+	for _, tx := range []*Transaction{parent, child, better} {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The lowest fee rate transaction went, with its child
+	if bc.mempoolTx(parent.Hash) != nil || bc.mempoolTx(child.Hash) != nil || bc.mempoolTx(better.Hash) == nil {
+		t.Error("eviction did not remove the parent with its child only")
+	}
+	info := bc.MempoolInfo()
+	if info.Size != 1 || info.Bytes != len(better.Encode()) || info.Evicted != 2 {
+		t.Errorf("mempool after eviction = %+v", info)
+	}
+	parentRate := Amount(2000).MulDiv(1000, int64(len(parent.Encode())))
+	// It decays from the moment of the eviction
+	if want := parentRate + policy.MinRelayFeeRate; info.MinFeeRate > want || info.MinFeeRate < want-want/100 {
+		t.Errorf("minimum fee rate = %s, want %s", info.MinFeeRate, want)
+	}
+
+	// Transactions paying no more than the evicted one are turned away
+	err = bc.AddTransaction(spend(split.Hash, 2, 98000))
+	if _, ok := err.(*PolicyError); !ok || !strings.Contains(err.Error(), "mempool minimum fee") {
+		t.Errorf("low fee transaction: err = %v, want mempool minimum fee error", err)
+	}
+
+	// The minimum decays back to the relay fee rate
+	bc.mu.RLock()
+	decayed := bc.mempoolMinFeeRate(bc.evictionFeeTime.Add(10 * mempoolMinFeeHalfLife))
+	bc.mu.RUnlock()
+	if decayed != policy.MinRelayFeeRate {
+		t.Errorf("minimum fee rate after 10 half-lives = %s, want %s", decayed, policy.MinRelayFeeRate)
+	}
+}
+
+func TestMempoolConflicts(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	funding, err := bc.GenerateBlock([]byte("funds"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0].Hash
+	spend := func(prev Hash, value uint64, script string) *Transaction {
+		return NewTransaction(
+			[]TxInput{{PrevTxHash: prev, Sequence: 0xFFFFFFFF}},
+			[]TxOutput{{Value: value, Script: []byte(script)}},
+		)
+	}
+
+	first := spend(coinbase, 100000, "alice")
+	child := spend(first.Hash, 90000, "carol")
+	if err := bc.AddTransaction(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(child); err != nil {
+		t.Fatal(err)
+	}
+	double := spend(coinbase, 100000, "bob")
+	if err := bc.AddTransaction(double); !errors.Is(err, ErrMempoolConflict) {
+		t.Fatalf("double spend: err = %v, want ErrMempoolConflict", err)
+	}
+	if outputs := bc.FindSpendableOutputs([]byte("funds")); len(outputs) != 0 {
+		t.Errorf("output spent in the mempool still spendable: %v", outputs)
+	}
+
+	// A block mining the double spend evicts the first spend and its child
+	block := NewBlock(1, funding.Hash, bc.requiredDifficulty())
+	block.Timestamp = funding.Timestamp + 60
+	block.Transactions = []Transaction{*bc.newCoinbase(2, 0, []byte("miner")), *double}
+	block.MerkleRoot = block.CalculateMerkleRoot()
+	block.Mine()
+	if err := bc.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if bc.MempoolSize() != 0 || len(bc.mempoolSpends) != 0 {
+		t.Errorf("%d transactions and %d spends left in the mempool, want none", bc.MempoolSize(), len(bc.mempoolSpends))
+	}
+	if info := bc.MempoolInfo(); info.Bytes != 0 {
+		t.Errorf("mempool bytes = %d, want 0", info.Bytes)
+	}
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// messagePrefix is prepended to signed messages, so a message signature
+// can never pass for a transaction signature
+const messagePrefix = "Alerim Signed Message:\n"
+
+// CompactSignatureSize is the size of a compact signature: a header byte
+// with the recovery ID, then r and s, 32 bytes each
+const CompactSignatureSize = 65
+
+// compactHeader is added to the recovery ID in a compact signature's first
+// byte
+const compactHeader = 27
+
+// MessageHash returns the hash signed by SignMessage
+func MessageHash(message string) [32]byte {
+	return sha256.Sum256([]byte(messagePrefix + message))
+}
+
+// SignMessage signs a message with a compact signature, from which
+// RecoverMessageKey recovers the public key
+func SignMessage(key *ecdsa.PrivateKey, message string) ([]byte, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("signing key is not a P-256 key")
+	}
+	r, s, recID := signHash(key, MessageHash(message))
+	sig := make([]byte, CompactSignatureSize)
+	sig[0] = compactHeader + recID
+	r.FillBytes(sig[1:33])
+	s.FillBytes(sig[33:])
+	return sig, nil
+}
+
+// RecoverMessageKey returns the public key that made a compact signature
+// of message. Any valid signature recovers some key, so the caller must
+// compare it with the key expected.
+func RecoverMessageKey(message string, sig []byte) (*ecdsa.PublicKey, error) {
+	if len(sig) != CompactSignatureSize || sig[0] < compactHeader || sig[0] > compactHeader+3 {
+		return nil, errors.New("invalid compact signature")
+	}
+	r := new(big.Int).SetBytes(sig[1:33])
+	s := new(big.Int).SetBytes(sig[33:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(curveOrder) >= 0 || s.Cmp(halfOrder) > 0 {
+		return nil, errors.New("compact signature value out of range")
+	}
+	return recoverPublicKey(MessageHash(message), r, s, sig[0]-compactHeader)
+}
+
+// recoverPublicKey returns the key whose signature of hash is r and s,
+// given the recovery ID of signHash: Q = r⁻¹(sR - eG), where R is the
+// nonce point
+func recoverPublicKey(hash [32]byte, r, s *big.Int, recID byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	x := new(big.Int).Set(r)
+	if recID&2 != 0 {
+		x.Add(x, curveOrder)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, errors.New("invalid recovery ID")
+	}
+	// y² = x³ - 3x + b; as p ≡ 3 (mod 4), y = (y²)^((p+1)/4)
+	y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+	y2.Add(y2, params.B)
+	y2.Mod(y2, params.P)
+	y := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(params.P, big.NewInt(1)), 2), params.P)
+	if new(big.Int).Exp(y, big.NewInt(2), params.P).Cmp(y2) != 0 {
+		return nil, errors.New("signature has no nonce point")
+	}
+	if y.Bit(0) != uint(recID&1) {
+		y.Sub(params.P, y)
+	}
+
+	sRx, sRy := curve.ScalarMult(x, y, s.Bytes())
+	e := new(big.Int).SetBytes(hash[:])
+	e.Mod(e, curveOrder)
+	eGx, eGy := curve.ScalarBaseMult(e.Bytes())
+	eGy.Sub(params.P, eGy)
+	qx, qy := curve.Add(sRx, sRy, eGx, eGy)
+	rInv := new(big.Int).ModInverse(r, curveOrder)
+	qx, qy = curve.ScalarMult(qx, qy, rInv.Bytes())
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("signature recovers no key")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}, nil
+}
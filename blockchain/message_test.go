@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestRecoverMessageKey(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := SignMessage(key, "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != CompactSignatureSize {
+			t.Fatalf("signature size = %d", len(sig))
+		}
+		recovered, err := RecoverMessageKey("hello", sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !recovered.Equal(&key.PublicKey) {
+			t.Fatalf("recovered %x, %x; want %x, %x", recovered.X, recovered.Y, key.X, key.Y)
+		}
+
+		if other, err := RecoverMessageKey("goodbye", sig); err == nil && other.Equal(&key.PublicKey) {
+			t.Error("signature recovered the key for another message")
+		}
+		flipped := append([]byte{sig[0] ^ 1}, sig[1:]...)
+		if other, err := RecoverMessageKey("hello", flipped); err == nil && other.Equal(&key.PublicKey) {
+			t.Error("wrong recovery ID recovered the key")
+		}
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sig, _ := SignMessage(key, "hello")
+	tests := []struct {
+		name string
+		sig  []byte
+	}{
+		{"short", sig[:64]},
+		{"bad header", append([]byte{31}, sig[1:]...)},
+		{"zero r", append(append([]byte{sig[0]}, make([]byte, 32)...), sig[33:]...)},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		if _, err := RecoverMessageKey("hello", tt.sig); err == nil {
+			t.Errorf("%s signature accepted", tt.name)
+		}
+	}
+}
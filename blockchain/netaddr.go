@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NormalizeAddress returns address as host:port, adding defaultPort when
+// it has none. IPv6 hosts may be given with or without brackets, and are
+// returned bracketed and in canonical form, e.g. "2001:db8::1" becomes
+// "[2001:db8::1]:9000", so the same peer is always known by one address.
+func NormalizeAddress(address string, defaultPort int) (string, error) {
+	address = strings.TrimSpace(address)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port: a hostname, IPv4 address, or IPv6 address with or
+		// without brackets
+		host, port = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), strconv.Itoa(defaultPort)
+	}
+	if host == "" && address != "" && !strings.HasPrefix(address, ":") {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("invalid port in address %q", address)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	} else if strings.Contains(host, ":") {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// ListenAddrs returns the addresses to listen on for a listener bound to
+// each of binds, which are hosts or host:port, on port unless they give
+// their own. With no binds it listens on port on every interface, over
+// both IPv4 and IPv6 where the system supports it.
+func ListenAddrs(binds []string, port int) ([]string, error) {
+	if len(binds) == 0 {
+		return []string{net.JoinHostPort("", strconv.Itoa(port))}, nil
+	}
+	addrs := make([]string, 0, len(binds))
+	for _, bind := range binds {
+		addr, err := NormalizeAddress(bind, port)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// Listen listens on TCP on every address, returning a single listener that
+// accepts connections from all of them. Binding fails as a whole if any
+// address can't be bound.
+func Listen(addrs []string) (net.Listener, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no listen addresses")
+	}
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 1 {
+		return listeners[0], nil
+	}
+	return newMultiListener(listeners), nil
+}
+
+// ListenerAddrs returns the addresses a listener from Listen is bound to,
+// with ephemeral ports resolved
+func ListenerAddrs(l net.Listener) []string {
+	m, ok := l.(*multiListener)
+	if !ok {
+		return []string{l.Addr().String()}
+	}
+	addrs := make([]string, len(m.listeners))
+	for i, listener := range m.listeners {
+		addrs[i] = listener.Addr().String()
+	}
+	return addrs
+}
+
+// multiListener merges several listeners into one
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// acceptResult is the outcome of an Accept on one of a multiListener's
+// listeners
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan acceptResult),
+		done:      make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go m.serve(l)
+	}
+	return m
+}
+
+// serve forwards the connections of one listener until it is closed
+func (m *multiListener) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case m.conns <- acceptResult{conn, err}:
+		case <-m.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+				return
+			}
+		}
+	}
+}
+
+// Accept waits for a connection on any of the listeners
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-m.conns:
+		return r.conn, r.err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes every listener
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, l := range m.listeners {
+			if cerr := l.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
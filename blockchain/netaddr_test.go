@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1.2.3.4", "1.2.3.4:9000", false},
+		{"1.2.3.4:9333", "1.2.3.4:9333", false},
+		{"seed.example.org", "seed.example.org:9000", false},
+		{"seed.example.org:1", "seed.example.org:1", false},
+		{"2001:db8::1", "[2001:db8::1]:9000", false},
+		{"[2001:db8::1]", "[2001:db8::1]:9000", false},
+		{"[2001:DB8:0::1]:9333", "[2001:db8::1]:9333", false},
+		{"::", "[::]:9000", false},
+		{":9333", ":9333", false},
+		{"1.2.3.4:port", "", true},
+		{"1.2.3.4:70000", "", true},
+		{"[not:an:ip]:1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeAddress(tt.in, 9000)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeAddress(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeAddress(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestListenAddrs(t *testing.T) {
+	addrs, err := ListenAddrs(nil, 9000)
+	if err != nil || len(addrs) != 1 || addrs[0] != ":9000" {
+		t.Errorf("ListenAddrs(nil) = %v, %v", addrs, err)
+	}
+	addrs, err = ListenAddrs([]string{"127.0.0.1", "::1:9001", "[::1]:9002"}, 9000)
+	want := []string{"127.0.0.1:9000", "[::1:9001]:9000", "[::1]:9002"}
+	if err != nil || len(addrs) != len(want) {
+		t.Fatalf("ListenAddrs = %v, %v", addrs, err)
+	}
+	for i := range want {
+		if addrs[i] != want[i] {
+			t.Errorf("address %d = %q, want %q", i, addrs[i], want[i])
+		}
+	}
+}
+
+func TestListenMultiple(t *testing.T) {
+	l, err := Listen([]string{"127.0.0.1:0", "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	m, ok := l.(*multiListener)
+	if !ok {
+		t.Fatalf("Listen returned %T for two addresses", l)
+	}
+	for _, inner := range m.listeners {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accepted.LocalAddr().String() != inner.Addr().String() {
+			t.Errorf("accepted on %s, dialled %s", accepted.LocalAddr(), inner.Addr())
+		}
+		accepted.Close()
+		conn.Close()
+	}
+
+	l.Close()
+	if _, err := l.Accept(); err == nil {
+		t.Error("Accept succeeded after Close")
+	}
+}
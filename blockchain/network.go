@@ -3,9 +3,10 @@ package blockchain
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,6 +15,29 @@ type Peer struct {
 	Address  string
 	Conn     net.Conn
 	LastSeen time.Time
+	Inbound  bool
+	Pinned   bool // Always reconnected, never evicted or disconnected for misbehavior
+
+	// compress is set once the peer's version shows it accepts compressed
+	// payloads
+	compress          int32
+
+	// version and services are set from the peer's version message: the
+	// negotiated protocol version and the ServiceFlag it announced
+	version           uint32
+	services          uint64
+
+	connectedAt       time.Time
+
+	done              chan struct{} // Closed when the connection ends
+	traffic           trafficCounter
+	headerWindowStart time.Time
+	headersInWindow   int
+	headersRequested  int32 // Set while a getheaders to this peer is outstanding
+	announced         map[Hash]bool // Blocks announced by the peer awaiting acknowledgment
+
+	txQueueMu         sync.Mutex
+	txQueue           []*Transaction // Transactions waiting for the next relay batch
 }
 
 // Network manages P2P communication
@@ -21,10 +45,30 @@ type Network struct {
 	blockchain  *Blockchain
 	peers       map[string]*Peer
 	listener    net.Listener
-	port        int
 	mu          sync.RWMutex
 	ctx         context.Context
 	cancel      context.CancelFunc
+	connFilter  func(net.Addr) bool
+	msgFilter   func(*Peer, string) bool
+	managed     map[string]*managedPeer
+	traffic     trafficCounter
+	upload      uploadBudget
+	noCompress  int32 // Set when payload compression is disabled
+	services    uint64 // ServiceFlag announced to peers
+	relays      relayTracker
+
+	txRelayDelay     int64 // Mean relay delay, see SetTxRelayDelay
+	walletRelayPeers int32 // See SetWalletRelayPeers
+}
+
+// maxBlocksPerMsg is the most blocks sent in reply to one getblocks
+const maxBlocksPerMsg = 500
+
+// NetTotals are the network's traffic totals and upload target
+type NetTotals struct {
+	TrafficStats
+	TimeMillis   int64        `json:"timemillis"`
+	UploadTarget UploadTarget `json:"uploadtarget"`
 }
 
 // Message types
@@ -34,30 +78,65 @@ const (
 	MsgTypeGetBlocks    = "getblocks"
 	MsgTypeGetMempool   = "getmempool"
 	MsgTypePing         = "ping"
+	MsgTypeGetHeaders   = "getheaders"
+	MsgTypeHeaders      = "headers"
+	MsgTypeVersion      = "version"
 )
 
+// ProtocolVersion is the P2P protocol version announced to peers. Version
+// 2 added services to the version message.
+const ProtocolVersion = 2
+
+// VersionPayload is exchanged by both sides when a connection is opened
+type VersionPayload struct {
+	Version   uint32 `json:"version"`
+	Timestamp int64  `json:"timestamp"`
+	Height    int    `json:"height"`
+	UserAgent string `json:"user_agent"`
+
+	// Services are the features the sender offers; see ServiceFlag
+	Services ServiceFlag `json:"services,omitempty"`
+
+	// Compression lists the payload encodings the sender accepts
+	Compression []string `json:"compression,omitempty"`
+}
+
+// GetHeadersPayload requests headers following the first known locator hash
+type GetHeadersPayload struct {
+	Locator [][32]byte `json:"locator"`
+}
+
 // Message represents a P2P network message
 type Message struct {
-	Type    string          `json:"type"`
-	Payload json.RawMessage `json:"payload"`
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"payload"`
+	Encoding string          `json:"encoding,omitempty"` // Payload encoding, empty for plain JSON
+}
+
+// NewNetwork creates a new P2P network listening on every one of
+// listenAddrs, see ListenAddrs
+func NewNetwork(blockchain *Blockchain, listenAddrs []string) (*Network, error) {
+	listener, err := Listen(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	return NewNetworkWithListener(blockchain, listener), nil
 }
 
-// NewNetwork creates a new P2P network
-func NewNetwork(blockchain *Blockchain, port int) (*Network, error) {
+// NewNetworkWithListener creates a new P2P network accepting peers on a
+// listener bound by the caller, which the network closes when stopped
+func NewNetworkWithListener(blockchain *Blockchain, listener net.Listener) *Network {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	network := &Network{
 		blockchain: blockchain,
 		peers:      make(map[string]*Peer),
-		port:       port,
+		managed:    make(map[string]*managedPeer),
 		ctx:        ctx,
 		cancel:     cancel,
-	}
-	
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		cancel()
-		return nil, err
+		services:   uint64(DefaultServices),
+
+		txRelayDelay: int64(DefaultTxRelayDelay),
 	}
 	
 	network.listener = listener
@@ -65,39 +144,69 @@ func NewNetwork(blockchain *Blockchain, port int) (*Network, error) {
 	go network.acceptConnections()
 	go network.maintainPeers()
 	
-	return network, nil
+	return network
+}
+
+// SetConnFilter installs a filter deciding at accept time whether an
+// inbound connection from the given address is allowed
+func (n *Network) SetConnFilter(filter func(net.Addr) bool) {
+	n.mu.Lock()
+	n.connFilter = filter
+	n.mu.Unlock()
 }
 
-// Connect connects to a peer
+// SetMessageFilter installs a filter deciding whether a message of the
+// given type received from a peer is handled or dropped
+func (n *Network) SetMessageFilter(filter func(peer *Peer, msgType string) bool) {
+	n.mu.Lock()
+	n.msgFilter = filter
+	n.mu.Unlock()
+}
+
+// Connect connects to a peer at host or host:port, on the network's
+// default port if none is given. IPv6 hosts may be bracketed or bare.
+// The peer isn't reconnected if the connection ends; see AddPeer.
 func (n *Network) Connect(address string) error {
-	conn, err := net.Dial("tcp", address)
+	address, err := NormalizeAddress(address, n.blockchain.Params().DefaultPort)
 	if err != nil {
 		return err
 	}
-	
-	peer := &Peer{
-		Address:  address,
-		Conn:     conn,
-		LastSeen: time.Now(),
+	_, err = n.connect(address)
+	return err
+}
+
+// connect opens a connection to a normalized address and starts syncing
+// from the peer
+func (n *Network) connect(address string) (*Peer, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(n.ctx, "tcp", address)
+	if err != nil {
+		return nil, err
 	}
 	
 	n.mu.Lock()
+	peer := &Peer{
+		Address:     address,
+		Conn:        conn,
+		LastSeen:    time.Now(),
+		Pinned:      n.managed[address] != nil && n.managed[address].pinned,
+		connectedAt: time.Now(),
+		done:        make(chan struct{}),
+	}
 	n.peers[address] = peer
 	n.mu.Unlock()
 	
 	go n.handlePeer(peer)
 	
-	return nil
-}
-
-// BroadcastTransaction broadcasts a transaction to all peers
-func (n *Network) BroadcastTransaction(tx *Transaction) {
-	msg := Message{
-		Type:    MsgTypeTransaction,
-		Payload: tx.Serialize(),
+	if err := n.sendVersion(peer); err != nil {
+		conn.Close()
+		return nil, err
 	}
-	
-	n.broadcast(msg)
+	if err := n.SyncHeaders(peer); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return peer, nil
 }
 
 // BroadcastBlock broadcasts a block to all peers
@@ -112,16 +221,28 @@ func (n *Network) BroadcastBlock(block *Block) {
 
 // broadcast sends a message to all connected peers
 func (n *Network) broadcast(msg Message) {
-	msgBytes, err := json.Marshal(msg)
+	msgBytes, err := encodeMessage(msg, false)
 	if err != nil {
 		return
 	}
+	var compressed []byte
 	
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 	
 	for _, peer := range n.peers {
-		peer.Conn.Write(msgBytes)
+		data := msgBytes
+		if atomic.LoadInt32(&peer.compress) == 1 {
+			if compressed == nil {
+				if compressed, err = encodeMessage(msg, true); err != nil {
+					compressed = msgBytes
+				}
+			}
+			data = compressed
+		}
+		if written, _ := peer.Conn.Write(data); written > 0 {
+			n.countSent(peer, msg.Type, written)
+		}
 	}
 }
 
@@ -136,11 +257,22 @@ func (n *Network) acceptConnections() {
 			if err != nil {
 				continue
 			}
+
+			n.mu.RLock()
+			filter := n.connFilter
+			n.mu.RUnlock()
+			if filter != nil && !filter(conn.RemoteAddr()) {
+				conn.Close()
+				continue
+			}
 			
 			peer := &Peer{
-				Address:  conn.RemoteAddr().String(),
-				Conn:     conn,
-				LastSeen: time.Now(),
+				Address:     conn.RemoteAddr().String(),
+				Conn:        conn,
+				LastSeen:    time.Now(),
+				Inbound:     true,
+				connectedAt: time.Now(),
+				done:        make(chan struct{}),
 			}
 			
 			n.mu.Lock()
@@ -148,6 +280,7 @@ func (n *Network) acceptConnections() {
 			n.mu.Unlock()
 			
 			go n.handlePeer(peer)
+			n.sendVersion(peer)
 		}
 	}
 }
@@ -157,11 +290,17 @@ func (n *Network) handlePeer(peer *Peer) {
 	defer func() {
 		peer.Conn.Close()
 		n.mu.Lock()
-		delete(n.peers, peer.Address)
+		if n.peers[peer.Address] == peer {
+			delete(n.peers, peer.Address)
+		}
 		n.mu.Unlock()
+		close(peer.done)
 	}()
 	
+	go n.trickleTransactions(peer)
+
 	decoder := json.NewDecoder(peer.Conn)
+	var offset int64
 	
 	for {
 		select {
@@ -172,6 +311,22 @@ func (n *Network) handlePeer(peer *Peer) {
 			if err := decoder.Decode(&msg); err != nil {
 				return
 			}
+			next := decoder.InputOffset()
+			n.countRecv(peer, msg.Type, int(next-offset))
+			offset = next
+			payload, err := decompressPayload(msg.Encoding, msg.Payload)
+			if err != nil {
+				log.Printf("Bad %s message from peer %s: %v", msg.Type, peer.Address, err)
+				continue
+			}
+			msg.Payload = payload
+
+			n.mu.RLock()
+			filter := n.msgFilter
+			n.mu.RUnlock()
+			if filter != nil && !filter(peer, msg.Type) {
+				continue
+			}
 			
 			peer.LastSeen = time.Now()
 			
@@ -181,30 +336,306 @@ func (n *Network) handlePeer(peer *Peer) {
 				if err := json.Unmarshal(msg.Payload, &block); err != nil {
 					continue
 				}
-				// Handle new block
-				n.blockchain.AddBlock([]*Transaction{})
+				err := n.blockchain.ProcessBlock(&block)
+				if err == ErrOrphanBlock {
+					n.requestAncestors(peer, block.Hash)
+				} else if err != nil && err != ErrDuplicateBlock {
+					log.Printf("Rejected block %x from peer %s: %v", block.Hash, peer.Address, err)
+				} else {
+					n.ackBlock(peer, block.Hash)
+				}
+
+			case MsgTypeNewBlock:
+				var header BlockHeader
+				if err := json.Unmarshal(msg.Payload, &header); err != nil {
+					continue
+				}
+				if !n.handleNewBlock(peer, header) {
+					return
+				}
+
+			case MsgTypeBlockAck:
+				var ack BlockAckPayload
+				if err := json.Unmarshal(msg.Payload, &ack); err != nil {
+					continue
+				}
+				n.relays.ack(ack.Hash, peer.Address, time.Now())
 				
 			case MsgTypeTransaction:
 				var tx Transaction
 				if err := json.Unmarshal(msg.Payload, &tx); err != nil {
 					continue
 				}
-				// Handle new transaction
-				n.blockchain.AddTransaction(&tx)
+				if err := n.blockchain.AddTransaction(&tx); err == nil {
+					n.relayTransaction(&tx, peer)
+				}
 				
 			case MsgTypeGetBlocks:
-				// Send blocks
+				var req GetHeadersPayload
+				if err := json.Unmarshal(msg.Payload, &req); err != nil {
+					continue
+				}
+				n.serveBlocks(peer, req.Locator)
 				
 			case MsgTypeGetMempool:
 				// Send mempool transactions
 				
 			case MsgTypePing:
 				// Respond to ping
+
+			case MsgTypeVersion:
+				var version VersionPayload
+				if err := json.Unmarshal(msg.Payload, &version); err != nil {
+					continue
+				}
+				n.blockchain.TimeSource().AddTimeSample(peerHost(peer.Address), time.Unix(version.Timestamp, 0))
+				n.handleVersion(peer, &version)
+
+			case MsgTypeGetHeaders:
+				var req GetHeadersPayload
+				if err := json.Unmarshal(msg.Payload, &req); err != nil {
+					continue
+				}
+				headers := n.blockchain.GetHeaders(req.Locator, n.blockchain.Params().MaxHeadersPerMsg)
+				n.sendMessage(peer, MsgTypeHeaders, headers)
+
+			case MsgTypeHeaders:
+				var headers []BlockHeader
+				if err := json.Unmarshal(msg.Payload, &headers); err != nil {
+					continue
+				}
+				if !n.handleHeaders(peer, headers) {
+					return
+				}
 			}
 		}
 	}
 }
 
+// handleHeaders processes a headers message from a peer. It returns false
+// if the peer misbehaved and should be disconnected.
+func (n *Network) handleHeaders(peer *Peer, headers []BlockHeader) bool {
+	// Responses to our own getheaders are not rate limited, so an honest
+	// peer serving initial sync can send full batches back to back
+	solicited := atomic.SwapInt32(&peer.headersRequested, 0) == 1
+	if !solicited && !n.countHeaders(peer, len(headers)) {
+		return false
+	}
+
+	if len(headers) == 0 {
+		return true
+	}
+
+	params := n.blockchain.Params()
+	result, err := n.blockchain.ProcessHeaders(headers)
+	switch err {
+	case nil:
+		// Ask for the next batch if this one was full
+		if len(headers) == params.MaxHeadersPerMsg {
+			n.requestHeaders(peer, [][32]byte{result.TipHash})
+		}
+		// Request the blocks for the validated headers from a peer that has
+		// them
+		n.sendMessage(n.blockSource(peer), MsgTypeGetBlocks, GetHeadersPayload{Locator: [][32]byte{headers[0].PrevHash}})
+		return true
+	case ErrInsufficientChainWork:
+		// Low-work chains count against the rate limit even when we asked
+		// for them, so a peer can't feed us an endless cheap chain
+		if solicited && !n.countHeaders(peer, len(headers)) {
+			return false
+		}
+		// Keep syncing headers but don't download blocks until the chain
+		// has proven enough work
+		if len(headers) == params.MaxHeadersPerMsg {
+			n.requestHeaders(peer, [][32]byte{result.TipHash})
+		}
+		return true
+	case ErrHeadersNotConnected:
+		// Possibly a different branch; restart from our locator
+		n.requestHeaders(peer, n.blockchain.BlockLocator())
+		return true
+	default:
+		log.Printf("Rejected headers from peer %s: %v", peer.Address, err)
+		return peer.Pinned
+	}
+}
+
+// countHeaders charges headers against a peer's per-minute allowance. It
+// returns false once the peer exceeds it; pinned peers have no limit.
+func (n *Network) countHeaders(peer *Peer, count int) bool {
+	if peer.Pinned {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(peer.headerWindowStart) > time.Minute {
+		peer.headerWindowStart = now
+		peer.headersInWindow = 0
+	}
+	peer.headersInWindow += count
+	if peer.headersInWindow > n.blockchain.Params().MaxHeadersPerMinute {
+		log.Printf("Peer %s exceeded header rate limit, disconnecting", peer.Address)
+		return false
+	}
+	return true
+}
+
+// requestAncestors asks the peer that sent an orphan block for the blocks
+// leading to it, through header sync from our locator, unless headers were
+// already requested from it
+func (n *Network) requestAncestors(peer *Peer, orphan [32]byte) {
+	root, ok := n.blockchain.OrphanRoot(orphan)
+	if !ok || atomic.LoadInt32(&peer.headersRequested) == 1 {
+		return
+	}
+	log.Printf("Orphan block %x from peer %s, requesting ancestors of %x", orphan, peer.Address, root)
+	n.requestHeaders(peer, n.blockchain.BlockLocator())
+}
+
+// requestHeaders sends a getheaders message and marks the reply as solicited
+func (n *Network) requestHeaders(peer *Peer, locator [][32]byte) error {
+	atomic.StoreInt32(&peer.headersRequested, 1)
+	return n.sendMessage(peer, MsgTypeGetHeaders, GetHeadersPayload{Locator: locator})
+}
+
+// sendMessage encodes and sends a single message to a peer
+func (n *Network) sendMessage(peer *Peer, msgType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	msgBytes, err := encodeMessage(Message{Type: msgType, Payload: data}, atomic.LoadInt32(&peer.compress) == 1)
+	if err != nil {
+		return err
+	}
+
+	written, err := peer.Conn.Write(msgBytes)
+	if written > 0 {
+		n.countSent(peer, msgType, written)
+	}
+	return err
+}
+
+// encodeMessage encodes a message, compressing its payload if compress is
+// set and the payload is large enough to be worth it
+func encodeMessage(msg Message, compress bool) ([]byte, error) {
+	if compress && len(msg.Payload) >= compressThreshold {
+		payload, err := compressPayload(msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload, msg.Encoding = payload, EncodingGzip
+	}
+	return json.Marshal(msg)
+}
+
+// acceptsEncoding reports whether encodings lists encoding
+func acceptsEncoding(encodings []string, encoding string) bool {
+	for _, e := range encodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCompression enables or disables compressing large payloads, such as
+// blocks, to peers that accept it. It is enabled by default. Compressed
+// payloads from peers are accepted either way.
+func (n *Network) SetCompression(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&n.noCompress, 0)
+	} else {
+		atomic.StoreInt32(&n.noCompress, 1)
+	}
+}
+
+// compressionEnabled reports whether payloads may be compressed
+func (n *Network) compressionEnabled() bool {
+	return atomic.LoadInt32(&n.noCompress) == 0
+}
+
+// serveBlocks sends a peer the blocks following its locator. Historical
+// blocks are skipped while the upload target is nearly reached, so the
+// remaining budget goes to relaying new blocks.
+func (n *Network) serveBlocks(peer *Peer, locator [][32]byte) {
+	skipped := 0
+	for _, block := range n.blockchain.GetBlocksAfter(locator, maxBlocksPerMsg) {
+		if !n.upload.serveBlock(block.Timestamp, time.Now()) {
+			skipped++
+			continue
+		}
+		if err := n.sendMessage(peer, MsgTypeBlock, block); err != nil {
+			return
+		}
+	}
+	if skipped > 0 {
+		log.Printf("Upload target nearly reached, not serving %d historical blocks to peer %s", skipped, peer.Address)
+	}
+}
+
+// countSent counts bytes sent to a peer
+func (n *Network) countSent(peer *Peer, msgType string, bytes int) {
+	peer.traffic.addSent(msgType, bytes)
+	n.traffic.addSent(msgType, bytes)
+	n.upload.add(bytes, time.Now())
+}
+
+// countRecv counts bytes received from a peer
+func (n *Network) countRecv(peer *Peer, msgType string, bytes int) {
+	peer.traffic.addRecv(msgType, bytes)
+	n.traffic.addRecv(msgType, bytes)
+}
+
+// SetMaxUploadTarget limits the bytes sent per 24 hours. Near the target,
+// historical blocks are no longer served to peers; new blocks and other
+// messages are still sent past it. 0 removes the target.
+func (n *Network) SetMaxUploadTarget(bytes uint64) {
+	n.upload.setTarget(bytes)
+}
+
+// GetNetTotals returns the traffic totals since start and the state of the
+// upload target
+func (n *Network) GetNetTotals() NetTotals {
+	now := time.Now()
+	return NetTotals{
+		TrafficStats: n.traffic.stats(),
+		TimeMillis:   now.UnixNano() / int64(time.Millisecond),
+		UploadTarget: n.upload.status(now),
+	}
+}
+
+// sendVersion announces our protocol version, services, clock and height
+// to a peer
+func (n *Network) sendVersion(peer *Peer) error {
+	version := VersionPayload{
+		Version:   ProtocolVersion,
+		Timestamp: time.Now().Unix(),
+		Height:    n.blockchain.GetHeight(),
+		UserAgent: "/" + NetworkName + ":" + Version + "/",
+		Services:  n.LocalServices(),
+	}
+	if n.compressionEnabled() {
+		version.Compression = []string{EncodingGzip}
+	}
+	return n.sendMessage(peer, MsgTypeVersion, version)
+}
+
+// SyncHeaders asks a peer for headers following our current tip
+func (n *Network) SyncHeaders(peer *Peer) error {
+	return n.requestHeaders(peer, n.blockchain.BlockLocator())
+}
+
+// peerHost returns the IP of a peer address. Inbound peers are known by
+// ip:ephemeralport, so the port must be dropped to identify the host.
+func peerHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
 // maintainPeers removes inactive peers
 func (n *Network) maintainPeers() {
 	ticker := time.NewTicker(time.Minute)
@@ -217,7 +648,7 @@ func (n *Network) maintainPeers() {
 		case <-ticker.C:
 			n.mu.Lock()
 			for addr, peer := range n.peers {
-				if time.Since(peer.LastSeen) > 5*time.Minute {
+				if !peer.Pinned && time.Since(peer.LastSeen) > 5*time.Minute {
 					peer.Conn.Close()
 					delete(n.peers, addr)
 				}
@@ -0,0 +1,73 @@
+package blockchain
+
+// NotificationType represents the type of a chain notification
+type NotificationType int
+
+const (
+	// NTBlockConnected indicates a block was connected to the main chain
+	NTBlockConnected NotificationType = iota
+
+	// NTBlockDisconnected indicates a block was disconnected from the main chain
+	NTBlockDisconnected
+
+	// NTReorganization indicates the main chain switched to another branch
+	NTReorganization
+
+	// NTTxAccepted indicates a transaction was accepted into the mempool
+	NTTxAccepted
+)
+
+var notificationTypeStrings = map[NotificationType]string{
+	NTBlockConnected:    "NTBlockConnected",
+	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorganization:    "NTReorganization",
+	NTTxAccepted:        "NTTxAccepted",
+}
+
+// String returns the notification type in human-readable form
+func (n NotificationType) String() string {
+	if s, ok := notificationTypeStrings[n]; ok {
+		return s
+	}
+	return "Unknown"
+}
+
+// ReorganizationData describes a switch of the main chain to another branch
+type ReorganizationData struct {
+	OldTip     Hash
+	NewTip     Hash
+	ForkHeight int
+}
+
+// Notification is delivered to subscribers on chain events. Data is a
+// *Block for block notifications, a *Transaction for NTTxAccepted and a
+// *ReorganizationData for NTReorganization.
+type Notification struct {
+	Type NotificationType
+	Data interface{}
+}
+
+// NotificationCallback is invoked for every chain notification
+type NotificationCallback func(*Notification)
+
+// Subscribe registers a callback to receive chain notifications. Callbacks
+// are invoked synchronously and must not call back into the blockchain
+// while holding their own locks.
+func (bc *Blockchain) Subscribe(callback NotificationCallback) {
+	bc.notificationsMu.Lock()
+	bc.notifications = append(bc.notifications, callback)
+	bc.notificationsMu.Unlock()
+}
+
+// sendNotification delivers a notification to all subscribers
+func (bc *Blockchain) sendNotification(typ NotificationType, data interface{}) {
+	n := &Notification{Type: typ, Data: data}
+
+	bc.notificationsMu.RLock()
+	callbacks := bc.notifications
+	bc.notificationsMu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(n)
+	}
+}
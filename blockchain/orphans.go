@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"log"
+	"time"
+)
+
+// Bounds of the orphan pool. Orphans whose parent doesn't arrive within
+// orphanExpiry are dropped, and when the pool is full the orphan closest
+// to expiring makes room.
+const (
+	maxOrphanBlocks = 100
+	orphanExpiry    = 20 * time.Minute
+)
+
+// orphanBlock is a block whose parent is unknown, waiting for it
+type orphanBlock struct {
+	block   *Block
+	expires time.Time
+}
+
+// orphanPool holds blocks received before their parent, so they connect
+// once it arrives. It is guarded by Blockchain.mu.
+type orphanPool struct {
+	blocks   map[[32]byte]*orphanBlock
+	byParent map[[32]byte][][32]byte // Orphan hashes by parent hash
+}
+
+// newOrphanPool returns an empty orphan pool
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks:   make(map[[32]byte]*orphanBlock),
+		byParent: make(map[[32]byte][][32]byte),
+	}
+}
+
+// add keeps an orphan block, reporting whether it was new
+func (p *orphanPool) add(block *Block, now time.Time) bool {
+	if p.blocks[block.Hash] != nil {
+		return false
+	}
+	var oldest *orphanBlock
+	for hash, orphan := range p.blocks {
+		if now.After(orphan.expires) {
+			p.remove(hash)
+		} else if oldest == nil || orphan.expires.Before(oldest.expires) {
+			oldest = orphan
+		}
+	}
+	if len(p.blocks) >= maxOrphanBlocks {
+		p.remove(oldest.block.Hash)
+	}
+	p.blocks[block.Hash] = &orphanBlock{block: block, expires: now.Add(orphanExpiry)}
+	p.byParent[block.PrevHash] = append(p.byParent[block.PrevHash], block.Hash)
+	return true
+}
+
+// remove drops an orphan
+func (p *orphanPool) remove(hash [32]byte) {
+	orphan := p.blocks[hash]
+	if orphan == nil {
+		return
+	}
+	delete(p.blocks, hash)
+	siblings := p.byParent[orphan.block.PrevHash]
+	for i, sibling := range siblings {
+		if sibling == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, orphan.block.PrevHash)
+	} else {
+		p.byParent[orphan.block.PrevHash] = siblings
+	}
+}
+
+// takeChildren removes and returns the orphans of a parent
+func (p *orphanPool) takeChildren(parent [32]byte) []*Block {
+	var children []*Block
+	for _, hash := range p.byParent[parent] {
+		if orphan := p.blocks[hash]; orphan != nil {
+			children = append(children, orphan.block)
+			delete(p.blocks, hash)
+		}
+	}
+	delete(p.byParent, parent)
+	return children
+}
+
+// root returns the missing ancestor of an orphan: the parent of the
+// earliest orphan it descends from
+func (p *orphanPool) root(hash [32]byte) ([32]byte, bool) {
+	orphan := p.blocks[hash]
+	if orphan == nil {
+		return [32]byte{}, false
+	}
+	for {
+		parent := p.blocks[orphan.block.PrevHash]
+		if parent == nil {
+			return orphan.block.PrevHash, true
+		}
+		orphan = parent
+	}
+}
+
+// connectOrphans processes the orphans descending from a block that was
+// just accepted, returning the notifications of those that connected; the
+// caller must hold bc.mu for writing
+func (bc *Blockchain) connectOrphans(parent [32]byte) []*Notification {
+	var notifications []*Notification
+	queue := [][32]byte{parent}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		for _, orphan := range bc.orphans.takeChildren(hash) {
+			n, err := bc.processBlock(orphan)
+			if err != nil {
+				log.Printf("Rejected orphan block %x: %v", orphan.Hash, err)
+				continue
+			}
+			notifications = append(notifications, n...)
+			queue = append(queue, orphan.Hash)
+		}
+	}
+	return notifications
+}
+
+// OrphanRoot returns the hash of the block an orphan is waiting for, the
+// missing ancestor to request from peers. It reports false if the block
+// isn't an orphan.
+func (bc *Blockchain) OrphanRoot(hash [32]byte) ([32]byte, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.orphans.root(hash)
+}
+
+// OrphanCount returns the number of orphan blocks waiting for their parent
+func (bc *Blockchain) OrphanCount() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return len(bc.orphans.blocks)
+}
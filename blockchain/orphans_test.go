@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrphansConnectWhenParentArrives(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	a1 := mineTestBlock(bc, genesis, "a1")
+	a2 := mineTestBlock(bc, a1, "a2")
+	a3 := mineTestBlock(bc, a2, "a3")
+
+	var connected int
+	bc.Subscribe(func(n *Notification) {
+		if n.Type == NTBlockConnected {
+			connected++
+		}
+	})
+
+	for _, b := range []*Block{a3, a2} {
+		if err := bc.ProcessBlock(b); err != ErrOrphanBlock {
+			t.Fatalf("err = %v, want ErrOrphanBlock", err)
+		}
+	}
+	if err := bc.ProcessBlock(a3); err != ErrOrphanBlock {
+		t.Fatalf("resubmitted orphan: err = %v", err)
+	}
+	if got := bc.OrphanCount(); got != 2 {
+		t.Fatalf("%d orphans, want 2", got)
+	}
+	if root, ok := bc.OrphanRoot(a3.Hash); !ok || root != a1.Hash {
+		t.Errorf("orphan root = %x, %v; want a1", root, ok)
+	}
+
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+	if tip := bc.GetLatestBlock(); tip.Hash != a3.Hash {
+		t.Fatalf("tip = %x, want a3", tip.Hash)
+	}
+	if connected != 3 || bc.OrphanCount() != 0 {
+		t.Errorf("%d blocks connected, %d orphans left; want 3 and 0", connected, bc.OrphanCount())
+	}
+	if _, ok := bc.OrphanRoot(a3.Hash); ok {
+		t.Error("connected block still an orphan")
+	}
+}
+
+func TestOrphanPoolBounds(t *testing.T) {
+	pool := newOrphanPool()
+	now := time.Now()
+	orphan := func(i int) *Block {
+		return &Block{Hash: Hash{1, byte(i)}, PrevHash: Hash{2, byte(i)}}
+	}
+
+	for i := 0; i < maxOrphanBlocks; i++ {
+		pool.add(orphan(i), now.Add(time.Duration(i)*time.Second))
+	}
+	if pool.add(orphan(0), now) {
+		t.Error("duplicate orphan added")
+	}
+	// A full pool drops the orphan closest to expiring
+	pool.add(orphan(maxOrphanBlocks), now.Add(time.Minute))
+	if len(pool.blocks) != maxOrphanBlocks || pool.blocks[orphan(0).Hash] != nil {
+		t.Errorf("full pool kept %d orphans, oldest present: %v", len(pool.blocks), pool.blocks[orphan(0).Hash] != nil)
+	}
+	if len(pool.byParent[orphan(0).PrevHash]) != 0 {
+		t.Error("dropped orphan still indexed by parent")
+	}
+
+	// Expired orphans go when the next one is added
+	pool.add(orphan(maxOrphanBlocks+1), now.Add(orphanExpiry+2*time.Hour))
+	if len(pool.blocks) != 1 {
+		t.Errorf("%d orphans after expiry, want 1", len(pool.blocks))
+	}
+}
@@ -0,0 +1,119 @@
+package blockchain
+
+import "math/big"
+
+// ChainParamsInfo describes the consensus rules and relay policy a node
+// enforces, so explorers and wallets need not hard-code them. Amounts are
+// in base units.
+type ChainParamsInfo struct {
+	Network     string          `json:"network"`
+	Height      int             `json:"height"`     // Tip the active rules are given at
+	BlockTime   int             `json:"block_time"` // Target seconds between blocks
+	DefaultPort int             `json:"default_port"`
+	Subsidy     SubsidyInfo     `json:"subsidy"`
+	Difficulty  DifficultyInfo  `json:"difficulty"`
+	Treasury    *TreasuryParams `json:"treasury,omitempty"`
+	Checkpoints map[int]Hash    `json:"checkpoints"` // Height -> block hash
+	SoftForks   []SoftFork      `json:"softforks"`
+
+	// LockTimeThreshold splits transaction lock times into heights below
+	// it and unix times from it on
+	LockTimeThreshold uint32 `json:"locktime_threshold"`
+
+	// MedianTimeBlocks is the number of blocks whose median timestamp a
+	// block's must exceed, and MaxFutureBlockTime how many seconds ahead
+	// of network time it may be
+	MedianTimeBlocks   int `json:"median_time_blocks"`
+	MaxFutureBlockTime int `json:"max_future_block_time"`
+
+	// MaxBlockSize is the largest valid block in bytes
+	MaxBlockSize int `json:"max_block_size"`
+
+	// MaxHeadersPerMsg is the most headers a peer may send at once
+	MaxHeadersPerMsg int `json:"max_headers_per_msg"`
+
+	// Policy is this node's relay policy; other nodes may differ
+	Policy Policy `json:"policy"`
+}
+
+// SubsidyInfo describes the subsidy schedule
+type SubsidyInfo struct {
+	Initial         Amount `json:"initial"`
+	HalvingInterval int    `json:"halving_interval"`
+	MaxSupply       Amount `json:"max_supply"`
+	Next            Amount `json:"next"`         // Subsidy of the next block
+	NextHalving     int    `json:"next_halving"` // Height
+	Issued          Amount `json:"issued"`       // Up to and including the tip
+}
+
+// DifficultyInfo describes the proof of work
+type DifficultyInfo struct {
+	Algorithm   string   `json:"algorithm"`
+	Retarget    string   `json:"retarget"` // How the required difficulty changes
+	Minimum     *big.Int `json:"minimum"`
+	Required    *big.Int `json:"required"` // Of the next block
+	MergeMining bool     `json:"merge_mining"`
+}
+
+// SoftFork is a consensus rule added after launch, enforced from Height
+type SoftFork struct {
+	Name   string `json:"name"`
+	Height int    `json:"height"`
+	Active bool   `json:"active"` // Enforced in the next block
+}
+
+// softForks returns the rules added after launch, with the height each is
+// enforced from
+func (p *ChainParams) softForks() []SoftFork {
+	forks := []SoftFork{{Name: "locktime", Height: 0}, {Name: "mediantime", Height: 0}, {Name: "scripts", Height: 0}}
+	if p.Treasury != nil {
+		forks = append(forks, SoftFork{Name: "treasury", Height: p.Treasury.ActivationHeight})
+	}
+	return forks
+}
+
+// ChainParamsInfo returns the rules the chain enforces at its tip
+func (bc *Blockchain) ChainParamsInfo() *ChainParamsInfo {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	p := bc.params
+	next := len(bc.blocks)
+	info := &ChainParamsInfo{
+		Network:     p.Name,
+		Height:      next - 1,
+		BlockTime:   int(BlockTime.Seconds()),
+		DefaultPort: p.DefaultPort,
+		Subsidy: SubsidyInfo{
+			Initial:         p.InitialSubsidy,
+			HalvingInterval: p.HalvingInterval,
+			MaxSupply:       p.MaxSupply,
+			Next:            p.BlockSubsidy(next),
+			NextHalving:     (next/p.HalvingInterval + 1) * p.HalvingInterval,
+			Issued:          p.IssuedSupply(next),
+		},
+		Difficulty: DifficultyInfo{
+			Algorithm:   p.Consensus.Algorithm,
+			Retarget:    "fixed",
+			Minimum:     p.Consensus.MinimumDifficulty,
+			Required:    new(big.Int).Set(bc.requiredDifficulty()),
+			MergeMining: p.Consensus.MergeminingEnabled,
+		},
+		Treasury:           p.Treasury,
+		Checkpoints:        make(map[int]Hash, len(p.Checkpoints)),
+		SoftForks:          p.softForks(),
+		LockTimeThreshold:  LockTimeThreshold,
+		MedianTimeBlocks:   MedianTimeBlocks,
+		MaxFutureBlockTime: int(MaxFutureBlockTime.Seconds()),
+		MaxBlockSize:       p.BlockSizeLimit(),
+		MaxHeadersPerMsg:   p.MaxHeadersPerMsg,
+		Policy:             bc.policy,
+	}
+	for _, checkpoint := range p.Checkpoints {
+		info.Checkpoints[checkpoint.Height] = checkpoint.Hash
+	}
+	for i := range info.SoftForks {
+		info.SoftForks[i].Active = next >= info.SoftForks[i].Height
+	}
+	return info
+}
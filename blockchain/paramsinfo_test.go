@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChainParamsInfo(t *testing.T) {
+	bc := newTreasuryTestChain()
+	bc.params.Checkpoints = []Checkpoint{{Height: 0, Hash: bc.GetLatestBlock().Hash}}
+
+	info := bc.ChainParamsInfo()
+	if info.Network != "mainnet" || info.Height != 0 || info.BlockTime != 60 {
+		t.Errorf("info = %+v", info)
+	}
+	want := SubsidyInfo{
+		Initial:         InitialBlockReward,
+		HalvingInterval: 210000,
+		MaxSupply:       MaxAmount,
+		Next:            InitialBlockReward,
+		NextHalving:     210000,
+	}
+	if info.Subsidy != want {
+		t.Errorf("subsidy = %+v, want %+v", info.Subsidy, want)
+	}
+	if info.Difficulty.Required.Cmp(bc.params.Consensus.MinimumDifficulty) != 0 {
+		t.Errorf("required difficulty = %v", info.Difficulty.Required)
+	}
+	forks := map[string]bool{}
+	for _, fork := range info.SoftForks {
+		forks[fork.Name] = fork.Active
+	}
+	if !forks["locktime"] || forks["treasury"] {
+		t.Errorf("soft forks = %+v, want only locktime active", info.SoftForks)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := bc.GetLatestBlock().Hash
+	if !strings.Contains(string(data), `"checkpoints":{"0":"`+hex.EncodeToString(genesis[:])+`"}`) {
+		t.Errorf("checkpoints not encoded as height to hex hash: %s", data)
+	}
+}
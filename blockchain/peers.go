@@ -0,0 +1,212 @@
+package blockchain
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Backoff between attempts to reconnect an outbound peer
+const (
+	peerRetryMin = time.Second
+	peerRetryMax = 5 * time.Minute
+)
+
+// peerStableAfter is how long a connection must last for the backoff to
+// reset, so a peer that accepts and then drops connections isn't redialled
+// every second
+const peerStableAfter = time.Minute
+
+// dialTimeout bounds an outbound connection attempt
+const dialTimeout = 30 * time.Second
+
+// Connection states of an outbound peer
+const (
+	PeerConnected  = "connected"
+	PeerConnecting = "connecting"
+	PeerWaiting    = "waiting" // Backing off before the next attempt
+)
+
+// managedPeer is an outbound peer the network keeps connected. Its fields
+// are guarded by Network.mu.
+type managedPeer struct {
+	address     string
+	pinned      bool
+	state       string
+	attempts    int // Failed attempts since the last connection
+	lastError   string
+	nextAttempt time.Time
+}
+
+// PeerInfo describes a connected peer, or an outbound peer the network is
+// reconnecting
+type PeerInfo struct {
+	Address     string   `json:"addr"`
+	Inbound     bool     `json:"inbound"`
+	Pinned      bool     `json:"pinned"`
+	State       string   `json:"state"`
+	ConnectedAt int64    `json:"conntime,omitempty"`
+	LastSeen    int64    `json:"lastrecv,omitempty"`
+	Attempts    int      `json:"attempts,omitempty"`
+	LastError   string   `json:"lasterror,omitempty"`
+	NextAttempt int64    `json:"nextattempt,omitempty"`
+	Compression string   `json:"compression,omitempty"` // Encoding of large payloads sent to the peer
+	Version     uint32   `json:"version,omitempty"`     // Negotiated protocol version
+	Services    []string `json:"services,omitempty"`    // Known services the peer offers
+	*TrafficStats
+}
+
+// AddPeer keeps an outbound peer at host or host:port connected: it is
+// connected now and reconnected whenever the connection ends, with
+// exponential backoff and jitter after failures. A pinned peer is also
+// never evicted for inactivity and isn't disconnected for misbehavior;
+// pin the nodes of a private cluster, or bridges between datacenters.
+func (n *Network) AddPeer(address string, pinned bool) error {
+	address, err := NormalizeAddress(address, n.blockchain.Params().DefaultPort)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	mp, known := n.managed[address]
+	if !known {
+		mp = &managedPeer{address: address, state: PeerConnecting}
+		n.managed[address] = mp
+	}
+	mp.pinned = mp.pinned || pinned
+	n.mu.Unlock()
+
+	if !known {
+		go n.keepConnected(mp)
+	}
+	return nil
+}
+
+// ConnectSeeds keeps the seed peers of the chain parameters connected
+func (n *Network) ConnectSeeds() {
+	for _, seed := range n.blockchain.Params().Seeds {
+		if err := n.AddPeer(seed, false); err != nil {
+			log.Printf("Invalid seed %s: %v", seed, err)
+		}
+	}
+}
+
+// keepConnected connects to a managed peer until the network stops
+func (n *Network) keepConnected(mp *managedPeer) {
+	var backoff time.Duration
+	for {
+		n.setPeerState(mp, PeerConnecting)
+		peer, err := n.connect(mp.address)
+		if err == nil {
+			n.mu.Lock()
+			mp.state, mp.attempts, mp.lastError = PeerConnected, 0, ""
+			n.mu.Unlock()
+			select {
+			case <-peer.done:
+				log.Printf("Peer %s disconnected", mp.address)
+			case <-n.ctx.Done():
+				return
+			}
+			if time.Since(peer.connectedAt) > peerStableAfter {
+				backoff = 0
+			}
+		}
+
+		backoff = nextBackoff(backoff, peerRetryMin, peerRetryMax)
+		delay := withJitter(backoff)
+		n.mu.Lock()
+		mp.state, mp.nextAttempt = PeerWaiting, time.Now().Add(delay)
+		if err != nil {
+			mp.attempts++
+			mp.lastError = err.Error()
+		}
+		n.mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to connect to peer %s, retrying in %v: %v", mp.address, delay.Round(time.Second), err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// setPeerState sets the state of a managed peer
+func (n *Network) setPeerState(mp *managedPeer, state string) {
+	n.mu.Lock()
+	mp.state = state
+	n.mu.Unlock()
+}
+
+// GetPeers returns the connected peers
+func (n *Network) GetPeers() []*Peer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]*Peer, 0, len(n.peers))
+	for _, peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// DisconnectPeer closes the connection to a peer by address, reporting
+// whether it was connected. Peers added with AddPeer are reconnected as
+// if the connection had dropped.
+func (n *Network) DisconnectPeer(address string) bool {
+	n.mu.RLock()
+	peer := n.peers[address]
+	n.mu.RUnlock()
+	if peer == nil {
+		return false
+	}
+	peer.Conn.Close()
+	return true
+}
+
+// GetPeerInfo describes every connected peer and every outbound peer being
+// reconnected, sorted by address
+func (n *Network) GetPeerInfo() []PeerInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	infos := make([]PeerInfo, 0, len(n.peers)+len(n.managed))
+	for _, peer := range n.peers {
+		info := PeerInfo{
+			Address:     peer.Address,
+			Inbound:     peer.Inbound,
+			Pinned:      peer.Pinned,
+			State:       PeerConnected,
+			ConnectedAt: peer.connectedAt.Unix(),
+			LastSeen:    peer.LastSeen.Unix(),
+			Version:     peer.ProtocolVersion(),
+			Services:    peer.Services().Names(),
+		}
+		if atomic.LoadInt32(&peer.compress) == 1 {
+			info.Compression = EncodingGzip
+		}
+		traffic := peer.traffic.stats()
+		info.TrafficStats = &traffic
+		infos = append(infos, info)
+	}
+	for _, mp := range n.managed {
+		if mp.state == PeerConnected && n.peers[mp.address] != nil {
+			continue
+		}
+		info := PeerInfo{
+			Address:   mp.address,
+			Pinned:    mp.pinned,
+			State:     mp.state,
+			Attempts:  mp.attempts,
+			LastError: mp.lastError,
+		}
+		if mp.state == PeerWaiting {
+			info.NextAttempt = mp.nextAttempt.Unix()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Address < infos[j].Address })
+	return infos
+}
@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Policy holds the node's local rules for accepting transactions into the
+// mempool and relaying them. Unlike consensus rules they don't apply to
+// transactions in blocks, and nodes may configure them differently.
+type Policy struct {
+	MinRelayFeeRate       Amount `json:"min_relay_fee_rate"` // Per 1000 bytes
+	DustThreshold         Amount `json:"dust_threshold"`     // Smallest standard output value
+	MaxStandardTxSize     int    `json:"max_standard_tx_size"`
+	MaxStandardScriptSize int    `json:"max_standard_script_size"`     // Output scripts
+	MaxStandardSigSize    int    `json:"max_standard_sig_script_size"` // Input scripts
+	BlockMaxSize          int    `json:"block_max_size"`               // Block templates this node builds
+	MaxMempoolSize        int    `json:"max_mempool_size"`             // Bytes
+	MaxMempoolTxs         int    `json:"max_mempool_txs"`
+}
+
+// DefaultPolicy returns the default relay policy
+func DefaultPolicy() Policy {
+	return Policy{
+		MinRelayFeeRate:       1000,
+		DustThreshold:         546,
+		MaxStandardTxSize:     100000,
+		MaxStandardScriptSize: 128,
+		MaxStandardSigSize:    1650,
+		BlockMaxSize:          1000000,
+		MaxMempoolSize:        300000000,
+		MaxMempoolTxs:         100000,
+	}
+}
+
+// Validate checks that the policy values are usable
+func (p Policy) Validate() error {
+	if p.MinRelayFeeRate < 0 || p.DustThreshold < 0 {
+		return errors.New("fee rate and dust threshold can't be negative")
+	}
+	if p.MaxStandardTxSize <= 0 {
+		return errors.New("max standard transaction size must be positive")
+	}
+	if p.MaxStandardScriptSize <= 0 || p.MaxStandardSigSize <= 0 {
+		return errors.New("max standard script sizes must be positive")
+	}
+	if p.BlockMaxSize < p.MaxStandardTxSize {
+		return errors.New("block max size can't be below the max standard transaction size")
+	}
+	if p.MaxMempoolSize < p.MaxStandardTxSize || p.MaxMempoolTxs <= 0 {
+		return errors.New("mempool limits must hold at least one transaction")
+	}
+	return nil
+}
+
+// MinFee returns the minimum relay fee of a transaction of size bytes
+func (p Policy) MinFee(size int) Amount {
+	return p.MinRelayFeeRate.MulDiv(int64(size), 1000)
+}
+
+// PolicyError is returned when a transaction is valid but not accepted
+// under the node's relay policy
+type PolicyError struct {
+	Reason string
+}
+
+// Error implements error
+func (e *PolicyError) Error() string {
+	return "transaction rejected by policy: " + e.Reason
+}
+
+// policyErrorf creates a PolicyError with a formatted reason
+func policyErrorf(format string, args ...interface{}) *PolicyError {
+	return &PolicyError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// CheckStandard checks a transaction against the size, script and dust
+// rules of the policy
+func (p Policy) CheckStandard(tx *Transaction) error {
+	if size := len(tx.Encode()); size > p.MaxStandardTxSize {
+		return policyErrorf("size %d exceeds %d bytes", size, p.MaxStandardTxSize)
+	}
+	for i, in := range tx.Inputs {
+		if len(in.Script) > p.MaxStandardSigSize {
+			return policyErrorf("input %d script exceeds %d bytes", i, p.MaxStandardSigSize)
+		}
+	}
+	for i, out := range tx.Outputs {
+		if len(out.Script) == 0 {
+			return policyErrorf("output %d has an empty script", i)
+		}
+		if len(out.Script) > p.MaxStandardScriptSize {
+			return policyErrorf("output %d script exceeds %d bytes", i, p.MaxStandardScriptSize)
+		}
+		if Amount(out.Value) < p.DustThreshold {
+			return policyErrorf("output %d value %s is dust", i, Amount(out.Value))
+		}
+	}
+	return nil
+}
+
+// CheckFee checks that a transaction pays at least the minimum relay fee
+func (p Policy) CheckFee(tx *Transaction, fee Amount) error {
+	size := len(tx.Encode())
+	if minFee := p.MinFee(size); fee < minFee {
+		return policyErrorf("fee %s below minimum relay fee %s for %d bytes", fee, minFee, size)
+	}
+	return nil
+}
+
+// Policy returns the current relay policy
+func (bc *Blockchain) Policy() Policy {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.policy
+}
+
+// SetPolicy replaces the relay policy. It applies to transactions accepted
+// from then on; the mempool is not re-checked.
+func (bc *Blockchain) SetPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	bc.mu.Lock()
+	bc.policy = p
+	bc.mu.Unlock()
+	return nil
+}
+
+// checkPolicy applies the relay policy to a transaction entering the
+// mempool; the caller must hold bc.mu
+func (bc *Blockchain) checkPolicy(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return policyErrorf("coinbase transactions are only valid in blocks")
+	}
+	if err := bc.policy.CheckStandard(tx); err != nil {
+		return err
+	}
+	fee, err := bc.transactionFee(tx)
+	if err != nil {
+		return err
+	}
+	if err := bc.policy.CheckFee(tx, Amount(fee)); err != nil {
+		return err
+	}
+	// A full mempool raises the fee rate above the relay minimum
+	size := len(tx.Encode())
+	if minFee := bc.mempoolMinFeeRate(time.Now()).MulDiv(int64(size), 1000); Amount(fee) < minFee {
+		return policyErrorf("fee %s below mempool minimum fee %s for %d bytes", Amount(fee), minFee, size)
+	}
+	return nil
+}
+
+// transactionFee returns the fee a transaction pays, looking up its inputs
+// on the main chain and in the mempool; the caller must hold bc.mu
+func (bc *Blockchain) transactionFee(tx *Transaction) (uint64, error) {
+	var in, out uint64
+	for _, input := range tx.Inputs {
+		prev, ok := bc.findOutput(input.PrevTxHash, input.PrevTxIndex)
+		if !ok {
+			return 0, fmt.Errorf("missing input %x:%d", input.PrevTxHash, input.PrevTxIndex)
+		}
+		in += prev.Value
+	}
+	for _, output := range tx.Outputs {
+		out += output.Value
+	}
+	if out > in {
+		return 0, fmt.Errorf("outputs %d exceed inputs %d", out, in)
+	}
+	return in - out, nil
+}
+
+// findOutput looks up an output on the main chain or in the mempool; the
+// caller must hold bc.mu
+func (bc *Blockchain) findOutput(txHash [32]byte, index uint32) (*TxOutput, bool) {
+	if out, ok := bc.findTxOutput(txHash, index); ok {
+		return out, true
+	}
+	for _, tx := range bc.mempool {
+		if tx.Hash == txHash {
+			if int(index) >= len(tx.Outputs) {
+				return nil, false
+			}
+			out := tx.Outputs[index]
+			return &out, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPolicyCheckStandard(t *testing.T) {
+	p := DefaultPolicy()
+	input := TxInput{PrevTxHash: [32]byte{1}, Script: []byte("sig")}
+	output := TxOutput{Value: uint64(p.DustThreshold), Script: []byte("addr")}
+
+	tests := []struct {
+		name    string
+		inputs  []TxInput
+		outputs []TxOutput
+		wantErr bool
+	}{
+		{"standard", []TxInput{input}, []TxOutput{output}, false},
+		{"dust output", []TxInput{input}, []TxOutput{{Value: uint64(p.DustThreshold) - 1, Script: []byte("addr")}}, true},
+		{"empty output script", []TxInput{input}, []TxOutput{{Value: uint64(p.DustThreshold)}}, true},
+		{"large output script", []TxInput{input}, []TxOutput{{Value: uint64(p.DustThreshold), Script: bytes.Repeat([]byte{1}, p.MaxStandardScriptSize+1)}}, true},
+		{"large input script", []TxInput{{Script: bytes.Repeat([]byte{1}, p.MaxStandardSigSize+1)}}, []TxOutput{output}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckStandard(NewTransaction(tt.inputs, tt.outputs))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*PolicyError); err != nil && !ok {
+				t.Errorf("err = %T, want *PolicyError", err)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckStandardSize(t *testing.T) {
+	p := DefaultPolicy()
+	tx := NewTransaction(nil, []TxOutput{{Value: uint64(p.DustThreshold), Script: []byte("addr")}})
+	p.MaxStandardTxSize = len(tx.Encode()) - 1
+	if err := p.CheckStandard(tx); err == nil {
+		t.Error("expected oversized transaction to be rejected")
+	}
+}
+
+func TestPolicyCheckFee(t *testing.T) {
+	p := DefaultPolicy()
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: [32]byte{1}, Script: []byte("sig")}},
+		[]TxOutput{{Value: 1000, Script: []byte("addr")}},
+	)
+	minFee := p.MinFee(len(tx.Encode()))
+	if minFee == 0 {
+		t.Fatal("expected a non-zero minimum fee")
+	}
+
+	if err := p.CheckFee(tx, minFee); err != nil {
+		t.Errorf("fee at minimum rejected: %v", err)
+	}
+	if err := p.CheckFee(tx, minFee-1); err == nil {
+		t.Error("fee below minimum accepted")
+	}
+
+	p.MinRelayFeeRate = 0
+	if err := p.CheckFee(tx, 0); err != nil {
+		t.Errorf("zero fee rejected with zero fee rate: %v", err)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := DefaultPolicy().Validate(); err != nil {
+		t.Errorf("default policy invalid: %v", err)
+	}
+	p := DefaultPolicy()
+	p.MaxStandardTxSize = 0
+	if err := p.Validate(); err == nil {
+		t.Error("expected zero max size to be rejected")
+	}
+}
@@ -0,0 +1,219 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Messages of the block relay fast path. A relayed block's header is
+// announced first, so peers learn of the block from one small message, and
+// peers acknowledge the full block once they accepted it. Nodes that don't
+// know these messages ignore them.
+const (
+	MsgTypeNewBlock = "newblock"
+	MsgTypeBlockAck = "blockack"
+)
+
+// BlockAckPayload acknowledges a block announced with MsgTypeNewBlock
+type BlockAckPayload struct {
+	Hash Hash `json:"hash"`
+}
+
+// maxTrackedRelays bounds the relayed blocks whose propagation is kept
+const maxTrackedRelays = 20
+
+// maxAnnounced bounds the announced blocks awaiting acknowledgment per peer
+const maxAnnounced = 16
+
+// BlockPropagation describes how a block relayed with RelayBlock reached
+// the network
+type BlockPropagation struct {
+	Hash      Hash      `json:"hash"`
+	RelayedAt time.Time `json:"relayed_at"`
+	Peers     int       `json:"peers"`  // Peers the block was sent to
+	Failed    int       `json:"failed"` // Peers the block couldn't be written to
+
+	// Milliseconds from the relay until each peer acknowledged the block,
+	// by peer address, and their median
+	AckMillis       map[string]int64 `json:"ack_ms"`
+	MedianAckMillis int64            `json:"median_ack_ms,omitempty"`
+}
+
+// relayTracker keeps the propagation of the last relayed blocks
+type relayTracker struct {
+	mu     sync.Mutex
+	relays []*BlockPropagation // Oldest first
+}
+
+// start begins tracking a block sent to peers
+func (t *relayTracker) start(hash Hash, peers int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.relays = append(t.relays, &BlockPropagation{
+		Hash:      hash,
+		RelayedAt: now,
+		Peers:     peers,
+		AckMillis: make(map[string]int64),
+	})
+	if len(t.relays) > maxTrackedRelays {
+		t.relays = t.relays[len(t.relays)-maxTrackedRelays:]
+	}
+}
+
+// failed counts a peer the block couldn't be written to
+func (t *relayTracker) failed(hash Hash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if relay := t.find(hash); relay != nil {
+		relay.Failed++
+	}
+}
+
+// ack records a peer's acknowledgment of a relayed block. Only the first
+// acknowledgment of each peer counts.
+func (t *relayTracker) ack(hash Hash, peer string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	relay := t.find(hash)
+	if relay == nil {
+		return
+	}
+	if _, ok := relay.AckMillis[peer]; !ok {
+		relay.AckMillis[peer] = now.Sub(relay.RelayedAt).Milliseconds()
+	}
+}
+
+// find returns the tracked relay of a block; the caller must hold t.mu
+func (t *relayTracker) find(hash Hash) *BlockPropagation {
+	for _, relay := range t.relays {
+		if relay.Hash == hash {
+			return relay
+		}
+	}
+	return nil
+}
+
+// snapshot returns copies of the tracked relays, newest first
+func (t *relayTracker) snapshot() []BlockPropagation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	relays := make([]BlockPropagation, 0, len(t.relays))
+	for i := len(t.relays) - 1; i >= 0; i-- {
+		relay := *t.relays[i]
+		relay.AckMillis = make(map[string]int64, len(t.relays[i].AckMillis))
+		times := make([]int64, 0, len(relay.AckMillis))
+		for peer, ms := range t.relays[i].AckMillis {
+			relay.AckMillis[peer] = ms
+			times = append(times, ms)
+		}
+		if len(times) > 0 {
+			sort.Slice(times, func(a, b int) bool { return times[a] < times[b] })
+			relay.MedianAckMillis = times[len(times)/2]
+		}
+		relays = append(relays, relay)
+	}
+	return relays
+}
+
+// RelayBlock sends a block to every connected peer at once, for blocks the
+// pool found that must reach the network before competing ones. Each peer
+// gets the header announcement and then the block from its own goroutine,
+// so a slow peer doesn't hold up the others, and the upload target doesn't
+// apply. It returns without waiting for the writes; see BlockPropagation
+// for when peers acknowledged the block.
+func (n *Network) RelayBlock(block *Block) {
+	header, err := json.Marshal(block.Header())
+	if err != nil {
+		log.Printf("Failed to encode header of block %x: %v", block.Hash, err)
+		return
+	}
+	announce, err := encodeMessage(Message{Type: MsgTypeNewBlock, Payload: header}, false)
+	if err != nil {
+		log.Printf("Failed to encode header of block %x: %v", block.Hash, err)
+		return
+	}
+	payload, err := json.Marshal(block)
+	if err != nil {
+		log.Printf("Failed to encode block %x: %v", block.Hash, err)
+		return
+	}
+	msg := Message{Type: MsgTypeBlock, Payload: payload}
+	plain, err := encodeMessage(msg, false)
+	if err != nil {
+		log.Printf("Failed to encode block %x: %v", block.Hash, err)
+		return
+	}
+	compressed, err := encodeMessage(msg, true)
+	if err != nil {
+		compressed = plain
+	}
+
+	peers := n.GetPeers()
+	n.relays.start(block.Hash, len(peers), time.Now())
+	for _, peer := range peers {
+		data := plain
+		if atomic.LoadInt32(&peer.compress) == 1 {
+			data = compressed
+		}
+		go func(peer *Peer, data []byte) {
+			if err := n.writeMessage(peer, MsgTypeNewBlock, announce); err == nil {
+				err = n.writeMessage(peer, MsgTypeBlock, data)
+			}
+			if err != nil {
+				n.relays.failed(block.Hash)
+				log.Printf("Failed to relay block %x to peer %s: %v", block.Hash, peer.Address, err)
+			}
+		}(peer, data)
+	}
+}
+
+// writeMessage writes an encoded message to a peer
+func (n *Network) writeMessage(peer *Peer, msgType string, data []byte) error {
+	written, err := peer.Conn.Write(data)
+	if written > 0 {
+		n.countSent(peer, msgType, written)
+	}
+	return err
+}
+
+// BlockPropagation returns how the last blocks relayed with RelayBlock
+// reached peers, newest first
+func (n *Network) BlockPropagation() []BlockPropagation {
+	return n.relays.snapshot()
+}
+
+// handleNewBlock processes a header announced ahead of its block. Valid
+// announcements are remembered so the block is acknowledged once accepted.
+// It returns false if the peer exceeded its header allowance.
+func (n *Network) handleNewBlock(peer *Peer, header BlockHeader) bool {
+	if !n.countHeaders(peer, 1) {
+		return false
+	}
+	if _, err := n.blockchain.ProcessHeaders([]BlockHeader{header}); err != nil {
+		return true
+	}
+	if peer.announced == nil {
+		peer.announced = make(map[Hash]bool)
+	}
+	if len(peer.announced) >= maxAnnounced {
+		for hash := range peer.announced {
+			delete(peer.announced, hash)
+			break
+		}
+	}
+	peer.announced[header.Hash] = true
+	return true
+}
+
+// ackBlock acknowledges an accepted block the peer announced
+func (n *Network) ackBlock(peer *Peer, hash Hash) {
+	if !peer.announced[hash] {
+		return
+	}
+	delete(peer.announced, hash)
+	n.sendMessage(peer, MsgTypeBlockAck, BlockAckPayload{Hash: hash})
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipePeers connects two networks over an in-memory connection
+func pipePeers(t *testing.T, a, b *Network) {
+	connA, connB := net.Pipe()
+	t.Cleanup(func() { connA.Close(); connB.Close() })
+	for _, side := range []struct {
+		n    *Network
+		conn net.Conn
+		addr string
+	}{{a, connA, "b"}, {b, connB, "a"}} {
+		peer := &Peer{Address: side.addr, Conn: side.conn, LastSeen: time.Now(), connectedAt: time.Now(), done: make(chan struct{})}
+		side.n.peers[peer.Address] = peer
+		go side.n.handlePeer(peer)
+	}
+}
+
+// newTestNetwork returns a network of bc without a listener
+func newTestNetwork(t *testing.T, bc *Blockchain) *Network {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Network{
+		blockchain: bc,
+		peers:      make(map[string]*Peer),
+		managed:    make(map[string]*managedPeer),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func TestRelayBlock(t *testing.T) {
+	pool := NewBlockchainWithParams(&RegTestParams)
+	node := NewBlockchainWithParams(&RegTestParams)
+	poolNet, nodeNet := newTestNetwork(t, pool), newTestNetwork(t, node)
+	pipePeers(t, poolNet, nodeNet)
+
+	block, err := pool.GenerateBlock([]byte("pool"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolNet.RelayBlock(block)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		relays := poolNet.BlockPropagation()
+		if len(relays) != 1 || relays[0].Hash != block.Hash || relays[0].Peers != 1 {
+			t.Fatalf("propagation = %+v", relays)
+		}
+		if _, ok := relays[0].AckMillis["b"]; ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("block not acknowledged: %+v", relays[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := node.GetHeight(); got != 1 {
+		t.Errorf("node height = %d after relay, want 1", got)
+	}
+}
+
+func TestRelayTracker(t *testing.T) {
+	var tracker relayTracker
+	start := time.Now()
+	for i := 0; i < maxTrackedRelays+5; i++ {
+		tracker.start(Hash{byte(i)}, 3, start)
+	}
+	last := Hash{byte(maxTrackedRelays + 4)}
+	tracker.ack(last, "a", start.Add(30*time.Millisecond))
+	tracker.ack(last, "b", start.Add(10*time.Millisecond))
+	tracker.ack(last, "c", start.Add(20*time.Millisecond))
+	tracker.ack(last, "a", start.Add(time.Second)) // Only the first ack counts
+	tracker.ack(Hash{0}, "a", start)               // No longer tracked
+	tracker.failed(last)
+
+	relays := tracker.snapshot()
+	if len(relays) != maxTrackedRelays || relays[0].Hash != last {
+		t.Fatalf("tracked %d relays, newest %x", len(relays), relays[0].Hash)
+	}
+	if got := relays[0]; got.MedianAckMillis != 20 || got.AckMillis["a"] != 30 || got.Failed != 1 {
+		t.Errorf("newest relay = %+v", got)
+	}
+}
@@ -0,0 +1,203 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrDuplicateBlock is returned for a block that is already known
+	ErrDuplicateBlock = errors.New("block already known")
+
+	// ErrOrphanBlock is returned for a block whose parent is unknown. The
+	// block is kept and connected once its parent arrives; see OrphanRoot.
+	ErrOrphanBlock = errors.New("block parent is unknown")
+)
+
+// ProcessBlock validates a block received from the network and connects
+// it. A block extending the tip is appended; a block on a side branch is
+// kept, and if its branch has more cumulative work than the main chain
+// above the fork point the chain is reorganized onto it. Subscribers get
+// NTBlockDisconnected for every block removed (tip first), NTBlockConnected
+// for every block added, and NTReorganization once the switch is complete.
+// A block whose parent is unknown is kept as an orphan and ErrOrphanBlock
+// returned; orphans are processed in turn once their parent is accepted.
+func (bc *Blockchain) ProcessBlock(block *Block) error {
+	bc.mu.Lock()
+	notifications, err := bc.processBlock(block)
+	switch err {
+	case nil:
+		notifications = append(notifications, bc.connectOrphans(block.Hash)...)
+	case ErrOrphanBlock:
+		bc.orphans.add(block, time.Now())
+	}
+	bc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		bc.sendNotification(n.Type, n.Data)
+	}
+	return nil
+}
+
+// processBlock connects a block; the caller must hold bc.mu
+func (bc *Blockchain) processBlock(block *Block) ([]*Notification, error) {
+	if block.CalculateHash() != block.Hash {
+		return nil, errors.New("block hash does not match header")
+	}
+	header := block.Header()
+	if err := bc.checkHeaderDifficulty(&header); err != nil {
+		return nil, err
+	}
+	if !block.ValidatePoW() {
+		return nil, errors.New("invalid proof of work")
+	}
+	if block.MerkleRoot != block.CalculateMerkleRoot() {
+		return nil, errors.New("merkle root mismatch")
+	}
+
+	if bc.mainChainHeight(block.Hash) >= 0 || bc.sideBlocks[block.Hash] != nil {
+		return nil, ErrDuplicateBlock
+	}
+	if bc.invalid[block.PrevHash] {
+		bc.sideBlocks[block.Hash] = block
+		bc.indexBlock(block)
+		bc.invalid[block.Hash] = true
+		return nil, ErrInvalidAncestor
+	}
+	if err := bc.checkBlockTime(block); err != nil {
+		return nil, err
+	}
+
+	// Fast path: the block extends the tip
+	tip := bc.blocks[len(bc.blocks)-1]
+	if block.PrevHash == tip.Hash {
+		if cp := bc.params.CheckpointAt(len(bc.blocks)); cp != nil && cp.Hash != block.Hash {
+			return nil, fmt.Errorf("block at height %d contradicts checkpoint", len(bc.blocks))
+		}
+		if err := bc.checkBlockTransactions(block, len(bc.blocks), bc.utxos); err != nil {
+			return nil, err
+		}
+		bc.connectBlock(block)
+		bc.publishStatus()
+		return []*Notification{{Type: NTBlockConnected, Data: block}}, nil
+	}
+
+	// Walk back through known side blocks to the main chain
+	branch := []*Block{block}
+	forkHeight := bc.mainChainHeight(block.PrevHash)
+	for forkHeight < 0 {
+		parent := bc.sideBlocks[branch[0].PrevHash]
+		if parent == nil {
+			return nil, ErrOrphanBlock
+		}
+		branch = append([]*Block{parent}, branch...)
+		forkHeight = bc.mainChainHeight(parent.PrevHash)
+	}
+
+	if cp := bc.params.LastCheckpoint(); cp != nil && forkHeight < cp.Height {
+		return nil, ErrForkBelowCheckpoint
+	}
+	for i, b := range branch {
+		if cp := bc.params.CheckpointAt(forkHeight + 1 + i); cp != nil && cp.Hash != b.Hash {
+			return nil, fmt.Errorf("block at height %d contradicts checkpoint", forkHeight+1+i)
+		}
+	}
+
+	if err := bc.params.checkTreasury(forkHeight+len(branch), block); err != nil {
+		return nil, err
+	}
+	bc.sideBlocks[block.Hash] = block
+	if bc.indexBlock(block).chainWork.Cmp(bc.tipWork()) <= 0 {
+		// Side branch without more work; keep it in case it grows
+		return nil, nil
+	}
+
+	if err := bc.checkBranch(forkHeight, branch); err != nil {
+		return nil, err
+	}
+	return bc.reorganize(forkHeight, branch), nil
+}
+
+// checkBranch checks the transactions of a branch forking off the main
+// chain after forkHeight against the UTXO set as the branch would see it,
+// before the chain reorganizes onto it. The first block that fails and its
+// descendants are marked invalid. The caller must hold bc.mu for writing.
+func (bc *Blockchain) checkBranch(forkHeight int, branch []*Block) error {
+	view := newUTXOView(bc.utxos)
+	for height := len(bc.blocks) - 1; height > forkHeight; height-- {
+		block := bc.blocks[height]
+		view.disconnectBlock(block, bc.undo[block.Hash])
+	}
+	for i, block := range branch {
+		height := forkHeight + 1 + i
+		if err := bc.checkBlockTransactions(block, height, view); err != nil {
+			bc.invalid[block.Hash] = true
+			bc.markDescendantsInvalid()
+			return fmt.Errorf("block %x at height %d: %v", block.Hash, height, err)
+		}
+		view.connectBlock(block, height)
+	}
+	return nil
+}
+
+// reorganize switches the main chain to branch, which forks off the main
+// chain after forkHeight; the caller must hold bc.mu
+func (bc *Blockchain) reorganize(forkHeight int, branch []*Block) []*Notification {
+	oldTip := bc.blocks[len(bc.blocks)-1].Hash
+	notifications := make([]*Notification, 0, len(bc.blocks)-forkHeight+len(branch))
+
+	// Disconnect from the tip down, returning transactions to the mempool
+	for len(bc.blocks)-1 > forkHeight {
+		disconnected := bc.disconnectTip()
+		bc.sideBlocks[disconnected.Hash] = disconnected
+		for _, tx := range blockTransactions(disconnected) {
+			if !tx.IsCoinbase() {
+				bc.addToMempool(tx)
+			}
+		}
+		notifications = append(notifications, &Notification{Type: NTBlockDisconnected, Data: disconnected})
+	}
+
+	for _, connected := range branch {
+		delete(bc.sideBlocks, connected.Hash)
+		bc.connectBlock(connected)
+		notifications = append(notifications, &Notification{Type: NTBlockConnected, Data: connected})
+	}
+	bc.trimMempool(time.Now())
+
+	bc.publishStatus()
+	newTip := bc.blocks[len(bc.blocks)-1].Hash
+	log.Printf("Chain reorganization at height %d: %x -> %x", forkHeight, oldTip, newTip)
+
+	return append(notifications, &Notification{
+		Type: NTReorganization,
+		Data: &ReorganizationData{
+			OldTip:     oldTip,
+			NewTip:     newTip,
+			ForkHeight: forkHeight,
+		},
+	})
+}
+
+// mainChainHeight returns the height of a main-chain block, or -1 if the
+// hash is not on the main chain; the caller must hold bc.mu
+func (bc *Blockchain) mainChainHeight(hash [32]byte) int {
+	if node, ok := bc.index[hash]; ok && node.height < len(bc.blocks) && bc.blocks[node.height].Hash == hash {
+		return node.height
+	}
+	return -1
+}
+
+// blockTransactions returns pointers to a block's transactions
+func blockTransactions(block *Block) []*Transaction {
+	txs := make([]*Transaction, len(block.Transactions))
+	for i := range block.Transactions {
+		txs[i] = &block.Transactions[i]
+	}
+	return txs
+}
@@ -0,0 +1,465 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Output scripts follow fixed templates, laid out as their Bitcoin
+// counterparts so the same tooling can read them, rather than being run by
+// a general interpreter:
+//
+//	pubkey      <65-byte public key>
+//	pubkeyhash  OP_DUP OP_HASH160 <20-byte key hash> OP_EQUALVERIFY OP_CHECKSIG
+//	scripthash  OP_HASH160 <20-byte script hash> OP_EQUAL
+//	multisig    OP_m <public key>... OP_n OP_CHECKMULTISIG
+//
+// Any other script, such as the bare addresses miners are paid to, is
+// nonstandard: it carries no key and its spends aren't checked. Time-locked
+// scripts wrap one of these, see NewTimeLockScript.
+
+// Opcodes of the script templates
+const (
+	opPushData1     = 0x4c
+	opPushData2     = 0x4d
+	op1             = 0x51 // OP_1; OP_n is op1 + n - 1
+	opDup           = 0x76
+	opEqual         = 0x87
+	opEqualVerify   = 0x88
+	opHash160       = 0xa9
+	opCheckSig      = 0xac
+	opCheckMultiSig = 0xae
+)
+
+// pubKeyScriptSize is the size of an output script paying a public key: an
+// uncompressed P-256 point, as the pool and node wallets pay themselves
+const pubKeyScriptSize = 65
+
+// MaxMultiSigKeys is the most keys a multisig script may hold
+const MaxMultiSigKeys = 16
+
+// ScriptClass identifies the template of an output script
+type ScriptClass int
+
+// Script classes
+const (
+	NonStandardScript ScriptClass = iota
+	PubKeyScript
+	PubKeyHashScript
+	ScriptHashScript
+	MultiSigScript
+)
+
+// scriptClassNames are the names of the script classes, as RPCs show them
+var scriptClassNames = map[ScriptClass]string{
+	NonStandardScript: "nonstandard",
+	PubKeyScript:      "pubkey",
+	PubKeyHashScript:  "pubkeyhash",
+	ScriptHashScript:  "scripthash",
+	MultiSigScript:    "multisig",
+}
+
+// String returns the name of a script class
+func (c ScriptClass) String() string {
+	return scriptClassNames[c]
+}
+
+// Hash160 returns RIPEMD-160 of SHA-256 of data, the hash pubkeyhash and
+// scripthash scripts commit to
+func Hash160(data []byte) [20]byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	var hash [20]byte
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// marshalPubKey returns the uncompressed encoding of a public key
+func marshalPubKey(key *ecdsa.PublicKey) []byte {
+	return elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+}
+
+// NewPubKeyScript returns an output script paying a public key
+func NewPubKeyScript(key *ecdsa.PublicKey) []byte {
+	return marshalPubKey(key)
+}
+
+// NewPubKeyHashScript returns an output script paying the hash of a public
+// key, spent with the key and its signature
+func NewPubKeyHashScript(key *ecdsa.PublicKey) []byte {
+	hash := Hash160(marshalPubKey(key))
+	script := []byte{opDup, opHash160, 20}
+	script = append(script, hash[:]...)
+	return append(script, opEqualVerify, opCheckSig)
+}
+
+// NewScriptHashScript returns an output script paying the hash of a
+// redeem script, spent with the redeem script and what it requires
+func NewScriptHashScript(redeemScript []byte) []byte {
+	hash := Hash160(redeemScript)
+	script := []byte{opHash160, 20}
+	script = append(script, hash[:]...)
+	return append(script, opEqual)
+}
+
+// NewMultiSigScript returns a script spendable with signatures by m of
+// keys. It is usually the redeem script of a scripthash output, as the
+// relay policy's script size limit only allows small bare multisigs.
+func NewMultiSigScript(m int, keys []*ecdsa.PublicKey) ([]byte, error) {
+	if len(keys) == 0 || len(keys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d keys, got %d", MaxMultiSigKeys, len(keys))
+	}
+	if m < 1 || m > len(keys) {
+		return nil, fmt.Errorf("multisig needs 1 to %d signatures, got %d", len(keys), m)
+	}
+	script := []byte{byte(op1 + m - 1)}
+	for _, key := range keys {
+		script = append(script, pubKeyScriptSize)
+		script = append(script, marshalPubKey(key)...)
+	}
+	return append(script, byte(op1+len(keys)-1), opCheckMultiSig), nil
+}
+
+// ClassifyScript returns the template of an output script
+func ClassifyScript(script []byte) ScriptClass {
+	switch {
+	case parsePubKeyScript(script) != nil:
+		return PubKeyScript
+	case parsePubKeyHashScript(script) != nil:
+		return PubKeyHashScript
+	case parseScriptHashScript(script) != nil:
+		return ScriptHashScript
+	}
+	if _, _, ok := parseMultiSigScript(script); ok {
+		return MultiSigScript
+	}
+	return NonStandardScript
+}
+
+// parsePubKeyScript returns the public key an output script pays, or nil
+// if the script isn't a public key
+func parsePubKeyScript(script []byte) *ecdsa.PublicKey {
+	if len(script) != pubKeyScriptSize || script[0] != 4 {
+		return nil
+	}
+	return ParsePubKey(script)
+}
+
+// ParsePubKey decodes an uncompressed P-256 public key, or returns nil
+func ParsePubKey(data []byte) *ecdsa.PublicKey {
+	x, y := elliptic.Unmarshal(elliptic.P256(), data)
+	if x == nil {
+		return nil
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+}
+
+// parsePubKeyHashScript returns the key hash a pubkeyhash script pays, or
+// nil for any other script
+func parsePubKeyHashScript(script []byte) []byte {
+	if len(script) != 25 || script[0] != opDup || script[1] != opHash160 || script[2] != 20 ||
+		script[23] != opEqualVerify || script[24] != opCheckSig {
+		return nil
+	}
+	return script[3:23]
+}
+
+// parseScriptHashScript returns the script hash a scripthash script pays,
+// or nil for any other script
+func parseScriptHashScript(script []byte) []byte {
+	if len(script) != 23 || script[0] != opHash160 || script[1] != 20 || script[22] != opEqual {
+		return nil
+	}
+	return script[2:22]
+}
+
+// parseMultiSigScript returns the signatures required and the keys of a
+// multisig script, with ok false for any other script
+func parseMultiSigScript(script []byte) (m int, keys []*ecdsa.PublicKey, ok bool) {
+	if len(script) < 3 || script[len(script)-1] != opCheckMultiSig {
+		return 0, nil, false
+	}
+	m = int(script[0]) - op1 + 1
+	n := int(script[len(script)-2]) - op1 + 1
+	if n < 1 || n > MaxMultiSigKeys || m < 1 || m > n || len(script) != 3+n*(1+pubKeyScriptSize) {
+		return 0, nil, false
+	}
+	keys = make([]*ecdsa.PublicKey, n)
+	for i := range keys {
+		push := script[1+i*(1+pubKeyScriptSize):]
+		if push[0] != pubKeyScriptSize {
+			return 0, nil, false
+		}
+		if keys[i] = ParsePubKey(push[1 : 1+pubKeyScriptSize]); keys[i] == nil {
+			return 0, nil, false
+		}
+	}
+	return m, keys, true
+}
+
+// ScriptInfo describes an output script, for decodescript
+type ScriptInfo struct {
+	Class        string   `json:"type"`
+	RequiredSigs int      `json:"reqSigs,omitempty"`
+	PubKeys      []string `json:"pubkeys,omitempty"` // Hex, of pubkey and multisig scripts
+	Hash         string   `json:"hash,omitempty"`    // Hex, of pubkeyhash and scripthash scripts
+	P2SH         string   `json:"p2sh,omitempty"`    // The scripthash script paying this one, in hex
+}
+
+// DescribeScript describes an output script's template and keys
+func DescribeScript(script []byte) ScriptInfo {
+	class := ClassifyScript(script)
+	info := ScriptInfo{Class: class.String()}
+	switch class {
+	case PubKeyScript:
+		info.RequiredSigs = 1
+		info.PubKeys = []string{fmt.Sprintf("%x", script)}
+	case PubKeyHashScript:
+		info.RequiredSigs = 1
+		info.Hash = fmt.Sprintf("%x", parsePubKeyHashScript(script))
+	case ScriptHashScript:
+		info.Hash = fmt.Sprintf("%x", parseScriptHashScript(script))
+	case MultiSigScript:
+		m, keys, _ := parseMultiSigScript(script)
+		info.RequiredSigs = m
+		for _, key := range keys {
+			info.PubKeys = append(info.PubKeys, fmt.Sprintf("%x", marshalPubKey(key)))
+		}
+	}
+	if class != ScriptHashScript {
+		info.P2SH = fmt.Sprintf("%x", NewScriptHashScript(script))
+	}
+	return info
+}
+
+// pushData returns a script pushing data, with the shortest push opcode
+func pushData(data []byte) []byte {
+	switch {
+	case len(data) < opPushData1:
+		return append([]byte{byte(len(data))}, data...)
+	case len(data) <= 0xff:
+		return append([]byte{opPushData1, byte(len(data))}, data...)
+	default:
+		push := []byte{opPushData2, 0, 0}
+		binary.LittleEndian.PutUint16(push[1:], uint16(len(data)))
+		return append(push, data...)
+	}
+}
+
+// parsePushes decodes a signature script made only of data pushes, each
+// with the shortest push opcode, as pushData writes them
+func parsePushes(script []byte) ([][]byte, error) {
+	var pushes [][]byte
+	for len(script) > 0 {
+		var size, header int
+		switch op := script[0]; {
+		case op > 0 && op < opPushData1:
+			size, header = int(op), 1
+		case op == opPushData1 && len(script) >= 2:
+			size, header = int(script[1]), 2
+			if size < opPushData1 {
+				return nil, errors.New("signature script push is not minimal")
+			}
+		case op == opPushData2 && len(script) >= 3:
+			size, header = int(binary.LittleEndian.Uint16(script[1:])), 3
+			if size <= 0xff {
+				return nil, errors.New("signature script push is not minimal")
+			}
+		default:
+			return nil, fmt.Errorf("signature script has a non-push opcode 0x%02x", op)
+		}
+		if len(script) < header+size {
+			return nil, errors.New("signature script push is truncated")
+		}
+		pushes = append(pushes, script[header:header+size])
+		script = script[header+size:]
+	}
+	return pushes, nil
+}
+
+// checkInputSignature checks the signature script of an input spending an
+// output with the given script, against the transaction's SignatureHash.
+// Outputs paying a public key take its signature as the whole signature
+// script. Other standard scripts take data pushes: pubkeyhash the
+// signature and the key, multisig the signatures in the order of their
+// keys, and scripthash what the redeem script takes followed by the redeem
+// script, which must be a pubkey, pubkeyhash or multisig script.
+// Nonstandard scripts carry no key and aren't checked.
+func checkInputSignature(sigHash [32]byte, sigScript, script []byte) error {
+	class := ClassifyScript(script)
+	switch class {
+	case NonStandardScript:
+		return nil
+	case PubKeyScript:
+		if len(sigScript) == 0 {
+			return errors.New("missing signature")
+		}
+		return verifySignature(parsePubKeyScript(script), sigHash, sigScript)
+	}
+
+	pushes, err := parsePushes(sigScript)
+	if err != nil {
+		return err
+	}
+	if class == ScriptHashScript {
+		if len(pushes) == 0 {
+			return errors.New("missing redeem script")
+		}
+		redeem := pushes[len(pushes)-1]
+		hash := Hash160(redeem)
+		if !bytes.Equal(hash[:], parseScriptHashScript(script)) {
+			return errors.New("redeem script does not match the script hash")
+		}
+		pushes, script = pushes[:len(pushes)-1], redeem
+		if class = ClassifyScript(script); class == ScriptHashScript || class == NonStandardScript {
+			return fmt.Errorf("redeem script is %s", class)
+		}
+	}
+	return checkScriptPushes(sigHash, pushes, script, class)
+}
+
+// checkScriptPushes checks the data pushed to spend a pubkey, pubkeyhash
+// or multisig script
+func checkScriptPushes(sigHash [32]byte, pushes [][]byte, script []byte, class ScriptClass) error {
+	switch class {
+	case PubKeyScript:
+		if len(pushes) != 1 {
+			return errors.New("pubkey script takes one signature")
+		}
+		return verifySignature(parsePubKeyScript(script), sigHash, pushes[0])
+
+	case PubKeyHashScript:
+		if len(pushes) != 2 {
+			return errors.New("pubkeyhash script takes a signature and a public key")
+		}
+		hash := Hash160(pushes[1])
+		if !bytes.Equal(hash[:], parsePubKeyHashScript(script)) {
+			return errors.New("public key does not match the key hash")
+		}
+		key := ParsePubKey(pushes[1])
+		if key == nil {
+			return errors.New("invalid public key")
+		}
+		return verifySignature(key, sigHash, pushes[0])
+
+	case MultiSigScript:
+		m, keys, _ := parseMultiSigScript(script)
+		if len(pushes) != m {
+			return fmt.Errorf("multisig script takes %d signatures, got %d", m, len(pushes))
+		}
+		// Signatures are matched to keys in order, each key used once
+		next := 0
+		for i, sig := range pushes {
+			for next < len(keys) && verifySignature(keys[next], sigHash, sig) != nil {
+				next++
+			}
+			if next == len(keys) {
+				return fmt.Errorf("multisig signature %d matches no remaining key", i)
+			}
+			next++
+		}
+		return nil
+	}
+	return fmt.Errorf("can't spend a %s script", class)
+}
+
+// SignInput sets the signature script of input i, spending an output with
+// script prevScript, and updates the transaction's hash. Scripthash
+// outputs need their redeem script; other scripts take nil. signers must
+// hold the keys the script requires: one for pubkey and pubkeyhash
+// scripts, and at least m of a multisig's keys, of which the first m in
+// key order sign. Time-locked scripts are signed as the script they wrap.
+func (tx *Transaction) SignInput(i int, prevScript, redeemScript []byte, signers ...Signer) error {
+	if i < 0 || i >= len(tx.Inputs) {
+		return fmt.Errorf("no input %d", i)
+	}
+	if _, inner, ok := ParseTimeLockScript(prevScript); ok {
+		prevScript = inner
+	}
+	script, class := prevScript, ClassifyScript(prevScript)
+	if class == ScriptHashScript {
+		hash := Hash160(redeemScript)
+		if !bytes.Equal(hash[:], parseScriptHashScript(prevScript)) {
+			return errors.New("redeem script does not match the script hash")
+		}
+		script, class = redeemScript, ClassifyScript(redeemScript)
+	}
+
+	hash := tx.SignatureHash()
+	sign := func(signer Signer) ([]byte, error) {
+		sig, err := signer.SignHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifySignature(signer.PublicKey(), hash, sig); err != nil {
+			return nil, fmt.Errorf("signer returned a bad signature: %v", err)
+		}
+		return sig, nil
+	}
+	var pushes [][]byte
+	switch class {
+	case PubKeyScript, PubKeyHashScript:
+		if len(signers) != 1 {
+			return fmt.Errorf("%s script takes one signer", class)
+		}
+		key := marshalPubKey(signers[0].PublicKey())
+		if class == PubKeyScript && !bytes.Equal(key, script) {
+			return errors.New("signer's key is not the script's")
+		}
+		if hash := Hash160(key); class == PubKeyHashScript && !bytes.Equal(hash[:], parsePubKeyHashScript(script)) {
+			return errors.New("signer's key does not match the key hash")
+		}
+		sig, err := sign(signers[0])
+		if err != nil {
+			return err
+		}
+		pushes = [][]byte{sig}
+		if class == PubKeyHashScript {
+			pushes = append(pushes, key)
+		}
+	case MultiSigScript:
+		m, keys, _ := parseMultiSigScript(script)
+		for _, key := range keys {
+			for _, signer := range signers {
+				if len(pushes) < m && bytes.Equal(marshalPubKey(signer.PublicKey()), marshalPubKey(key)) {
+					sig, err := sign(signer)
+					if err != nil {
+						return err
+					}
+					pushes = append(pushes, sig)
+					break
+				}
+			}
+		}
+		if len(pushes) < m {
+			return fmt.Errorf("multisig script takes %d signatures, got signers for %d", m, len(pushes))
+		}
+	default:
+		return fmt.Errorf("can't sign a %s script", class)
+	}
+
+	var sigScript []byte
+	switch ClassifyScript(prevScript) {
+	case PubKeyScript:
+		// Bare pubkey outputs take the signature itself
+		sigScript = pushes[0]
+	case ScriptHashScript:
+		pushes = append(pushes, redeemScript)
+		fallthrough
+	default:
+		for _, push := range pushes {
+			sigScript = append(sigScript, pushData(push)...)
+		}
+	}
+	tx.Inputs[i].Script = sigScript
+	tx.Hash = tx.CalculateHash()
+	return nil
+}
@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"testing"
+)
+
+func TestClassifyScript(t *testing.T) {
+	key, pubKey := newTestKey(t)
+	other, _ := newTestKey(t)
+	multiSig, err := NewMultiSigScript(1, []*ecdsa.PublicKey{&key.PublicKey, &other.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   ScriptClass
+	}{
+		{"pubkey", pubKey, PubKeyScript},
+		{"pubkeyhash", NewPubKeyHashScript(&key.PublicKey), PubKeyHashScript},
+		{"scripthash", NewScriptHashScript(multiSig), ScriptHashScript},
+		{"multisig", multiSig, MultiSigScript},
+		{"address", []byte("miner-address"), NonStandardScript},
+		{"truncated multisig", multiSig[:len(multiSig)-1], NonStandardScript},
+		{"bad key", append([]byte{4}, make([]byte, 64)...), NonStandardScript},
+		{"empty", nil, NonStandardScript},
+	}
+	for _, tt := range tests {
+		if got := ClassifyScript(tt.script); got != tt.want {
+			t.Errorf("%s: ClassifyScript = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := NewMultiSigScript(3, []*ecdsa.PublicKey{&key.PublicKey, &other.PublicKey}); err == nil {
+		t.Error("3-of-2 multisig created")
+	}
+}
+
+func TestSignInput(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	pubKeys := make([]*ecdsa.PublicKey, 3)
+	signers := make([]Signer, 3)
+	for i := range keys {
+		keys[i], _ = newTestKey(t)
+		pubKeys[i] = &keys[i].PublicKey
+		signers[i] = KeySigner{Key: keys[i]}
+	}
+	multiSig, err := NewMultiSigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHash := NewPubKeyHashScript(pubKeys[0])
+
+	tests := []struct {
+		name    string
+		script  []byte
+		redeem  []byte
+		signers []Signer
+	}{
+		{"pubkey", NewPubKeyScript(pubKeys[0]), nil, signers[:1]},
+		{"pubkeyhash", keyHash, nil, signers[:1]},
+		{"multisig", multiSig, nil, []Signer{signers[2], signers[0]}},
+		{"scripthash multisig", NewScriptHashScript(multiSig), multiSig, signers[1:]},
+		{"scripthash pubkeyhash", NewScriptHashScript(keyHash), keyHash, signers[:1]},
+		{"time-locked pubkeyhash", NewTimeLockScript(10, keyHash), nil, signers[:1]},
+	}
+	for _, tt := range tests {
+		tx := NewTransaction(
+			[]TxInput{{PrevTxHash: Hash{1}, Sequence: 0xFFFFFFFE}},
+			[]TxOutput{{Value: 1000, Script: []byte("payee")}},
+		)
+		if err := tx.SignInput(0, tt.script, tt.redeem, tt.signers...); err != nil {
+			t.Errorf("%s: SignInput: %v", tt.name, err)
+			continue
+		}
+		script := tt.script
+		if _, inner, ok := ParseTimeLockScript(script); ok {
+			script = inner
+		}
+		if err := checkInputSignature(tx.SignatureHash(), tx.Inputs[0].Script, script); err != nil {
+			t.Errorf("%s: signature script rejected: %v", tt.name, err)
+		}
+	}
+}
+
+func TestCheckInputSignatureRejects(t *testing.T) {
+	key, _ := newTestKey(t)
+	other, _ := newTestKey(t)
+	multiSig, err := NewMultiSigScript(2, []*ecdsa.PublicKey{&key.PublicKey, &other.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHash := NewPubKeyHashScript(&key.PublicKey)
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: Hash{1}, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 1000, Script: []byte("payee")}},
+	)
+	hash := tx.SignatureHash()
+	sig, _ := KeySigner{Key: key}.SignHash(hash)
+	otherSig, _ := KeySigner{Key: other}.SignHash(hash)
+	pubKey := marshalPubKey(&key.PublicKey)
+	push := func(pushes ...[]byte) []byte {
+		var script []byte
+		for _, p := range pushes {
+			script = append(script, pushData(p)...)
+		}
+		return script
+	}
+
+	tests := []struct {
+		name      string
+		sigScript []byte
+		script    []byte
+	}{
+		{"pubkeyhash with other key", push(otherSig, marshalPubKey(&other.PublicKey)), keyHash},
+		{"pubkeyhash with other signature", push(otherSig, pubKey), keyHash},
+		{"pubkeyhash without key", push(sig), keyHash},
+		{"pubkeyhash with a non-push opcode", append(push(sig, pubKey), opCheckSig), keyHash},
+		{"pubkeyhash with a non-minimal push", append(append([]byte{opPushData1, byte(len(sig))}, sig...), push(pubKey)...), keyHash},
+		{"multisig with one signature", push(sig), multiSig},
+		{"multisig out of order", push(otherSig, sig), multiSig},
+		{"multisig with a repeated signature", push(sig, sig), multiSig},
+		{"scripthash with other redeem script", push(sig, pubKey, keyHash), NewScriptHashScript(multiSig)},
+		{"scripthash without redeem script", nil, NewScriptHashScript(keyHash)},
+		{"scripthash of a nonstandard script", push([]byte("payee")), NewScriptHashScript([]byte("payee"))},
+	}
+	for _, tt := range tests {
+		if err := checkInputSignature(hash, tt.sigScript, tt.script); err == nil {
+			t.Errorf("%s accepted", tt.name)
+		}
+	}
+	if err := checkInputSignature(hash, push(sig, otherSig), multiSig); err != nil {
+		t.Errorf("multisig rejected: %v", err)
+	}
+}
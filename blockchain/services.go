@@ -0,0 +1,137 @@
+package blockchain
+
+import "sync/atomic"
+
+// ServiceFlag is a set of features a node announces in its version message,
+// so peers can pick partners able to serve what they need. Bits a node
+// doesn't know are kept but otherwise ignored, so new features can be
+// announced without breaking older nodes.
+type ServiceFlag uint64
+
+// Services a node can offer
+const (
+	// ServiceFullHistory nodes serve every block since genesis
+	ServiceFullHistory ServiceFlag = 1 << iota
+	// ServiceCompactBlocks nodes relay blocks as short transaction IDs
+	ServiceCompactBlocks
+	// ServiceCFilters nodes serve compact block filters for light clients
+	ServiceCFilters
+)
+
+// serviceNames names the known service bits, in bit order
+var serviceNames = []struct {
+	flag ServiceFlag
+	name string
+}{
+	{ServiceFullHistory, "full_history"},
+	{ServiceCompactBlocks, "compact_blocks"},
+	{ServiceCFilters, "cfilters"},
+}
+
+// DefaultServices are the services a node announces unless told otherwise
+const DefaultServices = ServiceFullHistory
+
+// Has reports whether every service in flag is offered
+func (s ServiceFlag) Has(flag ServiceFlag) bool {
+	return s&flag == flag
+}
+
+// Names returns the names of the known services offered
+func (s ServiceFlag) Names() []string {
+	var names []string
+	for _, known := range serviceNames {
+		if s.Has(known.flag) {
+			names = append(names, known.name)
+		}
+	}
+	return names
+}
+
+// servicesVersion is the first protocol version announcing services. Older
+// nodes serve full history and nothing else.
+const servicesVersion = 2
+
+// peerServices returns the services of a peer from its version message
+func peerServices(version *VersionPayload) ServiceFlag {
+	if version.Version < servicesVersion {
+		return ServiceFullHistory
+	}
+	return version.Services
+}
+
+// negotiateVersion returns the protocol version spoken with a peer, the
+// lower of both sides'
+func negotiateVersion(theirs uint32) uint32 {
+	if theirs < ProtocolVersion {
+		return theirs
+	}
+	return ProtocolVersion
+}
+
+// handleVersion records what a peer's version message announces: its
+// protocol version, services and payload encodings
+func (n *Network) handleVersion(peer *Peer, version *VersionPayload) {
+	atomic.StoreUint32(&peer.version, negotiateVersion(version.Version))
+	atomic.StoreUint64(&peer.services, uint64(peerServices(version)))
+	if n.compressionEnabled() && acceptsEncoding(version.Compression, EncodingGzip) {
+		atomic.StoreInt32(&peer.compress, 1)
+	}
+}
+
+// ProtocolVersion returns the protocol version negotiated with the peer, 0
+// until its version message arrives
+func (p *Peer) ProtocolVersion() uint32 {
+	return atomic.LoadUint32(&p.version)
+}
+
+// Services returns the services the peer announced, none until its
+// version message arrives
+func (p *Peer) Services() ServiceFlag {
+	return ServiceFlag(atomic.LoadUint64(&p.services))
+}
+
+// SetServices sets the services announced to peers connected from now on.
+// It is DefaultServices unless changed.
+func (n *Network) SetServices(services ServiceFlag) {
+	atomic.StoreUint64(&n.services, uint64(services))
+}
+
+// LocalServices returns the services announced to peers
+func (n *Network) LocalServices() ServiceFlag {
+	return ServiceFlag(atomic.LoadUint64(&n.services))
+}
+
+// PeersWithService returns the connected peers offering every service in
+// flag
+func (n *Network) PeersWithService(flag ServiceFlag) []*Peer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var peers []*Peer
+	for _, peer := range n.peers {
+		if peer.Services().Has(flag) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// blockSource returns the peer to download blocks from after headers
+// arrived from peer: peer itself if it serves full history, or else a
+// connected peer that does, preferring pinned ones. Peers that don't keep
+// every block may not have the ones we are missing.
+func (n *Network) blockSource(peer *Peer) *Peer {
+	if peer.Services().Has(ServiceFullHistory) {
+		return peer
+	}
+	var source *Peer
+	for _, candidate := range n.PeersWithService(ServiceFullHistory) {
+		if source == nil || candidate.Pinned && !source.Pinned {
+			source = candidate
+		}
+	}
+	if source == nil {
+		return peer
+	}
+	return source
+}
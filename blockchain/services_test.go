@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandleVersion(t *testing.T) {
+	n := &Network{peers: make(map[string]*Peer), services: uint64(DefaultServices)}
+	tests := []struct {
+		name         string
+		version      VersionPayload
+		wantVersion  uint32
+		wantServices ServiceFlag
+		wantNames    []string
+	}{
+		{
+			name:         "old node serves full history",
+			version:      VersionPayload{Version: 1},
+			wantVersion:  1,
+			wantServices: ServiceFullHistory,
+			wantNames:    []string{"full_history"},
+		},
+		{
+			name:         "pruned node",
+			version:      VersionPayload{Version: ProtocolVersion, Services: ServiceCFilters},
+			wantVersion:  ProtocolVersion,
+			wantServices: ServiceCFilters,
+			wantNames:    []string{"cfilters"},
+		},
+		{
+			name:         "newer node with unknown services",
+			version:      VersionPayload{Version: ProtocolVersion + 3, Services: ServiceFullHistory | ServiceCompactBlocks | 1<<40},
+			wantVersion:  ProtocolVersion,
+			wantServices: ServiceFullHistory | ServiceCompactBlocks | 1<<40,
+			wantNames:    []string{"full_history", "compact_blocks"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &Peer{}
+			n.handleVersion(peer, &tt.version)
+			if got := peer.ProtocolVersion(); got != tt.wantVersion {
+				t.Errorf("version = %d, want %d", got, tt.wantVersion)
+			}
+			if got := peer.Services(); got != tt.wantServices {
+				t.Errorf("services = %b, want %b", got, tt.wantServices)
+			}
+			if got := peer.Services().Names(); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestBlockSource(t *testing.T) {
+	n := &Network{peers: make(map[string]*Peer)}
+	pruned := &Peer{Address: "pruned", services: uint64(ServiceCFilters)}
+	n.peers[pruned.Address] = pruned
+	if got := n.blockSource(pruned); got != pruned {
+		t.Errorf("with no full peer, source = %s", got.Address)
+	}
+
+	full := &Peer{Address: "full", services: uint64(ServiceFullHistory)}
+	pinned := &Peer{Address: "pinned", Pinned: true, services: uint64(ServiceFullHistory | ServiceCompactBlocks)}
+	n.peers[full.Address] = full
+	n.peers[pinned.Address] = pinned
+	if got := n.blockSource(pruned); got != pinned {
+		t.Errorf("source = %s, want the pinned full peer", got.Address)
+	}
+	if got := n.blockSource(full); got != full {
+		t.Errorf("full peer's source = %s", got.Address)
+	}
+	if got := n.PeersWithService(ServiceCompactBlocks); len(got) != 1 || got[0] != pinned {
+		t.Errorf("compact block peers = %v", got)
+	}
+}
@@ -0,0 +1,223 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// MaxSignatureSize is the size of the largest DER encoded input signature:
+// a sequence of two 33-byte integers
+const MaxSignatureSize = 72
+
+// Signer signs transaction signature hashes with a key it may keep
+// elsewhere, such as on a hardware wallet
+type Signer interface {
+	// PublicKey returns the public key of the signing key
+	PublicKey() *ecdsa.PublicKey
+	// SignHash returns the canonical DER signature of a signature hash
+	SignHash(hash [32]byte) ([]byte, error)
+}
+
+// KeySigner is a Signer holding its P-256 private key in memory
+type KeySigner struct {
+	Key *ecdsa.PrivateKey
+}
+
+// PublicKey implements Signer
+func (s KeySigner) PublicKey() *ecdsa.PublicKey {
+	return &s.Key.PublicKey
+}
+
+// SignHash implements Signer
+func (s KeySigner) SignHash(hash [32]byte) ([]byte, error) {
+	if s.Key.Curve != elliptic.P256() {
+		return nil, errors.New("signing key is not a P-256 key")
+	}
+	r, sig, _ := signHash(s.Key, hash)
+	return encodeSignature(r, sig), nil
+}
+
+// curveOrder is the order of the P-256 group; halfOrder is half of it, the
+// largest s of a low-S signature
+var (
+	curveOrder = elliptic.P256().Params().N
+	halfOrder  = new(big.Int).Rsh(curveOrder, 1)
+)
+
+// signHash signs a 32-byte hash with a nonce derived from the key and hash
+// as RFC 6979 describes, so no randomness is needed and the same message
+// is never signed with two nonces. s is normalized to the lower half of
+// the curve order, making the signature the only valid one for this nonce.
+// recID tells which point the nonce was, for recoverPublicKey: bit 0 is
+// the parity of its y, bit 1 is set if its x is r plus the curve order.
+func signHash(key *ecdsa.PrivateKey, hash [32]byte) (r, s *big.Int, recID byte) {
+	e := new(big.Int).SetBytes(hash[:])
+	nonces := newRFC6979(key.D, hash)
+	for {
+		k := nonces.next()
+		x, y := key.Curve.ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+		r = new(big.Int).Mod(x, curveOrder)
+		if r.Sign() == 0 {
+			continue
+		}
+		recID = byte(y.Bit(0))
+		if x.Cmp(curveOrder) >= 0 {
+			recID |= 2
+		}
+		s = new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, curveOrder))
+		s.Mod(s, curveOrder)
+		if s.Sign() == 0 {
+			continue
+		}
+		// Negating s is signing with the nonce's negation, whose y has
+		// the other parity
+		if s.Cmp(halfOrder) > 0 {
+			s.Sub(curveOrder, s)
+			recID ^= 1
+		}
+		return r, s, recID
+	}
+}
+
+// rfc6979 generates the nonce candidates of RFC 6979 section 3.2 for
+// P-256 and SHA-256
+type rfc6979 struct {
+	k, v  []byte
+	first bool
+}
+
+func newRFC6979(d *big.Int, hash [32]byte) *rfc6979 {
+	// bits2octets of the hash is its value reduced modulo the order
+	h := new(big.Int).SetBytes(hash[:])
+	h.Mod(h, curveOrder)
+	seed := append(d.FillBytes(make([]byte, 32)), h.FillBytes(make([]byte, 32))...)
+
+	g := &rfc6979{k: make([]byte, 32), v: make([]byte, 32), first: true}
+	for i := range g.v {
+		g.v[i] = 1
+	}
+	g.k = g.mac(g.k, g.v, []byte{0}, seed)
+	g.v = g.mac(g.k, g.v)
+	g.k = g.mac(g.k, g.v, []byte{1}, seed)
+	g.v = g.mac(g.k, g.v)
+	return g
+}
+
+// mac returns HMAC-SHA256 of the concatenated data under key
+func (g *rfc6979) mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// next returns the next nonce candidate within [1, order-1]
+func (g *rfc6979) next() *big.Int {
+	for {
+		if !g.first {
+			g.k = g.mac(g.k, g.v, []byte{0})
+			g.v = g.mac(g.k, g.v)
+		}
+		g.first = false
+		g.v = g.mac(g.k, g.v)
+		k := new(big.Int).SetBytes(g.v)
+		if k.Sign() > 0 && k.Cmp(curveOrder) < 0 {
+			return k
+		}
+	}
+}
+
+// encodeSignature returns the canonical DER encoding of a signature
+func encodeSignature(r, s *big.Int) []byte {
+	rb, sb := derInteger(r), derInteger(s)
+	sig := make([]byte, 0, 6+len(rb)+len(sb))
+	sig = append(sig, 0x30, byte(4+len(rb)+len(sb)))
+	sig = append(sig, 0x02, byte(len(rb)))
+	sig = append(sig, rb...)
+	sig = append(sig, 0x02, byte(len(sb)))
+	return append(sig, sb...)
+}
+
+// derInteger returns the minimal big-endian encoding of a positive DER
+// integer, with a zero byte ahead of a set high bit
+func derInteger(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+// parseSignature decodes a signature, accepting only the canonical DER
+// encoding with a low s. Any other encoding of the same signature is
+// rejected, so a relayed transaction's hash can't be changed without its
+// signer.
+func parseSignature(sig []byte) (r, s *big.Int, err error) {
+	if len(sig) < 8 || len(sig) > MaxSignatureSize {
+		return nil, nil, errors.New("signature has an invalid length")
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-2 {
+		return nil, nil, errors.New("signature is not a DER sequence")
+	}
+	r, rest, err := parseDERInteger(sig[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	s, rest, err = parseDERInteger(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, errors.New("signature has trailing bytes")
+	}
+	if r.Cmp(curveOrder) >= 0 || s.Cmp(curveOrder) >= 0 {
+		return nil, nil, errors.New("signature value out of range")
+	}
+	if s.Cmp(halfOrder) > 0 {
+		return nil, nil, errors.New("signature s is not low")
+	}
+	return r, s, nil
+}
+
+// parseDERInteger decodes a minimally encoded positive DER integer at the
+// start of b, returning it and the bytes after it
+func parseDERInteger(b []byte) (*big.Int, []byte, error) {
+	if len(b) < 2 || b[0] != 0x02 {
+		return nil, nil, errors.New("signature value is not a DER integer")
+	}
+	size := int(b[1])
+	if size == 0 || len(b) < 2+size {
+		return nil, nil, errors.New("signature value has an invalid length")
+	}
+	value := b[2 : 2+size]
+	if value[0]&0x80 != 0 {
+		return nil, nil, errors.New("signature value is negative")
+	}
+	if size > 1 && value[0] == 0 && value[1]&0x80 == 0 {
+		return nil, nil, errors.New("signature value has excess padding")
+	}
+	n := new(big.Int).SetBytes(value)
+	if n.Sign() == 0 {
+		return nil, nil, errors.New("signature value is zero")
+	}
+	return n, b[2+size:], nil
+}
+
+// verifySignature checks a canonical signature of hash by key
+func verifySignature(key *ecdsa.PublicKey, hash [32]byte, sig []byte) error {
+	r, s, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.Verify(key, hash[:], r, s) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %q", s)
+	}
+	return n
+}
+
+func TestSignHashRFC6979(t *testing.T) {
+	// RFC 6979 A.2.5, P-256 with SHA-256, message "sample"
+	key := new(ecdsa.PrivateKey)
+	key.Curve = elliptic.P256()
+	key.D = hexInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+	key.X, key.Y = key.Curve.ScalarBaseMult(key.D.Bytes())
+
+	r, s, _ := signHash(key, sha256.Sum256([]byte("sample")))
+	wantR := hexInt(t, "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716")
+	wantS := hexInt(t, "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8")
+	// The vector's s is high, so it is normalized
+	wantS.Sub(curveOrder, wantS)
+	if r.Cmp(wantR) != 0 || s.Cmp(wantS) != 0 {
+		t.Errorf("signature = (%X, %X), want (%X, %X)", r, s, wantR, wantS)
+	}
+}
+
+func TestSignatureEncoding(t *testing.T) {
+	key, script := newTestKey(t)
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: Hash{1}, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 1000, Script: []byte("payee")}},
+	)
+	if err := tx.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	sig := tx.Inputs[0].Script
+	again := tx.Clone()
+	if err := again.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if string(again.Inputs[0].Script) != string(sig) {
+		t.Error("signing twice gave different signatures")
+	}
+	if len(sig) > MaxSignatureSize || !tx.Verify(&key.PublicKey) {
+		t.Fatalf("signature %x does not verify", sig)
+	}
+	if err := checkInputSignature(tx.SignatureHash(), sig, script); err != nil {
+		t.Fatalf("signature rejected: %v", err)
+	}
+
+	r, s, err := parseSignature(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	highS := encodeSignature(r, new(big.Int).Sub(curveOrder, s))
+	padded := append([]byte{0x30, sig[1] + 1, 0x02, sig[3] + 1, 0}, sig[4:]...)
+	tests := []struct {
+		name string
+		sig  []byte
+	}{
+		{"high s", highS},
+		{"padded r", padded},
+		{"trailing byte", append(append([]byte{}, sig...), 0)},
+		{"wrong length", append([]byte{0x30, sig[1] - 1}, sig[2:]...)},
+		{"raw r and s", append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		if err := checkInputSignature(tx.SignatureHash(), tt.sig, script); err == nil {
+			t.Errorf("%s signature accepted", tt.name)
+		}
+	}
+}
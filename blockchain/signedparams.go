@@ -0,0 +1,196 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SignedChainParams is the distributable form of a chain parameters file:
+// the parameters as JSON plus an ECDSA P-256 signature over them
+type SignedChainParams struct {
+	Params    json.RawMessage `json:"params"`
+	PublicKey string          `json:"public_key"`
+	Signature string          `json:"signature"`
+}
+
+// checkpointJSON is the wire form of a checkpoint with a hex hash
+type checkpointJSON struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// MarshalJSON encodes the checkpoint hash as hex
+func (c Checkpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(checkpointJSON{Height: c.Height, Hash: hex.EncodeToString(c.Hash[:])})
+}
+
+// UnmarshalJSON decodes a checkpoint with a hex hash
+func (c *Checkpoint) UnmarshalJSON(data []byte) error {
+	var v checkpointJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	hash, err := hex.DecodeString(v.Hash)
+	if err != nil || len(hash) != 32 {
+		return fmt.Errorf("invalid checkpoint hash at height %d", v.Height)
+	}
+
+	c.Height = v.Height
+	copy(c.Hash[:], hash)
+	return nil
+}
+
+// paramsDigest hashes the compact form of the parameters JSON, so the
+// signature survives the file being re-indented
+func paramsDigest(data []byte) ([32]byte, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(compact.Bytes()), nil
+}
+
+// ExportSignedParams serializes and signs chain parameters
+func ExportSignedParams(params *ChainParams, key *ecdsa.PrivateKey) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := paramsDigest(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(SignedChainParams{
+		Params:    data,
+		PublicKey: hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)),
+		Signature: hex.EncodeToString(sig),
+	}, "", "  ")
+}
+
+// LoadSignedParams verifies a signed chain parameters file and returns the
+// parameters. The file must be signed by one of the trusted public keys,
+// given as hex-encoded uncompressed P-256 points.
+func LoadSignedParams(data []byte, trustedKeys []string) (*ChainParams, error) {
+	var signed SignedChainParams
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("malformed chain parameters file: %v", err)
+	}
+
+	trusted := false
+	for _, key := range trustedKeys {
+		if key == signed.PublicKey {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return nil, errors.New("chain parameters signed by an untrusted key")
+	}
+
+	pubBytes, err := hex.DecodeString(signed.PublicKey)
+	if err != nil {
+		return nil, errors.New("invalid public key encoding")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubBytes)
+	if x == nil {
+		return nil, errors.New("invalid public key")
+	}
+
+	sig, err := hex.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+
+	digest, err := paramsDigest(signed.Params)
+	if err != nil {
+		return nil, fmt.Errorf("malformed chain parameters: %v", err)
+	}
+	if !ecdsa.VerifyASN1(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], sig) {
+		return nil, errors.New("chain parameters signature verification failed")
+	}
+
+	var params ChainParams
+	if err := json.Unmarshal(signed.Params, &params); err != nil {
+		return nil, fmt.Errorf("malformed chain parameters: %v", err)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &params, nil
+}
+
+// Validate checks chain parameters for internal consistency
+func (p *ChainParams) Validate() error {
+	if p.Name == "" {
+		return errors.New("chain parameters have no network name")
+	}
+	if p.MinimumChainWork == nil || p.MinimumChainWork.Sign() < 0 {
+		return errors.New("invalid minimum chain work")
+	}
+	if p.MaxHeadersPerMsg <= 0 || p.MaxHeadersPerMinute < p.MaxHeadersPerMsg {
+		return errors.New("invalid header sync limits")
+	}
+	if p.DefaultPort <= 0 || p.DefaultPort > 65535 {
+		return fmt.Errorf("invalid default port %d", p.DefaultPort)
+	}
+
+	minDiff := p.Consensus.MinimumDifficulty
+	if minDiff == nil || minDiff.Sign() <= 0 {
+		return errors.New("invalid minimum difficulty")
+	}
+	if initial := p.Consensus.InitialDifficulty; initial != nil && initial.Cmp(minDiff) < 0 {
+		return errors.New("initial difficulty below minimum difficulty")
+	}
+
+	if p.InitialSubsidy < 0 || p.InitialSubsidy > p.MaxSupply {
+		return fmt.Errorf("invalid initial subsidy %v", p.InitialSubsidy)
+	}
+	if p.HalvingInterval <= 0 {
+		return fmt.Errorf("invalid halving interval %d", p.HalvingInterval)
+	}
+	if p.MaxSupply <= 0 || p.MaxSupply > MaxAmount {
+		return fmt.Errorf("invalid maximum supply %v", p.MaxSupply)
+	}
+	if p.MaxBlockSize < 0 || (p.MaxBlockSize != 0 && p.MaxBlockSize <= headerSize) {
+		return fmt.Errorf("invalid maximum block size %d", p.MaxBlockSize)
+	}
+	if p.Treasury != nil {
+		if err := p.Treasury.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, seed := range p.Seeds {
+		if _, err := NormalizeAddress(seed, p.DefaultPort); err != nil || seed == "" {
+			return fmt.Errorf("invalid seed %q", seed)
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, cp := range p.Checkpoints {
+		if cp.Height <= 0 || seen[cp.Height] {
+			return fmt.Errorf("invalid or duplicate checkpoint at height %d", cp.Height)
+		}
+		seen[cp.Height] = true
+	}
+	return nil
+}
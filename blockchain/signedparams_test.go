@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func testSigningKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+}
+
+func testParams() *ChainParams {
+	return &ChainParams{
+		Name:        "testnet",
+		DefaultPort: 19000,
+		Checkpoints: []Checkpoint{
+			{Height: 10, Hash: [32]byte{1, 2, 3}},
+		},
+		MinimumChainWork:    big.NewInt(1000),
+		MaxHeadersPerMsg:    2000,
+		MaxHeadersPerMinute: 20000,
+		Consensus:           DefaultConsensusParams,
+		InitialSubsidy:      Coin,
+		HalvingInterval:     1000,
+		MaxSupply:           MaxAmount,
+	}
+}
+
+func TestSignedParamsRoundTrip(t *testing.T) {
+	key, pub := testSigningKey(t)
+
+	data, err := ExportSignedParams(testParams(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := LoadSignedParams(data, []string{pub})
+	if err != nil {
+		t.Fatalf("LoadSignedParams: %v", err)
+	}
+	if params.Name != "testnet" || params.DefaultPort != 19000 {
+		t.Errorf("loaded params = %+v", params)
+	}
+	if cp := params.CheckpointAt(10); cp == nil || cp.Hash != ([32]byte{1, 2, 3}) {
+		t.Errorf("checkpoint not preserved: %+v", params.Checkpoints)
+	}
+}
+
+func TestLoadSignedParamsRejectsTampering(t *testing.T) {
+	key, pub := testSigningKey(t)
+	otherKey, otherPub := testSigningKey(t)
+
+	data, err := ExportSignedParams(testParams(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(f func(*SignedChainParams)) []byte {
+		var signed SignedChainParams
+		if err := json.Unmarshal(data, &signed); err != nil {
+			t.Fatal(err)
+		}
+		f(&signed)
+		out, err := json.Marshal(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	otherSigned, err := ExportSignedParams(testParams(), otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		trusted []string
+	}{
+		{"untrusted signer", data, []string{otherPub}},
+		{"no trusted keys", data, nil},
+		{"signed by other trusted key but key swapped", tamper(func(s *SignedChainParams) { s.PublicKey = otherPub }), []string{pub, otherPub}},
+		{"modified params", tamper(func(s *SignedChainParams) {
+			s.Params = json.RawMessage(`{"name":"evilnet"}`)
+		}), []string{pub}},
+		{"signature from other key", tamper(func(s *SignedChainParams) {
+			var other SignedChainParams
+			if err := json.Unmarshal(otherSigned, &other); err != nil {
+				t.Fatal(err)
+			}
+			s.Signature = other.Signature
+		}), []string{pub}},
+		{"malformed signature", tamper(func(s *SignedChainParams) { s.Signature = "zz" }), []string{pub}},
+		{"malformed file", []byte("{"), []string{pub}},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadSignedParams(test.data, test.trusted); err == nil {
+			t.Errorf("%s: LoadSignedParams succeeded", test.name)
+		}
+	}
+}
+
+func TestChainParamsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ChainParams)
+		valid  bool
+	}{
+		{"valid", func(p *ChainParams) {}, true},
+		{"no name", func(p *ChainParams) { p.Name = "" }, false},
+		{"negative chain work", func(p *ChainParams) { p.MinimumChainWork = big.NewInt(-1) }, false},
+		{"no header limit", func(p *ChainParams) { p.MaxHeadersPerMsg = 0 }, false},
+		{"no halving interval", func(p *ChainParams) { p.HalvingInterval = 0 }, false},
+		{"negative subsidy", func(p *ChainParams) { p.InitialSubsidy = -1 }, false},
+		{"supply beyond amount range", func(p *ChainParams) { p.MaxSupply = MaxAmount + 1 }, false},
+		{"subsidy above supply", func(p *ChainParams) { p.MaxSupply = p.InitialSubsidy - 1 }, false},
+		{"seeds", func(p *ChainParams) { p.Seeds = []string{"seed.example.org", "[2001:db8::1]:9000"} }, true},
+		{"invalid seed", func(p *ChainParams) { p.Seeds = []string{"seed.example.org:port"} }, false},
+		{"duplicate checkpoint", func(p *ChainParams) {
+			p.Checkpoints = append(p.Checkpoints, Checkpoint{Height: 10})
+		}, false},
+	}
+
+	for _, test := range tests {
+		params := testParams()
+		test.modify(params)
+		if err := params.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package blockchain
+
+// chainStatus is an immutable snapshot of the chain tip and mempool. It is
+// replaced as a whole whenever either changes, so readers get a consistent
+// view without taking bc.mu.
+type chainStatus struct {
+	height      int
+	tipHash     [32]byte
+	mempoolSize int
+}
+
+// publishStatus records the current tip and mempool size for the lock-free
+// accessors; the caller must hold bc.mu for writing
+func (bc *Blockchain) publishStatus() {
+	status := &chainStatus{
+		height:      len(bc.blocks) - 1,
+		mempoolSize: len(bc.mempool),
+	}
+	if len(bc.blocks) > 0 {
+		status.tipHash = bc.blocks[len(bc.blocks)-1].Hash
+	}
+	bc.status.Store(status)
+}
+
+// Height returns the height of the chain tip. Unlike the accessors that
+// return blocks it never waits for a block being connected.
+func (bc *Blockchain) Height() int {
+	return bc.status.Load().height
+}
+
+// TipHash returns the hash of the chain tip without taking the chain lock
+func (bc *Blockchain) TipHash() [32]byte {
+	return bc.status.Load().tipHash
+}
+
+// MempoolSize returns the number of mempool transactions without taking
+// the chain lock
+func (bc *Blockchain) MempoolSize() int {
+	return bc.status.Load().mempoolSize
+}
@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestStatusSnapshot(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	if bc.Height() != 0 || bc.TipHash() != genesis.Hash || bc.MempoolSize() != 0 {
+		t.Fatalf("new chain status = %d %x %d", bc.Height(), bc.TipHash(), bc.MempoolSize())
+	}
+
+	a1 := mineTestBlock(bc, genesis, "a1")
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+	if bc.Height() != 1 || bc.TipHash() != a1.Hash {
+		t.Errorf("after connect status = %d %x", bc.Height(), bc.TipHash())
+	}
+
+	// A reorganization onto a longer branch moves the snapshot too
+	b1 := mineTestBlock(bc, genesis, "b1")
+	b2 := mineTestBlock(bc, b1, "b2")
+	for _, b := range []*Block{b1, b2} {
+		if err := bc.ProcessBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bc.Height() != 2 || bc.TipHash() != b2.Hash {
+		t.Errorf("after reorg status = %d %x", bc.Height(), bc.TipHash())
+	}
+	if bc.Height() != bc.GetHeight() {
+		t.Errorf("Height() = %d, GetHeight() = %d", bc.Height(), bc.GetHeight())
+	}
+}
@@ -0,0 +1,54 @@
+package blockchain
+
+// maxHalvings is the number of halvings after which any subsidy has
+// shifted down to nothing
+const maxHalvings = 63
+
+// BlockSubsidy returns the subsidy of the block at height. The genesis
+// block has none; after that the subsidy starts at InitialSubsidy, halves
+// every HalvingInterval blocks and stops once MaxSupply has been issued.
+func (p *ChainParams) BlockSubsidy(height int) Amount {
+	if height <= 0 {
+		return 0
+	}
+	subsidy := p.eraSubsidy(height)
+	if remaining := p.MaxSupply - p.IssuedSupply(height); subsidy > remaining {
+		subsidy = remaining
+	}
+	if subsidy < 0 {
+		return 0
+	}
+	return subsidy
+}
+
+// IssuedSupply returns the total subsidy of the blocks below height,
+// capped at MaxSupply
+func (p *ChainParams) IssuedSupply(height int) Amount {
+	var issued Amount
+	for start := 1; start < height; {
+		end := (start/p.HalvingInterval + 1) * p.HalvingInterval
+		if end > height {
+			end = height
+		}
+		subsidy := p.eraSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+		// Stop before the product can overflow
+		if blocks := Amount(end - start); subsidy > (p.MaxSupply-issued)/blocks {
+			return p.MaxSupply
+		}
+		issued += subsidy * Amount(end-start)
+		start = end
+	}
+	return issued
+}
+
+// eraSubsidy returns the uncapped subsidy of the halving era of height
+func (p *ChainParams) eraSubsidy(height int) Amount {
+	halvings := height / p.HalvingInterval
+	if halvings >= maxHalvings {
+		return 0
+	}
+	return p.InitialSubsidy >> uint(halvings)
+}
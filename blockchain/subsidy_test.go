@@ -0,0 +1,52 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestBlockSubsidy(t *testing.T) {
+	params := &ChainParams{InitialSubsidy: 100, HalvingInterval: 10, MaxSupply: 2500}
+
+	tests := []struct {
+		height  int
+		subsidy Amount
+		issued  Amount
+	}{
+		{0, 0, 0},
+		{1, 100, 0},
+		{9, 100, 800},
+		{10, 50, 900},
+		{20, 25, 1400},
+		{30, 12, 1650},
+		{69, 1, 1869},
+		{70, 0, 1870},
+		{1000, 0, 1870},
+	}
+	for _, test := range tests {
+		if got := params.BlockSubsidy(test.height); got != test.subsidy {
+			t.Errorf("BlockSubsidy(%d) = %d, want %d", test.height, got, test.subsidy)
+		}
+		if got := params.IssuedSupply(test.height); got != test.issued {
+			t.Errorf("IssuedSupply(%d) = %d, want %d", test.height, got, test.issued)
+		}
+	}
+}
+
+func TestBlockSubsidyMaxSupply(t *testing.T) {
+	params := &ChainParams{InitialSubsidy: 100, HalvingInterval: 10, MaxSupply: 450}
+
+	// Four full blocks, then the remaining 50, then nothing
+	for height, want := range []Amount{0, 100, 100, 100, 100, 50, 0, 0} {
+		if got := params.BlockSubsidy(height); got != want {
+			t.Errorf("BlockSubsidy(%d) = %d, want %d", height, got, want)
+		}
+	}
+	if got := params.IssuedSupply(1000); got != params.MaxSupply {
+		t.Errorf("IssuedSupply(1000) = %d, want %d", got, params.MaxSupply)
+	}
+
+	// Main network emission stays within its supply
+	if got := MainNetParams.IssuedSupply(100 * MainNetParams.HalvingInterval); got > MainNetParams.MaxSupply {
+		t.Errorf("main network issues %v, above %v", got, MainNetParams.MaxSupply)
+	}
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import "sort"
+
+// templateTx is a mempool transaction considered for a block template
+type templateTx struct {
+	tx   *Transaction
+	fee  uint64
+	size int
+	rate Amount // Fee per 1000 bytes
+}
+
+// prioritizeTransactions returns the candidates whose inputs are available
+// on top of the utxos, directly or from other candidates, highest fee rate
+// first. Equal rates keep arrival order.
+func prioritizeTransactions(candidates []*Transaction, utxos utxoSource) []*templateTx {
+	created := make(map[outpoint]TxOutput)
+	for _, tx := range candidates {
+		for j, output := range tx.Outputs {
+			created[outpoint{tx.Hash, uint32(j)}] = output
+		}
+	}
+	prevOutput := func(op outpoint) (TxOutput, bool) {
+		if out, ok := created[op]; ok {
+			return out, true
+		}
+		utxo, ok := utxos.get(op)
+		if !ok {
+			return TxOutput{}, false
+		}
+		return utxo.Output, true
+	}
+
+	var prioritized []*templateTx
+	for _, tx := range candidates {
+		if tx.IsCoinbase() {
+			continue
+		}
+		fee, err := checkTxInputs(tx, prevOutput, true)
+		if err != nil {
+			continue
+		}
+		size := len(tx.Encode())
+		prioritized = append(prioritized, &templateTx{
+			tx:   tx,
+			fee:  fee,
+			size: size,
+			rate: Amount(fee).MulDiv(1000, int64(size)),
+		})
+	}
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		return prioritized[i].rate > prioritized[j].rate
+	})
+	return prioritized
+}
+
+// selectTransactions picks the transactions of a block template from the
+// candidates, highest fee rate first, in at most maxSize bytes. A
+// transaction spending the output of another candidate waits until that
+// one is in the block, so parents always come before their children; a
+// low-fee parent doesn't get a high-fee child in sooner. It returns the
+// transactions in block order with their total fee.
+func selectTransactions(candidates []*Transaction, utxos utxoSource, maxSize int) ([]*Transaction, uint64) {
+	pending := prioritizeTransactions(candidates, utxos)
+	spends := newBlockSpends(utxos)
+	var selected []*Transaction
+	var fees uint64
+	size := 0
+	// Each pass adds whatever fits now; another pass is only needed if it
+	// added a transaction whose children were passed over
+	for added := true; added; {
+		added = false
+		remaining := pending[:0]
+		for _, candidate := range pending {
+			if size+candidate.size > maxSize {
+				continue
+			}
+			fee, err := checkTxInputs(candidate.tx, spends.prevOutput, true)
+			if err != nil {
+				remaining = append(remaining, candidate)
+				continue
+			}
+			spends.apply(candidate.tx)
+			selected = append(selected, candidate.tx)
+			fees += fee
+			size += candidate.size
+			added = true
+		}
+		pending = remaining
+	}
+	return selected, fees
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// LockTimeThreshold splits lock times, as in Bitcoin: below it a lock
+// time is a block height, from it on a unix time
+const LockTimeThreshold = 500000000
+
+// finalSequence is the input sequence number that leaves a transaction's
+// lock time unenforced
+const finalSequence = 0xFFFFFFFF
+
+// timeLockScriptMarker starts an output script that can't be spent until
+// a lock time: the marker, the lock time as 4 little-endian bytes, then
+// the script of the output once unlocked
+const timeLockScriptMarker = 0xb1
+
+// timeLockScriptHeader is the size of a time-locked script before the
+// script it wraps
+const timeLockScriptHeader = 5
+
+// NewTimeLockScript returns an output script paying script, spendable
+// only by a transaction whose lock time has reached lockTime. Outputs
+// locked to height h can be spent from block h+1, those locked to a time
+// from the first block after it.
+func NewTimeLockScript(lockTime uint32, script []byte) []byte {
+	locked := make([]byte, timeLockScriptHeader, timeLockScriptHeader+len(script))
+	locked[0] = timeLockScriptMarker
+	binary.LittleEndian.PutUint32(locked[1:], lockTime)
+	return append(locked, script...)
+}
+
+// ParseTimeLockScript returns the lock time and wrapped script of a
+// time-locked output script, with ok false if the script isn't locked
+func ParseTimeLockScript(script []byte) (lockTime uint32, inner []byte, ok bool) {
+	if len(script) <= timeLockScriptHeader || script[0] != timeLockScriptMarker {
+		return 0, nil, false
+	}
+	return binary.LittleEndian.Uint32(script[1:]), script[timeLockScriptHeader:], true
+}
+
+// lockTimeReached reports whether a lock time has passed for a block at
+// height with time blockTime
+func lockTimeReached(lockTime uint32, height int, blockTime int64) bool {
+	if lockTime < LockTimeThreshold {
+		return int64(lockTime) < int64(height)
+	}
+	return int64(lockTime) < blockTime
+}
+
+// IsFinal reports whether a transaction can be included in a block at
+// height with time blockTime: it has no lock time, its lock time has
+// passed, or every input opts out of it with the final sequence number
+func (tx *Transaction) IsFinal(height int, blockTime int64) bool {
+	if tx.LockTime == 0 || lockTimeReached(tx.LockTime, height, blockTime) {
+		return true
+	}
+	for _, input := range tx.Inputs {
+		if input.Sequence != finalSequence {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTimeLock checks that an input may spend an output locked until
+// lockTime: the transaction's lock time must be of the same kind, height
+// or time, and at least lockTime, and the input must not opt out of it.
+// IsFinal then keeps the transaction out of blocks until the lock passes.
+func checkTimeLock(tx *Transaction, input TxInput, lockTime uint32) error {
+	if input.Sequence == finalSequence {
+		return errors.New("spends a time-locked output with a final sequence number")
+	}
+	if (tx.LockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return errors.New("lock time is not of the kind the output is locked with")
+	}
+	if tx.LockTime < lockTime {
+		return fmt.Errorf("lock time %d is before the output's %d", tx.LockTime, lockTime)
+	}
+	return nil
+}
+
+// LockedOutput is an unspent time-locked output
+type LockedOutput struct {
+	UTXO
+	LockTime uint32 `json:"lock_time"`
+	Locked   bool   `json:"locked"` // Not yet spendable in the next block
+}
+
+// Balances splits the value paid to a script between what can be spent in
+// the next block and what is still time-locked
+type Balances struct {
+	Spendable uint64         `json:"spendable"`
+	Locked    uint64         `json:"locked"`
+	Outputs   []LockedOutput `json:"time_locked_outputs"` // Oldest first
+}
+
+// GetBalances returns the balances of the unspent main chain outputs
+// paying script, directly or once a time lock passes
+func (bc *Blockchain) GetBalances(script []byte) Balances {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var balances Balances
+	for _, utxo := range bc.utxos.forScript(script) {
+		balances.Spendable += utxo.Output.Value
+	}
+
+	height := len(bc.blocks)
+	now := bc.timeSource.AdjustedTime().Unix()
+	var locked []*UTXO
+	for s := range bc.utxos.byScript {
+		if _, inner, ok := ParseTimeLockScript([]byte(s)); ok && string(inner) == string(script) {
+			locked = append(locked, bc.utxos.forScript([]byte(s))...)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool {
+		a, b := locked[i], locked[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.TxHash != b.TxHash {
+			return string(a.TxHash[:]) < string(b.TxHash[:])
+		}
+		return a.Index < b.Index
+	})
+	balances.Outputs = make([]LockedOutput, 0, len(locked))
+	for _, utxo := range locked {
+		lockTime, _, _ := ParseTimeLockScript(utxo.Output.Script)
+		output := LockedOutput{UTXO: *utxo, LockTime: lockTime, Locked: !lockTimeReached(lockTime, height, now)}
+		if output.Locked {
+			balances.Locked += utxo.Output.Value
+		} else {
+			balances.Spendable += utxo.Output.Value
+		}
+		balances.Outputs = append(balances.Outputs, output)
+	}
+	return balances
+}
@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsFinal(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockTime uint32
+		sequence uint32
+		want     bool
+	}{
+		{"no lock time", 0, 0, true},
+		{"height reached", 9, 0, true},
+		{"height not reached", 10, 0, false},
+		{"time reached", 1700000000, 0, true},
+		{"time not reached", 1700000001, 0, false},
+		{"final sequence", 10, finalSequence, true},
+	}
+	for _, tt := range tests {
+		tx := NewTransaction([]TxInput{{Sequence: tt.sequence}}, nil)
+		tx.LockTime = tt.lockTime
+		if got := tx.IsFinal(10, 1700000001); got != tt.want {
+			t.Errorf("%s: IsFinal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeLockScript(t *testing.T) {
+	script := NewTimeLockScript(1234, []byte("alice"))
+	lockTime, inner, ok := ParseTimeLockScript(script)
+	if !ok || lockTime != 1234 || !bytes.Equal(inner, []byte("alice")) {
+		t.Errorf("ParseTimeLockScript = %d, %q, %v", lockTime, inner, ok)
+	}
+	if _, _, ok := ParseTimeLockScript([]byte("alice")); ok {
+		t.Error("plain script parsed as time-locked")
+	}
+	if _, _, ok := ParseTimeLockScript(NewTimeLockScript(1234, nil)); ok {
+		t.Error("time lock wrapping no script parsed")
+	}
+}
+
+func TestTimeLockedOutput(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	key, script := newTestKey(t)
+	other, _ := newTestKey(t)
+	funding, err := bc.GenerateBlock(script, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+	value := coinbase.Outputs[0].Value - 10000
+
+	// Locked until height 4, so spendable from block 5
+	vesting := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: finalSequence}},
+		[]TxOutput{{Value: value, Script: NewTimeLockScript(4, script)}},
+	)
+	if err := vesting.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(vesting); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spend := func(lockTime, sequence uint32) *Transaction {
+		tx := NewTransaction(
+			[]TxInput{{PrevTxHash: vesting.Hash, Sequence: sequence}},
+			[]TxOutput{{Value: value - 10000, Script: []byte("payee")}},
+		)
+		tx.LockTime = lockTime
+		if err := tx.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	rejected := []struct {
+		name string
+		tx   *Transaction
+	}{
+		{"final sequence", spend(4, finalSequence)},
+		{"lock time too low", spend(3, 0)},
+		{"time lock time", spend(LockTimeThreshold+4, 0)},
+		{"not final", spend(4, 0)},
+	}
+	for _, tt := range rejected {
+		if err := bc.AddTransaction(tt.tx); err == nil {
+			t.Errorf("%s: spend accepted at height %d", tt.name, bc.GetHeight())
+		}
+	}
+
+	for height := 2; height <= 4; height++ {
+		balances := bc.GetBalances(script)
+		wantLocked := uint64(value)
+		if height == 4 {
+			wantLocked = 0
+		}
+		if balances.Locked != wantLocked || balances.Spendable != value-wantLocked || len(balances.Outputs) != 1 {
+			t.Errorf("height %d: balances = %+v, want %d locked", height, balances, wantLocked)
+		}
+		if height < 4 {
+			if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	wrongKey := spend(4, 0)
+	if err := wrongKey.Sign(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(wrongKey); err == nil {
+		t.Error("spend signed by another key accepted")
+	}
+	if err := bc.AddTransaction(spend(4, 0)); err != nil {
+		t.Fatalf("spend after the lock rejected: %v", err)
+	}
+	if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil || bc.MempoolSize() != 0 {
+		t.Errorf("spend not mined: err = %v, %d left", err, bc.MempoolSize())
+	}
+	if balances := bc.GetBalances(script); balances.Spendable != 0 || len(balances.Outputs) != 0 {
+		t.Errorf("balances after spending = %+v", balances)
+	}
+}
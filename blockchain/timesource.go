@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAllowedOffset is the largest peer clock offset that will be used
+	// when adjusting network time
+	maxAllowedOffset = 70 * time.Minute
+
+	// maxTimeSamples is the maximum number of peer samples retained
+	maxTimeSamples = 200
+
+	// minTimeSamples is the number of samples required before the median
+	// offset is applied
+	minTimeSamples = 5
+
+	// clockSkewWarning is the offset above which the local clock is
+	// considered wrong
+	clockSkewWarning = 5 * time.Minute
+)
+
+// TimeSource provides network-adjusted time derived from the clocks of
+// connected peers, reported in their version messages
+type TimeSource struct {
+	mu      sync.RWMutex
+	samples map[string]time.Duration // peer IP -> offset
+	order   []string
+	offset  time.Duration
+	warned  bool
+}
+
+// NewTimeSource creates a new time source with no offset
+func NewTimeSource() *TimeSource {
+	return &TimeSource{
+		samples: make(map[string]time.Duration),
+	}
+}
+
+// AddTimeSample records the clock of a peer host. Callers must identify
+// peers by IP, not ip:port, so that a host reconnecting from new ports
+// still contributes a single sample; only its first sample counts.
+func (ts *TimeSource) AddTimeSample(peer string, peerTime time.Time) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if _, exists := ts.samples[peer]; exists {
+		return
+	}
+
+	// Keep a bounded, rolling set of samples
+	if len(ts.order) >= maxTimeSamples {
+		delete(ts.samples, ts.order[0])
+		ts.order = ts.order[1:]
+	}
+
+	offset := time.Until(peerTime).Truncate(time.Second)
+	ts.samples[peer] = offset
+	ts.order = append(ts.order, peer)
+
+	if len(ts.samples) < minTimeSamples {
+		return
+	}
+
+	offsets := make([]time.Duration, 0, len(ts.samples))
+	for _, o := range ts.samples {
+		offsets = append(offsets, o)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+
+	// Reject outliers: a median this far off means either our clock or
+	// our peers are badly wrong, so don't adjust at all
+	if abs(median) > maxAllowedOffset {
+		ts.offset = 0
+		if !ts.warned {
+			// Only warn if no peer is close to our own time
+			agreeing := false
+			for _, o := range offsets {
+				if o != 0 && abs(o) < clockSkewWarning {
+					agreeing = true
+					break
+				}
+			}
+			if !agreeing {
+				ts.warned = true
+				log.Printf("WARNING: local clock differs from network time by %v; check your system time", median)
+			}
+		}
+		return
+	}
+
+	ts.offset = median
+	if abs(median) > clockSkewWarning {
+		log.Printf("WARNING: local clock skew of %v detected against %d peers", median, len(offsets))
+	}
+}
+
+// Offset returns the current offset applied to the local clock
+func (ts *TimeSource) Offset() time.Duration {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.offset
+}
+
+// AdjustedTime returns the local time corrected by the network offset
+func (ts *TimeSource) AdjustedTime() time.Time {
+	return time.Now().Add(ts.Offset())
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
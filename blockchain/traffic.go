@@ -0,0 +1,174 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+)
+
+// msgTypeOther counts received messages of unknown types, so a peer can't
+// grow the traffic counters with made-up types
+const msgTypeOther = "other"
+
+// knownMsgTypes are the message types counted by name
+var knownMsgTypes = map[string]bool{
+	MsgTypeBlock:       true,
+	MsgTypeTransaction: true,
+	MsgTypeGetBlocks:   true,
+	MsgTypeGetMempool:  true,
+	MsgTypePing:        true,
+	MsgTypeGetHeaders:  true,
+	MsgTypeHeaders:     true,
+	MsgTypeVersion:     true,
+	MsgTypeNewBlock:    true,
+	MsgTypeBlockAck:    true,
+}
+
+// msgTypeLabel returns the traffic counter label of a message type
+func msgTypeLabel(msgType string) string {
+	if knownMsgTypes[msgType] {
+		return msgType
+	}
+	return msgTypeOther
+}
+
+// TrafficStats are the bytes sent and received, in total and by message
+// type
+type TrafficStats struct {
+	BytesSent      uint64            `json:"bytessent"`
+	BytesRecv      uint64            `json:"bytesrecv"`
+	BytesSentByMsg map[string]uint64 `json:"bytessent_per_msg"`
+	BytesRecvByMsg map[string]uint64 `json:"bytesrecv_per_msg"`
+}
+
+// trafficCounter counts the bytes of messages by type
+type trafficCounter struct {
+	mu   sync.Mutex
+	sent map[string]uint64
+	recv map[string]uint64
+}
+
+// addSent counts n bytes sent in a message of msgType
+func (c *trafficCounter) addSent(msgType string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sent == nil {
+		c.sent = make(map[string]uint64)
+	}
+	c.sent[msgTypeLabel(msgType)] += uint64(n)
+}
+
+// addRecv counts n bytes received in a message of msgType
+func (c *trafficCounter) addRecv(msgType string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recv == nil {
+		c.recv = make(map[string]uint64)
+	}
+	c.recv[msgTypeLabel(msgType)] += uint64(n)
+}
+
+// stats returns a copy of the counts
+func (c *trafficCounter) stats() TrafficStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := TrafficStats{
+		BytesSentByMsg: make(map[string]uint64, len(c.sent)),
+		BytesRecvByMsg: make(map[string]uint64, len(c.recv)),
+	}
+	for t, n := range c.sent {
+		s.BytesSentByMsg[t] = n
+		s.BytesSent += n
+	}
+	for t, n := range c.recv {
+		s.BytesRecvByMsg[t] = n
+		s.BytesRecv += n
+	}
+	return s
+}
+
+// uploadTargetTimeframe is the cycle over which the upload target applies
+const uploadTargetTimeframe = 24 * time.Hour
+
+// historicalBlockAge is the age past which a block is historical, and no
+// longer served once the upload target is nearly reached
+const historicalBlockAge = 7 * 24 * time.Hour
+
+// uploadTargetReserve is the share of the upload target kept for recent
+// blocks: historical blocks stop being served once less than this is left
+const uploadTargetReserve = 0.1
+
+// UploadTarget reports the upload target and the current cycle's usage
+type UploadTarget struct {
+	Timeframe             int64  `json:"timeframe"` // Seconds
+	Target                uint64 `json:"target"`    // Bytes per timeframe, 0 for no target
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks bool   `json:"serve_historical_blocks"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"` // Seconds
+}
+
+// uploadBudget tracks bytes sent against an upload target over 24-hour
+// cycles
+type uploadBudget struct {
+	mu         sync.Mutex
+	target     uint64
+	cycleStart time.Time
+	cycleSent  uint64
+}
+
+// setTarget sets the target in bytes per cycle, 0 for none
+func (b *uploadBudget) setTarget(target uint64) {
+	b.mu.Lock()
+	b.target = target
+	b.mu.Unlock()
+}
+
+// add counts n bytes sent at now
+func (b *uploadBudget) add(n int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollCycle(now)
+	b.cycleSent += uint64(n)
+}
+
+// rollCycle starts a new cycle once the current one has passed; the caller
+// must hold b.mu
+func (b *uploadBudget) rollCycle(now time.Time) {
+	if now.Sub(b.cycleStart) >= uploadTargetTimeframe {
+		b.cycleStart = now
+		b.cycleSent = 0
+	}
+}
+
+// status reports the budget at now
+func (b *uploadBudget) status(now time.Time) UploadTarget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollCycle(now)
+
+	status := UploadTarget{
+		Timeframe:             int64(uploadTargetTimeframe / time.Second),
+		Target:                b.target,
+		ServeHistoricalBlocks: true,
+	}
+	if b.target == 0 {
+		return status
+	}
+	if b.cycleSent < b.target {
+		status.BytesLeftInCycle = b.target - b.cycleSent
+	}
+	status.TargetReached = status.BytesLeftInCycle == 0
+	status.ServeHistoricalBlocks = float64(status.BytesLeftInCycle) > float64(b.target)*uploadTargetReserve
+	status.TimeLeftInCycle = int64(b.cycleStart.Add(uploadTargetTimeframe).Sub(now) / time.Second)
+	return status
+}
+
+// serveBlock reports whether a block with the given timestamp may be
+// served at now: recent blocks always are, historical ones only while the
+// target is not nearly reached
+func (b *uploadBudget) serveBlock(timestamp int64, now time.Time) bool {
+	if now.Sub(time.Unix(timestamp, 0)) < historicalBlockAge {
+		return true
+	}
+	return b.status(now).ServeHistoricalBlocks
+}
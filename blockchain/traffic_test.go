@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrafficCounter(t *testing.T) {
+	var c trafficCounter
+	c.addSent(MsgTypeBlock, 100)
+	c.addSent(MsgTypeBlock, 50)
+	c.addSent(MsgTypeHeaders, 10)
+	c.addRecv(MsgTypeGetBlocks, 7)
+	c.addRecv("made-up", 3)
+	c.addRecv("also-made-up", 2)
+
+	s := c.stats()
+	if s.BytesSent != 160 || s.BytesRecv != 12 {
+		t.Errorf("totals = %d sent, %d received", s.BytesSent, s.BytesRecv)
+	}
+	if s.BytesSentByMsg[MsgTypeBlock] != 150 || s.BytesRecvByMsg[msgTypeOther] != 5 || len(s.BytesRecvByMsg) != 2 {
+		t.Errorf("by message = %v sent, %v received", s.BytesSentByMsg, s.BytesRecvByMsg)
+	}
+}
+
+func TestUploadBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	recent := now.Add(-time.Hour).Unix()
+	historical := now.Add(-30 * 24 * time.Hour).Unix()
+
+	var unlimited uploadBudget
+	unlimited.add(1<<30, now)
+	if s := unlimited.status(now); s.Target != 0 || s.TargetReached || !s.ServeHistoricalBlocks {
+		t.Errorf("no target: %+v", s)
+	}
+
+	var b uploadBudget
+	b.setTarget(1000)
+	b.add(850, now)
+	if s := b.status(now); s.BytesLeftInCycle != 150 || !s.ServeHistoricalBlocks || s.TimeLeftInCycle != 86400 {
+		t.Errorf("850 of 1000 sent: %+v", s)
+	}
+
+	// Within the reserve only recent blocks are served
+	b.add(100, now.Add(time.Minute))
+	if b.serveBlock(historical, now) || !b.serveBlock(recent, now) {
+		t.Error("historical blocks served within the reserve")
+	}
+	b.add(100, now.Add(time.Minute))
+	if s := b.status(now); !s.TargetReached || s.BytesLeftInCycle != 0 {
+		t.Errorf("past the target: %+v", s)
+	}
+
+	// A new cycle starts with the full budget
+	later := now.Add(uploadTargetTimeframe)
+	if s := b.status(later); s.TargetReached || s.BytesLeftInCycle != 1000 || !b.serveBlock(historical, later) {
+		t.Errorf("new cycle: %+v", s)
+	}
+}
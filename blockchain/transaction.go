@@ -5,7 +5,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/binary"
-	"math/big"
+	"errors"
+	"fmt"
+	"io"
 )
 
 // Transaction represents a transaction in the blockchain
@@ -14,12 +16,12 @@ type Transaction struct {
 	Inputs   []TxInput
 	Outputs  []TxOutput
 	LockTime uint32
-	Hash     [32]byte
+	Hash     Hash
 }
 
 // TxInput represents a transaction input
 type TxInput struct {
-	PrevTxHash  [32]byte
+	PrevTxHash  Hash
 	PrevTxIndex uint32
 	Script      []byte
 	Sequence    uint32
@@ -45,6 +47,11 @@ func NewTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
 
 // CalculateHash calculates the SHA-256 hash of the transaction
 func (tx *Transaction) CalculateHash() [32]byte {
+	return sha256.Sum256(tx.Encode())
+}
+
+// Encode returns the raw binary encoding of the transaction
+func (tx *Transaction) Encode() []byte {
 	buf := bytes.NewBuffer(nil)
 	
 	binary.Write(buf, binary.LittleEndian, tx.Version)
@@ -69,39 +76,139 @@ func (tx *Transaction) CalculateHash() [32]byte {
 	
 	binary.Write(buf, binary.LittleEndian, tx.LockTime)
 	
-	return sha256.Sum256(buf.Bytes())
+	return buf.Bytes()
 }
 
-// Sign signs the transaction with the given private key
-func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) error {
-	hash := tx.CalculateHash()
-	
+// maxRawScriptSize bounds script lengths accepted when decoding
+const maxRawScriptSize = 10000
+
+// DecodeTransaction parses a transaction from its raw binary encoding
+func DecodeTransaction(data []byte) (*Transaction, error) {
+	r := bytes.NewReader(data)
+	tx := &Transaction{}
+
+	readScript := func() ([]byte, error) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if n > maxRawScriptSize || int(n) > r.Len() {
+			return nil, errors.New("script length out of range")
+		}
+		script := make([]byte, n)
+		_, err := io.ReadFull(r, script)
+		return script, err
+	}
+	readCount := func(minSize int) (int, error) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return 0, err
+		}
+		if int(n) > r.Len()/minSize {
+			return 0, errors.New("item count out of range")
+		}
+		return int(n), nil
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &tx.Version); err != nil {
+		return nil, err
+	}
+
+	// An input is at least a hash, index, script length and sequence
+	numInputs, err := readCount(32 + 4 + 4 + 4)
+	if err != nil {
+		return nil, err
+	}
+	tx.Inputs = make([]TxInput, numInputs)
 	for i := range tx.Inputs {
-		r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash[:])
-		if err != nil {
-			return err
+		in := &tx.Inputs[i]
+		if _, err := io.ReadFull(r, in.PrevTxHash[:]); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.PrevTxIndex); err != nil {
+			return nil, err
+		}
+		if in.Script, err = readScript(); err != nil {
+			return nil, err
 		}
-		
-		signature := append(r.Bytes(), s.Bytes()...)
+		if err := binary.Read(r, binary.LittleEndian, &in.Sequence); err != nil {
+			return nil, err
+		}
+	}
+
+	// An output is at least a value and script length
+	numOutputs, err := readCount(8 + 4)
+	if err != nil {
+		return nil, err
+	}
+	tx.Outputs = make([]TxOutput, numOutputs)
+	for i := range tx.Outputs {
+		out := &tx.Outputs[i]
+		if err := binary.Read(r, binary.LittleEndian, &out.Value); err != nil {
+			return nil, err
+		}
+		if out.Script, err = readScript(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &tx.LockTime); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after transaction")
+	}
+
+	tx.Hash = tx.CalculateHash()
+	return tx, nil
+}
+
+// SignatureHash returns the digest input signatures sign: the hash of the
+// transaction with every input script empty, so signatures don't cover
+// each other
+func (tx *Transaction) SignatureHash() [32]byte {
+	unsigned := *tx
+	unsigned.Inputs = make([]TxInput, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		in.Script = nil
+		unsigned.Inputs[i] = in
+	}
+	return unsigned.CalculateHash()
+}
+
+// Sign signs every input of the transaction with the given private key
+// and updates its hash; see SignatureHash for what is signed. Signatures
+// are deterministic, see signHash, and DER encoded.
+func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) error {
+	return tx.SignWith(KeySigner{Key: privateKey})
+}
+
+// SignWith signs every input of the transaction with signer and updates
+// its hash. The signature is checked against the signer's public key, so
+// a faulty external signer can't produce an invalid transaction.
+func (tx *Transaction) SignWith(signer Signer) error {
+	hash := tx.SignatureHash()
+	signature, err := signer.SignHash(hash)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(signer.PublicKey(), hash, signature); err != nil {
+		return fmt.Errorf("signer returned a bad signature: %v", err)
+	}
+	for i := range tx.Inputs {
 		tx.Inputs[i].Script = signature
 	}
 	
+	tx.Hash = tx.CalculateHash()
 	return nil
 }
 
 // Verify verifies the transaction signature with the given public key
 func (tx *Transaction) Verify(publicKey *ecdsa.PublicKey) bool {
-	hash := tx.CalculateHash()
+	hash := tx.SignatureHash()
 	
 	for _, input := range tx.Inputs {
-		if len(input.Script) != 64 {
-			return false
-		}
-		
-		r := new(big.Int).SetBytes(input.Script[:32])
-		s := new(big.Int).SetBytes(input.Script[32:])
-		
-		if !ecdsa.Verify(publicKey, hash[:], r, s) {
+		if verifySignature(publicKey, hash, input.Script) != nil {
 			return false
 		}
 	}
@@ -109,6 +216,35 @@ func (tx *Transaction) Verify(publicKey *ecdsa.PublicKey) bool {
 	return true
 }
 
+// Clone returns a deep copy of the transaction, including its input and
+// output scripts
+func (tx *Transaction) Clone() *Transaction {
+	clone := *tx
+	if tx.Inputs != nil {
+		clone.Inputs = make([]TxInput, len(tx.Inputs))
+		for i, in := range tx.Inputs {
+			in.Script = cloneBytes(in.Script)
+			clone.Inputs[i] = in
+		}
+	}
+	if tx.Outputs != nil {
+		clone.Outputs = make([]TxOutput, len(tx.Outputs))
+		for i, out := range tx.Outputs {
+			out.Script = cloneBytes(out.Script)
+			clone.Outputs[i] = out
+		}
+	}
+	return &clone
+}
+
+// cloneBytes copies b, keeping nil as nil
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
 // IsCoinbase checks if this is a coinbase transaction
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && bytes.Equal(tx.Inputs[0].PrevTxHash[:], make([]byte, 32))
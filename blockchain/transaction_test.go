@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTransactionEncodeRoundTrip(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: [32]byte{1, 2, 3}, PrevTxIndex: 7, Script: []byte("sig"), Sequence: 0xFFFFFFFE}},
+		[]TxOutput{{Value: 150000000, Script: []byte("addr1")}, {Value: 42, Script: nil}},
+	)
+	tx.LockTime = 99
+	tx.Hash = tx.CalculateHash()
+
+	decoded, err := DecodeTransaction(tx.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != tx.Hash {
+		t.Errorf("hash = %x, want %x", decoded.Hash, tx.Hash)
+	}
+	if !bytes.Equal(decoded.Encode(), tx.Encode()) {
+		t.Error("re-encoding differs from the original")
+	}
+}
+
+func TestDecodeTransactionRejectsMalformed(t *testing.T) {
+	valid := NewTransaction(
+		[]TxInput{{PrevTxHash: [32]byte{9}, Script: []byte("sig")}},
+		[]TxOutput{{Value: 1, Script: []byte("addr")}},
+	).Encode()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing data", append(append([]byte{}, valid...), 0)},
+		{"huge input count", []byte{1, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeTransaction(tt.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTransactionClone(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: [32]byte{1}, Script: []byte("sig")}},
+		[]TxOutput{{Value: 5, Script: []byte("addr")}, {Value: 6}},
+	)
+	clone := tx.Clone()
+	if !bytes.Equal(clone.Encode(), tx.Encode()) || clone.Hash != tx.Hash {
+		t.Fatal("clone differs from the original")
+	}
+	if clone.Outputs[1].Script != nil {
+		t.Error("nil script cloned as non-nil")
+	}
+
+	clone.Inputs[0].Script[0] = 'X'
+	clone.Outputs[0].Script[0] = 'X'
+	clone.Outputs[0].Value = 50
+	clone.Inputs = append(clone.Inputs, TxInput{})
+	if string(tx.Inputs[0].Script) != "sig" || string(tx.Outputs[0].Script) != "addr" || tx.Outputs[0].Value != 5 || len(tx.Inputs) != 1 {
+		t.Error("modifying the clone changed the original")
+	}
+}
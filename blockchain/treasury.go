@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxBasisPoints is 100% in basis points
+const maxBasisPoints = 10000
+
+// TreasuryParams direct a share of every coinbase to a development fund
+type TreasuryParams struct {
+	// Address receives the treasury output
+	Address string `json:"address"`
+
+	// BasisPoints is the share of the coinbase paid to Address, in
+	// hundredths of a percent
+	BasisPoints int `json:"basis_points"`
+
+	// ActivationHeight is the first height whose coinbase must pay the
+	// treasury
+	ActivationHeight int `json:"activation_height"`
+}
+
+// validate checks the treasury parameters for consistency
+func (t *TreasuryParams) validate() error {
+	if t.Address == "" {
+		return errors.New("treasury has no address")
+	}
+	if t.BasisPoints <= 0 || t.BasisPoints > maxBasisPoints {
+		return fmt.Errorf("invalid treasury share of %d basis points", t.BasisPoints)
+	}
+	if t.ActivationHeight < 0 {
+		return fmt.Errorf("invalid treasury activation height %d", t.ActivationHeight)
+	}
+	return nil
+}
+
+// TreasuryShare returns the amount a coinbase of total value at height must
+// pay the treasury: nothing before activation or without a treasury
+func (p *ChainParams) TreasuryShare(height int, total uint64) Amount {
+	if p.Treasury == nil || height < p.Treasury.ActivationHeight {
+		return 0
+	}
+	return Amount(total).MulDiv(int64(p.Treasury.BasisPoints), maxBasisPoints)
+}
+
+// checkTreasury checks that the coinbase of the block at height pays the
+// treasury its share of everything the coinbase claims. The share is taken
+// from the claimed total rather than subsidy plus fees so the rule needs
+// no chain state.
+func (p *ChainParams) checkTreasury(height int, block *Block) error {
+	if p.Treasury == nil || height < p.Treasury.ActivationHeight {
+		return nil
+	}
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return errors.New("first transaction is not a coinbase")
+	}
+
+	var total, paid uint64
+	script := []byte(p.Treasury.Address)
+	for _, output := range block.Transactions[0].Outputs {
+		total += output.Value
+		if bytes.Equal(output.Script, script) {
+			paid += output.Value
+		}
+	}
+	if required := uint64(p.TreasuryShare(height, total)); paid < required {
+		return fmt.Errorf("coinbase pays the treasury %d, less than its share %d", paid, required)
+	}
+	return nil
+}
+
+// newCoinbase creates the coinbase of the block at height, claiming the
+// subsidy plus fees. The treasury share, if any, goes to its own output
+// and the rest to script. The height is put in the input script so that
+// coinbases paying the same script at different heights have distinct
+// hashes.
+func (bc *Blockchain) newCoinbase(height int, fees uint64, script []byte) *Transaction {
+	total := uint64(bc.params.BlockSubsidy(height)) + fees
+	coinbase := CreateCoinbase(total, script)
+	coinbase.Inputs[0].Script = binary.LittleEndian.AppendUint32(nil, uint32(height))
+
+	if share := uint64(bc.params.TreasuryShare(height, total)); share > 0 {
+		coinbase.Outputs[0].Value -= share
+		coinbase.Outputs = append(coinbase.Outputs, TxOutput{Value: share, Script: []byte(bc.params.Treasury.Address)})
+	}
+	coinbase.Hash = coinbase.CalculateHash()
+	return coinbase
+}
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// newTreasuryTestChain returns a test chain paying 10% to a treasury from
+// height 2
+func newTreasuryTestChain() *Blockchain {
+	params := MainNetParams
+	params.Consensus.InitialDifficulty = params.Consensus.MinimumDifficulty
+	params.Treasury = &TreasuryParams{Address: "devfund", BasisPoints: 1000, ActivationHeight: 2}
+	return NewBlockchainWithParams(&params)
+}
+
+func TestTreasuryTemplate(t *testing.T) {
+	bc := newTreasuryTestChain()
+
+	// Before activation the miner gets everything
+	block, err := bc.NewBlockTemplate([]byte("pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(block.Transactions[0].Outputs); n != 1 {
+		t.Fatalf("coinbase before activation has %d outputs", n)
+	}
+	block.Mine()
+	if err := bc.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err = bc.NewBlockTemplate([]byte("pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := block.Transactions[0].Outputs
+	subsidy := uint64(bc.params.BlockSubsidy(2))
+	if len(outputs) != 2 || string(outputs[1].Script) != "devfund" {
+		t.Fatalf("coinbase outputs = %+v, want a treasury output", outputs)
+	}
+	if outputs[1].Value != subsidy/10 || outputs[0].Value+outputs[1].Value != subsidy {
+		t.Errorf("coinbase splits %d into %d and %d", subsidy, outputs[0].Value, outputs[1].Value)
+	}
+}
+
+func TestTreasuryEnforced(t *testing.T) {
+	bc := newTreasuryTestChain()
+	genesis := bc.GetLatestBlock()
+
+	// mineTestBlock pays everything to the miner, which is fine at height 1
+	a1 := mineTestBlock(bc, genesis, "a1")
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+	a2 := mineTestBlock(bc, a1, "a2")
+	if err := bc.ProcessBlock(a2); err == nil {
+		t.Fatal("block without treasury output accepted")
+	}
+
+	// Side branches are held to the same rule
+	b1 := mineTestBlock(bc, genesis, "b1")
+	if err := bc.ProcessBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ProcessBlock(mineTestBlock(bc, b1, "b2")); err == nil {
+		t.Fatal("side block without treasury output accepted")
+	}
+}
+
+func TestTreasuryParamsValidate(t *testing.T) {
+	for _, treasury := range []TreasuryParams{
+		{Address: "", BasisPoints: 100},
+		{Address: "devfund", BasisPoints: 0},
+		{Address: "devfund", BasisPoints: 10001},
+		{Address: "devfund", BasisPoints: 100, ActivationHeight: -1},
+	} {
+		params := testParams()
+		params.Treasury = &treasury
+		if err := params.Validate(); err == nil {
+			t.Errorf("Validate accepted treasury %+v", treasury)
+		}
+	}
+}
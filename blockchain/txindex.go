@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+var (
+	// ErrNoTxIndex is returned by GetTransaction for a transaction not in
+	// the mempool when the transaction index is disabled
+	ErrNoTxIndex = errors.New("transaction index is disabled")
+
+	// ErrTxNotFound is returned by GetTransaction for a transaction in
+	// neither the mempool nor a main chain block
+	ErrTxNotFound = errors.New("transaction not found")
+)
+
+// Transaction index log record types
+const (
+	txIndexConnect    byte = 1 // Block hash, transaction count, hashes
+	txIndexDisconnect byte = 2 // Block hash
+)
+
+// TxLocation is where a main chain transaction is
+type TxLocation struct {
+	BlockHash Hash `json:"block_hash"`
+	Height    int  `json:"height"`
+	Position  int  `json:"position"` // Index in the block's transactions
+}
+
+// txIndex maps the hash of every main chain transaction to its block and
+// position. It is kept on disk as a log of connected and disconnected
+// blocks, compacted when opened, so a restarted node only indexes the
+// blocks connected since.
+type txIndex struct {
+	file    *os.File
+	entries map[[32]byte]txIndexEntry
+}
+
+// txIndexEntry is the location of an indexed transaction
+type txIndexEntry struct {
+	block    [32]byte
+	position int
+}
+
+// indexedBlock is a connected block replayed from the index log
+type indexedBlock struct {
+	hash [32]byte
+	txs  [][32]byte
+}
+
+// EnableTxIndex loads the transaction index from path, creating it if
+// needed, brings it up to the main chain and keeps it there as blocks are
+// connected and disconnected
+func (bc *Blockchain) EnableTxIndex(path string) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	indexed, err := readTxIndexLog(path)
+	if err != nil {
+		return err
+	}
+	// Blocks disconnected while the node was down are no longer on the
+	// main chain; those below them still are
+	for len(indexed) > 0 && bc.mainChainHeight(indexed[len(indexed)-1].hash) < 0 {
+		indexed = indexed[:len(indexed)-1]
+	}
+
+	idx := &txIndex{entries: make(map[[32]byte]txIndexEntry)}
+	for _, block := range indexed {
+		idx.add(block.hash, block.txs)
+	}
+	for _, block := range bc.blocks[len(indexed):] {
+		txs := make([][32]byte, len(block.Transactions))
+		for i := range block.Transactions {
+			txs[i] = block.Transactions[i].Hash
+		}
+		idx.add(block.Hash, txs)
+		indexed = append(indexed, indexedBlock{block.Hash, txs})
+	}
+
+	if bc.txIndex != nil {
+		bc.txIndex.file.Close()
+		bc.txIndex = nil
+	}
+	if idx.file, err = writeTxIndexLog(path, indexed); err != nil {
+		return err
+	}
+	bc.txIndex = idx
+	log.Printf("Transaction index holds %d transactions of %d blocks", len(idx.entries), len(indexed))
+	return nil
+}
+
+// add indexes the transactions of a block
+func (idx *txIndex) add(block [32]byte, txs [][32]byte) {
+	for i, hash := range txs {
+		idx.entries[hash] = txIndexEntry{block: block, position: i}
+	}
+}
+
+// connect indexes a block connected to the main chain and logs it
+func (idx *txIndex) connect(block *Block) {
+	record := make([]byte, 0, 1+32+4+32*len(block.Transactions))
+	record = append(record, txIndexConnect)
+	record = append(record, block.Hash[:]...)
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(block.Transactions)))
+	for i := range block.Transactions {
+		hash := block.Transactions[i].Hash
+		idx.entries[hash] = txIndexEntry{block: block.Hash, position: i}
+		record = append(record, hash[:]...)
+	}
+	idx.write(record)
+}
+
+// disconnect removes a block disconnected from the main chain and logs it
+func (idx *txIndex) disconnect(block *Block) {
+	for i := range block.Transactions {
+		if entry, ok := idx.entries[block.Transactions[i].Hash]; ok && entry.block == block.Hash {
+			delete(idx.entries, block.Transactions[i].Hash)
+		}
+	}
+	idx.write(append([]byte{txIndexDisconnect}, block.Hash[:]...))
+}
+
+// write appends a record to the index log. The index in memory stays
+// right if it fails; the log is rebuilt from the chain when next opened.
+func (idx *txIndex) write(record []byte) {
+	if _, err := idx.file.Write(record); err != nil {
+		log.Printf("Error writing transaction index: %v", err)
+	}
+}
+
+// readTxIndexLog replays an index log into the blocks it has connected, in
+// chain order. A missing log is empty, and a record cut short by a crash
+// ends it.
+func readTxIndexLog(path string) ([]indexedBlock, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var blocks []indexedBlock
+	for {
+		kind, err := r.ReadByte()
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var hash [32]byte
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return blocks, nil
+		}
+		switch kind {
+		case txIndexConnect:
+			var count uint32
+			if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+				return blocks, nil
+			}
+			block := indexedBlock{hash: hash}
+			for i := uint32(0); i < count; i++ {
+				var tx [32]byte
+				if _, err := io.ReadFull(r, tx[:]); err != nil {
+					return blocks, nil
+				}
+				block.txs = append(block.txs, tx)
+			}
+			blocks = append(blocks, block)
+		case txIndexDisconnect:
+			if len(blocks) == 0 || blocks[len(blocks)-1].hash != hash {
+				return nil, fmt.Errorf("transaction index %s disconnects block %x, which is not its tip", path, hash)
+			}
+			blocks = blocks[:len(blocks)-1]
+		default:
+			return nil, fmt.Errorf("transaction index %s has an unknown record type %d", path, kind)
+		}
+	}
+}
+
+// writeTxIndexLog replaces the index log with the connect records of
+// blocks and returns it open for appending
+func writeTxIndexLog(path string, blocks []indexedBlock) (*os.File, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	for _, block := range blocks {
+		w.WriteByte(txIndexConnect)
+		w.Write(block.hash[:])
+		binary.Write(w, binary.LittleEndian, uint32(len(block.txs)))
+		for _, tx := range block.txs {
+			w.Write(tx[:])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// GetTransaction returns a transaction in the mempool or, if the
+// transaction index is enabled, in a main chain block, with its location
+// in the chain; the location is nil for mempool transactions. The
+// transaction is shared and must not be modified.
+func (bc *Blockchain) GetTransaction(hash [32]byte) (*Transaction, *TxLocation, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if tx := bc.mempoolTx(hash); tx != nil {
+		return tx, nil, nil
+	}
+	if bc.txIndex == nil {
+		return nil, nil, ErrNoTxIndex
+	}
+	entry, ok := bc.txIndex.entries[hash]
+	if !ok {
+		return nil, nil, ErrTxNotFound
+	}
+	height := bc.mainChainHeight(entry.block)
+	if height < 0 {
+		return nil, nil, ErrTxNotFound
+	}
+	return &bc.blocks[height].Transactions[entry.position], &TxLocation{
+		BlockHash: entry.block,
+		Height:    height,
+		Position:  entry.position,
+	}, nil
+}
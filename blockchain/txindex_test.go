@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTxIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txindex.dat")
+	bc := NewBlockchainWithParams(&RegTestParams)
+	first, err := bc.GenerateBlock([]byte("miner"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := first.Transactions[0].Hash
+	if _, _, err := bc.GetTransaction(coinbase); err != ErrNoTxIndex {
+		t.Fatalf("GetTransaction without an index err = %v", err)
+	}
+
+	if err := bc.EnableTxIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	tx, loc, err := bc.GetTransaction(coinbase)
+	if err != nil || tx.Hash != coinbase || loc.BlockHash != first.Hash || loc.Height != 1 || loc.Position != 0 {
+		t.Fatalf("GetTransaction = %v, %+v, %v", tx, loc, err)
+	}
+
+	// Blocks connected after enabling are indexed and logged
+	second, err := bc.GenerateBlock([]byte("miner"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, loc, err := bc.GetTransaction(second.Transactions[0].Hash); err != nil || loc.Height != 2 {
+		t.Fatalf("GetTransaction of a new block = %+v, %v", loc, err)
+	}
+	if err := bc.EnableTxIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.txIndex.entries) != 2 {
+		t.Errorf("reloaded index has %d transactions, want 2", len(bc.txIndex.entries))
+	}
+
+	// Disconnected blocks are dropped
+	if err := bc.InvalidateBlock(second.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bc.GetTransaction(second.Transactions[0].Hash); err != ErrTxNotFound {
+		t.Errorf("GetTransaction of a disconnected block err = %v", err)
+	}
+
+	// A chain that never had the logged blocks drops them when loading
+	other := NewBlockchainWithParams(&RegTestParams)
+	block, err := other.GenerateBlock([]byte("other"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.EnableTxIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.GetTransaction(coinbase); err != ErrTxNotFound {
+		t.Errorf("GetTransaction of another chain's block err = %v", err)
+	}
+	if _, loc, err := other.GetTransaction(block.Transactions[0].Hash); err != nil || loc.BlockHash != block.Hash {
+		t.Errorf("GetTransaction = %+v, %v", loc, err)
+	}
+	if indexed, err := readTxIndexLog(path); err != nil || len(indexed) != 2 {
+		t.Errorf("compacted log has %d blocks, %v; want 2", len(indexed), err)
+	}
+}
@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTxRelayDelay is the mean delay before transactions are relayed to
+// an outbound peer; inbound peers wait twice as long
+const DefaultTxRelayDelay = 2 * time.Second
+
+// maxTxRelayQueue bounds the transactions waiting to be relayed to a peer
+const maxTxRelayQueue = 5000
+
+// SetTxRelayDelay sets the mean delay before transactions are relayed to a
+// peer. Each peer waits a random, exponentially distributed time between
+// batches, so the peers hearing of a transaction first can't tell whether
+// this node originated it. 0 relays transactions as soon as they arrive.
+func (n *Network) SetTxRelayDelay(mean time.Duration) {
+	atomic.StoreInt64(&n.txRelayDelay, int64(mean))
+}
+
+// SetWalletRelayPeers limits the peers this node's own transactions are
+// first sent to: that many randomly chosen peers, outbound ones first,
+// which relay them on. 0 sends them to every peer.
+func (n *Network) SetWalletRelayPeers(count int) {
+	atomic.StoreInt32(&n.walletRelayPeers, int32(count))
+}
+
+// BroadcastTransaction relays a transaction this node originated, to the
+// peers chosen by SetWalletRelayPeers
+func (n *Network) BroadcastTransaction(tx *Transaction) {
+	for _, peer := range n.walletRelayTargets() {
+		n.queueTransaction(peer, tx)
+	}
+}
+
+// relayTransaction relays a transaction received from a peer to every
+// other peer
+func (n *Network) relayTransaction(tx *Transaction, from *Peer) {
+	for _, peer := range n.GetPeers() {
+		if peer != from {
+			n.queueTransaction(peer, tx)
+		}
+	}
+}
+
+// walletRelayTargets returns the peers this node's own transactions are
+// sent to
+func (n *Network) walletRelayTargets() []*Peer {
+	peers := n.GetPeers()
+	count := int(atomic.LoadInt32(&n.walletRelayPeers))
+	if count <= 0 || count >= len(peers) {
+		return peers
+	}
+	// Inbound peers are whoever chose to connect, spies included, so
+	// outbound peers are picked first
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	var outbound, inbound []*Peer
+	for _, peer := range peers {
+		if peer.Inbound {
+			inbound = append(inbound, peer)
+		} else {
+			outbound = append(outbound, peer)
+		}
+	}
+	return append(outbound, inbound...)[:count]
+}
+
+// queueTransaction queues a transaction for a peer's next relay batch, or
+// sends it at once without a relay delay
+func (n *Network) queueTransaction(peer *Peer, tx *Transaction) {
+	if atomic.LoadInt64(&n.txRelayDelay) <= 0 {
+		n.sendMessage(peer, MsgTypeTransaction, tx)
+		return
+	}
+	peer.txQueueMu.Lock()
+	defer peer.txQueueMu.Unlock()
+	if len(peer.txQueue) >= maxTxRelayQueue {
+		return
+	}
+	for _, queued := range peer.txQueue {
+		if queued.Hash == tx.Hash {
+			return
+		}
+	}
+	peer.txQueue = append(peer.txQueue, tx)
+}
+
+// trickleTransactions sends a peer its queued transactions in batches, at
+// random intervals, until the connection ends
+func (n *Network) trickleTransactions(peer *Peer) {
+	for {
+		mean := time.Duration(atomic.LoadInt64(&n.txRelayDelay))
+		if peer.Inbound {
+			mean *= 2
+		}
+		select {
+		case <-time.After(poissonDelay(mean)):
+		case <-peer.done:
+			return
+		case <-n.ctx.Done():
+			return
+		}
+		if err := n.flushTransactions(peer); err != nil {
+			log.Printf("Failed to relay transactions to peer %s: %v", peer.Address, err)
+		}
+	}
+}
+
+// flushTransactions sends a peer its queued transactions in random order,
+// in a single write
+func (n *Network) flushTransactions(peer *Peer) error {
+	peer.txQueueMu.Lock()
+	batch := peer.txQueue
+	peer.txQueue = nil
+	peer.txQueueMu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	rand.Shuffle(len(batch), func(i, j int) { batch[i], batch[j] = batch[j], batch[i] })
+	compress := atomic.LoadInt32(&peer.compress) == 1
+	var data []byte
+	for _, tx := range batch {
+		payload, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		msg, err := encodeMessage(Message{Type: MsgTypeTransaction, Payload: payload}, compress)
+		if err != nil {
+			return err
+		}
+		data = append(data, msg...)
+	}
+	return n.writeMessage(peer, MsgTypeTransaction, data)
+}
+
+// poissonDelay returns a random delay between events of a Poisson process
+// with the given mean interval, capped at ten times the mean. A
+// non-positive mean polls once a second, for the delay to be turned on.
+func poissonDelay(mean time.Duration) time.Duration {
+	if mean <= 0 {
+		return time.Second
+	}
+	delay := time.Duration(-math.Log(1-rand.Float64()) * float64(mean))
+	if delay > 10*mean {
+		delay = 10 * mean
+	}
+	return delay
+}
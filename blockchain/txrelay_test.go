@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWalletRelayTargets(t *testing.T) {
+	n := newTestNetwork(t, NewBlockchainWithParams(&RegTestParams))
+	for _, peer := range []*Peer{
+		{Address: "out1"}, {Address: "out2"},
+		{Address: "in1", Inbound: true}, {Address: "in2", Inbound: true},
+	} {
+		n.peers[peer.Address] = peer
+	}
+
+	tests := []struct {
+		count        int
+		wantPeers    int
+		wantOutbound int
+	}{
+		{0, 4, 2},
+		{1, 1, 1},
+		{2, 2, 2},
+		{3, 3, 2},
+		{10, 4, 2},
+	}
+	for _, tt := range tests {
+		n.SetWalletRelayPeers(tt.count)
+		targets := n.walletRelayTargets()
+		outbound := 0
+		for _, peer := range targets {
+			if !peer.Inbound {
+				outbound++
+			}
+		}
+		if len(targets) != tt.wantPeers || outbound != tt.wantOutbound {
+			t.Errorf("%d relay peers: got %d targets, %d outbound; want %d and %d", tt.count, len(targets), outbound, tt.wantPeers, tt.wantOutbound)
+		}
+	}
+}
+
+func TestTransactionTrickle(t *testing.T) {
+	origin := NewBlockchainWithParams(&RegTestParams)
+	peer := NewBlockchainWithParams(&RegTestParams)
+	funding, err := origin.GenerateBlock([]byte("miner"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.ProcessBlock(funding); err != nil {
+		t.Fatal(err)
+	}
+	originNet, peerNet := newTestNetwork(t, origin), newTestNetwork(t, peer)
+	originNet.SetTxRelayDelay(20 * time.Millisecond)
+	pipePeers(t, originNet, peerNet)
+
+	coinbase := funding.Transactions[0]
+	tx := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: coinbase.Outputs[0].Value - 10000, Script: []byte("payee")}},
+	)
+	if err := origin.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	originNet.BroadcastTransaction(tx)
+	originNet.BroadcastTransaction(tx) // Queued once
+
+	deadline := time.Now().Add(5 * time.Second)
+	for peer.MempoolSize() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("transaction not relayed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if peer.mempoolTx(tx.Hash) == nil {
+		t.Error("peer's mempool lacks the relayed transaction")
+	}
+}
+
+func TestPoissonDelay(t *testing.T) {
+	mean := 100 * time.Millisecond
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		delay := poissonDelay(mean)
+		if delay < 0 || delay > 10*mean {
+			t.Fatalf("delay %v out of range", delay)
+		}
+		total += delay
+	}
+	if avg := total / 1000; avg < mean/2 || avg > 2*mean {
+		t.Errorf("average delay %v, want about %v", avg, mean)
+	}
+}
@@ -0,0 +1,111 @@
+package blockchain
+
+import "log"
+
+// SpentOutput is an output spent by a block, as it was before the spend
+type SpentOutput struct {
+	TxHash Hash     `json:"tx_hash"`
+	Index  uint32   `json:"index"`
+	Output TxOutput `json:"output"`
+	Height int      `json:"height"` // Height of the block that created it
+
+	Coinbase bool `json:"coinbase,omitempty"` // Whether it was created by a coinbase
+}
+
+// BlockUndo is the unwind record of a connected block: every output its
+// transactions spent, in input order. Disconnecting the block restores
+// them without rescanning the chain.
+type BlockUndo struct {
+	Spent []SpentOutput `json:"spent"`
+}
+
+// connectBlock appends a block extending the tip to the main chain,
+// moving the outputs it spends from the UTXO set to its undo data and
+// adding those it creates; the caller must hold bc.mu for writing and
+// publish the new status
+func (bc *Blockchain) connectBlock(block *Block) {
+	height := len(bc.blocks)
+	undo := &BlockUndo{}
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				utxo, ok := bc.utxos.remove(outpoint{in.PrevTxHash, in.PrevTxIndex})
+				if !ok {
+					// Validated blocks only spend existing outputs
+					continue
+				}
+				undo.Spent = append(undo.Spent, SpentOutput{
+					TxHash:   utxo.TxHash,
+					Index:    utxo.Index,
+					Output:   utxo.Output,
+					Height:   utxo.Height,
+					Coinbase: utxo.Coinbase,
+				})
+			}
+		}
+		bc.utxos.addTx(tx, height)
+	}
+
+	bc.blocks = append(bc.blocks, block)
+	bc.indexBlock(block)
+	bc.undo[block.Hash] = undo
+	delete(bc.headers, block.Hash)
+	delete(bc.assumed, block.Hash)
+	if bc.txIndex != nil {
+		bc.txIndex.connect(block)
+	}
+	if bc.addrIndex != nil {
+		bc.addrIndex.connect(block, undo, height)
+	}
+	// Mempool transactions spending the same outputs as the block can
+	// never be mined now
+	conflicts := bc.mempoolConflicts(block)
+	if len(conflicts) > 0 {
+		log.Printf("Removed %d mempool transactions conflicting with block %x", len(conflicts), block.Hash)
+	}
+	bc.removeFromMempool(append(blockTransactions(block), conflicts...))
+}
+
+// disconnectTip removes the tip from the main chain, restoring the outputs
+// it spent from its undo data and dropping those it created, and returns
+// it; the caller must hold bc.mu for writing and publish the new status
+func (bc *Blockchain) disconnectTip() *Block {
+	tip := bc.blocks[len(bc.blocks)-1]
+	if bc.addrIndex != nil {
+		bc.addrIndex.disconnect(tip, bc.undo[tip.Hash])
+	}
+	if undo, ok := bc.undo[tip.Hash]; ok {
+		for _, spent := range undo.Spent {
+			bc.utxos.add(&UTXO{
+				TxHash:   spent.TxHash,
+				Index:    spent.Index,
+				Output:   spent.Output,
+				Height:   spent.Height,
+				Coinbase: spent.Coinbase,
+			})
+		}
+		delete(bc.undo, tip.Hash)
+	}
+	// Outputs created and spent within the block were restored above and
+	// go again here
+	for _, tx := range tip.Transactions {
+		for i := range tx.Outputs {
+			bc.utxos.remove(outpoint{tx.Hash, uint32(i)})
+		}
+	}
+	if bc.txIndex != nil {
+		bc.txIndex.disconnect(tip)
+	}
+	bc.blocks = bc.blocks[:len(bc.blocks)-1]
+	return tip
+}
+
+// GetBlockUndo returns the undo data of a main chain block. It is shared
+// and must not be modified.
+func (bc *Blockchain) GetBlockUndo(hash [32]byte) (*BlockUndo, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	undo, ok := bc.undo[hash]
+	return undo, ok
+}
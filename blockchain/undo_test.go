@@ -0,0 +1,55 @@
+package blockchain
+
+import "testing"
+
+func TestUndoDataRestoresSpentOutputs(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	funding, err := bc.GenerateBlock([]byte("alice"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+
+	spend := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: coinbase.Outputs[0].Value, Script: []byte("bob")}},
+	)
+	bc.addToMempool(spend)
+	block, err := bc.GenerateBlock([]byte("miner"), [][32]byte{spend.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	undo, ok := bc.GetBlockUndo(block.Hash)
+	if !ok || len(undo.Spent) != 1 {
+		t.Fatalf("undo = %+v, %v", undo, ok)
+	}
+	spent := undo.Spent[0]
+	if spent.TxHash != coinbase.Hash || spent.Index != 0 || spent.Height != 1 || string(spent.Output.Script) != "alice" {
+		t.Errorf("spent output = %+v", spent)
+	}
+	if bc.IsUnspent(coinbase.Hash, 0) {
+		t.Fatal("coinbase not marked spent")
+	}
+
+	// Disconnecting the block restores the output and drops its undo data
+	if err := bc.InvalidateBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.IsUnspent(coinbase.Hash, 0) {
+		t.Error("coinbase still spent after disconnect")
+	}
+	if _, ok := bc.GetBlockUndo(block.Hash); ok {
+		t.Error("undo data kept for a disconnected block")
+	}
+
+	if err := bc.ReconsiderBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if bc.IsUnspent(coinbase.Hash, 0) {
+		t.Error("coinbase not spent after reconnect")
+	}
+	if _, ok := bc.GetBlockUndo(block.Hash); !ok {
+		t.Error("no undo data after reconnect")
+	}
+}
@@ -0,0 +1,185 @@
+package blockchain
+
+import "sort"
+
+// UTXO is an unspent output of a main chain transaction
+type UTXO struct {
+	TxHash   Hash     `json:"tx_hash"`
+	Index    uint32   `json:"index"`
+	Output   TxOutput `json:"output"`
+	Height   int      `json:"height"` // Height of the block that created it
+	Coinbase bool     `json:"coinbase,omitempty"`
+}
+
+// utxoSet holds the unspent outputs of the main chain, indexed by outpoint
+// and by output script. It is updated as blocks connect and disconnect, so
+// balance lookups and spend checks never rescan the chain.
+type utxoSet struct {
+	outputs  map[outpoint]*UTXO
+	byScript map[string]map[outpoint]*UTXO
+}
+
+func newUTXOSet() *utxoSet {
+	return &utxoSet{
+		outputs:  make(map[outpoint]*UTXO),
+		byScript: make(map[string]map[outpoint]*UTXO),
+	}
+}
+
+// get returns the unspent output at an outpoint
+func (s *utxoSet) get(op outpoint) (*UTXO, bool) {
+	utxo, ok := s.outputs[op]
+	return utxo, ok
+}
+
+// add records an unspent output
+func (s *utxoSet) add(utxo *UTXO) {
+	op := outpoint{utxo.TxHash, utxo.Index}
+	s.outputs[op] = utxo
+	script := string(utxo.Output.Script)
+	if s.byScript[script] == nil {
+		s.byScript[script] = make(map[outpoint]*UTXO)
+	}
+	s.byScript[script][op] = utxo
+}
+
+// addTx records the outputs of a transaction connected at height
+func (s *utxoSet) addTx(tx *Transaction, height int) {
+	for i, out := range tx.Outputs {
+		s.add(&UTXO{TxHash: tx.Hash, Index: uint32(i), Output: out, Height: height, Coinbase: tx.IsCoinbase()})
+	}
+}
+
+// remove drops an output once spent, returning it
+func (s *utxoSet) remove(op outpoint) (*UTXO, bool) {
+	utxo, ok := s.outputs[op]
+	if !ok {
+		return nil, false
+	}
+	delete(s.outputs, op)
+	script := string(utxo.Output.Script)
+	delete(s.byScript[script], op)
+	if len(s.byScript[script]) == 0 {
+		delete(s.byScript, script)
+	}
+	return utxo, true
+}
+
+// forScript returns the unspent outputs paying script, oldest first
+func (s *utxoSet) forScript(script []byte) []*UTXO {
+	utxos := make([]*UTXO, 0, len(s.byScript[string(script)]))
+	for _, utxo := range s.byScript[string(script)] {
+		utxos = append(utxos, utxo)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := utxos[i], utxos[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.TxHash != b.TxHash {
+			return string(a.TxHash[:]) < string(b.TxHash[:])
+		}
+		return a.Index < b.Index
+	})
+	return utxos
+}
+
+// GetUTXOs returns copies of the unspent main chain outputs paying
+// script, oldest first
+func (bc *Blockchain) GetUTXOs(script []byte) []UTXO {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	utxos := make([]UTXO, 0)
+	for _, utxo := range bc.utxos.forScript(script) {
+		utxos = append(utxos, *utxo)
+	}
+	return utxos
+}
+
+// IsUnspent reports whether an output exists on the main chain and is
+// unspent there. Spends in the mempool don't count.
+func (bc *Blockchain) IsUnspent(txHash Hash, index uint32) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	_, ok := bc.utxos.get(outpoint{txHash, index})
+	return ok
+}
+
+// utxoView is the UTXO set as it would be after disconnecting and
+// connecting blocks, layered over the chain's set without changing it, so
+// a branch can be validated before the chain reorganizes onto it
+type utxoView struct {
+	base    *utxoSet
+	added   map[outpoint]*UTXO
+	removed map[outpoint]bool
+}
+
+func newUTXOView(base *utxoSet) *utxoView {
+	return &utxoView{
+		base:    base,
+		added:   make(map[outpoint]*UTXO),
+		removed: make(map[outpoint]bool),
+	}
+}
+
+// get returns the unspent output at an outpoint
+func (v *utxoView) get(op outpoint) (*UTXO, bool) {
+	if utxo, ok := v.added[op]; ok {
+		return utxo, true
+	}
+	if v.removed[op] {
+		return nil, false
+	}
+	return v.base.get(op)
+}
+
+// add records an unspent output
+func (v *utxoView) add(utxo *UTXO) {
+	op := outpoint{utxo.TxHash, utxo.Index}
+	v.added[op] = utxo
+	delete(v.removed, op)
+}
+
+// remove drops an output
+func (v *utxoView) remove(op outpoint) {
+	delete(v.added, op)
+	v.removed[op] = true
+}
+
+// connectBlock spends the outputs a block at height spends and adds those
+// it creates
+func (v *utxoView) connectBlock(block *Block, height int) {
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				v.remove(outpoint{in.PrevTxHash, in.PrevTxIndex})
+			}
+		}
+		for j, out := range tx.Outputs {
+			v.add(&UTXO{TxHash: tx.Hash, Index: uint32(j), Output: out, Height: height, Coinbase: tx.IsCoinbase()})
+		}
+	}
+}
+
+// disconnectBlock undoes connectBlock for a main chain block, restoring
+// the outputs it spent from its undo data
+func (v *utxoView) disconnectBlock(block *Block, undo *BlockUndo) {
+	if undo != nil {
+		for _, spent := range undo.Spent {
+			v.add(&UTXO{
+				TxHash:   spent.TxHash,
+				Index:    spent.Index,
+				Output:   spent.Output,
+				Height:   spent.Height,
+				Coinbase: spent.Coinbase,
+			})
+		}
+	}
+	for _, tx := range block.Transactions {
+		for i := range tx.Outputs {
+			v.remove(outpoint{tx.Hash, uint32(i)})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import "testing"
+
+func TestUTXOSetFollowsConnectAndDisconnect(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	funding, err := bc.GenerateBlock([]byte("alice"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+	value := coinbase.Outputs[0].Value
+	if got := bc.GetBalance([]byte("alice")); got != value {
+		t.Fatalf("alice balance = %d, want %d", got, value)
+	}
+	utxos := bc.GetUTXOs([]byte("alice"))
+	if len(utxos) != 1 || utxos[0].TxHash != coinbase.Hash || utxos[0].Height != 1 || !utxos[0].Coinbase {
+		t.Fatalf("alice UTXOs = %+v", utxos)
+	}
+
+	// Alice pays bob, who pays carol in the same block
+	toBob := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: value - 10, Script: []byte("bob")}, {Value: 10, Script: []byte("alice")}},
+	)
+	toCarol := NewTransaction(
+		[]TxInput{{PrevTxHash: toBob.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: value - 10, Script: []byte("carol")}},
+	)
+	bc.addToMempool(toBob, toCarol)
+	block, err := bc.GenerateBlock([]byte("miner"), [][32]byte{toBob.Hash, toCarol.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bc.IsUnspent(coinbase.Hash, 0) || bc.IsUnspent(toBob.Hash, 0) {
+		t.Error("spent outputs still in the UTXO set")
+	}
+	if !bc.IsUnspent(toBob.Hash, 1) || !bc.IsUnspent(toCarol.Hash, 0) {
+		t.Error("created outputs missing from the UTXO set")
+	}
+	balances := map[string]uint64{"alice": 10, "bob": 0, "carol": value - 10}
+	for script, want := range balances {
+		if got := bc.GetBalance([]byte(script)); got != want {
+			t.Errorf("%s balance = %d, want %d", script, got, want)
+		}
+	}
+
+	// Disconnecting the block restores the set as it was
+	if err := bc.InvalidateBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.IsUnspent(coinbase.Hash, 0) || bc.IsUnspent(toBob.Hash, 0) || bc.IsUnspent(toBob.Hash, 1) || bc.IsUnspent(toCarol.Hash, 0) {
+		t.Error("UTXO set not restored after disconnect")
+	}
+	if utxos := bc.GetUTXOs([]byte("alice")); len(utxos) != 1 || !utxos[0].Coinbase || utxos[0].Height != 1 {
+		t.Errorf("restored alice UTXOs = %+v", utxos)
+	}
+	if got := bc.GetBalance([]byte("carol")); got != 0 {
+		t.Errorf("carol balance after disconnect = %d", got)
+	}
+}
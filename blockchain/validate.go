@@ -0,0 +1,369 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+var (
+	// ErrStaleTemplate is returned by TestBlockValidity for a block that
+	// does not build on the current tip
+	ErrStaleTemplate = errors.New("block does not extend the chain tip")
+
+	// ErrAlreadyInMempool is returned by AddTransaction for a transaction
+	// the mempool already holds
+	ErrAlreadyInMempool = errors.New("transaction already in mempool")
+
+	// ErrMempoolConflict is returned by AddTransaction for a transaction
+	// spending an output a mempool transaction already spends
+	ErrMempoolConflict = errors.New("transaction conflicts with the mempool")
+)
+
+// outpoint identifies a transaction output
+type outpoint struct {
+	hash  [32]byte
+	index uint32
+}
+
+// TestBlockValidity checks that a block would be accepted on top of the
+// current tip under the full consensus rules, except proof of work. The
+// pool runs every template through it before handing out jobs, so miners
+// never work on a block the chain would reject.
+func (bc *Blockchain) TestBlockValidity(block *Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.checkBlockValidity(block)
+}
+
+// checkBlockValidity implements TestBlockValidity; the caller must hold
+// bc.mu
+func (bc *Blockchain) checkBlockValidity(block *Block) error {
+	tip := bc.blocks[len(bc.blocks)-1]
+	if block.PrevHash != tip.Hash {
+		return ErrStaleTemplate
+	}
+	header := block.Header()
+	if err := bc.checkHeaderDifficulty(&header); err != nil {
+		return err
+	}
+	if block.MerkleRoot != block.CalculateMerkleRoot() {
+		return errors.New("merkle root mismatch")
+	}
+	if err := bc.checkBlockTime(block); err != nil {
+		return err
+	}
+	return bc.checkBlockTransactions(block, len(bc.blocks), bc.utxos)
+}
+
+// utxoSource looks up unspent outputs: the chain's UTXO set, or a view of
+// it on another branch
+type utxoSource interface {
+	get(op outpoint) (*UTXO, bool)
+}
+
+// checkBlockTransactions checks the transactions of a block connected at
+// height against the unspent outputs of its parent: the block within the
+// chain's size limit, a single coinbase first, every input spending an
+// existing unspent output of the chain or of an earlier transaction in the
+// block with a valid signature, every transaction final at the block's
+// height and time, no transaction creating value, and a coinbase claiming
+// at most the subsidy and fees. Signatures are not verified in checkpoints
+// and their ancestors, see assumedValid. The caller must hold bc.mu.
+func (bc *Blockchain) checkBlockTransactions(block *Block, height int, utxos utxoSource) error {
+	if size, limit := block.Size(), bc.params.BlockSizeLimit(); size > limit {
+		return fmt.Errorf("block size %d exceeds %d bytes", size, limit)
+	}
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return errors.New("first transaction is not a coinbase")
+	}
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if tx.Hash != tx.CalculateHash() {
+			return fmt.Errorf("transaction %d hash mismatch", i)
+		}
+		if i > 0 && tx.IsCoinbase() {
+			return fmt.Errorf("transaction %d is a second coinbase", i)
+		}
+		if !tx.IsFinal(height, block.Timestamp) {
+			return fmt.Errorf("transaction %d is not final", i)
+		}
+	}
+
+	spends := newBlockSpends(utxos)
+	checkSignatures := !bc.assumedValid(block, height)
+	var fees uint64
+	for i := 1; i < len(block.Transactions); i++ {
+		tx := &block.Transactions[i]
+		fee, err := checkTxInputs(tx, spends.prevOutput, checkSignatures)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %v", i, err)
+		}
+		spends.apply(tx)
+		fees += fee
+	}
+
+	var claimed uint64
+	for _, output := range block.Transactions[0].Outputs {
+		if claimed+output.Value < claimed {
+			return errors.New("coinbase value overflows")
+		}
+		claimed += output.Value
+	}
+	if allowed := uint64(bc.params.BlockSubsidy(height)) + fees; claimed > allowed {
+		return fmt.Errorf("coinbase claims %d, more than subsidy and fees %d", claimed, allowed)
+	}
+	return bc.params.checkTreasury(height, block)
+}
+
+// blockSpends tracks the outputs spent and created by the transactions of a
+// block being checked or assembled, on top of the unspent outputs of its
+// parent
+type blockSpends struct {
+	utxos   utxoSource
+	spent   map[outpoint]bool
+	created map[outpoint]TxOutput
+}
+
+func newBlockSpends(utxos utxoSource) *blockSpends {
+	return &blockSpends{
+		utxos:   utxos,
+		spent:   make(map[outpoint]bool),
+		created: make(map[outpoint]TxOutput),
+	}
+}
+
+// prevOutput returns an output still unspent at this point of the block
+func (b *blockSpends) prevOutput(op outpoint) (TxOutput, bool) {
+	if b.spent[op] {
+		return TxOutput{}, false
+	}
+	if out, ok := b.created[op]; ok {
+		return out, true
+	}
+	utxo, ok := b.utxos.get(op)
+	if !ok {
+		return TxOutput{}, false
+	}
+	return utxo.Output, true
+}
+
+// apply records the spends and outputs of a transaction added to the block
+func (b *blockSpends) apply(tx *Transaction) {
+	for _, input := range tx.Inputs {
+		b.spent[outpoint{input.PrevTxHash, input.PrevTxIndex}] = true
+	}
+	for j, output := range tx.Outputs {
+		b.created[outpoint{tx.Hash, uint32(j)}] = output
+	}
+}
+
+// checkTxInputs checks a transaction against the outputs it spends, found
+// with prevOutput: every input must spend an available output, once, with
+// a signature script satisfying the output's script, see
+// checkInputSignature, as checkTimeLock allows if the output is
+// time-locked, and the outputs must not exceed the inputs. Signatures are
+// skipped unless checkSignatures. It returns the fee.
+func checkTxInputs(tx *Transaction, prevOutput func(outpoint) (TxOutput, bool), checkSignatures bool) (uint64, error) {
+	if len(tx.Inputs) == 0 {
+		return 0, errors.New("no inputs")
+	}
+	var sigHash [32]byte
+	if checkSignatures {
+		sigHash = tx.SignatureHash()
+	}
+	seen := make(map[outpoint]bool, len(tx.Inputs))
+	var in, out uint64
+	for i, input := range tx.Inputs {
+		op := outpoint{input.PrevTxHash, input.PrevTxIndex}
+		if seen[op] {
+			return 0, fmt.Errorf("input %d spends %x:%d twice", i, op.hash, op.index)
+		}
+		seen[op] = true
+		prev, ok := prevOutput(op)
+		if !ok {
+			return 0, fmt.Errorf("input %d spends missing or spent output %x:%d", i, op.hash, op.index)
+		}
+		script := prev.Script
+		if lockTime, inner, ok := ParseTimeLockScript(script); ok {
+			if err := checkTimeLock(tx, input, lockTime); err != nil {
+				return 0, fmt.Errorf("input %d: %v", i, err)
+			}
+			script = inner
+		}
+		if checkSignatures {
+			if err := checkInputSignature(sigHash, input.Script, script); err != nil {
+				return 0, fmt.Errorf("input %d: %v", i, err)
+			}
+		}
+		if in+prev.Value < in {
+			return 0, errors.New("input value overflows")
+		}
+		in += prev.Value
+	}
+	for _, output := range tx.Outputs {
+		if out+output.Value < out {
+			return 0, errors.New("output value overflows")
+		}
+		out += output.Value
+	}
+	if out > in {
+		return 0, fmt.Errorf("outputs %d exceed inputs %d", out, in)
+	}
+	return in - out, nil
+}
+
+// checkMempoolTx checks a transaction entering the mempool against the
+// main chain and the mempool: it must not be a coinbase or already known,
+// must be final in the next block, and must spend outputs that are unspent
+// on the main chain or created by mempool transactions, and not spent by
+// another mempool transaction, as checkTxInputs. The caller must hold
+// bc.mu.
+func (bc *Blockchain) checkMempoolTx(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return errors.New("coinbase transactions are only valid in blocks")
+	}
+	if tx.Hash != tx.CalculateHash() {
+		return errors.New("transaction hash mismatch")
+	}
+	if bc.mempoolTx(tx.Hash) != nil {
+		return ErrAlreadyInMempool
+	}
+	if !tx.IsFinal(len(bc.blocks), bc.timeSource.AdjustedTime().Unix()) {
+		return errors.New("transaction is not final")
+	}
+
+	for _, input := range tx.Inputs {
+		if spender := bc.mempoolSpends[outpoint{input.PrevTxHash, input.PrevTxIndex}]; spender != nil {
+			return fmt.Errorf("%w: output %x:%d already spent by %x", ErrMempoolConflict, input.PrevTxHash, input.PrevTxIndex, spender.Hash)
+		}
+	}
+	created := make(map[outpoint]TxOutput)
+	for _, mtx := range bc.mempool {
+		for j, output := range mtx.Outputs {
+			created[outpoint{mtx.Hash, uint32(j)}] = output
+		}
+	}
+
+	_, err := checkTxInputs(tx, func(op outpoint) (TxOutput, bool) {
+		if out, ok := created[op]; ok {
+			return out, true
+		}
+		utxo, ok := bc.utxos.get(op)
+		if !ok {
+			return TxOutput{}, false
+		}
+		return utxo.Output, true
+	}, true)
+	return err
+}
+
+// SpotCheck re-validates up to samples randomly chosen blocks of the main
+// chain: header hash, link to the parent, proof of work, transaction
+// hashes and merkle root. It returns the number of blocks checked and the
+// first inconsistency found.
+func (bc *Blockchain) SpotCheck(samples int) (int, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	heights := rand.Perm(len(bc.blocks))
+	if samples < len(heights) {
+		heights = heights[:samples]
+	}
+	for _, height := range heights {
+		block := bc.blocks[height]
+		if block.Hash != block.CalculateHash() {
+			return 0, fmt.Errorf("block %d: hash mismatch", height)
+		}
+		for i := range block.Transactions {
+			tx := &block.Transactions[i]
+			if tx.Hash != tx.CalculateHash() {
+				return 0, fmt.Errorf("block %d: transaction %d hash mismatch", height, i)
+			}
+		}
+		if block.MerkleRoot != block.CalculateMerkleRoot() {
+			return 0, fmt.Errorf("block %d: merkle root mismatch", height)
+		}
+		if height == 0 {
+			continue
+		}
+		if block.PrevHash != bc.blocks[height-1].Hash {
+			return 0, fmt.Errorf("block %d: does not link to block %d", height, height-1)
+		}
+		if !block.ValidatePoW() {
+			return 0, fmt.Errorf("block %d: invalid proof of work", height)
+		}
+	}
+	return len(heights), nil
+}
+
+// NewBlockTemplate builds a candidate block on the current tip paying the
+// subsidy and fees to coinbaseScript. Mempool transactions that no longer
+// fit on the tip are left out. The template has no proof of work; it has
+// passed TestBlockValidity.
+func (bc *Blockchain) NewBlockTemplate(coinbaseScript []byte) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.newBlockTemplate(coinbaseScript, bc.mempool, false)
+}
+
+// newBlockTemplate builds a block on the tip from candidate transactions.
+// Unless strict, the candidates are picked by fee rate up to the policy's
+// block size, capped at the chain's limit, and those that don't fit on the
+// tip or aren't final yet are left out; strict templates hold every
+// candidate in order, or fail. The caller must hold bc.mu.
+func (bc *Blockchain) newBlockTemplate(coinbaseScript []byte, candidates []*Transaction, strict bool) (*Block, error) {
+	tip := bc.blocks[len(bc.blocks)-1]
+	block := NewBlock(1, tip.Hash, bc.requiredDifficulty())
+	block.Timestamp = bc.nextBlockTime()
+	block.Transactions = append(block.Transactions, Transaction{})
+
+	var fees uint64
+	final := make([]*Transaction, 0, len(candidates))
+	for _, tx := range candidates {
+		if tx.IsFinal(len(bc.blocks), block.Timestamp) {
+			final = append(final, tx)
+		} else if strict {
+			return nil, fmt.Errorf("transaction %x is not final", tx.Hash)
+		}
+	}
+	candidates = final
+	if !strict {
+		// The coinbase is sized for every candidate's fee, as its outputs
+		// can only shrink with fewer
+		var allFees uint64
+		for _, candidate := range prioritizeTransactions(candidates, bc.utxos) {
+			allFees += candidate.fee
+		}
+		coinbase := bc.newCoinbase(len(bc.blocks), allFees, coinbaseScript)
+		maxSize := bc.policy.BlockMaxSize
+		if limit := bc.params.BlockSizeLimit(); maxSize > limit {
+			maxSize = limit
+		}
+		maxSize -= headerSize + len(coinbase.Encode())
+		var selected []*Transaction
+		selected, fees = selectTransactions(candidates, bc.utxos, maxSize)
+		for _, tx := range selected {
+			block.Transactions = append(block.Transactions, *tx)
+		}
+	} else {
+		spends := newBlockSpends(bc.utxos)
+		for _, tx := range candidates {
+			fee, err := checkTxInputs(tx, spends.prevOutput, true)
+			if err != nil || tx.IsCoinbase() {
+				return nil, fmt.Errorf("transaction %x does not fit on the tip", tx.Hash)
+			}
+			spends.apply(tx)
+			fees += fee
+			block.Transactions = append(block.Transactions, *tx)
+		}
+	}
+
+	block.Transactions[0] = *bc.newCoinbase(len(bc.blocks), fees, coinbaseScript)
+	block.MerkleRoot = block.CalculateMerkleRoot()
+
+	if err := bc.checkBlockValidity(block); err != nil {
+		return nil, fmt.Errorf("block template failed validation: %v", err)
+	}
+	return block, nil
+}
@@ -0,0 +1,325 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// newTestChain returns a chain at the minimum difficulty so mining is fast
+func newTestChain() *Blockchain {
+	params := MainNetParams
+	params.Consensus.InitialDifficulty = params.Consensus.MinimumDifficulty
+	return NewBlockchainWithParams(&params)
+}
+
+func TestNewBlockTemplateIsValid(t *testing.T) {
+	bc := newTestChain()
+	block, err := bc.NewBlockTemplate([]byte("pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.Transactions[0].IsCoinbase() {
+		t.Fatal("template does not start with a coinbase")
+	}
+	if got, want := block.Transactions[0].Outputs[0].Value, uint64(bc.params.BlockSubsidy(1)); got != want {
+		t.Errorf("coinbase value = %d, want %d", got, want)
+	}
+	if err := bc.TestBlockValidity(block); err != nil {
+		t.Errorf("template rejected: %v", err)
+	}
+}
+
+func TestBlockValidityRejectsInvalid(t *testing.T) {
+	bc := newTestChain()
+
+	tests := []struct {
+		name   string
+		modify func(b *Block)
+	}{
+		{"stale tip", func(b *Block) { b.PrevHash = [32]byte{1} }},
+		{"low difficulty", func(b *Block) { b.Bits = DifficultyToCompact(big.NewInt(1)) }},
+		{"no coinbase", func(b *Block) { b.Transactions = nil }},
+		{"merkle root", func(b *Block) { b.MerkleRoot = [32]byte{1} }},
+		{"excess coinbase", func(b *Block) {
+			b.Transactions[0] = *CreateCoinbase(uint64(bc.params.BlockSubsidy(1))+1, []byte("pool"))
+			b.MerkleRoot = b.CalculateMerkleRoot()
+		}},
+		{"second coinbase", func(b *Block) {
+			b.Transactions = append(b.Transactions, *CreateCoinbase(0, []byte("pool")))
+			b.MerkleRoot = b.CalculateMerkleRoot()
+		}},
+		{"missing input", func(b *Block) {
+			tx := NewTransaction(
+				[]TxInput{{PrevTxHash: [32]byte{9}, Sequence: 0xFFFFFFFF}},
+				[]TxOutput{{Value: 1, Script: []byte("addr")}},
+			)
+			b.Transactions = append(b.Transactions, *tx)
+			b.MerkleRoot = b.CalculateMerkleRoot()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := bc.NewBlockTemplate([]byte("pool"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(block)
+			if err := bc.TestBlockValidity(block); err == nil {
+				t.Error("expected the block to be rejected")
+			}
+		})
+	}
+}
+
+func TestNewBlockTemplateSkipsUnspendable(t *testing.T) {
+	bc := newTestChain()
+
+	// A mempool transaction spending an unknown output can't be mined
+	bc.addToMempool(NewTransaction(
+		[]TxInput{{PrevTxHash: [32]byte{9}, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 1, Script: []byte("addr")}},
+	))
+
+	block, err := bc.NewBlockTemplate([]byte("pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 1 {
+		t.Errorf("template has %d transactions, want only the coinbase", len(block.Transactions))
+	}
+}
+
+func TestSpotCheck(t *testing.T) {
+	bc := newTestChain()
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checked, err := bc.SpotCheck(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 4 {
+		t.Errorf("checked %d blocks, want 4", checked)
+	}
+
+	bc.blocks[2].MerkleRoot[0] ^= 1
+	if _, err := bc.SpotCheck(10); err == nil {
+		t.Error("corrupted block passed the spot check")
+	}
+}
+
+// newTestKey returns a wallet key and the output script paying it
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, elliptic.Marshal(key.Curve, key.X, key.Y)
+}
+
+func TestAddTransactionValidatesInputs(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	key, script := newTestKey(t)
+	other, _ := newTestKey(t)
+	funding, err := bc.GenerateBlock(script, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+	value := coinbase.Outputs[0].Value
+
+	spend := func(prev Hash, value uint64, signer *ecdsa.PrivateKey) *Transaction {
+		tx := NewTransaction(
+			[]TxInput{{PrevTxHash: prev, Sequence: 0xFFFFFFFF}},
+			[]TxOutput{{Value: value, Script: []byte("payee")}},
+		)
+		if signer != nil {
+			if err := tx.Sign(signer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return tx
+	}
+	rejected := []struct {
+		name string
+		tx   *Transaction
+	}{
+		{"unsigned", spend(coinbase.Hash, value-10000, nil)},
+		{"wrong key", spend(coinbase.Hash, value-10000, other)},
+		{"creates value", spend(coinbase.Hash, value+1, key)},
+		{"missing input", spend(Hash{9}, 1000, key)},
+		{"coinbase", CreateCoinbase(1000, []byte("payee"))},
+	}
+	for _, tt := range rejected {
+		if err := bc.AddTransaction(tt.tx); err == nil {
+			t.Errorf("%s transaction accepted", tt.name)
+		}
+	}
+
+	valid := spend(coinbase.Hash, value-10000, key)
+	if err := bc.AddTransaction(valid); err != nil {
+		t.Fatalf("signed transaction rejected: %v", err)
+	}
+	if err := bc.AddTransaction(valid); err != ErrAlreadyInMempool {
+		t.Errorf("resubmitted transaction: err = %v, want ErrAlreadyInMempool", err)
+	}
+	if err := bc.AddTransaction(spend(coinbase.Hash, value-20000, key)); err == nil {
+		t.Error("transaction conflicting with the mempool accepted")
+	}
+	// Outputs of mempool transactions can be spent; "payee" is no key
+	if err := bc.AddTransaction(spend(valid.Hash, value-20000, nil)); err != nil {
+		t.Errorf("child of a mempool transaction rejected: %v", err)
+	}
+	if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil || bc.MempoolSize() != 0 {
+		t.Errorf("mempool not mined: err = %v, %d left", err, bc.MempoolSize())
+	}
+}
+
+func TestReorgChecksBranchTransactions(t *testing.T) {
+	bc := newTestChain()
+	genesis := bc.GetLatestBlock()
+	a1 := mineTestBlock(bc, genesis, "a1")
+	if err := bc.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+
+	// b2 spends a1's coinbase, which doesn't exist on the b branch
+	b1 := mineTestBlock(bc, genesis, "b1")
+	b2 := NewBlock(1, b1.Hash, bc.requiredDifficulty())
+	b2.Timestamp = b1.Timestamp + 60
+	spend := NewTransaction(
+		[]TxInput{{PrevTxHash: a1.Transactions[0].Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 1, Script: []byte("thief")}},
+	)
+	b2.Transactions = []Transaction{*CreateCoinbase(uint64(bc.params.BlockSubsidy(2)), []byte("b2")), *spend}
+	b2.MerkleRoot = b2.CalculateMerkleRoot()
+	b2.Mine()
+
+	if err := bc.ProcessBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ProcessBlock(b2); err == nil {
+		t.Fatal("branch spending outputs of the replaced chain accepted")
+	}
+	if tip := bc.GetLatestBlock(); tip.Hash != a1.Hash {
+		t.Errorf("tip = %x, want a1", tip.Hash)
+	}
+	if !bc.IsInvalid(b2.Hash) || bc.IsInvalid(b1.Hash) {
+		t.Error("only the failing block should be marked invalid")
+	}
+	if !bc.IsUnspent(a1.Transactions[0].Hash, 0) {
+		t.Error("UTXO set changed by the rejected branch")
+	}
+}
+
+func TestNewBlockTemplatePrioritizesFees(t *testing.T) {
+	bc := NewBlockchainWithParams(&RegTestParams)
+	funding, err := bc.GenerateBlock([]byte("funds"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+	// "funds" and "payee" are no keys, so the spends need no signatures
+	split := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 100000, Script: []byte("funds")}, {Value: 100000, Script: []byte("funds")}},
+	)
+	bc.addToMempool(split)
+	if _, err := bc.GenerateBlock([]byte("miner"), [][32]byte{split.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	spend := func(prev Hash, index uint32, value uint64) *Transaction {
+		return NewTransaction(
+			[]TxInput{{PrevTxHash: prev, PrevTxIndex: index, Sequence: 0xFFFFFFFF}},
+			[]TxOutput{{Value: value, Script: []byte("payee")}},
+		)
+	}
+	low := spend(split.Hash, 0, 99000)
+	high := spend(split.Hash, 1, 90000)
+	child := spend(low.Hash, 0, 80000) // Pays more than its parent
+	bc.addToMempool(low, high, child)
+
+	block, err := bc.NewBlockTemplate([]byte("miner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []Hash
+	for _, tx := range block.Transactions[1:] {
+		order = append(order, tx.Hash)
+	}
+	if want := []Hash{high.Hash, low.Hash, child.Hash}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("template order = %x, want high, low, child", order)
+	}
+	if got, want := block.Transactions[0].Outputs[0].Value, uint64(bc.params.BlockSubsidy(3))+1000+10000+19000; got != want {
+		t.Errorf("coinbase value = %d, want %d", got, want)
+	}
+
+	// With room for one transaction only the highest fee rate is mined
+	bc.policy.BlockMaxSize = block.Size() - len(low.Encode()) - len(child.Encode())
+	block, err = bc.NewBlockTemplate([]byte("miner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].Hash != high.Hash {
+		t.Errorf("size-limited template has %d transactions, want the coinbase and high", len(block.Transactions))
+	}
+	if block.Size() > bc.policy.BlockMaxSize {
+		t.Errorf("template size %d exceeds %d", block.Size(), bc.policy.BlockMaxSize)
+	}
+}
+
+func TestMaxBlockSize(t *testing.T) {
+	params := RegTestParams
+	bc := NewBlockchainWithParams(&params)
+	funding, err := bc.GenerateBlock([]byte("funds"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := funding.Transactions[0]
+	split := NewTransaction(
+		[]TxInput{{PrevTxHash: coinbase.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 100000, Script: []byte("funds")}, {Value: 100000, Script: []byte("funds")}},
+	)
+	bc.addToMempool(split)
+	if _, err := bc.GenerateBlock([]byte("miner"), [][32]byte{split.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	high := NewTransaction(
+		[]TxInput{{PrevTxHash: split.Hash, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 90000, Script: []byte("payee")}},
+	)
+	low := NewTransaction(
+		[]TxInput{{PrevTxHash: split.Hash, PrevTxIndex: 1, Sequence: 0xFFFFFFFF}},
+		[]TxOutput{{Value: 99000, Script: []byte("payee")}},
+	)
+	bc.addToMempool(high, low)
+
+	full, err := bc.NewBlockTemplate([]byte("miner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Transactions) != 3 {
+		t.Fatalf("template has %d transactions, want 3", len(full.Transactions))
+	}
+
+	// The consensus limit caps templates below the policy's block size
+	params.MaxBlockSize = full.Size() - 1
+	block, err := bc.NewBlockTemplate([]byte("miner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].Hash != high.Hash {
+		t.Errorf("size-limited template has %d transactions, want the coinbase and high", len(block.Transactions))
+	}
+	if err := bc.TestBlockValidity(full); err == nil {
+		t.Error("block over the size limit accepted")
+	}
+}
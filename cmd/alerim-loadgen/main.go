@@ -0,0 +1,118 @@
+// Command alerim-loadgen simulates stratum miners against a pool to
+// measure share acceptance latency and reject rates, e.g. before and after
+// a pool performance change.
+//
+// Workers are named <worker>.<n>; the pool must know them for honest
+// shares to be accepted.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+var (
+	poolAddr  = flag.String("pool", "localhost:3333", "Stratum address of the pool")
+	miners    = flag.Int("miners", 10, "Number of simulated miners")
+	hashrate  = flag.Float64("hashrate", 10000, "Hashes per second of each miner")
+	spread    = flag.Float64("spread", 0, "Random spread of miner hashrates, as a fraction of -hashrate (0 to 1)")
+	worker    = flag.String("worker", "loadgen", "Worker name prefix")
+	version   = flag.Uint("version", 1, "Block version of the pool's jobs")
+	duration  = flag.Duration("duration", time.Minute, "How long to run")
+	ramp      = flag.Duration("ramp", 0, "Period over which miners connect, evenly spaced")
+	interval  = flag.Duration("interval", 10*time.Second, "How often to print intermediate results (0 for only at the end)")
+	reconnect = flag.Bool("reconnect", false, "Reconnect miners the pool disconnects")
+	seed      = flag.Int64("seed", 0, "Random seed (default: time-based)")
+
+	stale     = flag.Float64("stale", 0, "Fraction of shares submitted for the previous job")
+	duplicate = flag.Float64("duplicate", 0, "Fraction of shares replaced by a resubmitted earlier share")
+	badHash   = flag.Float64("badhash", 0, "Fraction of shares with a hash not matching the nonce")
+	lowDiff   = flag.Float64("lowdiff", 0, "Fraction of shares above the share target")
+	malformed = flag.Float64("malformed", 0, "Fraction of shares with an unparsable nonce")
+)
+
+func main() {
+	flag.Parse()
+
+	behavior := Behavior{Stale: *stale, Duplicate: *duplicate, BadHash: *badHash, LowDiff: *lowDiff, Malformed: *malformed}
+	if total := behavior.Stale + behavior.Duplicate + behavior.BadHash + behavior.LowDiff + behavior.Malformed; total > 1 {
+		log.Fatalf("Misbehavior fractions add up to %.2f, more than 1", total)
+	}
+	if *miners <= 0 || *hashrate <= 0 || *spread < 0 || *spread > 1 {
+		log.Fatal("-miners and -hashrate must be positive and -spread between 0 and 1")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	stats := NewStats()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < *miners; i++ {
+		rate := *hashrate * (1 + *spread*(2*rng.Float64()-1))
+		miner := NewMiner(fmt.Sprintf("%s.%d", *worker, i), rate, behavior, uint32(*version), stats, rng.Int63())
+		delay := time.Duration(0)
+		if *miners > 1 {
+			delay = *ramp * time.Duration(i) / time.Duration(*miners)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-time.After(delay):
+			case <-stop:
+				return
+			}
+			for {
+				err := miner.Run(*poolAddr, stop)
+				if err == nil || !*reconnect {
+					if err != nil {
+						log.Printf("Miner %s: %v", miner.worker, err)
+					}
+					return
+				}
+				select {
+				case <-time.After(time.Second):
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	log.Printf("Started %d miners against %s (seed %d)", *miners, *poolAddr, *seed)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	deadline := time.After(*duration)
+	var tick <-chan time.Time
+	if *interval > 0 {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+run:
+	for {
+		select {
+		case <-tick:
+			stats.Report(os.Stdout)
+			fmt.Println()
+		case <-deadline:
+			break run
+		case <-interrupt:
+			break run
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+	stats.Report(os.Stdout)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// hashTick is how often a simulated miner does a batch of hashing
+const hashTick = 100 * time.Millisecond
+
+// lowDiffTries bounds the search for a hash missing the share target
+const lowDiffTries = 1000
+
+// Behavior is the share mix of a simulated miner: the probability of each
+// misbehavior for every share found. Shares not picked for a misbehavior
+// are submitted honestly.
+type Behavior struct {
+	Stale     float64
+	Duplicate float64
+	BadHash   float64
+	LowDiff   float64
+	Malformed float64
+}
+
+// pick chooses the kind of the next share given a uniform random r in [0,1)
+func (b Behavior) pick(r float64) shareKind {
+	for _, choice := range []struct {
+		p    float64
+		kind shareKind
+	}{
+		{b.Stale, shareStale},
+		{b.Duplicate, shareDuplicate},
+		{b.BadHash, shareBadHash},
+		{b.LowDiff, shareLowDiff},
+		{b.Malformed, shareMalformed},
+	} {
+		if r < choice.p {
+			return choice.kind
+		}
+		r -= choice.p
+	}
+	return shareHonest
+}
+
+// stratumMessage is any message from the pool: a response to a request, or
+// a notification when Method is set
+type stratumMessage struct {
+	ID     interface{}   `json:"id"`
+	Result interface{}   `json:"result"`
+	Error  []interface{} `json:"error"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// job is the work a miner hashes on
+type job struct {
+	id     string
+	header blockchain.Block // Header fields only
+}
+
+// pendingShare is a share waiting for the pool's response
+type pendingShare struct {
+	kind shareKind
+	sent time.Time
+}
+
+// Miner is one simulated stratum miner
+type Miner struct {
+	worker   string
+	hashrate float64 // Hashes per second
+	behavior Behavior
+	version  uint32 // Block version the pool's jobs use
+	stats    *Stats
+	rand     *rand.Rand
+
+	conn    net.Conn
+	encoder *json.Encoder
+	nonce   uint32 // Next nonce to try, only used by the hashing loop
+
+	mu       sync.Mutex // Guards writes and the fields below
+	nextID   int
+	pending  map[int]pendingShare
+	job      *job
+	previous *job          // For stale shares
+	target   *big.Int      // Share target
+	last     []interface{} // Params of the last honest share, for duplicates
+}
+
+// NewMiner creates a simulated miner
+func NewMiner(worker string, hashrate float64, behavior Behavior, version uint32, stats *Stats, seed int64) *Miner {
+	return &Miner{
+		worker:   worker,
+		hashrate: hashrate,
+		behavior: behavior,
+		version:  version,
+		stats:    stats,
+		rand:     rand.New(rand.NewSource(seed)),
+		pending:  make(map[int]pendingShare),
+	}
+}
+
+// Run connects to the pool and mines until stop is closed or the pool
+// drops the connection
+func (m *Miner) Run(addr string, stop <-chan struct{}) error {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	m.stats.Connected(err)
+	if err != nil {
+		return err
+	}
+	m.conn = conn
+	m.encoder = json.NewEncoder(conn)
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- m.readLoop() }()
+
+	if err := m.send("mining.subscribe", []interface{}{"alerim-loadgen/1.0"}); err != nil {
+		return err
+	}
+	if err := m.send("mining.authorize", []interface{}{m.worker, "x"}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(hashTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-done:
+			m.stats.Disconnected()
+			return err
+		case <-ticker.C:
+			m.hash(int(m.hashrate * hashTick.Seconds()))
+		}
+	}
+}
+
+// send writes a request
+func (m *Miner) send(method string, params []interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.sendLocked(method, params)
+	return err
+}
+
+// sendLocked writes a request and returns its ID; the caller must hold m.mu
+func (m *Miner) sendLocked(method string, params []interface{}) (int, error) {
+	m.nextID++
+	return m.nextID, m.encoder.Encode(map[string]interface{}{"id": m.nextID, "method": method, "params": params})
+}
+
+// readLoop handles messages from the pool until the connection closes
+func (m *Miner) readLoop() error {
+	reader := bufio.NewReader(m.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		var msg stratumMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("invalid message from pool: %v", err)
+		}
+		m.handleMessage(&msg, time.Now())
+	}
+}
+
+// handleMessage applies a notification or matches a response to its share
+func (m *Miner) handleMessage(msg *stratumMessage, now time.Time) {
+	switch msg.Method {
+	case "mining.notify":
+		if j, err := parseJob(msg.Params, m.version); err == nil {
+			m.mu.Lock()
+			m.previous, m.job = m.job, j
+			m.mu.Unlock()
+			m.stats.Job()
+		}
+		return
+	case "mining.set_difficulty":
+		if len(msg.Params) > 0 {
+			if s, ok := msg.Params[0].(string); ok {
+				if difficulty, ok := new(big.Int).SetString(s, 16); ok && difficulty.Sign() > 0 {
+					m.mu.Lock()
+					m.target = blockchain.DifficultyToTarget(difficulty)
+					m.mu.Unlock()
+				}
+			}
+		}
+		return
+	case "":
+		// A response
+	default:
+		return
+	}
+
+	id, ok := msg.ID.(float64)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	share, ok := m.pending[int(id)]
+	delete(m.pending, int(id))
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	accepted := msg.Result == true && msg.Error == nil
+	code := 0
+	if len(msg.Error) > 0 {
+		if c, ok := msg.Error[0].(float64); ok {
+			code = int(c)
+		}
+	}
+	m.stats.Result(share.kind, accepted, code, now.Sub(share.sent))
+}
+
+// parseJob parses the mining.notify parameters: job ID, previous block
+// hash, merkle root, timestamp and compact bits
+func parseJob(params []interface{}, version uint32) (*job, error) {
+	if len(params) < 5 {
+		return nil, fmt.Errorf("job has %d parameters, want 5", len(params))
+	}
+	fields := make([]string, 5)
+	for i := range fields {
+		s, ok := params[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("job parameter %d is not a string", i+1)
+		}
+		fields[i] = s
+	}
+
+	j := &job{id: fields[0], header: blockchain.Block{Version: version}}
+	for i, dst := range []*blockchain.Hash{&j.header.PrevHash, &j.header.MerkleRoot} {
+		b, err := hex.DecodeString(fields[1+i])
+		if err != nil || len(b) != len(dst) {
+			return nil, fmt.Errorf("invalid hash %q", fields[1+i])
+		}
+		copy(dst[:], b)
+	}
+	timestamp, err := strconv.ParseInt(fields[3], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	bits, err := strconv.ParseUint(fields[4], 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bits: %v", err)
+	}
+	j.header.Timestamp = timestamp
+	j.header.Bits = uint32(bits)
+	return j, nil
+}
+
+// hash tries n nonces on the current job and submits the shares found
+func (m *Miner) hash(n int) {
+	m.mu.Lock()
+	j, target := m.job, m.target
+	m.mu.Unlock()
+	if j == nil || target == nil {
+		return
+	}
+
+	header := j.header
+	for i := 0; i < n; i++ {
+		header.Nonce = m.nonce
+		m.nonce++
+		hash := header.CalculateHash()
+		if blockchain.HashMeetsTarget(hash, target) {
+			m.submit(j, header.Nonce, hash, target)
+		}
+	}
+}
+
+// submit sends a share found on j, misbehaving as the miner's behavior
+// dictates
+func (m *Miner) submit(j *job, nonce uint32, hash [32]byte, target *big.Int) {
+	kind := m.behavior.pick(m.rand.Float64())
+	jobID, nonceHex := j.id, fmt.Sprintf("%x", nonce)
+
+	switch kind {
+	case shareStale:
+		m.mu.Lock()
+		previous := m.previous
+		m.mu.Unlock()
+		if previous == nil {
+			kind = shareHonest
+			break
+		}
+		header := previous.header
+		header.Nonce = nonce
+		jobID, hash = previous.id, header.CalculateHash()
+	case shareDuplicate:
+		m.mu.Lock()
+		last := m.last
+		m.mu.Unlock()
+		if last == nil {
+			kind = shareHonest
+			break
+		}
+		m.track(kind, last)
+		return
+	case shareBadHash:
+		hash[m.rand.Intn(len(hash))] ^= 0xff
+	case shareLowDiff:
+		// Find a nonce whose hash misses the target; almost any will do
+		// unless the share difficulty is trivial
+		kind = shareHonest
+		header := j.header
+		for header.Nonce = nonce + 1; header.Nonce <= nonce+lowDiffTries; header.Nonce++ {
+			if h := header.CalculateHash(); !blockchain.HashMeetsTarget(h, target) {
+				kind, nonceHex, hash = shareLowDiff, fmt.Sprintf("%x", header.Nonce), h
+				break
+			}
+		}
+	case shareMalformed:
+		nonceHex = "not-a-nonce"
+	}
+
+	params := []interface{}{m.worker, jobID, nonceHex, fmt.Sprintf("%x", hash)}
+	if kind == shareHonest {
+		m.mu.Lock()
+		m.last = params
+		m.mu.Unlock()
+	}
+	m.track(kind, params)
+}
+
+// track sends a share and keeps it pending until the pool responds
+func (m *Miner) track(kind shareKind, params []interface{}) {
+	m.mu.Lock()
+	id, err := m.sendLocked("mining.submit", params)
+	if err == nil {
+		m.pending[id] = pendingShare{kind: kind, sent: time.Now()}
+	}
+	m.mu.Unlock()
+	if err == nil {
+		m.stats.Submitted(kind)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestBehaviorPick(t *testing.T) {
+	b := Behavior{Stale: 0.1, Duplicate: 0.2, Malformed: 0.1}
+	tests := []struct {
+		r    float64
+		want shareKind
+	}{
+		{0, shareStale},
+		{0.05, shareStale},
+		{0.15, shareDuplicate},
+		{0.35, shareMalformed},
+		{0.4, shareHonest},
+		{0.99, shareHonest},
+	}
+	for _, tt := range tests {
+		if got := b.pick(tt.r); got != tt.want {
+			t.Errorf("pick(%v) = %s, want %s", tt.r, got, tt.want)
+		}
+	}
+}
+
+// fakePool serves one stratum connection the way the pool does, checking
+// shares against two jobs at share difficulty 2
+func fakePool(t *testing.T, listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	target := blockchain.DifficultyToTarget(big.NewInt(2))
+	jobs := map[string]*blockchain.Block{}
+	current := ""
+	seen := map[string]bool{}
+	notify := func(id string) {
+		block := &blockchain.Block{Version: 1, Timestamp: time.Now().Unix(), PrevHash: [32]byte{byte(len(jobs))}, Bits: 0x1f00ffff}
+		jobs[id], current = block, id
+		encoder.Encode(map[string]interface{}{"method": "mining.notify", "params": []interface{}{
+			id, fmt.Sprintf("%x", block.PrevHash), fmt.Sprintf("%x", block.MerkleRoot), fmt.Sprintf("%x", block.Timestamp), fmt.Sprintf("%08x", block.Bits),
+		}})
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req struct {
+			ID     interface{}   `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		switch req.Method {
+		case "mining.subscribe":
+			encoder.Encode(map[string]interface{}{"id": req.ID, "result": []interface{}{"sub", "fake"}})
+		case "mining.authorize":
+			encoder.Encode(map[string]interface{}{"id": req.ID, "result": true})
+			encoder.Encode(map[string]interface{}{"id": req.ID, "method": "mining.set_difficulty", "params": []interface{}{"2"}})
+			notify("1")
+			notify("2")
+		case "mining.submit":
+			reject := func(code int) {
+				encoder.Encode(map[string]interface{}{"id": req.ID, "error": []interface{}{code, "rejected", nil}})
+			}
+			jobID, nonceHex, hashHex := req.Params[1].(string), req.Params[2].(string), req.Params[3].(string)
+			nonce, err := strconv.ParseUint(nonceHex, 16, 32)
+			if err != nil {
+				reject(20)
+				continue
+			}
+			if jobID != current {
+				reject(21)
+				continue
+			}
+			header := *jobs[jobID]
+			header.Nonce = uint32(nonce)
+			hash := header.CalculateHash()
+			if hex.EncodeToString(hash[:]) != hashHex {
+				reject(20)
+				continue
+			}
+			if seen[hashHex] {
+				reject(22)
+				continue
+			}
+			if !blockchain.HashMeetsTarget(hash, target) {
+				reject(23)
+				continue
+			}
+			seen[hashHex] = true
+			encoder.Encode(map[string]interface{}{"id": req.ID, "result": true})
+		}
+	}
+}
+
+func TestMinerAgainstPool(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go fakePool(t, listener)
+
+	stats := NewStats()
+	behavior := Behavior{Stale: 0.1, Duplicate: 0.1, BadHash: 0.1, LowDiff: 0.1, Malformed: 0.1}
+	miner := NewMiner("loadgen.0", 2000, behavior, 1, stats, 1)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- miner.Run(listener.Addr().String(), stop) }()
+	time.Sleep(500 * time.Millisecond)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// Let the last responses arrive
+	time.Sleep(50 * time.Millisecond)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	wantCodes := map[shareKind]int{shareStale: 21, shareDuplicate: 22, shareBadHash: 20, shareLowDiff: 23, shareMalformed: 20}
+	for _, kind := range shareKinds {
+		k := stats.kinds[kind]
+		if k.submitted == 0 {
+			t.Errorf("no %s shares submitted", kind)
+			continue
+		}
+		if kind == shareHonest {
+			if k.rejected > 0 {
+				t.Errorf("%d honest shares rejected: %v", k.rejected, k.rejects)
+			}
+			continue
+		}
+		if k.accepted > 0 || len(k.rejects) != 1 || k.rejects[wantCodes[kind]] != k.rejected {
+			t.Errorf("%s shares: %d accepted, rejects %v", kind, k.accepted, k.rejects)
+		}
+	}
+	if stats.jobs != 2 || len(stats.latencies) == 0 {
+		t.Errorf("%d jobs, %d responses", stats.jobs, len(stats.latencies))
+	}
+}
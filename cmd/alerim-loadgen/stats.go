@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// shareKind is how a simulated miner built a share
+type shareKind string
+
+// Share kinds. Honest shares should be accepted and every other kind
+// rejected.
+const (
+	shareHonest    shareKind = "honest"
+	shareStale     shareKind = "stale"     // Submitted for the previous job
+	shareDuplicate shareKind = "duplicate" // Resubmits an earlier share
+	shareBadHash   shareKind = "bad-hash"  // Hash doesn't match the nonce
+	shareLowDiff   shareKind = "low-diff"  // Hash above the share target
+	shareMalformed shareKind = "malformed" // Unparsable nonce
+)
+
+// shareKinds lists every share kind in report order
+var shareKinds = []shareKind{shareHonest, shareStale, shareDuplicate, shareBadHash, shareLowDiff, shareMalformed}
+
+// kindStats counts the results of one kind of share
+type kindStats struct {
+	submitted int
+	accepted  int
+	rejected  int
+	rejects   map[int]int // Stratum error code -> count
+}
+
+// Stats aggregates the results of every simulated miner
+type Stats struct {
+	mu            sync.Mutex
+	started       time.Time
+	connected     int
+	connectErrors int
+	disconnects   int
+	jobs          int
+	kinds         map[shareKind]*kindStats
+	latencies     []time.Duration // Submit to response, every share
+}
+
+// NewStats creates empty statistics starting now
+func NewStats() *Stats {
+	kinds := make(map[shareKind]*kindStats, len(shareKinds))
+	for _, kind := range shareKinds {
+		kinds[kind] = &kindStats{rejects: make(map[int]int)}
+	}
+	return &Stats{started: time.Now(), kinds: kinds}
+}
+
+// Connected records a miner connecting, or failing to
+func (s *Stats) Connected(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.connectErrors++
+		return
+	}
+	s.connected++
+}
+
+// Disconnected records the pool dropping a miner
+func (s *Stats) Disconnected() {
+	s.mu.Lock()
+	s.disconnects++
+	s.mu.Unlock()
+}
+
+// Job records a job notification
+func (s *Stats) Job() {
+	s.mu.Lock()
+	s.jobs++
+	s.mu.Unlock()
+}
+
+// Submitted records a share being sent
+func (s *Stats) Submitted(kind shareKind) {
+	s.mu.Lock()
+	s.kinds[kind].submitted++
+	s.mu.Unlock()
+}
+
+// Result records the pool's response to a share. code is the stratum
+// error code of a reject, ignored when the share was accepted.
+func (s *Stats) Result(kind shareKind, accepted bool, code int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := s.kinds[kind]
+	if accepted {
+		k.accepted++
+	} else {
+		k.rejected++
+		k.rejects[code]++
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// percentile returns the p-th percentile (0-100) of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+// Report writes a summary of the run so far
+func (s *Stats) Report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.started)
+	fmt.Fprintf(w, "Elapsed %v: %d connected, %d connect errors, %d disconnects, %d jobs\n",
+		elapsed.Round(time.Second), s.connected, s.connectErrors, s.disconnects, s.jobs)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tSUBMITTED\tACCEPTED\tREJECTED\tREJECT RATE\tREJECT CODES")
+	var unexpected int
+	for _, kind := range shareKinds {
+		k := s.kinds[kind]
+		if k.submitted == 0 {
+			continue
+		}
+		rate := 0.0
+		if answered := k.accepted + k.rejected; answered > 0 {
+			rate = float64(k.rejected) / float64(answered) * 100
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\t%s\n", kind, k.submitted, k.accepted, k.rejected, rate, formatCodes(k.rejects))
+		if kind == shareHonest {
+			unexpected += k.rejected
+		} else {
+			unexpected += k.accepted
+		}
+	}
+	tw.Flush()
+
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted) > 0 {
+		fmt.Fprintf(w, "Latency: p50 %v, p90 %v, p99 %v, max %v over %d responses (%.1f/s)\n",
+			percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), sorted[len(sorted)-1],
+			len(sorted), float64(len(sorted))/elapsed.Seconds())
+	}
+	if unexpected > 0 {
+		fmt.Fprintf(w, "WARNING: %d honest shares rejected or bad shares accepted\n", unexpected)
+	}
+}
+
+// formatCodes formats reject counts by stratum error code
+func formatCodes(rejects map[int]int) string {
+	codes := make([]int, 0, len(rejects))
+	for code := range rejects {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	out := ""
+	for i, code := range codes {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%d:%d", code, rejects[code])
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of nothing = %v", got)
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	stats := NewStats()
+	stats.Submitted(shareHonest)
+	stats.Result(shareHonest, true, 0, time.Millisecond)
+	stats.Submitted(shareStale)
+	stats.Result(shareStale, false, 21, 2*time.Millisecond)
+
+	var out bytes.Buffer
+	stats.Report(&out)
+	if !strings.Contains(out.String(), "21:1") || strings.Contains(out.String(), "WARNING") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	// A misbehaving share the pool accepted is flagged
+	stats.Submitted(shareDuplicate)
+	stats.Result(shareDuplicate, true, 0, time.Millisecond)
+	out.Reset()
+	stats.Report(&out)
+	if !strings.Contains(out.String(), "WARNING: 1") {
+		t.Errorf("accepted duplicate not flagged:\n%s", out.String())
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// A wallet restored from a seed is found by account discovery, as BIP 44
+// wallets do it: under each derivation scheme, accounts 0, 1, ... are
+// scanned until one has never been paid, and each account's receive and
+// change chains until gap limit addresses in a row are unused. A key's
+// addresses are its pubkeyhash and pubkey scripts. The operator then
+// activates the accounts to keep. The node stores only their extended
+// public keys, never the seed, and watches their addresses. Fresh receive
+// and change addresses are handed out from them in order, never more than
+// the gap limit past the last used one, so a restore still finds them.
+
+// Account discovery limits
+const (
+	defaultGapLimit       = 20 // As BIP 44 wallets scan
+	maxGapLimit           = 1000
+	maxDiscoveredAccounts = 100 // Per derivation scheme
+)
+
+// Address chains of an account
+const (
+	receiveChain = 0
+	changeChain  = 1
+)
+
+// accountSchemes returns the derivation paths discovery scans by default,
+// each followed by the hardened account index: BIP 44 with the chain's
+// coin type, then m/<account>' as other BIP 32 wallets use
+func accountSchemes(params *blockchain.ChainParams) []string {
+	return []string{fmt.Sprintf("m/44'/%d'", params.HDCoinType), "m"}
+}
+
+// keyScripts returns the output scripts paying a wallet key
+func keyScripts(key *ecdsa.PublicKey) [][]byte {
+	return [][]byte{blockchain.NewPubKeyHashScript(key), blockchain.NewPubKeyScript(key)}
+}
+
+// AccountInfo describes an account of a seed and what the chain holds for
+// it
+type AccountInfo struct {
+	Path          string      `json:"path"` // Derivation path of the account key
+	XPub          string      `json:"xpub"` // See blockchain.ExtendedKey.EncodePublic
+	Label         string      `json:"label,omitempty"`
+	UsedAddresses int         `json:"used_addresses"`
+	NextReceive   string      `json:"next_receive_address"` // First unused receive address, in hex
+	NextChange    string      `json:"next_change_address"`
+	Spendable     json.Number `json:"spendable"`
+	Locked        json.Number `json:"locked"`
+	ActivatedAt   int64       `json:"activated_at,omitempty"`
+}
+
+// chainScan is what the chain holds for the addresses of an account chain
+type chainScan struct {
+	used              int
+	next              uint32 // Index after the last used address
+	spendable, locked uint64
+}
+
+// scanChain scans the addresses of an account chain key until gapLimit in
+// a row are unused
+func scanChain(bc *blockchain.Blockchain, chain *blockchain.ExtendedKey, gapLimit int) (*chainScan, error) {
+	scan := &chainScan{}
+	lastUsed := -1
+	for scanned := 0; scanned-lastUsed-1 < gapLimit; {
+		end := lastUsed + 1 + gapLimit
+		keys := make([]*ecdsa.PublicKey, 0, end-scanned)
+		var scripts [][]byte
+		for i := scanned; i < end; i++ {
+			key, err := chain.Child(uint32(i))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key.PublicKey())
+			scripts = append(scripts, keyScripts(key.PublicKey())...)
+		}
+		used := bc.UsedScripts(scripts)
+		for i, key := range keys {
+			keyUsed := false
+			for _, script := range keyScripts(key) {
+				if used[string(script)] {
+					keyUsed = true
+					balances := bc.GetBalances(script)
+					scan.spendable += balances.Spendable
+					scan.locked += balances.Locked
+				}
+			}
+			if keyUsed {
+				scan.used++
+				lastUsed = scanned + i
+			}
+		}
+		scanned = end
+	}
+	scan.next = uint32(lastUsed + 1)
+	return scan, nil
+}
+
+// scanAccount describes the account with extended public key xpub, at
+// path, scanning its receive and change chains
+func scanAccount(bc *blockchain.Blockchain, path string, xpub *blockchain.ExtendedKey, gapLimit int) (*AccountInfo, error) {
+	info := &AccountInfo{Path: path, XPub: xpub.EncodePublic()}
+	var spendable, locked uint64
+	for _, chain := range []uint32{receiveChain, changeChain} {
+		chainKey, err := xpub.Child(chain)
+		if err != nil {
+			return nil, err
+		}
+		scan, err := scanChain(bc, chainKey, gapLimit)
+		if err != nil {
+			return nil, err
+		}
+		next, err := chainKey.Child(scan.next)
+		if err != nil {
+			return nil, err
+		}
+		address := hex.EncodeToString(blockchain.NewPubKeyHashScript(next.PublicKey()))
+		if chain == receiveChain {
+			info.NextReceive = address
+		} else {
+			info.NextChange = address
+		}
+		info.UsedAddresses += scan.used
+		spendable += scan.spendable
+		locked += scan.locked
+	}
+	info.Spendable = json.Number(blockchain.Amount(spendable).String())
+	info.Locked = json.Number(blockchain.Amount(locked).String())
+	return info, nil
+}
+
+// discoverAccounts returns the used accounts of a master key under each
+// scheme, a derivation path. Without any, it returns the first account of
+// the first scheme, so a new wallet can be activated.
+func discoverAccounts(bc *blockchain.Blockchain, master *blockchain.ExtendedKey, schemes []blockchain.DerivationPath, gapLimit int) ([]AccountInfo, error) {
+	accounts := make([]AccountInfo, 0)
+	var first *AccountInfo
+	for _, scheme := range schemes {
+		for a := uint32(0); a < maxDiscoveredAccounts; a++ {
+			path := scheme.Child(blockchain.HardenedKeyStart + a)
+			key, err := master.Derive(path)
+			if err != nil {
+				return nil, err
+			}
+			info, err := scanAccount(bc, path.String(), key.Public(), gapLimit)
+			if err != nil {
+				return nil, err
+			}
+			if first == nil {
+				first = info
+			}
+			if info.UsedAddresses == 0 {
+				break
+			}
+			accounts = append(accounts, *info)
+		}
+	}
+	if len(accounts) == 0 && first != nil {
+		accounts = append(accounts, *first)
+	}
+	return accounts, nil
+}
+
+// ActivatedAccount is an account the wallet watches
+type ActivatedAccount struct {
+	Path        string `json:"path"`
+	XPub        string `json:"xpub"`
+	Label       string `json:"label,omitempty"`
+	ActivatedAt int64  `json:"activated_at"`
+
+	// Addresses handed out on the receive and change chains, see
+	// NextAddress
+	ReceiveIssued uint32 `json:"receive_issued,omitempty"`
+	ChangeIssued  uint32 `json:"change_issued,omitempty"`
+}
+
+// issued returns the count of addresses handed out on an address chain
+func (a *ActivatedAccount) issued(chain uint32) *uint32 {
+	if chain == changeChain {
+		return &a.ChangeIssued
+	}
+	return &a.ReceiveIssued
+}
+
+// AccountAddress is an address handed out from an account
+type AccountAddress struct {
+	Address string `json:"address"` // Pubkeyhash script, in hex
+	Path    string `json:"path"`
+}
+
+// errNoAccount is returned when no active account matches a request
+var errNoAccount = errors.New("no such active account")
+
+// WalletAccounts keeps the accounts activated after discovery
+type WalletAccounts struct {
+	mu       sync.RWMutex
+	path     string
+	accounts []ActivatedAccount
+}
+
+// NewWalletAccounts loads the accounts persisted at path
+func NewWalletAccounts(path string) (*WalletAccounts, error) {
+	w := &WalletAccounts{path: path}
+	if err := loadJSONFile(path, &w.accounts); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Activate adds an account, or relabels it if already active
+func (w *WalletAccounts) Activate(account ActivatedAccount) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	replaced := false
+	for i := range w.accounts {
+		if w.accounts[i].XPub == account.XPub {
+			w.accounts[i].Label = account.Label
+			replaced = true
+		}
+	}
+	if !replaced {
+		w.accounts = append(w.accounts, account)
+	}
+	w.save()
+}
+
+// Deactivate removes the account with extended public key xpub,
+// reporting whether it was active
+func (w *WalletAccounts) Deactivate(xpub string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.accounts {
+		if w.accounts[i].XPub == xpub {
+			w.accounts = append(w.accounts[:i], w.accounts[i+1:]...)
+			w.save()
+			return true
+		}
+	}
+	return false
+}
+
+// NextAddress hands out the first address of an account's receive or
+// change chain that is neither used on the chain nor handed out before.
+// The account is matched by extended public key, path or label; an empty
+// name picks the first active account. It fails once gapLimit addresses
+// in a row past the last used one are handed out, as account discovery
+// with that gap limit would miss any further.
+func (w *WalletAccounts) NextAddress(bc *blockchain.Blockchain, name string, chain uint32, gapLimit int) (*AccountAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var account *ActivatedAccount
+	for i := range w.accounts {
+		a := &w.accounts[i]
+		if name == "" || name == a.XPub || name == a.Path || name == a.Label {
+			account = a
+			break
+		}
+	}
+	if account == nil {
+		return nil, errNoAccount
+	}
+
+	key, err := blockchain.DecodeExtendedPublicKey(account.XPub)
+	if err != nil {
+		return nil, err
+	}
+	chainKey, err := key.Child(chain)
+	if err != nil {
+		return nil, err
+	}
+	scan, err := scanChain(bc, chainKey, gapLimit)
+	if err != nil {
+		return nil, err
+	}
+	issued := account.issued(chain)
+	index := *issued
+	if index < scan.next {
+		index = scan.next
+	}
+	if index-scan.next >= uint32(gapLimit) {
+		return nil, fmt.Errorf("account %s has %d unused addresses handed out in a row, the gap limit; wait until one is paid", account.Path, gapLimit)
+	}
+	next, err := chainKey.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	*issued = index + 1
+	w.save()
+	return &AccountAddress{
+		Address: hex.EncodeToString(blockchain.NewPubKeyHashScript(next.PublicKey())),
+		Path:    fmt.Sprintf("%s/%d/%d", account.Path, chain, index),
+	}, nil
+}
+
+// List returns the active accounts, in activation order
+func (w *WalletAccounts) List() []ActivatedAccount {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]ActivatedAccount{}, w.accounts...)
+}
+
+// save persists the accounts. The caller must hold w.mu.
+func (w *WalletAccounts) save() {
+	if w.path == "" {
+		return
+	}
+	if err := saveJSONFile(w.path, w.accounts); err != nil {
+		log.Printf("Error saving wallet accounts: %v", err)
+	}
+}
+
+// accountRPC implements account discovery and activation
+type accountRPC struct {
+	chain    *blockchain.Blockchain
+	accounts *WalletAccounts
+}
+
+// registerAccountRPCs adds discoveraccounts, activateaccount,
+// deactivateaccount, listaccounts, getnewaddress and getrawchangeaddress
+func registerAccountRPCs(s *RPCServer, bc *blockchain.Blockchain, accounts *WalletAccounts) {
+	r := &accountRPC{chain: bc, accounts: accounts}
+	s.Register("discoveraccounts", r.discoverAccounts)
+	s.Register("activateaccount", r.activateAccount)
+	s.Register("deactivateaccount", r.deactivateAccount)
+	s.Register("listaccounts", r.listAccounts)
+	s.Register("getnewaddress", r.addressGetter(receiveChain))
+	s.Register("getrawchangeaddress", r.addressGetter(changeChain))
+}
+
+// discoverAccounts implements discoveraccounts "seed" ( options ), where
+// seed is a hex seed or a BIP 39 mnemonic. options.passphrase is the
+// mnemonic's passphrase, options.gapLimit the unused addresses in a row
+// ending a chain, and options.paths the derivation schemes to scan instead
+// of the defaults of accountSchemes.
+func (r *accountRPC) discoverAccounts(params []json.RawMessage) (interface{}, error) {
+	var seedParam string
+	var options struct {
+		Passphrase string   `json:"passphrase"`
+		GapLimit   int      `json:"gapLimit"`
+		Paths      []string `json:"paths"`
+	}
+	if err := parseParams(params, 1, &seedParam, &options); err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(seedParam)
+	if err != nil {
+		seed = blockchain.MnemonicSeed(seedParam, options.Passphrase)
+	} else if options.Passphrase != "" {
+		return nil, rpcErrorf(RPCInvalidParams, "A passphrase only applies to mnemonics")
+	}
+	master, err := blockchain.NewMasterKey(seed)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "%v", err)
+	}
+
+	gapLimit := options.GapLimit
+	if gapLimit == 0 {
+		gapLimit = defaultGapLimit
+	}
+	if gapLimit < 1 || gapLimit > maxGapLimit {
+		return nil, rpcErrorf(RPCInvalidParams, "gapLimit must be 1 to %d", maxGapLimit)
+	}
+	paths := options.Paths
+	if len(paths) == 0 {
+		paths = accountSchemes(r.chain.Params())
+	}
+	schemes := make([]blockchain.DerivationPath, len(paths))
+	for i, path := range paths {
+		if schemes[i], err = blockchain.ParseDerivationPath(path); err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+		}
+	}
+
+	accounts, err := discoverAccounts(r.chain, master, schemes, gapLimit)
+	if err != nil {
+		return nil, rpcErrorf(RPCWalletError, "Discovery failed: %v", err)
+	}
+	return accounts, nil
+}
+
+// activateAccount implements activateaccount "path" "xpub" ( "label" ),
+// watching an account found by discoveraccounts
+func (r *accountRPC) activateAccount(params []json.RawMessage) (interface{}, error) {
+	var path, xpub, label string
+	if err := parseParams(params, 2, &path, &xpub, &label); err != nil {
+		return nil, err
+	}
+	derivationPath, err := blockchain.ParseDerivationPath(path)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	key, err := blockchain.DecodeExtendedPublicKey(xpub)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "%v", err)
+	}
+	account := ActivatedAccount{
+		Path:        derivationPath.String(),
+		XPub:        key.EncodePublic(),
+		Label:       label,
+		ActivatedAt: time.Now().Unix(),
+	}
+	r.accounts.Activate(account)
+	log.Printf("Activated wallet account %s", account.Path)
+	return account, nil
+}
+
+// deactivateAccount implements deactivateaccount "xpub"
+func (r *accountRPC) deactivateAccount(params []json.RawMessage) (interface{}, error) {
+	var xpub string
+	if err := parseParams(params, 1, &xpub); err != nil {
+		return nil, err
+	}
+	if !r.accounts.Deactivate(xpub) {
+		return nil, rpcErrorf(RPCWalletError, "Account %s is not active", xpub)
+	}
+	return true, nil
+}
+
+// listAccounts implements listaccounts, describing the active accounts
+// with their balances and next addresses
+func (r *accountRPC) listAccounts(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	infos := make([]AccountInfo, 0)
+	for _, account := range r.accounts.List() {
+		key, err := blockchain.DecodeExtendedPublicKey(account.XPub)
+		if err != nil {
+			return nil, rpcErrorf(RPCWalletError, "Account %s: %v", account.Path, err)
+		}
+		info, err := scanAccount(r.chain, account.Path, key, defaultGapLimit)
+		if err != nil {
+			return nil, rpcErrorf(RPCWalletError, "Account %s: %v", account.Path, err)
+		}
+		info.Label, info.ActivatedAt = account.Label, account.ActivatedAt
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// addressGetter returns the implementation of getnewaddress ( "account" )
+// or getrawchangeaddress ( "account" ), handing out the next unused
+// address of an account's receive or change chain
+func (r *accountRPC) addressGetter(chain uint32) func(params []json.RawMessage) (interface{}, error) {
+	return func(params []json.RawMessage) (interface{}, error) {
+		var name string
+		if err := parseParams(params, 0, &name); err != nil {
+			return nil, err
+		}
+		address, err := r.accounts.NextAddress(r.chain, name, chain, defaultGapLimit)
+		if err != nil {
+			return nil, rpcErrorf(RPCWalletError, "%v", err)
+		}
+		return address, nil
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestDiscoverAccounts(t *testing.T) {
+	seed := "000102030405060708090a0b0c0d0e0f"
+	seedBytes, _ := hex.DecodeString(seed)
+	master, err := blockchain.NewMasterKey(seedBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	pay := func(path string, script func(*blockchain.ExtendedKey) []byte) {
+		p, err := blockchain.ParseDerivationPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.Derive(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bc.GenerateBlock(script(key), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyHash := func(k *blockchain.ExtendedKey) []byte { return blockchain.NewPubKeyHashScript(k.PublicKey()) }
+	pubKey := func(k *blockchain.ExtendedKey) []byte { return blockchain.NewPubKeyScript(k.PublicKey()) }
+	pay("m/44'/1'/0'/0/0", keyHash)
+	pay("m/44'/1'/0'/0/3", pubKey)
+	pay("m/44'/1'/1'/1/0", keyHash)
+	pay("m/0'/0/0", keyHash)
+
+	r := &accountRPC{chain: bc, accounts: &WalletAccounts{}}
+	discover := func(options string) []AccountInfo {
+		t.Helper()
+		result, err := r.discoverAccounts([]json.RawMessage{json.RawMessage(fmt.Sprintf("%q", seed)), json.RawMessage(options)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.([]AccountInfo)
+	}
+
+	accounts := discover(`{"gapLimit":5}`)
+	if len(accounts) != 3 {
+		t.Fatalf("discovered %d accounts, want 3: %+v", len(accounts), accounts)
+	}
+	next, _ := master.Derive(blockchain.DerivationPath{44 + blockchain.HardenedKeyStart, 1 + blockchain.HardenedKeyStart, blockchain.HardenedKeyStart, 0, 4})
+	if a := accounts[0]; a.Path != "m/44'/1'/0'" || a.UsedAddresses != 2 || a.NextReceive != hex.EncodeToString(keyHash(next)) {
+		t.Errorf("account 0 = %+v", a)
+	}
+	if a := accounts[1]; a.Path != "m/44'/1'/1'" || a.UsedAddresses != 1 || a.Spendable != json.Number(blockchain.InitialBlockReward.String()) {
+		t.Errorf("account 1 = %+v", a)
+	}
+	if accounts[2].Path != "m/0'" {
+		t.Errorf("account 2 = %+v", accounts[2])
+	}
+	// The address past the gap limit is missed
+	if a := discover(`{"gapLimit":2,"paths":["m/44'/1'"]}`); len(a) != 2 || a[0].UsedAddresses != 1 {
+		t.Errorf("with a gap limit of 2, discovered %+v", a)
+	}
+
+	// A seed never paid finds its first account
+	result, err := r.discoverAccounts([]json.RawMessage{json.RawMessage(`"legal winner thank year wave sausage worth useful legal winner thank yellow"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := result.([]AccountInfo); len(a) != 1 || a[0].Path != "m/44'/1'/0'" || a[0].UsedAddresses != 0 {
+		t.Errorf("new wallet discovered %+v", a)
+	}
+
+	for _, params := range [][]json.RawMessage{
+		{json.RawMessage(`"00ff"`)},
+		{json.RawMessage(fmt.Sprintf("%q", seed)), json.RawMessage(`{"passphrase":"x"}`)},
+		{json.RawMessage(fmt.Sprintf("%q", seed)), json.RawMessage(`{"gapLimit":-1}`)},
+		{json.RawMessage(fmt.Sprintf("%q", seed)), json.RawMessage(`{"paths":["44'"]}`)},
+	} {
+		if _, err := r.discoverAccounts(params); err == nil {
+			t.Errorf("discoveraccounts(%s) succeeded", params)
+		}
+	}
+}
+
+func TestActivateAccounts(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := blockchain.NewMasterKey(seed)
+	path, _ := blockchain.ParseDerivationPath("m/44'/1'/0'")
+	account, _ := master.Derive(path)
+	xpub := account.Public().EncodePublic()
+	receive, _ := account.Derive(blockchain.DerivationPath{0, 0})
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	if _, err := bc.GenerateBlock(blockchain.NewPubKeyHashScript(receive.PublicKey()), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	storePath := filepath.Join(t.TempDir(), "accounts.json")
+	accounts, err := NewWalletAccounts(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &accountRPC{chain: bc, accounts: accounts}
+	quote := func(s string) json.RawMessage { b, _ := json.Marshal(s); return b }
+	if _, err := r.activateAccount([]json.RawMessage{quote("m/44h/1h/0h"), quote(xpub), quote("savings")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.activateAccount([]json.RawMessage{quote("m/44'/1'/0'"), quote("abcd")}); err == nil {
+		t.Error("invalid extended public key activated")
+	}
+
+	reloaded, err := NewWalletAccounts(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.accounts = reloaded
+	result, err := r.listAccounts(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := result.([]AccountInfo)
+	if len(list) != 1 || list[0].Path != "m/44'/1'/0'" || list[0].Label != "savings" || list[0].UsedAddresses != 1 || list[0].Spendable != json.Number(blockchain.InitialBlockReward.String()) {
+		t.Errorf("listaccounts = %+v", list)
+	}
+
+	if _, err := r.deactivateAccount([]json.RawMessage{quote(xpub)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.deactivateAccount([]json.RawMessage{quote(xpub)}); err == nil {
+		t.Error("deactivated an inactive account")
+	}
+}
+
+func TestNextAddress(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := blockchain.NewMasterKey(seed)
+	path, _ := blockchain.ParseDerivationPath("m/44'/1'/0'")
+	account, _ := master.Derive(path)
+	address := func(chain, index uint32) string {
+		key, _ := account.Derive(blockchain.DerivationPath{chain, index})
+		return hex.EncodeToString(blockchain.NewPubKeyHashScript(key.PublicKey()))
+	}
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	pay := func(address string) {
+		script, _ := hex.DecodeString(address)
+		if _, err := bc.GenerateBlock(script, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pay(address(receiveChain, 0))
+
+	accounts := &WalletAccounts{}
+	if _, err := accounts.NextAddress(bc, "", receiveChain, 2); err != errNoAccount {
+		t.Errorf("without accounts: err = %v, want errNoAccount", err)
+	}
+	accounts.Activate(ActivatedAccount{Path: "m/44'/1'/0'", XPub: account.Public().EncodePublic(), Label: "savings"})
+
+	next := func(chain uint32) string {
+		t.Helper()
+		a, err := accounts.NextAddress(bc, "savings", chain, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Address
+	}
+	// Used and handed out addresses are skipped, up to the gap limit
+	if got := next(receiveChain); got != address(receiveChain, 1) {
+		t.Errorf("first receive address = %s, want index 1", got)
+	}
+	if got := next(receiveChain); got != address(receiveChain, 2) {
+		t.Errorf("second receive address = %s, want index 2", got)
+	}
+	if _, err := accounts.NextAddress(bc, "savings", receiveChain, 2); err == nil {
+		t.Error("handed out an address past the gap limit")
+	}
+	pay(address(receiveChain, 1))
+	if got := next(receiveChain); got != address(receiveChain, 3) {
+		t.Errorf("receive address after a payment = %s, want index 3", got)
+	}
+	if got := next(changeChain); got != address(changeChain, 0) {
+		t.Errorf("first change address = %s, want index 0", got)
+	}
+
+	// fundrawtransaction takes fresh change from the account
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.GenerateBlock(elliptic.Marshal(key.Curve, key.X, key.Y), nil); err != nil {
+		t.Fatal(err)
+	}
+	r := &rawTxRPC{chain: bc, network: &blockchain.Network{}, key: key, accounts: accounts}
+	raw, err := r.createRawTransaction([]json.RawMessage{json.RawMessage(`[]`), json.RawMessage(`{"payee":0.001}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fund := func(options string) (interface{}, error) {
+		return r.fundRawTransaction([]json.RawMessage{json.RawMessage(fmt.Sprintf("%q", raw)), json.RawMessage(options)})
+	}
+	result, err := fund(`{"changeAccount":"savings"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funded := result.(map[string]interface{})
+	tx, err := decodeRawTx(funded["hex"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := funded["changepos"].(int); pos < 0 || hex.EncodeToString(tx.Outputs[pos].Script) != address(changeChain, 1) {
+		t.Errorf("change output %d of %+v, want change index 1", pos, tx.Outputs)
+	}
+	if _, err := fund(`{"changeAccount":"savings","changeAddress":"other"}`); err == nil {
+		t.Error("changeAccount and changeAddress both accepted")
+	}
+}
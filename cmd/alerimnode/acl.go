@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// NetACL restricts which client addresses may connect to a listener.
+// Deny entries always win; if any allow entries are configured, only
+// matching addresses are accepted.
+type NetACL struct {
+	mu    sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// ParseNetACL builds an ACL from comma-separated lists of CIDRs or single
+// IP addresses (rpcallowip-style)
+func ParseNetACL(allow, deny string) (*NetACL, error) {
+	acl := &NetACL{}
+	var err error
+	if acl.allow, err = parseCIDRList(allow); err != nil {
+		return nil, err
+	}
+	if acl.deny, err = parseCIDRList(deny); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Allowed reports whether a remote address passes the ACL
+func (a *NetACL) Allowed(addr net.Addr) bool {
+	if a == nil {
+		return true
+	}
+
+	var ip net.IP
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		ip = v.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return false
+		}
+		ip = net.ParseIP(host)
+	}
+	if ip == nil {
+		return false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, n := range a.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, n := range a.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace replaces the ACL's entries with those of other, e.g. when the
+// node reloads its config file
+func (a *NetACL) Replace(other *NetACL) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.allow, a.deny = other.allow, other.deny
+}
+
+// parseCIDRList parses a comma-separated list of CIDRs or IP addresses
+func parseCIDRList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range splitList(list) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// aclListener drops connections rejected by the ACL at accept time
+type aclListener struct {
+	net.Listener
+	acl  *NetACL
+	name string
+}
+
+// newACLListener wraps l so that only connections allowed by acl are
+// returned from Accept. name labels the rejection metrics.
+func newACLListener(l net.Listener, acl *NetACL, name string) net.Listener {
+	if acl == nil {
+		return l
+	}
+	return &aclListener{Listener: l, acl: acl, name: name}
+}
+
+func (l *aclListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.acl.Allowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		metrics.Inc("alerim_rejected_connections_total", "listener", l.name)
+		conn.Close()
+	}
+}
+
+func init() {
+	metrics.Describe("alerim_rejected_connections_total", "Connections rejected by listener ACLs")
+}
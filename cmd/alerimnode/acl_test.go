@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseNetACL(t *testing.T) {
+	tests := []struct {
+		allow, deny string
+		wantErr     bool
+	}{
+		{"", "", false},
+		{"10.0.0.0/8, 192.168.1.5", "", false},
+		{"2001:db8::/32", "::1", false},
+		{"10.0.0.0/33", "", true},
+		{"", "not-an-ip", true},
+		{"300.1.1.1", "", true},
+	}
+
+	for _, test := range tests {
+		_, err := ParseNetACL(test.allow, test.deny)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseNetACL(%q, %q) error = %v, wantErr %v", test.allow, test.deny, err, test.wantErr)
+		}
+	}
+}
+
+func TestNetACLAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny string
+		ip          string
+		want        bool
+	}{
+		{"empty ACL allows all", "", "", "203.0.113.7", true},
+		{"CIDR allow match", "10.0.0.0/8", "", "10.1.2.3", true},
+		{"CIDR allow miss", "10.0.0.0/8", "", "11.1.2.3", false},
+		{"single IP allow match", "192.168.1.5", "", "192.168.1.5", true},
+		{"single IP allow miss", "192.168.1.5", "", "192.168.1.6", false},
+		{"deny wins over allow", "10.0.0.0/8", "10.0.0.1", "10.0.0.1", false},
+		{"deny only", "", "203.0.113.0/24", "203.0.113.9", false},
+		{"deny only miss", "", "203.0.113.0/24", "198.51.100.1", true},
+		{"v4-mapped v6 matches v4 CIDR", "10.0.0.0/8", "", "::ffff:10.0.0.1", true},
+		{"v4-mapped v6 matches v4 single IP deny", "", "10.0.0.1", "::ffff:10.0.0.1", false},
+		{"v4-mapped entry matches v4 client", "::ffff:10.0.0.1", "", "10.0.0.1", true},
+		{"v6 CIDR match", "2001:db8::/32", "", "2001:db8::1", true},
+		{"v6 single IP match", "::1", "", "::1", true},
+		{"v6 client not in v4 allow", "10.0.0.0/8", "", "2001:db8::1", false},
+	}
+
+	for _, test := range tests {
+		acl, err := ParseNetACL(test.allow, test.deny)
+		if err != nil {
+			t.Fatalf("%s: ParseNetACL: %v", test.name, err)
+		}
+
+		addr := &net.TCPAddr{IP: net.ParseIP(test.ip), Port: 1234}
+		if got := acl.Allowed(addr); got != test.want {
+			t.Errorf("%s: Allowed(%s) = %v, want %v", test.name, test.ip, got, test.want)
+		}
+	}
+}
+
+func TestNetACLAllowedNonTCPAddr(t *testing.T) {
+	acl, err := ParseNetACL("10.0.0.0/8", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !acl.Allowed(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}) {
+		t.Error("expected UDP address in allowed CIDR to pass")
+	}
+	if acl.Allowed(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}) {
+		t.Error("expected address without an IP to be rejected")
+	}
+
+	var nilACL *NetACL
+	if !nilACL.Allowed(&net.TCPAddr{IP: net.ParseIP("203.0.113.1")}) {
+		t.Error("expected nil ACL to allow everything")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of address history pages
+const (
+	defaultAddressHistoryLimit = 50
+	maxAddressHistoryLimit     = 500
+)
+
+// addressScript returns the output script of an address as given in a
+// URL: standard scripts (see blockchain.ClassifyScript) and time-locked
+// addresses, shown in hex by scriptAddress, are decoded and anything else
+// is the script itself
+func addressScript(address string) []byte {
+	script, err := hex.DecodeString(address)
+	if err != nil {
+		return []byte(address)
+	}
+	if blockchain.ClassifyScript(script) != blockchain.NonStandardScript {
+		return script
+	}
+	if _, _, ok := blockchain.ParseTimeLockScript(script); ok {
+		return script
+	}
+	return []byte(address)
+}
+
+// registerAddressRoutes adds the per-address transaction history, served
+// from the address index enabled by -addressindex, and the spendable and
+// time-locked balances
+func registerAddressRoutes(api *gin.RouterGroup, bc *blockchain.Blockchain) {
+	api.GET("/address/:address/history", func(c *gin.Context) {
+		limit, err := queryInt(c, "limit", defaultAddressHistoryLimit)
+		if err != nil || limit < 1 || limit > maxAddressHistoryLimit {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid limit"))
+			return
+		}
+		page, err := queryInt(c, "page", 0)
+		if err != nil || page < 0 {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid page"))
+			return
+		}
+
+		txs, total, err := bc.GetAddressHistory(addressScript(c.Param("address")), page, limit)
+		if err != nil {
+			respondError(c, apiError(CodeNotFound, "Address history requires -addressindex"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"total":        total,
+			"page":         page,
+			"transactions": txs,
+		})
+	})
+	api.GET("/address/:address/balances", func(c *gin.Context) {
+		c.JSON(http.StatusOK, bc.GetBalances(addressScript(c.Param("address"))))
+	})
+}
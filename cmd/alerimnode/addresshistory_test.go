@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAddressScript(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := elliptic.Marshal(key.Curve, key.X, key.Y)
+
+	tests := []struct {
+		address string
+		want    []byte
+	}{
+		{hex.EncodeToString(pubKey), pubKey},
+		{"alice", []byte("alice")},
+		{"abcd", []byte("abcd")},
+	}
+	for _, tt := range tests {
+		if got := addressScript(tt.address); !bytes.Equal(got, tt.want) {
+			t.Errorf("addressScript(%q) = %x, want %x", tt.address, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errAdjustmentZero      = errors.New("adjustment amount must not be zero")
+	errAdjustmentNoReason  = errors.New("a reason is required for balance adjustments")
+	errAdjustmentOverdraft = errors.New("debit exceeds the miner's balance")
+	errNoAuditLog          = errors.New("balance adjustments require an audit log")
+)
+
+// AdjustBalance credits, or with a negative amount debits, a miner's
+// balance outside the normal reward flow, e.g. to compensate for a pool
+// error. The adjustment is recorded in the audit log and the miner's
+// payout history, linked by the audit entry ID. Debits may not take the
+// balance below zero.
+func (rm *RewardManager) AdjustBalance(minerID string, amount blockchain.Amount, reason, actor string) (*PayoutRecord, error) {
+	reason = strings.TrimSpace(reason)
+	if amount == 0 {
+		return nil, errAdjustmentZero
+	}
+	if reason == "" {
+		return nil, errAdjustmentNoReason
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.audit == nil {
+		return nil, errNoAuditLog
+	}
+	balance := rm.balances[minerID]
+	if balance+amount < 0 {
+		return nil, errAdjustmentOverdraft
+	}
+
+	entry := rm.audit.Record(actor, AuditBalanceAdjustment, minerID, reason, map[string]interface{}{
+		"amount":      amount,
+		"old_balance": balance,
+		"new_balance": balance + amount,
+	})
+	record := &PayoutRecord{
+		MinerID: minerID,
+		Kind:    PayoutAdjustment,
+		Amount:  amount,
+		Time:    entry.Time,
+		Reason:  reason,
+		Actor:   actor,
+		AuditID: entry.ID,
+	}
+	rm.balances[minerID] = balance + amount
+	rm.appendPayout(record)
+	rm.saveState()
+
+	return record, nil
+}
+
+// Adjustments returns a miner's manual balance adjustments, oldest first
+func (rm *RewardManager) Adjustments(minerID string) []*PayoutRecord {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	adjustments := make([]*PayoutRecord, 0)
+	for _, record := range rm.payouts {
+		if record.MinerID == minerID && record.Kind == PayoutAdjustment {
+			adjustments = append(adjustments, record)
+		}
+	}
+	return adjustments
+}
+
+// registerAdjustmentRoutes adds the manual balance adjustment endpoints.
+// Adjustments move funds, so they require an admin session.
+func registerAdjustmentRoutes(api *gin.RouterGroup, pool *MiningPool) {
+	api.POST("/admin/miners/:id/adjustments", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Amount string `json:"amount"` // Coins, negative to debit
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		amount, err := blockchain.ParseAmount(req.Amount)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if findMiner(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+
+		record, err := pool.rewards.AdjustBalance(c.Param("id"), amount, req.Reason, requestActor(c))
+		if err == errAdjustmentOverdraft {
+			respondError(c, apiError(CodeConflict, err.Error()))
+			return
+		} else if err == errNoAuditLog {
+			respondError(c, apiError(CodeUnavailable, err.Error()))
+			return
+		} else if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"adjustment": record,
+			"balance":    pool.rewards.GetMinerBalance(c.Param("id")),
+		})
+	})
+
+	api.GET("/admin/miners/:id/adjustments", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, pool.rewards.Adjustments(c.Param("id")))
+	})
+}
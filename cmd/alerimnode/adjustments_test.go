@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestAdjustBalance(t *testing.T) {
+	dir := t.TempDir()
+	audit, err := NewAuditLog(filepath.Join(dir, "audit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := newTestRewardManager(10)
+	rm.balances["m1"] = 100
+
+	if _, err := rm.AdjustBalance("m1", 5, "refund", "admin:ops"); err != errNoAuditLog {
+		t.Fatalf("without audit log: err = %v, want %v", err, errNoAuditLog)
+	}
+	rm.SetAuditLog(audit)
+
+	tests := []struct {
+		name    string
+		amount  blockchain.Amount
+		reason  string
+		err     error
+		balance blockchain.Amount
+	}{
+		{"credit", 50, "stratum outage compensation", nil, 150},
+		{"debit", -30, "duplicate credit", nil, 120},
+		{"overdraft", -121, "too much", errAdjustmentOverdraft, 120},
+		{"no reason", 10, "  ", errAdjustmentNoReason, 120},
+		{"zero", 0, "nothing", errAdjustmentZero, 120},
+		{"debit to zero", -120, "clawback", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := rm.AdjustBalance("m1", tt.amount, tt.reason, "admin:ops")
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got := rm.GetMinerBalance("m1"); got != tt.balance {
+				t.Errorf("balance = %s, want %s", got, tt.balance)
+			}
+			if err == nil && (record.Kind != PayoutAdjustment || record.Amount != tt.amount || record.AuditID == "") {
+				t.Errorf("record = %+v", record)
+			}
+		})
+	}
+
+	// Every applied adjustment is in the payout history and linked to
+	// its audit entry
+	adjustments := rm.Adjustments("m1")
+	entries := audit.List("m1", maxAuditListed)
+	if len(adjustments) != 3 || len(entries) != 3 {
+		t.Fatalf("%d adjustments and %d audit entries, want 3 each", len(adjustments), len(entries))
+	}
+	for i, adj := range adjustments {
+		entry := entries[len(entries)-1-i]
+		if entry.ID != adj.AuditID || entry.Actor != "admin:ops" || entry.Reason != adj.Reason || entry.Action != AuditBalanceAdjustment {
+			t.Errorf("adjustment %+v not linked to audit entry %+v", adj, entry)
+		}
+	}
+
+	// The audit log survives a restart
+	reloaded, err := NewAuditLog(filepath.Join(dir, "audit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.List("", maxAuditListed); len(got) != 3 || got[0].ID != entries[0].ID {
+		t.Errorf("reloaded %d entries", len(got))
+	}
+}
+
+func TestAuditLogAnonymize(t *testing.T) {
+	audit, err := NewAuditLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit.Record("admin:ops", AuditBalanceAdjustment, "m1", "refund", nil)
+	audit.Record("admin:ops", AuditBalanceAdjustment, "m2", "refund", nil)
+
+	audit.Anonymize("m1", "anon-1")
+	if got := audit.List("m1", maxAuditListed); len(got) != 0 {
+		t.Errorf("%d entries still target m1", len(got))
+	}
+	if got := audit.List("anon-1", maxAuditListed); len(got) != 1 {
+		t.Errorf("%d entries target the pseudonym, want 1", len(got))
+	}
+	if got := audit.List("", 1); len(got) != 1 || got[0].Target != "m2" {
+		t.Errorf("limited list = %+v, want the newest entry", got)
+	}
+}
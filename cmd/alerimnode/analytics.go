@@ -0,0 +1,237 @@
+package main
+
+import (
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of analytics queries
+const (
+	defaultAnalyticsRange = 144
+	maxAnalyticsPoints    = 10000
+)
+
+// BlockStats is the analytics index entry of one main-chain block
+type BlockStats struct {
+	Height     int               `json:"height"`
+	Hash       [32]byte          `json:"-"`
+	Time       time.Time         `json:"time"`
+	Interval   int64             `json:"interval"` // Seconds since the previous block
+	Difficulty float64           `json:"difficulty"`
+	TxCount    int               `json:"tx_count"`
+	Fees       blockchain.Amount `json:"fees"`
+	Size       int               `json:"size"`
+}
+
+// analyticsSeries describes how a chart series is read from the index and
+// aggregated when several blocks fall into one bucket
+type analyticsSeries struct {
+	value func(s *BlockStats) float64
+	sum   bool // Sum the bucket instead of averaging it
+}
+
+var analyticsSeriesByName = map[string]analyticsSeries{
+	"block-interval": {value: func(s *BlockStats) float64 { return float64(s.Interval) }},
+	"difficulty":     {value: func(s *BlockStats) float64 { return s.Difficulty }},
+	"tx-count":       {value: func(s *BlockStats) float64 { return float64(s.TxCount) }, sum: true},
+	"fees":           {value: func(s *BlockStats) float64 { return float64(s.Fees) }, sum: true},
+	"block-size":     {value: func(s *BlockStats) float64 { return float64(s.Size) }},
+}
+
+// AnalyticsPoint is one point of a chart series. Height and Time are those
+// of the first block in the bucket.
+type AnalyticsPoint struct {
+	Height int       `json:"height"`
+	Time   time.Time `json:"time"`
+	Value  float64   `json:"value"`
+}
+
+// AnalyticsIndex keeps per-block statistics of the main chain for charts
+type AnalyticsIndex struct {
+	mu     sync.RWMutex
+	params *blockchain.ChainParams // Emission schedule to tell fees apart
+	blocks []*BlockStats           // Indexed by height
+}
+
+// NewAnalyticsIndex builds the index from the current chain and keeps it
+// in sync through chain notifications
+func NewAnalyticsIndex(bc *blockchain.Blockchain) *AnalyticsIndex {
+	idx := &AnalyticsIndex{params: bc.Params()}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	bc.Subscribe(idx.handleChainNotification)
+	for _, block := range bc.GetBlocks() {
+		idx.connect(block)
+	}
+	return idx
+}
+
+// handleChainNotification applies connected and disconnected blocks
+func (idx *AnalyticsIndex) handleChainNotification(n *blockchain.Notification) {
+	block, ok := n.Data.(*blockchain.Block)
+	if !ok {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		idx.connect(block)
+	case blockchain.NTBlockDisconnected:
+		if tip := len(idx.blocks) - 1; tip >= 0 && idx.blocks[tip].Hash == block.Hash {
+			idx.blocks = idx.blocks[:tip]
+		}
+	}
+}
+
+// connect appends a block extending the indexed tip; the caller must hold
+// idx.mu
+func (idx *AnalyticsIndex) connect(block *blockchain.Block) {
+	var prev *BlockStats
+	if n := len(idx.blocks); n > 0 {
+		prev = idx.blocks[n-1]
+		if prev.Hash != block.PrevHash {
+			// Already indexed, or not on top of the indexed chain
+			return
+		}
+	}
+	idx.blocks = append(idx.blocks, blockStats(block, len(idx.blocks), prev, idx.params))
+}
+
+// blockStats computes the statistics of a block at height
+func blockStats(block *blockchain.Block, height int, prev *BlockStats, params *blockchain.ChainParams) *BlockStats {
+	stats := &BlockStats{
+		Height:  height,
+		Hash:    block.Hash,
+		Time:    time.Unix(block.Timestamp, 0),
+		TxCount: len(block.Transactions),
+		Size:    block.Size(),
+	}
+	if prev != nil {
+		stats.Interval = block.Timestamp - prev.Time.Unix()
+	}
+	stats.Difficulty, _ = new(big.Float).SetInt(block.Difficulty()).Float64()
+
+	// Fees are whatever the coinbase claims above the subsidy
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			continue
+		}
+		var claimed uint64
+		for _, out := range tx.Outputs {
+			claimed += out.Value
+		}
+		if subsidy := uint64(params.BlockSubsidy(height)); claimed > subsidy {
+			stats.Fees = blockchain.Amount(claimed - subsidy)
+		}
+		break
+	}
+	return stats
+}
+
+// Series returns a chart series for the blocks in [from, to], bucketed by
+// bucket blocks per point
+func (idx *AnalyticsIndex) Series(series analyticsSeries, from, to, bucket int) []AnalyticsPoint {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if to >= len(idx.blocks) {
+		to = len(idx.blocks) - 1
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	points := make([]AnalyticsPoint, 0)
+	for start := from; start <= to; start += bucket {
+		end := start + bucket - 1
+		if end > to {
+			end = to
+		}
+
+		var total float64
+		for _, s := range idx.blocks[start : end+1] {
+			total += series.value(s)
+		}
+		if !series.sum {
+			total /= float64(end - start + 1)
+		}
+		points = append(points, AnalyticsPoint{
+			Height: start,
+			Time:   idx.blocks[start].Time,
+			Value:  total,
+		})
+	}
+	return points
+}
+
+// Tip returns the indexed chain height
+func (idx *AnalyticsIndex) Tip() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.blocks) - 1
+}
+
+// queryInt reads an integer query parameter with a default
+func queryInt(c *gin.Context, name string, def int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// RegisterRoutes adds the public chart endpoints. Each takes optional from
+// and to heights (default: the last 144 blocks) and a bucket size in blocks.
+func (idx *AnalyticsIndex) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/analytics/:series", func(c *gin.Context) {
+		series, ok := analyticsSeriesByName[c.Param("series")]
+		if !ok {
+			respondError(c, apiErrorf(CodeNotFound, "Unknown series %s", c.Param("series")))
+			return
+		}
+
+		tip := idx.Tip()
+		to, err := queryInt(c, "to", tip)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid to height"))
+			return
+		}
+		from, err := queryInt(c, "from", to-defaultAnalyticsRange+1)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid from height"))
+			return
+		}
+		bucket, err := queryInt(c, "bucket", 1)
+		if err != nil || bucket < 1 {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid bucket size"))
+			return
+		}
+		if from > to {
+			respondError(c, apiError(CodeInvalidRequest, "from must not be above to"))
+			return
+		}
+		if (to-from)/bucket+1 > maxAnalyticsPoints {
+			respondError(c, apiError(CodeInvalidRequest, "Range too large; use a bigger bucket"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"series": c.Param("series"),
+			"from":   from,
+			"to":     to,
+			"bucket": bucket,
+			"points": idx.Series(series, from, to, bucket),
+		})
+	})
+}
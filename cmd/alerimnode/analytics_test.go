@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func testChainBlock(hash, prev byte, timestamp int64, txs int) *blockchain.Block {
+	block := &blockchain.Block{
+		Hash:      [32]byte{hash},
+		PrevHash:  [32]byte{prev},
+		Timestamp: timestamp,
+		Bits:      blockchain.DifficultyToCompact(big.NewInt(1000)),
+	}
+	for i := 0; i < txs; i++ {
+		block.Transactions = append(block.Transactions, blockchain.Transaction{Hash: [32]byte{hash, byte(i)}})
+	}
+	return block
+}
+
+func TestAnalyticsIndexSeries(t *testing.T) {
+	idx := &AnalyticsIndex{params: &blockchain.MainNetParams}
+	connect := func(b *blockchain.Block) {
+		idx.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: b})
+	}
+	connect(testChainBlock(1, 0, 1000, 1))
+	connect(testChainBlock(2, 1, 1060, 2))
+	connect(testChainBlock(3, 2, 1180, 3))
+	connect(testChainBlock(4, 3, 1200, 4))
+
+	// Blocks not extending the tip are ignored
+	connect(testChainBlock(3, 2, 1180, 3))
+	connect(testChainBlock(9, 7, 1300, 1))
+	if tip := idx.Tip(); tip != 3 {
+		t.Fatalf("tip = %d, want 3", tip)
+	}
+
+	tests := []struct {
+		series         string
+		from, to, size int
+		want           []float64
+	}{
+		{"block-interval", 1, 3, 1, []float64{60, 120, 20}},
+		{"block-interval", 0, 3, 2, []float64{30, 70}},
+		{"tx-count", 0, 3, 2, []float64{3, 7}},
+		{"tx-count", 0, 99, 3, []float64{6, 4}},
+		{"difficulty", 2, 3, 5, []float64{1000}},
+	}
+	for _, tt := range tests {
+		points := idx.Series(analyticsSeriesByName[tt.series], tt.from, tt.to, tt.size)
+		if len(points) != len(tt.want) {
+			t.Errorf("%s [%d,%d]/%d: got %d points, want %d", tt.series, tt.from, tt.to, tt.size, len(points), len(tt.want))
+			continue
+		}
+		for i, p := range points {
+			if p.Value != tt.want[i] {
+				t.Errorf("%s [%d,%d]/%d point %d = %v, want %v", tt.series, tt.from, tt.to, tt.size, i, p.Value, tt.want[i])
+			}
+		}
+	}
+
+	idx.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockDisconnected, Data: testChainBlock(4, 3, 1200, 4)})
+	if tip := idx.Tip(); tip != 2 {
+		t.Errorf("tip after disconnect = %d, want 2", tip)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions taken on a worker flagged for anomalous shares
+const (
+	AnomalyActionFlag       = "flag"       // Only list it for review
+	AnomalyActionRaiseDiff  = "raisediff"  // Also raise its share difficulty
+	AnomalyActionQuarantine = "quarantine" // Also hold its payouts until cleared
+)
+
+// Anomalies a worker's share stream is flagged for
+const (
+	AnomalyHashrateSpike    = "hashrate-spike"
+	AnomalyRepeatedNonces   = "repeated-nonces"
+	AnomalySequentialNonces = "sequential-nonces"
+	AnomalyAboveReported    = "above-reported-hashrate"
+)
+
+// AuditAnomalyCleared is the audited action of clearing a flagged worker
+const AuditAnomalyCleared = "anomaly-cleared"
+
+// anomalyWindow is the interval a worker's shares are checked over
+const anomalyWindow = 5 * time.Minute
+
+// anomalyMinShares is the fewest shares in a window worth checking; with
+// fewer, luck alone swings the implied hashrate too far
+const anomalyMinShares = 10
+
+// anomalyBaselineWindows is how many windows establish a worker's baseline
+// hashrate before spikes are checked
+const anomalyBaselineWindows = 3
+
+// anomalyBaselineWeight is the weight of a new window in the baseline
+const anomalyBaselineWeight = 0.2
+
+// anomalyReportedFactor is how far the share rate may exceed the hashrate
+// a worker reports
+const anomalyReportedFactor = 3
+
+// anomalyNearNonces is the distance under which consecutive nonces count as
+// sequential; winning nonces are uniform, so even one pair is unlikely
+const anomalyNearNonces = 1 << 16
+
+// anomalyDifficultyFactor is how much the raisediff action multiplies a
+// worker's difficulty by
+const anomalyDifficultyFactor = 4
+
+// maxAnomalyNonces caps the nonces kept per window
+const maxAnomalyNonces = 256
+
+// AnomalyConfig holds the anomaly detector's settings
+type AnomalyConfig struct {
+	Action      string  // One of the AnomalyAction* constants
+	SpikeFactor float64 // Hashrate over the baseline counted as a spike
+}
+
+// AnomalyFlag is a worker flagged for review
+type AnomalyFlag struct {
+	Worker    string    `json:"worker"`
+	Reasons   []string  `json:"reasons"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Hashrate  float64   `json:"hashrate"` // Implied by the shares of the last flagged window
+	Baseline  float64   `json:"baseline"`
+	Reported  float64   `json:"reported,omitempty"`
+	Action    string    `json:"action"`
+}
+
+// workerActivity is a worker's share stream as seen by the detector
+type workerActivity struct {
+	windowStart time.Time
+	work        float64 // Sum of share difficulties in the window
+	shares      int
+	nonces      []uint32
+	baseline    float64 // Moving average of the windows' hashrates
+	windows     int     // Windows in the baseline
+	reported    float64 // Hashrate the worker reports, 0 if none
+}
+
+// AnomalyDetector watches workers' accepted shares for signs of rented or
+// misreported hashrate and of broken or cheating miners: sudden hashrate
+// spikes, nonces that aren't uniformly random, and share rates a worker's
+// reported hashrate can't produce. Flags persist until an operator clears
+// them.
+type AnomalyDetector struct {
+	mu      sync.Mutex
+	config  AnomalyConfig
+	path    string
+	workers map[string]*workerActivity
+	flags   map[string]*AnomalyFlag
+}
+
+// NewAnomalyDetector creates a detector whose flags are persisted at path
+func NewAnomalyDetector(path string, config AnomalyConfig) (*AnomalyDetector, error) {
+	switch config.Action {
+	case AnomalyActionFlag, AnomalyActionRaiseDiff, AnomalyActionQuarantine:
+	default:
+		return nil, fmt.Errorf("unknown anomaly action %q", config.Action)
+	}
+	if config.SpikeFactor <= 1 {
+		return nil, fmt.Errorf("anomaly spike factor %v must be above 1", config.SpikeFactor)
+	}
+
+	d := &AnomalyDetector{
+		config:  config,
+		path:    path,
+		workers: make(map[string]*workerActivity),
+		flags:   make(map[string]*AnomalyFlag),
+	}
+	if err := loadJSONFile(path, &d.flags); err != nil {
+		return nil, err
+	}
+	metrics.Set("alerim_pool_flagged_workers", float64(len(d.flags)))
+	return d, nil
+}
+
+// activity returns a worker's activity, creating it; the caller must hold
+// d.mu
+func (d *AnomalyDetector) activity(worker string) *workerActivity {
+	w, ok := d.workers[worker]
+	if !ok {
+		w = &workerActivity{}
+		d.workers[worker] = w
+	}
+	return w
+}
+
+// ReportHashrate records the hashrate a worker reports, in the pool's
+// hashrate units
+func (d *AnomalyDetector) ReportHashrate(worker string, hashrate float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.activity(worker).reported = hashrate
+}
+
+// Observe records an accepted share and returns the anomalies newly found
+// when it closes the worker's window
+func (d *AnomalyDetector) Observe(worker string, difficulty float64, nonce uint32, now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w := d.activity(worker)
+	if w.windowStart.IsZero() {
+		w.windowStart = now
+	}
+	elapsed := now.Sub(w.windowStart)
+	var found []string
+	if elapsed >= anomalyWindow {
+		found = d.closeWindow(worker, w, elapsed.Seconds(), now)
+	}
+
+	w.work += difficulty
+	w.shares++
+	if len(w.nonces) < maxAnomalyNonces {
+		w.nonces = append(w.nonces, nonce)
+	}
+	return found
+}
+
+// closeWindow checks a worker's finished window, folds it into the
+// baseline and starts the next one; the caller must hold d.mu
+func (d *AnomalyDetector) closeWindow(worker string, w *workerActivity, seconds float64, now time.Time) []string {
+	defer func() {
+		w.windowStart = now
+		w.work, w.shares, w.nonces = 0, 0, w.nonces[:0]
+	}()
+	if w.shares < anomalyMinShares {
+		return nil
+	}
+
+	hashrate := w.work / seconds
+	var found []string
+	if w.windows >= anomalyBaselineWindows && hashrate > w.baseline*d.config.SpikeFactor {
+		found = append(found, AnomalyHashrateSpike)
+	}
+	if w.reported > 0 && hashrate > w.reported*anomalyReportedFactor {
+		found = append(found, AnomalyAboveReported)
+	}
+	found = append(found, nonceAnomalies(w.nonces)...)
+
+	// A spike doesn't move the baseline, so it stays flagged until cleared
+	if len(found) == 0 || found[0] != AnomalyHashrateSpike {
+		if w.windows == 0 {
+			w.baseline = hashrate
+		} else {
+			w.baseline += (hashrate - w.baseline) * anomalyBaselineWeight
+		}
+		w.windows++
+	}
+	if len(found) > 0 {
+		d.flag(worker, w, hashrate, found, now)
+	}
+	return found
+}
+
+// nonceAnomalies checks a window's nonces. A valid share's nonce is
+// uniformly random, so repeats or runs of nearby nonces point to a miner
+// replaying work or not hashing what it claims.
+func nonceAnomalies(nonces []uint32) []string {
+	if len(nonces) < anomalyMinShares {
+		return nil
+	}
+	var found []string
+	distinct := make(map[uint32]bool, len(nonces))
+	for _, nonce := range nonces {
+		distinct[nonce] = true
+	}
+	if len(distinct)*4 < len(nonces)*3 {
+		found = append(found, AnomalyRepeatedNonces)
+	}
+
+	near := 0
+	for i := 1; i < len(nonces); i++ {
+		a, b := nonces[i-1], nonces[i]
+		if a > b {
+			a, b = b, a
+		}
+		if b-a < anomalyNearNonces {
+			near++
+		}
+	}
+	if near*2 > len(nonces)-1 {
+		found = append(found, AnomalySequentialNonces)
+	}
+	return found
+}
+
+// flag records anomalies of a worker; the caller must hold d.mu
+func (d *AnomalyDetector) flag(worker string, w *workerActivity, hashrate float64, reasons []string, now time.Time) {
+	f, ok := d.flags[worker]
+	if !ok {
+		f = &AnomalyFlag{Worker: worker, FirstSeen: now, Action: d.config.Action}
+		d.flags[worker] = f
+		log.Printf("Worker %s flagged for anomalous shares: %v", worker, reasons)
+	}
+	f.LastSeen = now
+	f.Hashrate, f.Baseline, f.Reported = hashrate, w.baseline, w.reported
+	for _, reason := range reasons {
+		known := false
+		for _, r := range f.Reasons {
+			known = known || r == reason
+		}
+		if !known {
+			f.Reasons = append(f.Reasons, reason)
+		}
+		metrics.Inc("alerim_pool_anomalies_total", "reason", reason)
+	}
+	metrics.Set("alerim_pool_flagged_workers", float64(len(d.flags)))
+	d.save()
+}
+
+// save persists the flags; the caller must hold d.mu
+func (d *AnomalyDetector) save() {
+	if d.path == "" {
+		return
+	}
+	if err := saveJSONFile(d.path, d.flags); err != nil {
+		log.Printf("Error saving anomaly flags: %v", err)
+	}
+}
+
+// RaisesDifficulty reports whether flagged workers get a higher difficulty
+func (d *AnomalyDetector) RaisesDifficulty() bool {
+	return d.config.Action == AnomalyActionRaiseDiff
+}
+
+// Quarantined reports whether a worker's payouts are held
+func (d *AnomalyDetector) Quarantined(worker string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.flags[worker]
+	return ok && f.Action == AnomalyActionQuarantine
+}
+
+// Flags returns the flagged workers, most recently flagged first
+func (d *AnomalyDetector) Flags() []AnomalyFlag {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	flags := make([]AnomalyFlag, 0, len(d.flags))
+	for _, f := range d.flags {
+		flags = append(flags, *f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].LastSeen.After(flags[j].LastSeen) })
+	return flags
+}
+
+// Clear removes a worker's flag after review, releasing any quarantine.
+// Its baseline restarts, so a legitimate hashrate change isn't flagged
+// again. It reports whether the worker was flagged.
+func (d *AnomalyDetector) Clear(worker string) (AnomalyFlag, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.flags[worker]
+	if !ok {
+		return AnomalyFlag{}, false
+	}
+	delete(d.flags, worker)
+	delete(d.workers, worker)
+	metrics.Set("alerim_pool_flagged_workers", float64(len(d.flags)))
+	d.save()
+	return *f, true
+}
+
+// RegisterRoutes adds the flagged worker review endpoints, which require
+// an admin session. Clearing a flag is recorded in the audit log.
+func (d *AnomalyDetector) RegisterRoutes(api *gin.RouterGroup, audit *AuditLog) {
+	api.GET("/admin/anomalies", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Flags())
+	})
+
+	api.POST("/admin/anomalies/:worker/clear", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		flag, ok := d.Clear(c.Param("worker"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Worker is not flagged"))
+			return
+		}
+		audit.Record(requestActor(c), AuditAnomalyCleared, flag.Worker, req.Reason, map[string]interface{}{
+			"reasons": flag.Reasons,
+			"action":  flag.Action,
+		})
+		c.JSON(http.StatusOK, flag)
+	})
+}
+
+func init() {
+	metrics.Describe("alerim_pool_anomalies_total", "Anomalies found in workers' share streams by reason")
+	metrics.Describe("alerim_pool_flagged_workers", "Workers flagged for anomalous shares awaiting review")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// feedWindow submits n shares of difficulty spread over one anomaly
+// window starting at start, with nonces from nonce, and returns the
+// anomalies found
+func feedWindow(d *AnomalyDetector, worker string, start time.Time, n int, difficulty float64, nonce func(i int) uint32) []string {
+	var found []string
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * anomalyWindow / time.Duration(n))
+		found = append(found, d.Observe(worker, difficulty, nonce(i), at)...)
+	}
+	return found
+}
+
+// randomNonce spreads nonces over the whole range, like real shares
+func randomNonce(i int) uint32 { return uint32(i) * 2654435761 }
+
+func TestNonceAnomalies(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonces func(i int) uint32
+		want   []string
+	}{
+		{"random", randomNonce, nil},
+		{"repeated", func(i int) uint32 { return uint32(i%4) * 2654435761 }, []string{AnomalyRepeatedNonces}},
+		{"sequential", func(i int) uint32 { return 1000 + uint32(i) }, []string{AnomalySequentialNonces}},
+		{"constant", func(int) uint32 { return 7 }, []string{AnomalyRepeatedNonces, AnomalySequentialNonces}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonces := make([]uint32, 30)
+			for i := range nonces {
+				nonces[i] = tt.nonces(i)
+			}
+			got := nonceAnomalies(nonces)
+			if len(got) != len(tt.want) {
+				t.Fatalf("anomalies = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("anomalies = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+	if got := nonceAnomalies([]uint32{1, 1, 1}); got != nil {
+		t.Errorf("too few nonces checked: %v", got)
+	}
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomalies.json")
+	d, err := NewAnomalyDetector(path, AnomalyConfig{Action: AnomalyActionQuarantine, SpikeFactor: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+	next := func(i int) time.Time { return start.Add(time.Duration(i) * anomalyWindow) }
+
+	// A steady worker builds its baseline without being flagged
+	for i := 0; i < anomalyBaselineWindows+1; i++ {
+		if found := feedWindow(d, "steady", next(i), 30, 100, randomNonce); len(found) != 0 {
+			t.Fatalf("steady window %d flagged: %v", i, found)
+		}
+	}
+	if d.Quarantined("steady") {
+		t.Fatal("steady worker quarantined")
+	}
+
+	// Rented hashrate twenty times the baseline is a spike
+	found := feedWindow(d, "steady", next(anomalyBaselineWindows+1), 30, 2000, randomNonce)
+	found = append(found, d.Observe("steady", 2000, 1, next(anomalyBaselineWindows+2))...)
+	if len(found) != 1 || found[0] != AnomalyHashrateSpike {
+		t.Fatalf("spike window: %v", found)
+	}
+	if !d.Quarantined("steady") {
+		t.Fatal("flagged worker not quarantined")
+	}
+
+	// Flags survive a restart
+	reloaded, err := NewAnomalyDetector(path, AnomalyConfig{Action: AnomalyActionQuarantine, SpikeFactor: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := reloaded.Flags(); len(flags) != 1 || flags[0].Worker != "steady" || flags[0].Reasons[0] != AnomalyHashrateSpike {
+		t.Fatalf("reloaded flags = %+v", flags)
+	}
+
+	// Clearing releases the quarantine
+	if _, ok := d.Clear("steady"); !ok || d.Quarantined("steady") {
+		t.Error("clear didn't release the worker")
+	}
+	if _, ok := d.Clear("steady"); ok {
+		t.Error("cleared a worker twice")
+	}
+
+	// A share rate the reported hashrate can't produce
+	d.ReportHashrate("liar", 10)
+	found = feedWindow(d, "liar", start, 30, 1000, randomNonce)
+	found = append(found, d.Observe("liar", 1000, 1, next(1))...)
+	if len(found) != 1 || found[0] != AnomalyAboveReported {
+		t.Errorf("above reported: %v", found)
+	}
+}
+
+func TestNewAnomalyDetectorConfig(t *testing.T) {
+	for _, config := range []AnomalyConfig{
+		{Action: "ban", SpikeFactor: 10},
+		{Action: AnomalyActionFlag, SpikeFactor: 1},
+	} {
+		if _, err := NewAnomalyDetector("", config); err == nil {
+			t.Errorf("accepted %+v", config)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is a stable, machine-readable error code. Messages are in
+// English and may change; clients should branch on, and localize by, the
+// code instead.
+type ErrorCode string
+
+// Error codes, documented in errorRegistry
+const (
+	CodeInvalidRequest     ErrorCode = "invalid_request"
+	CodeParseError         ErrorCode = "parse_error"
+	CodeMethodNotFound     ErrorCode = "method_not_found"
+	CodeUnauthorized       ErrorCode = "unauthorized"
+	CodeForbidden          ErrorCode = "forbidden"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeConflict           ErrorCode = "conflict"
+	CodeRateLimited        ErrorCode = "rate_limited"
+	CodeInsufficientFunds  ErrorCode = "insufficient_funds"
+	CodeWalletError        ErrorCode = "wallet_error"
+	CodeDecodeFailed       ErrorCode = "decode_failed"
+	CodeVerifyFailed       ErrorCode = "verify_failed"
+	CodeTxRejected         ErrorCode = "tx_rejected"
+	CodeStaleShare         ErrorCode = "stale_share"
+	CodeDuplicateShare     ErrorCode = "duplicate_share"
+	CodeLowDifficultyShare ErrorCode = "low_difficulty_share"
+	CodeInvalidShare       ErrorCode = "invalid_share"
+	CodeFailed             ErrorCode = "failed"
+	CodeUnavailable        ErrorCode = "unavailable"
+	CodeUpstreamError      ErrorCode = "upstream_error"
+	CodeInternal           ErrorCode = "internal"
+)
+
+// ErrorCodeInfo documents an error code and what it maps to in each
+// protocol
+type ErrorCodeInfo struct {
+	Code        ErrorCode `json:"code"`
+	HTTPStatus  int       `json:"http_status"`
+	RPCCode     int       `json:"rpc_code"`
+	StratumCode int       `json:"stratum_code"`
+	Description string    `json:"description"`
+}
+
+// errorRegistry is the registry of error codes, served at /api/errors.
+// Where several codes share a JSON-RPC code, the first is the one reported
+// for RPC errors raised with only a numeric code.
+var errorRegistry = []ErrorCodeInfo{
+	{CodeInvalidRequest, http.StatusBadRequest, RPCInvalidParams, stratumOtherError, "A parameter is missing or invalid"},
+	{CodeParseError, http.StatusBadRequest, RPCParseError, stratumOtherError, "The request is not valid JSON"},
+	{CodeMethodNotFound, http.StatusNotFound, RPCMethodNotFound, stratumOtherError, "No such method"},
+	{CodeUnauthorized, http.StatusUnauthorized, RPCMiscError, 24, "Credentials are missing or invalid"},
+	{CodeForbidden, http.StatusForbidden, RPCMiscError, 24, "The credentials don't allow this request"},
+	{CodeNotFound, http.StatusNotFound, RPCInvalidAddressOrKey, stratumOtherError, "The resource doesn't exist"},
+	{CodeConflict, http.StatusConflict, RPCMiscError, stratumOtherError, "The request conflicts with the resource's current state"},
+	{CodeRateLimited, http.StatusTooManyRequests, RPCMiscError, stratumOtherError, "Too many requests; retry later"},
+	{CodeInsufficientFunds, http.StatusBadRequest, RPCInsufficientFunds, stratumOtherError, "The wallet can't cover the amount"},
+	{CodeWalletError, http.StatusInternalServerError, RPCWalletError, stratumOtherError, "The wallet failed"},
+	{CodeDecodeFailed, http.StatusBadRequest, RPCDeserializationErr, stratumOtherError, "A transaction or block couldn't be decoded"},
+	{CodeVerifyFailed, http.StatusBadRequest, RPCVerifyError, stratumOtherError, "A transaction failed verification"},
+	{CodeTxRejected, http.StatusBadRequest, RPCVerifyRejected, stratumOtherError, "A transaction was rejected by policy"},
+	{CodeStaleShare, http.StatusBadRequest, RPCMiscError, 21, "The share's job is no longer current"},
+	{CodeDuplicateShare, http.StatusBadRequest, RPCMiscError, 22, "The share was already submitted"},
+	{CodeLowDifficultyShare, http.StatusBadRequest, RPCMiscError, 23, "The share's hash is above the worker's target"},
+	{CodeInvalidShare, http.StatusBadRequest, RPCMiscError, stratumOtherError, "The share's hash doesn't match its job and nonce"},
+	{CodeFailed, http.StatusBadRequest, RPCMiscError, stratumOtherError, "The request failed; see the message"},
+	{CodeUnavailable, http.StatusServiceUnavailable, RPCMiscError, stratumOtherError, "The feature is disabled or not ready"},
+	{CodeUpstreamError, http.StatusBadGateway, RPCMiscError, stratumOtherError, "An external service failed"},
+	{CodeInternal, http.StatusInternalServerError, RPCInternalError, stratumOtherError, "An unexpected error in the node"},
+}
+
+// errorCodeInfo returns the registry entry of code
+func errorCodeInfo(code ErrorCode) ErrorCodeInfo {
+	for _, info := range errorRegistry {
+		if info.Code == code {
+			return info
+		}
+	}
+	return errorCodeInfo(CodeInternal)
+}
+
+// errorCodeForRPC returns the error code of a JSON-RPC error code
+func errorCodeForRPC(rpcCode int) ErrorCode {
+	for _, info := range errorRegistry {
+		if info.RPCCode == rpcCode {
+			return info.Code
+		}
+	}
+	return CodeFailed
+}
+
+// APIError is an error reported to clients over REST, JSON-RPC or stratum.
+// Over REST the message is in "error", where clients looked for it before
+// errors had codes.
+type APIError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// apiError creates an APIError
+func apiError(code ErrorCode, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+// apiErrorf creates an APIError with a formatted message
+func apiErrorf(code ErrorCode, format string, args ...interface{}) *APIError {
+	return apiError(code, fmt.Sprintf(format, args...))
+}
+
+// WithDetail adds a detail to the error and returns it
+func (e *APIError) WithDetail(key string, value interface{}) *APIError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Status returns the HTTP status of the error
+func (e *APIError) Status() int {
+	return errorCodeInfo(e.Code).HTTPStatus
+}
+
+// RPCError returns the error as a JSON-RPC error
+func (e *APIError) RPCError() *RPCError {
+	return &RPCError{
+		Code:    errorCodeInfo(e.Code).RPCCode,
+		Message: e.Message,
+		Data:    &rpcErrorData{Code: e.Code, Details: e.Details},
+	}
+}
+
+// StratumError returns the error as a stratum error, [code, message,
+// traceback], with the error code in place of the traceback
+func (e *APIError) StratumError() []interface{} {
+	return []interface{}{errorCodeInfo(e.Code).StratumCode, e.Message, e.Code}
+}
+
+// toAPIError returns err as an APIError, with code if it isn't one
+func toAPIError(err error, code ErrorCode) *APIError {
+	switch e := err.(type) {
+	case *APIError:
+		return e
+	case *ShareError:
+		return e.APIError()
+	case *RPCError:
+		return apiError(errorCodeForRPC(e.Code), e.Message)
+	}
+	return apiError(code, err.Error())
+}
+
+// respondError writes err as the response, as an internal error unless it
+// is an APIError
+func respondError(c *gin.Context, err error) {
+	e := toAPIError(err, CodeInternal)
+	c.JSON(e.Status(), e)
+}
+
+// abortWithError writes err as the response and stops the handler chain
+func abortWithError(c *gin.Context, err error) {
+	e := toAPIError(err, CodeInternal)
+	c.AbortWithStatusJSON(e.Status(), e)
+}
+
+// registerErrorRoutes serves the error code registry
+func registerErrorRoutes(api *gin.RouterGroup) {
+	api.GET("/errors", func(c *gin.Context) {
+		c.JSON(http.StatusOK, errorRegistry)
+	})
+}
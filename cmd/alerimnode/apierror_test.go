@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorRegistry(t *testing.T) {
+	seen := make(map[ErrorCode]bool)
+	for _, info := range errorRegistry {
+		if seen[info.Code] {
+			t.Errorf("code %s registered twice", info.Code)
+		}
+		seen[info.Code] = true
+		if info.HTTPStatus < 400 || info.Description == "" {
+			t.Errorf("code %s: status %d, description %q", info.Code, info.HTTPStatus, info.Description)
+		}
+	}
+	for _, code := range rejectErrorCodes {
+		if !seen[code] {
+			t.Errorf("reject code %s isn't registered", code)
+		}
+	}
+
+	tests := []struct {
+		rpc  int
+		want ErrorCode
+	}{
+		{RPCInvalidParams, CodeInvalidRequest},
+		{RPCMethodNotFound, CodeMethodNotFound},
+		{RPCInvalidAddressOrKey, CodeNotFound},
+		{RPCMiscError, CodeUnauthorized},
+		{RPCVerifyRejected, CodeTxRejected},
+		{-999, CodeFailed},
+	}
+	for _, tt := range tests {
+		if got := errorCodeForRPC(tt.rpc); got != tt.want {
+			t.Errorf("errorCodeForRPC(%d) = %s, want %s", tt.rpc, got, tt.want)
+		}
+	}
+}
+
+func TestAPIErrorEncodings(t *testing.T) {
+	e := apiErrorf(CodeNotFound, "Miner %s not found", "m1").WithDetail("miner", "m1")
+
+	rpcErr := e.RPCError()
+	if rpcErr.Code != RPCInvalidAddressOrKey || rpcErr.Message != e.Message ||
+		rpcErr.Data.Code != CodeNotFound || rpcErr.Data.Details["miner"] != "m1" {
+		t.Errorf("RPCError = %+v", rpcErr)
+	}
+
+	stratumErr := rejectShare(RejectStale, "Stale share").APIError().StratumError()
+	if stratumErr[0] != 21 || stratumErr[1] != "Stale share" || stratumErr[2] != CodeStaleShare {
+		t.Errorf("StratumError = %v", stratumErr)
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		err        error
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{e, http.StatusNotFound, CodeNotFound},
+		{apiError(CodeRateLimited, "Slow down"), http.StatusTooManyRequests, CodeRateLimited},
+		{rpcErrorf(RPCInvalidParams, "Bad parameter"), http.StatusBadRequest, CodeInvalidRequest},
+		{errors.New("disk full"), http.StatusInternalServerError, CodeInternal},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondError(c, tt.err)
+
+		var body struct {
+			Code    ErrorCode              `json:"code"`
+			Error   string                 `json:"error"`
+			Details map[string]interface{} `json:"details"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.wantStatus || body.Code != tt.wantCode || body.Error != tt.err.Error() {
+			t.Errorf("respondError(%v) = %d %s", tt.err, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API key scopes
+const (
+	ScopeReadStats    = "read-stats"
+	ScopeSubmitTx     = "submit-tx"
+	ScopeManageMiners = "manage-miners"
+	ScopeRPC          = "rpc"
+)
+
+// apiKeyPrefix makes keys recognizable in logs and secret scanners
+const apiKeyPrefix = "aim_"
+
+// apiKeySaveInterval debounces persisting last-used times
+const apiKeySaveInterval = time.Minute
+
+var validScopes = map[string]bool{
+	ScopeReadStats:    true,
+	ScopeSubmitTx:     true,
+	ScopeManageMiners: true,
+	ScopeRPC:          true,
+}
+
+var (
+	errInvalidAPIKey   = errors.New("invalid API key")
+	errAPIKeyRateLimit = errors.New("API key rate limit exceeded")
+)
+
+// APIKey is a scoped credential for programmatic access. Only the SHA-256
+// hash of the key is stored.
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	KeyHash   string    `json:"-"`
+	RateLimit int       `json:"rate_limit"` // Requests per minute, 0 for unlimited
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+
+	windowStart time.Time
+	windowCount int
+}
+
+// storedAPIKey is the on-disk form of an API key, which unlike API
+// responses includes the key hash
+type storedAPIKey struct {
+	APIKey
+	KeyHash string `json:"key_hash"`
+}
+
+// HasScope reports whether the key grants the given scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore issues, authenticates and revokes API keys
+type APIKeyStore struct {
+	mu    sync.Mutex
+	path  string
+	keys  map[string]*APIKey // key hash -> key
+	dirty bool               // Last-used times changed since the last save
+}
+
+// NewAPIKeyStore loads the API keys persisted at path
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	store := &APIKeyStore{
+		path: path,
+		keys: make(map[string]*APIKey),
+	}
+
+	var keys []*storedAPIKey
+	if err := loadJSONFile(path, &keys); err != nil {
+		return nil, err
+	}
+	for _, stored := range keys {
+		key := stored.APIKey
+		key.KeyHash = stored.KeyHash
+		store.keys[key.KeyHash] = &key
+	}
+
+	go store.flushPeriodically()
+	return store, nil
+}
+
+// Issue creates a new key for a user and returns it with its plaintext
+// secret, which is never stored and can't be retrieved again
+func (s *APIKeyStore) Issue(userID, name string, scopes []string, rateLimit int) (*APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	if rateLimit < 0 {
+		return nil, "", errors.New("rate limit must not be negative")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return nil, "", errors.New("unknown scope: " + scope)
+		}
+	}
+
+	secret := apiKeyPrefix + randomToken()
+	key := &APIKey{
+		ID:        randomToken()[:16],
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		KeyHash:   hashAPIKey(secret),
+		RateLimit: rateLimit,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.KeyHash] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.KeyHash)
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+// Revoke deletes a user's key by ID
+func (s *APIKeyStore) Revoke(userID, keyID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.keys {
+		if key.ID == keyID && key.UserID == userID {
+			delete(s.keys, hash)
+			if err := s.save(); err != nil {
+				log.Printf("Error saving API keys: %v", err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// ListForUser returns all keys belonging to a user
+func (s *APIKeyStore) ListForUser(userID string) []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*APIKey, 0)
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Authenticate looks up a key by its secret, enforcing its rate limit and
+// recording its last use
+func (s *APIKeyStore) Authenticate(secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, errInvalidAPIKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.keys[hashAPIKey(secret)]
+	if !exists {
+		return nil, errInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.RateLimit > 0 {
+		if now.Sub(key.windowStart) > time.Minute {
+			key.windowStart = now
+			key.windowCount = 0
+		}
+		key.windowCount++
+		if key.windowCount > key.RateLimit {
+			return nil, errAPIKeyRateLimit
+		}
+	}
+
+	key.LastUsed = now
+	s.dirty = true
+	return key, nil
+}
+
+// Flush persists pending last-used times
+func (s *APIKeyStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// flushPeriodically saves last-used times at most once per interval
+func (s *APIKeyStore) flushPeriodically() {
+	ticker := time.NewTicker(apiKeySaveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Flush(); err != nil {
+			log.Printf("Error saving API keys: %v", err)
+		}
+	}
+}
+
+// save persists the keys; the caller must hold s.mu
+func (s *APIKeyStore) save() error {
+	keys := make([]*storedAPIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, &storedAPIKey{APIKey: *key, KeyHash: key.KeyHash})
+	}
+	if err := saveJSONFile(s.path, keys); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// RegisterRoutes adds the per-user API key management endpoints
+func (s *APIKeyStore) RegisterRoutes(api *gin.RouterGroup) {
+	api.POST("/users/:id/apikeys", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Name      string   `json:"name"`
+			Scopes    []string `json:"scopes"`
+			RateLimit int      `json:"rate_limit"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		if findUser(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "User not found"))
+			return
+		}
+
+		key, secret, err := s.Issue(c.Param("id"), req.Name, req.Scopes, req.RateLimit)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"key":     secret,
+			"api_key": key,
+		})
+	})
+
+	api.GET("/users/:id/apikeys", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.ListForUser(c.Param("id")))
+	})
+
+	api.DELETE("/users/:id/apikeys/:keyid", authMiddleware(""), func(c *gin.Context) {
+		if !s.Revoke(c.Param("id"), c.Param("keyid")) {
+			respondError(c, apiError(CodeNotFound, "API key not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+	})
+}
+
+// findUser returns the registered user with the given ID
+func findUser(id string) *User {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, user := range users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// userCount returns the number of registered users
+func userCount() int {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return len(users)
+}
+
+// hashAPIKey returns the storage hash of an API key secret
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyIssueValidation(t *testing.T) {
+	store, err := NewAPIKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		scopes    []string
+		rateLimit int
+		wantErr   bool
+	}{
+		{"single scope", []string{ScopeReadStats}, 0, false},
+		{"all scopes", []string{ScopeReadStats, ScopeSubmitTx, ScopeManageMiners}, 60, false},
+		{"no scopes", nil, 0, true},
+		{"unknown scope", []string{"admin"}, 0, true},
+		{"negative rate limit", []string{ScopeReadStats}, -1, true},
+	}
+
+	for _, test := range tests {
+		_, secret, err := store.Issue("user1", test.name, test.scopes, test.rateLimit)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+		if err == nil && !strings.HasPrefix(secret, apiKeyPrefix) {
+			t.Errorf("%s: secret %q lacks prefix", test.name, secret)
+		}
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	store, err := NewAPIKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, secret, err := store.Issue("user1", "stats", []string{ScopeReadStats}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr error
+	}{
+		{"missing prefix", "nope", errInvalidAPIKey},
+		{"unknown key", apiKeyPrefix + "unknown", errInvalidAPIKey},
+		{"first use", secret, nil},
+		{"second use", secret, nil},
+		{"over rate limit", secret, errAPIKeyRateLimit},
+	}
+
+	for _, test := range tests {
+		got, err := store.Authenticate(test.secret)
+		if err != test.wantErr {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && got.ID != key.ID {
+			t.Errorf("%s: authenticated key %s, want %s", test.name, got.ID, key.ID)
+		}
+	}
+
+	if !key.HasScope(ScopeReadStats) || key.HasScope(ScopeSubmitTx) {
+		t.Errorf("unexpected scopes %v", key.Scopes)
+	}
+}
+
+func TestAPIKeyPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	store, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, secret, err := store.Issue("user1", "stats", []string{ScopeReadStats}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("reloaded store rejects key: %v", err)
+	}
+	if got.ID != key.ID || got.LastUsed.IsZero() {
+		t.Errorf("reloaded key = %+v", got)
+	}
+
+	// The hash is persisted but never part of API responses
+	data, err := json.Marshal(reloaded.ListForUser("user1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), key.KeyHash) {
+		t.Errorf("API response leaks key hash: %s", data)
+	}
+
+	if !reloaded.Revoke("user1", key.ID) {
+		t.Error("revoke failed")
+	}
+	if _, err := reloaded.Authenticate(secret); err != errInvalidAPIKey {
+		t.Errorf("revoked key: err = %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audited actions
+const (
+	AuditBalanceAdjustment = "balance-adjustment"
+	AuditVarDiffConfig     = "vardiff-config"
+	AuditVarDiffReset      = "vardiff-reset"
+)
+
+// maxAuditListed caps the entries one audit log request returns
+const maxAuditListed = 500
+
+// AuditEntry records an operator action that changed pool state outside
+// the normal flow of shares and payouts
+type AuditEntry struct {
+	ID      string                 `json:"id"`
+	Time    time.Time              `json:"time"`
+	Actor   string                 `json:"actor"`  // Who acted, e.g. "admin:alice"
+	Action  string                 `json:"action"` // One of the Audit* constants
+	Target  string                 `json:"target"` // What was acted on, e.g. a miner ID
+	Reason  string                 `json:"reason"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditLog is the append-only record of operator actions. Entries are
+// never removed; their target is only rewritten when its owner's data is
+// anonymized.
+type AuditLog struct {
+	mu      sync.RWMutex
+	path    string
+	entries []*AuditEntry
+}
+
+// NewAuditLog loads the audit log persisted at path
+func NewAuditLog(path string) (*AuditLog, error) {
+	a := &AuditLog{path: path}
+	if err := loadJSONFile(path, &a.entries); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Record appends an entry and returns it
+func (a *AuditLog) Record(actor, action, target, reason string, details map[string]interface{}) *AuditEntry {
+	entry := &AuditEntry{
+		ID:      randomToken()[:16],
+		Time:    time.Now(),
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Reason:  reason,
+		Details: details,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, entry)
+	if a.path != "" {
+		if err := saveJSONFile(a.path, a.entries); err != nil {
+			log.Printf("Error saving audit log: %v", err)
+		}
+	}
+	return entry
+}
+
+// List returns up to limit entries, newest first, optionally only those
+// acting on target
+func (a *AuditLog) List(target string, limit int) []*AuditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	entries := make([]*AuditEntry, 0)
+	for i := len(a.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if target == "" || a.entries[i].Target == target {
+			entries = append(entries, a.entries[i])
+		}
+	}
+	return entries
+}
+
+// Anonymize replaces target in every entry, e.g. a deleted miner's ID
+// with its pseudonym
+func (a *AuditLog) Anonymize(target, pseudonym string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	changed := false
+	for _, entry := range a.entries {
+		if entry.Target == target {
+			entry.Target = pseudonym
+			changed = true
+		}
+	}
+	if changed && a.path != "" {
+		if err := saveJSONFile(a.path, a.entries); err != nil {
+			log.Printf("Error saving audit log: %v", err)
+		}
+	}
+}
+
+// requestActor identifies who made an authenticated request, for the
+// audit log
+func requestActor(c *gin.Context) string {
+	if v, ok := c.Get("session"); ok {
+		return "admin:" + v.(*Session).Username
+	}
+	if v, ok := c.Get("apikey"); ok {
+		key := v.(*APIKey)
+		return fmt.Sprintf("apikey:%s (user %s)", key.ID, key.UserID)
+	}
+	return "unknown"
+}
+
+// RegisterRoutes adds the audit log endpoint, which requires an admin
+// session
+func (a *AuditLog) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/admin/audit", authMiddleware(""), func(c *gin.Context) {
+		limit := maxAuditListed
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				respondError(c, apiError(CodeInvalidRequest, "Invalid limit"))
+				return
+			}
+			if n < limit {
+				limit = n
+			}
+		}
+		c.JSON(http.StatusOK, a.List(c.Query("target"), limit))
+	})
+}
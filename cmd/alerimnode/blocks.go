@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBlocksLimit = 50
+	maxBlocksLimit     = 500
+)
+
+// registerBlockRoutes adds the public list of blocks found by the pool,
+// paginated with offset and limit, and filtered by the status of their
+// rounds if a status is given. Finders who opted out of the leaderboard
+// are shown under their leaderboard pseudonym.
+func registerBlockRoutes(api *gin.RouterGroup, rewards *RewardManager, lb *Leaderboard) {
+	api.GET("/pool/blocks", func(c *gin.Context) {
+		status := c.Query("status")
+		switch status {
+		case "", RoundPending, RoundConfirmed, RoundOrphaned:
+		default:
+			respondError(c, apiError(CodeInvalidRequest, "status must be pending, confirmed or orphaned"))
+			return
+		}
+		limit, err := queryInt(c, "limit", defaultBlocksLimit)
+		if err != nil || limit < 1 || limit > maxBlocksLimit {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid limit"))
+			return
+		}
+		offset, err := queryInt(c, "offset", 0)
+		if err != nil || offset < 0 {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid offset"))
+			return
+		}
+
+		blocks, total := rewards.FoundBlocks(status, offset, limit)
+		for i := range blocks {
+			if blocks[i].Finder != "" {
+				blocks[i].Finder = lb.publicName(blocks[i].Finder)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"total":  total,
+			"offset": offset,
+			"blocks": blocks,
+		})
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// bootstrapProgressEvery is how many imported blocks pass between
+// progress log lines
+const bootstrapProgressEvery = 1000
+
+// importBootstrapFile imports a bootstrap file into the chain. Blocks
+// before a bad one stay connected, so the node can sync the rest from
+// peers.
+func importBootstrapFile(bc *blockchain.Blockchain, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Printf("Importing blocks from %s", path)
+	n, err := bc.ImportBootstrap(f, func(height int) {
+		if height%bootstrapProgressEvery == 0 {
+			log.Printf("Imported blocks to height %d", height)
+		}
+	})
+	log.Printf("Imported %d blocks from %s; height %d", n, path, bc.GetHeight())
+	return err
+}
+
+// registerBootstrapRoutes adds the bootstrap file export, which requires
+// an admin session
+func registerBootstrapRoutes(api *gin.RouterGroup, bc *blockchain.Blockchain) {
+	api.GET("/admin/bootstrap.dat", authMiddleware(""), func(c *gin.Context) {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", `attachment; filename="bootstrap.dat"`)
+		if _, err := bc.ExportBootstrap(c.Writer); err != nil {
+			log.Printf("Error exporting bootstrap file: %v", err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func init() {
+	subcommands["chainparams"] = runChainParams
+}
+
+// runChainParams implements the chainparams subcommand:
+//
+//	alerimnode chainparams export [-network name] [-out file]
+//	alerimnode chainparams sign -in params.json [-out file]
+//	alerimnode chainparams verify -file file -pubkey hex
+//
+// export signs the parameters of a built-in network, sign those of a custom
+// network (a fork or private chain) given as unsigned ChainParams JSON. The
+// signing key is read as hex from ALERIM_CHAINPARAMS_KEY.
+func runChainParams(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: alerimnode chainparams export|sign|verify [flags]")
+	}
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("chainparams export", flag.ContinueOnError)
+		network := fs.String("network", "mainnet", "Network whose parameters to export")
+		out := fs.String("out", "", "Output file (default: stdout)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		params, ok := blockchain.ParamsForNetwork(*network)
+		if !ok {
+			return fmt.Errorf("unknown network: %s", *network)
+		}
+		return signChainParams(params, *out)
+
+	case "sign":
+		fs := flag.NewFlagSet("chainparams sign", flag.ContinueOnError)
+		in := fs.String("in", "", "Unsigned chain parameters JSON")
+		out := fs.String("out", "", "Output file (default: stdout)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *in == "" {
+			return errors.New("-in is required")
+		}
+
+		data, err := os.ReadFile(*in)
+		if err != nil {
+			return err
+		}
+		var params blockchain.ChainParams
+		if err := json.Unmarshal(data, &params); err != nil {
+			return fmt.Errorf("malformed chain parameters: %v", err)
+		}
+		return signChainParams(&params, *out)
+
+	case "verify":
+		fs := flag.NewFlagSet("chainparams verify", flag.ContinueOnError)
+		file := fs.String("file", "", "Signed chain parameters file")
+		pubKey := fs.String("pubkey", "", "Comma-separated trusted public keys (hex)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		params, err := loadChainParamsFile(*file, *pubKey)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(params, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown chainparams command: %s", args[0])
+	}
+}
+
+// signChainParams signs parameters with the key in ALERIM_CHAINPARAMS_KEY
+// and writes the signed file to out, or stdout if out is empty
+func signChainParams(params *blockchain.ChainParams, out string) error {
+	keyHex := os.Getenv(envPrefix + "CHAINPARAMS_KEY")
+	if keyHex == "" {
+		return errors.New("ALERIM_CHAINPARAMS_KEY is not set")
+	}
+	key, err := parsePrivateKey([]byte(keyHex))
+	if err != nil {
+		return err
+	}
+
+	data, err := blockchain.ExportSignedParams(params, key)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = fmt.Println(string(data))
+		return err
+	}
+	return os.WriteFile(out, data, 0644)
+}
+
+// loadChainParamsFile reads and verifies a signed chain parameters file
+func loadChainParamsFile(path, trustedKeys string) (*blockchain.ChainParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.LoadSignedParams(data, splitList(trustedKeys))
+}
+
+// parseCheckpoints parses a comma-separated list of height:hash checkpoints
+func parseCheckpoints(s string) ([]blockchain.Checkpoint, error) {
+	var checkpoints []blockchain.Checkpoint
+	for _, item := range splitList(s) {
+		heightStr, hashHex, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("checkpoint %q is not height:hash", item)
+		}
+		height, err := strconv.Atoi(heightStr)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q has an invalid height", item)
+		}
+		hash, err := parseHash(hashHex)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %v", item, err)
+		}
+		cp := blockchain.Checkpoint{Height: height}
+		copy(cp.Hash[:], hash)
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCheckpoints(t *testing.T) {
+	hash := strings.Repeat("00", 31) + "ff"
+	checkpoints, err := parseCheckpoints("100:" + hash + ", 200:" + hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 2 || checkpoints[1].Height != 200 || checkpoints[1].Hash[31] != 0xff {
+		t.Errorf("parseCheckpoints = %v", checkpoints)
+	}
+
+	for _, s := range []string{"100", "x:" + hash, "100:abcd"} {
+		if _, err := parseCheckpoints(s); err == nil {
+			t.Errorf("parseCheckpoints(%q) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// subcommands maps a subcommand name to its implementation. The node itself
+// runs when no subcommand is given.
+var subcommands = map[string]func(args []string) error{
+	"encrypt-secret": runEncryptSecret,
+	"verify-backup":  runVerifyBackup,
+}
+
+// runSubcommand runs the subcommand named in os.Args, if any. It reports
+// whether a subcommand was run.
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	cmd, ok := subcommands[os.Args[1]]
+	if !ok {
+		return false
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// readAllStdin reads standard input to EOF
+func readAllStdin() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Settings may also come from the file given to -conf, one name=value per
+// line as the flag takes it, with # starting a comment:
+//
+//	minrelayfee=0.0001
+//	rpcallowip=10.0.0.0/8,127.0.0.1
+//
+// Flags given on the command line or through the environment take
+// precedence over the file. On SIGHUP the node rereads the file and applies
+// the settings in reloadableFlags; the others take effect on restart.
+
+// reloadableFlags are the settings applied again when the node reloads its
+// config file
+var reloadableFlags = []string{
+	"minrelayfee", "dustthreshold", "maxstandardtxsize", "blockmaxsize", "maxmempoolsize", "maxmempooltxs",
+	"rpcallowip", "rpcdenyip", "stratumallowip", "stratumdenyip", "p2pallowip", "p2pdenyip",
+}
+
+// commandLineFlags returns the names of the flags given on the command line.
+// Call it before any flag is set otherwise.
+func commandLineFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// parseConfigFile reads the settings of a config file, by flag name
+func parseConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected name=value", path, line)
+		}
+		if flag.Lookup(name) == nil || name == "conf" {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", path, line, name)
+		}
+		settings[name] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// applyConfigFile sets flags from a config file, skipping those in cmdLine
+// or set through the environment. With only, it applies just those flags,
+// resetting any the file leaves out to their defaults, so a setting
+// removed from the file is undone on reload.
+func applyConfigFile(path string, cmdLine map[string]bool, only []string) error {
+	settings, err := parseConfigFile(path)
+	if err != nil {
+		return err
+	}
+	names := only
+	if names == nil {
+		for name := range settings {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if cmdLine[name] {
+			continue
+		}
+		if _, ok := os.LookupEnv(envName(name)); ok {
+			continue
+		}
+		f := flag.Lookup(name)
+		value, ok := settings[name]
+		if !ok {
+			value = f.DefValue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %v", path, value, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"minrelayfee", "maxmempooltxs", "rpcallowip", "blocknotify"} {
+			f := flag.Lookup(name)
+			f.Value.Set(f.DefValue)
+		}
+	}()
+	path := filepath.Join(t.TempDir(), "alerim.conf")
+	write := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# Relay policy\nminrelayfee = 0.001\nmaxmempooltxs=500\n\nrpcallowip=10.0.0.0/8\nblocknotify=notify.sh %s\n")
+	if err := applyConfigFile(path, map[string]bool{"maxmempooltxs": true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if minRelayFee.String() != "0.001" || *rpcAllowIP != "10.0.0.0/8" || *blockNotify != "notify.sh %s" {
+		t.Errorf("settings = %s, %q, %q", minRelayFee, *rpcAllowIP, *blockNotify)
+	}
+	if *maxMempoolTxs == 500 {
+		t.Error("config file overrode a command-line flag")
+	}
+
+	// Reloading resets the reloadable settings left out of the file and
+	// leaves the others alone
+	write("minrelayfee=0.002\n")
+	if err := applyConfigFile(path, nil, reloadableFlags); err != nil {
+		t.Fatal(err)
+	}
+	if minRelayFee.String() != "0.002" || *rpcAllowIP != "" || *blockNotify != "notify.sh %s" {
+		t.Errorf("reloaded settings = %s, %q, %q", minRelayFee, *rpcAllowIP, *blockNotify)
+	}
+
+	for _, contents := range []string{"nosuchflag=1\n", "minrelayfee\n", "conf=other.conf\n", "maxmempooltxs=many\n"} {
+		write(contents)
+		if err := applyConfigFile(path, nil, nil); err == nil {
+			t.Errorf("config file %q accepted", contents)
+		}
+	}
+}
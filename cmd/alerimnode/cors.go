@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORSPolicies selects a CORS policy per route, so the public API can be
+// open to any origin while the admin API only answers an allowlist
+type CORSPolicies struct {
+	routes   []corsRoute
+	fallback gin.HandlerFunc
+}
+
+type corsRoute struct {
+	prefix string
+	policy gin.HandlerFunc
+}
+
+// NewCORSPolicies creates a policy set using fallback for unmatched routes
+func NewCORSPolicies(fallback gin.HandlerFunc) *CORSPolicies {
+	return &CORSPolicies{fallback: fallback}
+}
+
+// Route applies policy to every request path starting with prefix. The
+// longest matching prefix wins.
+func (p *CORSPolicies) Route(prefix string, policy gin.HandlerFunc) *CORSPolicies {
+	p.routes = append(p.routes, corsRoute{prefix: prefix, policy: policy})
+	return p
+}
+
+// Middleware returns the router-level middleware dispatching to the
+// policies. It runs before routing so preflight requests are answered
+// even for paths that only register GET/POST handlers.
+func (p *CORSPolicies) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		policy := p.fallback
+		longest := -1
+		for _, route := range p.routes {
+			if strings.HasPrefix(path, route.prefix) && len(route.prefix) > longest {
+				policy = route.policy
+				longest = len(route.prefix)
+			}
+		}
+		policy(c)
+	}
+}
+
+// publicCORS allows any origin without credentials, which is what browsers
+// accept for a wildcard origin
+func publicCORS(origins []string) gin.HandlerFunc {
+	config := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: false,
+		MaxAge:           12 * time.Hour,
+	}
+	if len(origins) == 0 || (len(origins) == 1 && origins[0] == "*") {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = origins
+	}
+	return cors.New(config)
+}
+
+// adminCORS only allows the configured origins, with credentials. An empty
+// allowlist rejects all cross-origin requests (same-origin still works).
+func adminCORS(origins []string) gin.HandlerFunc {
+	config := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+	if len(origins) == 0 {
+		config.AllowOriginFunc = func(string) bool { return false }
+	} else {
+		config.AllowOrigins = origins
+	}
+	return cors.New(config)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// envPrefix is prepended to flag names to form their environment variables
+const envPrefix = "ALERIM_"
+
+// DataDir describes the on-disk layout of a node's data directory
+type DataDir struct {
+	Root string
+}
+
+// defaultDataDir returns the data directory used when none is configured
+func defaultDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".alerim"
+	}
+	return filepath.Join(home, ".alerim")
+}
+
+// Blocks returns the directory holding raw block data
+func (d *DataDir) Blocks() string {
+	return filepath.Join(d.Root, "blocks")
+}
+
+// Chainstate returns the directory holding chain state and indexes
+func (d *DataDir) Chainstate() string {
+	return filepath.Join(d.Root, "chainstate")
+}
+
+// Wallets returns the directory holding wallet files
+func (d *DataDir) Wallets() string {
+	return filepath.Join(d.Root, "wallets")
+}
+
+// Pool returns the directory holding mining pool state
+func (d *DataDir) Pool() string {
+	return filepath.Join(d.Root, "pool")
+}
+
+// Logs returns the directory for log files, e.g. when the node's output
+// is redirected there
+func (d *DataDir) Logs() string {
+	return filepath.Join(d.Root, "logs")
+}
+
+// Init creates the data directory layout if it doesn't exist yet
+func (d *DataDir) Init() error {
+	for _, dir := range []string{d.Root, d.Blocks(), d.Chainstate(), d.Wallets(), d.Pool(), d.Logs()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// applyEnvConfig sets every flag not given on the command line from its
+// environment variable, e.g. -p2p from ALERIM_P2P and -blocknotify from
+// ALERIM_BLOCKNOTIFY. Command-line flags always take precedence.
+func applyEnvConfig() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := envName(f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if e := f.Value.Set(value); e != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", value, name, e)
+			}
+		}
+	})
+	return err
+}
+
+// envName returns the environment variable setting a flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// amountFlag defines a flag taking a decimal number of coins
+func amountFlag(name string, value blockchain.Amount, usage string) *blockchain.Amount {
+	amount := value
+	flag.Var(&amount, name, usage)
+	return &amount
+}
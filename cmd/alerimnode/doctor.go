@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func init() {
+	subcommands["doctor"] = runDoctor
+}
+
+// Doctor check outcomes
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+const (
+	// clockSkewWarn and clockSkewFail bound the local clock's offset from
+	// the reference clock; peers distrust a node past the failure bound
+	clockSkewWarn = time.Minute
+	clockSkewFail = 5 * time.Minute
+
+	// doctorDialTimeout bounds every network probe of the doctor
+	doctorDialTimeout = 5 * time.Second
+)
+
+// DoctorCheck is the outcome of one diagnostic
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// DoctorReport collects the outcome of every diagnostic
+type DoctorReport struct {
+	Time   time.Time     `json:"time"`
+	Checks []DoctorCheck `json:"checks"`
+}
+
+func (r *DoctorReport) add(name, status, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Failed reports whether any check failed
+func (r *DoctorReport) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText prints the report as one line per check
+func (r *DoctorReport) WriteText(w io.Writer) {
+	for _, check := range r.Checks {
+		fmt.Fprintf(w, "[%-4s] %-18s %s\n", strings.ToUpper(check.Status), check.Name, check.Detail)
+	}
+}
+
+// runDoctor implements the doctor subcommand:
+//
+//	alerimnode doctor [-json] [-timeurl url] [-samples n] [node flags]
+//
+// It takes the node's own flags and environment, so it diagnoses exactly
+// the configuration the node would start with, and exits non-zero if any
+// check fails. The node must not be running, or its ports show as taken.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	timeURL := fs.String("timeurl", "https://www.google.com", "URL whose Date header is the reference clock (empty to skip)")
+	samples := fs.Int("samples", 100, "Number of blocks to re-validate")
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Mark node flags given on the command line so the environment doesn't
+	// override them
+	fs.Visit(func(f *flag.Flag) {
+		if flag.Lookup(f.Name) != nil {
+			flag.Set(f.Name, f.Value.String())
+		}
+	})
+	if err := applyEnvConfig(); err != nil {
+		return err
+	}
+
+	report := &DoctorReport{Time: time.Now()}
+	dataDir := &DataDir{Root: *dataDirFlag}
+	checkDataDir(report, dataDir)
+	checkSchema(report, dataDir)
+
+	p2p := *p2pPort
+	params := &blockchain.MainNetParams
+	if *chainParamsFile != "" {
+		loaded, err := loadChainParamsFile(*chainParamsFile, *chainParamsKeys)
+		if err != nil {
+			report.add("chainparams", checkFail, "%v", err)
+		} else {
+			params = loaded
+			report.add("chainparams", checkOK, "network %s", params.Name)
+		}
+	}
+	if p2p == 0 {
+		p2p = params.DefaultPort
+	}
+	if listeners, err := configuredListeners(p2p); err != nil {
+		report.add("ports", checkFail, "%v", err)
+	} else {
+		checkPorts(report, listeners)
+	}
+	checkClock(report, *timeURL)
+
+	if *secretsDir == "" {
+		*secretsDir = filepath.Join(dataDir.Root, "secrets")
+	}
+	checkWallet(report, *secretsProvider, *secretsDir, *secretsCommand)
+	checkChainstate(report, blockchain.NewBlockchainWithParams(params), *samples)
+	peerAddrs := append(splitList(*pinnedPeers), splitList(*peers)...)
+	if len(peerAddrs) == 0 {
+		peerAddrs = params.Seeds
+	}
+	checkPeers(report, peerAddrs, params.DefaultPort)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if report.Failed() {
+		return fmt.Errorf("some checks failed")
+	}
+	return nil
+}
+
+// checkDataDir checks that the data directory layout exists and is
+// writable, and that every JSON state file parses
+func checkDataDir(report *DoctorReport, d *DataDir) {
+	before := len(report.Checks)
+	for _, dir := range []string{d.Root, d.Blocks(), d.Chainstate(), d.Wallets(), d.Pool()} {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			report.add("datadir", checkWarn, "%s does not exist yet; the node creates it on start", dir)
+			continue
+		} else if err != nil {
+			report.add("datadir", checkFail, "%v", err)
+			continue
+		}
+		if !info.IsDir() {
+			report.add("datadir", checkFail, "%s is not a directory", dir)
+			continue
+		}
+		probe, err := os.CreateTemp(dir, ".doctor-*")
+		if err != nil {
+			report.add("datadir", checkFail, "%s is not writable: %v", dir, err)
+			continue
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+
+	for _, dir := range []string{d.Root, d.Pool()} {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, file := range files {
+			var v interface{}
+			if err := loadJSONFile(file, &v); err != nil {
+				report.add("datadir", checkFail, "%s is corrupt: %v", file, err)
+			}
+		}
+		if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.json.tmp")); len(leftovers) > 0 {
+			report.add("datadir", checkWarn, "interrupted writes left %s", strings.Join(leftovers, ", "))
+		}
+	}
+
+	if len(report.Checks) == before {
+		report.add("datadir", checkOK, "%s", d.Root)
+	}
+}
+
+// checkSchema checks that the data directory's schema version is one the
+// node can run with, possibly after migrating
+func checkSchema(report *DoctorReport, d *DataDir) {
+	version, err := d.SchemaVersion()
+	latest := latestSchemaVersion(migrations)
+	switch {
+	case err != nil:
+		report.add("schema", checkFail, "%v", err)
+	case version > latest:
+		report.add("schema", checkFail, "schema version %d is newer than this node supports (%d)", version, latest)
+	case version < latest:
+		report.add("schema", checkWarn, "schema version %d will be migrated to %d on start", version, latest)
+	default:
+		report.add("schema", checkOK, "schema version %d", version)
+	}
+}
+
+// checkPorts checks that no two of the node's listeners claim the same
+// port and that each one's addresses are free
+func checkPorts(report *DoctorReport, listeners []ListenerConfig) {
+	if err := checkListenerConflicts(listeners); err != nil {
+		report.add("ports", checkFail, "%v", err)
+	}
+	for _, l := range listeners {
+		listener, err := blockchain.Listen(l.Addrs)
+		if err != nil {
+			report.add("port "+l.Name, checkFail, "%s is unavailable: %v", strings.Join(l.Addrs, ", "), err)
+			continue
+		}
+		listener.Close()
+		report.add("port "+l.Name, checkOK, "%s is free", strings.Join(l.Addrs, ", "))
+	}
+}
+
+// checkClock compares the local clock with the Date header of url
+func checkClock(report *DoctorReport, url string) {
+	if url == "" {
+		report.add("clock", checkSkip, "no reference clock configured")
+		return
+	}
+
+	client := &http.Client{Timeout: doctorDialTimeout}
+	start := time.Now()
+	resp, err := client.Head(url)
+	if err != nil {
+		report.add("clock", checkWarn, "reference clock unreachable: %v", err)
+		return
+	}
+	resp.Body.Close()
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		report.add("clock", checkWarn, "%s sent no usable Date header", url)
+		return
+	}
+
+	// The Date header has one-second resolution and was set somewhere
+	// during the round trip
+	local := start.Add(time.Since(start) / 2)
+	skew := local.Sub(remote).Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs > clockSkewFail:
+		report.add("clock", checkFail, "local clock is off by %v", skew)
+	case abs > clockSkewWarn:
+		report.add("clock", checkWarn, "local clock is off by %v", skew)
+	default:
+		report.add("clock", checkOK, "local clock is off by %v", skew)
+	}
+}
+
+// checkWallet checks that the pool wallet key can be loaded and decrypted
+func checkWallet(report *DoctorReport, kind, dir, command string) {
+	secrets, err := NewSecretProvider(kind, dir, os.Getenv(envPrefix+"SECRETS_PASSPHRASE"), command)
+	if err != nil {
+		report.add("wallet", checkFail, "%v", err)
+		return
+	}
+	secret, err := secrets.GetSecret(SecretPoolWalletKey)
+	if err == ErrSecretNotFound {
+		report.add("wallet", checkWarn, "no %s secret; payouts are disabled", SecretPoolWalletKey)
+		return
+	} else if err != nil {
+		report.add("wallet", checkFail, "can't load %s: %v", SecretPoolWalletKey, err)
+		return
+	}
+	if _, err := parsePrivateKey(secret); err != nil {
+		report.add("wallet", checkFail, "invalid %s: %v", SecretPoolWalletKey, err)
+		return
+	}
+	report.add("wallet", checkOK, "%s decrypts to a valid key", SecretPoolWalletKey)
+}
+
+// checkChainstate re-validates a sample of the chain's blocks
+func checkChainstate(report *DoctorReport, bc *blockchain.Blockchain, samples int) {
+	checked, err := bc.SpotCheck(samples)
+	if err != nil {
+		report.add("chainstate", checkFail, "%v", err)
+		return
+	}
+	report.add("chainstate", checkOK, "%d of %d blocks re-validated", checked, bc.GetHeight()+1)
+}
+
+// checkPeers checks that every configured peer accepts connections, on
+// defaultPort if it gives none
+func checkPeers(report *DoctorReport, addrs []string, defaultPort int) {
+	if len(addrs) == 0 {
+		report.add("peers", checkSkip, "no peers configured")
+		return
+	}
+	for _, addr := range addrs {
+		dialAddr, err := blockchain.NormalizeAddress(addr, defaultPort)
+		if err != nil {
+			report.add("peer "+addr, checkFail, "%v", err)
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", dialAddr, doctorDialTimeout)
+		if err != nil {
+			report.add("peer "+addr, checkFail, "unreachable: %v", err)
+			continue
+		}
+		conn.Close()
+		report.add("peer "+addr, checkOK, "reachable")
+	}
+}
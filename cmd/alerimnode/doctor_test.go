@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckDataDir(t *testing.T) {
+	d := &DataDir{Root: t.TempDir()}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	report := &DoctorReport{}
+	checkDataDir(report, d)
+	if len(report.Checks) != 1 || report.Checks[0].Status != checkOK {
+		t.Fatalf("healthy data dir: %+v", report.Checks)
+	}
+
+	if err := os.WriteFile(filepath.Join(d.Pool(), "rewards.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report = &DoctorReport{}
+	checkDataDir(report, d)
+	if !report.Failed() {
+		t.Errorf("corrupt state file not reported: %+v", report.Checks)
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	report := &DoctorReport{}
+	checkPorts(report, []ListenerConfig{{Name: ListenerAPI, Addrs: []string{listener.Addr().String()}}})
+	if !report.Failed() {
+		t.Errorf("port in use not reported: %+v", report.Checks)
+	}
+}
+
+func TestCheckPeers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reachable := listener.Addr().String()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+	defer listener.Close()
+
+	report := &DoctorReport{}
+	checkPeers(report, []string{reachable, unreachable, "127.0.0.1:port"}, 9000)
+	if len(report.Checks) != 3 {
+		t.Fatalf("got %d checks, want 3", len(report.Checks))
+	}
+	if report.Checks[0].Status != checkOK || report.Checks[1].Status != checkFail || report.Checks[2].Status != checkFail {
+		t.Errorf("checks = %+v", report.Checks)
+	}
+}
+
+func TestCheckClock(t *testing.T) {
+	tests := []struct {
+		offset time.Duration
+		want   string
+	}{
+		{0, checkOK},
+		{2 * time.Minute, checkWarn},
+		{-time.Hour, checkFail},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(tt.offset).UTC().Format(http.TimeFormat))
+		}))
+		report := &DoctorReport{}
+		checkClock(report, server.URL)
+		server.Close()
+
+		if got := report.Checks[0].Status; got != tt.want {
+			t.Errorf("offset %v: status %s, want %s (%s)", tt.offset, got, tt.want, report.Checks[0].Detail)
+		}
+	}
+}
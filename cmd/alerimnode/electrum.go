@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+const (
+	// electrumProtocolVersion is the Electrum protocol version served
+	electrumProtocolVersion = "1.4"
+
+	// electrumMaxRequest bounds the size of one request line; it must hold
+	// a hex-encoded transaction of the largest standard size
+	electrumMaxRequest = 1 << 20
+)
+
+// electrumRequest is a JSON-RPC request of an Electrum client
+type electrumRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// electrumResponse is a successful JSON-RPC 2.0 response; result must be
+// present even when null
+type electrumResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id"`
+	Result  interface{} `json:"result"`
+}
+
+// electrumErrorResponse is a failed JSON-RPC 2.0 response
+type electrumErrorResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id"`
+	Error   *RPCError   `json:"error"`
+}
+
+// electrumNotification is a JSON-RPC 2.0 notification to a subscriber
+type electrumNotification struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// electrumHandler implements one Electrum method
+type electrumHandler func(s *electrumSession, params []json.RawMessage) (interface{}, error)
+
+// electrumMethods maps Electrum method names to their handlers
+var electrumMethods = map[string]electrumHandler{
+	"server.version":                    (*electrumSession).serverVersion,
+	"server.banner":                     (*electrumSession).serverBanner,
+	"server.features":                   (*electrumSession).serverFeatures,
+	"server.ping":                       (*electrumSession).serverPing,
+	"blockchain.headers.subscribe":      (*electrumSession).headersSubscribe,
+	"blockchain.block.header":           (*electrumSession).blockHeader,
+	"blockchain.estimatefee":            (*electrumSession).relayFee,
+	"blockchain.relayfee":               (*electrumSession).relayFee,
+	"blockchain.scripthash.get_balance": (*electrumSession).scriptHashBalance,
+	"blockchain.scripthash.get_history": (*electrumSession).scriptHashHistory,
+	"blockchain.scripthash.get_mempool": (*electrumSession).scriptHashMempool,
+	"blockchain.scripthash.listunspent": (*electrumSession).scriptHashUnspent,
+	"blockchain.scripthash.subscribe":   (*electrumSession).scriptHashSubscribe,
+	"blockchain.scripthash.unsubscribe": (*electrumSession).scriptHashUnsubscribe,
+	"blockchain.transaction.get":        (*electrumSession).transactionGet,
+	"blockchain.transaction.get_merkle": (*electrumSession).transactionGetMerkle,
+	"blockchain.transaction.broadcast":  (*electrumSession).transactionBroadcast,
+}
+
+// ElectrumServer serves the Electrum protocol so existing light wallets
+// can use the node as their backend. Only confirmed transactions are
+// indexed; mempool transactions show once they are mined.
+type ElectrumServer struct {
+	chain    *blockchain.Blockchain
+	network  *blockchain.Network
+	index    *ElectrumIndex
+	listener net.Listener
+
+	mu       sync.Mutex
+	sessions map[*electrumSession]bool
+}
+
+// electrumSession is one connected Electrum client
+type electrumSession struct {
+	server *ElectrumServer
+	conn   net.Conn
+
+	mu           sync.Mutex // Guards writes and subscriptions
+	encoder      *json.Encoder
+	headers      bool            // Subscribed to new tips
+	scriptHashes map[string]bool // Subscribed script hashes
+}
+
+// NewElectrumServer indexes the chain and serves light wallets on a
+// listener bound by the caller, over TLS if tlsConfig is set
+func NewElectrumServer(bc *blockchain.Blockchain, network *blockchain.Network, listener net.Listener, tlsConfig *tls.Config) *ElectrumServer {
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	s := &ElectrumServer{
+		chain:    bc,
+		network:  network,
+		index:    newElectrumIndex(),
+		listener: listener,
+		sessions: make(map[*electrumSession]bool),
+	}
+
+	s.index.mu.Lock()
+	defer s.index.mu.Unlock()
+
+	bc.Subscribe(s.handleChainNotification)
+	for _, block := range bc.GetBlocks() {
+		s.index.connect(block)
+	}
+	return s
+}
+
+// Start begins accepting Electrum connections
+func (s *ElectrumServer) Start() {
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				log.Printf("Error accepting Electrum connection: %v", err)
+				continue
+			}
+
+			session := &electrumSession{
+				server:       s,
+				conn:         conn,
+				encoder:      json.NewEncoder(conn),
+				scriptHashes: make(map[string]bool),
+			}
+			s.mu.Lock()
+			s.sessions[session] = true
+			s.mu.Unlock()
+
+			go session.handleConnection()
+		}
+	}()
+}
+
+// handleChainNotification updates the index and notifies subscribed
+// clients of the new tip and of changed script hashes
+func (s *ElectrumServer) handleChainNotification(n *blockchain.Notification) {
+	block, ok := n.Data.(*blockchain.Block)
+	if !ok {
+		return
+	}
+
+	s.index.mu.Lock()
+	var touched map[string]bool
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		touched = s.index.connect(block)
+	case blockchain.NTBlockDisconnected:
+		touched = s.index.disconnect(block)
+	}
+	s.index.mu.Unlock()
+	if touched == nil {
+		return
+	}
+
+	header := s.tipHeader()
+	s.mu.Lock()
+	sessions := make([]*electrumSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		session.notify(header, touched)
+	}
+}
+
+// tipHeader returns the headers.subscribe result for the indexed tip
+func (s *ElectrumServer) tipHeader() map[string]interface{} {
+	tip, height := s.index.Tip()
+	return map[string]interface{}{
+		"height": height,
+		"hex":    hex.EncodeToString(tip.EncodeHeader()),
+	}
+}
+
+// handleConnection serves requests until the client disconnects
+func (s *electrumSession) handleConnection() {
+	defer func() {
+		s.conn.Close()
+		s.server.mu.Lock()
+		delete(s.server.sessions, s)
+		s.server.mu.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(s.conn)
+	scanner.Buffer(make([]byte, 4096), electrumMaxRequest)
+	for scanner.Scan() {
+		var req electrumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			s.send(electrumErrorResponse{JSONRPC: "2.0", Error: rpcErrorf(RPCParseError, "Parse error: %v", err)})
+			continue
+		}
+
+		handler, ok := electrumMethods[req.Method]
+		if !ok {
+			s.send(electrumErrorResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErrorf(RPCMethodNotFound, "Method not found: %s", req.Method)})
+			continue
+		}
+		result, err := handler(s, req.Params)
+		if err != nil {
+			rpcErr, ok := err.(*RPCError)
+			if !ok {
+				rpcErr = &RPCError{Code: RPCMiscError, Message: err.Error()}
+			}
+			s.send(electrumErrorResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr})
+			continue
+		}
+		s.send(electrumResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading from Electrum client %s: %v", s.conn.RemoteAddr(), err)
+	}
+}
+
+// send writes a message to the client
+func (s *electrumSession) send(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(msg); err != nil {
+		log.Printf("Error sending to Electrum client %s: %v", s.conn.RemoteAddr(), err)
+	}
+}
+
+// notify sends the new tip and the status of changed script hashes the
+// client subscribed to
+func (s *electrumSession) notify(header map[string]interface{}, touched map[string]bool) {
+	s.mu.Lock()
+	headers := s.headers
+	var changed []string
+	for scriptHash := range touched {
+		if s.scriptHashes[scriptHash] {
+			changed = append(changed, scriptHash)
+		}
+	}
+	s.mu.Unlock()
+
+	if headers {
+		s.send(electrumNotification{JSONRPC: "2.0", Method: "blockchain.headers.subscribe", Params: []interface{}{header}})
+	}
+	for _, scriptHash := range changed {
+		s.send(electrumNotification{JSONRPC: "2.0", Method: "blockchain.scripthash.subscribe", Params: []interface{}{scriptHash, s.status(scriptHash)}})
+	}
+}
+
+// status returns a script hash status, null without history
+func (s *electrumSession) status(scriptHash string) interface{} {
+	if status := s.server.index.Status(scriptHash); status != "" {
+		return status
+	}
+	return nil
+}
+
+// scriptHashParam parses the script hash parameter of a method
+func scriptHashParam(params []json.RawMessage) (string, error) {
+	var scriptHash string
+	if err := parseParams(params, 1, &scriptHash); err != nil {
+		return "", err
+	}
+	if b, err := hex.DecodeString(scriptHash); err != nil || len(b) != 32 {
+		return "", rpcErrorf(RPCInvalidParams, "Invalid script hash %q", scriptHash)
+	}
+	return scriptHash, nil
+}
+
+func (s *electrumSession) serverVersion(params []json.RawMessage) (interface{}, error) {
+	var client string
+	var version interface{}
+	if err := parseParams(params, 0, &client, &version); err != nil {
+		return nil, err
+	}
+	return []string{"AlerimElectrum " + blockchain.Version, electrumProtocolVersion}, nil
+}
+
+func (s *electrumSession) serverBanner(params []json.RawMessage) (interface{}, error) {
+	return fmt.Sprintf("Alerim node %s (%s)", blockchain.Version, s.server.chain.Params().Name), nil
+}
+
+func (s *electrumSession) serverFeatures(params []json.RawMessage) (interface{}, error) {
+	genesis, _ := s.server.index.BlockAt(0)
+	return map[string]interface{}{
+		"genesis_hash":   hex.EncodeToString(genesis.Hash[:]),
+		"hash_function":  "sha256",
+		"server_version": "AlerimElectrum " + blockchain.Version,
+		"protocol_min":   electrumProtocolVersion,
+		"protocol_max":   electrumProtocolVersion,
+		"pruning":        nil,
+		"hosts":          map[string]interface{}{},
+	}, nil
+}
+
+func (s *electrumSession) serverPing(params []json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+func (s *electrumSession) headersSubscribe(params []json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	s.headers = true
+	s.mu.Unlock()
+	return s.server.tipHeader(), nil
+}
+
+func (s *electrumSession) blockHeader(params []json.RawMessage) (interface{}, error) {
+	var height, cpHeight int
+	if err := parseParams(params, 1, &height, &cpHeight); err != nil {
+		return nil, err
+	}
+	block, ok := s.server.index.BlockAt(height)
+	if !ok {
+		return nil, rpcErrorf(RPCInvalidParams, "Height %d out of range", height)
+	}
+	return hex.EncodeToString(block.EncodeHeader()), nil
+}
+
+// relayFee implements blockchain.relayfee and blockchain.estimatefee: the
+// node doesn't estimate fees, so both return the minimum relay fee rate
+// in coins per kilobyte
+func (s *electrumSession) relayFee(params []json.RawMessage) (interface{}, error) {
+	return float64(s.server.chain.Policy().MinRelayFeeRate) / float64(blockchain.Coin), nil
+}
+
+func (s *electrumSession) scriptHashBalance(params []json.RawMessage) (interface{}, error) {
+	scriptHash, err := scriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]uint64{
+		"confirmed":   s.server.index.Balance(scriptHash),
+		"unconfirmed": 0,
+	}, nil
+}
+
+func (s *electrumSession) scriptHashHistory(params []json.RawMessage) (interface{}, error) {
+	scriptHash, err := scriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.server.index.History(scriptHash), nil
+}
+
+func (s *electrumSession) scriptHashMempool(params []json.RawMessage) (interface{}, error) {
+	if _, err := scriptHashParam(params); err != nil {
+		return nil, err
+	}
+	return []ElectrumHistoryEntry{}, nil
+}
+
+func (s *electrumSession) scriptHashUnspent(params []json.RawMessage) (interface{}, error) {
+	scriptHash, err := scriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.server.index.Unspent(scriptHash), nil
+}
+
+func (s *electrumSession) scriptHashSubscribe(params []json.RawMessage) (interface{}, error) {
+	scriptHash, err := scriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.scriptHashes[scriptHash] = true
+	s.mu.Unlock()
+	return s.status(scriptHash), nil
+}
+
+func (s *electrumSession) scriptHashUnsubscribe(params []json.RawMessage) (interface{}, error) {
+	scriptHash, err := scriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscribed := s.scriptHashes[scriptHash]
+	delete(s.scriptHashes, scriptHash)
+	return subscribed, nil
+}
+
+func (s *electrumSession) transactionGet(params []json.RawMessage) (interface{}, error) {
+	var txid string
+	var verbose bool
+	if err := parseParams(params, 1, &txid, &verbose); err != nil {
+		return nil, err
+	}
+	if verbose {
+		return nil, rpcErrorf(RPCInvalidParams, "Verbose transactions are not supported")
+	}
+	hash, err := decodeHash(txid)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	tx, _, ok := s.server.index.Transaction(hash)
+	if !ok {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "No such transaction")
+	}
+	return hex.EncodeToString(tx.Encode()), nil
+}
+
+// transactionGetMerkle implements blockchain.transaction.get_merkle: the
+// merkle branch proving a confirmed transaction is in the block at height,
+// checked by light clients against the block header
+func (s *electrumSession) transactionGetMerkle(params []json.RawMessage) (interface{}, error) {
+	var txid string
+	var height int
+	if err := parseParams(params, 2, &txid, &height); err != nil {
+		return nil, err
+	}
+	hash, err := decodeHash(txid)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	block, ok := s.server.index.BlockAt(height)
+	if !ok {
+		return nil, rpcErrorf(RPCInvalidParams, "Height %d out of range", height)
+	}
+	branch, pos, err := block.MerkleProof(hash)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Transaction not in block %d", height)
+	}
+	merkle := make([]string, len(branch))
+	for i, h := range branch {
+		merkle[i] = hex.EncodeToString(h[:])
+	}
+	return map[string]interface{}{
+		"block_height": height,
+		"merkle":       merkle,
+		"pos":          pos,
+	}, nil
+}
+
+func (s *electrumSession) transactionBroadcast(params []json.RawMessage) (interface{}, error) {
+	var rawHex string
+	if err := parseParams(params, 1, &rawHex); err != nil {
+		return nil, err
+	}
+	tx, err := decodeRawTx(rawHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.server.chain.AddTransaction(tx); err != nil {
+		return nil, rpcErrorf(RPCVerifyRejected, "%v", err)
+	}
+	if s.server.network != nil {
+		s.server.network.BroadcastTransaction(tx)
+	}
+	return hex.EncodeToString(tx.Hash[:]), nil
+}
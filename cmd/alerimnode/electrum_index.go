@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// electrumScriptHash returns the Electrum script hash of an output script:
+// its SHA-256 hash in reversed byte order, as hex
+func electrumScriptHash(script []byte) string {
+	hash := sha256.Sum256(script)
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// electrumHistoryItem is a confirmed transaction touching a script hash
+type electrumHistoryItem struct {
+	txHash [32]byte
+	height int
+}
+
+// electrumOutput is an unspent output tracked by the index
+type electrumOutput struct {
+	scriptHash string
+	txHash     [32]byte
+	index      uint32
+	value      uint64
+	height     int
+}
+
+// electrumTx is a confirmed transaction and the height it was mined at
+type electrumTx struct {
+	tx     *blockchain.Transaction
+	height int
+}
+
+// ElectrumUnspent is an unspent output as listed by
+// blockchain.scripthash.listunspent
+type ElectrumUnspent struct {
+	TxHash string `json:"tx_hash"`
+	TxPos  uint32 `json:"tx_pos"`
+	Height int    `json:"height"`
+	Value  uint64 `json:"value"`
+}
+
+// ElectrumHistoryEntry is a transaction as listed by
+// blockchain.scripthash.get_history
+type ElectrumHistoryEntry struct {
+	TxHash string `json:"tx_hash"`
+	Height int    `json:"height"`
+}
+
+// ElectrumIndex keeps the confirmed history and unspent outputs of every
+// script hash on the main chain, and the transactions by hash
+type ElectrumIndex struct {
+	mu      sync.RWMutex
+	blocks  []*blockchain.Block              // Main chain by height
+	history map[string][]electrumHistoryItem // Script hash -> history in chain order
+	utxos   map[string]*electrumOutput       // Outpoint -> output
+	unspent map[string]map[string]bool       // Script hash -> outpoints
+	txs     map[[32]byte]electrumTx
+	undo    map[[32]byte][]*electrumOutput // Connected block -> outputs it spent
+}
+
+// newElectrumIndex creates an empty index
+func newElectrumIndex() *ElectrumIndex {
+	return &ElectrumIndex{
+		history: make(map[string][]electrumHistoryItem),
+		utxos:   make(map[string]*electrumOutput),
+		unspent: make(map[string]map[string]bool),
+		txs:     make(map[[32]byte]electrumTx),
+		undo:    make(map[[32]byte][]*electrumOutput),
+	}
+}
+
+// addUnspent records an unspent output; the caller must hold idx.mu
+func (idx *ElectrumIndex) addUnspent(out *electrumOutput) {
+	key := outpointKey(out.txHash, out.index)
+	idx.utxos[key] = out
+	if idx.unspent[out.scriptHash] == nil {
+		idx.unspent[out.scriptHash] = make(map[string]bool)
+	}
+	idx.unspent[out.scriptHash][key] = true
+}
+
+// removeUnspent forgets an unspent output and returns it, or nil if it
+// isn't tracked; the caller must hold idx.mu
+func (idx *ElectrumIndex) removeUnspent(key string) *electrumOutput {
+	out, ok := idx.utxos[key]
+	if !ok {
+		return nil
+	}
+	delete(idx.utxos, key)
+	delete(idx.unspent[out.scriptHash], key)
+	if len(idx.unspent[out.scriptHash]) == 0 {
+		delete(idx.unspent, out.scriptHash)
+	}
+	return out
+}
+
+// connect applies a block extending the indexed tip and returns the
+// script hashes whose history changed; the caller must hold idx.mu
+func (idx *ElectrumIndex) connect(block *blockchain.Block) map[string]bool {
+	if n := len(idx.blocks); n > 0 && idx.blocks[n-1].Hash != block.PrevHash {
+		// Already indexed, or not on top of the indexed chain
+		return nil
+	}
+	height := len(idx.blocks)
+	idx.blocks = append(idx.blocks, block)
+
+	touched := make(map[string]bool)
+	spent := make([]*electrumOutput, 0)
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		txTouched := make(map[string]bool)
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				if out := idx.removeUnspent(outpointKey(in.PrevTxHash, in.PrevTxIndex)); out != nil {
+					spent = append(spent, out)
+					txTouched[out.scriptHash] = true
+				}
+			}
+		}
+		for j, output := range tx.Outputs {
+			scriptHash := electrumScriptHash(output.Script)
+			idx.addUnspent(&electrumOutput{
+				scriptHash: scriptHash,
+				txHash:     tx.Hash,
+				index:      uint32(j),
+				value:      output.Value,
+				height:     height,
+			})
+			txTouched[scriptHash] = true
+		}
+
+		for scriptHash := range txTouched {
+			idx.history[scriptHash] = append(idx.history[scriptHash], electrumHistoryItem{txHash: tx.Hash, height: height})
+			touched[scriptHash] = true
+		}
+		idx.txs[tx.Hash] = electrumTx{tx: tx, height: height}
+	}
+	idx.undo[block.Hash] = spent
+	return touched
+}
+
+// disconnect reverses connect for the indexed tip and returns the script
+// hashes whose history changed; the caller must hold idx.mu
+func (idx *ElectrumIndex) disconnect(block *blockchain.Block) map[string]bool {
+	n := len(idx.blocks)
+	if n == 0 || idx.blocks[n-1].Hash != block.Hash {
+		return nil
+	}
+	height := n - 1
+	idx.blocks = idx.blocks[:height]
+
+	touched := make(map[string]bool)
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := &block.Transactions[i]
+		for j := range tx.Outputs {
+			if out := idx.removeUnspent(outpointKey(tx.Hash, uint32(j))); out != nil {
+				touched[out.scriptHash] = true
+			}
+		}
+		delete(idx.txs, tx.Hash)
+	}
+	for _, out := range idx.undo[block.Hash] {
+		idx.addUnspent(out)
+		touched[out.scriptHash] = true
+	}
+	delete(idx.undo, block.Hash)
+
+	for scriptHash := range touched {
+		history := idx.history[scriptHash]
+		for len(history) > 0 && history[len(history)-1].height == height {
+			history = history[:len(history)-1]
+		}
+		if len(history) == 0 {
+			delete(idx.history, scriptHash)
+		} else {
+			idx.history[scriptHash] = history
+		}
+	}
+	return touched
+}
+
+// Tip returns the indexed chain tip and its height
+func (idx *ElectrumIndex) Tip() (*blockchain.Block, int) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if len(idx.blocks) == 0 {
+		return nil, -1
+	}
+	return idx.blocks[len(idx.blocks)-1], len(idx.blocks) - 1
+}
+
+// BlockAt returns the main chain block at height
+func (idx *ElectrumIndex) BlockAt(height int) (*blockchain.Block, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if height < 0 || height >= len(idx.blocks) {
+		return nil, false
+	}
+	return idx.blocks[height], true
+}
+
+// History returns the confirmed transactions touching a script hash in
+// chain order
+func (idx *ElectrumIndex) History(scriptHash string) []ElectrumHistoryEntry {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	entries := make([]ElectrumHistoryEntry, 0, len(idx.history[scriptHash]))
+	for _, item := range idx.history[scriptHash] {
+		entries = append(entries, ElectrumHistoryEntry{TxHash: hex.EncodeToString(item.txHash[:]), Height: item.height})
+	}
+	return entries
+}
+
+// Status returns the Electrum status of a script hash: the SHA-256 hash of
+// its history as "tx_hash:height:" items, or "" without history
+func (idx *ElectrumIndex) Status(scriptHash string) string {
+	history := idx.History(scriptHash)
+	if len(history) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, entry := range history {
+		fmt.Fprintf(h, "%s:%d:", entry.TxHash, entry.Height)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Unspent returns the unspent outputs of a script hash by height
+func (idx *ElectrumIndex) Unspent(scriptHash string) []ElectrumUnspent {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	unspent := make([]ElectrumUnspent, 0, len(idx.unspent[scriptHash]))
+	for key := range idx.unspent[scriptHash] {
+		out := idx.utxos[key]
+		unspent = append(unspent, ElectrumUnspent{
+			TxHash: hex.EncodeToString(out.txHash[:]),
+			TxPos:  out.index,
+			Height: out.height,
+			Value:  out.value,
+		})
+	}
+	sort.Slice(unspent, func(i, j int) bool {
+		if unspent[i].Height != unspent[j].Height {
+			return unspent[i].Height < unspent[j].Height
+		}
+		if unspent[i].TxHash != unspent[j].TxHash {
+			return unspent[i].TxHash < unspent[j].TxHash
+		}
+		return unspent[i].TxPos < unspent[j].TxPos
+	})
+	return unspent
+}
+
+// Balance returns the confirmed balance of a script hash
+func (idx *ElectrumIndex) Balance(scriptHash string) uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var balance uint64
+	for key := range idx.unspent[scriptHash] {
+		balance += idx.utxos[key].value
+	}
+	return balance
+}
+
+// Transaction returns a confirmed transaction and its height
+func (idx *ElectrumIndex) Transaction(hash [32]byte) (*blockchain.Transaction, int, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	entry, ok := idx.txs[hash]
+	return entry.tx, entry.height, ok
+}
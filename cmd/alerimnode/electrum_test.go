@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// electrumTestChain returns three blocks: a coinbase paying alice 50 and a
+// transaction splitting it into 30 for bob and 20 back to alice
+func electrumTestChain() []*blockchain.Block {
+	coinbase := blockchain.CreateCoinbase(50, []byte("alice"))
+	spend := blockchain.NewTransaction(
+		[]blockchain.TxInput{{PrevTxHash: coinbase.Hash, PrevTxIndex: 0, Sequence: 0xFFFFFFFF}},
+		[]blockchain.TxOutput{{Value: 30, Script: []byte("bob")}, {Value: 20, Script: []byte("alice")}},
+	)
+	genesis := &blockchain.Block{Hash: [32]byte{1}}
+	b1 := &blockchain.Block{Hash: [32]byte{2}, PrevHash: genesis.Hash, Transactions: []blockchain.Transaction{*coinbase}}
+	b2 := &blockchain.Block{Hash: [32]byte{3}, PrevHash: b1.Hash, Transactions: []blockchain.Transaction{*spend}}
+	return []*blockchain.Block{genesis, b1, b2}
+}
+
+func TestElectrumIndex(t *testing.T) {
+	idx := newElectrumIndex()
+	blocks := electrumTestChain()
+	for _, b := range blocks {
+		idx.connect(b)
+	}
+
+	alice, bob := electrumScriptHash([]byte("alice")), electrumScriptHash([]byte("bob"))
+	if got := idx.Balance(alice); got != 20 {
+		t.Errorf("alice balance = %d, want 20", got)
+	}
+	if got := idx.Balance(bob); got != 30 {
+		t.Errorf("bob balance = %d, want 30", got)
+	}
+	history := idx.History(alice)
+	if len(history) != 2 || history[0].Height != 1 || history[1].Height != 2 {
+		t.Errorf("alice history = %+v", history)
+	}
+	if unspent := idx.Unspent(bob); len(unspent) != 1 || unspent[0].Value != 30 || unspent[0].TxPos != 0 {
+		t.Errorf("bob unspent = %+v", unspent)
+	}
+	status := idx.Status(alice)
+	if status == "" || idx.Status(electrumScriptHash([]byte("carol"))) != "" {
+		t.Errorf("status = %q", status)
+	}
+
+	// Disconnecting the tip restores the spent output and the old status
+	if touched := idx.disconnect(blocks[2]); !touched[alice] || !touched[bob] {
+		t.Errorf("disconnect touched %v", touched)
+	}
+	if got := idx.Balance(alice); got != 50 {
+		t.Errorf("alice balance after disconnect = %d, want 50", got)
+	}
+	if got := idx.Balance(bob); got != 0 || len(idx.History(bob)) != 0 {
+		t.Errorf("bob still has balance %d or history", got)
+	}
+	if len(idx.History(alice)) != 1 || idx.Status(alice) == status {
+		t.Error("alice history not rolled back")
+	}
+	if _, _, ok := idx.Transaction(blocks[2].Transactions[0].Hash); ok {
+		t.Error("disconnected transaction still indexed")
+	}
+}
+
+func TestElectrumSession(t *testing.T) {
+	server := &ElectrumServer{index: newElectrumIndex(), sessions: make(map[*electrumSession]bool)}
+	blocks := electrumTestChain()
+	server.index.connect(blocks[0])
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	session := &electrumSession{server: server, conn: conn, encoder: json.NewEncoder(conn), scriptHashes: make(map[string]bool)}
+	server.sessions[session] = true
+	go session.handleConnection()
+
+	reader := bufio.NewReader(client)
+	call := func(request string) map[string]interface{} {
+		t.Helper()
+		if _, err := client.Write([]byte(request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	alice := electrumScriptHash([]byte("alice"))
+	resp := call(`{"id":1,"method":"blockchain.scripthash.subscribe","params":["` + alice + `"]}`)
+	if result, ok := resp["result"]; !ok || result != nil {
+		t.Fatalf("subscribe without history = %v, want null result", resp)
+	}
+	if resp := call(`{"id":2,"method":"blockchain.scripthash.subscribe","params":["zz"]}`); resp["error"] == nil {
+		t.Errorf("invalid script hash accepted: %v", resp)
+	}
+	if resp := call(`{"id":3,"method":"no.such.method"}`); resp["error"] == nil {
+		t.Errorf("unknown method accepted: %v", resp)
+	}
+
+	// A block paying alice notifies the subscription with her new status
+	go server.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: blocks[1]})
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var note electrumNotification
+	if err := json.Unmarshal(line, &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Method != "blockchain.scripthash.subscribe" || len(note.Params) != 2 || note.Params[1] != server.index.Status(alice) {
+		t.Errorf("notification = %+v", note)
+	}
+}
+
+func TestElectrumTransactionGetMerkle(t *testing.T) {
+	server := &ElectrumServer{index: newElectrumIndex()}
+	blocks := electrumTestChain()
+	for _, b := range blocks {
+		b.MerkleRoot = b.CalculateMerkleRoot()
+		server.index.connect(b)
+	}
+	session := &electrumSession{server: server}
+	param := func(v interface{}) json.RawMessage { b, _ := json.Marshal(v); return b }
+
+	tx := blocks[2].Transactions[0]
+	result, err := session.transactionGetMerkle([]json.RawMessage{param(hex.EncodeToString(tx.Hash[:])), param(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := result.(map[string]interface{})
+	var branch [][32]byte
+	for _, h := range proof["merkle"].([]string) {
+		hash, err := decodeHash(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, hash)
+	}
+	if !blockchain.VerifyMerkleProof(tx.Hash, branch, proof["pos"].(int), blocks[2].MerkleRoot) {
+		t.Errorf("proof %v does not verify", proof)
+	}
+
+	if _, err := session.transactionGetMerkle([]json.RawMessage{param(hex.EncodeToString(tx.Hash[:])), param(1)}); err == nil {
+		t.Error("proof for a block without the transaction")
+	}
+	if _, err := session.transactionGetMerkle([]json.RawMessage{param(hex.EncodeToString(tx.Hash[:])), param(9)}); err == nil {
+		t.Error("proof for a height past the tip")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// NativeCurrency is the currency payouts are made in without conversion
+const NativeCurrency = "AIM"
+
+// SwapOrder is an exchange's instruction for converting one payout. The
+// pool sends the native amount to DepositAddress and the exchange delivers
+// the converted amount to the miner's destination.
+type SwapOrder struct {
+	Reference      string `json:"reference"`
+	DepositAddress string `json:"deposit_address"`
+	ExpectedAmount string `json:"expected_amount"` // In the target currency
+	Rate           string `json:"rate"`            // Target units per AIM
+}
+
+// PayoutAdapter converts native payouts into another currency through an
+// external exchange or swap service
+type PayoutAdapter interface {
+	// Supports reports whether payouts can be converted to a currency
+	Supports(currency string) bool
+
+	// CreateSwap opens a conversion of amount to currency, delivered to
+	// destination
+	CreateSwap(currency, destination string, amount blockchain.Amount) (*SwapOrder, error)
+}
+
+// ConversionRecord is an entry in the conversion history, kept next to the
+// native payout history
+type ConversionRecord struct {
+	MinerID        string            `json:"miner_id"`
+	Currency       string            `json:"currency"`
+	Destination    string            `json:"destination"`
+	Amount         blockchain.Amount `json:"amount"` // Native amount sent to the exchange
+	Reference      string            `json:"reference"`
+	DepositAddress string            `json:"deposit_address"`
+	ExpectedAmount string            `json:"expected_amount"`
+	Rate           string            `json:"rate"`
+	TxHash         string            `json:"tx_hash"`
+	Time           time.Time         `json:"time"`
+}
+
+// WebhookPayoutAdapter requests swaps from an external service over HTTP.
+// Requests are signed with the shared secret like the KYC webhook.
+type WebhookPayoutAdapter struct {
+	URL        string
+	Secret     []byte
+	Currencies []string
+	client     *http.Client
+}
+
+// NewWebhookPayoutAdapter creates a webhook-based payout adapter
+func NewWebhookPayoutAdapter(url string, secret []byte, currencies []string) *WebhookPayoutAdapter {
+	normalized := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		normalized = append(normalized, strings.ToUpper(currency))
+	}
+	return &WebhookPayoutAdapter{
+		URL:        url,
+		Secret:     secret,
+		Currencies: normalized,
+		client:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Supports implements PayoutAdapter
+func (a *WebhookPayoutAdapter) Supports(currency string) bool {
+	for _, c := range a.Currencies {
+		if c == strings.ToUpper(currency) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSwap implements PayoutAdapter
+func (a *WebhookPayoutAdapter) CreateSwap(currency, destination string, amount blockchain.Amount) (*SwapOrder, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"from":        NativeCurrency,
+		"to":          strings.ToUpper(currency),
+		"destination": destination,
+		"amount":      amount.String(), // Decimal AIM
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signPayload(a.Secret, timestamp, body))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("exchange returned status %d", resp.StatusCode)
+	}
+
+	order := &SwapOrder{}
+	if err := json.NewDecoder(resp.Body).Decode(order); err != nil {
+		return nil, err
+	}
+	if order.Reference == "" || order.DepositAddress == "" {
+		return nil, errors.New("exchange returned an incomplete swap order")
+	}
+	return order, nil
+}
+
+// convertsPayout reports whether a miner's payouts go through the exchange
+func convertsPayout(miner *Miner) bool {
+	return miner.PayoutCurrency != "" && !strings.EqualFold(miner.PayoutCurrency, NativeCurrency)
+}
+
+// SetPayoutAdapter installs the exchange used for converted payouts
+func (rm *RewardManager) SetPayoutAdapter(adapter PayoutAdapter) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.exchange = adapter
+}
+
+// recordConversion appends to the conversion history; the caller must hold
+// rm.mu
+func (rm *RewardManager) recordConversion(record *ConversionRecord) {
+	rm.conversions = append(rm.conversions, record)
+	if err := saveJSONFile(rm.conversionsPath, rm.conversions); err != nil {
+		log.Printf("Error saving conversion history: %v", err)
+	}
+}
+
+// GetConversions returns a miner's conversion history
+func (rm *RewardManager) GetConversions(minerID string) []*ConversionRecord {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	records := make([]*ConversionRecord, 0)
+	for _, record := range rm.conversions {
+		if record.MinerID == minerID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// registerExchangeRoutes adds the payout currency preference and
+// conversion history endpoints
+func registerExchangeRoutes(api *gin.RouterGroup, pool *MiningPool) {
+	api.PUT("/miners/:id/payout", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		var req struct {
+			Currency    string `json:"currency"`
+			Destination string `json:"destination"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		req.Currency = strings.ToUpper(req.Currency)
+		if req.Currency != "" && req.Currency != NativeCurrency {
+			pool.rewards.mu.RLock()
+			adapter := pool.rewards.exchange
+			pool.rewards.mu.RUnlock()
+			if adapter == nil || !adapter.Supports(req.Currency) {
+				respondError(c, apiErrorf(CodeInvalidRequest, "Payouts can't be converted to %s", req.Currency))
+				return
+			}
+			if req.Destination == "" {
+				respondError(c, apiError(CodeInvalidRequest, "A destination address is required for converted payouts"))
+				return
+			}
+		} else {
+			req.Currency, req.Destination = "", ""
+		}
+
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		for _, miner := range activeMiners {
+			if miner.ID == c.Param("id") {
+				if !authorizeUser(c, miner.UserID) {
+					respondError(c, apiError(CodeForbidden, "Not allowed to manage this miner"))
+					return
+				}
+				if req.Currency != "" && len(miner.PayoutSplits) > 0 {
+					respondError(c, apiError(CodeInvalidRequest, "Split payouts can't be converted"))
+					return
+				}
+				miner.PayoutCurrency = req.Currency
+				miner.PayoutDestination = req.Destination
+				c.JSON(http.StatusOK, miner)
+				return
+			}
+		}
+		respondError(c, apiError(CodeNotFound, "Miner not found"))
+	})
+
+	api.GET("/miners/:id/conversions", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		c.JSON(http.StatusOK, pool.rewards.GetConversions(c.Param("id")))
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestConvertsPayout(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     bool
+	}{
+		{"", false},
+		{"AIM", false},
+		{"aim", false},
+		{"BTC", true},
+	}
+	for _, tt := range tests {
+		if got := convertsPayout(&Miner{PayoutCurrency: tt.currency}); got != tt.want {
+			t.Errorf("convertsPayout(%q) = %v, want %v", tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookPayoutAdapterCreateSwap(t *testing.T) {
+	secret := []byte("exchange-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := verifyCallback(secret, r.Header.Get(webhookTimestampHeader), r.Header.Get(webhookSignatureHeader), body, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var req map[string]string
+		json.Unmarshal(body, &req)
+		if req["to"] != "BTC" || req["destination"] != "bc1qdest" || req["amount"] != "0.00005" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(SwapOrder{Reference: "swap-1", DepositAddress: "aim-deposit", ExpectedAmount: "0.0001", Rate: "0.00002"})
+	}))
+	defer server.Close()
+
+	adapter := NewWebhookPayoutAdapter(server.URL, secret, []string{"btc"})
+	if !adapter.Supports("BTC") || adapter.Supports("ETH") {
+		t.Fatalf("unexpected supported currencies %v", adapter.Currencies)
+	}
+
+	order, err := adapter.CreateSwap("btc", "bc1qdest", blockchain.Amount(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Reference != "swap-1" || order.DepositAddress != "aim-deposit" {
+		t.Errorf("unexpected order %+v", order)
+	}
+
+	adapter.Secret = []byte("wrong")
+	if _, err := adapter.CreateSwap("BTC", "bc1qdest", blockchain.Amount(5000)); err == nil {
+		t.Error("expected an error for a badly signed request")
+	}
+}
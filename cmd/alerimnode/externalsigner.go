@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// ExternalSigner signs payouts with a key kept outside the node, such as
+// on a hardware wallet, through a bridge command. The bridge is run as
+//
+//	<command> getpubkey          prints the hex uncompressed public key
+//	<command> signhash <hex>     prints the hex DER signature of the hash
+//
+// so an HWI-style tool can sit behind a small wrapper script. Signing may
+// wait for a confirmation on the device, up to the timeout.
+type ExternalSigner struct {
+	command string
+	timeout time.Duration
+	pubKey  *ecdsa.PublicKey
+}
+
+// NewExternalSigner creates a signer for the bridge command and fetches
+// its public key
+func NewExternalSigner(command string, timeout time.Duration) (*ExternalSigner, error) {
+	s := &ExternalSigner{command: command, timeout: timeout}
+	out, err := s.run("getpubkey")
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := hex.DecodeString(out)
+	if err != nil {
+		return nil, errors.New("external signer returned an invalid public key")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubKey)
+	if x == nil {
+		return nil, errors.New("external signer returned an invalid public key")
+	}
+	s.pubKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	return s, nil
+}
+
+// run runs the bridge with args and returns its trimmed output
+func (s *ExternalSigner) run(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command+" "+strings.Join(args, " "))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children of the shell may hold its output open after it is killed
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("external signer %s timed out after %s", args[0], s.timeout)
+		}
+		return "", fmt.Errorf("external signer %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// PublicKey implements blockchain.Signer
+func (s *ExternalSigner) PublicKey() *ecdsa.PublicKey {
+	return s.pubKey
+}
+
+// SignHash implements blockchain.Signer. The signature is checked by
+// Transaction.SignWith.
+func (s *ExternalSigner) SignHash(hash [32]byte) ([]byte, error) {
+	out, err := s.run("signhash", hex.EncodeToString(hash[:]))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(out)
+	if err != nil || len(sig) == 0 || len(sig) > blockchain.MaxSignatureSize {
+		return nil, errors.New("external signer returned an invalid signature")
+	}
+	return sig, nil
+}
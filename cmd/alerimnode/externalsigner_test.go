@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// writeSignerBridge writes a bridge script answering getpubkey with
+// pubKey and signhash with sig
+func writeSignerBridge(t *testing.T, pubKey, sig string) string {
+	path := filepath.Join(t.TempDir(), "bridge.sh")
+	script := fmt.Sprintf("#!/bin/sh\ncase \"$1\" in\ngetpubkey) echo %s ;;\nsignhash) echo %s ;;\n*) exit 1 ;;\nesac\n", pubKey, sig)
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExternalSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubHex := hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	newTx := func() *blockchain.Transaction {
+		return blockchain.NewTransaction(
+			[]blockchain.TxInput{{PrevTxHash: [32]byte{1}, Sequence: 0xFFFFFFFF}},
+			[]blockchain.TxOutput{{Value: 5, Script: []byte("miner")}},
+		)
+	}
+	sig, err := blockchain.KeySigner{Key: key}.SignHash(newTx().SignatureHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewExternalSigner(writeSignerBridge(t, pubHex, hex.EncodeToString(sig)), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.PublicKey().Equal(&key.PublicKey) {
+		t.Fatal("external signer has the wrong public key")
+	}
+	tx := newTx()
+	if err := tx.SignWith(signer); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify(&key.PublicKey) {
+		t.Error("externally signed transaction does not verify")
+	}
+
+	// A signature of anything else is refused
+	other := newTx()
+	other.Outputs[0].Value = 6
+	if err := other.SignWith(signer); err == nil {
+		t.Error("signature of another transaction accepted")
+	}
+
+	for name, bridge := range map[string]string{
+		"bad public key": writeSignerBridge(t, "abcd", ""),
+		"failing bridge": "exit 1;",
+	} {
+		if _, err := NewExternalSigner(bridge, time.Minute); err == nil {
+			t.Errorf("%s: signer created", name)
+		}
+	}
+	slow := &ExternalSigner{command: "sleep 5;", timeout: 50 * time.Millisecond, pubKey: &key.PublicKey}
+	if _, err := slow.SignHash([32]byte{}); err == nil {
+		t.Error("signer outlived its timeout")
+	}
+}
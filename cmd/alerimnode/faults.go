@@ -0,0 +1,187 @@
+//go:build faults
+
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Fault injection is compiled in only with the faults build tag, so
+// operators and CI can check that the node recovers from lost messages,
+// slow disks, bad shares and dropped peers. Production builds get the
+// no-op hooks of faults_off.go.
+
+// FaultConfig is the set of faults being injected
+type FaultConfig struct {
+	// DropMessages is the fraction of inbound P2P messages dropped, of
+	// the types in DropTypes or of every type if it is empty
+	DropMessages float64  `json:"drop_messages"`
+	DropTypes    []string `json:"drop_types,omitempty"`
+
+	// WriteDelayMs delays every write of persistent state
+	WriteDelayMs int64 `json:"write_delay_ms"`
+
+	// CorruptShares is the number of upcoming shares corrupted so they
+	// fail validation
+	CorruptShares int `json:"corrupt_shares"`
+}
+
+// FaultStats counts the faults injected since the node started
+type FaultStats struct {
+	DroppedMessages int64 `json:"dropped_messages"`
+	DelayedWrites   int64 `json:"delayed_writes"`
+	CorruptedShares int64 `json:"corrupted_shares"`
+	KilledPeers     int64 `json:"killed_peers"`
+}
+
+// faultInjector holds the active faults
+type faultInjector struct {
+	mu     sync.Mutex
+	config FaultConfig
+	stats  FaultStats
+}
+
+// faults is the node's fault injector
+var faults = &faultInjector{}
+
+// validate checks that a fault configuration is usable
+func (c *FaultConfig) validate() error {
+	if c.DropMessages < 0 || c.DropMessages > 1 {
+		return apiError(CodeInvalidRequest, "drop_messages must be between 0 and 1")
+	}
+	if c.WriteDelayMs < 0 || c.CorruptShares < 0 {
+		return apiError(CodeInvalidRequest, "write_delay_ms and corrupt_shares can't be negative")
+	}
+	return nil
+}
+
+// dropMessage reports whether to drop a P2P message of the given type
+func (f *faultInjector) dropMessage(msgType string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.DropMessages == 0 {
+		return false
+	}
+	if len(f.config.DropTypes) > 0 {
+		matched := false
+		for _, t := range f.config.DropTypes {
+			matched = matched || t == msgType
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rand.Float64() >= f.config.DropMessages {
+		return false
+	}
+	f.stats.DroppedMessages++
+	return true
+}
+
+// writeDelay returns how long to delay a write of persistent state
+func (f *faultInjector) writeDelay() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.WriteDelayMs == 0 {
+		return 0
+	}
+	f.stats.DelayedWrites++
+	return time.Duration(f.config.WriteDelayMs) * time.Millisecond
+}
+
+// corruptShare reports whether to corrupt the next share, counting it
+func (f *faultInjector) corruptShare() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.CorruptShares == 0 {
+		return false
+	}
+	f.config.CorruptShares--
+	f.stats.CorruptedShares++
+	return true
+}
+
+// installFaults hooks the fault injector into the P2P network
+func installFaults(network *blockchain.Network) {
+	log.Printf("Fault injection is compiled in; don't run this build in production")
+	network.SetMessageFilter(func(peer *blockchain.Peer, msgType string) bool {
+		return !faults.dropMessage(msgType)
+	})
+}
+
+// faultDelayWrite delays a write of persistent state if configured
+func faultDelayWrite() {
+	if delay := faults.writeDelay(); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// faultCorruptShare flips a bit of a submitted share's hash if configured
+func faultCorruptShare(hash []byte) {
+	if len(hash) > 0 && faults.corruptShare() {
+		hash[0] ^= 0x01
+	}
+}
+
+// registerFaultRoutes adds the admin endpoints controlling fault injection
+func registerFaultRoutes(api *gin.RouterGroup, network *blockchain.Network) {
+	api.GET("/admin/faults", authMiddleware(""), func(c *gin.Context) {
+		faults.mu.Lock()
+		defer faults.mu.Unlock()
+		c.JSON(http.StatusOK, gin.H{"config": faults.config, "stats": faults.stats})
+	})
+
+	// Fields left out keep their current values
+	api.PUT("/admin/faults", authMiddleware(""), func(c *gin.Context) {
+		faults.mu.Lock()
+		config := faults.config
+		faults.mu.Unlock()
+		if err := c.ShouldBindJSON(&config); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if err := config.validate(); err != nil {
+			respondError(c, err)
+			return
+		}
+		faults.mu.Lock()
+		faults.config = config
+		faults.mu.Unlock()
+		log.Printf("Fault injection set to %+v", config)
+		c.JSON(http.StatusOK, config)
+	})
+
+	api.DELETE("/admin/faults", authMiddleware(""), func(c *gin.Context) {
+		faults.mu.Lock()
+		faults.config = FaultConfig{}
+		faults.mu.Unlock()
+		log.Printf("Fault injection cleared")
+		c.Status(http.StatusNoContent)
+	})
+
+	api.POST("/admin/faults/killpeer", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Address string `json:"address" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if !network.DisconnectPeer(req.Address) {
+			respondError(c, apiErrorf(CodeNotFound, "peer %s is not connected", req.Address))
+			return
+		}
+		faults.mu.Lock()
+		faults.stats.KilledPeers++
+		faults.mu.Unlock()
+		log.Printf("Fault injection killed peer %s", req.Address)
+		c.JSON(http.StatusOK, gin.H{"address": req.Address})
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !faults
+
+package main
+
+import (
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Without the faults build tag the fault injection hooks do nothing and no
+// endpoints control them; see faults.go.
+
+func installFaults(network *blockchain.Network) {}
+
+func faultDelayWrite() {}
+
+func faultCorruptShare(hash []byte) {}
+
+func registerFaultRoutes(api *gin.RouterGroup, network *blockchain.Network) {}
@@ -0,0 +1,44 @@
+//go:build faults
+
+package main
+
+import (
+	"testing"
+)
+
+func TestFaultInjector(t *testing.T) {
+	f := &faultInjector{}
+	if f.dropMessage("block") || f.corruptShare() || f.writeDelay() != 0 {
+		t.Fatal("faults injected with none configured")
+	}
+
+	f.config = FaultConfig{DropMessages: 1, DropTypes: []string{"block"}, CorruptShares: 1}
+	if !f.dropMessage("block") || f.dropMessage("transaction") {
+		t.Error("drop_types not applied")
+	}
+	hash := []byte{0x10, 0x20}
+	if !f.corruptShare() || f.corruptShare() {
+		t.Error("corrupt_shares not counted down")
+	}
+	if f.stats.DroppedMessages != 1 || f.stats.CorruptedShares != 1 {
+		t.Errorf("stats = %+v", f.stats)
+	}
+
+	faults.config = FaultConfig{CorruptShares: 1}
+	defer func() { faults.config = FaultConfig{} }()
+	faultCorruptShare(hash)
+	if hash[0] != 0x11 {
+		t.Errorf("share hash not corrupted: %x", hash)
+	}
+}
+
+func TestFaultConfigValidate(t *testing.T) {
+	for _, config := range []FaultConfig{{DropMessages: 1.5}, {DropMessages: -0.1}, {WriteDelayMs: -1}, {CorruptShares: -1}} {
+		if err := config.validate(); err == nil {
+			t.Errorf("validate(%+v) accepted", config)
+		}
+	}
+	if err := (&FaultConfig{DropMessages: 0.5, WriteDelayMs: 100}).validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// hotWalletCheckInterval is how often the pool wallet is checked against
+// the balances owed to miners
+const hotWalletCheckInterval = 10 * time.Minute
+
+// errPayoutsPaused is returned by ProcessPayouts while the pool wallet
+// can't cover the mature balances
+var errPayoutsPaused = errors.New("payouts paused: pool wallet can't cover mature balances")
+
+// HotWalletStatus compares the pool wallet's funds with what it owes
+type HotWalletStatus struct {
+	Balance     blockchain.Amount `json:"balance"`     // Confirmed, unspent pool wallet funds
+	Liabilities blockchain.Amount `json:"liabilities"` // Mature miner balances
+	FeeReserve  blockchain.Amount `json:"fee_reserve"` // Estimated fees of paying every balance above the threshold
+	Shortfall   blockchain.Amount `json:"shortfall"`   // Missing funds, 0 when covered
+	Paused      bool              `json:"paused"`
+	CheckedAt   time.Time         `json:"checked_at"`
+}
+
+// SetFundsAlert sets the hook alerted when payouts are paused for lack of
+// funds and when they resume, see runJSONHook
+func (rm *RewardManager) SetFundsAlert(hook string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.fundsAlert = hook
+}
+
+// CheckHotWallet compares the pool wallet's balance with the mature
+// balances owed to miners, pausing payouts while it falls short. Returns
+// nil when no pool wallet key is loaded.
+func (rm *RewardManager) CheckHotWallet() *HotWalletStatus {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.payoutSigner == nil {
+		return nil
+	}
+	return rm.checkHotWallet()
+}
+
+// LastHotWalletCheck returns the result of the last check, or nil
+func (rm *RewardManager) LastHotWalletCheck() *HotWalletStatus {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.hotWallet
+}
+
+// checkHotWallet implements CheckHotWallet, logging and alerting when
+// payouts are paused or resumed; the caller must hold rm.mu and have
+// checked that payoutSigner is set. Any shortfall pauses payouts: a run
+// started anyway would fail to fund its transaction and pay no one.
+func (rm *RewardManager) checkHotWallet() *HotWalletStatus {
+	status := &HotWalletStatus{CheckedAt: time.Now()}
+	for _, out := range rm.blockchain.FindSpendableOutputs(rm.poolScript()) {
+		status.Balance += blockchain.Amount(out.Value)
+	}
+
+	fee := rm.estimatePayoutFee()
+	for minerID, balance := range rm.balances {
+		payable := balance - rm.immatureCredit(minerID)
+		if payable <= 0 {
+			continue
+		}
+		status.Liabilities += payable
+		if payable >= rm.config.PayoutThreshold {
+			status.FeeReserve += fee
+		}
+	}
+	if needed := status.Liabilities + status.FeeReserve; needed > status.Balance {
+		status.Shortfall = needed - status.Balance
+		status.Paused = true
+	}
+
+	wasPaused := rm.hotWallet != nil && rm.hotWallet.Paused
+	rm.hotWallet = status
+
+	metrics.Set("alerim_hotwallet_balance", amountCoins(status.Balance))
+	metrics.Set("alerim_hotwallet_liabilities", amountCoins(status.Liabilities))
+	metrics.Set("alerim_hotwallet_shortfall", amountCoins(status.Shortfall))
+	paused := 0.0
+	if status.Paused {
+		paused = 1
+	}
+	metrics.Set("alerim_payouts_paused", paused)
+
+	if status.Paused && !wasPaused {
+		log.Printf("WARNING: pausing payouts, the pool wallet holds %s but owes %s plus %s in fees", status.Balance, status.Liabilities, status.FeeReserve)
+		rm.alertFunds("payouts-paused", status)
+	} else if !status.Paused && wasPaused {
+		log.Printf("Resuming payouts, the pool wallet covers the %s owed", status.Liabilities)
+		rm.alertFunds("payouts-resumed", status)
+	}
+	return status
+}
+
+// estimatePayoutFee estimates the fee of a payout spending one pool
+// wallet output, with change; the caller must hold rm.mu
+func (rm *RewardManager) estimatePayoutFee() blockchain.Amount {
+	tx := blockchain.NewTransaction(
+		[]blockchain.TxInput{{Sequence: 0xFFFFFFFF}},
+		[]blockchain.TxOutput{{Script: rm.poolScript()}, {Script: rm.poolScript()}},
+	)
+	return rm.blockchain.Policy().MinFee(len(tx.Encode()) + signatureSize)
+}
+
+// alertFunds delivers a funds event to the alert hook in the background;
+// the caller must hold rm.mu
+func (rm *RewardManager) alertFunds(event string, status *HotWalletStatus) {
+	if rm.fundsAlert == "" {
+		return
+	}
+	body, err := json.MarshalIndent(map[string]interface{}{
+		"event":  event,
+		"status": status,
+	}, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding funds alert: %v", err)
+		return
+	}
+	hook := rm.fundsAlert
+	go func() {
+		client := &http.Client{Timeout: 10 * time.Second}
+		if err := runJSONHook(client, hook, body); err != nil {
+			log.Printf("Error delivering funds alert: %v", err)
+		}
+	}()
+}
+
+// StartHotWalletMonitor checks the pool wallet every interval, so payouts
+// are paused, and operators alerted, before the next payout run. It does
+// nothing when no pool wallet key is loaded.
+func (rm *RewardManager) StartHotWalletMonitor(interval time.Duration) {
+	go func() {
+		for rm.CheckHotWallet() != nil {
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// amountCoins converts an amount to coins for metrics
+func amountCoins(a blockchain.Amount) float64 {
+	return float64(a) / float64(blockchain.Coin)
+}
+
+// registerHotWalletRoutes adds the pool wallet status endpoint, which
+// requires an admin session. ?refresh=true checks the wallet again.
+func registerHotWalletRoutes(api *gin.RouterGroup, pool *MiningPool) {
+	api.GET("/admin/hotwallet", authMiddleware(""), func(c *gin.Context) {
+		status := pool.rewards.LastHotWalletCheck()
+		if status == nil || strings.EqualFold(c.Query("refresh"), "true") {
+			status = pool.rewards.CheckHotWallet()
+		}
+		if status == nil {
+			respondError(c, apiError(CodeUnavailable, "Payouts are disabled: no pool wallet key loaded"))
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+}
+
+func init() {
+	metrics.Describe("alerim_hotwallet_balance", "Confirmed unspent funds of the pool wallet, in coins")
+	metrics.Describe("alerim_hotwallet_liabilities", "Mature miner balances owed by the pool, in coins")
+	metrics.Describe("alerim_hotwallet_shortfall", "Funds the pool wallet lacks to pay every mature balance and its fee, in coins")
+	metrics.Describe("alerim_payouts_paused", "1 while payouts are paused for lack of pool wallet funds")
+}
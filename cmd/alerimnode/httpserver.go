@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPServerConfig holds the limits applied to the REST API server
+type HTTPServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxConnections    int // 0 means unlimited
+	ACL               *NetACL
+	ShutdownTimeout   time.Duration
+}
+
+// APIServer wraps the REST API in an http.Server with timeouts and a
+// connection limit
+type APIServer struct {
+	server   *http.Server
+	listener net.Listener
+	config   *HTTPServerConfig
+}
+
+// NewAPIServer serves the API on a listener bound by the caller
+func NewAPIServer(listener net.Listener, handler http.Handler, config *HTTPServerConfig) *APIServer {
+	listener = newACLListener(listener, config.ACL, "rpc")
+	if config.MaxConnections > 0 {
+		listener = newLimitListener(listener, config.MaxConnections)
+	}
+
+	return &APIServer{
+		server: &http.Server{
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			MaxHeaderBytes:    config.MaxHeaderBytes,
+		},
+		listener: listener,
+		config:   config,
+	}
+}
+
+// Serve serves requests until Shutdown is called
+func (s *APIServer) Serve() error {
+	if err := s.server.Serve(s.listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to finish, up to the configured shutdown timeout
+func (s *APIServer) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// limitListener caps the number of simultaneously open connections
+type limitListener struct {
+	net.Listener
+	sem chan struct{}
+}
+
+func newLimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{
+		Listener: l,
+		sem:      make(chan struct{}, n),
+	}
+}
+
+// Accept blocks until a connection slot is free
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.sem <- struct{}{}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// limitConn frees its listener slot exactly once when closed
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identity verification statuses tracked on the User record
+const (
+	VerificationNone     = ""
+	VerificationPending  = "pending"
+	VerificationVerified = "verified"
+	VerificationRejected = "rejected"
+)
+
+// Webhook bodies are signed with HMAC-SHA256 over "<timestamp>.<body>",
+// where the timestamp is Unix seconds sent alongside the signature
+const (
+	webhookSignatureHeader = "X-Alerim-Signature"
+	webhookTimestampHeader = "X-Alerim-Timestamp"
+)
+
+// kycCallbackMaxAge bounds how far a callback's timestamp may be from now,
+// so captured callbacks can't be replayed later
+const kycCallbackMaxAge = 5 * time.Minute
+
+var (
+	errStaleCallback    = errors.New("callback timestamp missing or outside the allowed window")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+// IdentityVerifier is a pluggable identity (KYC) verification provider
+type IdentityVerifier interface {
+	// StartVerification submits a user for verification and returns the
+	// provider's reference and the initial status
+	StartVerification(user *User) (ref string, status string, err error)
+}
+
+// WebhookVerifier submits users to an external provider over HTTP. The
+// provider reports the outcome to /api/kyc/callback, signed with the
+// shared secret.
+type WebhookVerifier struct {
+	URL    string
+	Secret []byte
+	client *http.Client
+}
+
+// NewWebhookVerifier creates a webhook-based verifier
+func NewWebhookVerifier(url string, secret []byte) *WebhookVerifier {
+	return &WebhookVerifier{
+		URL:    url,
+		Secret: secret,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// StartVerification implements IdentityVerifier
+func (v *WebhookVerifier) StartVerification(user *User) (string, string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signPayload(v.Secret, timestamp, body))
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", "", fmt.Errorf("verification provider returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", "", err
+	}
+	return result.Reference, VerificationPending, nil
+}
+
+// IdentityService runs the registration verification pipeline and gates
+// payouts on its outcome
+type IdentityService struct {
+	mu       sync.Mutex
+	verifier IdentityVerifier
+	secret   []byte
+}
+
+// NewIdentityService creates the identity service. A nil verifier disables
+// verification entirely.
+func NewIdentityService(verifier IdentityVerifier, secret []byte) *IdentityService {
+	return &IdentityService{verifier: verifier, secret: secret}
+}
+
+// Enabled reports whether identity verification is required
+func (s *IdentityService) Enabled() bool {
+	return s != nil && s.verifier != nil
+}
+
+// Register runs a newly registered user through verification
+func (s *IdentityService) Register(user *User) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	ref, status, err := s.verifier.StartVerification(user)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	user.VerificationRef = ref
+	user.VerificationStatus = status
+	s.mu.Unlock()
+	return nil
+}
+
+// PayoutAllowed reports whether payouts to a miner may proceed. When
+// verification is enabled, the miner must belong to a verified user.
+func (s *IdentityService) PayoutAllowed(minerID string) bool {
+	if !s.Enabled() {
+		return true
+	}
+
+	userID := ""
+	registryMu.RLock()
+	for _, miner := range activeMiners {
+		if miner.ID == minerID {
+			userID = miner.UserID
+			break
+		}
+	}
+	registryMu.RUnlock()
+
+	user := findUser(userID)
+	if user == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return user.VerificationStatus == VerificationVerified
+}
+
+// RegisterRoutes adds the provider callback endpoint
+func (s *IdentityService) RegisterRoutes(api *gin.RouterGroup) {
+	api.POST("/kyc/callback", func(c *gin.Context) {
+		if !s.Enabled() {
+			respondError(c, apiError(CodeNotFound, "Identity verification is disabled"))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<16))
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		err = verifyCallback(s.secret, c.GetHeader(webhookTimestampHeader), c.GetHeader(webhookSignatureHeader), body, time.Now())
+		if err != nil {
+			respondError(c, apiError(CodeUnauthorized, err.Error()))
+			return
+		}
+
+		var req struct {
+			Reference string `json:"reference"`
+			Status    string `json:"status"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if err := s.updateStatus(req.Reference, req.Status); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+}
+
+// updateStatus records the provider's decision for a verification reference
+func (s *IdentityService) updateStatus(ref, status string) error {
+	switch status {
+	case VerificationPending, VerificationVerified, VerificationRejected:
+	default:
+		return fmt.Errorf("invalid verification status: %s", status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, user := range users {
+		if ref != "" && user.VerificationRef == ref {
+			if !statusTransitionAllowed(user.VerificationStatus, status) {
+				return fmt.Errorf("cannot change verification status from %s to %s", user.VerificationStatus, status)
+			}
+			user.VerificationStatus = status
+			return nil
+		}
+	}
+	return errors.New("unknown verification reference")
+}
+
+// statusTransitionAllowed reports whether a verification status may change
+// from one value to another. A decided verification never returns to
+// pending, so a replayed early callback can't undo it.
+func statusTransitionAllowed(from, to string) bool {
+	if to == VerificationPending {
+		return from == VerificationNone || from == VerificationPending
+	}
+	return true
+}
+
+// verifyCallback checks a callback's timestamp and signature
+func verifyCallback(secret []byte, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errStaleCallback
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > kycCallbackMaxAge || age < -kycCallbackMaxAge {
+		return errStaleCallback
+	}
+	if !hmac.Equal([]byte(signature), []byte(signPayload(secret, timestamp, body))) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of a timestamped payload
+func signPayload(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyCallback(t *testing.T) {
+	secret := []byte("webhook-secret")
+	body := []byte(`{"reference":"ref-1","status":"verified"}`)
+	now := time.Unix(1700000000, 0)
+	fresh := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{"valid", fresh, signPayload(secret, fresh, body), body, nil},
+		{"missing timestamp", "", signPayload(secret, "", body), body, errStaleCallback},
+		{"replayed old callback", old, signPayload(secret, old, body), body, errStaleCallback},
+		{"timestamp swapped", fresh, signPayload(secret, old, body), body, errInvalidSignature},
+		{"body tampered", fresh, signPayload(secret, fresh, body), []byte(`{"reference":"ref-1","status":"pending"}`), errInvalidSignature},
+		{"wrong secret", fresh, signPayload([]byte("other"), fresh, body), body, errInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCallback(secret, tt.timestamp, tt.signature, tt.body, now); got != tt.want {
+				t.Errorf("verifyCallback() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusTransitionAllowed(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{VerificationNone, VerificationPending, true},
+		{VerificationPending, VerificationVerified, true},
+		{VerificationPending, VerificationRejected, true},
+		{VerificationRejected, VerificationVerified, true},
+		{VerificationVerified, VerificationRejected, true},
+		{VerificationVerified, VerificationPending, false},
+		{VerificationRejected, VerificationPending, false},
+	}
+	for _, tt := range tests {
+		if got := statusTransitionAllowed(tt.from, tt.to); got != tt.want {
+			t.Errorf("statusTransitionAllowed(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
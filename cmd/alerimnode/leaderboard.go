@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// leaderboardCacheTTL is how long a computed ranking is served
+	leaderboardCacheTTL = time.Minute
+
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 500
+)
+
+// LeaderboardEntry is one ranked miner
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	Miner       string  `json:"miner"`
+	Anonymous   bool    `json:"anonymous"`
+	Hashrate24h float64 `json:"hashrate_24h"`
+	BlocksFound int64   `json:"blocks_found"`
+}
+
+// leaderboardSorts orders entries for each ranking the API offers
+var leaderboardSorts = map[string]func(a, b *LeaderboardEntry) bool{
+	"hashrate": func(a, b *LeaderboardEntry) bool { return a.Hashrate24h > b.Hashrate24h },
+	"blocks": func(a, b *LeaderboardEntry) bool {
+		if a.BlocksFound != b.BlocksFound {
+			return a.BlocksFound > b.BlocksFound
+		}
+		return a.Hashrate24h > b.Hashrate24h
+	},
+}
+
+// Leaderboard ranks miners for the public frontend. Rankings are rebuilt
+// at most once per leaderboardCacheTTL. Miners who opted out are listed
+// under a pseudonym that is stable until the node restarts.
+type Leaderboard struct {
+	pool *MiningPool
+	salt string
+
+	mu       sync.Mutex
+	builtAt  time.Time
+	rankings map[string][]LeaderboardEntry // Sort name -> ranked entries
+}
+
+// NewLeaderboard creates a leaderboard over the pool's miners
+func NewLeaderboard(pool *MiningPool) *Leaderboard {
+	return &Leaderboard{pool: pool, salt: randomToken()}
+}
+
+// pseudonym returns the public name of a miner that opted out
+func (lb *Leaderboard) pseudonym(minerID string) string {
+	sum := sha256.Sum256([]byte(lb.salt + minerID))
+	return anonPrefix + hex.EncodeToString(sum[:4])
+}
+
+// publicName returns the name a miner is shown under publicly: its
+// pseudonym if it opted out of the leaderboard
+func (lb *Leaderboard) publicName(minerID string) string {
+	if miner := findMiner(minerID); miner != nil && miner.LeaderboardOptOut {
+		return lb.pseudonym(minerID)
+	}
+	return minerID
+}
+
+// Invalidate drops the cached rankings
+func (lb *Leaderboard) Invalidate() {
+	lb.mu.Lock()
+	lb.builtAt = time.Time{}
+	lb.mu.Unlock()
+}
+
+// build computes every ranking; the caller must hold lb.mu
+func (lb *Leaderboard) build() {
+	registryMu.RLock()
+	miners := make([]Miner, 0, len(activeMiners))
+	for _, miner := range activeMiners {
+		miners = append(miners, *miner)
+	}
+	registryMu.RUnlock()
+
+	entries := make([]LeaderboardEntry, 0, len(miners))
+	for _, miner := range miners {
+		hashrate, blocks := lb.pool.minerSummary(miner.ID)
+		if hashrate == 0 && blocks == 0 {
+			continue
+		}
+		entry := LeaderboardEntry{Miner: miner.ID, Hashrate24h: hashrate, BlocksFound: blocks}
+		if miner.LeaderboardOptOut {
+			entry.Miner = lb.pseudonym(miner.ID)
+			entry.Anonymous = true
+		}
+		entries = append(entries, entry)
+	}
+
+	lb.rankings = make(map[string][]LeaderboardEntry, len(leaderboardSorts))
+	for name, less := range leaderboardSorts {
+		ranked := make([]LeaderboardEntry, len(entries))
+		copy(ranked, entries)
+		sort.SliceStable(ranked, func(i, j int) bool { return less(&ranked[i], &ranked[j]) })
+		for i := range ranked {
+			ranked[i].Rank = i + 1
+		}
+		lb.rankings[name] = ranked
+	}
+	lb.builtAt = time.Now()
+}
+
+// Page returns a page of a ranking and the number of ranked miners
+func (lb *Leaderboard) Page(sortBy string, offset, limit int) ([]LeaderboardEntry, int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if time.Since(lb.builtAt) > leaderboardCacheTTL {
+		lb.build()
+	}
+
+	ranked := lb.rankings[sortBy]
+	if offset >= len(ranked) {
+		return []LeaderboardEntry{}, len(ranked)
+	}
+	end := offset + limit
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+	page := make([]LeaderboardEntry, end-offset)
+	copy(page, ranked[offset:end])
+	return page, len(ranked)
+}
+
+// RegisterRoutes adds the public leaderboard and the opt-out setting
+func (lb *Leaderboard) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/leaderboard", func(c *gin.Context) {
+		sortBy := c.DefaultQuery("sort", "hashrate")
+		if _, ok := leaderboardSorts[sortBy]; !ok {
+			respondError(c, apiError(CodeInvalidRequest, "sort must be hashrate or blocks"))
+			return
+		}
+		limit, err := queryInt(c, "limit", defaultLeaderboardLimit)
+		if err != nil || limit < 1 || limit > maxLeaderboardLimit {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid limit"))
+			return
+		}
+		offset, err := queryInt(c, "offset", 0)
+		if err != nil || offset < 0 {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid offset"))
+			return
+		}
+
+		entries, total := lb.Page(sortBy, offset, limit)
+		c.JSON(http.StatusOK, gin.H{
+			"sort":    sortBy,
+			"total":   total,
+			"offset":  offset,
+			"entries": entries,
+		})
+	})
+
+	api.PUT("/miners/:id/leaderboard", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		var req struct {
+			OptOut bool `json:"opt_out"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		registryMu.Lock()
+		var found *Miner
+		for _, miner := range activeMiners {
+			if miner.ID == c.Param("id") {
+				found = miner
+				break
+			}
+		}
+		if found == nil {
+			registryMu.Unlock()
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		if !authorizeUser(c, found.UserID) {
+			registryMu.Unlock()
+			respondError(c, apiError(CodeForbidden, "Not allowed to manage this miner"))
+			return
+		}
+		found.LeaderboardOptOut = req.OptOut
+		miner := *found
+		registryMu.Unlock()
+
+		lb.Invalidate()
+		c.JSON(http.StatusOK, miner)
+	})
+}
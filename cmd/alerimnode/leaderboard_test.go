@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestLeaderboardRanking(t *testing.T) {
+	pool := &MiningPool{minerStats: make(map[string]*MinerStats)}
+	stats := func(id string, hashrate float64, blocks int64) {
+		ms := NewMinerStats()
+		ms.AverageHashrate = hashrate
+		ms.BlocksFound = blocks
+		pool.minerStats[id] = ms
+	}
+	stats("slow", 10, 3)
+	stats("fast", 100, 1)
+	stats("hidden", 50, 2)
+
+	registryMu.Lock()
+	saved := activeMiners
+	activeMiners = []*Miner{
+		{ID: "slow"},
+		{ID: "fast"},
+		{ID: "hidden", LeaderboardOptOut: true},
+		{ID: "idle"},
+	}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		activeMiners = saved
+		registryMu.Unlock()
+	}()
+
+	lb := NewLeaderboard(pool)
+
+	entries, total := lb.Page("hashrate", 0, 10)
+	if total != 3 {
+		t.Fatalf("total = %d, want 3 (idle miners are left out)", total)
+	}
+	if entries[0].Miner != "fast" || entries[0].Rank != 1 || entries[2].Miner != "slow" {
+		t.Errorf("hashrate ranking = %+v", entries)
+	}
+	if !entries[1].Anonymous || entries[1].Miner == "hidden" || entries[1].Miner != lb.pseudonym("hidden") {
+		t.Errorf("opted-out miner shown as %+v", entries[1])
+	}
+
+	entries, _ = lb.Page("blocks", 0, 10)
+	if entries[0].Miner != "slow" || entries[0].BlocksFound != 3 {
+		t.Errorf("blocks ranking = %+v", entries)
+	}
+
+	entries, _ = lb.Page("hashrate", 1, 1)
+	if len(entries) != 1 || entries[0].Rank != 2 {
+		t.Errorf("page = %+v", entries)
+	}
+	if entries, _ := lb.Page("hashrate", 5, 10); len(entries) != 0 {
+		t.Errorf("page past the end = %+v", entries)
+	}
+}
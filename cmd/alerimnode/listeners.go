@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Services the node listens for, as the listeners API names them
+const (
+	ListenerAPI      = "api"
+	ListenerP2P      = "p2p"
+	ListenerStratum  = "stratum"
+	ListenerElectrum = "electrum"
+)
+
+// ListenerConfig is a service's configured listen addresses
+type ListenerConfig struct {
+	Name  string
+	Flags string   // The flags setting the addresses, for error messages
+	Addrs []string // See blockchain.ListenAddrs; port 0 picks a free port
+}
+
+// Listeners holds the node's listeners. They are all bound at startup,
+// before any service starts, so a taken port stops the node with a clear
+// error instead of leaving one service silently down.
+type Listeners struct {
+	listeners map[string]net.Listener
+	addrs     map[string][]string // Bound addresses, ephemeral ports resolved
+}
+
+// configuredListeners returns the listen addresses of every enabled
+// service from the flags, with p2pPort already defaulted to the network's
+func configuredListeners(p2pPort int) ([]ListenerConfig, error) {
+	type service struct {
+		name, flags, binds string
+		port               int
+	}
+	services := []service{
+		{ListenerAPI, "-port, -rpcbind", *rpcBind, *port},
+		{ListenerP2P, "-p2p, -p2pbind", *p2pBind, p2pPort},
+		{ListenerStratum, "-stratum, -stratumbind", *stratumBind, *stratumPort},
+	}
+	if *electrumPort != 0 {
+		services = append(services, service{ListenerElectrum, "-electrum, -electrumbind", *electrumBind, *electrumPort})
+	}
+
+	configs := make([]ListenerConfig, 0, len(services))
+	for _, service := range services {
+		addrs, err := blockchain.ListenAddrs(splitList(service.binds), service.port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", service.flags, err)
+		}
+		configs = append(configs, ListenerConfig{Name: service.name, Flags: service.flags, Addrs: addrs})
+	}
+	return configs, nil
+}
+
+// BindListeners checks that no address is claimed by two services, then
+// binds every service's addresses. If any fails nothing is left bound.
+func BindListeners(configs []ListenerConfig) (*Listeners, error) {
+	if err := checkListenerConflicts(configs); err != nil {
+		return nil, err
+	}
+
+	l := &Listeners{
+		listeners: make(map[string]net.Listener),
+		addrs:     make(map[string][]string),
+	}
+	for _, config := range configs {
+		listener, err := blockchain.Listen(config.Addrs)
+		if err != nil {
+			l.Close()
+			if errors.Is(err, syscall.EADDRINUSE) {
+				return nil, fmt.Errorf("%s listener (%s): %v; is another node or service using the port?", config.Name, config.Flags, err)
+			}
+			return nil, fmt.Errorf("%s listener (%s): %v", config.Name, config.Flags, err)
+		}
+		l.listeners[config.Name] = listener
+		l.addrs[config.Name] = blockchain.ListenerAddrs(listener)
+	}
+	return l, nil
+}
+
+// checkListenerConflicts returns an error naming the first two services
+// configured to listen on the same port of overlapping hosts
+func checkListenerConflicts(configs []ListenerConfig) error {
+	for i, a := range configs {
+		for _, b := range configs[i+1:] {
+			for _, addrA := range a.Addrs {
+				for _, addrB := range b.Addrs {
+					if listenAddrsOverlap(addrA, addrB) {
+						return fmt.Errorf("%s listener %s (%s) and %s listener %s (%s) use the same port", a.Name, addrA, a.Flags, b.Name, addrB, b.Flags)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listenAddrsOverlap reports whether two listen addresses would claim the
+// same socket: the same fixed port on the same host, or with either
+// listening on every interface
+func listenAddrsOverlap(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB || portA == "0" {
+		return false
+	}
+	return hostA == hostB || unspecifiedHost(hostA) || unspecifiedHost(hostB)
+}
+
+// unspecifiedHost reports whether a listen host means every interface
+func unspecifiedHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// Listener returns the listener of a service, or nil if it has none
+func (l *Listeners) Listener(name string) net.Listener {
+	return l.listeners[name]
+}
+
+// Addrs returns the bound addresses of every service
+func (l *Listeners) Addrs() map[string][]string {
+	return l.addrs
+}
+
+// String lists the services and their bound addresses for logging
+func (l *Listeners) String() string {
+	parts := make([]string, 0, len(l.addrs))
+	for _, name := range []string{ListenerAPI, ListenerP2P, ListenerStratum, ListenerElectrum} {
+		if addrs, ok := l.addrs[name]; ok {
+			parts = append(parts, name+" on "+strings.Join(addrs, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Close closes every listener; services that took one close it themselves
+// when they stop
+func (l *Listeners) Close() {
+	for _, listener := range l.listeners {
+		listener.Close()
+	}
+}
+
+// registerListenerRoutes reports the bound listen addresses, so tools
+// starting a node on ephemeral ports can find them
+func registerListenerRoutes(api *gin.RouterGroup, listeners *Listeners) {
+	api.GET("/listeners", func(c *gin.Context) {
+		c.JSON(http.StatusOK, listeners.Addrs())
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestListenAddrsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{":8545", ":8545", true},
+		{":8545", "127.0.0.1:8545", true},
+		{"[::]:8545", "127.0.0.1:8545", true},
+		{"127.0.0.1:8545", "127.0.0.1:8545", true},
+		{"127.0.0.1:8545", "10.0.0.1:8545", false},
+		{":8545", ":9000", false},
+		{":0", ":0", false},
+	}
+	for _, tt := range tests {
+		if got := listenAddrsOverlap(tt.a, tt.b); got != tt.overlap {
+			t.Errorf("listenAddrsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.overlap)
+		}
+	}
+}
+
+func TestBindListenersConflict(t *testing.T) {
+	_, err := BindListeners([]ListenerConfig{
+		{Name: ListenerAPI, Flags: "-port", Addrs: []string{":8545"}},
+		{Name: ListenerStratum, Flags: "-stratum", Addrs: []string{"127.0.0.1:8545"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "-port") || !strings.Contains(err.Error(), "-stratum") {
+		t.Errorf("conflict error = %v, want both flags named", err)
+	}
+}
+
+func TestBindListenersEphemeral(t *testing.T) {
+	listeners, err := BindListeners([]ListenerConfig{
+		{Name: ListenerAPI, Addrs: []string{"127.0.0.1:0"}},
+		{Name: ListenerP2P, Addrs: []string{"127.0.0.1:0"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listeners.Close()
+
+	addrs := listeners.Addrs()
+	for _, name := range []string{ListenerAPI, ListenerP2P} {
+		if len(addrs[name]) != 1 || strings.HasSuffix(addrs[name][0], ":0") {
+			t.Errorf("%s addresses = %v, want the chosen port", name, addrs[name])
+		}
+	}
+	if addrs[ListenerAPI][0] == addrs[ListenerP2P][0] {
+		t.Error("listeners share a port")
+	}
+	if listeners.Listener(ListenerStratum) != nil {
+		t.Error("unconfigured listener bound")
+	}
+}
+
+func TestBindListenersPortInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	_, err = BindListeners([]ListenerConfig{
+		{Name: ListenerAPI, Flags: "-port", Addrs: []string{"127.0.0.1:0"}},
+		{Name: ListenerP2P, Flags: "-p2p", Addrs: []string{taken.Addr().String()}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "p2p") {
+		t.Fatalf("bind error = %v, want the p2p listener named", err)
+	}
+}
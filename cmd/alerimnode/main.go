@@ -1,26 +1,109 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexandrut83/alerimAIM/blockchain"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-contrib/cors"
 )
 
 var (
 	port = flag.Int("port", 8545, "Node port")
-	p2pPort = flag.Int("p2p", 9000, "P2P port")
+	p2pPort = flag.Int("p2p", 0, "P2P port (default: the network's default port)")
+	rpcBind = flag.String("rpcbind", "", "Comma-separated addresses the API listens on, as host or host:port, IPv6 bracketed or bare (default: all interfaces)")
+	p2pBind = flag.String("p2pbind", "", "Comma-separated addresses the P2P listener binds, as for -rpcbind")
+	stratumBind = flag.String("stratumbind", "", "Comma-separated addresses the stratum listener binds, as for -rpcbind")
+	electrumBind = flag.String("electrumbind", "", "Comma-separated addresses the Electrum listener binds, as for -rpcbind")
 	peers = flag.String("peers", "", "Comma-separated list of peer addresses")
+	maxUploadTarget = flag.String("maxuploadtarget", "", "Bytes uploaded to peers per 24 hours, e.g. 5GB, past which historical blocks stop being served (empty for no target)")
+	p2pCompress = flag.Bool("p2pcompress", true, "Compress large P2P messages, such as blocks, to peers that accept it")
+	txRelayDelay = flag.Duration("txrelaydelay", blockchain.DefaultTxRelayDelay, "Mean random delay before relaying transactions to a peer, doubled for inbound peers (0 to relay at once)")
+	walletRelayPeers = flag.Int("walletrelaypeers", 0, "Number of random peers, outbound first, this node's own transactions are first sent to (0 for all)")
+	pinnedPeers = flag.String("pinnedpeers", "", "Comma-separated peer addresses always reconnected, never evicted and exempt from misbehavior disconnects")
+	stratumPort = flag.Int("stratum", 3333, "Stratum mining port")
+	rpcAllowIP = flag.String("rpcallowip", "", "Comma-separated CIDRs/IPs allowed to connect to the API (default: all)")
+	rpcDenyIP = flag.String("rpcdenyip", "", "Comma-separated CIDRs/IPs denied from the API")
+	stratumAllowIP = flag.String("stratumallowip", "", "Comma-separated CIDRs/IPs allowed to connect to stratum (default: all)")
+	stratumDenyIP = flag.String("stratumdenyip", "", "Comma-separated CIDRs/IPs denied from stratum")
+	p2pAllowIP = flag.String("p2pallowip", "", "Comma-separated CIDRs/IPs allowed to connect over P2P (default: all)")
+	p2pDenyIP = flag.String("p2pdenyip", "", "Comma-separated CIDRs/IPs denied from P2P")
+	httpReadTimeout = flag.Duration("httpreadtimeout", 15*time.Second, "Maximum duration for reading an API request")
+	httpReadHeaderTimeout = flag.Duration("httpreadheadertimeout", 5*time.Second, "Maximum duration for reading API request headers")
+	httpWriteTimeout = flag.Duration("httpwritetimeout", 30*time.Second, "Maximum duration for writing an API response")
+	httpIdleTimeout = flag.Duration("httpidletimeout", 120*time.Second, "Maximum keep-alive idle time for API connections")
+	httpMaxHeaderBytes = flag.Int("httpmaxheaderbytes", 1<<20, "Maximum size of API request headers")
+	httpMaxConns = flag.Int("httpmaxconns", 512, "Maximum simultaneous API connections (0 for unlimited)")
+	httpShutdownTimeout = flag.Duration("httpshutdowntimeout", 10*time.Second, "Time allowed for in-flight API requests to finish on shutdown")
+	corsOrigins = flag.String("corsorigins", "*", "Comma-separated origins allowed to call the public API")
+	adminCORSOrigins = flag.String("admincorsorigins", "", "Comma-separated origins allowed to call the admin API with credentials")
+	adminUser = flag.String("adminuser", "admin", "Admin panel username")
+	adminPassword = flag.String("adminpassword", "", "Admin panel password (login is disabled when empty)")
+	adminSessionTimeout = flag.Duration("adminsessiontimeout", 24*time.Hour, "Idle timeout of admin panel sessions")
+	maxLoginAttempts = flag.Int("maxloginattempts", 5, "Failed admin logins before a client is locked out")
+	loginLockout = flag.Duration("loginlockout", 30*time.Minute, "Lockout duration after too many failed admin logins")
+	trustedProxies = flag.String("trustedproxies", "", "Comma-separated proxy CIDRs/IPs whose X-Forwarded-For is trusted (default: none)")
+	secretsProvider = flag.String("secretsprovider", "env", "Secrets provider for wallet and signing keys: env, file or command")
+	secretsDir = flag.String("secretsdir", "", "Directory of encrypted secret files (default: <datadir>/secrets)")
+	secretsCommand = flag.String("secretscommand", "", "Command fetching a secret from a KMS/Vault (%s is replaced by the secret name)")
+	networkName = flag.String("network", "mainnet", "Built-in network to run: mainnet or regtest (ignored with -chainparams)")
+	chainParamsFile = flag.String("chainparams", "", "Signed chain parameters file to run a custom network")
+	chainParamsKeys = flag.String("chainparamskeys", "", "Comma-separated public keys trusted to sign the chain parameters file")
+	checkpoints = flag.String("checkpoints", "", "Comma-separated height:hash checkpoints added to the network's own")
+	kycWebhook = flag.String("kycwebhook", "", "Identity verification provider URL; enables KYC gating of payouts when set")
+	exchangeWebhook = flag.String("exchangewebhook", "", "Exchange/swap service URL; enables converted payouts when set")
+	exchangeCurrencies = flag.String("exchangecurrencies", "BTC", "Comma-separated currencies the exchange can convert payouts to")
+	minRelayFee = amountFlag("minrelayfee", blockchain.DefaultPolicy().MinRelayFeeRate, "Minimum fee rate, in AIM per 1000 bytes, for relaying transactions")
+	dustThreshold = amountFlag("dustthreshold", blockchain.DefaultPolicy().DustThreshold, "Smallest output value, in AIM, accepted for relay")
+	maxStandardTxSize = flag.Int("maxstandardtxsize", blockchain.DefaultPolicy().MaxStandardTxSize, "Largest transaction, in bytes, accepted for relay")
+	blockMaxSize = flag.Int("blockmaxsize", blockchain.DefaultPolicy().BlockMaxSize, "Largest block, in bytes, built for mining")
+	maxMempoolSize = flag.Int("maxmempoolsize", blockchain.DefaultPolicy().MaxMempoolSize, "Largest mempool, in bytes, before the lowest fee rate transactions are evicted")
+	maxMempoolTxs = flag.Int("maxmempooltxs", blockchain.DefaultPolicy().MaxMempoolTxs, "Most transactions kept in the mempool")
+	richList = flag.Bool("richlist", false, "Maintain the address balance index behind /api/richlist")
+	txIndex = flag.Bool("txindex", false, "Maintain an index of all transactions, for lookups by hash (stored in <datadir>/chainstate)")
+	addressIndex = flag.Bool("addressindex", false, "Maintain an index of the transactions of every address behind /api/address/:address/history")
+	electrumPort = flag.Int("electrum", 0, "Electrum protocol port for light wallets (0 to disable)")
+	electrumCert = flag.String("electrumcert", "", "TLS certificate file for the Electrum port (plain TCP when empty)")
+	electrumKey = flag.String("electrumkey", "", "TLS private key file for the Electrum port")
+	dataDirFlag = flag.String("datadir", defaultDataDir(), "Data directory (blocks/, chainstate/, wallets/, pool/, logs/)")
+	noMigrate = flag.Bool("no-migrate", false, "Refuse to start instead of migrating an outdated data directory")
+	blockNotify = flag.String("blocknotify", "", "Command or webhook URL to run when a new block arrives (%s is replaced by the block hash)")
+	walletNotify = flag.String("walletnotify", "", "Command or webhook URL to run when a wallet transaction arrives (%s is replaced by the tx hash)")
+	reorgNotify = flag.String("reorgnotify", "", "Command or webhook URL to run on chain reorganization (%s is replaced by the new tip hash)")
+	storageLimits = flag.String("storagelimits", "", "Comma-separated disk usage limits by data directory component, e.g. blocks=50GB,pool=2GB (blocks, chainstate, wallets, pool, logs, other)")
+	storageWarn = flag.Float64("storagewarn", 0.9, "Fraction of a storage limit at which to warn")
+	shareLogDays = flag.Int("sharelogdays", 30, "Days of issued jobs and submitted shares kept in pool/sharelog for dispute resolution (0 to disable)")
+	walletBackupDir = flag.String("walletbackupdir", "", "Directory of encrypted pool wallet backups, passphrase from ALERIM_WALLET_BACKUP_PASSPHRASE (disabled when empty)")
+	walletBackupInterval = flag.Duration("walletbackupinterval", 24*time.Hour, "Interval between pool wallet backups")
+	walletBackupKeep = flag.Int("walletbackupkeep", 7, "Number of pool wallet backups kept")
+	walletBackupNotify = flag.String("walletbackupnotify", "", "Command or webhook URL alerted as JSON (on stdin for commands) when a pool wallet backup fails")
+	payoutSignerCommand = flag.String("payoutsigner", "", "External signer bridge command holding the payout key, e.g. on a hardware wallet (run with getpubkey or signhash <hex>)")
+	payoutSignerTimeout = flag.Duration("payoutsignertimeout", 2*time.Minute, "How long the external signer may take, including confirmation on the device")
+	sendManyMaxOutputs = flag.Int("sendmanymaxoutputs", defaultSendManyMaxOutputs, "Most outputs a sendmany transaction may have")
+	fundsNotify = flag.String("fundsnotify", "", "Command or webhook URL alerted as JSON (on stdin for commands) when payouts pause for lack of pool wallet funds, and when they resume")
+	loadBlock = flag.String("loadblock", "", "Comma-separated bootstrap files of blocks to import on start, e.g. when peers are unreachable")
+	poolStateURL = flag.String("poolstate", "", "Redis URL, e.g. redis://10.0.0.5:6379/0, keeping the active jobs, submitted shares and worker difficulties shared by pool instances (in memory when empty)")
+	shareWALFlush = flag.Duration("sharewalflush", time.Second, "Interval at which the current round's shares are flushed to pool/shares.wal, replayed after a crash (0 to keep them in memory only)")
+	anomalyAction = flag.String("anomalyaction", AnomalyActionFlag, "Action on workers with anomalous share streams: flag (list for review only), raisediff (also raise their difficulty) or quarantine (also hold their payouts until cleared)")
+	anomalySpike = flag.Float64("anomalyspike", 10, "Factor over a worker's baseline hashrate that counts as a sudden spike")
+	varDiffAlgorithm = flag.String("vardiff", VarDiffEMA, "Vardiff algorithm: ema (moving average of share times), window (mean of recent share times, skipped while they vary) or ab (half the workers each, compared at /api/admin/vardiff/evaluation)")
+	diffClassesFile = flag.String("diffclasses", "", "JSON file of the classes of miners starting at a multiple of the minimum share difficulty, matched by user agent (built-in asic, gpu and cpu classes when empty)")
+	finderBonus = flag.Float64("finderbonus", 0, "Percentage of each block's reward, after the pool fee, paid to the worker whose share found it")
+	reportNotify = flag.String("reportnotify", "", "Command or webhook URL receiving each daily pool report as JSON (on stdin for commands)")
+	confFile = flag.String("conf", "", "Config file of name=value settings, reread on SIGHUP for the relay policy and IP allow/deny lists")
+	pidFile = flag.String("pid", "", "File the node's process ID is written to while it runs (none when empty)")
 )
 
 // Global state for mining statistics
@@ -35,68 +118,497 @@ var stats = &MiningStats{
 	Difficulty: new(big.Int),
 }
 
+// ready is set once all node subsystems have started
+var ready int32
+
+// apiKeys authenticates programmatic access to the API
+var apiKeys *APIKeyStore
+
 func main() {
+	if runSubcommand() {
+		return
+	}
+
+	startedAt := time.Now()
 	flag.Parse()
+	cmdLine := commandLineFlags()
+	if err := applyEnvConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if *confFile != "" {
+		if err := applyConfigFile(*confFile, cmdLine, nil); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+		}
+	}
+	service, err := startService(*pidFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Prepare the data directory layout
+	dataDir := &DataDir{Root: *dataDirFlag}
+	if err := dataDir.Init(); err != nil {
+		log.Fatal(err)
+	}
+	if err := dataDir.Migrate(migrations, !*noMigrate); err != nil {
+		log.Fatal(err)
+	}
 
 	// Set Gin to release mode
 	gin.SetMode(gin.ReleaseMode)
 
 	// Initialize blockchain
-	bc := blockchain.NewBlockchain()
+	params, ok := blockchain.ParamsForNetwork(*networkName)
+	if !ok {
+		log.Fatalf("Unknown network: %s", *networkName)
+	}
+	if *chainParamsFile != "" {
+		loaded, err := loadChainParamsFile(*chainParamsFile, *chainParamsKeys)
+		if err != nil {
+			log.Fatalf("Failed to load chain parameters: %v", err)
+		}
+		params = loaded
+		log.Printf("Loaded signed chain parameters for network %s", params.Name)
+	}
+	if *checkpoints != "" {
+		extra, err := parseCheckpoints(*checkpoints)
+		if err != nil {
+			log.Fatalf("Invalid -checkpoints: %v", err)
+		}
+		if params, err = params.WithCheckpoints(extra); err != nil {
+			log.Fatalf("Invalid -checkpoints: %v", err)
+		}
+	}
+	bc := blockchain.NewBlockchainWithParams(params)
+	if err := applyPolicyFlags(bc); err != nil {
+		log.Fatal(err)
+	}
+	if *p2pPort == 0 {
+		*p2pPort = params.DefaultPort
+	}
+
+	// Import bootstrap files before anything subscribes to the chain, so
+	// imported blocks don't fire notification hooks
+	for _, path := range splitList(*loadBlock) {
+		if err := importBootstrapFile(bc, path); err != nil {
+			log.Printf("Bootstrap import from %s stopped: %v", path, err)
+		}
+	}
+	if *txIndex {
+		if err := bc.EnableTxIndex(filepath.Join(dataDir.Chainstate(), "txindex.dat")); err != nil {
+			log.Fatalf("Failed to load the transaction index: %v", err)
+		}
+	}
+	if *addressIndex {
+		bc.EnableAddressIndex()
+	}
+
+	// Wire up operator notification hooks
+	notifier := NewNotifier(&NotifyConfig{
+		BlockNotify:  *blockNotify,
+		WalletNotify: *walletNotify,
+		ReorgNotify:  *reorgNotify,
+	})
+	bc.Subscribe(notifier.HandleNotification)
+
+	// Build per-listener network ACLs
+	rpcACL, err := ParseNetACL(*rpcAllowIP, *rpcDenyIP)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stratumACL, err := ParseNetACL(*stratumAllowIP, *stratumDenyIP)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p2pACL, err := ParseNetACL(*p2pAllowIP, *p2pDenyIP)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Bind every listener before starting any service, so a taken port
+	// stops the node here rather than leaving a service down
+	listenerConfigs, err := configuredListeners(*p2pPort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listeners, err := BindListeners(listenerConfigs)
+	if err != nil {
+		log.Fatalf("Failed to bind listeners: %v", err)
+	}
+	log.Printf("Listening: %s", listeners)
 
 	// Initialize P2P network
-	network, err := blockchain.NewNetwork(bc, *p2pPort)
+	network := blockchain.NewNetworkWithListener(bc, listeners.Listener(ListenerP2P))
+	installFaults(network)
+	network.SetCompression(*p2pCompress)
+	network.SetTxRelayDelay(*txRelayDelay)
+	network.SetWalletRelayPeers(*walletRelayPeers)
+	if *maxUploadTarget != "" {
+		target, err := parseByteSize(*maxUploadTarget)
+		if err != nil {
+			log.Fatalf("Invalid -maxuploadtarget: %v", err)
+		}
+		network.SetMaxUploadTarget(uint64(target))
+	}
+	network.SetConnFilter(func(addr net.Addr) bool {
+		if p2pACL.Allowed(addr) {
+			return true
+		}
+		metrics.Inc("alerim_rejected_connections_total", "listener", "p2p")
+		return false
+	})
+
+	// Keep pinned and configured peers connected, or the network's seeds
+	// when none are configured
+	for _, peer := range splitList(*pinnedPeers) {
+		if err := network.AddPeer(peer, true); err != nil {
+			log.Fatalf("Invalid -pinnedpeers: %v", err)
+		}
+	}
+	for _, peer := range splitList(*peers) {
+		if err := network.AddPeer(peer, false); err != nil {
+			log.Fatalf("Invalid -peers: %v", err)
+		}
+	}
+	if *peers == "" && *pinnedPeers == "" {
+		network.ConnectSeeds()
+	}
+
+	// Load keys from the secrets provider
+	if *secretsDir == "" {
+		*secretsDir = filepath.Join(dataDir.Root, "secrets")
+	}
+	secrets, err := NewSecretProvider(*secretsProvider, *secretsDir, os.Getenv(envPrefix+"SECRETS_PASSPHRASE"), *secretsCommand)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Connect to initial peers
-	if *peers != "" {
-		for _, peer := range strings.Split(*peers, ",") {
-			if err := network.Connect(peer); err != nil {
-				log.Printf("Failed to connect to peer %s: %v", peer, err)
-			}
+	// Optional identity verification on registration
+	var verifier IdentityVerifier
+	kycSecret, err := secrets.GetSecret(SecretKYCWebhookKey)
+	if err != nil && err != ErrSecretNotFound {
+		log.Fatalf("Failed to load %s: %v", SecretKYCWebhookKey, err)
+	}
+	if *kycWebhook != "" {
+		if len(kycSecret) == 0 {
+			log.Fatalf("KYC webhook requires the %s secret", SecretKYCWebhookKey)
 		}
+		verifier = NewWebhookVerifier(*kycWebhook, kycSecret)
+	}
+	identity := NewIdentityService(verifier, kycSecret)
+
+	// Initialize the mining pool
+	var shareLog *ShareLog
+	if *shareLogDays > 0 {
+		shareLog, err = NewShareLog(shareLogDir(dataDir), *shareLogDays)
+		if err != nil {
+			log.Fatalf("Failed to open share log: %v", err)
+		}
+		defer shareLog.Close()
+	}
+	// Workers with suspicious share streams are flagged for review
+	anomalies, err := NewAnomalyDetector(filepath.Join(dataDir.Pool(), "anomalies.json"), AnomalyConfig{
+		Action:      *anomalyAction,
+		SpikeFactor: *anomalySpike,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Pool instances behind one stratum endpoint share their hot state
+	var poolState PoolState
+	if *poolStateURL != "" {
+		redisPassword, err := secrets.GetSecret(SecretRedisPassword)
+		if err != nil && err != ErrSecretNotFound {
+			log.Fatalf("Failed to load %s: %v", SecretRedisPassword, err)
+		}
+		redis, err := NewRedisClient(*poolStateURL, string(redisPassword))
+		if err != nil {
+			log.Fatalf("Invalid -poolstate: %v", err)
+		}
+		defer redis.Close()
+		if _, err := redis.Do("PING"); err != nil {
+			log.Fatalf("Failed to connect to pool state server: %v", err)
+		}
+		poolState = NewRedisPoolState(redis)
+	}
+	var diffClasses []DiffClass
+	if *diffClassesFile != "" {
+		if diffClasses, err = LoadDiffClasses(*diffClassesFile); err != nil {
+			log.Fatalf("Invalid -diffclasses: %v", err)
+		}
+	}
+	pool := NewMiningPool(bc, &PoolConfig{
+		StratumListener: listeners.Listener(ListenerStratum),
+		StratumACL:      stratumACL,
+		DataDir:         dataDir.Pool(),
+		ShareLog:        shareLog,
+		Anomalies:       anomalies,
+		State:           poolState,
+		DiffClasses:     diffClasses,
+		Network:         network,
+	})
+	varDiffConfig := *pool.vardiff.Config()
+	varDiffConfig.Algorithm = *varDiffAlgorithm
+	if err := pool.vardiff.SetConfig(&varDiffConfig); err != nil {
+		log.Fatalf("Invalid -vardiff: %v", err)
+	}
+	if err := pool.rewards.SetFinderBonus(*finderBonus); err != nil {
+		log.Fatalf("Invalid -finderbonus: %v", err)
+	}
+	if *shareWALFlush > 0 {
+		if err := pool.rewards.OpenShareWAL(filepath.Join(dataDir.Pool(), "shares.wal"), *shareWALFlush); err != nil {
+			log.Fatalf("Failed to open share WAL: %v", err)
+		}
+	}
+	var poolKey *ecdsa.PrivateKey
+	poolKeySecret, err := secrets.GetSecret(SecretPoolWalletKey)
+	if err == ErrSecretNotFound {
+		log.Printf("WARNING: no %s secret configured, payouts and wallet RPCs are disabled", SecretPoolWalletKey)
+	} else if err != nil {
+		log.Fatalf("Failed to load %s: %v", SecretPoolWalletKey, err)
+	} else {
+		poolKey, err = parsePrivateKey(poolKeySecret)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", SecretPoolWalletKey, err)
+		}
+		pool.rewards.SetPayoutKey(poolKey)
+	}
+	if *payoutSignerCommand != "" {
+		signer, err := NewExternalSigner(*payoutSignerCommand, *payoutSignerTimeout)
+		if err != nil {
+			log.Fatalf("Failed to start the payout signer: %v", err)
+		}
+		pool.rewards.SetPayoutSigner(signer)
+		log.Printf("Payouts are signed by the external signer %q", *payoutSignerCommand)
+	}
+	if *walletBackupDir != "" {
+		if poolKey == nil {
+			log.Fatalf("-walletbackupdir requires the %s secret", SecretPoolWalletKey)
+		}
+		backups, err := NewWalletBackups(*walletBackupDir, os.Getenv(envPrefix+"WALLET_BACKUP_PASSPHRASE"), *walletBackupKeep, poolKey, *walletBackupNotify)
+		if err != nil {
+			log.Fatalf("Invalid wallet backup settings: %v", err)
+		}
+		backups.Start(*walletBackupInterval)
+	}
+	pool.rewards.SetPayoutGate(func(minerID string) bool {
+		return identity.PayoutAllowed(minerID) && !anomalies.Quarantined(minerID)
+	})
+
+	// Optional conversion of payouts through an external exchange
+	if *exchangeWebhook != "" {
+		exchangeSecret, err := secrets.GetSecret(SecretExchangeKey)
+		if err != nil {
+			log.Fatalf("Exchange webhook requires the %s secret: %v", SecretExchangeKey, err)
+		}
+		pool.rewards.SetPayoutAdapter(NewWebhookPayoutAdapter(*exchangeWebhook, exchangeSecret, splitList(*exchangeCurrencies)))
+	}
+	pool.rewards.SetFundsAlert(*fundsNotify)
+	pool.rewards.StartHotWalletMonitor(hotWalletCheckInterval)
+	pool.rewards.StartPayoutProcessor()
+
+	// Read-only miner tokens survive restarts only with a configured key
+	minerTokenKey, err := secrets.GetSecret(SecretMinerTokenKey)
+	if err == ErrSecretNotFound {
+		log.Printf("WARNING: no %s secret configured, using an ephemeral key; miner tokens won't survive restarts", SecretMinerTokenKey)
+		minerTokenKey = []byte(randomToken())
+	} else if err != nil {
+		log.Fatalf("Failed to load %s: %v", SecretMinerTokenKey, err)
+	}
+	minerTokens := NewMinerTokenIssuer(minerTokenKey)
+
+	// Load API keys
+	apiKeys, err = NewAPIKeyStore(filepath.Join(dataDir.Root, "apikeys.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Comments on the outputs of wallet transactions
+	txLabels, err := NewTxLabels(filepath.Join(dataDir.Wallets(), "labels.json"))
+	if err != nil {
+		log.Fatalf("Failed to load transaction labels: %v", err)
+	}
+
+	// Accounts of restored seeds the wallet watches
+	walletAccounts, err := NewWalletAccounts(filepath.Join(dataDir.Wallets(), "accounts.json"))
+	if err != nil {
+		log.Fatalf("Failed to load wallet accounts: %v", err)
+	}
+
+	// Farm operators' groups of workers
+	subAccounts, err = NewSubAccountStore(filepath.Join(dataDir.Pool(), "subaccounts.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Users' webhooks for their workers' balances, payouts and blocks
+	webhooks, err = NewWebhookService(filepath.Join(dataDir.Pool(), "webhooks.json"), pool.rewards)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Operator actions outside the normal share and payout flow
+	audit, err := NewAuditLog(filepath.Join(dataDir.Root, "audit.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pool.rewards.SetAuditLog(audit)
+
+	// Disk usage reporting against the configured limits
+	limits, err := parseStorageLimits(*storageLimits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage, err := NewStorageManager(dataDir, limits, *storageWarn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage.Start(storageScanInterval)
+
+	// Daily pool summaries for operators
+	reporter, err := NewReporter(pool.rewards, filepath.Join(dataDir.Pool(), "reports.json"), *reportNotify)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reporter.Start()
+
+	// Watch-only tracking of descriptor sets, e.g. the pool's cold wallet
+	watches, err := NewWatchService(bc, filepath.Join(dataDir.Root, "watchlists.json"))
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Initialize HTTP server
 	router := gin.Default()
 
-	// Configure CORS
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// Only trust forwarding headers from configured proxies, so clients
+	// can't spoof their address to evade login throttling or ACLs
+	if err := router.SetTrustedProxies(splitList(*trustedProxies)); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	// Configure CORS: the public API is open to any origin without
+	// credentials, the admin API only to the configured allowlist
+	adminPolicy := adminCORS(splitList(*adminCORSOrigins))
+	corsPolicies := NewCORSPolicies(publicCORS(splitList(*corsOrigins))).
+		Route("/admin", adminPolicy).
+		Route("/api/admin", adminPolicy).
+		Route("/api/miners", adminPolicy).
+		Route("/api/users", adminPolicy).
+		Route("/api/wallets", adminPolicy).
+		Route("/api/watch", adminPolicy)
+	router.Use(corsPolicies.Middleware())
+
+	// Cookie sessions for the admin panel
+	sessions := NewSessionManager(&SessionConfig{
+		Username:         *adminUser,
+		Password:         *adminPassword,
+		Timeout:          *adminSessionTimeout,
+		MaxLoginAttempts: *maxLoginAttempts,
+		LockoutDuration:  *loginLockout,
+	})
+	router.Use(sessions.Middleware())
 
 	// Static files for admin panel
 	router.Static("/admin", "./wallet/web")
 
+	// Prometheus metrics
+	router.GET("/metrics", metrics.Handler())
+
+	// Container orchestration probes
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "alive"})
+	})
+
+	router.GET("/readyz", func(c *gin.Context) {
+		if atomic.LoadInt32(&ready) == 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "starting"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ready",
+			"height": bc.GetHeight(),
+		})
+	})
+
+	status := &nodeStatus{
+		chain:        bc,
+		network:      network,
+		pool:         pool,
+		listeners:    listeners,
+		walletLoaded: poolKey != nil,
+		startedAt:    startedAt,
+	}
+
 	// API endpoints
 	api := router.Group("/api")
 	{
+		sessions.RegisterRoutes(api)
+		apiKeys.RegisterRoutes(api)
+		identity.RegisterRoutes(api)
+		registerPrivacyRoutes(api, pool)
+		registerExchangeRoutes(api, pool)
+		registerPayoutSplitRoutes(api)
+		registerSubAccountRoutes(api, pool)
+		registerWebhookRoutes(api)
+		registerPolicyRoutes(api, bc)
+		registerListenerRoutes(api, listeners)
+		registerInfoRoutes(api, status)
+		registerFaultRoutes(api, network)
+		registerMinerRoutes(api, pool, minerTokens)
+		registerAdjustmentRoutes(api, pool)
+		audit.RegisterRoutes(api)
+		reporter.RegisterRoutes(api)
+		storage.RegisterRoutes(api)
+		registerHotWalletRoutes(api, pool)
+		registerErrorRoutes(api)
+		registerBootstrapRoutes(api, bc)
+		anomalies.RegisterRoutes(api, audit)
+		registerVarDiffRoutes(api, pool, audit)
+		leaderboard := NewLeaderboard(pool)
+		leaderboard.RegisterRoutes(api)
+		registerBlockRoutes(api, pool.rewards, leaderboard)
+		registerAddressRoutes(api, bc)
+		watches.RegisterRoutes(api)
+		NewAnalyticsIndex(bc).RegisterRoutes(api)
+		if *richList {
+			NewRichListIndex(bc).RegisterRoutes(api)
+		}
+
+		// JSON-RPC for integrators' existing tooling
+		rpc := NewRPCServer()
+		registerRawTxRPCs(rpc, bc, network, poolKey, txLabels, walletAccounts, *sendManyMaxOutputs)
+		registerMessageRPCs(rpc, poolKey)
+		registerScriptRPCs(rpc)
+		registerAccountRPCs(rpc, bc, walletAccounts)
+		registerMiningRPCs(rpc, bc, longPollTimeout(*httpWriteTimeout))
+		registerChainRPCs(rpc, bc)
+		registerNetRPCs(rpc, network)
+		registerInfoRPCs(rpc, status)
+		registerGenerateRPCs(rpc, bc)
+		rpc.RegisterRoutes(api)
+
 		// Blockchain endpoints
+		// Status is polled by dashboards and load balancers, so it only
+		// reads the chain's lock-free snapshot
 		api.GET("/status", func(c *gin.Context) {
-			latestBlock := bc.GetLatestBlock()
 			c.JSON(http.StatusOK, gin.H{
-				"height": len(bc.GetBlocks()),
-				"latest_block": latestBlock.Hash,
+				"height": bc.Height() + 1, // Block count, kept for existing clients
+				"latest_block": bc.TipHash(),
+				"mempool_size": bc.MempoolSize(),
 				"peers": len(network.GetPeers()),
 			})
 		})
 
-		api.POST("/transaction", func(c *gin.Context) {
+		api.POST("/transaction", authMiddleware(ScopeSubmitTx), func(c *gin.Context) {
 			var tx blockchain.Transaction
 			if err := c.BindJSON(&tx); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
 				return
 			}
 
 			if err := bc.AddTransaction(&tx); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
 				return
 			}
 
@@ -104,6 +616,32 @@ func main() {
 			c.JSON(http.StatusOK, gin.H{"hash": tx.Hash})
 		})
 
+		// Mempool transactions, and with -txindex any main chain one
+		api.GET("/transaction/:hash", func(c *gin.Context) {
+			hash, err := decodeHash(c.Param("hash"))
+			if err != nil {
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
+				return
+			}
+			tx, loc, err := bc.GetTransaction(hash)
+			if err == blockchain.ErrNoTxIndex {
+				respondError(c, apiError(CodeNotFound, "Transaction not in the mempool; run with -txindex to look up confirmed transactions"))
+				return
+			}
+			if err != nil {
+				respondError(c, apiError(CodeNotFound, "Transaction not found"))
+				return
+			}
+			result := gin.H{"transaction": tx, "confirmations": 0}
+			if loc != nil {
+				result["block_hash"] = loc.BlockHash
+				result["height"] = loc.Height
+				result["position"] = loc.Position
+				result["confirmations"] = bc.Height() - loc.Height + 1
+			}
+			c.JSON(http.StatusOK, result)
+		})
+
 		// Admin panel endpoints
 		api.GET("/stats", func(c *gin.Context) {
 			stats.mu.RLock()
@@ -113,48 +651,80 @@ func main() {
 				"hashrate": stats.TotalHashrate,
 				"activeMiners": stats.ActiveMiners,
 				"difficulty": stats.Difficulty,
-				"totalUsers": len(users),
+				"totalUsers": userCount(),
 			})
 		})
 
-		api.GET("/miners", authMiddleware(), func(c *gin.Context) {
+		api.GET("/miners", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+			registryMu.RLock()
+			defer registryMu.RUnlock()
 			c.JSON(http.StatusOK, activeMiners)
 		})
 
-		api.POST("/miners", authMiddleware(), func(c *gin.Context) {
+		// Per-miner stratum traffic, protocol errors and reconnects, to
+		// spot flaky rigs and abusive clients
+		api.GET("/miners/connections", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+			if pool.stratum == nil {
+				c.JSON(http.StatusOK, map[string]ConnStats{})
+				return
+			}
+			c.JSON(http.StatusOK, pool.stratum.ConnectionStats())
+		})
+
+		api.GET("/miners/:id/stats", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+			stats := pool.GetMinerStats(c.Param("id"))
+			if stats == nil {
+				respondError(c, apiError(CodeNotFound, "No statistics for miner"))
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		})
+
+		api.POST("/miners", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
 			var miner Miner
 			if err := c.BindJSON(&miner); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
 				return
 			}
 			
+			registryMu.Lock()
 			activeMiners = append(activeMiners, &miner)
+			registryMu.Unlock()
 			c.JSON(http.StatusOK, miner)
 		})
 
-		api.GET("/users", authMiddleware(), func(c *gin.Context) {
+		api.GET("/users", authMiddleware(""), func(c *gin.Context) {
+			registryMu.RLock()
+			defer registryMu.RUnlock()
 			c.JSON(http.StatusOK, users)
 		})
 
-		api.POST("/users", authMiddleware(), func(c *gin.Context) {
+		api.POST("/users", authMiddleware(""), func(c *gin.Context) {
 			var user User
 			if err := c.BindJSON(&user); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
 				return
 			}
 			
+			if err := identity.Register(&user); err != nil {
+				respondError(c, apiErrorf(CodeUpstreamError, "Identity verification failed: %v", err))
+				return
+			}
+
+			registryMu.Lock()
 			users = append(users, &user)
+			registryMu.Unlock()
 			c.JSON(http.StatusOK, user)
 		})
 
-		api.GET("/wallets", authMiddleware(), func(c *gin.Context) {
+		api.GET("/wallets", authMiddleware(""), func(c *gin.Context) {
 			c.JSON(http.StatusOK, wallets)
 		})
 
-		api.POST("/wallets", authMiddleware(), func(c *gin.Context) {
+		api.POST("/wallets", authMiddleware(""), func(c *gin.Context) {
 			wallet, err := blockchain.GenerateWallet()
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respondError(c, apiError(CodeInternal, err.Error()))
 				return
 			}
 			
@@ -164,35 +734,150 @@ func main() {
 	}
 
 	// Start HTTP server
-	log.Printf("Starting Alerim node on port %d...", *port)
+	log.Printf("Starting Alerim node on %s...", strings.Join(listeners.Addrs()[ListenerAPI], ", "))
+	apiServer := NewAPIServer(listeners.Listener(ListenerAPI), router, &HTTPServerConfig{
+		ReadTimeout:       *httpReadTimeout,
+		ReadHeaderTimeout: *httpReadHeaderTimeout,
+		WriteTimeout:      *httpWriteTimeout,
+		IdleTimeout:       *httpIdleTimeout,
+		MaxHeaderBytes:    *httpMaxHeaderBytes,
+		MaxConnections:    *httpMaxConns,
+		ACL:               rpcACL,
+		ShutdownTimeout:   *httpShutdownTimeout,
+	})
 	go func() {
-		if err := router.Run(fmt.Sprintf(":%d", *port)); err != nil {
+		if err := apiServer.Serve(); err != nil {
 			log.Fatal(err)
 		}
 	}()
 
+	// Optional Electrum protocol server for light wallets
+	if *electrumPort != 0 {
+		var tlsConfig *tls.Config
+		if *electrumCert != "" {
+			cert, err := tls.LoadX509KeyPair(*electrumCert, *electrumKey)
+			if err != nil {
+				log.Fatalf("Failed to load Electrum TLS certificate: %v", err)
+			}
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		}
+		electrum := NewElectrumServer(bc, network, listeners.Listener(ListenerElectrum), tlsConfig)
+		electrum.Start()
+		log.Printf("Electrum server listening on %s", strings.Join(listeners.Addrs()[ListenerElectrum], ", "))
+	}
+
+	// Start the stratum server and mining coordination
+	if pool.stratum != nil {
+		pool.stratum.Start()
+	}
+	pool.StartMining()
+
 	// Start mining statistics updater
 	go updateMiningStats()
 
-	// Handle shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	atomic.StoreInt32(&ready, 1)
+	log.Printf("%s", status.Banner())
+
+	service.Ready()
+
+	// Run until stopped, reloading the config file on SIGHUP
+	service.Wait(func() error {
+		if *confFile == "" {
+			return errors.New("no -conf file is configured")
+		}
+		if err := applyConfigFile(*confFile, cmdLine, reloadableFlags); err != nil {
+			return err
+		}
+		if err := applyPolicyFlags(bc); err != nil {
+			return err
+		}
+		for _, acl := range []struct {
+			acl         *NetACL
+			allow, deny string
+		}{
+			{rpcACL, *rpcAllowIP, *rpcDenyIP},
+			{stratumACL, *stratumAllowIP, *stratumDenyIP},
+			{p2pACL, *p2pAllowIP, *p2pDenyIP},
+		} {
+			parsed, err := ParseNetACL(acl.allow, acl.deny)
+			if err != nil {
+				return err
+			}
+			acl.acl.Replace(parsed)
+		}
+		log.Printf("Reloaded configuration from %s", *confFile)
+		return nil
+	})
 
 	fmt.Println("\nShutting down...")
+	service.Stopping()
+	atomic.StoreInt32(&ready, 0)
+	if err := apiServer.Shutdown(); err != nil {
+		log.Printf("Error shutting down API server: %v", err)
+	}
+	if err := apiKeys.Flush(); err != nil {
+		log.Printf("Error saving API keys: %v", err)
+	}
+	pool.StopMining()
+	if err := pool.rewards.CloseShareWAL(); err != nil {
+		log.Printf("Error closing share WAL: %v", err)
+	}
 	network.Stop()
+	service.Stopped()
+}
+
+// applyPolicyFlags sets the chain's relay policy from the policy flags
+func applyPolicyFlags(bc *blockchain.Blockchain) error {
+	policy := bc.Policy()
+	policy.MinRelayFeeRate = *minRelayFee
+	policy.DustThreshold = *dustThreshold
+	policy.MaxStandardTxSize = *maxStandardTxSize
+	policy.BlockMaxSize = *blockMaxSize
+	policy.MaxMempoolSize = *maxMempoolSize
+	policy.MaxMempoolTxs = *maxMempoolTxs
+	if err := bc.SetPolicy(policy); err != nil {
+		return fmt.Errorf("invalid relay policy: %v", err)
+	}
+	return nil
 }
 
-func authMiddleware() gin.HandlerFunc {
+// authMiddleware authenticates admin requests by session cookie, or by an
+// API key carrying the given scope. An empty scope restricts the route to
+// admin sessions.
+func authMiddleware(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
+		// Admin panel requests are authenticated by session cookie
+		if _, ok := c.Get("session"); ok {
+			c.Next()
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
 		if token == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "No authorization token provided"})
+			abortWithError(c, apiError(CodeUnauthorized, "No authorization token provided"))
+			return
+		}
+
+		if scope == "" {
+			abortWithError(c, apiError(CodeForbidden, "Admin session required"))
+			return
+		}
+
+		key, err := apiKeys.Authenticate(token)
+		if err == errAPIKeyRateLimit {
+			abortWithError(c, apiError(CodeRateLimited, err.Error()))
+			return
+		} else if err != nil {
+			abortWithError(c, apiError(CodeUnauthorized, err.Error()))
+			return
+		}
+
+		if !key.HasScope(scope) {
+			abortWithError(c, apiErrorf(CodeForbidden, "API key lacks scope %s", scope).WithDetail("scope", scope))
 			return
 		}
 
-		// Validate token here
-		// For now, we'll accept any token
+		c.Set("apikey", key)
 		c.Next()
 	}
 }
@@ -206,7 +891,9 @@ func updateMiningStats() {
 		// Update mining statistics here
 		// This would typically come from your mining pool implementation
 		stats.TotalHashrate = calculateNetworkHashrate()
+		registryMu.RLock()
 		stats.ActiveMiners = len(activeMiners)
+		registryMu.RUnlock()
 		stats.Difficulty.Set(blockchain.GetCurrentDifficulty())
 		stats.mu.Unlock()
 	}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metrics is the node-wide metrics registry exported at /metrics
+var metrics = NewMetricsRegistry()
+
+// MetricsRegistry collects counters and gauges and renders them in the
+// Prometheus text exposition format
+type MetricsRegistry struct {
+	mu       sync.RWMutex
+	counters map[string]float64 // series -> value
+	gauges   map[string]float64 // series -> value
+	help     map[string]string  // metric name -> help text
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		help:     make(map[string]string),
+	}
+}
+
+// Describe sets the help text of a metric
+func (m *MetricsRegistry) Describe(name, help string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.help[name] = help
+}
+
+// Inc increments a counter. Labels are given as key/value pairs.
+func (m *MetricsRegistry) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+// Add adds delta to a counter
+func (m *MetricsRegistry) Add(name string, delta float64, labels ...string) {
+	series := seriesName(name, labels)
+	m.mu.Lock()
+	m.counters[series] += delta
+	m.mu.Unlock()
+}
+
+// Set sets a gauge to value
+func (m *MetricsRegistry) Set(name string, value float64, labels ...string) {
+	series := seriesName(name, labels)
+	m.mu.Lock()
+	m.gauges[series] = value
+	m.mu.Unlock()
+}
+
+// Handler serves the metrics in Prometheus text format
+func (m *MetricsRegistry) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+
+		var b strings.Builder
+		m.writeSeries(&b, m.counters, "counter")
+		m.writeSeries(&b, m.gauges, "gauge")
+		c.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(b.String()))
+	}
+}
+
+// writeSeries renders one kind of metric grouped by name
+func (m *MetricsRegistry) writeSeries(b *strings.Builder, values map[string]float64, kind string) {
+	series := make([]string, 0, len(values))
+	for s := range values {
+		series = append(series, s)
+	}
+	sort.Strings(series)
+
+	lastName := ""
+	for _, s := range series {
+		name := s
+		if i := strings.IndexByte(s, '{'); i >= 0 {
+			name = s[:i]
+		}
+		if name != lastName {
+			if help, ok := m.help[name]; ok {
+				fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+			}
+			fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+			lastName = name
+		}
+		fmt.Fprintf(b, "%s %g\n", s, values[s])
+	}
+}
+
+// seriesName formats a metric name with its labels
+func seriesName(name string, labels []string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
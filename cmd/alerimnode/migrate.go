@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// schemaFile records the schema version of a data directory
+const schemaFile = "schema.json"
+
+// Migration upgrades a data directory from the previous schema version to
+// Version. Migrations must leave the directory loadable by the new code
+// and may assume every earlier migration has run.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(d *DataDir) error
+}
+
+// migrations lists every schema change in order. Append a migration
+// whenever a persistent store changes incompatibly; never edit or remove
+// one that has shipped.
+var migrations = []Migration{
+	{
+		// Data directories from before schema versioning need no changes
+		Version:     1,
+		Description: "Record the schema version",
+		Migrate:     func(*DataDir) error { return nil },
+	},
+	{
+		Version:     2,
+		Description: "Store pool balances in base units instead of 1e-18 AIM",
+		Migrate:     migrateAmountUnits,
+	},
+}
+
+// ErrMigrationRequired is returned by Migrate when the data directory is
+// outdated and migrations are disabled
+var ErrMigrationRequired = errors.New("data directory needs migration")
+
+// schemaState is the content of the schema file
+type schemaState struct {
+	Version  int       `json:"version"`
+	Migrated time.Time `json:"migrated"`
+}
+
+// latestSchemaVersion returns the schema version the code expects
+func latestSchemaVersion(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the schema version of the data directory. A
+// directory without a schema file predates versioning and is version 0.
+func (d *DataDir) SchemaVersion() (int, error) {
+	var state schemaState
+	if err := loadJSONFile(filepath.Join(d.Root, schemaFile), &state); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return state.Version, nil
+}
+
+// setSchemaVersion records the schema version of the data directory
+func (d *DataDir) setSchemaVersion(version int) error {
+	return saveJSONFile(filepath.Join(d.Root, schemaFile), schemaState{Version: version, Migrated: time.Now().UTC()})
+}
+
+// stateFiles returns the JSON stores of the data directory
+func (d *DataDir) stateFiles() []string {
+	var files []string
+	for _, dir := range []string{d.Root, d.Pool()} {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, file := range matches {
+			if filepath.Base(file) != schemaFile {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// Migrate brings the data directory to the latest schema version. A new,
+// empty directory is stamped with the latest version. Stores are backed
+// up before the first migration runs and the version is recorded after
+// each one, so an interrupted upgrade resumes where it stopped. With apply
+// false, an outdated directory fails with ErrMigrationRequired instead.
+func (d *DataDir) Migrate(migrations []Migration, apply bool) error {
+	latest := latestSchemaVersion(migrations)
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("data directory schema version %d is newer than this node supports (%d); upgrade the node", version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+
+	files := d.stateFiles()
+	if version == 0 && len(files) == 0 {
+		return d.setSchemaVersion(latest)
+	}
+	if !apply {
+		return fmt.Errorf("%w: schema version %d, node expects %d", ErrMigrationRequired, version, latest)
+	}
+
+	backup := filepath.Join(d.Root, "backups", fmt.Sprintf("schema-%d-%s", version, time.Now().UTC().Format("20060102T150405")))
+	if err := backupFiles(files, d.Root, backup); err != nil {
+		return fmt.Errorf("failed to back up stores before migration: %v", err)
+	}
+	log.Printf("Backed up data directory stores to %s", backup)
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		log.Printf("Migrating data directory to schema version %d: %s", m.Version, m.Description)
+		if err := m.Migrate(d); err != nil {
+			return fmt.Errorf("migration to schema version %d failed: %v", m.Version, err)
+		}
+		if err := d.setSchemaVersion(m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupFiles copies files under root into dir, keeping their relative
+// paths
+func backupFiles(files []string, root, dir string) error {
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		if err := copyFile(file, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// legacyUnitsPerBaseUnit is how many of the 1e-18 AIM units pool balances
+// were kept in before schema version 2 make up one base unit
+var legacyUnitsPerBaseUnit = big.NewInt(1e10)
+
+// migrateAmountUnits rescales the amounts of the reward state, payout and
+// conversion history to base units. Fractions of a base unit, which could
+// never be paid out, are dropped.
+func migrateAmountUnits(d *DataDir) error {
+	rescale := func(v interface{}) (interface{}, error) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return v, nil
+		}
+		amount, ok := new(big.Int).SetString(n.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid amount %s", n)
+		}
+		return json.Number(amount.Quo(amount, legacyUnitsPerBaseUnit).String()), nil
+	}
+	rescaleMap := func(v interface{}) error {
+		m, _ := v.(map[string]interface{})
+		for key, value := range m {
+			scaled, err := rescale(value)
+			if err != nil {
+				return err
+			}
+			m[key] = scaled
+		}
+		return nil
+	}
+	rescaleField := func(v interface{}, field string) error {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		scaled, err := rescale(m[field])
+		if err != nil {
+			return err
+		}
+		if scaled != nil {
+			m[field] = scaled
+		}
+		return nil
+	}
+
+	return rewriteJSONFiles(map[string]func(v interface{}) error{
+		filepath.Join(d.Pool(), "rewards.json"): func(v interface{}) error {
+			state, _ := v.(map[string]interface{})
+			if err := rescaleMap(state["balances"]); err != nil {
+				return err
+			}
+			rounds, _ := state["rounds"].([]interface{})
+			for _, round := range rounds {
+				if err := rescaleField(round, "pool_fee"); err != nil {
+					return err
+				}
+				if r, ok := round.(map[string]interface{}); ok {
+					if err := rescaleMap(r["credits"]); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		filepath.Join(d.Pool(), "payouts.json"): func(v interface{}) error {
+			records, _ := v.([]interface{})
+			for _, record := range records {
+				if err := rescaleField(record, "amount"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		filepath.Join(d.Pool(), "conversions.json"): func(v interface{}) error {
+			records, _ := v.([]interface{})
+			for _, record := range records {
+				if err := rescaleField(record, "amount"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// rewriteJSONFiles applies a transformation to the decoded content of each
+// existing file and saves the result. Numbers are kept as json.Number.
+func rewriteJSONFiles(files map[string]func(v interface{}) error) error {
+	for path, transform := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := transform(v); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := saveJSONFile(path, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
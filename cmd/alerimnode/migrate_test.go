@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	var ran []int
+	steps := []Migration{
+		{Version: 1, Migrate: func(*DataDir) error { ran = append(ran, 1); return nil }},
+		{Version: 2, Migrate: func(*DataDir) error { ran = append(ran, 2); return nil }},
+	}
+
+	d := &DataDir{Root: t.TempDir()}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new data directory is stamped without running migrations
+	if err := d.Migrate(steps, true); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := d.SchemaVersion(); version != 2 || len(ran) != 0 {
+		t.Fatalf("new dir: version %d, ran %v", version, ran)
+	}
+
+	// An existing store at version 1 runs only the later migration
+	if err := d.setSchemaVersion(1); err != nil {
+		t.Fatal(err)
+	}
+	store := filepath.Join(d.Pool(), "rewards.json")
+	if err := os.WriteFile(store, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate(steps, false); !errors.Is(err, ErrMigrationRequired) {
+		t.Fatalf("Migrate without apply = %v, want ErrMigrationRequired", err)
+	}
+	if err := d.Migrate(steps, true); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := d.SchemaVersion(); version != 2 || len(ran) != 1 || ran[0] != 2 {
+		t.Fatalf("after migration: version %d, ran %v", version, ran)
+	}
+	backups, _ := filepath.Glob(filepath.Join(d.Root, "backups", "schema-1-*", "pool", "rewards.json"))
+	if len(backups) != 1 {
+		t.Errorf("stores not backed up before migrating")
+	}
+
+	// A failed migration keeps the version it reached
+	if err := d.setSchemaVersion(0); err != nil {
+		t.Fatal(err)
+	}
+	steps[1].Migrate = func(*DataDir) error { return errors.New("boom") }
+	if err := d.Migrate(steps, true); err == nil {
+		t.Fatal("failed migration not reported")
+	}
+	if version, _ := d.SchemaVersion(); version != 1 {
+		t.Errorf("version after failed migration = %d, want 1", version)
+	}
+
+	// Newer data directories are refused
+	if err := d.setSchemaVersion(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate(steps, true); err == nil {
+		t.Error("newer schema accepted")
+	}
+}
+
+func TestMigrateAmountUnits(t *testing.T) {
+	d := &DataDir{Root: t.TempDir()}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"rewards.json":     `{"rounds":[{"height":5,"credits":{"m1":150000000000000000000},"pool_fee":20000000000}],"balances":{"m1":150000000012345678901,"m2":-30000000000}}`,
+		"payouts.json":     `[{"miner_id":"m1","amount":100000000000000000000}]`,
+		"conversions.json": `[{"miner_id":"m1","amount":5000000000000000}]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(d.Pool(), name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateAmountUnits(d); err != nil {
+		t.Fatal(err)
+	}
+
+	var state rewardState
+	if err := loadJSONFile(filepath.Join(d.Pool(), "rewards.json"), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances["m1"] != 15000000001 || state.Balances["m2"] != -3 {
+		t.Errorf("balances = %v", state.Balances)
+	}
+	if len(state.Rounds) != 1 || state.Rounds[0].Credits["m1"] != 15000000000 || state.Rounds[0].PoolFee != 2 {
+		t.Errorf("rounds = %+v", state.Rounds[0])
+	}
+
+	var payouts []*PayoutRecord
+	if err := loadJSONFile(filepath.Join(d.Pool(), "payouts.json"), &payouts); err != nil {
+		t.Fatal(err)
+	}
+	if payouts[0].Amount != 10000000000 || payouts[0].MinerID != "m1" {
+		t.Errorf("payout = %+v", payouts[0])
+	}
+
+	var conversions []*ConversionRecord
+	if err := loadJSONFile(filepath.Join(d.Pool(), "conversions.json"), &conversions); err != nil {
+		t.Fatal(err)
+	}
+	if conversions[0].Amount != 500000 {
+		t.Errorf("conversion = %+v", conversions[0])
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// minerTokenPrefix tells miner tokens apart from API keys
+const minerTokenPrefix = "mtk_"
+
+// minerTokenMessage is signed with the payout address key to claim a token
+const minerTokenMessage = "Alerim miner token: "
+
+var (
+	errInvalidMinerToken = errors.New("invalid miner token")
+	errAddressMismatch   = errors.New("public key does not match the miner's payout address")
+)
+
+// MinerTokenIssuer derives read-only access tokens for miners. A token is
+// the miner ID with an HMAC over it, so tokens need no storage and the
+// same token is shown every time; rotating the key revokes all of them.
+type MinerTokenIssuer struct {
+	key []byte
+}
+
+// NewMinerTokenIssuer creates an issuer signing with key
+func NewMinerTokenIssuer(key []byte) *MinerTokenIssuer {
+	return &MinerTokenIssuer{key: key}
+}
+
+// mac returns the token MAC of a miner ID
+func (t *MinerTokenIssuer) mac(minerID string) []byte {
+	h := hmac.New(sha256.New, t.key)
+	h.Write([]byte(minerTokenPrefix + minerID))
+	return h.Sum(nil)
+}
+
+// Issue returns the token of a miner
+func (t *MinerTokenIssuer) Issue(minerID string) string {
+	return minerTokenPrefix +
+		base64.RawURLEncoding.EncodeToString([]byte(minerID)) + "." +
+		base64.RawURLEncoding.EncodeToString(t.mac(minerID))
+}
+
+// Verify returns the miner ID a token was issued for
+func (t *MinerTokenIssuer) Verify(token string) (string, error) {
+	encodedID, encodedMAC, ok := strings.Cut(strings.TrimPrefix(token, minerTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, minerTokenPrefix) {
+		return "", errInvalidMinerToken
+	}
+	id, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", errInvalidMinerToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, t.mac(string(id))) {
+		return "", errInvalidMinerToken
+	}
+	return string(id), nil
+}
+
+// verifyAddressSignature checks a signature of the token claim message for
+// minerID by the key of a payout address. Addresses that are not a
+// hex-encoded public key can't sign, so their tokens come from the
+// dashboard only. Without a public key, the signature must be a compact
+// message signature, from which the key is recovered.
+func verifyAddressSignature(address, minerID, pubKeyHex, signatureHex string) error {
+	if pubKeyHex == "" {
+		return verifyCompactAddressSignature(address, minerTokenMessage+minerID, signatureHex)
+	}
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return errors.New("invalid public key")
+	}
+	if !strings.EqualFold(address, hex.EncodeToString(pubKey)) {
+		return errAddressMismatch
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubKey)
+	if x == nil {
+		return errors.New("invalid public key")
+	}
+
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil || len(signature) != 64 {
+		return errors.New("invalid signature")
+	}
+	digest := sha256.Sum256([]byte(minerTokenMessage + minerID))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// verifyCompactAddressSignature checks a compact signature of message
+// recovers the key of a payout address
+func verifyCompactAddressSignature(address, message, signatureHex string) error {
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	key, err := blockchain.RecoverMessageKey(message, signature)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(address, hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))) {
+		return errAddressMismatch
+	}
+	return nil
+}
+
+// minerAuth allows admin sessions, API keys with the read-stats scope and
+// the miner's own token
+func (t *MinerTokenIssuer) minerAuth() gin.HandlerFunc {
+	readStats := authMiddleware(ScopeReadStats)
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if _, ok := c.Get("session"); ok || !strings.HasPrefix(token, minerTokenPrefix) {
+			readStats(c)
+			return
+		}
+
+		minerID, err := t.Verify(token)
+		if err != nil {
+			abortWithError(c, apiError(CodeUnauthorized, err.Error()))
+			return
+		}
+		if minerID != c.Param("id") {
+			abortWithError(c, apiError(CodeForbidden, "Token is for another miner"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// findMiner returns a copy of the registered miner with the given ID, or
+// nil if there is none
+func findMiner(id string) *Miner {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, miner := range activeMiners {
+		if miner.ID == id {
+			m := *miner
+			return &m
+		}
+	}
+	return nil
+}
+
+// minerWorkers returns copies of the miners paying to a payout address
+func minerWorkers(address string) []*Miner {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	workers := make([]*Miner, 0)
+	for _, miner := range activeMiners {
+		if miner.Address == address {
+			m := *miner
+			workers = append(workers, &m)
+		}
+	}
+	return workers
+}
+
+// MinerEarnings returns a miner's balance, the part of it not yet matured
+// and its payout history
+func (rm *RewardManager) MinerEarnings(minerID string) gin.H {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	payouts := make([]*PayoutRecord, 0)
+	for _, payout := range rm.payouts {
+		if payout.MinerID == minerID {
+			payouts = append(payouts, payout)
+		}
+	}
+	return gin.H{
+		"balance":  rm.balances[minerID],
+		"immature": rm.immatureCredit(minerID),
+		"payouts":  payouts,
+	}
+}
+
+// registerMinerRoutes adds the per-miner read-only endpoints and token
+// issuance
+func registerMinerRoutes(api *gin.RouterGroup, pool *MiningPool, tokens *MinerTokenIssuer) {
+	// Operators hand tokens out from the dashboard
+	api.POST("/miners/:id/token", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		miner := findMiner(c.Param("id"))
+		if miner == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		if !authorizeUser(c, miner.UserID) {
+			respondError(c, apiError(CodeForbidden, "Not allowed to manage this miner"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": tokens.Issue(miner.ID)})
+	})
+
+	// Miners claim their own token by signing with the payout address key
+	api.POST("/miner/:id/token", func(c *gin.Context) {
+		var req struct {
+			PublicKey string `json:"public_key"`
+			Signature string `json:"signature"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		miner := findMiner(c.Param("id"))
+		if miner == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		if err := verifyAddressSignature(miner.Address, miner.ID, req.PublicKey, req.Signature); err != nil {
+			respondError(c, apiError(CodeUnauthorized, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": tokens.Issue(miner.ID)})
+	})
+
+	miner := api.Group("/miner/:id", tokens.minerAuth())
+	miner.GET("/stats", func(c *gin.Context) {
+		m := findMiner(c.Param("id"))
+		if m == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"miner":  m,
+			"shares": pool.GetMinerStats(m.ID),
+		})
+	})
+
+	miner.GET("/earnings", func(c *gin.Context) {
+		if findMiner(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		earnings := pool.rewards.MinerEarnings(c.Param("id"))
+		earnings["conversions"] = pool.rewards.GetConversions(c.Param("id"))
+		c.JSON(http.StatusOK, earnings)
+	})
+
+	miner.GET("/chart", func(c *gin.Context) {
+		if findMiner(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"interval": int(shareChartInterval.Seconds()),
+			"points":   pool.MinerChart(c.Param("id"), time.Now()),
+		})
+	})
+
+	miner.GET("/workers", func(c *gin.Context) {
+		m := findMiner(c.Param("id"))
+		if m == nil {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		c.JSON(http.StatusOK, minerWorkers(m.Address))
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestMinerTokenRoundTrip(t *testing.T) {
+	issuer := NewMinerTokenIssuer([]byte("key"))
+	token := issuer.Issue("rig.01")
+	if !strings.HasPrefix(token, minerTokenPrefix) {
+		t.Fatalf("token %q lacks prefix", token)
+	}
+	if issuer.Issue("rig.01") != token {
+		t.Error("tokens are not deterministic")
+	}
+
+	id, err := issuer.Verify(token)
+	if err != nil || id != "rig.01" {
+		t.Fatalf("Verify = %q, %v", id, err)
+	}
+
+	other := NewMinerTokenIssuer([]byte("other"))
+	forged := issuer.Issue("rig.02")
+	tests := []string{
+		"",
+		"aim_" + strings.TrimPrefix(token, minerTokenPrefix),
+		strings.TrimPrefix(token, minerTokenPrefix),
+		token[:len(token)-2],
+		other.Issue("rig.01"),
+		strings.SplitN(token, ".", 2)[0] + "." + strings.SplitN(forged, ".", 2)[1],
+	}
+	for _, bad := range tests {
+		if _, err := issuer.Verify(bad); err == nil {
+			t.Errorf("Verify(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestVerifyAddressSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubHex := hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+
+	sign := func(message string) string {
+		digest := sha256.Sum256([]byte(message))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return hex.EncodeToString(sig)
+	}
+	valid := sign(minerTokenMessage + "rig")
+
+	tests := []struct {
+		name      string
+		address   string
+		signature string
+		wantErr   bool
+	}{
+		{"valid", pubHex, valid, false},
+		{"address case", strings.ToUpper(pubHex), valid, false},
+		{"other address", "addr1", valid, true},
+		{"other miner", pubHex, sign(minerTokenMessage + "other"), true},
+		{"malformed signature", pubHex, "abcd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyAddressSignature(tt.address, "rig", pubHex, tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCompactAddressSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	sign := func(message string) string {
+		sig, err := blockchain.SignMessage(key, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hex.EncodeToString(sig)
+	}
+	valid := sign(minerTokenMessage + "rig")
+
+	tests := []struct {
+		name      string
+		address   string
+		signature string
+		wantErr   bool
+	}{
+		{"valid", address, valid, false},
+		{"address case", strings.ToUpper(address), valid, false},
+		{"other address", "addr1", valid, true},
+		{"other miner", address, sign(minerTokenMessage + "other"), true},
+		{"raw signature", address, valid[2:], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyAddressSignature(tt.address, "rig", "", tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
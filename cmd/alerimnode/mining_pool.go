@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"math"
+	"net"
 	"sync"
 	"time"
 
@@ -11,34 +14,87 @@ import (
 type MiningPool struct {
 	mu            sync.RWMutex
 	miners        map[string]*Miner
-	currentBlock  *blockchain.Block
+	job           *miningJob // Nil until the first template
 	blockchain    *blockchain.Blockchain
 	difficulty    *big.Int
 	totalHashrate float64
 	rewards       *RewardManager
 	stratum       *StratumServer
-	workerDiffs   map[string]*big.Int // Worker-specific difficulties
-	vardiff       *VarDiffManager     // Add vardiff manager
+	state         PoolState                    // Active jobs, submitted shares and worker difficulties
+	shareTargets  map[string]workerShareTarget // Cached share targets of workers' difficulties
+	vardiff       *VarDiffManager              // Add vardiff manager
+	minerStats    map[string]*MinerStats
+	diffClasses   []DiffClass // Starting difficulties of new workers, never modified
+
+	shareLog  *ShareLog           // Nil when disabled
+	anomalies *AnomalyDetector    // Nil when disabled
+	network   *blockchain.Network // Relays found blocks; nil when not networked
+
+	// Signalled when the chain tip moves; holds at most one pending signal
+	// so a burst of blocks causes a single template refresh
+	tipChanged chan struct{}
+}
+
+// miningJob is the work handed to stratum clients. Its block is a private
+// clone of the template that is never modified once the job is created, so
+// clients may read it without holding p.mu while SubmitShare and template
+// refreshes run concurrently.
+type miningJob struct {
+	id     string
+	block  *blockchain.Block
+	target blockchain.HashTarget // The block's network target
+	clean  bool                  // First job on a new tip; older jobs are void
+}
+
+// PoolConfig holds the mining pool's listener settings
+type PoolConfig struct {
+	StratumListener net.Listener // Nil to run without a stratum server
+	StratumACL      *NetACL
+	DataDir         string // Directory for persistent pool state
+	ShareLog        *ShareLog
+	Anomalies       *AnomalyDetector
+	State           PoolState           // Nil to keep the pool's hot state in memory
+	Network         *blockchain.Network // Relays found blocks, if set
+	DiffClasses     []DiffClass         // Starting difficulties of new workers, nil for the defaults
+}
+
+// workerShareTarget is a worker's share target and the difficulty it was
+// computed from
+type workerShareTarget struct {
+	difficulty *big.Int
+	target     *blockchain.HashTarget
 }
 
 // NewMiningPool creates a new mining pool instance
-func NewMiningPool(bc *blockchain.Blockchain) *MiningPool {
+func NewMiningPool(bc *blockchain.Blockchain, config *PoolConfig) *MiningPool {
 	pool := &MiningPool{
-		miners:      make(map[string]*Miner),
-		blockchain:  bc,
-		difficulty:  new(big.Int).Set(blockchain.InitialDifficulty),
-		workerDiffs: make(map[string]*big.Int),
+		miners:       make(map[string]*Miner),
+		blockchain:   bc,
+		difficulty:   bc.InitialDifficulty(),
+		state:        config.State,
+		shareTargets: make(map[string]workerShareTarget),
+		minerStats:   make(map[string]*MinerStats),
+		shareLog:     config.ShareLog,
+		anomalies:    config.Anomalies,
+		network:      config.Network,
+		diffClasses:  config.DiffClasses,
+		tipChanged:   make(chan struct{}, 1),
+	}
+	if pool.state == nil {
+		pool.state = newMemoryPoolState()
+	}
+	if pool.diffClasses == nil {
+		pool.diffClasses = defaultDiffClasses()
 	}
 
-	// Initialize reward manager
-	pool.rewards = NewRewardManager(bc)
+	// Initialize reward manager and keep its rounds in sync with the chain
+	pool.rewards = NewRewardManager(bc, config.DataDir)
+	bc.Subscribe(pool.rewards.HandleChainNotification)
+	bc.Subscribe(pool.handleTipChange)
 
-	// Initialize stratum server on port 3333
-	stratum, err := NewStratumServer(pool, pool.rewards, 3333)
-	if err != nil {
-		log.Printf("Failed to initialize stratum server: %v", err)
-	} else {
-		pool.stratum = stratum
+	// Initialize stratum server
+	if config.StratumListener != nil {
+		pool.stratum = NewStratumServer(pool, pool.rewards, config.StratumListener, config.StratumACL)
 	}
 
 	// Initialize vardiff manager
@@ -64,6 +120,37 @@ func (p *MiningPool) RemoveMiner(minerID string) {
 	delete(p.miners, minerID)
 }
 
+// ForgetMiner removes every trace of a miner from the pool's live state:
+// its worker entry, difficulty and vardiff state, anomaly flags, and any
+// stratum session
+func (p *MiningPool) ForgetMiner(minerID string) {
+	p.mu.Lock()
+	delete(p.miners, minerID)
+	delete(p.shareTargets, minerID)
+	delete(p.minerStats, minerID)
+	p.mu.Unlock()
+	if err := p.state.ForgetWorker(minerID); err != nil {
+		log.Printf("Error forgetting worker %s: %v", minerID, err)
+	}
+
+	p.vardiff.Forget(minerID)
+	if p.anomalies != nil {
+		p.anomalies.Clear(minerID)
+	}
+
+	if p.stratum != nil {
+		p.stratum.mu.Lock()
+		client, exists := p.stratum.clients[minerID]
+		delete(p.stratum.clients, minerID)
+		p.stratum.mu.Unlock()
+		p.stratum.conns.forget(minerID)
+		p.stratum.sessions.forget(minerID)
+		if exists {
+			client.conn.Close()
+		}
+	}
+}
+
 // UpdateMinerStats updates a miner's statistics
 func (p *MiningPool) UpdateMinerStats(minerID string, hashrate float64, shares int64) {
 	p.mu.Lock()
@@ -161,56 +248,22 @@ func (p *MiningPool) UpdateDifficulty() {
 	newDifficulty, _ = difficultyFloat.Int(nil)
 
 	// Ensure difficulty doesn't go below initial difficulty
-	if newDifficulty.Cmp(blockchain.InitialDifficulty) < 0 {
-		newDifficulty.Set(blockchain.InitialDifficulty)
+	if initial := p.blockchain.InitialDifficulty(); newDifficulty.Cmp(initial) < 0 {
+		newDifficulty.Set(initial)
 	}
 
 	p.difficulty.Set(newDifficulty)
+	p.shareTargets = make(map[string]workerShareTarget)
 }
 
-// UpdateWorkerDifficulty adjusts a worker's difficulty based on share rate
-func (p *MiningPool) UpdateWorkerDifficulty(minerID string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	miner, exists := p.miners[minerID]
-	if !exists {
-		return
-	}
-
-	// Target share time in seconds
-	const targetShareTime = 10
-	// Maximum difficulty adjustment factor
-	const maxAdjustment = 2.0
-
-	// Calculate time since last share
-	timeSinceLastShare := time.Since(miner.LastSeen).Seconds()
-	if timeSinceLastShare == 0 {
+// setWorkerDifficulty sets a worker's share difficulty and notifies its
+// stratum client; the caller must hold p.mu
+func (p *MiningPool) setWorkerDifficulty(minerID string, newDiff *big.Int) {
+	if err := p.state.SetDifficulty(minerID, newDiff); err != nil {
+		log.Printf("Error saving difficulty of %s: %v", minerID, err)
 		return
 	}
-
-	// Calculate adjustment factor
-	adjustment := targetShareTime / timeSinceLastShare
-	if adjustment > maxAdjustment {
-		adjustment = maxAdjustment
-	} else if adjustment < 1/maxAdjustment {
-		adjustment = 1 / maxAdjustment
-	}
-
-	// Get current worker difficulty
-	currentDiff := p.workerDiffs[minerID]
-	if currentDiff == nil {
-		currentDiff = new(big.Int).Set(p.difficulty)
-		p.workerDiffs[minerID] = currentDiff
-	}
-
-	// Apply adjustment
-	adjustmentBig := new(big.Float).SetFloat64(adjustment)
-	difficultyFloat := new(big.Float).SetInt(currentDiff)
-	difficultyFloat.Mul(difficultyFloat, adjustmentBig)
-	
-	newDiff, _ := difficultyFloat.Int(nil)
-	p.workerDiffs[minerID] = newDiff
+	delete(p.shareTargets, minerID)
 
 	// Notify stratum client of difficulty change
 	if p.stratum != nil {
@@ -225,90 +278,278 @@ func (p *MiningPool) UpdateWorkerDifficulty(minerID string) {
 	}
 }
 
-// SubmitShare processes a share submission from a miner
-func (p *MiningPool) SubmitShare(minerID string, nonce uint64, hash []byte) error {
+// SubmitShare processes a share submission from a miner. Rejections are
+// returned as a *ShareError. Every submission is recorded in the share log.
+func (p *MiningPool) SubmitShare(minerID, jobID string, nonce uint64, hash []byte) (err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Record share for vardiff adjustment
-	p.vardiff.RecordShare(minerID)
+	var minerDiff *big.Int
+	if p.shareLog != nil {
+		defer func() {
+			p.shareLog.LogShare(minerID, jobID, nonce, hash, minerDiff, err, time.Now())
+		}()
+	}
 
-	// Get miner's specific difficulty
-	minerDiff := p.workerDiffs[minerID]
-	if minerDiff == nil {
-		minerDiff = p.difficulty
+	miner, exists := p.miners[minerID]
+	if !exists {
+		return rejectShare(RejectUnauthorized, "miner not found: %s", minerID)
+	}
+	job := p.activeJob(jobID)
+	if job == nil {
+		return rejectShare(RejectStale, "job %s is stale", jobID)
+	}
+	if nonce > math.MaxUint32 {
+		return rejectShare(RejectMalformed, "nonce %x out of range", nonce)
 	}
 
-	// Verify the share meets the worker's difficulty
-	if !blockchain.MeetsDifficulty(hash, minerDiff) {
-		return fmt.Errorf("share difficulty too low")
+	// The hash must be that of the job's header with the nonce
+	candidate := *job.block
+	candidate.Nonce = uint32(nonce)
+	if computed := candidate.CalculateHash(); !bytes.Equal(computed[:], hash) {
+		return rejectShare(RejectBadHash, "hash does not match job %s and nonce %x", jobID, nonce)
 	}
 
-	// Update miner statistics
-	miner, exists := p.miners[minerID]
-	if !exists {
-		return fmt.Errorf("miner not found: %s", minerID)
+	// Verify the share meets the worker's difficulty
+	var target *blockchain.HashTarget
+	minerDiff, target = p.shareTarget(minerID)
+	if !target.Met(hash) {
+		return rejectShare(RejectLowDifficulty, "share difficulty too low")
+	}
+	if fresh, err := p.state.MarkShare(jobID, hash); err != nil {
+		return fmt.Errorf("failed to record share: %v", err)
+	} else if !fresh {
+		return rejectShare(RejectDuplicate, "duplicate share")
 	}
 
+	// Record share for vardiff adjustment
+	p.vardiff.RecordShare(minerID, minerDiff)
+	p.statsFor(minerID).AddShare(minerDiff, blockchain.HashDifficulty(hash), true)
+
 	miner.TotalShares++
 	miner.LastSeen = time.Now()
 
 	// Add share for reward calculation
-	p.rewards.AddShare(minerID)
+	p.rewards.AddShare(minerID, minerDiff)
+
+	// Watch the worker's share stream; flagged workers may get a higher
+	// difficulty, so they can't keep flooding shares
+	if p.anomalies != nil {
+		work, _ := new(big.Float).SetInt(minerDiff).Float64()
+		found := p.anomalies.Observe(minerID, work, uint32(nonce), time.Now())
+		if len(found) > 0 && p.anomalies.RaisesDifficulty() {
+			raised := new(big.Int).Mul(minerDiff, big.NewInt(anomalyDifficultyFactor))
+			p.setWorkerDifficulty(minerID, raised)
+			p.statsFor(minerID).RecordDifficultyChange(raised, "anomaly")
+		}
+	}
 
 	// If share meets network difficulty, submit to blockchain
-	networkDifficulty := p.blockchain.GetCurrentDifficulty()
-	if blockchain.MeetsDifficulty(hash, networkDifficulty) {
-		block := p.currentBlock.Clone()
-		block.Nonce = nonce
-		block.Hash = hash
+	if job.target.Met(hash) {
+		block := job.block.Clone()
+		block.Nonce = uint32(nonce)
+		copy(block.Hash[:], hash)
 
-		if err := p.blockchain.AddBlock(block); err != nil {
+		if err := p.blockchain.ProcessBlock(block); err != nil {
 			return fmt.Errorf("failed to add block: %v", err)
 		}
 
+		// Get the block out before anything else, so it reaches the network
+		// ahead of competing blocks
+		if p.network != nil {
+			p.network.RelayBlock(block)
+		}
+
 		// Process block reward
-		p.rewards.ProcessBlockReward(block)
+		p.rewards.ProcessBlockReward(block, minerID)
+		p.statsFor(minerID).AddBlock()
 
-		// Create new block template for mining
+		// Create new block template for mining and hand it out
 		p.createNewBlockTemplate()
-
-		// Notify all stratum clients of new work
-		if p.stratum != nil {
-			p.stratum.mu.RLock()
-			for _, client := range p.stratum.clients {
-				client.sendWork()
-			}
-			p.stratum.mu.RUnlock()
-		}
+		p.broadcastWork()
 	}
 
-	// Update worker difficulty based on share time
-	go p.UpdateWorkerDifficulty(minerID)
-
 	return nil
 }
 
-// createNewBlockTemplate creates a new block for miners to work on
+// createNewBlockTemplate creates a new block for miners to work on. The
+// template has passed consensus validation; if none can be built miners
+// keep working on the previous one. A template identical to the current
+// one keeps its job, so shares already submitted stay duplicates.
 func (p *MiningPool) createNewBlockTemplate() {
-	transactions := p.blockchain.GetPendingTransactions()
-	previousBlock := p.blockchain.GetLatestBlock()
-
-	p.currentBlock = &blockchain.Block{
-		Version:        1,
-		PreviousHash:  previousBlock.Hash,
-		Timestamp:     time.Now(),
-		Transactions:  transactions,
-		MerkleRoot:    blockchain.CalculateMerkleRoot(transactions),
-		Difficulty:    p.difficulty,
-		Nonce:        0,
+	block, err := p.blockchain.NewBlockTemplate(p.rewards.CoinbaseScript())
+	if err != nil {
+		log.Printf("Failed to create block template: %v", err)
+		return
+	}
+	id := templateJobID(block)
+	if p.job != nil && p.job.id == id {
+		return
+	}
+
+	p.job = &miningJob{
+		id:     id,
+		block:  block.Clone(),
+		target: blockchain.NewHashTarget(block.Target()),
+		clean:  p.job == nil || p.job.block.PrevHash != block.PrevHash,
+	}
+	if err := p.state.PublishJob(p.job); err != nil {
+		log.Printf("Error publishing job %s: %v", id, err)
+	}
+	if p.shareLog != nil {
+		p.shareLog.LogJob(p.job, time.Now())
+	}
+}
+
+// shareTarget returns a worker's share difficulty, the pool's unless it
+// has its own, with its target, computed once per difficulty change; the
+// caller must hold p.mu for writing
+func (p *MiningPool) shareTarget(minerID string) (*big.Int, *blockchain.HashTarget) {
+	difficulty, err := p.state.Difficulty(minerID)
+	if err != nil {
+		log.Printf("Error loading difficulty of %s: %v", minerID, err)
+	}
+	if difficulty == nil {
+		difficulty = p.difficulty
+	}
+	cached, ok := p.shareTargets[minerID]
+	if !ok || cached.difficulty.Cmp(difficulty) != 0 {
+		t := blockchain.DifficultyHashTarget(difficulty)
+		cached = workerShareTarget{difficulty: difficulty, target: &t}
+		p.shareTargets[minerID] = cached
+	}
+	return difficulty, cached.target
+}
+
+// activeJob returns the job a share was submitted for: the current job,
+// or one another pool instance published on the same tip. It returns nil
+// for a stale job; the caller must hold p.mu.
+func (p *MiningPool) activeJob(jobID string) *miningJob {
+	if p.job == nil {
+		return nil
+	}
+	if jobID == p.job.id {
+		return p.job
+	}
+	job, err := p.state.Job(jobID)
+	if err != nil {
+		log.Printf("Error loading job %s: %v", jobID, err)
+		return nil
+	}
+	if job == nil || job.block.PrevHash != p.job.block.PrevHash {
+		return nil
+	}
+	return job
+}
+
+// statsFor returns a miner's statistics, creating them on first use; the
+// caller must hold p.mu
+func (p *MiningPool) statsFor(minerID string) *MinerStats {
+	ms, ok := p.minerStats[minerID]
+	if !ok {
+		ms = NewMinerStats()
+		p.minerStats[minerID] = ms
+	}
+	return ms
+}
+
+// RecordReject counts a rejected share in the metrics and, for a known
+// miner, in its statistics
+func (p *MiningPool) RecordReject(minerID string, reason RejectReason) {
+	metrics.Inc("alerim_shares_rejected_total", "reason", string(reason))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.miners[minerID]; exists {
+		p.statsFor(minerID).AddReject(reason)
+	}
+}
+
+// GetMinerStats returns a miner's statistics, or nil if it has none
+func (p *MiningPool) GetMinerStats(minerID string) map[string]interface{} {
+	p.mu.RLock()
+	ms, ok := p.minerStats[minerID]
+	p.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return ms.GetStats()
+}
+
+// MinerChart returns a miner's share chart for the window ending at now;
+// miners without statistics get an empty chart
+func (p *MiningPool) MinerChart(minerID string, now time.Time) []ShareBucket {
+	p.mu.RLock()
+	ms, ok := p.minerStats[minerID]
+	p.mu.RUnlock()
+	if !ok {
+		ms = NewMinerStats()
+	}
+	return ms.Chart(now)
+}
+
+// minerSummary returns a miner's 24h average hashrate and blocks found
+func (p *MiningPool) minerSummary(minerID string) (float64, int64) {
+	p.mu.RLock()
+	ms, ok := p.minerStats[minerID]
+	p.mu.RUnlock()
+	if !ok {
+		return 0, 0
+	}
+	return ms.Summary()
+}
+
+// broadcastWork sends the current job to every stratum client; the caller
+// must hold p.mu
+func (p *MiningPool) broadcastWork() {
+	if p.stratum == nil || p.job == nil {
+		return
+	}
+	p.stratum.mu.RLock()
+	for _, client := range p.stratum.clients {
+		client.sendJob(p.job, p.job.clean)
+	}
+	p.stratum.mu.RUnlock()
+}
+
+// handleTipChange signals followTip when the chain tip may have moved,
+// whether by the pool's own block, one from the network or a reorg.
+// Notifications for the pool's own blocks arrive while SubmitShare holds
+// p.mu, so it only signals and never blocks.
+func (p *MiningPool) handleTipChange(n *blockchain.Notification) {
+	switch n.Type {
+	case blockchain.NTBlockConnected, blockchain.NTBlockDisconnected, blockchain.NTReorganization:
+	default:
+		return
+	}
+	select {
+	case p.tipChanged <- struct{}{}:
+	default:
+	}
+}
+
+// followTip replaces the template whenever the chain tip moves under it
+// and pushes the new work to miners as a clean job at once, rather than
+// leaving them on a stale one until their next share
+func (p *MiningPool) followTip() {
+	for range p.tipChanged {
+		p.mu.Lock()
+		tip := p.blockchain.GetLatestBlock()
+		if p.job == nil || p.job.block.PrevHash != tip.Hash {
+			p.createNewBlockTemplate()
+			p.broadcastWork()
+		}
+		p.mu.Unlock()
 	}
 }
 
 // StartMining begins the mining process
 func (p *MiningPool) StartMining() {
-	// Create initial block template
+	// Create initial block template and follow the chain tip
+	p.mu.Lock()
 	p.createNewBlockTemplate()
+	p.mu.Unlock()
+	go p.followTip()
 
 	// Start difficulty adjustment routine
 	go func() {
@@ -4,6 +4,8 @@ import (
 	"math/big"
 	"sync"
 	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
 )
 
 // TimeWindow represents a time window for statistics
@@ -13,6 +15,24 @@ type TimeWindow struct {
 	Blocks   int64
 	Hashrate float64
 	StartTime time.Time
+	Work     float64 // Sum of accepted share difficulties
+}
+
+// Share chart resolution and retention
+const (
+	shareChartInterval = 5 * time.Minute
+	shareChartWindow   = 24 * time.Hour
+)
+
+// ShareBucket counts the shares of one chart interval
+type ShareBucket struct {
+	Time     time.Time `json:"time"`
+	Accepted int64     `json:"accepted"`
+	Stale    int64     `json:"stale"`
+	Invalid  int64     `json:"invalid"`
+	Hashrate float64   `json:"hashrate"` // Effective, from accepted work
+
+	work float64 // Sum of accepted share difficulties
 }
 
 // MinerStats tracks detailed statistics for a miner
@@ -21,20 +41,24 @@ type MinerStats struct {
 	TotalShares     int64
 	ValidShares     int64
 	InvalidShares   int64
+	Rejects         map[RejectReason]int64 // Invalid shares by reason
 	BlocksFound     int64
 	LastShare       time.Time
 	LastBlock       time.Time
 	CurrentHashrate float64
 	AverageHashrate float64
+	BestShare       *big.Int // Highest difficulty achieved by an accepted share
 	Windows         map[time.Duration]*TimeWindow // Different time windows (1h, 24h, 7d)
 	ShareHistory    []ShareEntry
 	Difficulties    []DifficultyEntry
+	buckets         map[int64]*ShareBucket // Interval start -> counts, for the chart
 }
 
 // ShareEntry represents a single share submission
 type ShareEntry struct {
 	Timestamp  time.Time
-	Difficulty *big.Int
+	Difficulty *big.Int // Difficulty the share was submitted at
+	Achieved   *big.Int // Difficulty its hash achieves, at least Difficulty
 	Valid      bool
 }
 
@@ -63,11 +87,20 @@ type PoolStats struct {
 
 // BlockEntry represents a found block
 type BlockEntry struct {
-	Timestamp time.Time
-	Height    uint64
-	Hash      []byte
-	Miner     string
-	Reward    *big.Int
+	Timestamp   time.Time         `json:"timestamp"`
+	Height      uint64            `json:"height"`
+	Hash        string            `json:"hash"`
+	Status      string            `json:"status"` // Of its round
+	Finder      string            `json:"finder"` // Worker whose share was the block, empty if unknown
+	Reward      blockchain.Amount `json:"reward"`
+	FinderBonus blockchain.Amount `json:"finder_bonus"`
+	Shares      int64             `json:"shares"` // Submitted in its round
+	Effort      float64           `json:"effort"` // Round's share work as a percentage of the block difficulty, 0 if unknown
+
+	// Blocks mined on top of it, up to the number it needs to mature.
+	// Orphaned blocks have none.
+	Confirmations         uint64 `json:"confirmations"`
+	ConfirmationsRequired uint64 `json:"confirmations_required"`
 }
 
 // NewMinerStats creates a new miner statistics tracker
@@ -78,13 +111,18 @@ func NewMinerStats() *MinerStats {
 			24 * time.Hour:     {Duration: 24 * time.Hour, StartTime: time.Now()},
 			7 * 24 * time.Hour: {Duration: 7 * 24 * time.Hour, StartTime: time.Now()},
 		},
+		Rejects:      make(map[RejectReason]int64),
+		BestShare:    new(big.Int),
+		buckets:      make(map[int64]*ShareBucket),
 		ShareHistory: make([]ShareEntry, 0, 1000),    // Keep last 1000 shares
 		Difficulties: make([]DifficultyEntry, 0, 100), // Keep last 100 difficulty changes
 	}
 }
 
-// AddShare records a share submission
-func (ms *MinerStats) AddShare(difficulty *big.Int, valid bool) {
+// AddShare records a share submitted at difficulty whose hash achieves
+// achieved. Hashrates are estimated from the submitted difficulty, which
+// is the share's expected work; the achieved difficulty only shows luck.
+func (ms *MinerStats) AddShare(difficulty, achieved *big.Int, valid bool) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
@@ -100,14 +138,30 @@ func (ms *MinerStats) AddShare(difficulty *big.Int, valid bool) {
 	ms.ShareHistory = append(ms.ShareHistory, ShareEntry{
 		Timestamp:  now,
 		Difficulty: new(big.Int).Set(difficulty),
+		Achieved:   new(big.Int).Set(achieved),
 		Valid:      valid,
 	})
+	if valid && achieved.Cmp(ms.BestShare) > 0 {
+		ms.BestShare.Set(achieved)
+	}
 
 	// Maintain history size
 	if len(ms.ShareHistory) > 1000 {
 		ms.ShareHistory = ms.ShareHistory[1:]
 	}
 
+	var work float64
+	if valid {
+		work, _ = new(big.Float).SetInt(difficulty).Float64()
+	}
+	bucket := ms.bucket(now)
+	if valid {
+		bucket.Accepted++
+		bucket.work += work
+	} else {
+		bucket.Invalid++
+	}
+
 	// Update time windows
 	for _, window := range ms.Windows {
 		if now.Sub(window.StartTime) > window.Duration {
@@ -116,14 +170,73 @@ func (ms *MinerStats) AddShare(difficulty *big.Int, valid bool) {
 			window.Shares = 0
 			window.Blocks = 0
 			window.Hashrate = 0
+			window.Work = 0
 		}
 		window.Shares++
+		window.Work += work
 	}
 
 	// Update hashrate calculations
 	ms.updateHashrate()
 }
 
+// AddReject records a rejected share. Rejects don't count towards the
+// hashrate, so they are kept out of the share history.
+func (ms *MinerStats) AddReject(reason RejectReason) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.TotalShares++
+	ms.InvalidShares++
+	ms.Rejects[reason]++
+
+	bucket := ms.bucket(time.Now())
+	if reason == RejectStale {
+		bucket.Stale++
+	} else {
+		bucket.Invalid++
+	}
+}
+
+// bucket returns the chart bucket of the interval containing t, dropping
+// buckets that fell out of the chart window; the caller must hold ms.mu
+func (ms *MinerStats) bucket(t time.Time) *ShareBucket {
+	start := t.Truncate(shareChartInterval)
+	b, ok := ms.buckets[start.Unix()]
+	if !ok {
+		cutoff := start.Add(-shareChartWindow).Unix()
+		for key := range ms.buckets {
+			if key <= cutoff {
+				delete(ms.buckets, key)
+			}
+		}
+		b = &ShareBucket{Time: start}
+		ms.buckets[start.Unix()] = b
+	}
+	return b
+}
+
+// Chart returns the share counts of every interval in the chart window
+// ending at now, oldest first, including intervals without shares
+func (ms *MinerStats) Chart(now time.Time) []ShareBucket {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	count := int(shareChartWindow / shareChartInterval)
+	start := now.Truncate(shareChartInterval).Add(-time.Duration(count-1) * shareChartInterval)
+	chart := make([]ShareBucket, 0, count)
+	for i := 0; i < count; i++ {
+		t := start.Add(time.Duration(i) * shareChartInterval)
+		point := ShareBucket{Time: t}
+		if b, ok := ms.buckets[t.Unix()]; ok {
+			point = *b
+			point.Hashrate = b.work / shareChartInterval.Seconds()
+		}
+		chart = append(chart, point)
+	}
+	return chart
+}
+
 // AddBlock records a found block
 func (ms *MinerStats) AddBlock() {
 	ms.mu.Lock()
@@ -165,9 +278,9 @@ func (ms *MinerStats) updateHashrate() {
 		return
 	}
 
-	// Use last 10 minutes of shares for current hashrate
+	// Use the work of the last 10 minutes of shares for current hashrate
 	cutoff := time.Now().Add(-10 * time.Minute)
-	var recentShares int64
+	var recentWork float64
 	var oldestTime time.Time
 
 	for i := len(ms.ShareHistory) - 1; i >= 0; i-- {
@@ -175,16 +288,17 @@ func (ms *MinerStats) updateHashrate() {
 		if share.Timestamp.Before(cutoff) {
 			break
 		}
-		if oldestTime.IsZero() {
-			oldestTime = share.Timestamp
+		oldestTime = share.Timestamp
+		if share.Valid {
+			work, _ := new(big.Float).SetInt(share.Difficulty).Float64()
+			recentWork += work
 		}
-		recentShares++
 	}
 
-	if recentShares > 0 {
+	if !oldestTime.IsZero() {
 		timespan := time.Since(oldestTime).Seconds()
 		if timespan > 0 {
-			ms.CurrentHashrate = float64(recentShares) / timespan
+			ms.CurrentHashrate = recentWork / timespan
 		}
 	}
 
@@ -193,11 +307,18 @@ func (ms *MinerStats) updateHashrate() {
 	if dayWindow != nil {
 		timespan := time.Since(dayWindow.StartTime).Seconds()
 		if timespan > 0 {
-			ms.AverageHashrate = float64(dayWindow.Shares) / timespan
+			ms.AverageHashrate = dayWindow.Work / timespan
 		}
 	}
 }
 
+// Summary returns the 24h average hashrate and the number of blocks found
+func (ms *MinerStats) Summary() (float64, int64) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.AverageHashrate, ms.BlocksFound
+}
+
 // GetStats returns current statistics
 func (ms *MinerStats) GetStats() map[string]interface{} {
 	ms.mu.RLock()
@@ -212,6 +333,7 @@ func (ms *MinerStats) GetStats() map[string]interface{} {
 		"average_hashrate": ms.AverageHashrate,
 		"last_share":       ms.LastShare,
 		"last_block":       ms.LastBlock,
+		"best_share":       ms.BestShare.String(),
 	}
 
 	// Add window statistics
@@ -225,6 +347,12 @@ func (ms *MinerStats) GetStats() map[string]interface{} {
 	}
 	stats["windows"] = windows
 
+	rejects := make(map[string]int64, len(RejectReasons))
+	for _, reason := range RejectReasons {
+		rejects[string(reason)] = ms.Rejects[reason]
+	}
+	stats["rejects"] = rejects
+
 	return stats
 }
 
@@ -243,7 +371,7 @@ func NewPoolStats() *PoolStats {
 }
 
 // AddBlock records a found block
-func (ps *PoolStats) AddBlock(height uint64, hash []byte, miner string, reward *big.Int) {
+func (ps *PoolStats) AddBlock(entry BlockEntry) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
@@ -252,13 +380,8 @@ func (ps *PoolStats) AddBlock(height uint64, hash []byte, miner string, reward *
 	ps.LastBlockTime = now
 
 	// Add to block history
-	ps.BlockHistory = append(ps.BlockHistory, BlockEntry{
-		Timestamp: now,
-		Height:    height,
-		Hash:      hash,
-		Miner:     miner,
-		Reward:    new(big.Int).Set(reward),
-	})
+	entry.Timestamp = now
+	ps.BlockHistory = append(ps.BlockHistory, entry)
 
 	// Maintain history size
 	if len(ps.BlockHistory) > 1000 {
@@ -324,16 +447,9 @@ func (ps *PoolStats) GetStats() map[string]interface{} {
 	stats["windows"] = windows
 
 	// Add recent blocks
-	recentBlocks := make([]map[string]interface{}, 0, 10)
+	recentBlocks := make([]BlockEntry, 0, 10)
 	for i := len(ps.BlockHistory) - 1; i >= max(0, len(ps.BlockHistory)-10); i-- {
-		block := ps.BlockHistory[i]
-		recentBlocks = append(recentBlocks, map[string]interface{}{
-			"timestamp": block.Timestamp,
-			"height":    block.Height,
-			"hash":      block.Hash,
-			"miner":     block.Miner,
-			"reward":    block.Reward,
-		})
+		recentBlocks = append(recentBlocks, ps.BlockHistory[i])
 	}
 	stats["recent_blocks"] = recentBlocks
 
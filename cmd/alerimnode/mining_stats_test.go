@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestMinerStatsChart(t *testing.T) {
+	ms := NewMinerStats()
+	ms.AddShare(big.NewInt(600), big.NewInt(700), true)
+	ms.AddShare(big.NewInt(300), big.NewInt(300), true)
+	ms.AddReject(RejectStale)
+	ms.AddReject(RejectLowDifficulty)
+
+	chart := ms.Chart(time.Now())
+	if want := int(shareChartWindow / shareChartInterval); len(chart) != want {
+		t.Fatalf("chart has %d points, want %d", len(chart), want)
+	}
+	for i := 1; i < len(chart); i++ {
+		if chart[i].Time.Sub(chart[i-1].Time) != shareChartInterval {
+			t.Fatalf("points %d and %d are not one interval apart", i-1, i)
+		}
+	}
+
+	last := chart[len(chart)-1]
+	if last.Accepted != 2 || last.Stale != 1 || last.Invalid != 1 {
+		t.Errorf("last point = %+v", last)
+	}
+	if want := 900 / shareChartInterval.Seconds(); last.Hashrate != want {
+		t.Errorf("hashrate = %v, want %v", last.Hashrate, want)
+	}
+	if chart[0].Accepted != 0 {
+		t.Errorf("first point = %+v, want empty", chart[0])
+	}
+}
+
+func TestMinerStatsBucketsExpire(t *testing.T) {
+	ms := NewMinerStats()
+	now := time.Now()
+	ms.bucket(now.Add(-shareChartWindow-time.Hour)).Accepted++
+	ms.bucket(now).Accepted++
+
+	if len(ms.buckets) != 1 {
+		t.Errorf("%d buckets retained, want 1", len(ms.buckets))
+	}
+}
+
+func TestMinerStatsAchievedDifficulty(t *testing.T) {
+	ms := NewMinerStats()
+	tests := []struct {
+		difficulty, achieved int64
+		valid                bool
+		best                 int64
+	}{
+		{100, 150, true, 150},
+		{100, 5000, true, 5000},
+		{100, 900, true, 5000},
+		{100, 90000, false, 5000}, // Invalid shares aren't credited
+	}
+	for _, tt := range tests {
+		ms.AddShare(big.NewInt(tt.difficulty), big.NewInt(tt.achieved), tt.valid)
+		if ms.BestShare.Int64() != tt.best {
+			t.Errorf("after share achieving %d: best = %v, want %d", tt.achieved, ms.BestShare, tt.best)
+		}
+	}
+
+	last := ms.ShareHistory[len(ms.ShareHistory)-1]
+	if last.Difficulty.Int64() != 100 || last.Achieved.Int64() != 90000 {
+		t.Errorf("last history entry = %+v", last)
+	}
+	if got := ms.GetStats()["best_share"]; got != "5000" {
+		t.Errorf("best_share = %v, want 5000", got)
+	}
+
+	// The 24h window counts the work of the three accepted shares
+	if work := ms.Windows[24*time.Hour].Work; work != 300 {
+		t.Errorf("window work = %v, want 300", work)
+	}
+}
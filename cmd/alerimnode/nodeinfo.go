@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// NodeInfo is the node's state at a glance: the single call monitoring
+// dashboards and CLIs poll
+type NodeInfo struct {
+	Version         string              `json:"version"`
+	ProtocolVersion uint32              `json:"protocol_version"`
+	Network         string              `json:"network"`
+	Height          int                 `json:"height"`
+	BestBlock       blockchain.Hash     `json:"best_block"`
+	Difficulty      *big.Int            `json:"difficulty"` // Required of the next block
+	MempoolSize     int                 `json:"mempool_size"`
+	Peers           int                 `json:"peers"`
+	Wallet          WalletInfo          `json:"wallet"`
+	Pool            PoolInfo            `json:"pool"`
+	Listeners       map[string][]string `json:"listeners"`
+	StartedAt       time.Time           `json:"started_at"`
+	Uptime          int64               `json:"uptime"` // Seconds
+}
+
+// WalletInfo is the state of the pool wallet
+type WalletInfo struct {
+	Loaded        bool `json:"loaded"`         // The pool wallet key is configured
+	PayoutsPaused bool `json:"payouts_paused"` // The wallet can't cover mature balances
+}
+
+// PoolInfo is the state of the mining pool
+type PoolInfo struct {
+	Stratum  bool    `json:"stratum"` // The stratum server is running
+	Miners   int     `json:"miners"`
+	Hashrate float64 `json:"hashrate"`
+}
+
+// nodeStatus gathers NodeInfo from the node's subsystems
+type nodeStatus struct {
+	chain        *blockchain.Blockchain
+	network      *blockchain.Network
+	pool         *MiningPool // Nil without a pool
+	listeners    *Listeners  // Nil when not yet bound
+	walletLoaded bool
+	startedAt    time.Time
+}
+
+// Info returns the node's current state
+func (s *nodeStatus) Info() *NodeInfo {
+	params := s.chain.ChainParamsInfo()
+	info := &NodeInfo{
+		Version:         blockchain.Version,
+		ProtocolVersion: blockchain.ProtocolVersion,
+		Network:         params.Network,
+		Height:          s.chain.Height(),
+		BestBlock:       s.chain.TipHash(),
+		Difficulty:      params.Difficulty.Required,
+		MempoolSize:     s.chain.MempoolSize(),
+		Peers:           len(s.network.GetPeers()),
+		Wallet:          WalletInfo{Loaded: s.walletLoaded},
+		Listeners:       map[string][]string{},
+		StartedAt:       s.startedAt,
+		Uptime:          int64(time.Since(s.startedAt).Seconds()),
+	}
+	if s.pool != nil {
+		if check := s.pool.rewards.LastHotWalletCheck(); check != nil {
+			info.Wallet.PayoutsPaused = check.Paused
+		}
+		info.Pool = PoolInfo{
+			Stratum:  s.pool.stratum != nil,
+			Miners:   len(s.pool.GetActiveMiners()),
+			Hashrate: s.pool.GetTotalHashrate(),
+		}
+	}
+	if s.listeners != nil {
+		info.Listeners = s.listeners.Addrs()
+	}
+	return info
+}
+
+// Banner formats the node's state for the log once it has started
+func (s *nodeStatus) Banner() string {
+	info := s.Info()
+	wallet := "not loaded"
+	if info.Wallet.Loaded {
+		wallet = "loaded"
+	}
+	stratum := "disabled"
+	if info.Pool.Stratum {
+		stratum = "enabled"
+	}
+	lines := []string{
+		fmt.Sprintf("Alerim node %s (protocol %d) started", info.Version, info.ProtocolVersion),
+		fmt.Sprintf("  network:    %s", info.Network),
+		fmt.Sprintf("  height:     %d (%x)", info.Height, info.BestBlock),
+		fmt.Sprintf("  difficulty: %s", info.Difficulty),
+		fmt.Sprintf("  mempool:    %d transactions", info.MempoolSize),
+		fmt.Sprintf("  wallet:     %s", wallet),
+		fmt.Sprintf("  stratum:    %s", stratum),
+	}
+	for _, name := range []string{ListenerAPI, ListenerP2P, ListenerStratum, ListenerElectrum} {
+		if addrs, ok := info.Listeners[name]; ok {
+			lines = append(lines, fmt.Sprintf("  %-11s %s", name+":", strings.Join(addrs, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// registerInfoRPCs adds getinfo
+func registerInfoRPCs(s *RPCServer, status *nodeStatus) {
+	s.Register("getinfo", func(params []json.RawMessage) (interface{}, error) {
+		if err := parseParams(params, 0); err != nil {
+			return nil, err
+		}
+		return status.Info(), nil
+	})
+}
+
+// registerInfoRoutes adds GET /info, the REST form of getinfo
+func registerInfoRoutes(api *gin.RouterGroup, status *nodeStatus) {
+	api.GET("/info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, status.Info())
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestNodeInfo(t *testing.T) {
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	for i := 0; i < 2; i++ {
+		if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := blockchain.NewNetworkWithListener(bc, listener)
+	defer network.Stop()
+
+	status := &nodeStatus{chain: bc, network: network, walletLoaded: true, startedAt: time.Now().Add(-time.Minute)}
+	info := status.Info()
+	if info.Network != "regtest" || info.Height != 2 || info.BestBlock != blockchain.Hash(bc.TipHash()) {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Difficulty == nil || info.Difficulty.Sign() <= 0 {
+		t.Errorf("difficulty = %v", info.Difficulty)
+	}
+	if !info.Wallet.Loaded || info.Pool.Stratum || info.Uptime < 60 {
+		t.Errorf("wallet = %+v, pool = %+v, uptime = %d", info.Wallet, info.Pool, info.Uptime)
+	}
+
+	banner := status.Banner()
+	for _, want := range []string{blockchain.Version, "regtest", "height:     2", "wallet:     loaded"} {
+		if !strings.Contains(banner, want) {
+			t.Errorf("banner lacks %q:\n%s", want, banner)
+		}
+	}
+}
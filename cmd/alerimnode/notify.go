@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// NotifyConfig holds the operator-configured notification hooks. Each hook
+// is either a shell command or an http(s) webhook URL; %s is replaced with
+// the relevant block or transaction hash.
+type NotifyConfig struct {
+	BlockNotify  string // Fired when a new block is connected
+	WalletNotify string // Fired when a transaction touches a node wallet
+	ReorgNotify  string // Fired when the main chain is reorganized
+}
+
+// Notifier dispatches chain events to the configured hooks
+type Notifier struct {
+	config *NotifyConfig
+	client *http.Client
+}
+
+// NewNotifier creates a notifier for the given hook configuration
+func NewNotifier(config *NotifyConfig) *Notifier {
+	return &Notifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// HandleNotification is a blockchain.NotificationCallback firing the hooks
+func (n *Notifier) HandleNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		block, ok := notification.Data.(*blockchain.Block)
+		if !ok {
+			return
+		}
+		n.fire("block", n.config.BlockNotify, fmt.Sprintf("%x", block.Hash))
+
+		for _, tx := range block.Transactions {
+			n.notifyWalletTx(&tx)
+		}
+
+	case blockchain.NTTxAccepted:
+		if tx, ok := notification.Data.(*blockchain.Transaction); ok {
+			n.notifyWalletTx(tx)
+		}
+
+	case blockchain.NTReorganization:
+		if reorg, ok := notification.Data.(*blockchain.ReorganizationData); ok {
+			n.fire("reorg", n.config.ReorgNotify, fmt.Sprintf("%x", reorg.NewTip))
+		}
+	}
+}
+
+// notifyWalletTx fires walletnotify if the transaction pays a node wallet
+func (n *Notifier) notifyWalletTx(tx *blockchain.Transaction) {
+	if n.config.WalletNotify == "" {
+		return
+	}
+
+	for _, out := range tx.Outputs {
+		for _, wallet := range wallets {
+			if bytes.Equal(out.Script, []byte(wallet.Address)) {
+				n.fire("wallet", n.config.WalletNotify, fmt.Sprintf("%x", tx.Hash))
+				return
+			}
+		}
+	}
+}
+
+// fire runs a hook asynchronously so slow hooks never stall the chain
+func (n *Notifier) fire(event, hook, hash string) {
+	if hook == "" {
+		return
+	}
+
+	target := strings.ReplaceAll(hook, "%s", hash)
+
+	go func() {
+		var err error
+		if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+			err = n.postWebhook(target, event, hash)
+		} else {
+			err = exec.Command("sh", "-c", target).Run()
+		}
+		if err != nil {
+			log.Printf("Error running %snotify hook: %v", event, err)
+		}
+	}()
+}
+
+// postWebhook delivers an event to a webhook URL as JSON
+func (n *Notifier) postWebhook(url, event, hash string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":     event,
+		"hash":      hash,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runJSONHook delivers a JSON document to an operator hook: webhook URLs
+// get it as a POST, commands on standard input, e.g. to pipe it into mail(1)
+func runJSONHook(client *http.Client, hook string, body []byte) error {
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		resp, err := client.Post(hook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", hook)
+	cmd.Stdin = bytes.NewReader(body)
+	return cmd.Run()
+}
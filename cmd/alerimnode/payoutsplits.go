@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPayoutSplits bounds the addresses a miner's payouts can be split
+// between, which keeps payout transactions small
+const maxPayoutSplits = 10
+
+// PayoutSplit is an address receiving a percentage of a miner's payouts
+type PayoutSplit struct {
+	Address string  `json:"address"`
+	Percent float64 `json:"percent"` // At most two decimals
+}
+
+// basisPoints returns the split's percentage in hundredths of a percent
+func (s PayoutSplit) basisPoints() uint64 {
+	return uint64(math.Round(s.Percent * 100))
+}
+
+// validatePayoutSplits checks that splits name distinct addresses and
+// percentages adding up to 100. No splits at all is valid: payouts then
+// go to the miner's address.
+func validatePayoutSplits(splits []PayoutSplit) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	if len(splits) > maxPayoutSplits {
+		return fmt.Errorf("payouts can be split between at most %d addresses", maxPayoutSplits)
+	}
+
+	seen := make(map[string]bool)
+	var total uint64
+	for _, split := range splits {
+		switch {
+		case split.Address == "":
+			return fmt.Errorf("split addresses can't be empty")
+		case seen[split.Address]:
+			return fmt.Errorf("address %s is split to more than once", split.Address)
+		case split.Percent <= 0 || math.Abs(split.Percent*100-math.Round(split.Percent*100)) > 1e-6:
+			return fmt.Errorf("split to %s: percent must be positive with at most two decimals", split.Address)
+		}
+		seen[split.Address] = true
+		total += split.basisPoints()
+	}
+	if total != 10000 {
+		return fmt.Errorf("split percentages add up to %.2f%%, not 100%%", float64(total)/100)
+	}
+	return nil
+}
+
+// splitPayout divides a payout between the split addresses, which must be
+// valid. What rounding leaves over goes to the first address.
+func splitPayout(value uint64, splits []PayoutSplit) []blockchain.TxOutput {
+	outputs := make([]blockchain.TxOutput, len(splits))
+	remaining := value
+	for i, split := range splits {
+		share := blockchain.Amount(value).MulDiv(int64(split.basisPoints()), 10000)
+		outputs[i] = blockchain.TxOutput{Value: uint64(share), Script: []byte(split.Address)}
+		remaining -= uint64(share)
+	}
+	outputs[0].Value += remaining
+	return outputs
+}
+
+// splitsDust reports whether a split payout would pay an address less
+// than the dust threshold. Such payouts are held until the balance grows.
+func splitsDust(outputs []blockchain.TxOutput, threshold blockchain.Amount) bool {
+	for _, out := range outputs {
+		if blockchain.Amount(out.Value) < threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// registerPayoutSplitRoutes adds the endpoint setting the addresses a
+// miner's payouts are split between. An empty list pays the miner's
+// address again.
+func registerPayoutSplitRoutes(api *gin.RouterGroup) {
+	api.PUT("/miners/:id/payout/splits", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		var req struct {
+			Splits []PayoutSplit `json:"splits"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if err := validatePayoutSplits(req.Splits); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		for _, miner := range activeMiners {
+			if miner.ID != c.Param("id") {
+				continue
+			}
+			if !authorizeUser(c, miner.UserID) {
+				respondError(c, apiError(CodeForbidden, "Not allowed to manage this miner"))
+				return
+			}
+			if len(req.Splits) > 0 && convertsPayout(miner) {
+				respondError(c, apiError(CodeInvalidRequest, "Converted payouts can't be split"))
+				return
+			}
+			miner.PayoutSplits = req.Splits
+			c.JSON(http.StatusOK, miner)
+			return
+		}
+		respondError(c, apiError(CodeNotFound, "Miner not found"))
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidatePayoutSplits(t *testing.T) {
+	tests := []struct {
+		name   string
+		splits []PayoutSplit
+		ok     bool
+	}{
+		{"none", nil, true},
+		{"80/20", []PayoutSplit{{"a", 80}, {"b", 20}}, true},
+		{"thirds", []PayoutSplit{{"a", 33.33}, {"b", 33.33}, {"c", 33.34}}, true},
+		{"single", []PayoutSplit{{"a", 100}}, true},
+		{"under 100", []PayoutSplit{{"a", 80}, {"b", 19.99}}, false},
+		{"over 100", []PayoutSplit{{"a", 80}, {"b", 30}}, false},
+		{"three decimals", []PayoutSplit{{"a", 33.333}, {"b", 66.667}}, false},
+		{"zero", []PayoutSplit{{"a", 100}, {"b", 0}}, false},
+		{"duplicate", []PayoutSplit{{"a", 50}, {"a", 50}}, false},
+		{"empty address", []PayoutSplit{{"", 100}}, false},
+	}
+	for _, tt := range tests {
+		if err := validatePayoutSplits(tt.splits); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestSplitPayout(t *testing.T) {
+	outputs := splitPayout(1001, []PayoutSplit{{"a", 80}, {"b", 20}})
+	if len(outputs) != 2 || string(outputs[0].Script) != "a" || string(outputs[1].Script) != "b" {
+		t.Fatalf("outputs = %+v", outputs)
+	}
+	// The unit lost to rounding goes to the first address
+	if outputs[0].Value != 801 || outputs[1].Value != 200 {
+		t.Errorf("split 1001 into %d and %d, want 801 and 200", outputs[0].Value, outputs[1].Value)
+	}
+
+	if !splitsDust(outputs, 250) || splitsDust(outputs, 200) {
+		t.Error("dust check wrong around the smallest split")
+	}
+}
+
+func TestPayoutSplitsOwnership(t *testing.T) {
+	store, err := NewAPIKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, owner, err := store.Issue("user1", "owner", []string{ScopeManageMiners}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := store.Issue("user2", "other", []string{ScopeManageMiners}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedKeys := apiKeys
+	apiKeys = store
+	registryMu.Lock()
+	savedMiners := activeMiners
+	miner := &Miner{ID: "rig1", UserID: "user1", Address: "addr"}
+	activeMiners = []*Miner{miner}
+	registryMu.Unlock()
+	defer func() {
+		apiKeys = savedKeys
+		registryMu.Lock()
+		activeMiners = savedMiners
+		registryMu.Unlock()
+	}()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerPayoutSplitRoutes(router.Group("/api"))
+
+	put := func(secret string) int {
+		body := `{"splits":[{"address":"a","percent":60},{"address":"b","percent":40}]}`
+		req := httptest.NewRequest(http.MethodPut, "/api/miners/rig1/payout/splits", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := put(other); code != http.StatusForbidden {
+		t.Errorf("other user's key: status %d, want %d", code, http.StatusForbidden)
+	}
+	if len(miner.PayoutSplits) != 0 {
+		t.Fatalf("other user's key changed splits to %v", miner.PayoutSplits)
+	}
+	if code := put(owner); code != http.StatusOK {
+		t.Errorf("owner's key: status %d, want %d", code, http.StatusOK)
+	}
+	if len(miner.PayoutSplits) != 2 {
+		t.Errorf("owner's key left splits %v", miner.PayoutSplits)
+	}
+}
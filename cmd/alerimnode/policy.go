@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// registerPolicyRoutes adds the relay policy endpoints and the chain
+// parameters. Anyone may read the policy so wallets can pick a fee; only
+// the admin may change it.
+func registerPolicyRoutes(api *gin.RouterGroup, bc *blockchain.Blockchain) {
+	api.GET("/policy", func(c *gin.Context) {
+		c.JSON(http.StatusOK, bc.Policy())
+	})
+
+	api.GET("/chainparams", func(c *gin.Context) {
+		c.JSON(http.StatusOK, bc.ChainParamsInfo())
+	})
+
+	api.PUT("/admin/policy", authMiddleware(""), func(c *gin.Context) {
+		// Fields left out of the request keep their current value
+		policy := bc.Policy()
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		if err := bc.SetPolicy(policy); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	})
+}
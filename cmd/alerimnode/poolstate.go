@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// PoolState holds the pool's hot state: active jobs, the shares submitted
+// for them and workers' difficulties. The in-memory state serves a single
+// node; pool instances sharing a Redis state accept shares for each
+// other's jobs, reject each other's duplicates, and keep a worker's
+// difficulty when it reconnects to another instance.
+type PoolState interface {
+	// PublishJob makes a job the current one
+	PublishJob(job *miningJob) error
+	// Job returns an active job by ID, nil if there is none
+	Job(id string) (*miningJob, error)
+	// MarkShare records a share of a job, reporting false if it was
+	// already submitted
+	MarkShare(jobID string, hash []byte) (bool, error)
+	// SetDifficulty sets a worker's share difficulty
+	SetDifficulty(minerID string, difficulty *big.Int) error
+	// Difficulty returns a worker's share difficulty, nil if it has none
+	Difficulty(minerID string) (*big.Int, error)
+	// ForgetWorker drops a worker's state
+	ForgetWorker(minerID string) error
+}
+
+// memoryPoolState is the pool state of a single node. Only the current job
+// is active, so shares for a replaced job are stale.
+type memoryPoolState struct {
+	mu           sync.Mutex
+	job          *miningJob
+	submitted    map[string]bool // Share hashes submitted for job
+	difficulties map[string]*big.Int
+}
+
+// newMemoryPoolState creates an empty in-memory pool state
+func newMemoryPoolState() *memoryPoolState {
+	return &memoryPoolState{
+		submitted:    make(map[string]bool),
+		difficulties: make(map[string]*big.Int),
+	}
+}
+
+func (m *memoryPoolState) PublishJob(job *miningJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.job = job
+	m.submitted = make(map[string]bool)
+	return nil
+}
+
+func (m *memoryPoolState) Job(id string) (*miningJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job == nil || m.job.id != id {
+		return nil, nil
+	}
+	return m.job, nil
+}
+
+func (m *memoryPoolState) MarkShare(jobID string, hash []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job == nil || m.job.id != jobID || m.submitted[string(hash)] {
+		return false, nil
+	}
+	m.submitted[string(hash)] = true
+	return true, nil
+}
+
+func (m *memoryPoolState) SetDifficulty(minerID string, difficulty *big.Int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.difficulties[minerID] = new(big.Int).Set(difficulty)
+	return nil
+}
+
+func (m *memoryPoolState) Difficulty(minerID string) (*big.Int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d, ok := m.difficulties[minerID]; ok {
+		return new(big.Int).Set(d), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryPoolState) ForgetWorker(minerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.difficulties, minerID)
+	return nil
+}
+
+// Lifetimes of the pool state kept in Redis
+const (
+	redisJobTTL        = time.Hour // Jobs on an old tip are refused before they expire
+	redisDifficultyTTL = 24 * time.Hour
+)
+
+// redisKeyPrefix namespaces the pool's keys, so the server can be shared
+const redisKeyPrefix = "alerim:pool:"
+
+// redisPoolState is pool state shared by instances through Redis. A job
+// is stored whole, so any instance can verify its shares and submit the
+// block they find.
+type redisPoolState struct {
+	client *RedisClient
+}
+
+// NewRedisPoolState creates pool state kept on a Redis server
+func NewRedisPoolState(client *RedisClient) PoolState {
+	return &redisPoolState{client: client}
+}
+
+// ttlMillis formats a lifetime for the PX option of SET
+func ttlMillis(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+func (r *redisPoolState) PublishJob(job *miningJob) error {
+	_, err := r.client.Do("SET", redisKeyPrefix+"job:"+job.id, string(job.block.Encode()), "PX", ttlMillis(redisJobTTL))
+	return err
+}
+
+func (r *redisPoolState) Job(id string) (*miningJob, error) {
+	reply, err := r.client.Do("GET", redisKeyPrefix+"job:"+id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply %T for job %s", reply, id)
+	}
+	block, err := blockchain.DecodeBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %v", id, err)
+	}
+	if templateJobID(block) != id {
+		return nil, fmt.Errorf("job %s holds a different template", id)
+	}
+	return &miningJob{
+		id:     id,
+		block:  block,
+		target: blockchain.NewHashTarget(block.Target()),
+	}, nil
+}
+
+func (r *redisPoolState) MarkShare(jobID string, hash []byte) (bool, error) {
+	key := redisKeyPrefix + "share:" + jobID + ":" + hex.EncodeToString(hash)
+	reply, err := r.client.Do("SET", key, "1", "NX", "PX", ttlMillis(redisJobTTL))
+	if err != nil {
+		return false, err
+	}
+	// SET NX replies OK when the key was set, nil when it existed
+	return reply != nil, nil
+}
+
+func (r *redisPoolState) SetDifficulty(minerID string, difficulty *big.Int) error {
+	_, err := r.client.Do("SET", redisKeyPrefix+"diff:"+minerID, difficulty.String(), "PX", ttlMillis(redisDifficultyTTL))
+	return err
+}
+
+func (r *redisPoolState) Difficulty(minerID string) (*big.Int, error) {
+	reply, err := r.client.Do("GET", redisKeyPrefix+"diff:"+minerID)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, _ := reply.([]byte)
+	difficulty, ok := new(big.Int).SetString(string(data), 10)
+	if !ok || difficulty.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid difficulty %q for %s", data, minerID)
+	}
+	return difficulty, nil
+}
+
+func (r *redisPoolState) ForgetWorker(minerID string) error {
+	_, err := r.client.Do("DEL", redisKeyPrefix+"diff:"+minerID)
+	return err
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// fakeRedis serves the commands the pool uses from memory
+type fakeRedis struct {
+	mu       sync.Mutex
+	password string
+	data     map[string]string
+	listener net.Listener
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{password: password, data: make(map[string]string), listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authed := r.password == ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ := reader.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			io.ReadFull(reader, buf)
+			args[i] = string(buf[:size])
+		}
+
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		r.mu.Lock()
+		switch cmd {
+		case "AUTH":
+			authed = args[1] == r.password
+			if authed {
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "SELECT":
+			io.WriteString(conn, "+OK\r\n")
+		case "GET":
+			if v, ok := r.data[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				io.WriteString(conn, "$-1\r\n")
+			}
+		case "SET":
+			_, exists := r.data[args[1]]
+			nx := false
+			for _, opt := range args[3:] {
+				nx = nx || strings.ToUpper(opt) == "NX"
+			}
+			if nx && exists {
+				io.WriteString(conn, "$-1\r\n")
+			} else {
+				r.data[args[1]] = args[2]
+				io.WriteString(conn, "+OK\r\n")
+			}
+		case "DEL":
+			_, exists := r.data[args[1]]
+			delete(r.data, args[1])
+			if exists {
+				io.WriteString(conn, ":1\r\n")
+			} else {
+				io.WriteString(conn, ":0\r\n")
+			}
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+		r.mu.Unlock()
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	tests := []struct {
+		url  string
+		addr string
+		db   int
+		ok   bool
+	}{
+		{"redis://10.0.0.5:6380/2", "10.0.0.5:6380", 2, true},
+		{"redis://cache", "cache:6379", 0, true},
+		{"redis://[::1]/", "[::1]:6379", 0, true},
+		{"http://cache:6379", "", 0, false},
+		{"redis://cache/x", "", 0, false},
+		{"redis:///0", "", 0, false},
+	}
+	for _, tt := range tests {
+		c, err := NewRedisClient(tt.url, "")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.url, err)
+			continue
+		}
+		if err == nil && (c.addr != tt.addr || c.db != tt.db) {
+			t.Errorf("%s: addr %s db %d, want %s db %d", tt.url, c.addr, c.db, tt.addr, tt.db)
+		}
+	}
+}
+
+func TestRedisClientAuth(t *testing.T) {
+	server := startFakeRedis(t, "secret")
+	url := "redis://" + server.listener.Addr().String() + "/1"
+
+	c, _ := NewRedisClient(url, "wrong")
+	if _, err := c.Do("PING"); err == nil {
+		t.Error("connected with a wrong password")
+	}
+	c, _ = NewRedisClient(url, "secret")
+	defer c.Close()
+	if reply, err := c.Do("PING"); err != nil || reply != "PONG" {
+		t.Errorf("PING = %v, %v", reply, err)
+	}
+	if _, err := c.Do("FLUSHALL"); err == nil {
+		t.Error("error reply not returned")
+	} else if _, ok := err.(RedisError); !ok {
+		t.Errorf("error reply returned as %T", err)
+	}
+	// An error reply leaves the connection usable
+	if reply, err := c.Do("DEL", "missing"); err != nil || reply != int64(0) {
+		t.Errorf("DEL = %v, %v", reply, err)
+	}
+}
+
+// testJob returns a job for a template with the given timestamp
+func testJob(t *testing.T, bc *blockchain.Blockchain, timestamp int64) *miningJob {
+	block, err := bc.NewBlockTemplate([]byte("pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Timestamp = timestamp
+	return &miningJob{id: templateJobID(block), block: block, target: blockchain.NewHashTarget(block.Target())}
+}
+
+func TestPoolState(t *testing.T) {
+	server := startFakeRedis(t, "")
+	client, _ := NewRedisClient("redis://"+server.listener.Addr().String(), "")
+	defer client.Close()
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+
+	states := []struct {
+		name   string
+		state  PoolState
+		shared bool // Another instance sees the same state
+	}{
+		{"memory", newMemoryPoolState(), false},
+		{"redis", NewRedisPoolState(client), true},
+	}
+	for _, st := range states {
+		t.Run(st.name, func(t *testing.T) {
+			other := st.state
+			if !st.shared {
+				other = newMemoryPoolState()
+			}
+			first, second := testJob(t, bc, 1000), testJob(t, bc, 2000)
+			if err := st.state.PublishJob(first); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.state.PublishJob(second); err != nil {
+				t.Fatal(err)
+			}
+
+			// Redis keeps every published job for other instances; memory
+			// only the current one
+			job, err := other.Job(first.id)
+			if err != nil || (job != nil) != st.shared {
+				t.Errorf("Job(first) = %v, %v", job, err)
+			}
+			if st.shared && (job.block.Timestamp != 1000 || job.target != first.target) {
+				t.Error("job changed in the store")
+			}
+			if job, err := st.state.Job(second.id); err != nil || job == nil {
+				t.Errorf("Job(current) = %v, %v", job, err)
+			}
+
+			hash := []byte{1, 2, 3}
+			if fresh, err := st.state.MarkShare(second.id, hash); err != nil || !fresh {
+				t.Errorf("first submission: fresh %v, %v", fresh, err)
+			}
+			if fresh, _ := st.state.MarkShare(second.id, hash); fresh {
+				t.Error("duplicate accepted")
+			}
+
+			if d, err := st.state.Difficulty("w1"); err != nil || d != nil {
+				t.Errorf("unknown worker difficulty = %v, %v", d, err)
+			}
+			st.state.SetDifficulty("w1", big.NewInt(4096))
+			if d, _ := st.state.Difficulty("w1"); d == nil || d.Int64() != 4096 {
+				t.Errorf("difficulty = %v, want 4096", d)
+			}
+			st.state.ForgetWorker("w1")
+			if d, _ := st.state.Difficulty("w1"); d != nil {
+				t.Errorf("forgotten worker has difficulty %v", d)
+			}
+		})
+	}
+
+	// A tampered job is refused
+	server.mu.Lock()
+	server.data[redisKeyPrefix+"job:0011223344556677"] = "garbage"
+	server.mu.Unlock()
+	if job, err := NewRedisPoolState(client).Job("0011223344556677"); err == nil || job != nil {
+		t.Errorf("tampered job = %v, %v", job, err)
+	}
+}
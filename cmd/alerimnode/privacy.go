@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// anonPrefix marks miner IDs that were anonymized on account deletion
+const anonPrefix = "anon-"
+
+// errUnpaidBalance is returned when deleting a user who still has funds
+var errUnpaidBalance = errors.New("user has an unpaid balance; pass forfeit=true to delete anyway")
+
+// UserDataExport is the archive of everything stored about a user
+type UserDataExport struct {
+	ExportedAt time.Time                    `json:"exported_at"`
+	Account    *User                        `json:"account"`
+	Miners     []*Miner                     `json:"miners"`
+	Shares     map[string]int64             `json:"shares"`   // minerID -> total shares
+	Balances   map[string]blockchain.Amount `json:"balances"` // minerID -> unpaid balance
+	Credits    []map[string]interface{}     `json:"credits"`  // Per-round credits
+	Payouts    []*PayoutRecord              `json:"payouts"`
+	APIKeys    []map[string]interface{}     `json:"api_keys"`
+}
+
+// authorizeUser reports whether the request may act on a user's data:
+// admin sessions may act on anyone, API keys only on their owner
+func authorizeUser(c *gin.Context, userID string) bool {
+	if _, ok := c.Get("session"); ok {
+		return true
+	}
+	if v, ok := c.Get("apikey"); ok {
+		return v.(*APIKey).UserID == userID
+	}
+	return false
+}
+
+// minersOfUser returns the miners registered to a user
+func minersOfUser(userID string) []*Miner {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	miners := make([]*Miner, 0)
+	for _, miner := range activeMiners {
+		if miner.UserID == userID {
+			miners = append(miners, miner)
+		}
+	}
+	return miners
+}
+
+// ExportUserData collects all data stored about a user
+func (rm *RewardManager) ExportUserData(user *User) *UserDataExport {
+	export := &UserDataExport{
+		ExportedAt: time.Now(),
+		Account:    user,
+		Miners:     minersOfUser(user.ID),
+		Shares:     make(map[string]int64),
+		Balances:   make(map[string]blockchain.Amount),
+		Credits:    make([]map[string]interface{}, 0),
+		Payouts:    make([]*PayoutRecord, 0),
+		APIKeys:    make([]map[string]interface{}, 0),
+	}
+
+	// Key metadata only, never the stored hash
+	for _, key := range apiKeys.ListForUser(user.ID) {
+		export.APIKeys = append(export.APIKeys, map[string]interface{}{
+			"id":         key.ID,
+			"name":       key.Name,
+			"scopes":     key.Scopes,
+			"created_at": key.CreatedAt,
+			"last_used":  key.LastUsed,
+		})
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	for _, miner := range export.Miners {
+		export.Shares[miner.ID] = miner.TotalShares
+		if balance, ok := rm.balances[miner.ID]; ok {
+			export.Balances[miner.ID] = balance
+		}
+		for _, round := range rm.rounds {
+			if credit, ok := round.Credits[miner.ID]; ok {
+				export.Credits = append(export.Credits, map[string]interface{}{
+					"miner":      miner.ID,
+					"height":     round.Height,
+					"block_hash": round.BlockHash,
+					"status":     round.Status,
+					"shares":     round.Shares[miner.ID],
+					"credit":     credit,
+				})
+			}
+		}
+		for _, payout := range rm.payouts {
+			if payout.MinerID == miner.ID {
+				export.Payouts = append(export.Payouts, payout)
+			}
+		}
+	}
+
+	return export
+}
+
+// UnpaidBalance returns the total unpaid balance of a set of miners
+func (rm *RewardManager) UnpaidBalance(miners []*Miner) blockchain.Amount {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	var total blockchain.Amount
+	for _, miner := range miners {
+		total += rm.balances[miner.ID]
+	}
+	return total
+}
+
+// AnonymizeMiner replaces a miner's identity in all accounting records with
+// an irreversible pseudonym. Historical round credits and payouts keep their
+// amounts so the pool's books still reconcile. The unpaid balance can't be
+// paid to a pseudonym, so it is forfeited to the pool and recorded as such;
+// shares not yet credited to a round are discarded.
+func (rm *RewardManager) AnonymizeMiner(minerID string) string {
+	sum := sha256.Sum256([]byte(minerID + time.Now().String()))
+	anonID := anonPrefix + hex.EncodeToString(sum[:8])
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for _, payout := range rm.payouts {
+		if payout.MinerID == minerID {
+			payout.MinerID = anonID
+		}
+	}
+	if balance, ok := rm.balances[minerID]; ok {
+		if balance != 0 {
+			rm.recordPayout(anonID, PayoutForfeited, balance, "")
+		}
+		delete(rm.balances, minerID)
+	}
+	delete(rm.pendingShares, minerID)
+	if rm.audit != nil {
+		rm.audit.Anonymize(minerID, anonID)
+	}
+
+	for _, round := range rm.rounds {
+		if credit, ok := round.Credits[minerID]; ok {
+			round.Credits[anonID] = credit
+			delete(round.Credits, minerID)
+		}
+		if shares, ok := round.Shares[minerID]; ok {
+			round.Shares[anonID] = shares
+			delete(round.Shares, minerID)
+		}
+		if round.Finder == minerID {
+			round.Finder = anonID
+		}
+	}
+	rm.saveState()
+
+	return anonID
+}
+
+// DeleteUser removes a user's account, miners and API keys and anonymizes
+// their accounting history. Deletion is refused while the user has an
+// unpaid balance unless forfeit is set.
+func (p *MiningPool) DeleteUser(user *User, forfeit bool) error {
+	miners := minersOfUser(user.ID)
+	if !forfeit && p.rewards.UnpaidBalance(miners) > 0 {
+		return errUnpaidBalance
+	}
+
+	registryMu.Lock()
+	remaining := make([]*Miner, 0, len(activeMiners))
+	for _, miner := range activeMiners {
+		if miner.UserID != user.ID {
+			remaining = append(remaining, miner)
+		}
+	}
+	activeMiners = remaining
+
+	for i, u := range users {
+		if u.ID == user.ID {
+			users = append(users[:i], users[i+1:]...)
+			break
+		}
+	}
+	registryMu.Unlock()
+
+	for _, miner := range miners {
+		p.ForgetMiner(miner.ID)
+		p.rewards.AnonymizeMiner(miner.ID)
+	}
+
+	for _, key := range apiKeys.ListForUser(user.ID) {
+		apiKeys.Revoke(user.ID, key.ID)
+	}
+	if subAccounts != nil {
+		subAccounts.ForgetUser(user.ID)
+	}
+	if webhooks != nil {
+		webhooks.ForgetUser(user.ID)
+	}
+
+	log.Printf("Deleted user %s and anonymized their accounting records", user.ID)
+	return nil
+}
+
+// registerPrivacyRoutes adds the data export and account deletion endpoints
+func registerPrivacyRoutes(api *gin.RouterGroup, pool *MiningPool) {
+	api.GET("/users/:id/export", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		if !authorizeUser(c, c.Param("id")) {
+			respondError(c, apiError(CodeForbidden, "Not allowed to export this user's data"))
+			return
+		}
+
+		user := findUser(c.Param("id"))
+		if user == nil {
+			respondError(c, apiError(CodeNotFound, "User not found"))
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=alerim-user-%s.json", user.ID))
+		c.JSON(http.StatusOK, pool.rewards.ExportUserData(user))
+	})
+
+	// Deletion is irreversible, so it requires an admin session
+	api.DELETE("/users/:id", authMiddleware(""), func(c *gin.Context) {
+		user := findUser(c.Param("id"))
+		if user == nil {
+			respondError(c, apiError(CodeNotFound, "User not found"))
+			return
+		}
+
+		forfeit := strings.EqualFold(c.Query("forfeit"), "true")
+		if err := pool.DeleteUser(user, forfeit); err != nil {
+			respondError(c, apiError(CodeConflict, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// reportDateLayout is the format of report dates; days are UTC
+	reportDateLayout = "2006-01-02"
+
+	// reportTopMiners is how many miners a report ranks
+	reportTopMiners = 10
+
+	// maxStoredReports bounds the persisted report history
+	maxStoredReports = 366
+)
+
+// PoolReport summarizes the pool's activity over one UTC day
+type PoolReport struct {
+	Date           string              `json:"date"`
+	GeneratedAt    time.Time           `json:"generated_at"`
+	Complete       bool                `json:"complete"` // False while the day is still running
+	BlocksFound    int                 `json:"blocks_found"`
+	BlocksOrphaned int                 `json:"blocks_orphaned"`
+	TotalPaid      blockchain.Amount   `json:"total_paid"`
+	FeeRevenue     blockchain.Amount   `json:"fee_revenue"`
+	AverageLuck    float64             `json:"average_luck"` // Mean luck of the day's rounds with known work, 0 if none
+	TopMiners      []ReportMinerResult `json:"top_miners"`
+}
+
+// ReportMinerResult is a miner's share of a report's rounds
+type ReportMinerResult struct {
+	MinerID string            `json:"miner_id"`
+	Shares  int64             `json:"shares"`
+	Credit  blockchain.Amount `json:"credit"`
+}
+
+// GenerateReport builds the report of the UTC day starting at day from
+// the rounds found and payouts made on it. Orphaned rounds are counted
+// but earn no fees or credits.
+func (rm *RewardManager) GenerateReport(day, now time.Time) *PoolReport {
+	day = day.UTC().Truncate(24 * time.Hour)
+	end := day.Add(24 * time.Hour)
+	inDay := func(t time.Time) bool {
+		return !t.Before(day) && t.Before(end)
+	}
+
+	report := &PoolReport{
+		Date:        day.Format(reportDateLayout),
+		GeneratedAt: now,
+		Complete:    !now.Before(end),
+		TopMiners:   make([]ReportMinerResult, 0),
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	miners := make(map[string]*ReportMinerResult)
+	var luckSum float64
+	var luckRounds int
+	for _, round := range rm.rounds {
+		if !inDay(round.FoundAt) {
+			continue
+		}
+		if round.Status == RoundOrphaned {
+			report.BlocksOrphaned++
+			continue
+		}
+		report.BlocksFound++
+		report.FeeRevenue += round.PoolFee
+		if luck := round.Luck(); luck > 0 {
+			luckSum += luck
+			luckRounds++
+		}
+		for minerID, credit := range round.Credits {
+			m, ok := miners[minerID]
+			if !ok {
+				m = &ReportMinerResult{MinerID: minerID}
+				miners[minerID] = m
+			}
+			m.Shares += round.Shares[minerID]
+			m.Credit += credit
+		}
+	}
+	if luckRounds > 0 {
+		report.AverageLuck = luckSum / float64(luckRounds)
+	}
+
+	for _, payout := range rm.payouts {
+		if payout.Kind == PayoutPaid && inDay(payout.Time) {
+			report.TotalPaid += payout.Amount
+		}
+	}
+
+	for _, m := range miners {
+		report.TopMiners = append(report.TopMiners, *m)
+	}
+	sort.Slice(report.TopMiners, func(i, j int) bool {
+		a, b := report.TopMiners[i], report.TopMiners[j]
+		if a.Credit != b.Credit {
+			return a.Credit > b.Credit
+		}
+		return a.MinerID < b.MinerID
+	})
+	if len(report.TopMiners) > reportTopMiners {
+		report.TopMiners = report.TopMiners[:reportTopMiners]
+	}
+	return report
+}
+
+// Reporter produces a report for every completed day, keeps them, and
+// delivers each to the operators' hook
+type Reporter struct {
+	mu      sync.RWMutex
+	rewards *RewardManager
+	path    string
+	hook    string // Command or webhook URL, see deliver
+	client  *http.Client
+	reports []*PoolReport // Oldest first
+}
+
+// NewReporter loads the reports persisted at path. hook, if set, receives
+// every scheduled report.
+func NewReporter(rewards *RewardManager, path, hook string) (*Reporter, error) {
+	r := &Reporter{
+		rewards: rewards,
+		path:    path,
+		hook:    hook,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := loadJSONFile(path, &r.reports); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start reports the previous day if that wasn't done before the node was
+// last stopped, then every day just after midnight UTC
+func (r *Reporter) Start() {
+	go func() {
+		for {
+			now := time.Now().UTC()
+			yesterday := now.Truncate(24 * time.Hour).Add(-24 * time.Hour)
+			if r.Get(yesterday.Format(reportDateLayout)) == nil {
+				r.deliver(r.run(yesterday, now))
+			}
+			time.Sleep(time.Until(now.Truncate(24 * time.Hour).Add(24*time.Hour + time.Minute)))
+		}
+	}()
+}
+
+// run generates the report of a day and, once the day is complete,
+// stores it in place of any earlier report of that day
+func (r *Reporter) run(day, now time.Time) *PoolReport {
+	report := r.rewards.GenerateReport(day, now)
+	if !report.Complete {
+		return report
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.reports[:0]
+	for _, stored := range r.reports {
+		if stored.Date != report.Date {
+			kept = append(kept, stored)
+		}
+	}
+	r.reports = append(kept, report)
+	sort.Slice(r.reports, func(i, j int) bool { return r.reports[i].Date < r.reports[j].Date })
+	if len(r.reports) > maxStoredReports {
+		r.reports = r.reports[len(r.reports)-maxStoredReports:]
+	}
+	if r.path != "" {
+		if err := saveJSONFile(r.path, r.reports); err != nil {
+			log.Printf("Error saving pool reports: %v", err)
+		}
+	}
+	return report
+}
+
+// Get returns the stored report of a date, or nil
+func (r *Reporter) Get(date string) *PoolReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, report := range r.reports {
+		if report.Date == date {
+			return report
+		}
+	}
+	return nil
+}
+
+// List returns the stored reports, newest first
+func (r *Reporter) List() []*PoolReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reports := make([]*PoolReport, 0, len(r.reports))
+	for i := len(r.reports) - 1; i >= 0; i-- {
+		reports = append(reports, r.reports[i])
+	}
+	return reports
+}
+
+// deliver sends a report to the hook, see runJSONHook
+func (r *Reporter) deliver(report *PoolReport) {
+	if r.hook == "" {
+		return
+	}
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding pool report: %v", err)
+		return
+	}
+	if err := runJSONHook(r.client, r.hook, body); err != nil {
+		log.Printf("Error delivering pool report %s: %v", report.Date, err)
+	}
+}
+
+// RegisterRoutes adds the report endpoints, which require an admin
+// session. POST generates a report on demand, by default for today so far.
+func (r *Reporter) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/admin/reports", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, r.List())
+	})
+
+	api.GET("/admin/reports/:date", authMiddleware(""), func(c *gin.Context) {
+		report := r.Get(c.Param("date"))
+		if report == nil {
+			respondError(c, apiError(CodeNotFound, "Report not found"))
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	api.POST("/admin/reports", authMiddleware(""), func(c *gin.Context) {
+		now := time.Now().UTC()
+		day := now
+		if date := c.Query("date"); date != "" {
+			var err error
+			day, err = time.Parse(reportDateLayout, date)
+			if err != nil || day.After(now) {
+				respondError(c, apiError(CodeInvalidRequest, "Invalid date"))
+				return
+			}
+		}
+		c.JSON(http.StatusOK, r.run(day, now))
+	})
+}
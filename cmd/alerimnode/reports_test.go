@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestGenerateReport(t *testing.T) {
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	rm := newTestRewardManager(10)
+	rm.rounds = []*RoundSnapshot{
+		{Height: 1, FoundAt: day.Add(-time.Minute), Status: RoundConfirmed, PoolFee: 1000,
+			Shares: map[string]int64{"m1": 5}, Credits: map[string]blockchain.Amount{"m1": 9000}},
+		{Height: 2, FoundAt: day.Add(time.Hour), Status: RoundConfirmed, PoolFee: 20, Work: 500, Difficulty: 1000,
+			Shares: map[string]int64{"m1": 3, "m2": 1}, Credits: map[string]blockchain.Amount{"m1": 600, "m2": 200}},
+		{Height: 3, FoundAt: day.Add(2 * time.Hour), Status: RoundPending, PoolFee: 30, Work: 2000, Difficulty: 1000,
+			Shares: map[string]int64{"m2": 4}, Credits: map[string]blockchain.Amount{"m2": 900}},
+		{Height: 4, FoundAt: day.Add(3 * time.Hour), Status: RoundOrphaned, PoolFee: 40,
+			Shares: map[string]int64{"m3": 4}, Credits: map[string]blockchain.Amount{"m3": 5000}},
+	}
+	rm.payouts = []*PayoutRecord{
+		{MinerID: "m1", Kind: PayoutPaid, Amount: 700, Time: day.Add(5 * time.Hour)},
+		{MinerID: "m2", Kind: PayoutPaid, Amount: 300, Time: day.Add(25 * time.Hour)},
+		{MinerID: "m2", Kind: PayoutAdjustment, Amount: 50, Time: day.Add(6 * time.Hour)},
+	}
+
+	report := rm.GenerateReport(day.Add(13*time.Hour), day.Add(30*time.Hour))
+	if report.Date != "2024-03-10" || !report.Complete {
+		t.Errorf("date = %s, complete = %v", report.Date, report.Complete)
+	}
+	if report.BlocksFound != 2 || report.BlocksOrphaned != 1 {
+		t.Errorf("blocks found = %d, orphaned = %d, want 2 and 1", report.BlocksFound, report.BlocksOrphaned)
+	}
+	if report.FeeRevenue != 50 || report.TotalPaid != 700 {
+		t.Errorf("fee revenue = %s, total paid = %s", report.FeeRevenue, report.TotalPaid)
+	}
+	if report.AverageLuck != 1.25 {
+		t.Errorf("average luck = %v, want 1.25", report.AverageLuck)
+	}
+
+	want := []ReportMinerResult{{"m2", 5, 1100}, {"m1", 3, 600}}
+	if len(report.TopMiners) != len(want) {
+		t.Fatalf("top miners = %+v, want %+v", report.TopMiners, want)
+	}
+	for i := range want {
+		if report.TopMiners[i] != want[i] {
+			t.Errorf("top miner %d = %+v, want %+v", i, report.TopMiners[i], want[i])
+		}
+	}
+
+	if rm.GenerateReport(day, day.Add(time.Hour)).Complete {
+		t.Error("report of a running day is complete")
+	}
+}
+
+func TestReporterStoresCompleteDays(t *testing.T) {
+	var delivered PoolReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&delivered)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "reports.json")
+	reporter, err := NewReporter(newTestRewardManager(10), path, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	reporter.run(day, day.Add(time.Hour))
+	if reporter.Get("2024-03-10") != nil {
+		t.Error("report of a running day was stored")
+	}
+
+	reporter.run(day, day.Add(25*time.Hour))
+	reporter.deliver(reporter.run(day, day.Add(26*time.Hour)))
+	if got := reporter.List(); len(got) != 1 || !got[0].GeneratedAt.Equal(day.Add(26*time.Hour)) {
+		t.Errorf("stored reports = %+v, want only the latest run", got)
+	}
+	if delivered.Date != "2024-03-10" {
+		t.Errorf("delivered report dated %q", delivered.Date)
+	}
+
+	reloaded, err := NewReporter(newTestRewardManager(10), path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Get("2024-03-10") == nil {
+		t.Error("report not persisted")
+	}
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"math/big"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
 )
 
 // RewardConfig defines the pool's reward distribution configuration
 type RewardConfig struct {
-	BlockReward       *big.Int // Base reward per block
 	PoolFee          float64   // Pool fee percentage (0-100)
-	PayoutThreshold  *big.Int // Minimum amount for payout
+	FinderBonus      float64   // Percentage of the reward after the pool fee paid to the block's finder (0-100)
+	PayoutThreshold  blockchain.Amount // Minimum amount for payout
 	MaturityDepth    uint64   // Number of confirmations before rewards are paid
 	PayoutInterval   time.Duration
 }
@@ -20,35 +30,132 @@ type RewardManager struct {
 	mu            sync.RWMutex
 	config        *RewardConfig
 	pendingShares map[string]int64    // minerID -> shares
-	balances      map[string]*big.Int // minerID -> balance
+	pendingWork   float64             // Sum of the pending shares' difficulties
+	balances      map[string]blockchain.Amount // minerID -> balance
 	blockchain    *blockchain.Blockchain
+	payoutSigner  blockchain.Signer   // Pool wallet key signing payouts
+	rounds        []*RoundSnapshot    // Share snapshots of found blocks
+	statePath     string              // Rounds and balances, saved together
+	payouts       []*PayoutRecord     // History of balances paid or forfeited
+	payoutsPath   string
+	payoutGate    func(minerID string) bool
+	audit         *AuditLog           // Records manual balance adjustments
+	exchange      PayoutAdapter       // Converts payouts to other currencies
+	conversions   []*ConversionRecord // History of converted payouts
+	conversionsPath string
+	hotWallet     *HotWalletStatus    // Last check of the pool wallet's funds
+	fundsAlert    string              // Hook alerted when payouts pause or resume
+	shareWAL      *ShareWAL           // Pending shares' write-ahead log, nil when disabled
+	settledSeq    uint64              // Last logged share folded into a saved round
+}
+
+// errInsufficientPoolFunds is returned when the pool wallet's unspent
+// outputs can't cover a payout
+var errInsufficientPoolFunds = errors.New("pool wallet has insufficient funds")
+
+// Payout record kinds
+const (
+	PayoutPaid       = "paid"
+	PayoutForfeited  = "forfeited"
+	PayoutAdjustment = "adjustment" // Manual credit or debit by an operator
+)
+
+// PayoutRecord is an entry in the payout history
+type PayoutRecord struct {
+	MinerID string    `json:"miner_id"`
+	Kind    string    `json:"kind"`
+	Amount  blockchain.Amount `json:"amount"` // Negative for adjustments debiting the balance
+	TxHash  string    `json:"tx_hash,omitempty"`
+	Time    time.Time `json:"time"`
+
+	// Adjustments only: why, by whom, and the audit log entry
+	Reason  string `json:"reason,omitempty"`
+	Actor   string `json:"actor,omitempty"`
+	AuditID string `json:"audit_id,omitempty"`
 }
 
-// NewRewardManager creates a new reward manager instance
-func NewRewardManager(bc *blockchain.Blockchain) *RewardManager {
-	return &RewardManager{
+// NewRewardManager creates a new reward manager instance. Round snapshots,
+// balances, payout and conversion history are persisted in dataDir.
+func NewRewardManager(bc *blockchain.Blockchain, dataDir string) *RewardManager {
+	rm := &RewardManager{
 		config: &RewardConfig{
-			BlockReward:      new(big.Int).Mul(big.NewInt(50), big.NewInt(1e18)), // 50 AIM
 			PoolFee:         2.0, // 2%
-			PayoutThreshold: new(big.Int).Mul(big.NewInt(1), big.NewInt(1e18)),  // 1 AIM
+			PayoutThreshold: 1 * blockchain.Coin,
 			MaturityDepth:   100,
 			PayoutInterval:  24 * time.Hour,
 		},
 		pendingShares: make(map[string]int64),
-		balances:      make(map[string]*big.Int),
+		balances:      make(map[string]blockchain.Amount),
 		blockchain:    bc,
+		statePath:     filepath.Join(dataDir, "rewards.json"),
+		payoutsPath:   filepath.Join(dataDir, "payouts.json"),
+		conversionsPath: filepath.Join(dataDir, "conversions.json"),
 	}
+
+	if err := rm.loadState(); err != nil {
+		log.Printf("Error loading reward state: %v", err)
+	}
+	if err := loadJSONFile(rm.payoutsPath, &rm.payouts); err != nil {
+		log.Printf("Error loading payout history: %v", err)
+	}
+	if err := loadJSONFile(rm.conversionsPath, &rm.conversions); err != nil {
+		log.Printf("Error loading conversion history: %v", err)
+	}
+
+	return rm
 }
 
-// AddShare records a share for reward calculation
-func (rm *RewardManager) AddShare(minerID string) {
+// AddShare records a share submitted at difficulty for reward calculation
+func (rm *RewardManager) AddShare(minerID string, difficulty *big.Int) {
+	work, _ := new(big.Float).SetInt(difficulty).Float64()
+
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 	rm.pendingShares[minerID]++
+	rm.pendingWork += work
+	if rm.shareWAL != nil {
+		rm.shareWAL.Append(minerID, work)
+	}
+}
+
+// OpenShareWAL logs the current round's shares to a write-ahead log at
+// path, flushed every interval, so they survive a restart. Shares left in
+// the log by a crash are replayed into the round first; call it before
+// accepting shares.
+func (rm *RewardManager) OpenShareWAL(path string, interval time.Duration) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	wal, records, err := OpenShareWAL(path, rm.settledSeq, interval)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		rm.pendingShares[record.Miner]++
+		rm.pendingWork += record.Work
+	}
+	if len(records) > 0 {
+		log.Printf("Replayed %d shares of the current round from %s", len(records), path)
+	}
+	rm.shareWAL = wal
+	return nil
 }
 
-// ProcessBlockReward distributes rewards when a block is found
-func (rm *RewardManager) ProcessBlockReward(block *blockchain.Block) {
+// CloseShareWAL flushes and closes the share write-ahead log
+func (rm *RewardManager) CloseShareWAL() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.shareWAL == nil {
+		return nil
+	}
+	err := rm.shareWAL.Close()
+	rm.shareWAL = nil
+	return err
+}
+
+// ProcessBlockReward distributes rewards when a block is found by the
+// share of a worker, the finder
+func (rm *RewardManager) ProcessBlockReward(block *blockchain.Block, finder string) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
@@ -62,72 +169,380 @@ func (rm *RewardManager) ProcessBlockReward(block *blockchain.Block) {
 		return
 	}
 
-	// Calculate pool fee
-	poolFeeAmount := new(big.Int).Mul(rm.config.BlockReward, big.NewInt(int64(rm.config.PoolFee)))
-	poolFeeAmount.Div(poolFeeAmount, big.NewInt(100))
+	// The reward is what the coinbase pays the pool: the subsidy and the
+	// block's transaction fees, less any treasury share
+	height := rm.blockchain.GetHeight()
+	blockReward, txFees := rm.coinbaseReward(block, height)
+
+	// Calculate pool fee, in basis points of the reward
+	poolFeeAmount := blockReward.MulDiv(int64(rm.config.PoolFee*100), 10000)
+	remainingReward := blockReward - poolFeeAmount
+
+	// The finder's bonus comes off the reward shared by the round
+	finderBonus := remainingReward.MulDiv(int64(rm.config.FinderBonus*100), 10000)
+	remainingReward -= finderBonus
 
-	// Calculate reward per share
-	remainingReward := new(big.Int).Sub(rm.config.BlockReward, poolFeeAmount)
-	rewardPerShare := new(big.Float).Quo(
-		new(big.Float).SetInt(remainingReward),
-		new(big.Float).SetInt64(totalShares),
-	)
+	// Snapshot the round so its credits can be reversed on reorg
+	shares := make(map[string]int64, len(rm.pendingShares))
+	for minerID, n := range rm.pendingShares {
+		shares[minerID] = n
+	}
+	difficulty, _ := new(big.Float).SetInt(block.Difficulty()).Float64()
+	round := &RoundSnapshot{
+		Height:      height,
+		BlockHash:   hex.EncodeToString(block.Hash[:]),
+		FoundAt:     time.Now(),
+		Status:      RoundPending,
+		Shares:      shares,
+		Credits:     make(map[string]blockchain.Amount),
+		PoolFee:     poolFeeAmount,
+		Reward:      blockReward,
+		TxFees:      txFees,
+		Work:        rm.pendingWork,
+		Difficulty:  difficulty,
+		Finder:      finder,
+		FinderBonus: finderBonus,
+	}
 
-	// Distribute rewards to miners
+	// Distribute the reward, fees included, in proportion to shares; the
+	// rounding remainder stays with the pool
 	for minerID, shares := range rm.pendingShares {
-		minerReward := new(big.Float).Mul(rewardPerShare, new(big.Float).SetInt64(shares))
-		rewardInt, _ := minerReward.Int(nil)
+		minerReward := remainingReward.MulDiv(shares, totalShares)
+		rm.balances[minerID] += minerReward
+		round.Credits[minerID] = minerReward
+	}
+	if finderBonus > 0 {
+		rm.balances[finder] += finderBonus
+		round.Credits[finder] += finderBonus
+	}
+	for minerID := range round.Credits {
+		notifyWebhooks(minerID, "", nil)
+	}
+	if finder != "" {
+		notifyWebhooks(finder, WebhookBlockFound, map[string]interface{}{
+			"height": height,
+			"hash":   round.BlockHash,
+			"reward": blockReward,
+		})
+	}
 
-		if _, exists := rm.balances[minerID]; !exists {
-			rm.balances[minerID] = new(big.Int)
+	// The round's shares are saved with it, so they leave the log
+	if rm.shareWAL != nil {
+		rm.settledSeq = rm.shareWAL.Seq()
+	}
+	rm.recordRound(round)
+	if rm.shareWAL != nil {
+		if err := rm.shareWAL.Reset(); err != nil {
+			log.Printf("Error resetting share WAL: %v", err)
 		}
-		rm.balances[minerID].Add(rm.balances[minerID], rewardInt)
 	}
 
 	// Clear pending shares for next round
 	rm.pendingShares = make(map[string]int64)
+	rm.pendingWork = 0
 }
 
-// GetMinerBalance returns a miner's current balance
-func (rm *RewardManager) GetMinerBalance(minerID string) *big.Int {
+// GetMinerBalance returns a miner's current balance, including credits
+// from rounds that have not matured yet
+func (rm *RewardManager) GetMinerBalance(minerID string) blockchain.Amount {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
+	return rm.balances[minerID]
+}
 
-	if balance, exists := rm.balances[minerID]; exists {
-		return new(big.Int).Set(balance)
+// SetFinderBonus sets the percentage of each block's reward, after the
+// pool fee, paid to the worker whose share found it
+func (rm *RewardManager) SetFinderBonus(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("finder bonus %v%% is not within 0-100%%", percent)
 	}
-	return new(big.Int)
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.config.FinderBonus = percent
+	return nil
+}
+
+// SetPayoutKey sets the pool wallet key. Payouts spend outputs paying the
+// key's public key and are signed with it.
+func (rm *RewardManager) SetPayoutKey(key *ecdsa.PrivateKey) {
+	rm.SetPayoutSigner(blockchain.KeySigner{Key: key})
+}
+
+// SetPayoutSigner sets the signer of the pool wallet key, which may keep
+// the key outside the node, see ExternalSigner
+func (rm *RewardManager) SetPayoutSigner(signer blockchain.Signer) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.payoutSigner = signer
+}
+
+// SetPayoutGate installs a check that must pass before a miner is paid
+func (rm *RewardManager) SetPayoutGate(gate func(minerID string) bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.payoutGate = gate
 }
 
-// ProcessPayouts processes pending payouts for all miners
+// SetAuditLog installs the audit log manual balance adjustments are
+// recorded in
+func (rm *RewardManager) SetAuditLog(audit *AuditLog) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.audit = audit
+}
+
+// maxPayoutOutputs bounds the outputs of a payout run's transaction,
+// keeping it within the standard size. Miners past it are paid next run.
+const maxPayoutOutputs = 500
+
+// pendingPayout is a miner's payout collected during a payout run
+type pendingPayout struct {
+	minerID string
+	miner   *Miner
+	amount  blockchain.Amount
+	order   *SwapOrder // Set for converted payouts
+}
+
+// ProcessPayouts pays every miner owed at least the payout threshold in
+// a single transaction, so a run pays all of them or none: the change of
+// one payout can't fund the next until it confirms
 func (rm *RewardManager) ProcessPayouts() error {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
+	if rm.payoutSigner == nil {
+		return errors.New("payouts disabled: no pool wallet key loaded")
+	}
+
+	// Never start a run the pool wallet can't finish
+	if status := rm.checkHotWallet(); status.Paused {
+		return errPayoutsPaused
+	}
+
+	var payouts []*pendingPayout
+	var outputs []blockchain.TxOutput
 	for minerID, balance := range rm.balances {
-		if balance.Cmp(rm.config.PayoutThreshold) >= 0 {
-			// Create payout transaction
-			tx := &blockchain.Transaction{
-				From:      "pool",
-				To:        minerID,
-				Amount:    new(big.Int).Set(balance),
-				Timestamp: time.Now(),
+		// Hold payouts for miners that haven't passed verification
+		if rm.payoutGate != nil && !rm.payoutGate(minerID) {
+			continue
+		}
+
+		// Credits from immature rounds stay until their block is buried
+		payable := balance - rm.immatureCredit(minerID)
+		if payable <= 0 || payable < rm.config.PayoutThreshold {
+			continue
+		}
+
+		miner := findMiner(minerID)
+		if miner != nil {
+			miner = payoutMiner(miner)
+		}
+		if miner == nil || (miner.Address == "" && len(miner.PayoutSplits) == 0) {
+			log.Printf("Holding payout for miner %s: no payout address", minerID)
+			continue
+		}
+
+		// Converted payouts are sent to the exchange's deposit address,
+		// split ones divided between the split addresses
+		minerOutputs := []blockchain.TxOutput{{Value: uint64(payable), Script: []byte(miner.Address)}}
+		if len(miner.PayoutSplits) > 0 && !convertsPayout(miner) {
+			minerOutputs = splitPayout(uint64(payable), miner.PayoutSplits)
+			if splitsDust(minerOutputs, rm.blockchain.Policy().DustThreshold) {
+				log.Printf("Holding payout for miner %s: a split of %s would be dust", minerID, payable)
+				continue
 			}
+		}
+		if len(outputs)+len(minerOutputs) > maxPayoutOutputs {
+			log.Printf("Holding payout for miner %s: the run's transaction is full", minerID)
+			continue
+		}
 
-			if err := rm.blockchain.AddTransaction(tx); err != nil {
-				return err
+		payout := &pendingPayout{minerID: minerID, miner: miner, amount: payable}
+		if convertsPayout(miner) {
+			if rm.exchange == nil || !rm.exchange.Supports(miner.PayoutCurrency) {
+				log.Printf("Holding payout for miner %s: conversion to %s unavailable", minerID, miner.PayoutCurrency)
+				continue
+			}
+			order, err := rm.exchange.CreateSwap(miner.PayoutCurrency, miner.PayoutDestination, payable)
+			if err != nil {
+				log.Printf("Holding payout for miner %s: exchange error: %v", minerID, err)
+				continue
 			}
+			minerOutputs[0].Script = []byte(order.DepositAddress)
+			payout.order = order
+		}
+		payouts = append(payouts, payout)
+		outputs = append(outputs, minerOutputs...)
+	}
+	if len(payouts) == 0 {
+		return nil
+	}
 
-			// Reset balance after successful payout
-			rm.balances[minerID] = new(big.Int)
+	tx, err := rm.buildPayoutTx(outputs)
+	if err != nil {
+		return fmt.Errorf("payout run to %d miners: %v", len(payouts), err)
+	}
+	if err := rm.blockchain.AddTransaction(tx); err != nil {
+		return err
+	}
+
+	txHash := hex.EncodeToString(tx.Hash[:])
+	for _, payout := range payouts {
+		rm.recordPayout(payout.minerID, PayoutPaid, payout.amount, txHash)
+		notifyWebhooks(payout.minerID, WebhookPayout, map[string]interface{}{"amount": payout.amount, "tx_hash": txHash})
+		if order := payout.order; order != nil {
+			rm.recordConversion(&ConversionRecord{
+				MinerID:        payout.minerID,
+				Currency:       payout.miner.PayoutCurrency,
+				Destination:    payout.miner.PayoutDestination,
+				Amount:         payout.amount,
+				Reference:      order.Reference,
+				DepositAddress: order.DepositAddress,
+				ExpectedAmount: order.ExpectedAmount,
+				Rate:           order.Rate,
+				TxHash:         txHash,
+				Time:           time.Now(),
+			})
 		}
+
+		// Deduct the payout; immature credits remain
+		rm.balances[payout.minerID] -= payout.amount
 	}
+	rm.saveState()
 
 	return nil
 }
 
-// StartPayoutProcessor starts the automatic payout processor
+// coinbaseReward returns the value a found block's coinbase pays the pool
+// and the transaction fees the coinbase collected; the caller must hold
+// rm.mu. Without a coinbase the reward is the subsidy less the treasury
+// share, so the pool never credits more than it is paid.
+func (rm *RewardManager) coinbaseReward(block *blockchain.Block, height int) (reward, txFees blockchain.Amount) {
+	params := rm.blockchain.Params()
+	subsidy := params.BlockSubsidy(height)
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return subsidy - params.TreasuryShare(height, uint64(subsidy)), 0
+	}
+
+	script := rm.coinbaseScript()
+	var total blockchain.Amount
+	for _, out := range block.Transactions[0].Outputs {
+		total += blockchain.Amount(out.Value)
+		if bytes.Equal(out.Script, script) {
+			reward += blockchain.Amount(out.Value)
+		}
+	}
+	if total > subsidy {
+		txFees = total - subsidy
+	}
+	return reward, txFees
+}
+
+// poolScript returns the output script of the pool wallet; the caller must
+// hold rm.mu and have checked that payoutSigner is set
+func (rm *RewardManager) poolScript() []byte {
+	key := rm.payoutSigner.PublicKey()
+	return elliptic.Marshal(key.Curve, key.X, key.Y)
+}
+
+// CoinbaseScript returns the script block rewards are paid to: the pool
+// wallet, or an empty script when no payout key is configured
+func (rm *RewardManager) CoinbaseScript() []byte {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.coinbaseScript()
+}
+
+// coinbaseScript implements CoinbaseScript; the caller must hold rm.mu
+func (rm *RewardManager) coinbaseScript() []byte {
+	if rm.payoutSigner == nil {
+		return []byte{}
+	}
+	return rm.poolScript()
+}
+
+// buildPayoutTx creates a transaction paying outputs from the pool
+// wallet's unspent outputs, with change back to the pool, signed with the
+// pool wallet key. The pool pays the minimum relay fee, and change below
+// the dust threshold goes to the fee. The caller must hold rm.mu.
+func (rm *RewardManager) buildPayoutTx(outputs []blockchain.TxOutput) (*blockchain.Transaction, error) {
+	poolScript := rm.poolScript()
+	policy := rm.blockchain.Policy()
+	var value uint64
+	for _, out := range outputs {
+		value += out.Value
+	}
+
+	// The fee is estimated for the signed transaction with a change output
+	estimateFee := func(inputs []blockchain.TxInput) uint64 {
+		tx := blockchain.NewTransaction(inputs, append(outputs, blockchain.TxOutput{Script: poolScript}))
+		return uint64(policy.MinFee(len(tx.Encode()) + signatureSize*len(inputs)))
+	}
+
+	var inputs []blockchain.TxInput
+	var total uint64
+	fee := estimateFee(nil)
+	for _, out := range rm.blockchain.FindSpendableOutputs(poolScript) {
+		inputs = append(inputs, blockchain.TxInput{
+			PrevTxHash:  out.TxHash,
+			PrevTxIndex: out.Index,
+			Sequence:    0xFFFFFFFF,
+		})
+		total += out.Value
+		fee = estimateFee(inputs)
+		if total >= value+fee {
+			break
+		}
+	}
+	if total < value+fee {
+		return nil, errInsufficientPoolFunds
+	}
+
+	if change := total - value - fee; change > 0 && blockchain.Amount(change) >= policy.DustThreshold {
+		outputs = append(outputs, blockchain.TxOutput{Value: change, Script: poolScript})
+	}
+
+	tx := blockchain.NewTransaction(inputs, outputs)
+	if err := tx.SignWith(rm.payoutSigner); err != nil {
+		return nil, err
+	}
+	tx.Hash = tx.CalculateHash()
+	return tx, nil
+}
+
+// recordPayout appends to the payout history; the caller must hold rm.mu
+func (rm *RewardManager) recordPayout(minerID, kind string, amount blockchain.Amount, txHash string) {
+	rm.appendPayout(&PayoutRecord{
+		MinerID: minerID,
+		Kind:    kind,
+		Amount:  amount,
+		TxHash:  txHash,
+		Time:    time.Now(),
+	})
+}
+
+// appendPayout appends a record to the payout history and saves it; the
+// caller must hold rm.mu
+func (rm *RewardManager) appendPayout(record *PayoutRecord) {
+	rm.payouts = append(rm.payouts, record)
+	if rm.payoutsPath == "" {
+		return
+	}
+	if err := saveJSONFile(rm.payoutsPath, rm.payouts); err != nil {
+		log.Printf("Error saving payout history: %v", err)
+	}
+}
+
+// StartPayoutProcessor starts the automatic payout processor. It does
+// nothing when no pool wallet key is loaded.
 func (rm *RewardManager) StartPayoutProcessor() {
+	rm.mu.RLock()
+	hasKey := rm.payoutSigner != nil
+	rm.mu.RUnlock()
+	if !hasKey {
+		return
+	}
+
 	go func() {
 		ticker := time.NewTicker(rm.config.PayoutInterval)
 		defer ticker.Stop()
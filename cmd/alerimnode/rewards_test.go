@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestProcessPayoutsPaysWholeRun(t *testing.T) {
+	params := blockchain.RegTestParams
+	bc := blockchain.NewBlockchainWithParams(&params)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := newTestRewardManager(10)
+	rm.blockchain = bc
+	rm.SetPayoutKey(key)
+
+	// A single pool wallet output funds both payouts
+	if _, err := bc.GenerateBlock(rm.CoinbaseScript(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if outs := bc.FindSpendableOutputs(rm.CoinbaseScript()); len(outs) != 1 || outs[0].Value != uint64(blockchain.InitialBlockReward) {
+		t.Fatalf("pool wallet outputs = %v, want one of %s", outs, blockchain.InitialBlockReward)
+	}
+	owed := blockchain.Coin / 1000
+	rm.balances["m1"] = owed
+	rm.balances["m2"] = owed
+
+	registryMu.Lock()
+	saved := activeMiners
+	activeMiners = []*Miner{
+		{ID: "m1", Address: "addr1"},
+		{ID: "m2", Address: "addr2"},
+	}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		activeMiners = saved
+		registryMu.Unlock()
+	}()
+
+	if err := rm.ProcessPayouts(); err != nil {
+		t.Fatal(err)
+	}
+	if rm.balances["m1"] != 0 || rm.balances["m2"] != 0 {
+		t.Errorf("balances after the run = %v, want all paid", rm.balances)
+	}
+	if len(rm.payouts) != 2 || rm.payouts[0].TxHash != rm.payouts[1].TxHash {
+		t.Errorf("payouts = %v, want both in one transaction", rm.payouts)
+	}
+	if size := bc.MempoolSize(); size != 1 {
+		t.Errorf("mempool holds %d transactions, want 1", size)
+	}
+}
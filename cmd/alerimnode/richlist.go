@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"unicode"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of rich list queries
+const (
+	defaultRichListLimit = 100
+	maxRichListLimit     = 1000
+)
+
+// richOutput is an unspent output tracked by the rich list index
+type richOutput struct {
+	script string
+	value  uint64
+}
+
+// RichListEntry is one ranked address
+type RichListEntry struct {
+	Rank    int               `json:"rank"`
+	Address string            `json:"address"`
+	Balance blockchain.Amount `json:"balance"`
+	Percent float64           `json:"percent"` // Share of the circulating supply
+}
+
+// RichListIndex keeps the balance of every address on the main chain
+type RichListIndex struct {
+	mu       sync.RWMutex
+	utxos    map[string]richOutput     // outpoint -> output
+	balances map[string]uint64         // script -> balance
+	undo     map[[32]byte][]spentEntry // Connected block -> outputs it spent
+	supply   uint64
+	ranked   []string // Scripts by balance, rebuilt lazily
+	dirty    bool
+}
+
+// spentEntry records an output spent by a block, for undo
+type spentEntry struct {
+	key    string
+	output richOutput
+}
+
+// scriptAddress formats an output script for display: printable scripts
+// are addresses as given, anything else is shown as hex
+func scriptAddress(script string) string {
+	for _, r := range script {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return hex.EncodeToString([]byte(script))
+		}
+	}
+	return script
+}
+
+// NewRichListIndex builds the index from the current chain and keeps it in
+// sync through chain notifications
+func NewRichListIndex(bc *blockchain.Blockchain) *RichListIndex {
+	idx := &RichListIndex{
+		utxos:    make(map[string]richOutput),
+		balances: make(map[string]uint64),
+		undo:     make(map[[32]byte][]spentEntry),
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	bc.Subscribe(idx.handleChainNotification)
+	for _, block := range bc.GetBlocks() {
+		idx.connect(block)
+	}
+	return idx
+}
+
+// handleChainNotification applies connected and disconnected blocks
+func (idx *RichListIndex) handleChainNotification(n *blockchain.Notification) {
+	block, ok := n.Data.(*blockchain.Block)
+	if !ok {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		idx.connect(block)
+	case blockchain.NTBlockDisconnected:
+		idx.disconnect(block)
+	}
+}
+
+// credit adds to a script's balance; the caller must hold idx.mu
+func (idx *RichListIndex) credit(script string, value uint64) {
+	idx.balances[script] += value
+	idx.supply += value
+	idx.dirty = true
+}
+
+// debit subtracts from a script's balance; the caller must hold idx.mu
+func (idx *RichListIndex) debit(script string, value uint64) {
+	idx.balances[script] -= value
+	if idx.balances[script] == 0 {
+		delete(idx.balances, script)
+	}
+	idx.supply -= value
+	idx.dirty = true
+}
+
+// connect applies a block's outputs and spends; the caller must hold
+// idx.mu
+func (idx *RichListIndex) connect(block *blockchain.Block) {
+	if _, ok := idx.undo[block.Hash]; ok {
+		return
+	}
+
+	spent := make([]spentEntry, 0)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				key := outpointKey(in.PrevTxHash, in.PrevTxIndex)
+				if out, ok := idx.utxos[key]; ok {
+					spent = append(spent, spentEntry{key: key, output: out})
+					delete(idx.utxos, key)
+					idx.debit(out.script, out.value)
+				}
+			}
+		}
+		for i, out := range tx.Outputs {
+			script := string(out.Script)
+			idx.utxos[outpointKey(tx.Hash, uint32(i))] = richOutput{script: script, value: out.Value}
+			idx.credit(script, out.Value)
+		}
+	}
+	idx.undo[block.Hash] = spent
+}
+
+// disconnect reverses connect; the caller must hold idx.mu
+func (idx *RichListIndex) disconnect(block *blockchain.Block) {
+	spent, ok := idx.undo[block.Hash]
+	if !ok {
+		return
+	}
+	delete(idx.undo, block.Hash)
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		for j := range tx.Outputs {
+			key := outpointKey(tx.Hash, uint32(j))
+			if out, ok := idx.utxos[key]; ok {
+				delete(idx.utxos, key)
+				idx.debit(out.script, out.value)
+			}
+		}
+	}
+	for _, entry := range spent {
+		idx.utxos[entry.key] = entry.output
+		idx.credit(entry.output.script, entry.output.value)
+	}
+}
+
+// Top returns ranked addresses starting at offset, the number of
+// addresses holding a balance and the circulating supply
+func (idx *RichListIndex) Top(offset, limit int) ([]RichListEntry, int, uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.dirty {
+		idx.ranked = idx.ranked[:0]
+		for script := range idx.balances {
+			idx.ranked = append(idx.ranked, script)
+		}
+		sort.Slice(idx.ranked, func(i, j int) bool {
+			bi, bj := idx.balances[idx.ranked[i]], idx.balances[idx.ranked[j]]
+			if bi != bj {
+				return bi > bj
+			}
+			return idx.ranked[i] < idx.ranked[j]
+		})
+		idx.dirty = false
+	}
+
+	entries := make([]RichListEntry, 0, limit)
+	for i := offset; i < len(idx.ranked) && i < offset+limit; i++ {
+		script := idx.ranked[i]
+		entry := RichListEntry{
+			Rank:    i + 1,
+			Address: scriptAddress(script),
+			Balance: blockchain.Amount(idx.balances[script]),
+		}
+		if idx.supply > 0 {
+			entry.Percent = float64(entry.Balance) * 100 / float64(idx.supply)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, len(idx.ranked), idx.supply
+}
+
+// RegisterRoutes adds the rich list endpoint
+func (idx *RichListIndex) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/richlist", func(c *gin.Context) {
+		limit, err := queryInt(c, "limit", defaultRichListLimit)
+		if err != nil || limit < 1 || limit > maxRichListLimit {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid limit"))
+			return
+		}
+		offset, err := queryInt(c, "offset", 0)
+		if err != nil || offset < 0 {
+			respondError(c, apiError(CodeInvalidRequest, "Invalid offset"))
+			return
+		}
+
+		entries, total, supply := idx.Top(offset, limit)
+		c.JSON(http.StatusOK, gin.H{
+			"supply":    supply,
+			"addresses": total,
+			"offset":    offset,
+			"entries":   entries,
+		})
+	})
+}
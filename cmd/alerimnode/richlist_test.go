@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestScriptAddress(t *testing.T) {
+	if got := scriptAddress("AIMaddr1"); got != "AIMaddr1" {
+		t.Errorf("printable script = %q", got)
+	}
+	if got := scriptAddress("\x04\xff"); got != "04ff" {
+		t.Errorf("binary script = %q", got)
+	}
+}
+
+func TestRichListIndex(t *testing.T) {
+	idx := &RichListIndex{
+		utxos:    make(map[string]richOutput),
+		balances: make(map[string]uint64),
+		undo:     make(map[[32]byte][]spentEntry),
+	}
+	notify := func(typ blockchain.NotificationType, b *blockchain.Block) {
+		idx.handleChainNotification(&blockchain.Notification{Type: typ, Data: b})
+	}
+
+	coinbase := blockchain.CreateCoinbase(1000, []byte("alice"))
+	block1 := &blockchain.Block{Hash: [32]byte{1}, Transactions: []blockchain.Transaction{*coinbase}}
+
+	pay := blockchain.NewTransaction(
+		[]blockchain.TxInput{{PrevTxHash: coinbase.Hash, PrevTxIndex: 0}},
+		[]blockchain.TxOutput{{Value: 700, Script: []byte("bob")}, {Value: 300, Script: []byte("alice")}},
+	)
+	block2 := &blockchain.Block{Hash: [32]byte{2}, PrevHash: block1.Hash, Transactions: []blockchain.Transaction{*pay}}
+
+	notify(blockchain.NTBlockConnected, block1)
+	notify(blockchain.NTBlockConnected, block2)
+	notify(blockchain.NTBlockConnected, block2)
+
+	entries, total, supply := idx.Top(0, 10)
+	if supply != 1000 || total != 2 {
+		t.Fatalf("supply %d with %d addresses, want 1000 with 2", supply, total)
+	}
+	if entries[0].Address != "bob" || entries[0].Balance != 700 || entries[0].Percent != 70 {
+		t.Errorf("first entry = %+v", entries[0])
+	}
+	if entries[1].Rank != 2 || entries[1].Address != "alice" {
+		t.Errorf("second entry = %+v", entries[1])
+	}
+
+	if entries, _, _ := idx.Top(1, 10); len(entries) != 1 || entries[0].Address != "alice" {
+		t.Errorf("offset page = %+v", entries)
+	}
+
+	notify(blockchain.NTBlockDisconnected, block2)
+	entries, total, supply = idx.Top(0, 10)
+	if supply != 1000 || total != 1 || entries[0].Address != "alice" || entries[0].Balance != 1000 {
+		t.Errorf("after disconnect: %+v, %d addresses, supply %d", entries, total, supply)
+	}
+}
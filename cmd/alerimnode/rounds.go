@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// Round statuses
+const (
+	RoundPending   = "pending"
+	RoundConfirmed = "confirmed"
+	RoundOrphaned  = "orphaned"
+)
+
+// RoundSnapshot records the share distribution and resulting credits of a
+// round at the moment its block was found, so the credits can be reversed
+// exactly if the block is reorganized out and re-applied if it returns
+type RoundSnapshot struct {
+	Height    int                          `json:"height"`
+	BlockHash string                       `json:"block_hash"`
+	FoundAt   time.Time                    `json:"found_at"`
+	Status    string                       `json:"status"`
+	Shares    map[string]int64             `json:"shares"`
+	Credits   map[string]blockchain.Amount `json:"credits"`
+	PoolFee   blockchain.Amount            `json:"pool_fee"`
+
+	// What the block's coinbase paid the pool, and the transaction fees
+	// it collected. Zero for rounds from older versions, which credited
+	// the subsidy only.
+	Reward blockchain.Amount `json:"reward,omitempty"`
+	TxFees blockchain.Amount `json:"tx_fees,omitempty"`
+
+	// The round's share work and the found block's difficulty; their
+	// ratio is the round's luck. Zero for rounds from older versions.
+	Work       float64 `json:"work,omitempty"`
+	Difficulty float64 `json:"difficulty,omitempty"`
+
+	// The worker whose share was the block, and the bonus it was credited
+	// on top of its shares. Empty for rounds from older versions.
+	Finder      string            `json:"finder,omitempty"`
+	FinderBonus blockchain.Amount `json:"finder_bonus,omitempty"`
+}
+
+// Luck returns how much less work than expected the round took, as the
+// block difficulty over the share work: above 1 the pool was lucky. It
+// returns 0 when the round's work isn't known.
+func (r *RoundSnapshot) Luck() float64 {
+	if r.Work <= 0 {
+		return 0
+	}
+	return r.Difficulty / r.Work
+}
+
+// maxSettledRounds bounds how many confirmed or orphaned rounds are kept
+// for history; pending rounds are always kept
+const maxSettledRounds = 1000
+
+// rewardState is the persisted accounting state. Rounds and balances are
+// written together so a restart never sees credits without their rounds.
+type rewardState struct {
+	Rounds   []*RoundSnapshot             `json:"rounds"`
+	Balances map[string]blockchain.Amount `json:"balances"`
+	ShareSeq uint64                       `json:"share_seq,omitempty"` // Last logged share in the rounds
+}
+
+// recordRound stores a snapshot of a round; the caller must hold rm.mu
+func (rm *RewardManager) recordRound(round *RoundSnapshot) {
+	rm.rounds = append(rm.rounds, round)
+	rm.saveState()
+}
+
+// findRound returns the round for a block hash; the caller must hold rm.mu
+func (rm *RewardManager) findRound(hash string) *RoundSnapshot {
+	for i := len(rm.rounds) - 1; i >= 0; i-- {
+		if rm.rounds[i].BlockHash == hash {
+			return rm.rounds[i]
+		}
+	}
+	return nil
+}
+
+// OrphanRound reverses the credits of a round whose block left the main
+// chain. Balances may go negative if the credits were already paid out.
+func (rm *RewardManager) OrphanRound(hash string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	round := rm.findRound(hash)
+	if round == nil || round.Status == RoundOrphaned {
+		return false
+	}
+
+	for minerID, credit := range round.Credits {
+		// Anonymized miners were settled when their account was deleted
+		if strings.HasPrefix(minerID, anonPrefix) {
+			continue
+		}
+		rm.balances[minerID] -= credit
+	}
+
+	round.Status = RoundOrphaned
+	rm.saveState()
+	log.Printf("Round at height %d orphaned, credits reversed for %d miners", round.Height, len(round.Credits))
+	return true
+}
+
+// ReinstateRound re-applies the credits of an orphaned round whose block
+// returned to the main chain
+func (rm *RewardManager) ReinstateRound(hash string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	round := rm.findRound(hash)
+	if round == nil || round.Status != RoundOrphaned {
+		return false
+	}
+
+	for minerID, credit := range round.Credits {
+		// Anonymized miners were settled when their account was deleted
+		if strings.HasPrefix(minerID, anonPrefix) {
+			continue
+		}
+		rm.balances[minerID] += credit
+	}
+
+	round.Status = RoundPending
+	rm.saveState()
+	log.Printf("Round at height %d reinstated", round.Height)
+	return true
+}
+
+// ConfirmRounds marks pending rounds at least MaturityDepth blocks below
+// the tip as confirmed, releasing their credits for payout, and prunes the
+// oldest settled rounds
+func (rm *RewardManager) ConfirmRounds(tipHeight int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	changed := false
+	for _, round := range rm.rounds {
+		if round.Status == RoundPending && uint64(tipHeight-round.Height) >= rm.config.MaturityDepth {
+			round.Status = RoundConfirmed
+			changed = true
+			log.Printf("Round at height %d confirmed", round.Height)
+		}
+	}
+	if rm.pruneRounds() {
+		changed = true
+	}
+	if changed {
+		rm.saveState()
+	}
+}
+
+// pruneRounds drops the oldest settled rounds beyond maxSettledRounds;
+// the caller must hold rm.mu
+func (rm *RewardManager) pruneRounds() bool {
+	settled := 0
+	for _, round := range rm.rounds {
+		if round.Status != RoundPending {
+			settled++
+		}
+	}
+	if settled <= maxSettledRounds {
+		return false
+	}
+
+	excess := settled - maxSettledRounds
+	kept := make([]*RoundSnapshot, 0, len(rm.rounds)-excess)
+	for _, round := range rm.rounds {
+		if excess > 0 && round.Status != RoundPending {
+			excess--
+			continue
+		}
+		kept = append(kept, round)
+	}
+	rm.rounds = kept
+	return true
+}
+
+// immatureCredit returns a miner's credits from rounds that have not yet
+// reached maturity; the caller must hold rm.mu
+func (rm *RewardManager) immatureCredit(minerID string) blockchain.Amount {
+	var total blockchain.Amount
+	for _, round := range rm.rounds {
+		if round.Status == RoundPending {
+			total += round.Credits[minerID]
+		}
+	}
+	return total
+}
+
+// blockEntry returns the round's block as listed in the blocks API, with
+// its confirmations at a tip height and the confirmations it needs to
+// mature
+func (r *RoundSnapshot) blockEntry(tip int, required uint64) BlockEntry {
+	entry := BlockEntry{
+		Timestamp:             r.FoundAt,
+		Height:                uint64(r.Height),
+		Hash:                  r.BlockHash,
+		Status:                r.Status,
+		Finder:                r.Finder,
+		Reward:                r.Reward,
+		FinderBonus:           r.FinderBonus,
+		ConfirmationsRequired: required,
+	}
+	for _, shares := range r.Shares {
+		entry.Shares += shares
+	}
+	if r.Difficulty > 0 {
+		entry.Effort = r.Work / r.Difficulty * 100
+	}
+	switch {
+	case r.Status == RoundConfirmed:
+		entry.Confirmations = required
+	case r.Status == RoundPending && tip > r.Height:
+		entry.Confirmations = uint64(tip - r.Height)
+		if entry.Confirmations > required {
+			entry.Confirmations = required
+		}
+	}
+	return entry
+}
+
+// FoundBlocks returns a page of the blocks of the recorded rounds, most
+// recent first, and how many there are in all. An empty status lists
+// blocks of every status.
+func (rm *RewardManager) FoundBlocks(status string, offset, limit int) ([]BlockEntry, int) {
+	tip := rm.blockchain.GetHeight()
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	blocks := []BlockEntry{}
+	total := 0
+	for i := len(rm.rounds) - 1; i >= 0; i-- {
+		round := rm.rounds[i]
+		if status != "" && round.Status != status {
+			continue
+		}
+		if total >= offset && len(blocks) < limit {
+			blocks = append(blocks, round.blockEntry(tip, rm.config.MaturityDepth))
+		}
+		total++
+	}
+	return blocks, total
+}
+
+// GetRounds returns the recorded round snapshots, most recent first
+func (rm *RewardManager) GetRounds() []*RoundSnapshot {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rounds := make([]*RoundSnapshot, 0, len(rm.rounds))
+	for i := len(rm.rounds) - 1; i >= 0; i-- {
+		rounds = append(rounds, rm.rounds[i])
+	}
+	return rounds
+}
+
+// HandleChainNotification keeps round status in sync with the main chain
+func (rm *RewardManager) HandleChainNotification(n *blockchain.Notification) {
+	block, ok := n.Data.(*blockchain.Block)
+	if !ok {
+		return
+	}
+	hash := hex.EncodeToString(block.Hash[:])
+
+	switch n.Type {
+	case blockchain.NTBlockDisconnected:
+		rm.OrphanRound(hash)
+	case blockchain.NTBlockConnected:
+		rm.ReinstateRound(hash)
+		rm.ConfirmRounds(rm.blockchain.GetHeight())
+	}
+}
+
+// loadState restores persisted rounds and balances
+func (rm *RewardManager) loadState() error {
+	if rm.statePath == "" {
+		return nil
+	}
+	state := rewardState{}
+	if err := loadJSONFile(rm.statePath, &state); err != nil {
+		return err
+	}
+	rm.rounds = state.Rounds
+	rm.settledSeq = state.ShareSeq
+	if state.Balances != nil {
+		rm.balances = state.Balances
+	}
+	return nil
+}
+
+// saveState persists rounds and balances; the caller must hold rm.mu
+func (rm *RewardManager) saveState() {
+	if rm.statePath == "" {
+		return
+	}
+	state := rewardState{Rounds: rm.rounds, Balances: rm.balances, ShareSeq: rm.settledSeq}
+	if err := saveJSONFile(rm.statePath, state); err != nil {
+		log.Printf("Error saving reward state: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func newTestRewardManager(depth uint64) *RewardManager {
+	return &RewardManager{
+		config:        &RewardConfig{MaturityDepth: depth},
+		pendingShares: make(map[string]int64),
+		balances:      make(map[string]blockchain.Amount),
+	}
+}
+
+func TestConfirmRoundsReleasesMatureCredits(t *testing.T) {
+	rm := newTestRewardManager(10)
+	rm.rounds = []*RoundSnapshot{
+		{Height: 5, BlockHash: "a", Status: RoundPending, Credits: map[string]blockchain.Amount{"m1": 100}},
+		{Height: 12, BlockHash: "b", Status: RoundPending, Credits: map[string]blockchain.Amount{"m1": 40}},
+	}
+
+	tests := []struct {
+		tip      int
+		immature int64
+	}{
+		{tip: 12, immature: 140},
+		{tip: 15, immature: 40},
+		{tip: 22, immature: 0},
+	}
+	for _, tt := range tests {
+		rm.ConfirmRounds(tt.tip)
+		if got := rm.immatureCredit("m1"); int64(got) != tt.immature {
+			t.Errorf("tip %d: immature credit = %s, want %d", tt.tip, got, tt.immature)
+		}
+	}
+}
+
+func TestOrphanedRoundIsNotImmature(t *testing.T) {
+	rm := newTestRewardManager(10)
+	rm.balances["m1"] = 100
+	rm.rounds = []*RoundSnapshot{
+		{Height: 5, BlockHash: "a", Status: RoundPending, Credits: map[string]blockchain.Amount{"m1": 100}},
+	}
+
+	if !rm.OrphanRound("a") {
+		t.Fatal("OrphanRound returned false")
+	}
+	if got := rm.immatureCredit("m1"); got != 0 {
+		t.Errorf("immature credit = %s, want 0", got)
+	}
+	if got := rm.GetMinerBalance("m1"); got != 0 {
+		t.Errorf("balance = %s, want 0", got)
+	}
+}
+
+func TestPruneRoundsKeepsPending(t *testing.T) {
+	rm := newTestRewardManager(10)
+	for i := 0; i < maxSettledRounds+5; i++ {
+		rm.rounds = append(rm.rounds, &RoundSnapshot{Height: i, Status: RoundConfirmed})
+	}
+	rm.rounds = append(rm.rounds, &RoundSnapshot{Height: maxSettledRounds + 5, Status: RoundPending})
+
+	if !rm.pruneRounds() {
+		t.Fatal("pruneRounds returned false")
+	}
+	if len(rm.rounds) != maxSettledRounds+1 {
+		t.Fatalf("kept %d rounds, want %d", len(rm.rounds), maxSettledRounds+1)
+	}
+	if rm.rounds[0].Height != 5 {
+		t.Errorf("oldest kept round height = %d, want 5", rm.rounds[0].Height)
+	}
+	if last := rm.rounds[len(rm.rounds)-1]; last.Status != RoundPending {
+		t.Errorf("pending round was pruned")
+	}
+}
+
+func TestFinderBonus(t *testing.T) {
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	block, err := bc.NewBlockTemplate([]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm := newTestRewardManager(10)
+	rm.blockchain = bc
+	rm.statePath = filepath.Join(t.TempDir(), "rewards.json")
+	rm.config.PoolFee = 2
+	if err := rm.SetFinderBonus(101); err == nil {
+		t.Error("bonus over 100% accepted")
+	}
+	if err := rm.SetFinderBonus(1); err != nil {
+		t.Fatal(err)
+	}
+	rm.pendingShares["m1"] = 3
+	rm.pendingShares["m2"] = 1
+	rm.ProcessBlockReward(block, "m2")
+
+	round := rm.rounds[0]
+	reward := round.Reward
+	bonus := (reward - round.PoolFee).MulDiv(100, 10000)
+	if round.Finder != "m2" || round.FinderBonus != bonus || bonus == 0 {
+		t.Fatalf("finder %q bonus %s, want m2 and %s", round.Finder, round.FinderBonus, bonus)
+	}
+	shared := reward - round.PoolFee - bonus
+	if got, want := round.Credits["m2"], shared.MulDiv(1, 4)+bonus; got != want {
+		t.Errorf("finder credited %s, want %s", got, want)
+	}
+	if got, want := round.Credits["m1"], shared.MulDiv(3, 4); got != want {
+		t.Errorf("other miner credited %s, want %s", got, want)
+	}
+
+	blocks, _ := rm.FoundBlocks("", 0, 1)
+	entry := blocks[0]
+	if entry.Finder != "m2" || entry.FinderBonus != bonus || entry.Status != RoundPending {
+		t.Errorf("block entry = %+v", entry)
+	}
+
+	// The bonus is reversed with the rest of the round
+	rm.OrphanRound(round.BlockHash)
+	if rm.balances["m1"] != 0 || rm.balances["m2"] != 0 {
+		t.Errorf("balances after orphaning = %v", rm.balances)
+	}
+}
+
+func TestFoundBlocks(t *testing.T) {
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	for i := 0; i < 3; i++ {
+		if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rm := newTestRewardManager(2)
+	rm.blockchain = bc
+	rm.rounds = []*RoundSnapshot{
+		{Height: 1, BlockHash: "a", Status: RoundConfirmed, Shares: map[string]int64{"m1": 3, "m2": 2}},
+		{Height: 2, BlockHash: "b", Status: RoundPending, Work: 150, Difficulty: 100},
+		{Height: 3, BlockHash: "c", Status: RoundOrphaned},
+	}
+
+	tests := []struct {
+		status        string
+		offset, limit int
+		hashes        string
+		total         int
+	}{
+		{"", 0, 10, "cba", 3},
+		{"", 1, 1, "b", 3},
+		{"", 5, 10, "", 3},
+		{RoundPending, 0, 10, "b", 1},
+		{RoundConfirmed, 0, 10, "a", 1},
+	}
+	for _, tt := range tests {
+		blocks, total := rm.FoundBlocks(tt.status, tt.offset, tt.limit)
+		hashes := ""
+		for _, block := range blocks {
+			hashes += block.Hash
+		}
+		if hashes != tt.hashes || total != tt.total {
+			t.Errorf("%q %d+%d: blocks %q of %d, want %q of %d", tt.status, tt.offset, tt.limit, hashes, total, tt.hashes, tt.total)
+		}
+	}
+
+	blocks, _ := rm.FoundBlocks("", 0, 10)
+	if c := blocks[0]; c.Confirmations != 0 || c.ConfirmationsRequired != 2 {
+		t.Errorf("orphaned block %d/%d confirmations", c.Confirmations, c.ConfirmationsRequired)
+	}
+	if b := blocks[1]; b.Confirmations != 1 || b.Effort != 150 {
+		t.Errorf("pending block %d confirmations, %v%% effort", b.Confirmations, b.Effort)
+	}
+	if a := blocks[2]; a.Confirmations != 2 || a.Shares != 5 || a.Effort != 0 {
+		t.Errorf("confirmed block %d confirmations, %d shares, %v%% effort", a.Confirmations, a.Shares, a.Effort)
+	}
+}
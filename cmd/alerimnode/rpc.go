@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON-RPC error codes, following the numbering existing Bitcoin-style
+// tooling expects
+const (
+	RPCInvalidRequest      = -32600
+	RPCMethodNotFound      = -32601
+	RPCInvalidParams       = -32602
+	RPCInternalError       = -32603
+	RPCParseError          = -32700
+	RPCMiscError           = -1
+	RPCWalletError         = -4
+	RPCInvalidAddressOrKey = -5
+	RPCInsufficientFunds   = -6
+	RPCDeserializationErr  = -22
+	RPCVerifyError         = -25
+	RPCVerifyRejected      = -26
+)
+
+// RPCError is a JSON-RPC error object
+type RPCError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+// rpcErrorData carries the error code and details of an RPC error
+type rpcErrorData struct {
+	Code    ErrorCode              `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Error implements error
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// rpcErrorf creates an RPCError with a formatted message
+func rpcErrorf(code int, format string, args ...interface{}) *RPCError {
+	return &RPCError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Data:    &rpcErrorData{Code: errorCodeForRPC(code)},
+	}
+}
+
+// rpcRequest is a JSON-RPC request
+type rpcRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC response; Bitcoin-style clients expect both
+// result and error to be present
+type rpcResponse struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *RPCError   `json:"error"`
+}
+
+// RPCHandler implements one RPC method
+type RPCHandler func(params []json.RawMessage) (interface{}, error)
+
+// RPCServer dispatches JSON-RPC requests to registered methods
+type RPCServer struct {
+	mu      sync.RWMutex
+	methods map[string]RPCHandler
+}
+
+// NewRPCServer creates an RPC server with no methods
+func NewRPCServer() *RPCServer {
+	return &RPCServer{methods: make(map[string]RPCHandler)}
+}
+
+// Register adds a method to the server
+func (s *RPCServer) Register(name string, handler RPCHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = handler
+}
+
+// Methods returns the registered method names in sorted order
+func (s *RPCServer) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call runs a single request
+func (s *RPCServer) Call(method string, params []json.RawMessage) (interface{}, *RPCError) {
+	s.mu.RLock()
+	handler, ok := s.methods[method]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, rpcErrorf(RPCMethodNotFound, "Method not found: %s", method)
+	}
+
+	result, err := handler(params)
+	if err != nil {
+		if rpcErr, ok := err.(*RPCError); ok {
+			return nil, rpcErr
+		}
+		return nil, toAPIError(err, CodeFailed).RPCError()
+	}
+	return result, nil
+}
+
+// Handler serves JSON-RPC over HTTP POST
+func (s *RPCServer) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req rpcRequest
+		if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			c.JSON(http.StatusOK, rpcResponse{Error: rpcErrorf(RPCParseError, "Parse error: %v", err)})
+			return
+		}
+		if req.Method == "" {
+			c.JSON(http.StatusOK, rpcResponse{ID: req.ID, Error: rpcErrorf(RPCInvalidRequest, "Missing method")})
+			return
+		}
+
+		result, err := s.Call(req.Method, req.Params)
+		c.JSON(http.StatusOK, rpcResponse{ID: req.ID, Result: result, Error: err})
+	}
+}
+
+// RegisterRoutes adds the RPC endpoint
+func (s *RPCServer) RegisterRoutes(api *gin.RouterGroup) {
+	api.POST("/rpc", authMiddleware(ScopeRPC), s.Handler())
+}
+
+// parseParams decodes positional parameters into dst, requiring at least
+// required of them
+func parseParams(params []json.RawMessage, required int, dst ...interface{}) error {
+	if len(params) < required || len(params) > len(dst) {
+		return rpcErrorf(RPCInvalidParams, "Expected %d to %d parameters, got %d", required, len(dst), len(params))
+	}
+	for i, p := range params {
+		if string(p) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(p, dst[i]); err != nil {
+			return rpcErrorf(RPCInvalidParams, "Invalid parameter %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
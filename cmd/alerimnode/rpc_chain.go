@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// chainRPC implements the chain management RPCs
+type chainRPC struct {
+	chain *blockchain.Blockchain
+}
+
+// registerChainRPCs adds getblock, getmempoolinfo, getchainparams, and
+// invalidateblock and reconsiderblock, which let operators and integration tests force
+// reorganizations and recover from stuck forks
+func registerChainRPCs(s *RPCServer, bc *blockchain.Blockchain) {
+	r := &chainRPC{chain: bc}
+	s.Register("getblock", r.getBlock)
+	s.Register("getmempoolinfo", r.getMempoolInfo)
+	s.Register("getchainparams", r.getChainParams)
+	s.Register("invalidateblock", r.invalidateBlock)
+	s.Register("reconsiderblock", r.reconsiderBlock)
+}
+
+// blockHashParam parses the single block hash parameter of a method
+func blockHashParam(params []json.RawMessage) ([32]byte, error) {
+	var hash [32]byte
+	var hashHex string
+	if err := parseParams(params, 1, &hashHex); err != nil {
+		return hash, err
+	}
+	b, err := parseHash(hashHex)
+	if err != nil {
+		return hash, rpcErrorf(RPCInvalidParams, "Invalid block hash: %v", err)
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+// chainRPCError maps a chain error to an RPC error
+func chainRPCError(err error) error {
+	if err == blockchain.ErrUnknownBlock {
+		return rpcErrorf(RPCInvalidAddressOrKey, "Block not found")
+	}
+	return rpcErrorf(RPCMiscError, "%v", err)
+}
+
+// invalidateBlock implements invalidateblock, marking a block and its
+// descendants invalid and reorganizing away from them
+func (r *chainRPC) invalidateBlock(params []json.RawMessage) (interface{}, error) {
+	hash, err := blockHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.chain.InvalidateBlock(hash); err != nil {
+		return nil, chainRPCError(err)
+	}
+	return nil, nil
+}
+
+// reconsiderBlock implements reconsiderblock, undoing invalidateblock
+func (r *chainRPC) reconsiderBlock(params []json.RawMessage) (interface{}, error) {
+	hash, err := blockHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.chain.ReconsiderBlock(hash); err != nil {
+		return nil, chainRPCError(err)
+	}
+	return nil, nil
+}
+
+// getMempoolInfo implements getmempoolinfo, returning the mempool's size
+// and limits and the fee rate transactions need to enter it
+func (r *chainRPC) getMempoolInfo(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.chain.MempoolInfo(), nil
+}
+
+// getChainParams implements getchainparams, returning the consensus rules
+// and relay policy the node enforces
+func (r *chainRPC) getChainParams(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.chain.ChainParamsInfo(), nil
+}
+
+// getBlock implements getblock "hash", describing a main chain or side
+// branch block. Side branch blocks have -1 confirmations.
+func (r *chainRPC) getBlock(params []json.RawMessage) (interface{}, error) {
+	hash, err := blockHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.chain.GetBlockInfo(hash)
+	if err != nil {
+		return nil, chainRPCError(err)
+	}
+
+	block := info.Block
+	txids := make([]string, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		txids = append(txids, hex.EncodeToString(tx.Hash[:]))
+	}
+	confirmations := -1
+	if info.MainChain {
+		confirmations = r.chain.Height() - info.Height + 1
+	}
+
+	result := map[string]interface{}{
+		"hash":          hex.EncodeToString(block.Hash[:]),
+		"confirmations": confirmations,
+		"height":        info.Height,
+		"version":       block.Version,
+		"merkleroot":    hex.EncodeToString(block.MerkleRoot[:]),
+		"tx":            txids,
+		"time":          block.Timestamp,
+		"nonce":         block.Nonce,
+		"bits":          fmt.Sprintf("%08x", block.Bits),
+		"difficulty":    block.Difficulty().String(),
+		"chainwork":     fmt.Sprintf("%064x", info.ChainWork),
+		"size":          block.Size(),
+	}
+	if info.Height > 0 {
+		result["previousblockhash"] = hex.EncodeToString(block.PrevHash[:])
+	}
+	if info.NextHash != ([32]byte{}) {
+		result["nextblockhash"] = hex.EncodeToString(info.NextHash[:])
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestBlockHashParam(t *testing.T) {
+	hashHex := strings.Repeat("00", 31) + "ff"
+	hash, err := blockHashParam([]json.RawMessage{json.RawMessage(`"` + hashHex + `"`)})
+	if err != nil || hash[31] != 0xff {
+		t.Fatalf("blockHashParam = %x, %v", hash, err)
+	}
+
+	for _, params := range [][]json.RawMessage{
+		nil,
+		{json.RawMessage(`"abcd"`)},
+		{json.RawMessage(`"zz"`)},
+		{json.RawMessage(`1`)},
+	} {
+		_, err := blockHashParam(params)
+		if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != RPCInvalidParams {
+			t.Errorf("blockHashParam(%s) err = %v, want invalid params", params, err)
+		}
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	var tip *blockchain.Block
+	for i := 0; i < 3; i++ {
+		block, err := bc.GenerateBlock([]byte("miner"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tip = block
+	}
+	r := &chainRPC{chain: bc}
+	hashHex := hex.EncodeToString(tip.Hash[:])
+	result, err := r.getBlock([]json.RawMessage{json.RawMessage(`"` + hashHex + `"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := result.(map[string]interface{})
+	if block["hash"] != hashHex || block["height"] != 3 || block["confirmations"] != 1 {
+		t.Errorf("getblock = %v", block)
+	}
+	work, _ := bc.ChainWork(tip.Hash)
+	if block["chainwork"] != fmt.Sprintf("%064x", work) || len(block["tx"].([]string)) != 1 {
+		t.Errorf("getblock = %v", block)
+	}
+	if _, ok := block["nextblockhash"]; ok {
+		t.Error("tip has a next block hash")
+	}
+
+	_, err = r.getBlock([]json.RawMessage{json.RawMessage(`"` + strings.Repeat("00", 32) + `"`)})
+	if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != RPCInvalidAddressOrKey {
+		t.Errorf("unknown block err = %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// maxGenerateBlocks caps the blocks one generatetoaddress call mines
+const maxGenerateBlocks = 1000
+
+// generateRPC implements the block generation RPCs of test networks
+type generateRPC struct {
+	chain *blockchain.Blockchain
+}
+
+// registerGenerateRPCs adds generatetoaddress and generateblock on networks
+// that mine blocks on demand, such as regtest, so wallet and pool
+// integration tests don't wait for real mining
+func registerGenerateRPCs(s *RPCServer, bc *blockchain.Blockchain) {
+	if !bc.Params().MineBlocksOnDemand {
+		return
+	}
+	r := &generateRPC{chain: bc}
+	s.Register("generatetoaddress", r.generateToAddress)
+	s.Register("generateblock", r.generateBlock)
+}
+
+// generateRPCError maps a GenerateBlock error to an RPC error
+func generateRPCError(err error) error {
+	if err == blockchain.ErrNotInMempool {
+		return rpcErrorf(RPCInvalidAddressOrKey, "Transaction not in mempool")
+	}
+	return rpcErrorf(RPCVerifyError, "%v", err)
+}
+
+// generateToAddress implements generatetoaddress nblocks "address",
+// mining nblocks blocks with mempool transactions paying address and
+// returning their hashes
+func (r *generateRPC) generateToAddress(params []json.RawMessage) (interface{}, error) {
+	var count int
+	var address string
+	if err := parseParams(params, 2, &count, &address); err != nil {
+		return nil, err
+	}
+	if count < 0 || count > maxGenerateBlocks {
+		return nil, rpcErrorf(RPCInvalidParams, "nblocks must be between 0 and %d", maxGenerateBlocks)
+	}
+	if address == "" {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid address")
+	}
+
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		block, err := r.chain.GenerateBlock([]byte(address), nil)
+		if err != nil {
+			return nil, generateRPCError(err)
+		}
+		hashes = append(hashes, hex.EncodeToString(block.Hash[:]))
+	}
+	return hashes, nil
+}
+
+// generateBlock implements generateblock "address" ["txid",...], mining
+// one block paying address that holds exactly the listed mempool
+// transactions in order
+func (r *generateRPC) generateBlock(params []json.RawMessage) (interface{}, error) {
+	var address string
+	var txidsHex []string
+	if err := parseParams(params, 1, &address, &txidsHex); err != nil {
+		return nil, err
+	}
+	if address == "" {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid address")
+	}
+
+	txids := make([][32]byte, 0, len(txidsHex))
+	for _, s := range txidsHex {
+		txid, err := decodeHash(s)
+		if err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+		}
+		txids = append(txids, txid)
+	}
+
+	block, err := r.chain.GenerateBlock([]byte(address), txids)
+	if err != nil {
+		return nil, generateRPCError(err)
+	}
+	return map[string]interface{}{
+		"hash": hex.EncodeToString(block.Hash[:]),
+	}, nil
+}
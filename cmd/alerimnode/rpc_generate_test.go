@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestGenerateRPCParams(t *testing.T) {
+	r := &generateRPC{}
+	raw := func(values ...string) []json.RawMessage {
+		params := make([]json.RawMessage, len(values))
+		for i, v := range values {
+			params[i] = json.RawMessage(v)
+		}
+		return params
+	}
+
+	tests := []struct {
+		name   string
+		call   func([]json.RawMessage) (interface{}, error)
+		params []json.RawMessage
+		code   int
+	}{
+		{"generatetoaddress without address", r.generateToAddress, raw(`1`), RPCInvalidParams},
+		{"generatetoaddress negative count", r.generateToAddress, raw(`-1`, `"addr"`), RPCInvalidParams},
+		{"generatetoaddress too many", r.generateToAddress, raw(`1001`, `"addr"`), RPCInvalidParams},
+		{"generatetoaddress empty address", r.generateToAddress, raw(`1`, `""`), RPCInvalidAddressOrKey},
+		{"generateblock empty address", r.generateBlock, raw(`""`), RPCInvalidAddressOrKey},
+		{"generateblock bad txid", r.generateBlock, raw(`"addr"`, `["zz"]`), RPCInvalidParams},
+	}
+	for _, tt := range tests {
+		_, err := tt.call(tt.params)
+		if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != tt.code {
+			t.Errorf("%s: err = %v, want code %d", tt.name, err, tt.code)
+		}
+	}
+
+	// Zero blocks mines nothing
+	hashes, err := r.generateToAddress(raw(`0`, `"addr"`))
+	if err != nil || len(hashes.([]string)) != 0 {
+		t.Errorf("generatetoaddress 0 = %v, %v", hashes, err)
+	}
+}
+
+func TestGenerateRPCError(t *testing.T) {
+	if err := generateRPCError(blockchain.ErrNotInMempool).(*RPCError); err.Code != RPCInvalidAddressOrKey {
+		t.Errorf("not in mempool mapped to %d", err.Code)
+	}
+	if err := generateRPCError(blockchain.ErrMiningOnDemandDisabled).(*RPCError); err.Code != RPCVerifyError {
+		t.Errorf("disabled mapped to %d", err.Code)
+	}
+}
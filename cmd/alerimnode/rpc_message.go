@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// messageRPC implements signing and verifying messages with address keys
+type messageRPC struct {
+	key *ecdsa.PrivateKey
+}
+
+// registerMessageRPCs adds signmessage and verifymessage. key may be nil,
+// in which case signmessage reports that no wallet is loaded.
+func registerMessageRPCs(s *RPCServer, key *ecdsa.PrivateKey) {
+	r := &messageRPC{key: key}
+	s.Register("signmessage", r.signMessage)
+	s.Register("verifymessage", r.verifyMessage)
+}
+
+// signMessage implements signmessage "message", returning a base64
+// compact signature by the wallet key, which verifymessage checks against
+// the wallet's address
+func (r *messageRPC) signMessage(params []json.RawMessage) (interface{}, error) {
+	var message string
+	if err := parseParams(params, 1, &message); err != nil {
+		return nil, err
+	}
+	if r.key == nil {
+		return nil, rpcErrorf(RPCWalletError, "No wallet key is loaded")
+	}
+	sig, err := blockchain.SignMessage(r.key, message)
+	if err != nil {
+		return nil, rpcErrorf(RPCWalletError, "%v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// verifyMessage implements verifymessage "address" "signature" "message",
+// recovering the signer's key from the compact signature and returning
+// whether it is the address's key
+func (r *messageRPC) verifyMessage(params []json.RawMessage) (interface{}, error) {
+	var address, signature, message string
+	if err := parseParams(params, 3, &address, &signature, &message); err != nil {
+		return nil, err
+	}
+	pubKey, err := hex.DecodeString(address)
+	if err != nil || len(pubKey) != 65 || pubKey[0] != 0x04 {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Address is not a public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Malformed base64 encoding")
+	}
+	key, err := blockchain.RecoverMessageKey(message, sig)
+	if err != nil {
+		return false, nil
+	}
+	return strings.EqualFold(address, hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))), nil
+}
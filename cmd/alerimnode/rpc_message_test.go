@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestSignVerifyMessage(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherAddress := hex.EncodeToString(elliptic.Marshal(other.Curve, other.X, other.Y))
+
+	r := &messageRPC{key: key}
+	quote := func(s string) json.RawMessage { b, _ := json.Marshal(s); return b }
+	result, err := r.signMessage([]json.RawMessage{quote("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := result.(string)
+
+	tests := []struct {
+		name    string
+		address string
+		sig     string
+		message string
+		want    bool
+	}{
+		{"valid", address, sig, "hello", true},
+		{"other message", address, sig, "goodbye", false},
+		{"other address", otherAddress, sig, "hello", false},
+		{"short signature", address, "AAAA", "hello", false},
+	}
+	for _, tt := range tests {
+		got, err := r.verifyMessage([]json.RawMessage{quote(tt.address), quote(tt.sig), quote(tt.message)})
+		if err != nil || got != tt.want {
+			t.Errorf("%s: verifymessage = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, params := range [][]json.RawMessage{
+		{quote("addr1"), quote(sig), quote("hello")},
+		{quote(address), quote("not base64!"), quote("hello")},
+	} {
+		if _, err := r.verifyMessage(params); err == nil {
+			t.Errorf("verifymessage(%s) succeeded", params)
+		}
+	}
+	if _, err := (&messageRPC{}).signMessage([]json.RawMessage{quote("hello")}); err == nil {
+		t.Error("signmessage without a wallet succeeded")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+const (
+	// maxLongPollWait caps how long a getblocktemplate long poll blocks
+	maxLongPollWait = 5 * time.Minute
+
+	// longPollMempoolDelay is how long a long poll waits before returning
+	// for new mempool transactions alone; a new tip returns immediately
+	longPollMempoolDelay = time.Minute
+)
+
+// longPollTimeout returns how long a long poll may block so the response
+// is written before the API write timeout cuts the connection
+func longPollTimeout(writeTimeout time.Duration) time.Duration {
+	if writeTimeout > 0 && writeTimeout*3/4 < maxLongPollWait {
+		return writeTimeout * 3 / 4
+	}
+	return maxLongPollWait
+}
+
+// miningRPC implements getblocktemplate with long polling. A long poll ID
+// is the tip hash followed by a counter of mempool additions, so a client
+// holding an old ID can tell which of the two changed.
+type miningRPC struct {
+	chain   *blockchain.Blockchain
+	timeout time.Duration
+
+	mu    sync.Mutex
+	tip   [32]byte
+	txSeq uint64
+	tipCh chan struct{} // Closed when the tip changes
+	txCh  chan struct{} // Closed when a transaction enters the mempool
+}
+
+// registerMiningRPCs adds getblocktemplate. Long polls return after at
+// most timeout with the current template.
+func registerMiningRPCs(s *RPCServer, bc *blockchain.Blockchain, timeout time.Duration) {
+	r := &miningRPC{
+		chain:   bc,
+		timeout: timeout,
+		tip:     bc.GetLatestBlock().Hash,
+		tipCh:   make(chan struct{}),
+		txCh:    make(chan struct{}),
+	}
+	bc.Subscribe(r.handleChainNotification)
+	s.Register("getblocktemplate", r.getBlockTemplate)
+}
+
+// handleChainNotification wakes long polls on tip and mempool changes
+func (r *miningRPC) handleChainNotification(n *blockchain.Notification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		r.tip = n.Data.(*blockchain.Block).Hash
+	case blockchain.NTBlockDisconnected:
+		r.tip = n.Data.(*blockchain.Block).PrevHash
+	case blockchain.NTTxAccepted:
+		r.txSeq++
+		close(r.txCh)
+		r.txCh = make(chan struct{})
+		return
+	default:
+		return
+	}
+	close(r.tipCh)
+	r.tipCh = make(chan struct{})
+}
+
+// longPollID returns the current long poll ID; the caller must hold r.mu
+func (r *miningRPC) longPollID() string {
+	return hex.EncodeToString(r.tip[:]) + strconv.FormatUint(r.txSeq, 10)
+}
+
+// parseLongPollID splits a long poll ID into its tip and mempool counter
+func parseLongPollID(id string) ([32]byte, uint64, error) {
+	var tip [32]byte
+	if len(id) <= 2*len(tip) {
+		return tip, 0, fmt.Errorf("invalid longpollid %q", id)
+	}
+	b, err := hex.DecodeString(id[:2*len(tip)])
+	if err != nil {
+		return tip, 0, fmt.Errorf("invalid longpollid %q", id)
+	}
+	copy(tip[:], b)
+	seq, err := strconv.ParseUint(id[2*len(tip):], 10, 64)
+	if err != nil {
+		return tip, 0, fmt.Errorf("invalid longpollid %q", id)
+	}
+	return tip, seq, nil
+}
+
+// waitForChange blocks until the template has changed since the long poll
+// ID was issued: at once for a new tip, or after longPollMempoolDelay for
+// new mempool transactions. It gives up after r.timeout.
+func (r *miningRPC) waitForChange(tip [32]byte, seq uint64) {
+	start := time.Now()
+	timeout := time.NewTimer(r.timeout)
+	defer timeout.Stop()
+
+	for {
+		r.mu.Lock()
+		tipChanged, txChanged := r.tip != tip, r.txSeq != seq
+		tipCh, txCh := r.tipCh, r.txCh
+		r.mu.Unlock()
+
+		if tipChanged {
+			return
+		}
+		var mempoolWait <-chan time.Time
+		if txChanged {
+			remaining := longPollMempoolDelay - time.Since(start)
+			if remaining <= 0 {
+				return
+			}
+			mempoolWait = time.After(remaining)
+			txCh = nil
+		}
+
+		select {
+		case <-tipCh:
+		case <-txCh:
+		case <-mempoolWait:
+			return
+		case <-timeout.C:
+			return
+		}
+	}
+}
+
+// blockTemplateTx is a transaction of a getblocktemplate result
+type blockTemplateTx struct {
+	Data string `json:"data"`
+	TxID string `json:"txid"`
+}
+
+// getBlockTemplate implements getblocktemplate ( {"longpollid":"id"} ).
+// With a long poll ID the call blocks until the template changes.
+func (r *miningRPC) getBlockTemplate(params []json.RawMessage) (interface{}, error) {
+	var request struct {
+		Mode       string `json:"mode"`
+		LongPollID string `json:"longpollid"`
+	}
+	if err := parseParams(params, 0, &request); err != nil {
+		return nil, err
+	}
+	if request.Mode != "" && request.Mode != "template" {
+		return nil, rpcErrorf(RPCInvalidParams, "Invalid mode %q", request.Mode)
+	}
+
+	if request.LongPollID != "" {
+		tip, seq, err := parseLongPollID(request.LongPollID)
+		if err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+		}
+		r.waitForChange(tip, seq)
+	}
+
+	// Take the ID before building so a change in between is seen by the
+	// client's next long poll
+	r.mu.Lock()
+	longPollID := r.longPollID()
+	r.mu.Unlock()
+
+	block, err := r.chain.NewBlockTemplate(nil)
+	if err != nil {
+		return nil, rpcErrorf(RPCInternalError, "%v", err)
+	}
+
+	transactions := make([]blockTemplateTx, 0, len(block.Transactions)-1)
+	for _, tx := range block.Transactions[1:] {
+		transactions = append(transactions, blockTemplateTx{
+			Data: hex.EncodeToString(tx.Encode()),
+			TxID: hex.EncodeToString(tx.Hash[:]),
+		})
+	}
+
+	return map[string]interface{}{
+		"version":           block.Version,
+		"previousblockhash": hex.EncodeToString(block.PrevHash[:]),
+		"transactions":      transactions,
+		"coinbasevalue":     block.Transactions[0].Outputs[0].Value,
+		"target":            fmt.Sprintf("%064x", block.Target()),
+		"bits":              fmt.Sprintf("%08x", block.Bits),
+		"difficulty":        block.Difficulty().String(),
+		"curtime":           block.Timestamp,
+		"mintime":           r.chain.MedianTimePast() + 1,
+		"sizelimit":         r.chain.Params().BlockSizeLimit(),
+		"height":            r.chain.GetHeight() + 1,
+		"longpollid":        longPollID,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestParseLongPollID(t *testing.T) {
+	r := &miningRPC{tip: [32]byte{0xab, 1}, txSeq: 42}
+	tip, seq, err := parseLongPollID(r.longPollID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip != r.tip || seq != r.txSeq {
+		t.Errorf("parsed %x/%d, want %x/%d", tip, seq, r.tip, r.txSeq)
+	}
+
+	for _, id := range []string{"", "abc", r.longPollID()[:64], "zz" + r.longPollID()[2:], r.longPollID() + "x"} {
+		if _, _, err := parseLongPollID(id); err == nil {
+			t.Errorf("parseLongPollID(%q) succeeded", id)
+		}
+	}
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	tests := []struct {
+		writeTimeout time.Duration
+		want         time.Duration
+	}{
+		{0, maxLongPollWait},
+		{40 * time.Second, 30 * time.Second},
+		{time.Hour, maxLongPollWait},
+	}
+	for _, tt := range tests {
+		if got := longPollTimeout(tt.writeTimeout); got != tt.want {
+			t.Errorf("longPollTimeout(%v) = %v, want %v", tt.writeTimeout, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	newRPC := func() *miningRPC {
+		return &miningRPC{timeout: time.Minute, tipCh: make(chan struct{}), txCh: make(chan struct{})}
+	}
+
+	t.Run("new tip", func(t *testing.T) {
+		r := newRPC()
+		tip, seq := r.tip, r.txSeq
+		done := make(chan struct{})
+		go func() {
+			r.waitForChange(tip, seq)
+			close(done)
+		}()
+		r.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: &blockchain.Block{Hash: [32]byte{1}}})
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("long poll did not return on a new tip")
+		}
+	})
+
+	t.Run("mempool only", func(t *testing.T) {
+		r := newRPC()
+		tip, seq := r.tip, r.txSeq
+		done := make(chan struct{})
+		go func() {
+			r.waitForChange(tip, seq)
+			close(done)
+		}()
+		r.handleChainNotification(&blockchain.Notification{Type: blockchain.NTTxAccepted, Data: &blockchain.Transaction{}})
+		select {
+		case <-done:
+			t.Fatal("long poll returned before the mempool delay")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := newRPC()
+		r.timeout = 10 * time.Millisecond
+		r.waitForChange(r.tip, r.txSeq)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// netRPC implements the peer-to-peer network RPCs
+type netRPC struct {
+	network *blockchain.Network
+}
+
+// registerNetRPCs adds getpeerinfo, getnettotals and getblockpropagation
+func registerNetRPCs(s *RPCServer, network *blockchain.Network) {
+	r := &netRPC{network: network}
+	s.Register("getpeerinfo", r.getPeerInfo)
+	s.Register("getnettotals", r.getNetTotals)
+	s.Register("getblockpropagation", r.getBlockPropagation)
+}
+
+// getPeerInfo implements getpeerinfo, listing connected peers, with the
+// bytes sent and received by message type, and the configured peers being
+// reconnected, with their connection state
+func (r *netRPC) getPeerInfo(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.network.GetPeerInfo(), nil
+}
+
+// getNetTotals implements getnettotals, returning the bytes sent and
+// received since start and the state of the upload target
+func (r *netRPC) getNetTotals(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.network.GetNetTotals(), nil
+}
+
+// getBlockPropagation implements getblockpropagation, returning how the
+// last blocks found by the pool reached peers: how many they were sent to
+// and how long each took to acknowledge them
+func (r *netRPC) getBlockPropagation(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.network.BlockPropagation(), nil
+}
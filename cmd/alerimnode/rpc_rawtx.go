@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// signatureSize is the largest size of an input signature added when
+// signing, so fees are never underestimated
+const signatureSize = blockchain.MaxSignatureSize
+
+// parseCoinAmount parses a decimal coin amount such as "0.5" given to an
+// RPC into base units
+func parseCoinAmount(s string) (blockchain.Amount, error) {
+	amount, err := blockchain.ParseAmount(s)
+	if err != nil {
+		return 0, err
+	}
+	if amount < 0 {
+		return 0, fmt.Errorf("amount %q is negative", s)
+	}
+	return amount, nil
+}
+
+// rawTxInput is an input given to createrawtransaction
+type rawTxInput struct {
+	TxID     string  `json:"txid"`
+	Vout     uint32  `json:"vout"`
+	Sequence *uint32 `json:"sequence"`
+}
+
+// rawTxOutput is one address and amount given to createrawtransaction
+type rawTxOutput struct {
+	Address string
+	Value   uint64
+}
+
+// decodeRawTxOutputs parses the outputs object of createrawtransaction,
+// keeping the order of its keys
+func decodeRawTxOutputs(data json.RawMessage) ([]rawTxOutput, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("outputs must be an object of address to amount")
+	}
+
+	outputs := make([]rawTxOutput, 0)
+	seen := make(map[string]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		address := tok.(string)
+		if seen[address] {
+			return nil, fmt.Errorf("duplicate output address %s", address)
+		}
+		seen[address] = true
+
+		var amount json.Number
+		if err := dec.Decode(&amount); err != nil {
+			return nil, fmt.Errorf("invalid amount for %s", address)
+		}
+		value, err := parseCoinAmount(amount.String())
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, rawTxOutput{Address: address, Value: uint64(value)})
+	}
+	return outputs, nil
+}
+
+// decodeHash parses a hex transaction hash
+func decodeHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid txid %q", s)
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+// decodeRawTx parses a hex-encoded raw transaction parameter
+func decodeRawTx(s string) (*blockchain.Transaction, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, rpcErrorf(RPCDeserializationErr, "TX decode failed: %v", err)
+	}
+	tx, err := blockchain.DecodeTransaction(data)
+	if err != nil {
+		return nil, rpcErrorf(RPCDeserializationErr, "TX decode failed: %v", err)
+	}
+	return tx, nil
+}
+
+// rawTxRPC implements the raw transaction RPCs. The node wallet is the
+// pool wallet key, which owns outputs paying its public key.
+type rawTxRPC struct {
+	chain    *blockchain.Blockchain
+	network  *blockchain.Network
+	key      *ecdsa.PrivateKey
+	labels   *TxLabels       // Output comments given to sendmany
+	accounts *WalletAccounts // HD accounts fresh change addresses come from
+
+	maxSendManyOutputs int
+}
+
+// registerRawTxRPCs adds createrawtransaction, fundrawtransaction,
+// signrawtransactionwithwallet, sendrawtransaction, sendmany,
+// gettxlabels, sendvesting and getbalances. key may be nil, in which case
+// the wallet methods report that no wallet is loaded.
+func registerRawTxRPCs(s *RPCServer, bc *blockchain.Blockchain, network *blockchain.Network, key *ecdsa.PrivateKey, labels *TxLabels, accounts *WalletAccounts, maxSendManyOutputs int) {
+	r := &rawTxRPC{chain: bc, network: network, key: key, labels: labels, accounts: accounts, maxSendManyOutputs: maxSendManyOutputs}
+	s.Register("createrawtransaction", r.createRawTransaction)
+	s.Register("fundrawtransaction", r.fundRawTransaction)
+	s.Register("signrawtransactionwithwallet", r.signRawTransactionWithWallet)
+	s.Register("sendrawtransaction", r.sendRawTransaction)
+	s.Register("sendmany", r.sendMany)
+	s.Register("gettxlabels", r.getTxLabels)
+	s.Register("sendvesting", r.sendVesting)
+	s.Register("getbalances", r.getBalances)
+	s.Register("getpolicyinfo", r.getPolicyInfo)
+}
+
+// walletScript returns the output script owned by the wallet
+func (r *rawTxRPC) walletScript() ([]byte, error) {
+	if r.key == nil {
+		return nil, rpcErrorf(RPCWalletError, "No wallet key is loaded")
+	}
+	return elliptic.Marshal(r.key.Curve, r.key.X, r.key.Y), nil
+}
+
+// createRawTransaction implements createrawtransaction
+// [{"txid":"hex","vout":n},...] {"address":amount,...} ( locktime )
+func (r *rawTxRPC) createRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var inputs []rawTxInput
+	var outputsRaw json.RawMessage
+	var lockTime uint32
+	if err := parseParams(params, 2, &inputs, &outputsRaw, &lockTime); err != nil {
+		return nil, err
+	}
+
+	outputs, err := decodeRawTxOutputs(outputsRaw)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+
+	tx := &blockchain.Transaction{Version: 1, LockTime: lockTime}
+	for _, in := range inputs {
+		hash, err := decodeHash(in.TxID)
+		if err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+		}
+		sequence := uint32(0xFFFFFFFF)
+		if in.Sequence != nil {
+			sequence = *in.Sequence
+		}
+		tx.Inputs = append(tx.Inputs, blockchain.TxInput{PrevTxHash: hash, PrevTxIndex: in.Vout, Sequence: sequence})
+	}
+	for _, out := range outputs {
+		if out.Address == "" {
+			return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid address")
+		}
+		tx.Outputs = append(tx.Outputs, blockchain.TxOutput{Value: out.Value, Script: []byte(out.Address)})
+	}
+
+	return hex.EncodeToString(tx.Encode()), nil
+}
+
+// fundRawTransaction implements fundrawtransaction "hex" ( options ),
+// adding wallet inputs to cover the outputs and fee and a change output
+// back to the wallet, options.changeAddress, or the next unused change
+// address of the HD account options.changeAccount
+func (r *rawTxRPC) fundRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var rawHex string
+	var options struct {
+		ChangeAddress string      `json:"changeAddress"`
+		ChangeAccount *string     `json:"changeAccount"` // "" picks the first active account
+		FeeRate       json.Number `json:"feeRate"`       // Coins per 1000 bytes
+	}
+	if err := parseParams(params, 1, &rawHex, &options); err != nil {
+		return nil, err
+	}
+	walletScript, err := r.walletScript()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeRawTx(rawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default to the minimum relay fee so the result is accepted
+	policy := r.chain.Policy()
+	feeRate := policy.MinRelayFeeRate
+	if options.FeeRate != "" {
+		if feeRate, err = parseCoinAmount(options.FeeRate.String()); err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "Invalid feeRate: %v", err)
+		}
+	}
+	// The wallet holds a single key, so change goes back to its one
+	// address unless the caller gives another or an HD account to take a
+	// fresh one from. Change paid to an address that already holds funds
+	// links the payments, so warn.
+	changeScript := walletScript
+	var warnings []string
+	if options.ChangeAccount != nil {
+		if options.ChangeAddress != "" {
+			return nil, rpcErrorf(RPCInvalidParams, "Give changeAddress or changeAccount, not both")
+		}
+		address, err := r.accounts.NextAddress(r.chain, *options.ChangeAccount, changeChain, defaultGapLimit)
+		if err != nil {
+			return nil, rpcErrorf(RPCWalletError, "%v", err)
+		}
+		changeScript, _ = hex.DecodeString(address.Address)
+	} else if options.ChangeAddress != "" {
+		changeScript = []byte(options.ChangeAddress)
+		for _, out := range tx.Outputs {
+			if bytes.Equal(out.Script, changeScript) {
+				return nil, rpcErrorf(RPCInvalidParams, "changeAddress is also a destination")
+			}
+		}
+		if len(r.chain.FindSpendableOutputs(changeScript)) > 0 {
+			warnings = append(warnings, "changeAddress already holds unspent outputs; reusing it links these payments")
+		}
+	}
+
+	fee, changePos, err := r.fundTx(tx, walletScript, changeScript, feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"hex":       hex.EncodeToString(tx.Encode()),
+		"fee":       json.Number(blockchain.Amount(fee).String()),
+		"changepos": changePos,
+	}
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+	return result, nil
+}
+
+// fundTx adds wallet inputs to tx until they cover its outputs and the
+// fee at feeRate of the signed transaction, and a change output paying
+// changeScript unless the change is dust. It returns the fee and the
+// change output's position, or -1.
+func (r *rawTxRPC) fundTx(tx *blockchain.Transaction, walletScript, changeScript []byte, feeRate blockchain.Amount) (uint64, int, error) {
+	var outTotal, inTotal uint64
+	for _, out := range tx.Outputs {
+		outTotal += out.Value
+	}
+	used := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		prev, ok := r.chain.FindTxOutput(in.PrevTxHash, in.PrevTxIndex)
+		if !ok {
+			return 0, -1, rpcErrorf(RPCInvalidAddressOrKey, "Input %x:%d not found", in.PrevTxHash, in.PrevTxIndex)
+		}
+		inTotal += prev.Value
+		used[fmt.Sprintf("%x:%d", in.PrevTxHash, in.PrevTxIndex)] = true
+	}
+
+	// Add wallet outputs until the inputs cover the outputs and the fee of
+	// the signed transaction including a change output
+	estimateFee := func() uint64 {
+		size := len(tx.Encode()) + signatureSize*len(tx.Inputs) + 8 + 4 + len(changeScript)
+		return uint64(feeRate.MulDiv(int64(size), 1000))
+	}
+	candidates := r.chain.FindSpendableOutputs(walletScript)
+	fee := estimateFee()
+	for inTotal < outTotal+fee {
+		if len(candidates) == 0 {
+			return 0, -1, rpcErrorf(RPCInsufficientFunds, "Insufficient funds")
+		}
+		c := candidates[0]
+		candidates = candidates[1:]
+		if used[fmt.Sprintf("%x:%d", c.TxHash, c.Index)] {
+			continue
+		}
+		tx.Inputs = append(tx.Inputs, blockchain.TxInput{PrevTxHash: c.TxHash, PrevTxIndex: c.Index, Sequence: 0xFFFFFFFF})
+		inTotal += c.Value
+		fee = estimateFee()
+	}
+
+	// Change below the dust threshold goes to the fee
+	policy := r.chain.Policy()
+	changePos := -1
+	if change := inTotal - outTotal - fee; change > 0 && blockchain.Amount(change) >= policy.DustThreshold {
+		tx.Outputs = append(tx.Outputs, blockchain.TxOutput{Value: change, Script: changeScript})
+		changePos = len(tx.Outputs) - 1
+	} else {
+		fee += change
+	}
+
+	return fee, changePos, nil
+}
+
+// signRawTransactionWithWallet implements signrawtransactionwithwallet
+// "hex". The transaction is signed only when the wallet owns every input,
+// paid to its key or its key hash, directly or once its time lock passes.
+func (r *rawTxRPC) signRawTransactionWithWallet(params []json.RawMessage) (interface{}, error) {
+	var rawHex string
+	if err := parseParams(params, 1, &rawHex); err != nil {
+		return nil, err
+	}
+	walletScript, err := r.walletScript()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeRawTx(rawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	keyHashScript := blockchain.NewPubKeyHashScript(&r.key.PublicKey)
+	prevScripts := make([][]byte, len(tx.Inputs))
+	inputErrors := make([]map[string]interface{}, 0)
+	for i, in := range tx.Inputs {
+		prev, ok := r.chain.FindTxOutput(in.PrevTxHash, in.PrevTxIndex)
+		reason := ""
+		if !ok {
+			reason = "Input not found or already spent"
+		} else if script := unlockedScript(prev.Script); !bytes.Equal(script, walletScript) && !bytes.Equal(script, keyHashScript) {
+			reason = "Input not owned by the wallet"
+		}
+		prevScripts[i] = prev.Script
+		if reason != "" {
+			inputErrors = append(inputErrors, map[string]interface{}{
+				"txid":  hex.EncodeToString(in.PrevTxHash[:]),
+				"vout":  in.PrevTxIndex,
+				"error": reason,
+			})
+		}
+	}
+
+	if len(inputErrors) > 0 {
+		return map[string]interface{}{
+			"hex":      rawHex,
+			"complete": false,
+			"errors":   inputErrors,
+		}, nil
+	}
+
+	signer := blockchain.KeySigner{Key: r.key}
+	for i := range tx.Inputs {
+		if err := tx.SignInput(i, prevScripts[i], nil, signer); err != nil {
+			return nil, rpcErrorf(RPCWalletError, "Signing failed: %v", err)
+		}
+	}
+	return map[string]interface{}{
+		"hex":      hex.EncodeToString(tx.Encode()),
+		"complete": true,
+	}, nil
+}
+
+// sendRawTransaction implements sendrawtransaction "hex", submitting the
+// transaction to the mempool and relaying it
+func (r *rawTxRPC) sendRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var rawHex string
+	if err := parseParams(params, 1, &rawHex); err != nil {
+		return nil, err
+	}
+	tx, err := decodeRawTx(rawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.chain.AddTransaction(tx); err != nil {
+		if _, ok := err.(*blockchain.PolicyError); ok {
+			return nil, rpcErrorf(RPCVerifyRejected, "%v", err)
+		}
+		return nil, rpcErrorf(RPCVerifyError, "%v", err)
+	}
+	r.network.BroadcastTransaction(tx)
+	return hex.EncodeToString(tx.Hash[:]), nil
+}
+
+// getPolicyInfo implements getpolicyinfo, returning the relay policy
+func (r *rawTxRPC) getPolicyInfo(params []json.RawMessage) (interface{}, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return r.chain.Policy(), nil
+}
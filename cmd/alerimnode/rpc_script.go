@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// registerScriptRPCs adds createmultisig and decodescript
+func registerScriptRPCs(s *RPCServer) {
+	s.Register("createmultisig", createMultiSig)
+	s.Register("decodescript", decodeScript)
+}
+
+// createMultiSig implements createmultisig nrequired ["pubkey",...],
+// returning the m-of-n multisig redeem script of the hex public keys and
+// the address paying it: the hex scripthash script, spent with
+// signatures by nrequired of the keys and the redeem script
+func createMultiSig(params []json.RawMessage) (interface{}, error) {
+	var required int
+	var pubKeys []string
+	if err := parseParams(params, 2, &required, &pubKeys); err != nil {
+		return nil, err
+	}
+	keys := make([]*ecdsa.PublicKey, len(pubKeys))
+	for i, pubKey := range pubKeys {
+		data, err := hex.DecodeString(pubKey)
+		if err == nil {
+			keys[i] = blockchain.ParsePubKey(data)
+		}
+		if keys[i] == nil {
+			return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid public key: %s", pubKey)
+		}
+	}
+	redeemScript, err := blockchain.NewMultiSigScript(required, keys)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	return map[string]interface{}{
+		"address":      hex.EncodeToString(blockchain.NewScriptHashScript(redeemScript)),
+		"redeemScript": hex.EncodeToString(redeemScript),
+	}, nil
+}
+
+// decodeScript implements decodescript "hex", describing an output or
+// redeem script
+func decodeScript(params []json.RawMessage) (interface{}, error) {
+	var scriptHex string
+	if err := parseParams(params, 1, &scriptHex); err != nil {
+		return nil, err
+	}
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil {
+		return nil, rpcErrorf(RPCDeserializationErr, "Script decode failed")
+	}
+	return blockchain.DescribeScript(script), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestCreateMultiSig(t *testing.T) {
+	var pubKeys []string
+	for i := 0; i < 3; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeys = append(pubKeys, hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)))
+	}
+	keysJSON, _ := json.Marshal(pubKeys)
+	result, err := createMultiSig([]json.RawMessage{json.RawMessage("2"), keysJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := result.(map[string]interface{})
+
+	quote := func(s string) json.RawMessage { b, _ := json.Marshal(s); return b }
+	result, err = decodeScript([]json.RawMessage{quote(created["redeemScript"].(string))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := result.(blockchain.ScriptInfo)
+	if info.Class != "multisig" || info.RequiredSigs != 2 || len(info.PubKeys) != 3 || info.P2SH != created["address"] {
+		t.Errorf("decodescript = %+v, want a 2-of-3 multisig paid by %s", info, created["address"])
+	}
+	script, _ := hex.DecodeString(created["address"].(string))
+	if blockchain.ClassifyScript(addressScript(created["address"].(string))) != blockchain.ScriptHashScript ||
+		blockchain.ClassifyScript(script) != blockchain.ScriptHashScript {
+		t.Errorf("address %s is not a scripthash script", created["address"])
+	}
+
+	for _, params := range [][]json.RawMessage{
+		{json.RawMessage("4"), keysJSON},
+		{json.RawMessage("0"), keysJSON},
+		{json.RawMessage("1"), json.RawMessage(`["04abcd"]`)},
+		{json.RawMessage("1"), json.RawMessage(`[]`)},
+	} {
+		if _, err := createMultiSig(params); err == nil {
+			t.Errorf("createmultisig(%s) succeeded", params)
+		}
+	}
+	if _, err := decodeScript([]json.RawMessage{quote("zz")}); err == nil {
+		t.Error("decodescript of bad hex succeeded")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// defaultSendManyMaxOutputs is how many outputs sendmany accepts unless
+// -sendmanymaxoutputs says otherwise
+const defaultSendManyMaxOutputs = 500
+
+// OutputLabel is the comment given to one output of a wallet transaction
+type OutputLabel struct {
+	Vout    uint32 `json:"vout"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+}
+
+// TxLabels keeps the output comments of transactions sent by the wallet,
+// so exchange withdrawals and refunds can be matched to their requests
+type TxLabels struct {
+	mu     sync.RWMutex
+	path   string
+	labels map[string][]OutputLabel // Hex txid -> labeled outputs
+}
+
+// NewTxLabels loads the labels persisted at path
+func NewTxLabels(path string) (*TxLabels, error) {
+	l := &TxLabels{path: path, labels: make(map[string][]OutputLabel)}
+	if err := loadJSONFile(path, &l.labels); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Set records the labeled outputs of a transaction
+func (l *TxLabels) Set(txid string, labels []OutputLabel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.labels[txid] = labels
+	if l.path == "" {
+		return
+	}
+	if err := saveJSONFile(l.path, l.labels); err != nil {
+		log.Printf("Error saving transaction labels: %v", err)
+	}
+}
+
+// Get returns the labeled outputs of a transaction
+func (l *TxLabels) Get(txid string) []OutputLabel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.labels[txid]
+}
+
+// sendMany implements sendmany {"address":amount,...} ( {"address":
+// "comment",...} ) ( options ), paying every address from the wallet in
+// one transaction with change back to the wallet. options.feeRate sets the
+// fee rate and options.dryRun returns the fee without sending.
+func (r *rawTxRPC) sendMany(params []json.RawMessage) (interface{}, error) {
+	var outputsRaw json.RawMessage
+	var comments map[string]string
+	var options struct {
+		FeeRate json.Number `json:"feeRate"` // Coins per 1000 bytes
+		DryRun  bool        `json:"dryRun"`
+	}
+	if err := parseParams(params, 1, &outputsRaw, &comments, &options); err != nil {
+		return nil, err
+	}
+	walletScript, err := r.walletScript()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := decodeRawTxOutputs(outputsRaw)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	if len(outputs) == 0 {
+		return nil, rpcErrorf(RPCInvalidParams, "No outputs")
+	}
+	if len(outputs) > r.maxSendManyOutputs {
+		return nil, rpcErrorf(RPCInvalidParams, "Too many outputs: %d, at most %d", len(outputs), r.maxSendManyOutputs)
+	}
+	policy := r.chain.Policy()
+	tx := &blockchain.Transaction{Version: 1}
+	paid := make(map[string]bool)
+	for _, out := range outputs {
+		if out.Address == "" {
+			return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid address")
+		}
+		if blockchain.Amount(out.Value) < policy.DustThreshold {
+			return nil, rpcErrorf(RPCInvalidParams, "Amount for %s is below the dust threshold", out.Address)
+		}
+		paid[out.Address] = true
+		tx.Outputs = append(tx.Outputs, blockchain.TxOutput{Value: out.Value, Script: []byte(out.Address)})
+	}
+	for address := range comments {
+		if !paid[address] {
+			return nil, rpcErrorf(RPCInvalidParams, "Comment for %s, which is not paid", address)
+		}
+	}
+
+	feeRate := policy.MinRelayFeeRate
+	if options.FeeRate != "" {
+		if feeRate, err = parseCoinAmount(options.FeeRate.String()); err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "Invalid feeRate: %v", err)
+		}
+	}
+	fee, changePos, err := r.fundTx(tx, walletScript, walletScript, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Sign(r.key); err != nil {
+		return nil, rpcErrorf(RPCWalletError, "Signing failed: %v", err)
+	}
+	size := len(tx.Encode())
+	if size > policy.MaxStandardTxSize {
+		return nil, rpcErrorf(RPCWalletError, "Transaction of %d bytes exceeds the %d byte limit; send fewer outputs", size, policy.MaxStandardTxSize)
+	}
+
+	result := map[string]interface{}{
+		"fee":       json.Number(blockchain.Amount(fee).String()),
+		"size":      size,
+		"changepos": changePos,
+	}
+	if options.DryRun {
+		return result, nil
+	}
+
+	if err := r.chain.AddTransaction(tx); err != nil {
+		return nil, rpcErrorf(RPCWalletError, "Transaction rejected: %v", err)
+	}
+	r.network.BroadcastTransaction(tx)
+	txid := hex.EncodeToString(tx.Hash[:])
+	if len(comments) > 0 {
+		var labels []OutputLabel
+		for i, out := range outputs {
+			if comment, ok := comments[out.Address]; ok {
+				labels = append(labels, OutputLabel{Vout: uint32(i), Address: out.Address, Label: comment})
+			}
+		}
+		r.labels.Set(txid, labels)
+	}
+	result["txid"] = txid
+	return result, nil
+}
+
+// getTxLabels implements gettxlabels "txid", returning the output comments
+// given to sendmany
+func (r *rawTxRPC) getTxLabels(params []json.RawMessage) (interface{}, error) {
+	var txid string
+	if err := parseParams(params, 1, &txid); err != nil {
+		return nil, err
+	}
+	hash, err := decodeHash(txid)
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "%v", err)
+	}
+	labels := r.labels.Get(hex.EncodeToString(hash[:]))
+	if labels == nil {
+		labels = []OutputLabel{}
+	}
+	return labels, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestSendMany(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	walletScript := elliptic.Marshal(key.Curve, key.X, key.Y)
+	for i := 0; i < 2; i++ {
+		if _, err := bc.GenerateBlock(walletScript, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "labels.json")
+	labels, err := NewTxLabels(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &rawTxRPC{chain: bc, network: &blockchain.Network{}, key: key, labels: labels, maxSendManyOutputs: 3}
+
+	outputs := json.RawMessage(`{"alice":0.005,"bob":0.0025,"carol":0.001}`)
+	comments := json.RawMessage(`{"alice":"withdrawal 17","carol":"refund 4"}`)
+	result, err := r.sendMany([]json.RawMessage{outputs, comments, json.RawMessage(`{"dryRun":true}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := result.(map[string]interface{})
+	if _, sent := preview["txid"]; sent || bc.MempoolSize() != 0 {
+		t.Fatalf("dry run sent the transaction: %v", preview)
+	}
+
+	result, err = r.sendMany([]json.RawMessage{outputs, comments})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := result.(map[string]interface{})
+	if bc.MempoolSize() != 1 || sent["fee"] != preview["fee"] || sent["changepos"] != 3 {
+		t.Errorf("sendmany = %v, preview %v", sent, preview)
+	}
+	txid := sent["txid"].(string)
+	hash, _ := decodeHash(txid)
+	tx, _, err := bc.GetTransaction(hash)
+	if err != nil || len(tx.Outputs) != 4 || string(tx.Outputs[1].Script) != "bob" || tx.Outputs[1].Value != uint64(blockchain.Coin/400) {
+		t.Fatalf("sent transaction = %+v, %v", tx, err)
+	}
+
+	// Labels are kept across restarts
+	reloaded, err := NewTxLabels(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reloaded.Get(txid)
+	if len(got) != 2 || got[0] != (OutputLabel{0, "alice", "withdrawal 17"}) || got[1] != (OutputLabel{2, "carol", "refund 4"}) {
+		t.Errorf("labels = %+v", got)
+	}
+	if listed, err := r.getTxLabels([]json.RawMessage{json.RawMessage(`"` + txid + `"`)}); err != nil || len(listed.([]OutputLabel)) != 2 {
+		t.Errorf("gettxlabels = %v, %v", listed, err)
+	}
+
+	for name, params := range map[string][]json.RawMessage{
+		"too many outputs": {json.RawMessage(`{"a":1,"b":1,"c":1,"d":1}`)},
+		"no outputs":       {json.RawMessage(`{}`)},
+		"dust":             {json.RawMessage(`{"alice":0.00000001}`)},
+		"unpaid comment":   {json.RawMessage(`{"alice":1}`), json.RawMessage(`{"bob":"x"}`)},
+		"too much":         {json.RawMessage(`{"alice":100000000}`)},
+	} {
+		if _, err := r.sendMany(params); err == nil {
+			t.Errorf("%s: sendmany succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestParseCoinAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    blockchain.Amount
+		wantErr bool
+	}{
+		{"1", 100000000, false},
+		{"0.5", 50000000, false},
+		{"1.", 100000000, false},
+		{".00000001", 1, false},
+		{"999999.12345678", 99999912345678, false},
+		{"21000000", 0, true},
+		{"0.000000001", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"1e3", 0, true},
+		{"184467440737.09551616", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCoinAmount(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCoinAmount(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeRawTxOutputsKeepsOrder(t *testing.T) {
+	outputs, err := decodeRawTxOutputs(json.RawMessage(`{"zeta": 1.5, "alpha": 0.25}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 || outputs[0].Address != "zeta" || outputs[1].Address != "alpha" {
+		t.Fatalf("unexpected outputs %+v", outputs)
+	}
+	if outputs[0].Value != 150000000 || outputs[1].Value != 25000000 {
+		t.Errorf("unexpected values %+v", outputs)
+	}
+
+	if _, err := decodeRawTxOutputs(json.RawMessage(`{"a": 1, "a": 2}`)); err == nil {
+		t.Error("expected an error for duplicate addresses")
+	}
+	if _, err := decodeRawTxOutputs(json.RawMessage(`[]`)); err == nil {
+		t.Error("expected an error for a non-object")
+	}
+}
+
+func TestRPCServerCall(t *testing.T) {
+	s := NewRPCServer()
+	s.Register("echo", func(params []json.RawMessage) (interface{}, error) {
+		var msg string
+		if err := parseParams(params, 1, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	})
+
+	if result, err := s.Call("echo", []json.RawMessage{json.RawMessage(`"hi"`)}); err != nil || result != "hi" {
+		t.Errorf("echo = %v, %v", result, err)
+	}
+	if _, err := s.Call("echo", nil); err == nil || err.Code != RPCInvalidParams {
+		t.Errorf("missing params error = %v", err)
+	}
+	if _, err := s.Call("nope", nil); err == nil || err.Code != RPCMethodNotFound {
+		t.Errorf("unknown method error = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+// unlockedScript returns the script a time-locked output pays once its
+// lock passes, or script itself if it isn't locked
+func unlockedScript(script []byte) []byte {
+	if _, inner, ok := blockchain.ParseTimeLockScript(script); ok {
+		return inner
+	}
+	return script
+}
+
+// sendVesting implements sendvesting "address" amount locktime ( options ),
+// paying amount from the wallet to an output of address that can't be
+// spent until locktime: a block height below 500000000, a unix time from
+// it on. The output can be spent from the first block after the lock, by a
+// transaction with at least that lock time and an input sequence below
+// 0xffffffff. options.feeRate sets the fee rate.
+func (r *rawTxRPC) sendVesting(params []json.RawMessage) (interface{}, error) {
+	var address string
+	var amount json.Number
+	var lockTime uint32
+	var options struct {
+		FeeRate json.Number `json:"feeRate"` // Coins per 1000 bytes
+	}
+	if err := parseParams(params, 3, &address, &amount, &lockTime, &options); err != nil {
+		return nil, err
+	}
+	walletScript, err := r.walletScript()
+	if err != nil {
+		return nil, err
+	}
+	if address == "" {
+		return nil, rpcErrorf(RPCInvalidAddressOrKey, "Invalid address")
+	}
+	value, err := parseCoinAmount(amount.String())
+	if err != nil {
+		return nil, rpcErrorf(RPCInvalidParams, "Invalid amount: %v", err)
+	}
+	policy := r.chain.Policy()
+	if value < policy.DustThreshold {
+		return nil, rpcErrorf(RPCInvalidParams, "Amount is below the dust threshold")
+	}
+	unlocked := blockchain.NewTransaction([]blockchain.TxInput{{Sequence: 0}}, nil)
+	unlocked.LockTime = lockTime
+	if lockTime == 0 || unlocked.IsFinal(r.chain.GetHeight()+1, r.chain.TimeSource().AdjustedTime().Unix()) {
+		return nil, rpcErrorf(RPCInvalidParams, "Lock time %d has already passed", lockTime)
+	}
+
+	script := blockchain.NewTimeLockScript(lockTime, addressScript(address))
+	tx := &blockchain.Transaction{Version: 1}
+	tx.Outputs = append(tx.Outputs, blockchain.TxOutput{Value: uint64(value), Script: script})
+	feeRate := policy.MinRelayFeeRate
+	if options.FeeRate != "" {
+		if feeRate, err = parseCoinAmount(options.FeeRate.String()); err != nil {
+			return nil, rpcErrorf(RPCInvalidParams, "Invalid feeRate: %v", err)
+		}
+	}
+	fee, _, err := r.fundTx(tx, walletScript, walletScript, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Sign(r.key); err != nil {
+		return nil, rpcErrorf(RPCWalletError, "Signing failed: %v", err)
+	}
+	if err := r.chain.AddTransaction(tx); err != nil {
+		return nil, rpcErrorf(RPCWalletError, "Transaction rejected: %v", err)
+	}
+	r.network.BroadcastTransaction(tx)
+
+	return map[string]interface{}{
+		"txid":     hex.EncodeToString(tx.Hash[:]),
+		"vout":     0,
+		"address":  hex.EncodeToString(script),
+		"locktime": lockTime,
+		"fee":      json.Number(blockchain.Amount(fee).String()),
+	}, nil
+}
+
+// getBalances implements getbalances ( "address" ), splitting the
+// confirmed balance of address, or of the wallet, between what can be
+// spent in the next block and what is still time-locked
+func (r *rawTxRPC) getBalances(params []json.RawMessage) (interface{}, error) {
+	var address string
+	if err := parseParams(params, 0, &address); err != nil {
+		return nil, err
+	}
+	var script []byte
+	if address == "" {
+		walletScript, err := r.walletScript()
+		if err != nil {
+			return nil, err
+		}
+		script = walletScript
+	} else {
+		script = addressScript(address)
+	}
+
+	balances := r.chain.GetBalances(script)
+	outputs := make([]map[string]interface{}, 0, len(balances.Outputs))
+	for _, out := range balances.Outputs {
+		outputs = append(outputs, map[string]interface{}{
+			"txid":     hex.EncodeToString(out.TxHash[:]),
+			"vout":     out.Index,
+			"amount":   json.Number(blockchain.Amount(out.Output.Value).String()),
+			"height":   out.Height,
+			"locktime": out.LockTime,
+			"locked":   out.Locked,
+		})
+	}
+	return map[string]interface{}{
+		"spendable":   json.Number(blockchain.Amount(balances.Spendable).String()),
+		"locked":      json.Number(blockchain.Amount(balances.Locked).String()),
+		"time_locked": outputs,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestSendVesting(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	walletScript := elliptic.Marshal(key.Curve, key.X, key.Y)
+	if _, err := bc.GenerateBlock(walletScript, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := &rawTxRPC{chain: bc, network: &blockchain.Network{}, key: key}
+	wallet := json.RawMessage(fmt.Sprintf("%q", hex.EncodeToString(walletScript)))
+
+	if _, err := r.sendVesting([]json.RawMessage{wallet, json.RawMessage("0.005"), json.RawMessage("1")}); err == nil {
+		t.Error("vesting locked to a passed height accepted")
+	}
+	// Locked until height 3, spendable from block 4
+	result, err := r.sendVesting([]json.RawMessage{wallet, json.RawMessage("0.005"), json.RawMessage("3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txid := result.(map[string]interface{})["txid"].(string)
+	if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	balances := func() map[string]interface{} {
+		result, err := r.getBalances(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.(map[string]interface{})
+	}
+	if b := balances(); b["locked"] != json.Number("0.005") || len(b["time_locked"].([]map[string]interface{})) != 1 {
+		t.Errorf("balances at height 2 = %v", b)
+	}
+
+	raw, err := r.createRawTransaction([]json.RawMessage{
+		json.RawMessage(fmt.Sprintf(`[{"txid":%q,"vout":0,"sequence":0}]`, txid)),
+		json.RawMessage(`{"payee":0.004}`),
+		json.RawMessage("3"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = r.signRawTransactionWithWallet([]json.RawMessage{json.RawMessage(fmt.Sprintf("%q", raw))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := result.(map[string]interface{})
+	if signed["complete"] != true {
+		t.Fatalf("vesting output not signed: %v", signed)
+	}
+	spend := json.RawMessage(fmt.Sprintf("%q", signed["hex"]))
+	if _, err := r.sendRawTransaction([]json.RawMessage{spend}); err == nil {
+		t.Error("spend of a locked output accepted")
+	}
+
+	if _, err := bc.GenerateBlock([]byte("miner"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if b := balances(); b["locked"] != json.Number("0") {
+		t.Errorf("balances at height 3 = %v", b)
+	}
+	if _, err := r.sendRawTransaction([]json.RawMessage{spend}); err != nil {
+		t.Errorf("spend after the lock rejected: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Names of the secrets loaded at startup
+const (
+	SecretPoolWalletKey = "pool-wallet-key"
+	SecretKYCWebhookKey = "kyc-webhook-key"
+	SecretExchangeKey   = "exchange-webhook-key"
+	SecretMinerTokenKey = "miner-token-key"
+	SecretRedisPassword = "redis-password"
+)
+
+// ErrSecretNotFound is returned when a provider has no value for a secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider loads named secrets from a backing store
+type SecretProvider interface {
+	GetSecret(name string) ([]byte, error)
+}
+
+// EnvSecretProvider reads secrets injected into the environment, e.g.
+// pool-wallet-key from ALERIM_SECRET_POOL_WALLET_KEY
+type EnvSecretProvider struct{}
+
+// GetSecret implements SecretProvider
+func (EnvSecretProvider) GetSecret(name string) ([]byte, error) {
+	env := envPrefix + "SECRET_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(value), nil
+}
+
+// FileSecretProvider reads secrets from passphrase-encrypted files named
+// <dir>/<name>.enc
+type FileSecretProvider struct {
+	Dir        string
+	Passphrase string
+}
+
+// GetSecret implements SecretProvider
+func (p *FileSecretProvider) GetSecret(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name+".enc"))
+	if os.IsNotExist(err) {
+		return nil, ErrSecretNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return DecryptSecret(p.Passphrase, data)
+}
+
+// CommandSecretProvider fetches secrets from an external KMS or Vault by
+// running a command; %s in the command is replaced by the secret name and
+// the secret is read from its standard output
+type CommandSecretProvider struct {
+	Command string
+}
+
+// GetSecret implements SecretProvider
+func (p *CommandSecretProvider) GetSecret(name string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", strings.ReplaceAll(p.Command, "%s", name))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("secret command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := bytes.TrimSpace(stdout.Bytes())
+	if len(secret) == 0 {
+		return nil, ErrSecretNotFound
+	}
+	return secret, nil
+}
+
+// NewSecretProvider creates the provider selected by kind
+func NewSecretProvider(kind, dir, passphrase, command string) (SecretProvider, error) {
+	switch kind {
+	case "env":
+		return EnvSecretProvider{}, nil
+	case "file":
+		if passphrase == "" {
+			return nil, errors.New("file secrets provider requires a passphrase")
+		}
+		return &FileSecretProvider{Dir: dir, Passphrase: passphrase}, nil
+	case "command":
+		if command == "" {
+			return nil, errors.New("command secrets provider requires a command")
+		}
+		return &CommandSecretProvider{Command: command}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider: %s", kind)
+	}
+}
+
+// EncryptSecret encrypts a secret with a passphrase-derived key using
+// scrypt and AES-256-GCM. The output is salt || nonce || ciphertext.
+func EncryptSecret(passphrase string, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := secretCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(salt, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(passphrase string, data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("encrypted secret too short")
+	}
+
+	gcm, err := secretCipher(passphrase, data[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[16:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted secret too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secret: wrong passphrase or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// secretCipher derives the AES-GCM cipher for a passphrase and salt
+func secretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// parsePrivateKey parses a hex-encoded P-256 private key scalar
+func parsePrivateKey(secret []byte) (*ecdsa.PrivateKey, error) {
+	d, err := hex.DecodeString(strings.TrimSpace(string(secret)))
+	if err != nil {
+		return nil, fmt.Errorf("private key is not valid hex: %v", err)
+	}
+
+	curve := elliptic.P256()
+	key := new(ecdsa.PrivateKey)
+	key.Curve = curve
+	key.D = new(big.Int).SetBytes(d)
+	if key.D.Sign() <= 0 || key.D.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key out of range")
+	}
+	key.X, key.Y = curve.ScalarBaseMult(d)
+	return key, nil
+}
+
+// runEncryptSecret implements the encrypt-secret subcommand, which reads
+// a secret from stdin and writes it encrypted to <dir>/<name>.enc
+func runEncryptSecret(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: alerimnode encrypt-secret <dir> <name>  (passphrase from ALERIM_SECRETS_PASSPHRASE)")
+	}
+
+	passphrase := os.Getenv(envPrefix + "SECRETS_PASSPHRASE")
+	if passphrase == "" {
+		return errors.New("ALERIM_SECRETS_PASSPHRASE is not set")
+	}
+
+	plaintext, err := readAllStdin()
+	if err != nil {
+		return err
+	}
+
+	data, err := EncryptSecret(passphrase, bytes.TrimSpace(plaintext))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(args[0], 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(args[0], args[1]+".enc"), data, 0600)
+}
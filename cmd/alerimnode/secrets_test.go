@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptDecryptSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string
+		plaintext  []byte
+	}{
+		{"hex key", "correct horse battery staple", []byte("3f8a9c2e1b7d4f6a0c5e8b2d9f1a3c7e5b0d2f4a6c8e1b3d5f7a9c0e2b4d6f8a")},
+		{"empty secret", "passphrase", []byte{}},
+		{"binary secret", "p", []byte{0, 1, 2, 255, 254}},
+	}
+
+	for _, test := range tests {
+		encrypted, err := EncryptSecret(test.passphrase, test.plaintext)
+		if err != nil {
+			t.Fatalf("%s: EncryptSecret: %v", test.name, err)
+		}
+		if len(test.plaintext) > 0 && bytes.Contains(encrypted, test.plaintext) {
+			t.Errorf("%s: ciphertext contains the plaintext", test.name)
+		}
+
+		decrypted, err := DecryptSecret(test.passphrase, encrypted)
+		if err != nil {
+			t.Fatalf("%s: DecryptSecret: %v", test.name, err)
+		}
+		if !bytes.Equal(decrypted, test.plaintext) {
+			t.Errorf("%s: round trip = %x, want %x", test.name, decrypted, test.plaintext)
+		}
+
+		if _, err := DecryptSecret(test.passphrase+"x", encrypted); err == nil {
+			t.Errorf("%s: decrypting with the wrong passphrase succeeded", test.name)
+		}
+	}
+}
+
+func TestDecryptSecretRejectsTampering(t *testing.T) {
+	encrypted, err := EncryptSecret("passphrase", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"salt only", encrypted[:16]},
+		{"truncated nonce", encrypted[:20]},
+		{"truncated ciphertext", encrypted[:len(encrypted)-1]},
+		{"flipped ciphertext bit", flipLastBit(encrypted)},
+	}
+
+	for _, test := range tests {
+		if _, err := DecryptSecret("passphrase", test.data); err == nil {
+			t.Errorf("%s: DecryptSecret succeeded", test.name)
+		}
+	}
+}
+
+func TestEncryptSecretUsesFreshSalt(t *testing.T) {
+	a, err := EncryptSecret("passphrase", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncryptSecret("passphrase", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("encrypting twice produced identical output")
+	}
+}
+
+func flipLastBit(data []byte) []byte {
+	out := append([]byte(nil), data...)
+	out[len(out)-1] ^= 1
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// nodeService ties the node's lifecycle to the init system running it:
+// the PID file, readiness and reload notifications to systemd, SIGHUP
+// reloads, and the Windows service manager (see service_windows.go)
+type nodeService struct {
+	pidFile  string
+	stop     chan struct{} // Closed when the service manager stops the node
+	platform platformService
+}
+
+// platformService reports the node's state to an OS-specific service
+// manager
+type platformService interface {
+	running() // The node has started
+	exited()  // The node has shut down
+}
+
+// noPlatformService is used when no OS-specific service manager runs the
+// node
+type noPlatformService struct{}
+
+func (noPlatformService) running() {}
+func (noPlatformService) exited()  {}
+
+// startService writes the PID file, if any, and connects to the service
+// manager running the node
+func startService(pidFile string) (*nodeService, error) {
+	s := &nodeService{pidFile: pidFile, stop: make(chan struct{})}
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write PID file: %v", err)
+		}
+	}
+	platform, err := startPlatformService(s.stop)
+	if err != nil {
+		s.removePIDFile()
+		return nil, err
+	}
+	s.platform = platform
+	return s, nil
+}
+
+// Ready reports that the node has started
+func (s *nodeService) Ready() {
+	s.notify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+	s.platform.running()
+}
+
+// Wait blocks until the node is asked to stop, by SIGINT, SIGTERM or the
+// service manager, calling reload on every SIGHUP
+func (s *nodeService) Wait(reload func() error) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				return
+			}
+			s.notify("RELOADING=1")
+			if err := reload(); err != nil {
+				log.Printf("Failed to reload configuration: %v", err)
+			}
+			s.notify("READY=1")
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stopping reports that the node is shutting down
+func (s *nodeService) Stopping() {
+	s.notify("STOPPING=1")
+}
+
+// Stopped removes the PID file and reports that the node has shut down
+func (s *nodeService) Stopped() {
+	s.removePIDFile()
+	s.platform.exited()
+}
+
+// removePIDFile removes the PID file, if any
+func (s *nodeService) removePIDFile() {
+	if s.pidFile == "" {
+		return
+	}
+	if err := os.Remove(s.pidFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove PID file: %v", err)
+	}
+}
+
+// notify sends a state to systemd, logging failures
+func (s *nodeService) notify(state string) {
+	if err := sdNotify(state); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// sdNotify sends a state, e.g. READY=1, to the socket systemd names in
+// NOTIFY_SOCKET for units of Type=notify. It does nothing without one.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// startPlatformService does nothing outside Windows; init systems there
+// use the PID file, signals and sd_notify of service.go
+func startPlatformService(stop chan<- struct{}) (platformService, error) {
+	return noPlatformService{}, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestServiceLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "notify.sock")
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer socket.Close()
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	received := func() string {
+		buf := make([]byte, 256)
+		n, err := socket.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	pidFile := filepath.Join(dir, "alerimnode.pid")
+	service, err := startService(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("PID file = %q, %v", data, err)
+	}
+
+	service.Ready()
+	if got := received(); !strings.HasPrefix(got, "READY=1\n") {
+		t.Errorf("ready notification = %q", got)
+	}
+	close(service.stop)
+	service.Wait(func() error { return nil })
+	service.Stopping()
+	if got := received(); got != "STOPPING=1" {
+		t.Errorf("stopping notification = %q", got)
+	}
+	service.Stopped()
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("PID file left behind: %v", err)
+	}
+}
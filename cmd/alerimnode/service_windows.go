@@ -0,0 +1,150 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// windowsServiceName is the name the node is installed as a Windows
+// service under
+const windowsServiceName = "alerimnode"
+
+// windowsServiceExitTimeout bounds how long the node waits, on exit, for
+// the service manager to take its stopped status
+const windowsServiceExitTimeout = 5 * time.Second
+
+func init() {
+	subcommands["install-service"] = runInstallService
+	subcommands["remove-service"] = runRemoveService
+}
+
+// windowsService reports the node's state to the Windows service manager
+// and passes on its stop requests
+type windowsService struct {
+	stop     chan<- struct{}
+	started  chan struct{} // Closed once the node has started
+	done     chan struct{} // Closed once the node has shut down
+	finished chan struct{} // Closed once the service manager has returned
+}
+
+// startPlatformService connects to the Windows service manager when it
+// started the node
+func startPlatformService(stop chan<- struct{}) (platformService, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect the Windows service manager: %v", err)
+	}
+	if !isService {
+		return noPlatformService{}, nil
+	}
+	s := &windowsService{
+		stop:     stop,
+		started:  make(chan struct{}),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.finished)
+		if err := svc.Run(windowsServiceName, s); err != nil {
+			log.Printf("Windows service failed: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Execute implements svc.Handler, reporting the node's state until it
+// has shut down
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	started, stopping := s.started, false
+	for {
+		select {
+		case <-started:
+			started = nil
+			if !stopping {
+				status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+			}
+		case <-s.done:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				if !stopping {
+					stopping = true
+					close(s.stop)
+				}
+				status <- svc.Status{State: svc.StopPending}
+			}
+		}
+	}
+}
+
+func (s *windowsService) running() {
+	close(s.started)
+}
+
+func (s *windowsService) exited() {
+	close(s.done)
+	select {
+	case <-s.finished:
+	case <-time.After(windowsServiceExitTimeout):
+	}
+}
+
+// runInstallService implements install-service [flag...], installing the
+// node as a Windows service started automatically with the given flags
+func runInstallService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(windowsServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", windowsServiceName)
+	}
+	s, err := m.CreateService(windowsServiceName, exe, mgr.Config{
+		DisplayName: "Alerim Node",
+		Description: "Alerim blockchain node and mining pool",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fmt.Printf("Installed service %s running %s\n", windowsServiceName, exe)
+	return nil
+}
+
+// runRemoveService implements remove-service, uninstalling the node's
+// Windows service
+func runRemoveService(args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %v", windowsServiceName, err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed service %s\n", windowsServiceName)
+	return nil
+}
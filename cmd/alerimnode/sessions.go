@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sessionCookieName is the cookie carrying the admin session ID
+	sessionCookieName = "alerim_session"
+
+	// csrfHeaderName is the header that must echo the session's CSRF token
+	// on state-changing requests
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid username or password")
+	errLoginThrottled     = errors.New("too many failed login attempts, try again later")
+)
+
+// SessionConfig holds admin session settings
+type SessionConfig struct {
+	Username         string
+	Password         string
+	Timeout          time.Duration
+	MaxLoginAttempts int
+	LockoutDuration  time.Duration
+}
+
+// Session is an authenticated admin panel session. ID is the secret cookie
+// value and is never serialized; Handle identifies the session in the
+// session management API.
+type Session struct {
+	ID         string    `json:"-"`
+	Handle     string    `json:"id"`
+	Username   string    `json:"username"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeen   time.Time `json:"last_seen"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	csrfToken  string
+}
+
+// loginAttempts tracks failed logins from a single client address
+type loginAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// SessionManager issues, validates and revokes admin sessions
+type SessionManager struct {
+	mu       sync.RWMutex
+	config   *SessionConfig
+	sessions map[string]*Session
+	attempts map[string]*loginAttempts
+}
+
+// NewSessionManager creates a new session manager
+func NewSessionManager(config *SessionConfig) *SessionManager {
+	sm := &SessionManager{
+		config:   config,
+		sessions: make(map[string]*Session),
+		attempts: make(map[string]*loginAttempts),
+	}
+	go sm.expireSessions()
+	return sm
+}
+
+// Login checks the credentials and creates a new session
+func (sm *SessionManager) Login(username, password, remoteAddr string) (*Session, string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	attempt := sm.attempts[remoteAddr]
+	if attempt != nil && now.Before(attempt.lockedUntil) {
+		return nil, "", errLoginThrottled
+	}
+
+	if sm.config.Password == "" || !constantTimeEqual(username, sm.config.Username) || !constantTimeEqual(password, sm.config.Password) {
+		if attempt == nil {
+			attempt = &loginAttempts{}
+			sm.attempts[remoteAddr] = attempt
+		}
+		attempt.failures++
+		if attempt.failures >= sm.config.MaxLoginAttempts {
+			attempt.failures = 0
+			attempt.lockedUntil = now.Add(sm.config.LockoutDuration)
+		}
+		return nil, "", errInvalidCredentials
+	}
+	delete(sm.attempts, remoteAddr)
+
+	session := &Session{
+		ID:         randomToken(),
+		Handle:     randomToken()[:16],
+		Username:   username,
+		RemoteAddr: remoteAddr,
+		CreatedAt:  now,
+		LastSeen:   now,
+		ExpiresAt:  now.Add(sm.config.Timeout),
+		csrfToken:  randomToken(),
+	}
+	sm.sessions[session.ID] = session
+
+	return session, session.csrfToken, nil
+}
+
+// Get returns a live session by ID and refreshes its expiry
+func (sm *SessionManager) Get(id string) (*Session, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[id]
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(sm.sessions, id)
+		return nil, false
+	}
+
+	session.LastSeen = time.Now()
+	session.ExpiresAt = session.LastSeen.Add(sm.config.Timeout)
+	return session, true
+}
+
+// Revoke ends a session
+func (sm *SessionManager) Revoke(id string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.sessions[id]; !exists {
+		return false
+	}
+	delete(sm.sessions, id)
+	return true
+}
+
+// RevokeHandle ends a session by its public handle
+func (sm *SessionManager) RevokeHandle(handle string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for id, session := range sm.sessions {
+		if session.Handle == handle {
+			delete(sm.sessions, id)
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeAll ends every session except the given one and returns the count
+func (sm *SessionManager) RevokeAll(except string) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	revoked := 0
+	for id := range sm.sessions {
+		if id != except {
+			delete(sm.sessions, id)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// List returns copies of all live sessions
+func (sm *SessionManager) List() []*Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		s := *session
+		sessions = append(sessions, &s)
+	}
+	return sessions
+}
+
+// expireSessions periodically drops expired sessions and stale lockouts
+func (sm *SessionManager) expireSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		sm.mu.Lock()
+		for id, session := range sm.sessions {
+			if now.After(session.ExpiresAt) {
+				delete(sm.sessions, id)
+			}
+		}
+		for addr, attempt := range sm.attempts {
+			if now.After(attempt.lockedUntil) && attempt.failures == 0 {
+				delete(sm.attempts, addr)
+			}
+		}
+		sm.mu.Unlock()
+	}
+}
+
+// Middleware authenticates requests by session cookie. State-changing
+// requests must also carry the session's CSRF token in X-CSRF-Token.
+// Requests without a valid session cookie are passed on unauthenticated so
+// public routes keep working and other authentication methods can handle
+// them; a stale cookie is cleared.
+func (sm *SessionManager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := c.Cookie(sessionCookieName)
+		if err != nil || id == "" {
+			c.Next()
+			return
+		}
+
+		session, ok := sm.Get(id)
+		if !ok {
+			sm.setCookie(c, "", -1)
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !constantTimeEqual(c.GetHeader(csrfHeaderName), session.csrfToken) {
+				abortWithError(c, apiError(CodeForbidden, "Invalid CSRF token"))
+				return
+			}
+		}
+
+		// The server-side expiry slides on every request, so slide the
+		// cookie with it
+		sm.setCookie(c, session.ID, int(sm.config.Timeout.Seconds()))
+
+		c.Set("session", session)
+		c.Next()
+	}
+}
+
+// setCookie sets or, with a negative maxAge, clears the session cookie
+func (sm *SessionManager) setCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookieName, value, maxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+// RegisterRoutes adds the login, logout and session management endpoints
+func (sm *SessionManager) RegisterRoutes(api *gin.RouterGroup) {
+	api.POST("/admin/login", func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		session, csrfToken, err := sm.Login(req.Username, req.Password, c.ClientIP())
+		if err == errLoginThrottled {
+			respondError(c, apiError(CodeRateLimited, err.Error()))
+			return
+		} else if err != nil {
+			respondError(c, apiError(CodeUnauthorized, err.Error()))
+			return
+		}
+
+		sm.setCookie(c, session.ID, int(sm.config.Timeout.Seconds()))
+		c.JSON(http.StatusOK, gin.H{
+			"csrf_token": csrfToken,
+			"expires_at": session.ExpiresAt,
+		})
+	})
+
+	admin := api.Group("/admin", sm.requireSession())
+	{
+		admin.POST("/logout", func(c *gin.Context) {
+			session := c.MustGet("session").(*Session)
+			sm.Revoke(session.ID)
+			sm.setCookie(c, "", -1)
+			c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+		})
+
+		// Lets the panel recover its CSRF token for an existing cookie
+		// session, e.g. after a page reload
+		admin.GET("/session", func(c *gin.Context) {
+			session := c.MustGet("session").(*Session)
+			c.JSON(http.StatusOK, gin.H{
+				"username":   session.Username,
+				"csrf_token": session.csrfToken,
+				"expires_at": session.ExpiresAt,
+			})
+		})
+
+		admin.GET("/sessions", func(c *gin.Context) {
+			c.JSON(http.StatusOK, sm.List())
+		})
+
+		admin.DELETE("/sessions/:id", func(c *gin.Context) {
+			if !sm.RevokeHandle(c.Param("id")) {
+				respondError(c, apiError(CodeNotFound, "Session not found"))
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+		})
+
+		admin.POST("/sessions/revoke-all", func(c *gin.Context) {
+			session := c.MustGet("session").(*Session)
+			c.JSON(http.StatusOK, gin.H{"revoked": sm.RevokeAll(session.ID)})
+		})
+	}
+}
+
+// requireSession rejects requests without a valid session
+func (sm *SessionManager) requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("session"); !ok {
+			abortWithError(c, apiError(CodeUnauthorized, "Login required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// randomToken returns a 256-bit random hex token
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// constantTimeEqual compares two secrets without leaking timing
+func constantTimeEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testSessionManager() *SessionManager {
+	return NewSessionManager(&SessionConfig{
+		Username:         "admin",
+		Password:         "secret",
+		Timeout:          time.Hour,
+		MaxLoginAttempts: 3,
+		LockoutDuration:  time.Minute,
+	})
+}
+
+func TestSessionLoginThrottling(t *testing.T) {
+	sm := testSessionManager()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := sm.Login("admin", "wrong", "198.51.100.1"); err != errInvalidCredentials {
+			t.Fatalf("attempt %d: err = %v, want errInvalidCredentials", i, err)
+		}
+	}
+	if _, _, err := sm.Login("admin", "secret", "198.51.100.1"); err != errLoginThrottled {
+		t.Errorf("locked out client: err = %v, want errLoginThrottled", err)
+	}
+	if _, _, err := sm.Login("admin", "secret", "198.51.100.2"); err != nil {
+		t.Errorf("other client: err = %v, want nil", err)
+	}
+}
+
+func TestSessionLoginDisabledWithoutPassword(t *testing.T) {
+	sm := NewSessionManager(&SessionConfig{Username: "admin", Timeout: time.Hour, MaxLoginAttempts: 3})
+	if _, _, err := sm.Login("admin", "", "198.51.100.1"); err == nil {
+		t.Error("login succeeded with no password configured")
+	}
+}
+
+func TestSessionRevokeByHandle(t *testing.T) {
+	sm := testSessionManager()
+	session, _, err := sm.Login("admin", "secret", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sm.RevokeHandle(session.ID) {
+		t.Error("revoking by the secret session ID succeeded")
+	}
+	if !sm.RevokeHandle(session.Handle) {
+		t.Error("revoking by handle failed")
+	}
+	if _, ok := sm.Get(session.ID); ok {
+		t.Error("session still live after revocation")
+	}
+}
+
+func TestSessionListHidesSecrets(t *testing.T) {
+	sm := testSessionManager()
+	session, csrfToken, err := sm.Login("admin", "secret", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(sm.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), session.ID) || strings.Contains(string(data), csrfToken) {
+		t.Errorf("session list leaks secrets: %s", data)
+	}
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sm := testSessionManager()
+	session, csrfToken, err := sm.Login("admin", "secret", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(sm.Middleware())
+	handler := func(c *gin.Context) {
+		_, ok := c.Get("session")
+		c.JSON(http.StatusOK, gin.H{"authenticated": ok})
+	}
+	router.GET("/status", handler)
+	router.POST("/action", handler)
+
+	tests := []struct {
+		name       string
+		method     string
+		cookie     string
+		csrf       string
+		wantStatus int
+		wantAuth   bool
+	}{
+		{"no cookie", http.MethodGet, "", "", http.StatusOK, false},
+		{"stale cookie passes unauthenticated", http.MethodGet, "stale", "", http.StatusOK, false},
+		{"valid cookie GET", http.MethodGet, session.ID, "", http.StatusOK, true},
+		{"valid cookie POST with CSRF token", http.MethodPost, session.ID, csrfToken, http.StatusOK, true},
+		{"valid cookie POST without CSRF token", http.MethodPost, session.ID, "", http.StatusForbidden, false},
+		{"valid cookie POST with wrong CSRF token", http.MethodPost, session.ID, "wrong", http.StatusForbidden, false},
+	}
+
+	for _, test := range tests {
+		path := "/status"
+		if test.method == http.MethodPost {
+			path = "/action"
+		}
+		req := httptest.NewRequest(test.method, path, nil)
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: test.cookie})
+		}
+		if test.csrf != "" {
+			req.Header.Set(csrfHeaderName, test.csrf)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+			continue
+		}
+		if w.Code == http.StatusOK {
+			var resp struct {
+				Authenticated bool `json:"authenticated"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Authenticated != test.wantAuth {
+				t.Errorf("%s: authenticated = %v, want %v", test.name, resp.Authenticated, test.wantAuth)
+			}
+		}
+		if test.cookie == "stale" && !strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=0") {
+			t.Errorf("%s: stale cookie not cleared", test.name)
+		}
+	}
+}
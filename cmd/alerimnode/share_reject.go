@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+
+// RejectReason classifies why a share was rejected
+type RejectReason string
+
+// Share reject reasons
+const (
+	RejectStale         RejectReason = "stale"        // Job is no longer current
+	RejectLowDifficulty RejectReason = "low-diff"     // Hash above the worker's target
+	RejectDuplicate     RejectReason = "duplicate"    // Already submitted for this job
+	RejectBadHash       RejectReason = "bad-hash"     // Hash doesn't match the job and nonce
+	RejectUnauthorized  RejectReason = "unauthorized" // Worker not authorized on the connection
+	RejectMalformed     RejectReason = "malformed"    // Missing or unparsable parameters
+)
+
+// RejectReasons lists every reject reason, for reporting
+var RejectReasons = []RejectReason{
+	RejectStale,
+	RejectLowDifficulty,
+	RejectDuplicate,
+	RejectBadHash,
+	RejectUnauthorized,
+	RejectMalformed,
+}
+
+// rejectErrorCodes maps reject reasons to error codes; their stratum error
+// codes are the ones mining software understands
+var rejectErrorCodes = map[RejectReason]ErrorCode{
+	RejectStale:         CodeStaleShare,
+	RejectLowDifficulty: CodeLowDifficultyShare,
+	RejectDuplicate:     CodeDuplicateShare,
+	RejectBadHash:       CodeInvalidShare,
+	RejectUnauthorized:  CodeUnauthorized,
+	RejectMalformed:     CodeInvalidRequest,
+}
+
+// stratumOtherError is the stratum error code for anything else
+const stratumOtherError = 20
+
+// ShareError is returned for a rejected share
+type ShareError struct {
+	Reason  RejectReason
+	Message string
+}
+
+// Error implements error
+func (e *ShareError) Error() string {
+	return e.Message
+}
+
+// APIError returns the rejection as an APIError
+func (e *ShareError) APIError() *APIError {
+	code, ok := rejectErrorCodes[e.Reason]
+	if !ok {
+		code = CodeInvalidShare
+	}
+	return apiError(code, e.Message).WithDetail("reason", e.Reason)
+}
+
+// Code returns the stratum error code of the rejection
+func (e *ShareError) Code() int {
+	return errorCodeInfo(e.APIError().Code).StratumCode
+}
+
+// rejectShare creates a ShareError with a formatted message
+func rejectShare(reason RejectReason, format string, args ...interface{}) *ShareError {
+	return &ShareError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func init() {
+	metrics.Describe("alerim_shares_rejected_total", "Shares rejected by reason")
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestShareErrorCode(t *testing.T) {
+	tests := []struct {
+		reason RejectReason
+		want   int
+	}{
+		{RejectStale, 21},
+		{RejectDuplicate, 22},
+		{RejectLowDifficulty, 23},
+		{RejectUnauthorized, 24},
+		{RejectBadHash, stratumOtherError},
+		{RejectMalformed, stratumOtherError},
+	}
+	for _, tt := range tests {
+		if got := rejectShare(tt.reason, "rejected").Code(); got != tt.want {
+			t.Errorf("code of %s = %d, want %d", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestParseShareParams(t *testing.T) {
+	if nonce, err := parseNonce("1f"); err != nil || nonce != 0x1f {
+		t.Errorf("parseNonce = %d, %v", nonce, err)
+	}
+	if _, err := parseNonce("xyz"); err == nil {
+		t.Error("expected an error for a non-hex nonce")
+	}
+
+	hash := "00000000000000000000000000000000000000000000000000000000000000ff"
+	if b, err := parseHash(hash); err != nil || len(b) != 32 || b[31] != 0xff {
+		t.Errorf("parseHash = %x, %v", b, err)
+	}
+	for _, bad := range []string{"", "zz", hash[:62]} {
+		if _, err := parseHash(bad); err == nil {
+			t.Errorf("parseHash(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestMinerStatsRejects(t *testing.T) {
+	ms := NewMinerStats()
+	ms.AddReject(RejectStale)
+	ms.AddReject(RejectStale)
+	ms.AddReject(RejectDuplicate)
+
+	stats := ms.GetStats()
+	if stats["invalid_shares"].(int64) != 3 {
+		t.Errorf("invalid_shares = %v, want 3", stats["invalid_shares"])
+	}
+	rejects := stats["rejects"].(map[string]int64)
+	if rejects["stale"] != 2 || rejects["duplicate"] != 1 || rejects["low-diff"] != 0 {
+		t.Errorf("rejects = %v", rejects)
+	}
+	if len(rejects) != len(RejectReasons) {
+		t.Errorf("rejects has %d reasons, want all %d", len(rejects), len(RejectReasons))
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func init() {
+	subcommands["verify-share"] = runVerifyShare
+}
+
+// Share log entry types
+const (
+	ShareLogJob   = "job"
+	ShareLogShare = "share"
+)
+
+// shareLogAccepted is the result of accepted shares in the share log
+const shareLogAccepted = "accepted"
+
+// ShareLogEntry is a line of the share log: an issued job, or a submitted
+// share and how it was judged. A job's header and a share's nonce are
+// enough to recompute the share's hash.
+type ShareLogEntry struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	JobID string    `json:"job_id"`
+
+	// Jobs
+	Clean  bool   `json:"clean,omitempty"`  // First job on a new tip
+	Header string `json:"header,omitempty"` // Hex header with a zero nonce
+
+	// Shares
+	Miner      string `json:"miner,omitempty"`
+	Nonce      uint64 `json:"nonce,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"` // Worker difficulty it was judged at
+	Result     string `json:"result,omitempty"`     // "accepted" or the reject reason
+	Message    string `json:"message,omitempty"`
+}
+
+// templateJobID derives a job ID from a template: the first 8 bytes of
+// the hash of its header with a zero nonce. IDs are stable across
+// restarts, and anyone holding the header can check it belongs to the job.
+func templateJobID(block *blockchain.Block) string {
+	header := *block
+	header.Nonce = 0
+	hash := header.CalculateHash()
+	return hex.EncodeToString(hash[:8])
+}
+
+// ShareLog is a rolling log of issued jobs and submitted shares, one JSON
+// line each, in a file per UTC day. Files older than the retention period
+// are deleted.
+type ShareLog struct {
+	mu     sync.Mutex
+	dir    string
+	retain int // Days of files kept, including today's
+	day    string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewShareLog opens the share log in dir, keeping retainDays days of files
+func NewShareLog(dir string, retainDays int) (*ShareLog, error) {
+	if retainDays < 1 {
+		return nil, errors.New("share log retention must be at least one day")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &ShareLog{dir: dir, retain: retainDays}, nil
+}
+
+// LogJob records an issued job
+func (l *ShareLog) LogJob(job *miningJob, now time.Time) {
+	header := *job.block
+	header.Nonce = 0
+	l.write(&ShareLogEntry{
+		Type:   ShareLogJob,
+		Time:   now,
+		JobID:  job.id,
+		Clean:  job.clean,
+		Header: hex.EncodeToString(header.EncodeHeader()),
+	})
+}
+
+// LogShare records a submitted share. err is the result of SubmitShare;
+// difficulty is nil if the share was rejected before it was known.
+func (l *ShareLog) LogShare(minerID, jobID string, nonce uint64, hash []byte, difficulty *big.Int, err error, now time.Time) {
+	entry := &ShareLogEntry{
+		Type:   ShareLogShare,
+		Time:   now,
+		JobID:  jobID,
+		Miner:  minerID,
+		Nonce:  nonce,
+		Hash:   hex.EncodeToString(hash),
+		Result: shareLogAccepted,
+	}
+	if difficulty != nil {
+		entry.Difficulty = difficulty.String()
+	}
+	if err != nil {
+		entry.Result, entry.Message = "error", err.Error()
+		if shareErr, ok := err.(*ShareError); ok {
+			entry.Result = string(shareErr.Reason)
+		}
+	}
+	l.write(entry)
+}
+
+// write appends an entry to the file of its day, rotating and pruning
+// files when the day changes
+func (l *ShareLog) write(entry *ShareLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	day := entry.Time.UTC().Format(reportDateLayout)
+	if day != l.day {
+		if err := l.rotate(day); err != nil {
+			log.Printf("Error opening share log: %v", err)
+			return
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding share log entry: %v", err)
+		return
+	}
+	l.writer.Write(append(data, '\n'))
+	if err := l.writer.Flush(); err != nil {
+		log.Printf("Error writing share log: %v", err)
+	}
+}
+
+// rotate switches to the file of day and deletes files that fell out of
+// the retention period; the caller must hold l.mu
+func (l *ShareLog) rotate(day string) error {
+	if l.file != nil {
+		l.file.Close()
+		l.file, l.writer = nil, nil
+	}
+	file, err := os.OpenFile(filepath.Join(l.dir, shareLogFileName(day)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	l.file, l.writer, l.day = file, bufio.NewWriter(file), day
+
+	files, err := shareLogFiles(l.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > l.retain {
+		if err := os.Remove(files[0]); err != nil {
+			log.Printf("Error pruning share log: %v", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Close closes the current file
+func (l *ShareLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file, l.writer, l.day = nil, nil, ""
+	return err
+}
+
+// shareLogDir returns the directory of the share log
+func shareLogDir(d *DataDir) string {
+	return filepath.Join(d.Pool(), "sharelog")
+}
+
+// shareLogFileName returns the name of the share log file of a day
+func shareLogFileName(day string) string {
+	return "shares-" + day + ".jsonl"
+}
+
+// shareLogFiles returns the share log files in dir, oldest first
+func shareLogFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, shareLogFileName("*")))
+	sort.Strings(files)
+	return files, err
+}
+
+// ReadShareLog calls fn for every entry in the share log in dir, oldest
+// first, stopping at the first error
+func ReadShareLog(dir string, fn func(*ShareLogEntry) error) error {
+	files, err := shareLogFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for i, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var entry ShareLogEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return fmt.Errorf("%s:%d: %v", filepath.Base(path), i+1, err)
+			}
+			if err := fn(&entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ShareVerdict is the outcome of re-verifying a logged share
+type ShareVerdict struct {
+	Hash         string `json:"hash"`          // Recomputed from the job header and nonce
+	HashMatches  bool   `json:"hash_matches"`  // Equal to the submitted hash
+	MeetsTarget  bool   `json:"meets_target"`  // Meets the difficulty it was judged at
+	Achieved     string `json:"achieved"`      // Difficulty the recomputed hash achieves
+	ShouldAccept bool   `json:"should_accept"` // Valid work, disregarding staleness and duplicates
+}
+
+// VerifyLoggedShare recomputes a logged share's hash from its job's header
+func VerifyLoggedShare(job, share *ShareLogEntry) (*ShareVerdict, error) {
+	if job.JobID != share.JobID {
+		return nil, fmt.Errorf("share is for job %s, not %s", share.JobID, job.JobID)
+	}
+	header, err := hex.DecodeString(job.Header)
+	if err != nil || len(header) < 4 {
+		return nil, fmt.Errorf("job %s has an invalid header", job.JobID)
+	}
+	if share.Nonce > 0xFFFFFFFF {
+		return &ShareVerdict{}, nil
+	}
+
+	// The nonce is the header's last field
+	binary.LittleEndian.PutUint32(header[len(header)-4:], uint32(share.Nonce))
+	hash := sha256.Sum256(header)
+	verdict := &ShareVerdict{
+		Hash:     hex.EncodeToString(hash[:]),
+		Achieved: blockchain.HashDifficulty(hash[:]).String(),
+	}
+	verdict.HashMatches = verdict.Hash == strings.ToLower(share.Hash)
+	if difficulty, ok := new(big.Int).SetString(share.Difficulty, 10); ok {
+		verdict.MeetsTarget = blockchain.MeetsDifficulty(hash[:], difficulty)
+	}
+	verdict.ShouldAccept = verdict.HashMatches && verdict.MeetsTarget
+	return verdict, nil
+}
+
+// runVerifyShare implements the verify-share subcommand, which re-verifies
+// the logged shares of a job, optionally only a miner's
+func runVerifyShare(args []string) error {
+	fs := flag.NewFlagSet("verify-share", flag.ContinueOnError)
+	jobID := fs.String("job", "", "Job ID")
+	miner := fs.String("miner", "", "Only shares of this miner")
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *jobID == "" {
+		return errors.New("usage: alerimnode verify-share -job <id> [-miner <id>] [-datadir <dir>]")
+	}
+	dataDir := &DataDir{Root: *dataDirFlag}
+	dir := shareLogDir(dataDir)
+
+	var job *ShareLogEntry
+	var verdicts []map[string]interface{}
+	err := ReadShareLog(dir, func(entry *ShareLogEntry) error {
+		if entry.JobID != *jobID {
+			return nil
+		}
+		if entry.Type == ShareLogJob {
+			job = entry
+			return nil
+		}
+		if *miner != "" && entry.Miner != *miner {
+			return nil
+		}
+		if job == nil {
+			return fmt.Errorf("share logged before job %s", *jobID)
+		}
+		verdict, err := VerifyLoggedShare(job, entry)
+		if err != nil {
+			return err
+		}
+		verdicts = append(verdicts, map[string]interface{}{
+			"share":   entry,
+			"verdict": verdict,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return fmt.Errorf("job %s not found in %s", *jobID, dir)
+	}
+
+	out, err := json.MarshalIndent(map[string]interface{}{"job": job, "shares": verdicts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func testShareLogJob() *miningJob {
+	block := &blockchain.Block{Version: 1, Timestamp: 1700000000, Bits: 0x207fffff}
+	block.PrevHash[0] = 0xAB
+	return &miningJob{id: templateJobID(block), block: block, clean: true}
+}
+
+func TestTemplateJobID(t *testing.T) {
+	job := testShareLogJob()
+	block := job.block.Clone()
+	block.Nonce = 12345
+	if got := templateJobID(block); got != job.id {
+		t.Errorf("job ID changed with the nonce: %s, want %s", got, job.id)
+	}
+	block.Timestamp++
+	if got := templateJobID(block); got == job.id {
+		t.Errorf("job ID unchanged by a different header")
+	}
+}
+
+func TestShareLogVerify(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewShareLog(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	job := testShareLogJob()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l.LogJob(job, now)
+
+	block := job.block.Clone()
+	block.Nonce = 42
+	hash := block.CalculateHash()
+	difficulty := big.NewInt(1)
+	l.LogShare("alice", job.id, 42, hash[:], difficulty, nil, now)
+	l.LogShare("bob", job.id, 43, hash[:], difficulty, rejectShare(RejectBadHash, "hash mismatch"), now)
+
+	var jobEntry *ShareLogEntry
+	var shares []*ShareLogEntry
+	err = ReadShareLog(dir, func(entry *ShareLogEntry) error {
+		if entry.Type == ShareLogJob {
+			jobEntry = entry
+		} else {
+			shares = append(shares, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobEntry == nil || jobEntry.JobID != job.id || !jobEntry.Clean {
+		t.Fatalf("job entry = %+v", jobEntry)
+	}
+	if len(shares) != 2 {
+		t.Fatalf("read %d shares, want 2", len(shares))
+	}
+	if shares[0].Result != shareLogAccepted || shares[1].Result != string(RejectBadHash) {
+		t.Errorf("results = %q, %q", shares[0].Result, shares[1].Result)
+	}
+
+	tests := []struct {
+		share      *ShareLogEntry
+		wantAccept bool
+	}{
+		{shares[0], true},
+		{shares[1], false}, // Nonce doesn't produce the submitted hash
+	}
+	for _, tt := range tests {
+		verdict, err := VerifyLoggedShare(jobEntry, tt.share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verdict.ShouldAccept != tt.wantAccept {
+			t.Errorf("share of %s: verdict %+v, want accept %v", tt.share.Miner, verdict, tt.wantAccept)
+		}
+	}
+	if verdict, _ := VerifyLoggedShare(jobEntry, shares[0]); verdict.Hash != hex.EncodeToString(hash[:]) {
+		t.Errorf("recomputed hash %s, want %x", verdict.Hash, hash)
+	}
+
+	other := *shares[0]
+	other.JobID = "0000000000000000"
+	if _, err := VerifyLoggedShare(jobEntry, &other); err == nil {
+		t.Error("verified a share of another job")
+	}
+}
+
+func TestShareLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewShareLog(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	job := testShareLogJob()
+	start := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	for day := 0; day < 4; day++ {
+		l.LogJob(job, start.Add(time.Duration(day)*24*time.Hour))
+	}
+
+	files, err := shareLogFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d files kept, want 2", len(files))
+	}
+	for i, day := range []string{"2026-03-03", "2026-03-04"} {
+		if want := dir + string(os.PathSeparator) + shareLogFileName(day); files[i] != want {
+			t.Errorf("file %d = %s, want %s", i, files[i], want)
+		}
+	}
+
+	if _, err := NewShareLog(dir, 0); err == nil {
+		t.Error("opened a share log keeping no days")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// shareWALRecord is an accepted share of the current round in the share
+// write-ahead log
+type shareWALRecord struct {
+	Seq   uint64  `json:"seq"`
+	Miner string  `json:"miner"`
+	Work  float64 `json:"work"` // The share's difficulty
+}
+
+// ShareWAL is the write-ahead log of the current round's accepted shares.
+// Shares are buffered in memory and written in batches every flush
+// interval, so accepting a share never waits for the disk; a crash loses
+// at most the shares of the last interval. Each share has a sequence
+// number, so shares already folded into a saved round aren't replayed
+// twice.
+type ShareWAL struct {
+	mu      sync.Mutex
+	seq     uint64 // Last sequence number assigned
+	pending []shareWALRecord
+
+	writeMu sync.Mutex // Serializes writes to file, taken before mu
+	file    *os.File
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// OpenShareWAL opens the log at path, flushing every interval, and
+// returns the shares in it after settled, the last sequence number already
+// accounted for. A torn record left by a crash mid-write is truncated.
+func OpenShareWAL(path string, settled uint64, interval time.Duration) (*ShareWAL, []shareWALRecord, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, valid, err := readShareWAL(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	w := &ShareWAL{
+		seq:     settled,
+		file:    file,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	replay := make([]shareWALRecord, 0, len(records))
+	for _, record := range records {
+		if record.Seq > w.seq {
+			w.seq = record.Seq
+		}
+		if record.Seq > settled {
+			replay = append(replay, record)
+		}
+	}
+
+	go w.flushLoop(interval)
+	return w, replay, nil
+}
+
+// readShareWAL reads the records of a log and returns them with the length
+// of the log up to the end of the last complete record
+func readShareWAL(r io.Reader) ([]shareWALRecord, int64, error) {
+	var records []shareWALRecord
+	var valid int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("Discarding a torn record at the end of the share WAL")
+			}
+			return records, valid, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		var record shareWALRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("Discarding the share WAL from a corrupt record: %v", err)
+			return records, valid, nil
+		}
+		records = append(records, record)
+		valid += int64(len(line))
+	}
+}
+
+// Append buffers an accepted share and returns its sequence number
+func (w *ShareWAL) Append(minerID string, work float64) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	w.pending = append(w.pending, shareWALRecord{Seq: w.seq, Miner: minerID, Work: work})
+	return w.seq
+}
+
+// Seq returns the sequence number of the last appended share
+func (w *ShareWAL) Seq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// flushLoop flushes the buffered shares every interval until closed
+func (w *ShareWAL) flushLoop(interval time.Duration) {
+	defer close(w.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				log.Printf("Error flushing share WAL: %v", err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Flush writes the buffered shares and syncs them to disk
+func (w *ShareWAL) Flush() error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 || w.file == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range batch {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Reset empties the log once its shares are saved in a round. The caller
+// must not append concurrently, so no share of the next round is dropped.
+func (w *ShareWAL) Reset() error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	w.pending = nil
+	w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Close flushes the buffered shares and closes the log
+func (w *ShareWAL) Close() error {
+	close(w.stop)
+	<-w.stopped
+	err := w.Flush()
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// crash stops a log without flushing it, as a crash would
+func crash(w *ShareWAL) {
+	close(w.stop)
+	<-w.stopped
+	w.file.Close()
+}
+
+func TestShareWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shares.wal")
+	w, records, err := OpenShareWAL(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("new log replayed %d shares", len(records))
+	}
+	w.Append("m1", 100)
+	w.Append("m1", 100)
+	w.Append("m2", 50)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	w.Append("m3", 10) // Not flushed, so lost
+	crash(w)
+
+	// A crash mid-write leaves a torn record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":4,"mi`)
+	f.Close()
+
+	tests := []struct {
+		name    string
+		settled uint64
+		want    []string
+	}{
+		{"all", 0, []string{"m1", "m1", "m2"}},
+		{"settled", 2, []string{"m2"}},
+		{"all settled", 3, nil},
+		{"settled past the log", 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, records, err := OpenShareWAL(path, tt.settled, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if len(records) != len(tt.want) {
+				t.Fatalf("replayed %+v, want miners %v", records, tt.want)
+			}
+			for i, record := range records {
+				if record.Miner != tt.want[i] {
+					t.Errorf("replayed %+v, want miners %v", records, tt.want)
+				}
+			}
+
+			// Sequence numbers continue past the log and the settled share
+			want := tt.settled
+			if want < 3 {
+				want = 3
+			}
+			if got := w.Seq(); got != want {
+				t.Errorf("Seq() = %d, want %d", got, want)
+			}
+		})
+	}
+
+	// The torn record was truncated, so later appends stay readable
+	w, _, err = OpenShareWAL(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Append("m4", 1)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w, records, err = OpenShareWAL(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[3].Miner != "m4" || records[3].Seq != 4 {
+		t.Fatalf("after truncation replayed %+v", records)
+	}
+
+	// A reset log replays nothing
+	w.Append("m5", 1)
+	if err := w.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w, records, err = OpenShareWAL(path, 5, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if len(records) != 0 {
+		t.Errorf("reset log replayed %+v", records)
+	}
+}
+
+func TestShareWALFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shares.wal")
+	w, _, err := OpenShareWAL(path, 0, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Append("m1", 1)
+	time.Sleep(100 * time.Millisecond)
+	crash(w)
+
+	w, records, err := OpenShareWAL(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if len(records) != 1 {
+		t.Errorf("replayed %d shares flushed by the interval, want 1", len(records))
+	}
+}
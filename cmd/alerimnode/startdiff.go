@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// DiffClass is a class of miners starting at the same share difficulty,
+// a multiple of the vardiff minimum. Miners are matched to a class by
+// their user agent, or pick one in their password.
+type DiffClass struct {
+	Name   string   `json:"name"`
+	Factor int64    `json:"factor"` // Of the vardiff minimum difficulty
+	Agents []string `json:"agents"` // Case-insensitive substrings of the user agent
+}
+
+// defaultDiffClasses are used unless -diffclasses names a file. Miners
+// matching none start at the vardiff minimum, which suits CPUs.
+func defaultDiffClasses() []DiffClass {
+	return []DiffClass{
+		{Name: "asic", Factor: 65536, Agents: []string{"cgminer", "bmminer", "bfgminer", "antminer", "whatsminer"}},
+		{Name: "gpu", Factor: 256, Agents: []string{"sgminer", "ccminer", "nbminer", "teamredminer", "gminer", "lolminer", "t-rex"}},
+		{Name: "cpu", Factor: 1, Agents: []string{"cpuminer", "xmrig", "alerim-loadgen"}},
+	}
+}
+
+// LoadDiffClasses reads difficulty classes from a JSON file, an array of
+// classes tried in order
+func LoadDiffClasses(path string) ([]DiffClass, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var classes []DiffClass
+	if err := json.Unmarshal(data, &classes); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, class := range classes {
+		switch {
+		case class.Name == "" || seen[class.Name]:
+			return nil, fmt.Errorf("class names must be unique and non-empty, got %q", class.Name)
+		case class.Factor < 1:
+			return nil, fmt.Errorf("class %s: factor must be at least 1", class.Name)
+		}
+		seen[class.Name] = true
+	}
+	return classes, nil
+}
+
+// diffClassFor returns the first class matching a user agent, nil if
+// there is none
+func diffClassFor(classes []DiffClass, userAgent string) *DiffClass {
+	userAgent = strings.ToLower(userAgent)
+	if userAgent == "" {
+		return nil
+	}
+	for i, class := range classes {
+		for _, agent := range class.Agents {
+			if strings.Contains(userAgent, strings.ToLower(agent)) {
+				return &classes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// diffClassNamed returns the class with a name, nil if there is none
+func diffClassNamed(classes []DiffClass, name string) *DiffClass {
+	for i, class := range classes {
+		if class.Name == name {
+			return &classes[i]
+		}
+	}
+	return nil
+}
+
+// passwordHints parses the starting difficulty a miner asks for in its
+// password, as comma-separated d=<difficulty> or class=<name> fields,
+// e.g. "x,d=4096". Other fields are ignored.
+func passwordHints(password string) (difficulty *big.Int, class string, err error) {
+	for _, field := range strings.Split(password, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "d":
+			var valid bool
+			if difficulty, valid = new(big.Int).SetString(value, 10); !valid || difficulty.Sign() <= 0 {
+				return nil, "", fmt.Errorf("invalid difficulty %q", value)
+			}
+		case "class":
+			class = value
+		}
+	}
+	return difficulty, class, nil
+}
+
+// startDifficulty picks a new worker's share difficulty: the one asked
+// for in its password, else that of the class it names there, else that
+// of the class matching its user agent, else the vardiff minimum. It is
+// clamped to the vardiff bounds. The second result names what picked it.
+// It needs no lock.
+func (p *MiningPool) startDifficulty(userAgent, password string) (*big.Int, string, error) {
+	config := p.vardiff.Config()
+	hinted, className, err := passwordHints(password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	difficulty, source := new(big.Int).Set(config.MinimumDiff), "default"
+	switch {
+	case hinted != nil:
+		difficulty, source = hinted, "password"
+	case className != "":
+		class := diffClassNamed(p.diffClasses, className)
+		if class == nil {
+			return nil, "", fmt.Errorf("unknown difficulty class %q", className)
+		}
+		difficulty.Mul(difficulty, big.NewInt(class.Factor))
+		source = class.Name
+	default:
+		if class := diffClassFor(p.diffClasses, userAgent); class != nil {
+			difficulty.Mul(difficulty, big.NewInt(class.Factor))
+			source = class.Name
+		}
+	}
+
+	if difficulty.Cmp(config.MinimumDiff) < 0 {
+		difficulty = new(big.Int).Set(config.MinimumDiff)
+	} else if difficulty.Cmp(config.MaximumDiff) > 0 {
+		difficulty = new(big.Int).Set(config.MaximumDiff)
+	}
+	return difficulty, source, nil
+}
+
+// StartWorker returns the share difficulty of a worker authorizing. A
+// worker keeps the difficulty it has, also when it moves between pool
+// instances sharing their state; a new one starts at the difficulty
+// picked from its user agent and password hints.
+func (p *MiningPool) StartWorker(minerID, userAgent, password string) (*big.Int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	difficulty, err := p.state.Difficulty(minerID)
+	if err != nil {
+		log.Printf("Error loading difficulty of %s: %v", minerID, err)
+	}
+	if difficulty != nil {
+		return difficulty, nil
+	}
+
+	difficulty, source, err := p.startDifficulty(userAgent, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.state.SetDifficulty(minerID, difficulty); err != nil {
+		log.Printf("Error saving difficulty of %s: %v", minerID, err)
+	}
+	p.statsFor(minerID).RecordDifficultyChange(difficulty, "start difficulty ("+source+")")
+	metrics.Inc("alerim_stratum_start_difficulty_total", "class", source)
+	return difficulty, nil
+}
+
+func init() {
+	metrics.Describe("alerim_stratum_start_difficulty_total", "Workers started at a difficulty by the class, password hint or default that picked it")
+}
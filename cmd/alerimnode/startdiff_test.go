@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordHints(t *testing.T) {
+	tests := []struct {
+		password   string
+		difficulty int64 // 0 for none
+		class      string
+		ok         bool
+	}{
+		{"x", 0, "", true},
+		{"", 0, "", true},
+		{"d=4096", 4096, "", true},
+		{"x, d=4096", 4096, "", true},
+		{"class=gpu,x", 0, "gpu", true},
+		{"d=0", 0, "", false},
+		{"d=fast", 0, "", false},
+	}
+	for _, tt := range tests {
+		difficulty, class, err := passwordHints(tt.password)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v", tt.password, err)
+			continue
+		}
+		got := int64(0)
+		if difficulty != nil {
+			got = difficulty.Int64()
+		}
+		if got != tt.difficulty {
+			t.Errorf("%q: difficulty %d, want %d", tt.password, got, tt.difficulty)
+		}
+		if class != tt.class {
+			t.Errorf("%q: class %q, want %q", tt.password, class, tt.class)
+		}
+	}
+}
+
+func TestStartDifficulty(t *testing.T) {
+	config := testVarDiffConfig() // Difficulties from 10 to 1000
+	p := &MiningPool{
+		vardiff:    &VarDiffManager{config: config, miners: make(map[string]*MinerVarDiff)},
+		minerStats: make(map[string]*MinerStats),
+		diffClasses: []DiffClass{
+			{Name: "asic", Factor: 1000, Agents: []string{"cgminer"}},
+			{Name: "gpu", Factor: 8, Agents: []string{"sgminer"}},
+		},
+	}
+
+	tests := []struct {
+		userAgent string
+		password  string
+		want      int64
+		source    string
+	}{
+		{"", "x", 10, "default"},
+		{"xmrig/6.21", "x", 10, "default"},
+		{"sgminer/5.6.1", "x", 80, "gpu"},
+		{"CGMiner/4.12", "x", 1000, "asic"}, // Clamped to the maximum
+		{"cgminer/4.12", "class=gpu", 80, "gpu"},
+		{"cgminer/4.12", "d=50", 50, "password"},
+		{"", "d=3", 10, "password"}, // Clamped to the minimum
+	}
+	for _, tt := range tests {
+		difficulty, source, err := p.startDifficulty(tt.userAgent, tt.password)
+		if err != nil {
+			t.Errorf("%q %q: %v", tt.userAgent, tt.password, err)
+			continue
+		}
+		if difficulty.Int64() != tt.want || source != tt.source {
+			t.Errorf("%q %q: %s by %s, want %d by %s", tt.userAgent, tt.password, difficulty, source, tt.want, tt.source)
+		}
+	}
+	if _, _, err := p.startDifficulty("", "class=fpga"); err == nil {
+		t.Error("unknown class accepted")
+	}
+
+	// A worker keeps the difficulty it has
+	p.state = newMemoryPoolState()
+	p.state.SetDifficulty("w1", big.NewInt(500))
+	if difficulty, err := p.StartWorker("w1", "sgminer", "d=20"); err != nil || difficulty.Int64() != 500 {
+		t.Errorf("returning worker: %v, %v", difficulty, err)
+	}
+	if difficulty, err := p.StartWorker("w2", "sgminer", "x"); err != nil || difficulty.Int64() != 80 {
+		t.Errorf("new worker: %v, %v", difficulty, err)
+	}
+	if difficulty, _ := p.state.Difficulty("w2"); difficulty == nil || difficulty.Int64() != 80 {
+		t.Errorf("stored difficulty = %v, want 80", difficulty)
+	}
+}
+
+func TestLoadDiffClasses(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"valid", `[{"name":"asic","factor":4096,"agents":["bmminer"]},{"name":"cpu","factor":1}]`, true},
+		{"duplicate name", `[{"name":"asic","factor":2},{"name":"asic","factor":4}]`, false},
+		{"zero factor", `[{"name":"asic","factor":0}]`, false},
+		{"malformed", `{"asic":4096}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "classes.json")
+			os.WriteFile(path, []byte(tt.data), 0600)
+			if _, err := LoadDiffClasses(path); (err == nil) != tt.ok {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Storage component states
+const (
+	StorageOK       = "ok"
+	StorageWarning  = "warning"  // Above the warning fraction of its limit
+	StorageExceeded = "exceeded" // At or above its limit
+)
+
+// storageScanInterval is how often the data directory's usage is measured
+const storageScanInterval = 10 * time.Minute
+
+// storageOther is the component of data directory files outside every
+// other component, such as API keys and the audit log
+const storageOther = "other"
+
+// ComponentUsage is the disk usage of one part of the data directory
+type ComponentUsage struct {
+	Name   string  `json:"name"`
+	Path   string  `json:"path"`
+	Bytes  int64   `json:"bytes"`
+	Files  int     `json:"files"`
+	Limit  int64   `json:"limit,omitempty"` // 0 for unlimited
+	Used   float64 `json:"used,omitempty"`  // Fraction of the limit
+	Status string  `json:"status"`
+}
+
+// StorageReport is the disk usage of the data directory by component
+type StorageReport struct {
+	Root       string           `json:"root"`
+	TotalBytes int64            `json:"total_bytes"`
+	Components []ComponentUsage `json:"components"`
+	ScannedAt  time.Time        `json:"scanned_at"`
+}
+
+// StorageManager measures the data directory's disk usage against
+// operator-configured limits, logging a warning and exporting metrics when
+// a component crosses its warning threshold. It only reports; nothing is
+// deleted to get under a limit.
+type StorageManager struct {
+	mu         sync.RWMutex
+	dataDir    *DataDir
+	limits     map[string]int64 // Component -> bytes
+	warnAt     float64          // Fraction of a limit that triggers a warning
+	last       *StorageReport
+	lastStatus map[string]string
+}
+
+// NewStorageManager creates a storage manager. limits maps component
+// names, as returned by storageComponents, to their size limits in bytes.
+func NewStorageManager(dataDir *DataDir, limits map[string]int64, warnAt float64) (*StorageManager, error) {
+	known := make(map[string]bool)
+	for name := range dataDir.storageComponents() {
+		known[name] = true
+	}
+	known[storageOther] = true
+	for name := range limits {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown storage component %q", name)
+		}
+	}
+	if warnAt <= 0 || warnAt > 1 {
+		return nil, fmt.Errorf("storage warning threshold must be between 0 and 1, not %v", warnAt)
+	}
+	return &StorageManager{
+		dataDir:    dataDir,
+		limits:     limits,
+		warnAt:     warnAt,
+		lastStatus: make(map[string]string),
+	}, nil
+}
+
+// storageComponents returns the directories whose usage is reported
+// separately, by component name
+func (d *DataDir) storageComponents() map[string]string {
+	return map[string]string{
+		"blocks":     d.Blocks(),
+		"chainstate": d.Chainstate(),
+		"wallets":    d.Wallets(),
+		"pool":       d.Pool(),
+		"logs":       d.Logs(),
+	}
+}
+
+// Scan measures every component, updates the metrics and warns about
+// components that newly crossed a threshold
+func (sm *StorageManager) Scan() *StorageReport {
+	report := &StorageReport{Root: sm.dataDir.Root, ScannedAt: time.Now()}
+	total, totalFiles := dirUsage(sm.dataDir.Root)
+	report.TotalBytes = total
+
+	other, otherFiles := total, totalFiles
+	for name, path := range sm.dataDir.storageComponents() {
+		bytes, files := dirUsage(path)
+		other -= bytes
+		otherFiles -= files
+		report.Components = append(report.Components, sm.usage(name, path, bytes, files))
+	}
+	report.Components = append(report.Components, sm.usage(storageOther, sm.dataDir.Root, other, otherFiles))
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	metrics.Set("alerim_storage_total_bytes", float64(total))
+	for _, c := range report.Components {
+		metrics.Set("alerim_storage_bytes", float64(c.Bytes), "component", c.Name)
+		if c.Limit > 0 {
+			metrics.Set("alerim_storage_limit_bytes", float64(c.Limit), "component", c.Name)
+			metrics.Set("alerim_storage_used_ratio", c.Used, "component", c.Name)
+		}
+		if c.Status != StorageOK && c.Status != sm.lastStatus[c.Name] {
+			log.Printf("WARNING: %s data uses %s of its %s limit (%.0f%%)", c.Name, formatBytes(c.Bytes), formatBytes(c.Limit), c.Used*100)
+		}
+		sm.lastStatus[c.Name] = c.Status
+	}
+	sm.last = report
+	return report
+}
+
+// usage classifies a component's usage against its limit
+func (sm *StorageManager) usage(name, path string, bytes int64, files int) ComponentUsage {
+	c := ComponentUsage{Name: name, Path: path, Bytes: bytes, Files: files, Limit: sm.limits[name], Status: StorageOK}
+	if c.Limit > 0 {
+		c.Used = float64(bytes) / float64(c.Limit)
+		if c.Used >= 1 {
+			c.Status = StorageExceeded
+		} else if c.Used >= sm.warnAt {
+			c.Status = StorageWarning
+		}
+	}
+	return c
+}
+
+// Last returns the most recent report, scanning if there is none yet
+func (sm *StorageManager) Last() *StorageReport {
+	sm.mu.RLock()
+	last := sm.last
+	sm.mu.RUnlock()
+	if last == nil {
+		return sm.Scan()
+	}
+	return last
+}
+
+// Start rescans the data directory every interval
+func (sm *StorageManager) Start(interval time.Duration) {
+	go func() {
+		for {
+			sm.Scan()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RegisterRoutes adds the disk usage endpoint. The cached report is
+// returned unless ?refresh=true asks for a new scan.
+func (sm *StorageManager) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/admin/storage", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		if strings.EqualFold(c.Query("refresh"), "true") {
+			c.JSON(http.StatusOK, sm.Scan())
+			return
+		}
+		c.JSON(http.StatusOK, sm.Last())
+	})
+}
+
+// dirUsage returns the total size and number of the regular files under
+// path. Files that vanish or can't be read during the walk are skipped.
+func dirUsage(path string) (int64, int) {
+	var bytes int64
+	var files int
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			bytes += info.Size()
+			files++
+		}
+		return nil
+	})
+	return bytes, files
+}
+
+// byteUnits are the suffixes accepted by parseByteSize, by multiplier
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// parseByteSize parses a size such as "512MB", "20GB" or "1048576"; units
+// are powers of 1024
+func parseByteSize(s string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatBytes formats a size with the largest unit it fills
+func formatBytes(n int64) string {
+	for _, unit := range byteUnits {
+		if n >= unit.size && unit.size > 1 {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// parseStorageLimits parses a comma-separated list of component=size
+// limits, e.g. "blocks=50GB,pool=2GB"
+func parseStorageLimits(s string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, item := range splitList(s) {
+		name, size, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid storage limit %q, want component=size", item)
+		}
+		bytes, err := parseByteSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("storage limit of %s: %v", name, err)
+		}
+		limits[strings.TrimSpace(name)] = bytes
+	}
+	return limits, nil
+}
+
+func init() {
+	metrics.Describe("alerim_storage_total_bytes", "Disk usage of the data directory")
+	metrics.Describe("alerim_storage_bytes", "Disk usage of the data directory by component")
+	metrics.Describe("alerim_storage_limit_bytes", "Configured disk usage limit by component")
+	metrics.Describe("alerim_storage_used_ratio", "Disk usage as a fraction of the component's limit")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStorageLimits(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]int64
+		wantErr bool
+	}{
+		{"", map[string]int64{}, false},
+		{"blocks=50GB, pool=512mb", map[string]int64{"blocks": 50 << 30, "pool": 512 << 20}, false},
+		{"logs=1.5KB,other=100", map[string]int64{"logs": 1536, "other": 100}, false},
+		{"blocks", nil, true},
+		{"blocks=lots", nil, true},
+		{"blocks=-1GB", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStorageLimits(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStorageLimits(%q) error = %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseStorageLimits(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		for name, size := range tt.want {
+			if got[name] != size {
+				t.Errorf("parseStorageLimits(%q)[%s] = %d, want %d", tt.in, name, got[name], size)
+			}
+		}
+	}
+}
+
+func TestStorageScan(t *testing.T) {
+	dataDir := &DataDir{Root: t.TempDir()}
+	if err := dataDir.Init(); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string, size int) {
+		if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dataDir.Pool(), "rewards.json"), 950)
+	write(filepath.Join(dataDir.Blocks(), "blk0.dat"), 2000)
+	write(filepath.Join(dataDir.Root, "apikeys.json"), 10)
+
+	if _, err := NewStorageManager(dataDir, map[string]int64{"nope": 1}, 0.9); err == nil {
+		t.Error("unknown component accepted")
+	}
+	sm, err := NewStorageManager(dataDir, map[string]int64{"pool": 1000, "blocks": 1000, "wallets": 1000}, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := sm.Scan()
+	if report.TotalBytes != 2960 {
+		t.Errorf("total = %d, want 2960", report.TotalBytes)
+	}
+	want := map[string]struct {
+		bytes  int64
+		status string
+	}{
+		"blocks":     {2000, StorageExceeded},
+		"chainstate": {0, StorageOK},
+		"logs":       {0, StorageOK},
+		"other":      {10, StorageOK},
+		"pool":       {950, StorageWarning},
+		"wallets":    {0, StorageOK},
+	}
+	if len(report.Components) != len(want) {
+		t.Fatalf("%d components, want %d", len(report.Components), len(want))
+	}
+	for _, c := range report.Components {
+		if w := want[c.Name]; c.Bytes != w.bytes || c.Status != w.status {
+			t.Errorf("%s: %d bytes, %s; want %d bytes, %s", c.Name, c.Bytes, c.Status, w.bytes, w.status)
+		}
+	}
+	if sm.Last() != report {
+		t.Error("Last doesn't return the latest scan")
+	}
+}
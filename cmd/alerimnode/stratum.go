@@ -2,10 +2,13 @@ package main
 
 import (
 	"bufio"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -16,6 +19,8 @@ type StratumServer struct {
 	pool     *MiningPool
 	rewards  *RewardManager
 	clients  map[string]*StratumClient
+	conns    *connTracker
+	sessions *sessionTable
 	listener net.Listener
 }
 
@@ -26,9 +31,13 @@ type StratumClient struct {
 	reader     *bufio.Reader
 	encoder    *json.Encoder
 	minerID    string
+	userAgent  string
 	difficulty *big.Int
+	session    *stratumSession // Nil until subscribed
+	resumed    sessionOpen     // Of a resumed session, until the worker authorizes
 	lastShare  time.Time
 	server     *StratumServer
+	counters   *connCounters
 }
 
 // StratumRequest represents a JSON-RPC request from a client
@@ -47,19 +56,19 @@ type StratumResponse struct {
 	Params []interface{} `json:"params,omitempty"`
 }
 
-// NewStratumServer creates a new stratum server instance
-func NewStratumServer(pool *MiningPool, rewards *RewardManager, port int) (*StratumServer, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return nil, err
-	}
+// NewStratumServer creates a new stratum server instance accepting miners
+// on a listener bound by the caller
+func NewStratumServer(pool *MiningPool, rewards *RewardManager, listener net.Listener, acl *NetACL) *StratumServer {
+	listener = newACLListener(listener, acl, "stratum")
 
 	return &StratumServer{
 		pool:     pool,
 		rewards:  rewards,
 		clients:  make(map[string]*StratumClient),
+		conns:    newConnTracker(),
+		sessions: newSessionTable(),
 		listener: listener,
-	}, nil
+	}
 }
 
 // Start begins accepting stratum connections
@@ -72,12 +81,16 @@ func (s *StratumServer) Start() {
 				continue
 			}
 
+			metrics.Inc("alerim_stratum_connections_total")
+			counters := &connCounters{}
+			conn = &countingConn{Conn: conn, counters: counters}
 			client := &StratumClient{
 				conn:       conn,
 				reader:     bufio.NewReader(conn),
 				encoder:    json.NewEncoder(conn),
 				difficulty: s.pool.vardiff.GetDifficulty(""),
 				server:     s,
+				counters:   counters,
 			}
 
 			go client.handleConnection()
@@ -85,9 +98,17 @@ func (s *StratumServer) Start() {
 	}()
 }
 
+// ConnectionStats returns the connection statistics of every miner that
+// connected since startup
+func (s *StratumServer) ConnectionStats() map[string]ConnStats {
+	return s.conns.Report(time.Now())
+}
+
 // handleConnection processes messages from a stratum client
 func (c *StratumClient) handleConnection() {
 	defer c.conn.Close()
+	defer c.server.conns.disconnected(c)
+	defer c.detach()
 
 	for {
 		// Read JSON-RPC request
@@ -97,9 +118,11 @@ func (c *StratumClient) handleConnection() {
 			return
 		}
 
+		c.counters.requests.Add(1)
 		var req StratumRequest
 		if err := json.Unmarshal(data, &req); err != nil {
 			log.Printf("Error parsing request: %v", err)
+			c.protocolError()
 			continue
 		}
 
@@ -111,49 +134,124 @@ func (c *StratumClient) handleConnection() {
 			c.handleAuthorize(req)
 		case "mining.submit":
 			c.handleSubmit(req)
+		case "mining.hashrate":
+			c.handleHashrate(req)
 		default:
-			c.sendError(req.ID, "Unknown method")
+			c.protocolError()
+			c.sendError(req.ID, apiErrorf(CodeMethodNotFound, "Unknown method %s", req.Method))
+			continue
 		}
+		metrics.Inc("alerim_stratum_requests_total", "method", req.Method)
 	}
 }
 
+// handleSubscribe starts a session, or resumes the one whose subscription
+// ID is given as the second parameter after the user agent
 func (c *StratumClient) handleSubscribe(req StratumRequest) {
-	// Generate unique subscription ID
-	subscriptionID := fmt.Sprintf("subscription-%d", time.Now().UnixNano())
-	
-	response := StratumResponse{
+	var userAgent, sessionID string
+	if len(req.Params) > 0 {
+		userAgent, _ = req.Params[0].(string)
+	}
+	if len(req.Params) > 1 {
+		sessionID, _ = req.Params[1].(string)
+	}
+
+	c.detach()
+	open := c.server.sessions.open(sessionID, c, userAgent, time.Now())
+	if open.previous != nil {
+		open.previous.conn.Close()
+		open.previous = nil
+	}
+	if open.resumed && userAgent == "" {
+		userAgent = open.userAgent
+	}
+
+	// Set initial difficulty: a resumed session's, else that of the
+	// miner's class until it authorizes
+	difficulty := open.difficulty
+	if difficulty == nil {
+		difficulty, _, _ = c.server.pool.startDifficulty(userAgent, "")
+	}
+	if open.resumed {
+		metrics.Inc("alerim_stratum_session_resumes_total")
+	}
+
+	c.mu.Lock()
+	c.session = open.session
+	c.resumed = open
+	c.userAgent = userAgent
+	c.difficulty = difficulty
+	c.mu.Unlock()
+
+	c.sendResponse(StratumResponse{
 		ID: req.ID,
 		Result: []interface{}{
-			subscriptionID,
+			open.session.id,
 			"AlerimStratum/1.0.0",
+			open.session.extranonce1,
 		},
-	}
-	
-	c.sendResponse(response)
-
-	// Set initial difficulty
+	})
 	c.sendResponse(StratumResponse{
 		ID:     req.ID,
 		Method: "mining.set_difficulty",
-		Params: []interface{}{fmt.Sprintf("%x", c.difficulty)},
+		Params: []interface{}{fmt.Sprintf("%x", difficulty)},
 	})
 }
 
+// detach leaves the client's session for a later resume
+func (c *StratumClient) detach() {
+	c.mu.Lock()
+	session, difficulty := c.session, c.difficulty
+	c.session = nil
+	c.mu.Unlock()
+	if session != nil {
+		c.server.sessions.close(c, session, difficulty, time.Now())
+	}
+}
+
 func (c *StratumClient) handleAuthorize(req StratumRequest) {
 	if len(req.Params) < 2 {
-		c.sendError(req.ID, "Invalid parameters")
+		c.protocolError()
+		c.sendError(req.ID, apiError(CodeInvalidRequest, "Invalid parameters"))
 		return
 	}
 
 	username, ok := req.Params[0].(string)
 	if !ok {
-		c.sendError(req.ID, "Invalid username")
+		c.protocolError()
+		c.sendError(req.ID, apiError(CodeInvalidRequest, "Invalid username"))
+		return
+	}
+	password, _ := req.Params[1].(string)
+
+	// A worker keeps its difficulty, also when it moves between pool
+	// instances sharing their state; a new one starts at that of its class
+	c.mu.Lock()
+	userAgent := c.userAgent
+	c.mu.Unlock()
+	difficulty, err := c.server.pool.StartWorker(username, userAgent, password)
+	if err != nil {
+		c.sendError(req.ID, apiErrorf(CodeInvalidRequest, "Invalid password hints: %v", err))
 		return
 	}
 
 	c.mu.Lock()
 	c.minerID = username
+	session, resumed := c.session, c.resumed
+	c.resumed = sessionOpen{}
 	c.mu.Unlock()
+	c.server.conns.connected(c, username, time.Now())
+
+	// A worker resuming its session carries on where it left off: the
+	// reconnect is counted as a resume, and the time it was away is left
+	// out of its vardiff share times
+	if session != nil {
+		c.server.sessions.authorized(c, session, username)
+		if resumed.resumed && resumed.minerID == username {
+			c.server.conns.resumed(username)
+			c.server.pool.vardiff.Resume(username, resumed.downtime)
+		}
+	}
 
 	c.server.mu.Lock()
 	c.server.clients[username] = c
@@ -165,30 +263,66 @@ func (c *StratumClient) handleAuthorize(req StratumRequest) {
 		Result: true,
 	})
 
+	c.mu.Lock()
+	c.difficulty = difficulty
+	c.mu.Unlock()
+	c.sendResponse(StratumResponse{
+		Method: "mining.set_difficulty",
+		Params: []interface{}{fmt.Sprintf("%x", difficulty)},
+	})
+
 	// Send initial work
 	c.sendWork()
 }
 
 func (c *StratumClient) handleSubmit(req StratumRequest) {
-	if len(req.Params) < 4 {
-		c.sendError(req.ID, "Invalid parameters")
+	var workerName, jobID, nonceHex, hashHex string
+	params := []*string{&workerName, &jobID, &nonceHex, &hashHex}
+	if len(req.Params) < len(params) {
+		c.reject(req.ID, "", rejectShare(RejectMalformed, "Invalid parameters"))
 		return
 	}
+	for i, dst := range params {
+		value, ok := req.Params[i].(string)
+		if !ok {
+			c.reject(req.ID, "", rejectShare(RejectMalformed, "Parameter %d must be a string", i+1))
+			return
+		}
+		*dst = value
+	}
 
-	// Extract share parameters
-	workerName := req.Params[0].(string)
-	jobID := req.Params[1].(string)
-	nonce := req.Params[2].(string)
-	hash := req.Params[3].(string)
+	c.mu.Lock()
+	authorized := workerName == c.minerID
+	c.mu.Unlock()
+	if !authorized {
+		c.reject(req.ID, workerName, rejectShare(RejectUnauthorized, "Worker %s is not authorized", workerName))
+		return
+	}
+
+	nonce, err := parseNonce(nonceHex)
+	if err != nil {
+		c.reject(req.ID, workerName, rejectShare(RejectMalformed, "Invalid nonce"))
+		return
+	}
+	hash, err := parseHash(hashHex)
+	if err != nil {
+		c.reject(req.ID, workerName, rejectShare(RejectMalformed, "Invalid hash"))
+		return
+	}
+	faultCorruptShare(hash)
 
 	// Verify share
-	if err := c.server.pool.SubmitShare(workerName, parseNonce(nonce), parseHash(hash)); err != nil {
-		c.sendError(req.ID, err.Error())
+	if err := c.server.pool.SubmitShare(workerName, jobID, nonce, hash); err != nil {
+		shareErr, ok := err.(*ShareError)
+		if !ok {
+			c.sendError(req.ID, toAPIError(err, CodeFailed))
+			return
+		}
+		c.reject(req.ID, workerName, shareErr)
 		return
 	}
 
-	// Record share for rewards
-	c.server.rewards.AddShare(workerName)
+	// SubmitShare has credited the share for rewards
 	c.lastShare = time.Now()
 
 	// Send success response
@@ -198,18 +332,77 @@ func (c *StratumClient) handleSubmit(req StratumRequest) {
 	})
 }
 
+// handleHashrate records the hashrate a worker reports, as a number or
+// decimal string in the pool's hashrate units. The anomaly detector checks
+// the worker's share rate against it.
+func (c *StratumClient) handleHashrate(req StratumRequest) {
+	if len(req.Params) < 2 {
+		c.protocolError()
+		c.sendError(req.ID, apiError(CodeInvalidRequest, "Invalid parameters"))
+		return
+	}
+	workerName, _ := req.Params[0].(string)
+	c.mu.Lock()
+	authorized := workerName != "" && workerName == c.minerID
+	c.mu.Unlock()
+	if !authorized {
+		c.sendError(req.ID, apiErrorf(CodeUnauthorized, "Worker %s is not authorized", workerName))
+		return
+	}
+
+	var hashrate float64
+	switch v := req.Params[1].(type) {
+	case float64:
+		hashrate = v
+	case string:
+		var err error
+		if hashrate, err = strconv.ParseFloat(v, 64); err != nil {
+			hashrate = -1
+		}
+	default:
+		hashrate = -1
+	}
+	if hashrate < 0 || math.IsInf(hashrate, 0) || math.IsNaN(hashrate) {
+		c.protocolError()
+		c.sendError(req.ID, apiError(CodeInvalidRequest, "Invalid hashrate"))
+		return
+	}
+
+	if anomalies := c.server.pool.anomalies; anomalies != nil {
+		anomalies.ReportHashrate(workerName, hashrate)
+	}
+	c.sendResponse(StratumResponse{
+		ID:     req.ID,
+		Result: true,
+	})
+}
+
+// sendWork sends the pool's current job
 func (c *StratumClient) sendWork() {
-	block := c.server.pool.currentBlock
-	if block == nil {
+	pool := c.server.pool
+	pool.mu.RLock()
+	job := pool.job
+	pool.mu.RUnlock()
+
+	c.sendJob(job, true)
+}
+
+// sendJob sends a job to the client, telling it to abandon its previous
+// jobs if clean. Jobs are immutable, so it needs no pool lock.
+func (c *StratumClient) sendJob(job *miningJob, clean bool) {
+	if job == nil {
 		return
 	}
+	block := job.block
 
 	// Format work data for stratum
 	workData := []interface{}{
-		fmt.Sprintf("%x", block.PreviousHash),
+		job.id,
+		fmt.Sprintf("%x", block.PrevHash),
 		fmt.Sprintf("%x", block.MerkleRoot),
-		fmt.Sprintf("%x", block.Timestamp.Unix()),
-		fmt.Sprintf("%x", c.difficulty),
+		fmt.Sprintf("%x", block.Timestamp),
+		fmt.Sprintf("%08x", block.Bits),
+		clean,
 	}
 
 	notification := StratumResponse{
@@ -229,23 +422,44 @@ func (c *StratumClient) sendResponse(response StratumResponse) {
 	}
 }
 
-func (c *StratumClient) sendError(id interface{}, message string) {
+func (c *StratumClient) sendError(id interface{}, err *APIError) {
 	response := StratumResponse{
 		ID:    id,
-		Error: []interface{}{20, message, nil},
+		Error: err.StratumError(),
 	}
 	c.sendResponse(response)
 }
 
+// protocolError counts a malformed or unknown request
+func (c *StratumClient) protocolError() {
+	c.counters.protocolErrors.Add(1)
+	metrics.Inc("alerim_stratum_protocol_errors_total")
+}
+
+// reject reports a rejected share to the client and records it
+func (c *StratumClient) reject(id interface{}, workerName string, err *ShareError) {
+	if err.Reason == RejectMalformed {
+		c.protocolError()
+	}
+	c.server.pool.RecordReject(workerName, err.Reason)
+	c.sendResponse(StratumResponse{
+		ID:    id,
+		Error: err.APIError().StratumError(),
+	})
+}
+
 // Helper functions for parsing share submissions
-func parseNonce(s string) uint64 {
-	var nonce uint64
-	fmt.Sscanf(s, "%x", &nonce)
-	return nonce
+func parseNonce(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
 }
 
-func parseHash(s string) []byte {
-	hash := make([]byte, 32)
-	fmt.Sscanf(s, "%x", &hash)
-	return hash
+func parseHash(s string) ([]byte, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("hash is %d bytes, want 32", len(hash))
+	}
+	return hash, nil
 }
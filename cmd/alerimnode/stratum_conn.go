@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reconnectWindow is the period over which connects are counted to spot
+// rigs that keep reconnecting
+const reconnectWindow = time.Hour
+
+// connCounters counts the traffic of one stratum connection
+type connCounters struct {
+	bytesIn        atomic.Uint64
+	bytesOut       atomic.Uint64
+	requests       atomic.Uint64
+	protocolErrors atomic.Uint64
+}
+
+// countingConn counts the bytes read from and written to a connection
+type countingConn struct {
+	net.Conn
+	counters *connCounters
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.counters.bytesIn.Add(uint64(n))
+	metrics.Add("alerim_stratum_bytes_total", float64(n), "direction", "in")
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.counters.bytesOut.Add(uint64(n))
+	metrics.Add("alerim_stratum_bytes_total", float64(n), "direction", "out")
+	return n, err
+}
+
+// ConnStats summarizes the stratum connections of one miner
+type ConnStats struct {
+	BytesIn        uint64    `json:"bytes_in"`
+	BytesOut       uint64    `json:"bytes_out"`
+	Requests       uint64    `json:"requests"`
+	ProtocolErrors uint64    `json:"protocol_errors"`
+	Connects       int64     `json:"connects"`
+	Resumes        int64     `json:"resumes"` // Connects that resumed a session
+	ConnectsHour   int       `json:"connects_last_hour"`
+	Connected      bool      `json:"connected"`
+	LastConnect    time.Time `json:"last_connect"`
+}
+
+// connHistory accumulates the traffic of a miner's closed connections and
+// when it connected
+type connHistory struct {
+	stats    ConnStats
+	connects []time.Time // Within reconnectWindow
+}
+
+// connTracker keeps connection statistics per miner across reconnects.
+// Live connections are added in when a report is taken.
+type connTracker struct {
+	mu      sync.Mutex
+	history map[string]*connHistory   // Miner ID -> closed connections
+	live    map[*StratumClient]string // Authorized connection -> miner ID
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		history: make(map[string]*connHistory),
+		live:    make(map[*StratumClient]string),
+	}
+}
+
+// historyFor returns a miner's history; the caller must hold t.mu
+func (t *connTracker) historyFor(minerID string) *connHistory {
+	h, ok := t.history[minerID]
+	if !ok {
+		h = &connHistory{}
+		t.history[minerID] = h
+	}
+	return h
+}
+
+// prune drops connect times that left the window
+func (h *connHistory) prune(now time.Time) {
+	recent := h.connects[:0]
+	for _, at := range h.connects {
+		if now.Sub(at) < reconnectWindow {
+			recent = append(recent, at)
+		}
+	}
+	h.connects = recent
+}
+
+// connected records that a client authorized as a miner. A connection's
+// traffic is billed to the last miner it authorized as.
+func (t *connTracker) connected(client *StratumClient, minerID string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.historyFor(minerID)
+	h.stats.Connects++
+	h.stats.LastConnect = now
+	h.prune(now)
+	h.connects = append(h.connects, now)
+	t.live[client] = minerID
+}
+
+// resumed records that a miner's connect resumed its session
+func (t *connTracker) resumed(minerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.historyFor(minerID).stats.Resumes++
+}
+
+// disconnected folds a closed connection into its miner's history
+func (t *connTracker) disconnected(client *StratumClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	minerID, ok := t.live[client]
+	if !ok {
+		return
+	}
+	delete(t.live, client)
+	if h, ok := t.history[minerID]; ok {
+		addCounters(&h.stats, client.counters)
+	}
+}
+
+// forget drops a miner's history
+func (t *connTracker) forget(minerID string) {
+	t.mu.Lock()
+	delete(t.history, minerID)
+	t.mu.Unlock()
+}
+
+// addCounters adds a connection's counters to s
+func addCounters(s *ConnStats, c *connCounters) {
+	s.BytesIn += c.bytesIn.Load()
+	s.BytesOut += c.bytesOut.Load()
+	s.Requests += c.requests.Load()
+	s.ProtocolErrors += c.protocolErrors.Load()
+}
+
+// Report returns the connection statistics of every miner seen since
+// startup
+func (t *connTracker) Report(now time.Time) map[string]ConnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := make(map[string]ConnStats, len(t.history))
+	for minerID, h := range t.history {
+		h.prune(now)
+		stats := h.stats
+		stats.ConnectsHour = len(h.connects)
+		report[minerID] = stats
+	}
+	for client, minerID := range t.live {
+		stats, ok := report[minerID]
+		if !ok {
+			continue
+		}
+		addCounters(&stats, client.counters)
+		stats.Connected = true
+		report[minerID] = stats
+	}
+	return report
+}
+
+func init() {
+	metrics.Describe("alerim_stratum_bytes_total", "Bytes transferred over stratum by direction")
+	metrics.Describe("alerim_stratum_requests_total", "Stratum requests by method")
+	metrics.Describe("alerim_stratum_protocol_errors_total", "Malformed or unknown stratum requests")
+	metrics.Describe("alerim_stratum_connections_total", "Stratum connections accepted")
+	metrics.Describe("alerim_stratum_session_resumes_total", "Stratum sessions resumed by a reconnecting miner")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCountingConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	counters := &connCounters{}
+	conn := &countingConn{Conn: server, counters: counters}
+	defer conn.Close()
+
+	go func() {
+		client.Write([]byte("hello"))
+		io.ReadFull(client, make([]byte, 3))
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if in, out := counters.bytesIn.Load(), counters.bytesOut.Load(); in != 5 || out != 3 {
+		t.Errorf("counted %d bytes in and %d out, want 5 and 3", in, out)
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	tracker := newConnTracker()
+	now := time.Now()
+
+	// An earlier connection, outside the reconnect window
+	first := &StratumClient{counters: &connCounters{}}
+	tracker.connected(first, "rig1", now.Add(-2*reconnectWindow))
+	first.counters.bytesIn.Add(100)
+	first.counters.protocolErrors.Add(2)
+	tracker.disconnected(first)
+
+	second := &StratumClient{counters: &connCounters{}}
+	tracker.connected(second, "rig1", now.Add(-time.Minute))
+	tracker.disconnected(second)
+
+	live := &StratumClient{counters: &connCounters{}}
+	tracker.connected(live, "rig1", now)
+	tracker.resumed("rig1")
+	live.counters.bytesIn.Add(10)
+	live.counters.requests.Add(3)
+
+	stats := tracker.Report(now)["rig1"]
+	if stats.BytesIn != 110 || stats.Requests != 3 || stats.ProtocolErrors != 2 {
+		t.Errorf("counters = %+v", stats)
+	}
+	if stats.Connects != 3 || stats.ConnectsHour != 2 || stats.Resumes != 1 {
+		t.Errorf("connects = %d, last hour = %d, resumes = %d, want 3, 2 and 1", stats.Connects, stats.ConnectsHour, stats.Resumes)
+	}
+	if !stats.Connected {
+		t.Error("miner with a live connection reported as disconnected")
+	}
+
+	tracker.disconnected(live)
+	if stats := tracker.Report(now)["rig1"]; stats.Connected || stats.BytesIn != 110 {
+		t.Errorf("after disconnect: %+v", stats)
+	}
+
+	tracker.forget("rig1")
+	if _, ok := tracker.Report(now)["rig1"]; ok {
+		t.Error("forgotten miner still reported")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// sessionResumeWindow is how long after a disconnect a session can be
+// resumed
+const sessionResumeWindow = 10 * time.Minute
+
+// stratumSession is what a miner keeps across reconnects by presenting its
+// subscription ID to mining.subscribe: its extranonce1, difficulty and
+// worker. Sessions are kept by each pool instance, so a miner resumes only
+// on the instance it was connected to.
+type stratumSession struct {
+	id          string // Subscription ID
+	extranonce1 string // Hex, unique among the instance's sessions
+
+	// Guarded by the table's mu
+	userAgent  string
+	minerID    string // Last worker authorized, empty before
+	difficulty *big.Int
+	client     *StratumClient // Nil while disconnected
+	detached   time.Time      // When its client disconnected
+}
+
+// sessionOpen is the outcome of a subscription
+type sessionOpen struct {
+	session    *stratumSession
+	resumed    bool
+	userAgent  string         // Of the resumed session
+	minerID    string         // Worker the resumed session last authorized
+	difficulty *big.Int       // Of the resumed session, nil if it had none
+	downtime   time.Duration  // Since the resumed session's client disconnected
+	previous   *StratumClient // Connection the session was taken from, to be closed
+}
+
+// sessionTable holds the sessions of connected clients, and of those
+// disconnected within sessionResumeWindow
+type sessionTable struct {
+	mu         sync.Mutex
+	sessions   map[string]*stratumSession // By subscription ID
+	extranonce uint32                     // Last extranonce1 handed out
+}
+
+func newSessionTable() *sessionTable {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return &sessionTable{
+		sessions:   make(map[string]*stratumSession),
+		extranonce: binary.BigEndian.Uint32(b[:]),
+	}
+}
+
+// open starts the session of a client subscribing, resuming the session
+// with id if there is one. A session still held by another connection is
+// taken over: the miner has evidently lost that connection.
+func (t *sessionTable) open(id string, client *StratumClient, userAgent string, now time.Time) sessionOpen {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sessions[id]; ok && id != "" {
+		open := sessionOpen{
+			session:    s,
+			resumed:    true,
+			userAgent:  s.userAgent,
+			minerID:    s.minerID,
+			difficulty: s.difficulty,
+			previous:   s.client,
+		}
+		if s.client == nil {
+			open.downtime = now.Sub(s.detached)
+		}
+		if userAgent != "" {
+			s.userAgent = userAgent
+		}
+		s.client = client
+		return open
+	}
+
+	// Expired sessions are dropped as new ones start
+	for id, s := range t.sessions {
+		if s.client == nil && now.Sub(s.detached) >= sessionResumeWindow {
+			delete(t.sessions, id)
+		}
+	}
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	t.extranonce++
+	s := &stratumSession{
+		id:          hex.EncodeToString(b[:]),
+		extranonce1: fmt.Sprintf("%08x", t.extranonce),
+		userAgent:   userAgent,
+		client:      client,
+	}
+	t.sessions[s.id] = s
+	return sessionOpen{session: s}
+}
+
+// authorized records the worker a client's session authorized as
+func (t *sessionTable) authorized(client *StratumClient, s *stratumSession, minerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.client == client {
+		s.minerID = minerID
+	}
+}
+
+// close detaches a disconnected client from its session, keeping the
+// difficulty it was at for a resume
+func (t *sessionTable) close(client *StratumClient, s *stratumSession, difficulty *big.Int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.client != client {
+		return // Taken over
+	}
+	s.client = nil
+	s.detached = now
+	s.difficulty = difficulty
+}
+
+// forget drops the sessions of a worker
+func (t *sessionTable) forget(minerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, s := range t.sessions {
+		if s.minerID == minerID {
+			delete(t.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSessionTable(t *testing.T) {
+	table := newSessionTable()
+	now := time.Now()
+
+	first := &StratumClient{}
+	open := table.open("", first, "cgminer/4.12", now)
+	if open.resumed || open.session.id == "" || len(open.session.extranonce1) != 8 {
+		t.Fatalf("new session = %+v", open)
+	}
+	session := open.session
+	if other := table.open("", &StratumClient{}, "", now).session; other.id == session.id || other.extranonce1 == session.extranonce1 {
+		t.Error("sessions share an ID or extranonce1")
+	}
+	table.authorized(first, session, "rig1")
+	table.close(first, session, big.NewInt(4096), now)
+
+	// The miner reconnects and resumes its session
+	second := &StratumClient{}
+	open = table.open(session.id, second, "", now.Add(time.Minute))
+	if !open.resumed || open.session != session || open.minerID != "rig1" || open.userAgent != "cgminer/4.12" {
+		t.Fatalf("resumed session = %+v", open)
+	}
+	if open.difficulty.Int64() != 4096 || open.downtime != time.Minute || open.previous != nil {
+		t.Errorf("resumed difficulty %v, downtime %v, previous %v", open.difficulty, open.downtime, open.previous)
+	}
+
+	// A session still held by a connection is taken over from it, which
+	// then can't detach it
+	third := &StratumClient{}
+	if open = table.open(session.id, third, "", now.Add(2*time.Minute)); open.previous != second {
+		t.Errorf("taken over from %p, want %p", open.previous, second)
+	}
+	table.close(second, session, big.NewInt(1), now.Add(2*time.Minute))
+	table.close(third, session, big.NewInt(8192), now.Add(2*time.Minute))
+	if open = table.open(session.id, &StratumClient{}, "", now.Add(3*time.Minute)); open.difficulty.Int64() != 8192 {
+		t.Errorf("difficulty = %v, want that of the connection holding the session", open.difficulty)
+	}
+
+	// Sessions expire once disconnected for the resume window
+	table.close(open.session.client, session, big.NewInt(8192), now.Add(3*time.Minute))
+	table.open("", &StratumClient{}, "", now.Add(3*time.Minute+sessionResumeWindow))
+	if open = table.open(session.id, &StratumClient{}, "", now.Add(4*time.Minute+sessionResumeWindow)); open.resumed {
+		t.Error("expired session resumed")
+	}
+
+	// Unknown IDs start a new session
+	if open = table.open("0123456789abcdef", &StratumClient{}, "", now); open.resumed || open.session.id == "0123456789abcdef" {
+		t.Errorf("unknown session = %+v", open)
+	}
+
+	table.forget("rig1")
+	if _, ok := table.sessions[session.id]; ok {
+		t.Error("forgotten worker's session kept")
+	}
+}
+
+func TestVarDiffResume(t *testing.T) {
+	v := &VarDiffManager{config: testVarDiffConfig(), miners: make(map[string]*MinerVarDiff)}
+	v.Resume("unknown", time.Minute) // No state to carry over
+
+	lastShare := time.Now().Add(-5 * time.Minute)
+	v.GetMinerDiff("rig1").lastShareTime = lastShare
+	v.Resume("rig1", 4*time.Minute)
+	if got := v.GetMinerDiff("rig1").lastShareTime; !got.Equal(lastShare.Add(4 * time.Minute)) {
+		t.Errorf("last share moved to %v, want 4 minutes later than %v", got, lastShare)
+	}
+}
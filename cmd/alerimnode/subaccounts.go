@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// maxSubAccountName bounds sub-account names
+const maxSubAccountName = 64
+
+var (
+	errSubAccountExists   = errors.New("sub-account already exists")
+	errSubAccountNotFound = errors.New("sub-account not found")
+)
+
+// SubAccount is a named group of a user's workers, e.g. the rigs at one
+// site or those of one hosting customer. Its payout configuration, if
+// set, replaces that of its workers.
+type SubAccount struct {
+	UserID       string        `json:"user_id"`
+	Name         string        `json:"name"`
+	Workers      []string      `json:"workers"` // Miner IDs
+	Address      string        `json:"address,omitempty"`
+	PayoutSplits []PayoutSplit `json:"payout_splits,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// hasPayout reports whether the sub-account overrides its workers' payout
+// configuration
+func (a *SubAccount) hasPayout() bool {
+	return a.Address != "" || len(a.PayoutSplits) > 0
+}
+
+// SubAccountStats aggregates the stats of a sub-account's workers
+type SubAccountStats struct {
+	Workers     int               `json:"workers"`
+	Hashrate24h float64           `json:"hashrate_24h"`
+	BlocksFound int64             `json:"blocks_found"`
+	Balance     blockchain.Amount `json:"balance"`
+	Immature    blockchain.Amount `json:"immature"` // Part of the balance not yet matured
+}
+
+// subAccountKey identifies a sub-account: names are unique per user
+type subAccountKey struct {
+	userID, name string
+}
+
+// SubAccountStore keeps users' sub-accounts, persisted at path
+type SubAccountStore struct {
+	mu       sync.Mutex
+	path     string
+	accounts map[subAccountKey]*SubAccount
+}
+
+// subAccounts groups workers of farm operators; nil until loaded
+var subAccounts *SubAccountStore
+
+// NewSubAccountStore loads the sub-accounts persisted at path
+func NewSubAccountStore(path string) (*SubAccountStore, error) {
+	store := &SubAccountStore{
+		path:     path,
+		accounts: make(map[subAccountKey]*SubAccount),
+	}
+	var accounts []*SubAccount
+	if err := loadJSONFile(path, &accounts); err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		store.accounts[subAccountKey{account.UserID, account.Name}] = account
+	}
+	return store, nil
+}
+
+// save persists the sub-accounts; the caller must hold s.mu
+func (s *SubAccountStore) save() {
+	if s.path == "" {
+		return
+	}
+	accounts := make([]*SubAccount, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].UserID != accounts[j].UserID {
+			return accounts[i].UserID < accounts[j].UserID
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+	if err := saveJSONFile(s.path, accounts); err != nil {
+		log.Printf("Error saving sub-accounts: %v", err)
+	}
+}
+
+// validateSubAccountPayout checks a sub-account's payout configuration:
+// an address or splits, not both
+func validateSubAccountPayout(address string, splits []PayoutSplit) error {
+	if address != "" && len(splits) > 0 {
+		return errors.New("set a payout address or payout splits, not both")
+	}
+	return validatePayoutSplits(splits)
+}
+
+// Create adds a sub-account for a user
+func (s *SubAccountStore) Create(userID, name, address string, splits []PayoutSplit) (*SubAccount, error) {
+	if name == "" || len(name) > maxSubAccountName || strings.ContainsAny(name, "/?#") {
+		return nil, fmt.Errorf("name must be 1-%d characters without /, ? or #", maxSubAccountName)
+	}
+	if err := validateSubAccountPayout(address, splits); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := subAccountKey{userID, name}
+	if _, ok := s.accounts[key]; ok {
+		return nil, errSubAccountExists
+	}
+	account := &SubAccount{
+		UserID:       userID,
+		Name:         name,
+		Workers:      []string{},
+		Address:      address,
+		PayoutSplits: splits,
+		CreatedAt:    time.Now(),
+	}
+	s.accounts[key] = account
+	s.save()
+	copied := *account
+	return &copied, nil
+}
+
+// SetPayout replaces a sub-account's payout configuration; an empty
+// address and no splits pay each worker by its own configuration again
+func (s *SubAccountStore) SetPayout(userID, name, address string, splits []PayoutSplit) (*SubAccount, error) {
+	if err := validateSubAccountPayout(address, splits); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[subAccountKey{userID, name}]
+	if !ok {
+		return nil, errSubAccountNotFound
+	}
+	account.Address = address
+	account.PayoutSplits = splits
+	s.save()
+	copied := *account
+	return &copied, nil
+}
+
+// Delete removes a sub-account; its workers go back to being paid by
+// their own configuration
+func (s *SubAccountStore) Delete(userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := subAccountKey{userID, name}
+	if _, ok := s.accounts[key]; !ok {
+		return errSubAccountNotFound
+	}
+	delete(s.accounts, key)
+	s.save()
+	return nil
+}
+
+// Assign moves a worker into one of its user's sub-accounts, out of any
+// other. An empty name only takes it out.
+func (s *SubAccountStore) Assign(userID, name, minerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var target *SubAccount
+	if name != "" {
+		var ok bool
+		if target, ok = s.accounts[subAccountKey{userID, name}]; !ok {
+			return errSubAccountNotFound
+		}
+	}
+	s.remove(minerID)
+	if target != nil {
+		target.Workers = append(target.Workers, minerID)
+	}
+	s.save()
+	return nil
+}
+
+// remove takes a worker out of its sub-account; the caller must hold s.mu
+func (s *SubAccountStore) remove(minerID string) {
+	for _, account := range s.accounts {
+		for i, worker := range account.Workers {
+			if worker == minerID {
+				account.Workers = append(account.Workers[:i:i], account.Workers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// List returns copies of a user's sub-accounts, by name
+func (s *SubAccountStore) List(userID string) []*SubAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := make([]*SubAccount, 0)
+	for _, account := range s.accounts {
+		if account.UserID == userID {
+			copied := *account
+			copied.Workers = append([]string{}, account.Workers...)
+			accounts = append(accounts, &copied)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts
+}
+
+// ForMiner returns a copy of the sub-account a worker is in, nil if none
+func (s *SubAccountStore) ForMiner(minerID string) *SubAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, account := range s.accounts {
+		for _, worker := range account.Workers {
+			if worker == minerID {
+				copied := *account
+				copied.Workers = append([]string{}, account.Workers...)
+				return &copied
+			}
+		}
+	}
+	return nil
+}
+
+// ForgetUser removes a deleted user's sub-accounts
+func (s *SubAccountStore) ForgetUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.accounts {
+		if key.userID == userID {
+			delete(s.accounts, key)
+		}
+	}
+	s.save()
+}
+
+// payoutMiner returns a miner with the payout configuration of its
+// sub-account, if that sets one. The miner must be a copy.
+func payoutMiner(miner *Miner) *Miner {
+	if subAccounts == nil {
+		return miner
+	}
+	if account := subAccounts.ForMiner(miner.ID); account != nil && account.hasPayout() {
+		miner.Address = account.Address
+		miner.PayoutSplits = account.PayoutSplits
+		miner.PayoutCurrency, miner.PayoutDestination = "", ""
+	}
+	return miner
+}
+
+// MinerBalances returns the summed balances of miners, and the part of
+// them not yet matured
+func (rm *RewardManager) MinerBalances(minerIDs []string) (balance, immature blockchain.Amount) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	for _, id := range minerIDs {
+		balance += rm.balances[id]
+		immature += rm.immatureCredit(id)
+	}
+	return balance, immature
+}
+
+// SubAccountStats aggregates the stats of a sub-account's workers
+func (p *MiningPool) SubAccountStats(account *SubAccount) SubAccountStats {
+	stats := SubAccountStats{Workers: len(account.Workers)}
+	for _, id := range account.Workers {
+		hashrate, blocks := p.minerSummary(id)
+		stats.Hashrate24h += hashrate
+		stats.BlocksFound += blocks
+	}
+	stats.Balance, stats.Immature = p.rewards.MinerBalances(account.Workers)
+	return stats
+}
+
+// subAccountError responds with the API error for a store error
+func subAccountError(c *gin.Context, err error) {
+	switch err {
+	case errSubAccountNotFound:
+		respondError(c, apiError(CodeNotFound, "Sub-account not found"))
+	case errSubAccountExists:
+		respondError(c, apiError(CodeConflict, "Sub-account already exists"))
+	default:
+		respondError(c, apiError(CodeInvalidRequest, err.Error()))
+	}
+}
+
+// registerSubAccountRoutes adds the endpoints farm operators manage their
+// sub-accounts with. Users may manage only their own, through API keys
+// with the manage-miners scope.
+func registerSubAccountRoutes(api *gin.RouterGroup, pool *MiningPool) {
+	type payoutRequest struct {
+		Address      string        `json:"address"`
+		PayoutSplits []PayoutSplit `json:"payout_splits"`
+	}
+	user := api.Group("/users/:id/subaccounts", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		if !authorizeUser(c, c.Param("id")) {
+			respondError(c, apiError(CodeForbidden, "Not allowed to manage this user's sub-accounts"))
+			c.Abort()
+			return
+		}
+		if findUser(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "User not found"))
+			c.Abort()
+		}
+	})
+
+	// Listed with their aggregated stats for the dashboard
+	user.GET("", func(c *gin.Context) {
+		accounts := subAccounts.List(c.Param("id"))
+		entries := make([]gin.H, 0, len(accounts))
+		for _, account := range accounts {
+			entries = append(entries, gin.H{
+				"sub_account": account,
+				"stats":       pool.SubAccountStats(account),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"sub_accounts": entries})
+	})
+
+	user.POST("", func(c *gin.Context) {
+		var req struct {
+			Name string `json:"name"`
+			payoutRequest
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		account, err := subAccounts.Create(c.Param("id"), req.Name, req.Address, req.PayoutSplits)
+		if err != nil {
+			subAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, account)
+	})
+
+	user.PUT("/:name/payout", func(c *gin.Context) {
+		var req payoutRequest
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		account, err := subAccounts.SetPayout(c.Param("id"), c.Param("name"), req.Address, req.PayoutSplits)
+		if err != nil {
+			subAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, account)
+	})
+
+	user.DELETE("/:name", func(c *gin.Context) {
+		if err := subAccounts.Delete(c.Param("id"), c.Param("name")); err != nil {
+			subAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	})
+
+	// Workers are moved between their user's sub-accounts
+	user.PUT("/:name/workers/:miner", func(c *gin.Context) {
+		miner := findMiner(c.Param("miner"))
+		if miner == nil || miner.UserID != c.Param("id") {
+			respondError(c, apiError(CodeNotFound, "Miner not found"))
+			return
+		}
+		if err := subAccounts.Assign(c.Param("id"), c.Param("name"), miner.ID); err != nil {
+			subAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "assigned"})
+	})
+
+	user.DELETE("/:name/workers/:miner", func(c *gin.Context) {
+		account := subAccounts.ForMiner(c.Param("miner"))
+		if account == nil || account.UserID != c.Param("id") || account.Name != c.Param("name") {
+			respondError(c, apiError(CodeNotFound, "Worker not in this sub-account"))
+			return
+		}
+		if err := subAccounts.Assign(c.Param("id"), "", c.Param("miner")); err != nil {
+			subAccountError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "removed"})
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSubAccountStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subaccounts.json")
+	store, err := NewSubAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Create("u1", "", "", nil); err == nil {
+		t.Error("empty name accepted")
+	}
+	if _, err := store.Create("u1", "site-a", "addr", []PayoutSplit{{"x", 100}}); err == nil {
+		t.Error("address and splits accepted together")
+	}
+	if _, err := store.Create("u1", "site-a", "", []PayoutSplit{{"x", 60}, {"y", 40}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("u1", "site-b", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("u1", "site-a", "", nil); err != errSubAccountExists {
+		t.Errorf("duplicate err = %v", err)
+	}
+	if _, err := store.Create("u2", "site-a", "", nil); err != nil {
+		t.Errorf("names are per user, got %v", err)
+	}
+
+	// A worker is in one sub-account at a time
+	if err := store.Assign("u1", "site-a", "rig1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Assign("u1", "site-b", "rig1"); err != nil {
+		t.Fatal(err)
+	}
+	if account := store.ForMiner("rig1"); account == nil || account.Name != "site-b" {
+		t.Fatalf("rig1 in %+v, want site-b", account)
+	}
+	if err := store.Assign("u1", "site-c", "rig1"); err != errSubAccountNotFound {
+		t.Errorf("unknown sub-account err = %v", err)
+	}
+	store.Assign("u1", "site-a", "rig2")
+
+	// Sub-accounts persist
+	reloaded, err := NewSubAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := reloaded.List("u1")
+	if len(accounts) != 2 || accounts[0].Name != "site-a" || len(accounts[0].Workers) != 1 || len(accounts[0].PayoutSplits) != 2 {
+		t.Fatalf("reloaded sub-accounts = %+v", accounts)
+	}
+
+	if err := store.Delete("u1", "site-b"); err != nil {
+		t.Fatal(err)
+	}
+	if store.ForMiner("rig1") != nil {
+		t.Error("worker of a deleted sub-account is still in it")
+	}
+	store.ForgetUser("u1")
+	if len(store.List("u1")) != 0 || len(store.List("u2")) != 1 {
+		t.Error("ForgetUser removed the wrong sub-accounts")
+	}
+}
+
+func TestPayoutMiner(t *testing.T) {
+	defer func(saved *SubAccountStore) { subAccounts = saved }(subAccounts)
+	subAccounts, _ = NewSubAccountStore("")
+	subAccounts.Create("u1", "hosted", "customer-addr", nil)
+	subAccounts.Create("u1", "stats-only", "", nil)
+	subAccounts.Assign("u1", "hosted", "rig1")
+	subAccounts.Assign("u1", "stats-only", "rig2")
+
+	miner := payoutMiner(&Miner{ID: "rig1", Address: "own", PayoutCurrency: "BTC"})
+	if miner.Address != "customer-addr" || miner.PayoutCurrency != "" {
+		t.Errorf("hosted rig paid to %q in %q", miner.Address, miner.PayoutCurrency)
+	}
+	// Sub-accounts without a payout configuration leave the worker's
+	if miner := payoutMiner(&Miner{ID: "rig2", Address: "own"}); miner.Address != "own" {
+		t.Errorf("rig2 paid to %q, want its own address", miner.Address)
+	}
+}
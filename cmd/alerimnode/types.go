@@ -1,7 +1,10 @@
 package main
 
 import (
+	"sync"
 	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
 )
 
 // User represents a registered user in the system
@@ -12,27 +15,41 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	LastLogin time.Time `json:"last_login"`
 	Status    string    `json:"status"`
+
+	VerificationStatus string `json:"verification_status,omitempty"`
+	VerificationRef    string `json:"verification_ref,omitempty"`
 }
 
 // Miner represents a mining worker in the network
 type Miner struct {
 	ID          string    `json:"id"`
+	UserID      string    `json:"user_id,omitempty"`
 	Name        string    `json:"name"`
 	Address     string    `json:"address"`
 	Hashrate    float64   `json:"hashrate"`
 	LastSeen    time.Time `json:"last_seen"`
 	Status      string    `json:"status"`
 	TotalShares int64     `json:"total_shares"`
+
+	// Optional conversion of payouts to another currency via the exchange
+	PayoutCurrency    string `json:"payout_currency,omitempty"`
+	PayoutDestination string `json:"payout_destination,omitempty"`
+
+	// Addresses payouts are split between instead of Address, if any
+	PayoutSplits []PayoutSplit `json:"payout_splits,omitempty"`
+
+	// Listed under a pseudonym on the public leaderboard
+	LeaderboardOptOut bool `json:"leaderboard_opt_out,omitempty"`
 }
 
 // Wallet represents a cryptocurrency wallet
 type Wallet struct {
-	Address     string    `json:"address"`
-	PublicKey   string    `json:"public_key"`
-	Balance     float64   `json:"balance"`
-	CreatedAt   time.Time `json:"created_at"`
-	LastUpdated time.Time `json:"last_updated"`
-	Status      string    `json:"status"`
+	Address     string            `json:"address"`
+	PublicKey   string            `json:"public_key"`
+	Balance     blockchain.Amount `json:"balance"`
+	CreatedAt   time.Time         `json:"created_at"`
+	LastUpdated time.Time         `json:"last_updated"`
+	Status      string            `json:"status"`
 }
 
 // Global state variables
@@ -40,4 +57,7 @@ var (
 	users        []*User
 	activeMiners []*Miner
 	wallets      []*Wallet
+
+	// registryMu guards users and activeMiners
+	registryMu sync.RWMutex
 )
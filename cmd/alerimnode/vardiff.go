@@ -1,9 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
 	"math/big"
+	"net/http"
 	"sync"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 // VarDiffConfig holds configuration for variable difficulty
@@ -16,14 +23,57 @@ type VarDiffConfig struct {
 	MinimumDiff     *big.Int      // Minimum allowed difficulty
 	MaximumDiff     *big.Int      // Maximum allowed difficulty
 	BufferSize      int           // Number of shares to keep for variance calculation
+	Algorithm       string        // VarDiffEMA, VarDiffWindow or VarDiffAB
+	EMAWeight       float64       // Weight of the latest share time in the average (e.g., 0.2)
+	Hysteresis      float64       // Band around the target time left alone, in percent (e.g., 25%)
+}
+
+// Vardiff algorithms
+const (
+	// VarDiffEMA retargets towards an exponential moving average of share
+	// times once it leaves the hysteresis band around the target
+	VarDiffEMA = "ema"
+	// VarDiffWindow retargets towards the mean of the buffered share
+	// times, skipping retargets while their variance is high
+	VarDiffWindow = "window"
+	// VarDiffAB assigns each worker one of the two by a hash of its ID, to
+	// compare them on the same pool
+	VarDiffAB = "ab"
+)
+
+// algorithmFor returns the algorithm retargeting a worker
+func (c *VarDiffConfig) algorithmFor(minerID string) string {
+	if c.Algorithm != VarDiffAB {
+		return c.Algorithm
+	}
+	h := fnv.New32a()
+	h.Write([]byte(minerID))
+	if h.Sum32()%2 == 0 {
+		return VarDiffEMA
+	}
+	return VarDiffWindow
 }
 
 // VarDiffManager manages variable difficulty for miners
 type VarDiffManager struct {
-	mu       sync.RWMutex
-	config   *VarDiffConfig
-	miners   map[string]*MinerVarDiff
-	pool     *MiningPool
+	mu        sync.RWMutex
+	config    *VarDiffConfig // Replaced, never modified, when changed at runtime
+	miners    map[string]*MinerVarDiff
+	pool      *MiningPool
+	retargets map[string]int // By algorithm, since start
+}
+
+// maxVarDiffHistory caps the retargets kept per worker
+const maxVarDiffHistory = 50
+
+// VarDiffRetarget is a change of a worker's difficulty
+type VarDiffRetarget struct {
+	Time        time.Time `json:"time"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	AverageTime float64   `json:"average_time,omitempty"` // Seconds between the shares that led to it
+	Algorithm   string    `json:"algorithm,omitempty"`
+	Reason      string    `json:"reason"`
 }
 
 // MinerVarDiff tracks vardiff state for a single miner
@@ -34,10 +84,29 @@ type MinerVarDiff struct {
 	lastRetarget  time.Time
 	lastShareTime time.Time
 	timeBuffer    []float64 // Buffer of share times for variance calculation
+	emaTime       float64   // Moving average of share times, 0 before the first
+	emaSamples    int       // Share times averaged since the last retarget
+	history       []VarDiffRetarget
+}
+
+// record appends a retarget to the history; the caller must hold m.mu
+func (m *MinerVarDiff) record(from, to *big.Int, averageTime float64, algorithm, reason string) {
+	m.history = append(m.history, VarDiffRetarget{
+		Time:        time.Now(),
+		From:        from.String(),
+		To:          to.String(),
+		AverageTime: averageTime,
+		Algorithm:   algorithm,
+		Reason:      reason,
+	})
+	if len(m.history) > maxVarDiffHistory {
+		m.history = m.history[len(m.history)-maxVarDiffHistory:]
+	}
 }
 
 // NewVarDiffManager creates a new vardiff manager
 func NewVarDiffManager(pool *MiningPool) *VarDiffManager {
+	initialDiff := pool.blockchain.InitialDifficulty()
 	return &VarDiffManager{
 		config: &VarDiffConfig{
 			TargetTime:      10 * time.Second,
@@ -45,15 +114,63 @@ func NewVarDiffManager(pool *MiningPool) *VarDiffManager {
 			VariancePercent: 30.0,
 			MaximumStep:     200.0,
 			MinimumStep:     50.0,
-			MinimumDiff:     new(big.Int).Set(blockchain.InitialDifficulty),
-			MaximumDiff:     new(big.Int).Mul(blockchain.InitialDifficulty, big.NewInt(1000000)),
+			MinimumDiff:     initialDiff,
+			MaximumDiff:     new(big.Int).Mul(initialDiff, big.NewInt(1000000)),
 			BufferSize:      30,
+			Algorithm:       VarDiffEMA,
+			EMAWeight:       0.2,
+			Hysteresis:      25.0,
 		},
-		miners: make(map[string]*MinerVarDiff),
-		pool:   pool,
+		miners:    make(map[string]*MinerVarDiff),
+		pool:      pool,
+		retargets: make(map[string]int),
 	}
 }
 
+// Config returns the vardiff configuration, which must not be modified
+func (v *VarDiffManager) Config() *VarDiffConfig {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.config
+}
+
+// SetConfig replaces the vardiff configuration. Workers keep their
+// difficulty until their next retarget.
+func (v *VarDiffManager) SetConfig(config *VarDiffConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.config = config
+	return nil
+}
+
+// validate checks a configuration is usable
+func (c *VarDiffConfig) validate() error {
+	switch {
+	case c.TargetTime <= 0 || c.RetargetTime <= 0:
+		return errors.New("target and retarget times must be positive")
+	case c.VariancePercent < 0:
+		return errors.New("variance percent must not be negative")
+	case c.MaximumStep < 100 || c.MinimumStep <= 0 || c.MinimumStep > 100:
+		return errors.New("maximum step must be at least 100% and minimum step within (0, 100]%")
+	case c.MinimumDiff == nil || c.MinimumDiff.Sign() <= 0:
+		return errors.New("minimum difficulty must be positive")
+	case c.MaximumDiff == nil || c.MaximumDiff.Cmp(c.MinimumDiff) < 0:
+		return errors.New("maximum difficulty must not be below the minimum")
+	case c.BufferSize < 2:
+		return errors.New("buffer size must be at least 2")
+	case c.Algorithm != VarDiffEMA && c.Algorithm != VarDiffWindow && c.Algorithm != VarDiffAB:
+		return fmt.Errorf("unknown algorithm %q: want %s, %s or %s", c.Algorithm, VarDiffEMA, VarDiffWindow, VarDiffAB)
+	case c.EMAWeight <= 0 || c.EMAWeight > 1:
+		return errors.New("EMA weight must be within (0, 1]")
+	case c.Hysteresis < 0 || c.Hysteresis >= 100:
+		return errors.New("hysteresis must be within [0, 100)%")
+	}
+	return nil
+}
+
 // GetMinerDiff gets or creates miner vardiff state
 func (v *VarDiffManager) GetMinerDiff(minerID string) *MinerVarDiff {
 	v.mu.Lock()
@@ -73,83 +190,167 @@ func (v *VarDiffManager) GetMinerDiff(minerID string) *MinerVarDiff {
 	return miner
 }
 
-// RecordShare records a share submission and updates difficulty if needed
-func (v *VarDiffManager) RecordShare(minerID string) {
+// Forget drops a miner's vardiff state
+func (v *VarDiffManager) Forget(minerID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.miners, minerID)
+}
+
+// RecordShare records a share submission, accepted at difficulty, and
+// retargets the worker when due
+//
+// The caller must hold v.pool.mu, through which adjustments are applied.
+func (v *VarDiffManager) RecordShare(minerID string, difficulty *big.Int) {
+	config := v.Config()
 	miner := v.GetMinerDiff(minerID)
 	miner.mu.Lock()
 	defer miner.mu.Unlock()
 
 	now := time.Now()
 
+	// The difficulty may have been set elsewhere, raised for an anomaly or
+	// kept from another pool instance. Share times measured at another
+	// difficulty don't apply to it.
+	if miner.currentDiff.Cmp(difficulty) != 0 {
+		miner.currentDiff.Set(difficulty)
+		miner.restart()
+	}
+
 	// Calculate time since last share
 	if !miner.lastShareTime.IsZero() {
 		timeDiff := now.Sub(miner.lastShareTime).Seconds()
 		miner.timeBuffer = append(miner.timeBuffer, timeDiff)
-		if len(miner.timeBuffer) > v.config.BufferSize {
-			miner.timeBuffer = miner.timeBuffer[1:]
+		if len(miner.timeBuffer) > config.BufferSize {
+			miner.timeBuffer = miner.timeBuffer[len(miner.timeBuffer)-config.BufferSize:]
 		}
+		miner.observe(timeDiff, config.EMAWeight)
 	}
 
 	miner.lastShareTime = now
 	miner.shares = append(miner.shares, now)
-	if len(miner.shares) > v.config.BufferSize {
-		miner.shares = miner.shares[1:]
+	if len(miner.shares) > config.BufferSize {
+		miner.shares = miner.shares[len(miner.shares)-config.BufferSize:]
 	}
 
 	// Check if it's time to adjust difficulty
-	if now.Sub(miner.lastRetarget) >= v.config.RetargetTime {
-		v.adjustDifficulty(minerID, miner)
+	if now.Sub(miner.lastRetarget) >= config.RetargetTime {
+		v.adjustDifficulty(minerID, miner, config)
 	}
 }
 
-// adjustDifficulty calculates and sets new difficulty for a miner
-func (v *VarDiffManager) adjustDifficulty(minerID string, miner *MinerVarDiff) {
-	if len(miner.timeBuffer) < 2 {
+// Resume carries a worker's share-time measurement over a reconnect,
+// leaving out the time it was disconnected
+func (v *VarDiffManager) Resume(minerID string, downtime time.Duration) {
+	v.mu.RLock()
+	miner, ok := v.miners[minerID]
+	v.mu.RUnlock()
+	if !ok {
 		return
 	}
 
+	miner.mu.Lock()
+	defer miner.mu.Unlock()
+	if !miner.lastShareTime.IsZero() {
+		miner.lastShareTime = miner.lastShareTime.Add(downtime)
+	}
+}
+
+// observe adds a share time to the moving average; the caller must hold
+// m.mu
+func (m *MinerVarDiff) observe(seconds, weight float64) {
+	if m.emaTime == 0 {
+		m.emaTime = seconds
+	} else {
+		m.emaTime += weight * (seconds - m.emaTime)
+	}
+	m.emaSamples++
+}
+
+// restart drops the share times measured so far; the caller must hold m.mu
+func (m *MinerVarDiff) restart() {
+	m.lastShareTime = time.Time{}
+	m.shares = m.shares[:0]
+	m.timeBuffer = m.timeBuffer[:0]
+	m.emaTime = 0
+	m.emaSamples = 0
+}
+
+// windowShareTime returns the mean of the buffered share times, and
+// whether their variance is low enough to retarget on; the caller must
+// hold m.mu
+func (m *MinerVarDiff) windowShareTime(config *VarDiffConfig) (float64, bool) {
+	if len(m.timeBuffer) < 2 {
+		return 0, false
+	}
+
 	// Calculate average share time
 	var totalTime float64
-	for _, t := range miner.timeBuffer {
+	for _, t := range m.timeBuffer {
 		totalTime += t
 	}
-	averageTime := totalTime / float64(len(miner.timeBuffer))
+	averageTime := totalTime / float64(len(m.timeBuffer))
 
 	// Calculate variance
 	var variance float64
-	for _, t := range miner.timeBuffer {
+	for _, t := range m.timeBuffer {
 		diff := t - averageTime
 		variance += diff * diff
 	}
-	variance /= float64(len(miner.timeBuffer))
-	
+	variance /= float64(len(m.timeBuffer))
+
 	// Skip adjustment if variance is too high
-	if variance > (averageTime * v.config.VariancePercent / 100.0) {
+	return averageTime, variance <= averageTime*config.VariancePercent/100.0
+}
+
+// emaShareTime returns the moving average of share times, and whether it
+// is outside the hysteresis band around the target time; the caller must
+// hold m.mu
+func (m *MinerVarDiff) emaShareTime(config *VarDiffConfig) (float64, bool) {
+	if m.emaSamples < 2 {
+		return 0, false
+	}
+	targetSeconds := config.TargetTime.Seconds()
+	band := targetSeconds * config.Hysteresis / 100.0
+	return m.emaTime, math.Abs(m.emaTime-targetSeconds) > band
+}
+
+// adjustDifficulty calculates and sets new difficulty for a miner
+func (v *VarDiffManager) adjustDifficulty(minerID string, miner *MinerVarDiff, config *VarDiffConfig) {
+	algorithm := config.algorithmFor(minerID)
+	var averageTime float64
+	var retarget bool
+	if algorithm == VarDiffEMA {
+		averageTime, retarget = miner.emaShareTime(config)
+	} else {
+		averageTime, retarget = miner.windowShareTime(config)
+	}
+	if !retarget {
 		return
 	}
 
 	// Calculate ideal adjustment factor
-	targetSeconds := v.config.TargetTime.Seconds()
+	targetSeconds := config.TargetTime.Seconds()
 	adjustment := targetSeconds / averageTime
 
 	// Apply adjustment limits
-	if adjustment > v.config.MaximumStep/100.0 {
-		adjustment = v.config.MaximumStep/100.0
-	} else if adjustment < v.config.MinimumStep/100.0 {
-		adjustment = v.config.MinimumStep/100.0
+	if adjustment > config.MaximumStep/100.0 {
+		adjustment = config.MaximumStep / 100.0
+	} else if adjustment < config.MinimumStep/100.0 {
+		adjustment = config.MinimumStep / 100.0
 	}
 
 	// Calculate new difficulty
 	newDiff := new(big.Float).SetInt(miner.currentDiff)
 	newDiff.Mul(newDiff, big.NewFloat(adjustment))
-	
+
 	finalDiff, _ := newDiff.Int(nil)
 
 	// Apply min/max limits
-	if finalDiff.Cmp(v.config.MinimumDiff) < 0 {
-		finalDiff.Set(v.config.MinimumDiff)
-	} else if finalDiff.Cmp(v.config.MaximumDiff) > 0 {
-		finalDiff.Set(v.config.MaximumDiff)
+	if finalDiff.Cmp(config.MinimumDiff) < 0 {
+		finalDiff.Set(config.MinimumDiff)
+	} else if finalDiff.Cmp(config.MaximumDiff) > 0 {
+		finalDiff.Set(config.MaximumDiff)
 	}
 
 	// Only update if difficulty changed significantly (>1%)
@@ -158,25 +359,26 @@ func (v *VarDiffManager) adjustDifficulty(minerID string, miner *MinerVarDiff) {
 	if changeValue < 0.99 || changeValue > 1.01 {
 		// Record the change
 		reason := "VarDiff adjustment"
-		if stats, ok := v.pool.miners[minerID]; ok {
-			stats.RecordDifficultyChange(finalDiff, reason)
-		}
+		v.pool.statsFor(minerID).RecordDifficultyChange(finalDiff, reason)
+		miner.record(miner.currentDiff, finalDiff, averageTime, algorithm, reason)
+		v.mu.Lock()
+		v.retargets[algorithm]++
+		v.mu.Unlock()
+		metrics.Inc("alerim_vardiff_retargets_total", "algorithm", algorithm)
 
 		// Update difficulty
 		miner.currentDiff.Set(finalDiff)
 		miner.lastRetarget = time.Now()
 		miner.timeBuffer = miner.timeBuffer[:0]
 
-		// Notify stratum client
-		if v.pool.stratum != nil {
-			if client, exists := v.pool.stratum.clients[minerID]; exists {
-				client.difficulty = finalDiff
-				client.sendResponse(StratumResponse{
-					Method: "mining.set_difficulty",
-					Params: []interface{}{fmt.Sprintf("%x", finalDiff)},
-				})
-			}
-		}
+		// Share times scale with the difficulty, so the average carries
+		// over to the new one instead of pulling it back
+		miner.emaTime *= changeValue
+		miner.emaSamples = 0
+
+		// Shares are checked at the new difficulty, and the stratum client
+		// is notified
+		v.pool.setWorkerDifficulty(minerID, finalDiff)
 	}
 }
 
@@ -203,13 +405,278 @@ func (v *VarDiffManager) GetStats(minerID string) map[string]interface{} {
 		averageTime = total / float64(len(miner.timeBuffer))
 	}
 
+	config := v.Config()
 	return map[string]interface{}{
 		"current_diff":     miner.currentDiff,
 		"average_time":     averageTime,
+		"ema_time":         miner.emaTime,
 		"buffer_size":      len(miner.timeBuffer),
 		"last_retarget":    miner.lastRetarget,
 		"last_share_time":  miner.lastShareTime,
-		"target_time":      v.config.TargetTime.Seconds(),
-		"variance_percent": v.config.VariancePercent,
+		"target_time":      config.TargetTime.Seconds(),
+		"variance_percent": config.VariancePercent,
+	}
+}
+
+// VarDiffState is a worker's vardiff state
+type VarDiffState struct {
+	Worker       string            `json:"worker"`
+	Difficulty   string            `json:"difficulty"`
+	Algorithm    string            `json:"algorithm"`
+	ShareTimes   []float64         `json:"share_times"` // Seconds between recent shares, oldest first
+	EMATime      float64           `json:"ema_time"`    // Moving average of share times, seconds
+	LastRetarget time.Time         `json:"last_retarget"`
+	LastShare    time.Time         `json:"last_share"`
+	History      []VarDiffRetarget `json:"history"` // Oldest first
+}
+
+// State returns a worker's vardiff state, if it has any
+func (v *VarDiffManager) State(minerID string) (VarDiffState, bool) {
+	v.mu.RLock()
+	miner, ok := v.miners[minerID]
+	v.mu.RUnlock()
+	if !ok {
+		return VarDiffState{}, false
+	}
+
+	miner.mu.Lock()
+	defer miner.mu.Unlock()
+	return VarDiffState{
+		Worker:       minerID,
+		Difficulty:   miner.currentDiff.String(),
+		Algorithm:    v.Config().algorithmFor(minerID),
+		ShareTimes:   append([]float64{}, miner.timeBuffer...),
+		EMATime:      miner.emaTime,
+		LastRetarget: miner.lastRetarget,
+		LastShare:    miner.lastShareTime,
+		History:      append([]VarDiffRetarget{}, miner.history...),
+	}, true
+}
+
+// Reset sets a worker's difficulty, clamped to the configured bounds, and
+// restarts its share-time measurement. It returns the difficulty set.
+func (v *VarDiffManager) Reset(minerID string, difficulty *big.Int, reason string) *big.Int {
+	config := v.Config()
+	difficulty = new(big.Int).Set(difficulty)
+	if difficulty.Cmp(config.MinimumDiff) < 0 {
+		difficulty.Set(config.MinimumDiff)
+	} else if difficulty.Cmp(config.MaximumDiff) > 0 {
+		difficulty.Set(config.MaximumDiff)
+	}
+
+	miner := v.GetMinerDiff(minerID)
+	miner.mu.Lock()
+	defer miner.mu.Unlock()
+	miner.record(miner.currentDiff, difficulty, 0, "", reason)
+	miner.currentDiff.Set(difficulty)
+	miner.lastRetarget = time.Now()
+	miner.restart()
+	return difficulty
+}
+
+// VarDiffEvaluation compares how an algorithm keeps its workers' share
+// times on target
+type VarDiffEvaluation struct {
+	Algorithm     string  `json:"algorithm"`
+	Workers       int     `json:"workers"`
+	Retargets     int     `json:"retargets"`       // Since start
+	MeanShareTime float64 `json:"mean_share_time"` // Mean of the workers' moving averages, seconds
+	MeanError     float64 `json:"mean_error"`      // Mean distance of those from the target time, as a fraction of it
+}
+
+// Evaluation returns the share times of the workers of each algorithm in
+// use, to compare them when workers are split between the two
+func (v *VarDiffManager) Evaluation() []VarDiffEvaluation {
+	config := v.Config()
+	v.mu.RLock()
+	miners := make(map[string]*MinerVarDiff, len(v.miners))
+	for id, miner := range v.miners {
+		miners[id] = miner
+	}
+	retargets := make(map[string]int, len(v.retargets))
+	for algorithm, n := range v.retargets {
+		retargets[algorithm] = n
+	}
+	v.mu.RUnlock()
+
+	algorithms := []string{config.Algorithm}
+	if config.Algorithm == VarDiffAB {
+		algorithms = []string{VarDiffEMA, VarDiffWindow}
+	}
+	targetSeconds := config.TargetTime.Seconds()
+	evaluations := make([]VarDiffEvaluation, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		e := VarDiffEvaluation{Algorithm: algorithm, Retargets: retargets[algorithm]}
+		measured := 0
+		for id, miner := range miners {
+			if config.algorithmFor(id) != algorithm {
+				continue
+			}
+			e.Workers++
+			miner.mu.Lock()
+			emaTime := miner.emaTime
+			miner.mu.Unlock()
+			if emaTime == 0 {
+				continue
+			}
+			measured++
+			e.MeanShareTime += emaTime
+			e.MeanError += math.Abs(emaTime-targetSeconds) / targetSeconds
+		}
+		if measured > 0 {
+			e.MeanShareTime /= float64(measured)
+			e.MeanError /= float64(measured)
+		}
+		evaluations = append(evaluations, e)
+	}
+	return evaluations
+}
+
+// ResetWorkerDifficulty resets a worker's vardiff state to difficulty,
+// the vardiff minimum if nil, and applies it at once
+func (p *MiningPool) ResetWorkerDifficulty(minerID string, difficulty *big.Int, reason string) *big.Int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if difficulty == nil {
+		difficulty = p.vardiff.Config().MinimumDiff
+	}
+	difficulty = p.vardiff.Reset(minerID, difficulty, reason)
+	p.statsFor(minerID).RecordDifficultyChange(difficulty, reason)
+	p.setWorkerDifficulty(minerID, difficulty)
+	return difficulty
+}
+
+// varDiffConfigView is the vardiff configuration in the admin API
+type varDiffConfigView struct {
+	TargetTime      float64 `json:"target_time"`   // Seconds
+	RetargetTime    float64 `json:"retarget_time"` // Seconds
+	VariancePercent float64 `json:"variance_percent"`
+	MaximumStep     float64 `json:"maximum_step"` // Percent
+	MinimumStep     float64 `json:"minimum_step"` // Percent
+	MinimumDiff     string  `json:"minimum_diff"`
+	MaximumDiff     string  `json:"maximum_diff"`
+	BufferSize      int     `json:"buffer_size"`
+	Algorithm       string  `json:"algorithm"`
+	EMAWeight       float64 `json:"ema_weight"`
+	Hysteresis      float64 `json:"hysteresis"` // Percent
+}
+
+// view returns the configuration as shown in the admin API
+func (c *VarDiffConfig) view() varDiffConfigView {
+	return varDiffConfigView{
+		TargetTime:      c.TargetTime.Seconds(),
+		RetargetTime:    c.RetargetTime.Seconds(),
+		VariancePercent: c.VariancePercent,
+		MaximumStep:     c.MaximumStep,
+		MinimumStep:     c.MinimumStep,
+		MinimumDiff:     c.MinimumDiff.String(),
+		MaximumDiff:     c.MaximumDiff.String(),
+		BufferSize:      c.BufferSize,
+		Algorithm:       c.Algorithm,
+		EMAWeight:       c.EMAWeight,
+		Hysteresis:      c.Hysteresis,
 	}
 }
+
+// config parses a configuration from the admin API
+func (view varDiffConfigView) config() (*VarDiffConfig, error) {
+	config := &VarDiffConfig{
+		TargetTime:      time.Duration(view.TargetTime * float64(time.Second)),
+		RetargetTime:    time.Duration(view.RetargetTime * float64(time.Second)),
+		VariancePercent: view.VariancePercent,
+		MaximumStep:     view.MaximumStep,
+		MinimumStep:     view.MinimumStep,
+		BufferSize:      view.BufferSize,
+		Algorithm:       view.Algorithm,
+		EMAWeight:       view.EMAWeight,
+		Hysteresis:      view.Hysteresis,
+	}
+	var ok bool
+	if config.MinimumDiff, ok = new(big.Int).SetString(view.MinimumDiff, 10); !ok {
+		return nil, errors.New("invalid minimum difficulty")
+	}
+	if config.MaximumDiff, ok = new(big.Int).SetString(view.MaximumDiff, 10); !ok {
+		return nil, errors.New("invalid maximum difficulty")
+	}
+	return config, config.validate()
+}
+
+// registerVarDiffRoutes adds the vardiff inspection and control endpoints,
+// which require an admin session. Changes are recorded in the audit log.
+func registerVarDiffRoutes(api *gin.RouterGroup, pool *MiningPool, audit *AuditLog) {
+	api.GET("/admin/vardiff", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, pool.vardiff.Config().view())
+	})
+
+	// Fields left out keep their current values
+	api.PUT("/admin/vardiff", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			varDiffConfigView
+			Reason string `json:"reason"`
+		}
+		req.varDiffConfigView = pool.vardiff.Config().view()
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		config, err := req.config()
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		previous := pool.vardiff.Config().view()
+		if err := pool.vardiff.SetConfig(config); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		audit.Record(requestActor(c), AuditVarDiffConfig, "vardiff", req.Reason, map[string]interface{}{
+			"from": previous,
+			"to":   config.view(),
+		})
+		c.JSON(http.StatusOK, config.view())
+	})
+
+	api.GET("/admin/vardiff/evaluation", authMiddleware(""), func(c *gin.Context) {
+		c.JSON(http.StatusOK, pool.vardiff.Evaluation())
+	})
+
+	api.GET("/admin/vardiff/workers/:id", authMiddleware(""), func(c *gin.Context) {
+		state, ok := pool.vardiff.State(c.Param("id"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Worker has no vardiff state"))
+			return
+		}
+		c.JSON(http.StatusOK, state)
+	})
+
+	api.POST("/admin/vardiff/workers/:id/reset", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Difficulty string `json:"difficulty"` // Decimal, the minimum when empty
+			Reason     string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		var difficulty *big.Int
+		if req.Difficulty != "" {
+			var ok bool
+			if difficulty, ok = new(big.Int).SetString(req.Difficulty, 10); !ok || difficulty.Sign() <= 0 {
+				respondError(c, apiError(CodeInvalidRequest, "Invalid difficulty"))
+				return
+			}
+		}
+
+		minerID := c.Param("id")
+		difficulty = pool.ResetWorkerDifficulty(minerID, difficulty, "admin reset")
+		audit.Record(requestActor(c), AuditVarDiffReset, minerID, req.Reason, map[string]interface{}{
+			"difficulty": difficulty.String(),
+		})
+		state, _ := pool.vardiff.State(minerID)
+		c.JSON(http.StatusOK, state)
+	})
+}
+
+func init() {
+	metrics.Describe("alerim_vardiff_retargets_total", "Worker difficulty retargets by vardiff algorithm")
+}
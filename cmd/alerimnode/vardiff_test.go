@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testVarDiffConfig() *VarDiffConfig {
+	return &VarDiffConfig{
+		TargetTime:      10 * time.Second,
+		RetargetTime:    2 * time.Minute,
+		VariancePercent: 30,
+		MaximumStep:     200,
+		MinimumStep:     50,
+		MinimumDiff:     big.NewInt(10),
+		MaximumDiff:     big.NewInt(1000),
+		BufferSize:      30,
+		Algorithm:       VarDiffEMA,
+		EMAWeight:       0.2,
+		Hysteresis:      25,
+	}
+}
+
+func TestVarDiffConfigView(t *testing.T) {
+	view := testVarDiffConfig().view()
+	config, err := view.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.view() != view {
+		t.Errorf("round trip changed %+v to %+v", view, config.view())
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*varDiffConfigView)
+	}{
+		{"zero target time", func(v *varDiffConfigView) { v.TargetTime = 0 }},
+		{"negative retarget time", func(v *varDiffConfigView) { v.RetargetTime = -1 }},
+		{"maximum step below 100%", func(v *varDiffConfigView) { v.MaximumStep = 90 }},
+		{"zero minimum step", func(v *varDiffConfigView) { v.MinimumStep = 0 }},
+		{"minimum above maximum", func(v *varDiffConfigView) { v.MinimumDiff = "2000" }},
+		{"zero minimum", func(v *varDiffConfigView) { v.MinimumDiff = "0" }},
+		{"malformed maximum", func(v *varDiffConfigView) { v.MaximumDiff = "1e6" }},
+		{"tiny buffer", func(v *varDiffConfigView) { v.BufferSize = 1 }},
+		{"unknown algorithm", func(v *varDiffConfigView) { v.Algorithm = "pid" }},
+		{"zero EMA weight", func(v *varDiffConfigView) { v.EMAWeight = 0 }},
+		{"hysteresis of 100%", func(v *varDiffConfigView) { v.Hysteresis = 100 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := view
+			tt.modify(&v)
+			if _, err := v.config(); err == nil {
+				t.Error("invalid configuration accepted")
+			}
+		})
+	}
+}
+
+func TestVarDiffReset(t *testing.T) {
+	v := &VarDiffManager{config: testVarDiffConfig(), miners: make(map[string]*MinerVarDiff)}
+	if _, ok := v.State("w1"); ok {
+		t.Fatal("unknown worker has state")
+	}
+
+	tests := []struct {
+		difficulty int64
+		want       int64
+	}{
+		{100, 100},
+		{5, 10},       // Clamped to the minimum
+		{50000, 1000}, // Clamped to the maximum
+	}
+	for _, tt := range tests {
+		if got := v.Reset("w1", big.NewInt(tt.difficulty), "admin reset"); got.Int64() != tt.want {
+			t.Errorf("Reset(%d) = %s, want %d", tt.difficulty, got, tt.want)
+		}
+	}
+
+	state, ok := v.State("w1")
+	if !ok || state.Difficulty != "1000" || len(state.ShareTimes) != 0 {
+		t.Fatalf("state = %+v", state)
+	}
+	if len(state.History) != 3 || state.History[0].From != "10" || state.History[2].To != "1000" {
+		t.Errorf("history = %+v", state.History)
+	}
+
+	// The configuration is replaced, not modified
+	old := v.Config()
+	config := testVarDiffConfig()
+	config.TargetTime = 30 * time.Second
+	if err := v.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if old.TargetTime != 10*time.Second || v.Config().TargetTime != 30*time.Second {
+		t.Error("configuration not replaced")
+	}
+	config = testVarDiffConfig()
+	config.BufferSize = 0
+	if err := v.SetConfig(config); err == nil || v.Config().TargetTime != 30*time.Second {
+		t.Error("invalid configuration applied")
+	}
+}
+
+func TestVarDiffShareTime(t *testing.T) {
+	config := testVarDiffConfig()
+	tests := []struct {
+		name       string
+		shareTimes []float64
+		ema        bool // Whether the EMA retargets
+		window     bool // Whether the window mean retargets
+	}{
+		{"on target", []float64{10, 10, 10, 10}, false, true},
+		{"within the band", []float64{12, 11, 12, 12}, false, true},
+		{"too fast", []float64{2, 2, 2, 2}, true, true},
+		// Only the EMA retargets on irregular share times
+		{"too slow and irregular", []float64{5, 60, 20, 90}, true, false},
+		{"one share time", []float64{2}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MinerVarDiff{}
+			for _, seconds := range tt.shareTimes {
+				m.timeBuffer = append(m.timeBuffer, seconds)
+				m.observe(seconds, config.EMAWeight)
+			}
+			if _, ok := m.emaShareTime(config); ok != tt.ema {
+				t.Errorf("EMA retargets = %v, want %v (average %.2f)", ok, tt.ema, m.emaTime)
+			}
+			if _, ok := m.windowShareTime(config); ok != tt.window {
+				t.Errorf("window retargets = %v, want %v", ok, tt.window)
+			}
+		})
+	}
+}
+
+func TestVarDiffAlgorithmFor(t *testing.T) {
+	config := testVarDiffConfig()
+	config.Algorithm = VarDiffAB
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("worker%d", i)
+		algorithm := config.algorithmFor(id)
+		if algorithm != config.algorithmFor(id) {
+			t.Fatalf("%s assigned inconsistently", id)
+		}
+		counts[algorithm]++
+	}
+	if len(counts) != 2 || counts[VarDiffEMA] < 400 || counts[VarDiffWindow] < 400 {
+		t.Errorf("split = %v", counts)
+	}
+
+	config.Algorithm = VarDiffWindow
+	if got := config.algorithmFor("worker1"); got != VarDiffWindow {
+		t.Errorf("algorithmFor = %s, want %s", got, VarDiffWindow)
+	}
+}
+
+func TestVarDiffEvaluation(t *testing.T) {
+	config := testVarDiffConfig()
+	config.Algorithm = VarDiffAB
+	v := &VarDiffManager{config: config, miners: make(map[string]*MinerVarDiff), retargets: make(map[string]int)}
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("worker%d", i)
+		miner := v.GetMinerDiff(id)
+		if config.algorithmFor(id) == VarDiffEMA {
+			miner.emaTime = 12 // 20% off target
+		} else {
+			miner.emaTime = 5 // 50% off target
+		}
+	}
+	v.GetMinerDiff("idle") // Not measured yet
+	v.retargets[VarDiffWindow] = 3
+
+	evaluations := v.Evaluation()
+	if len(evaluations) != 2 {
+		t.Fatalf("evaluations = %+v", evaluations)
+	}
+	workers := 0
+	for _, e := range evaluations {
+		workers += e.Workers
+		want := map[string]float64{VarDiffEMA: 0.2, VarDiffWindow: 0.5}[e.Algorithm]
+		if math.Abs(e.MeanError-want) > 1e-9 {
+			t.Errorf("%s mean error = %f, want %f", e.Algorithm, e.MeanError, want)
+		}
+		if e.Algorithm == VarDiffWindow && e.Retargets != 3 {
+			t.Errorf("window retargets = %d, want 3", e.Retargets)
+		}
+	}
+	if workers != 21 {
+		t.Errorf("workers = %d, want 21", workers)
+	}
+}
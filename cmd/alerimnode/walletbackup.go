@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// walletBackupVersion is the format version of wallet backups
+const walletBackupVersion = 1
+
+// walletBackup is the content of an encrypted wallet backup file
+type walletBackup struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	PublicKey string    `json:"public_key"` // Hex, uncompressed
+	Key       string    `json:"key"`        // Hex private key scalar
+}
+
+// WalletBackups writes encrypted backups of the pool wallet key to a
+// directory, keeping the newest ones, and checks each backup can be
+// restored before counting it done
+type WalletBackups struct {
+	dir        string
+	passphrase string
+	keep       int
+	key        *ecdsa.PrivateKey
+	alert      string // Command or webhook alerted on failures, see runJSONHook
+}
+
+// NewWalletBackups creates a backup writer for key, keeping the newest
+// keep backups in dir, encrypted with passphrase
+func NewWalletBackups(dir, passphrase string, keep int, key *ecdsa.PrivateKey, alert string) (*WalletBackups, error) {
+	if passphrase == "" {
+		return nil, errors.New("wallet backups require a passphrase")
+	}
+	if keep < 1 {
+		return nil, errors.New("at least one wallet backup must be kept")
+	}
+	return &WalletBackups{dir: dir, passphrase: passphrase, keep: keep, key: key, alert: alert}, nil
+}
+
+// encodeWalletBackup encrypts a backup of key with passphrase
+func encodeWalletBackup(key *ecdsa.PrivateKey, passphrase string, now time.Time) ([]byte, error) {
+	data, err := json.Marshal(walletBackup{
+		Version:   walletBackupVersion,
+		CreatedAt: now.UTC(),
+		PublicKey: hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)),
+		Key:       hex.EncodeToString(key.D.FillBytes(make([]byte, 32))),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return EncryptSecret(passphrase, data)
+}
+
+// verifyWalletBackup decrypts a backup and checks its key is consistent
+// and, unless live is nil, the same as the live wallet's
+func verifyWalletBackup(data []byte, passphrase string, live *ecdsa.PrivateKey) (*walletBackup, error) {
+	plaintext, err := DecryptSecret(passphrase, data)
+	if err != nil {
+		return nil, err
+	}
+	var backup walletBackup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	if backup.Version != walletBackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", backup.Version)
+	}
+	key, err := parsePrivateKey([]byte(backup.Key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup key: %v", err)
+	}
+	if hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)) != backup.PublicKey {
+		return nil, errors.New("backup key does not match its public key")
+	}
+	if live != nil && key.D.Cmp(live.D) != 0 {
+		return nil, errors.New("backup key does not match the live wallet key")
+	}
+	return &backup, nil
+}
+
+// Backup writes a new backup, reads it back to verify it and removes the
+// oldest backups beyond the number kept. It returns the backup's path.
+func (b *WalletBackups) Backup(now time.Time) (string, error) {
+	data, err := encodeWalletBackup(b.key, b.passphrase, now)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(b.dir, "wallet-"+now.UTC().Format("20060102T150405Z")+".enc")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := verifyWalletBackup(written, b.passphrase, b.key); err != nil {
+		return "", fmt.Errorf("backup %s failed verification: %v", path, err)
+	}
+	return path, b.rotate()
+}
+
+// rotate removes all but the newest backups kept
+func (b *WalletBackups) rotate() error {
+	backups, err := filepath.Glob(filepath.Join(b.dir, "wallet-*.enc"))
+	if err != nil {
+		return err
+	}
+	// Names sort by their timestamp
+	sort.Strings(backups)
+	for len(backups) > b.keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Start backs up the wallet now and then every interval, logging and
+// alerting on failures
+func (b *WalletBackups) Start(interval time.Duration) {
+	go func() {
+		for {
+			if path, err := b.Backup(time.Now()); err != nil {
+				log.Printf("Wallet backup failed: %v", err)
+				b.alertFailure(err)
+			} else {
+				log.Printf("Backed up pool wallet to %s", path)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// alertFailure delivers a failed backup event to the alert hook
+func (b *WalletBackups) alertFailure(backupErr error) {
+	if b.alert == "" {
+		return
+	}
+	body, err := json.MarshalIndent(map[string]interface{}{
+		"event": "wallet-backup-failed",
+		"dir":   b.dir,
+		"error": backupErr.Error(),
+		"time":  time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding wallet backup alert: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if err := runJSONHook(client, b.alert, body); err != nil {
+		log.Printf("Error delivering wallet backup alert: %v", err)
+	}
+}
+
+// runVerifyBackup implements the verify-backup subcommand, which decrypts
+// a wallet backup and checks its key against the pool wallet key of the
+// secrets provider
+func runVerifyBackup(args []string) error {
+	fs := flag.NewFlagSet("verify-backup", flag.ContinueOnError)
+	provider := fs.String("secretsprovider", "env", "Where the live pool wallet key is loaded from: env, file or command")
+	dir := fs.String("secretsdir", "", "Directory of encrypted secret files, for the file provider")
+	command := fs.String("secretscommand", "", "Command fetching a secret, for the command provider")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: alerimnode verify-backup [-secretsprovider env|file|command] [-secretsdir dir] [-secretscommand cmd] <backup>  (passphrase from ALERIM_WALLET_BACKUP_PASSPHRASE)")
+	}
+
+	passphrase := os.Getenv(envPrefix + "WALLET_BACKUP_PASSPHRASE")
+	if passphrase == "" {
+		return errors.New("ALERIM_WALLET_BACKUP_PASSPHRASE is not set")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	secrets, err := NewSecretProvider(*provider, *dir, os.Getenv(envPrefix+"SECRETS_PASSPHRASE"), *command)
+	if err != nil {
+		return err
+	}
+	secret, err := secrets.GetSecret(SecretPoolWalletKey)
+	if err != nil {
+		return fmt.Errorf("loading the live %s: %v", SecretPoolWalletKey, err)
+	}
+	live, err := parsePrivateKey(secret)
+	if err != nil {
+		return fmt.Errorf("invalid live %s: %v", SecretPoolWalletKey, err)
+	}
+
+	backup, err := verifyWalletBackup(data, passphrase, live)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("OK: backup of %s made %s matches the live wallet\n", backup.PublicKey, backup.CreatedAt.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWalletBackups(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	b, err := NewWalletBackups(dir, "backup passphrase", 2, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, err := b.Backup(start.Add(time.Duration(i) * time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// Only the newest two are kept
+	kept, _ := filepath.Glob(filepath.Join(dir, "wallet-*.enc"))
+	if len(kept) != 2 || kept[0] != paths[1] || kept[1] != paths[2] {
+		t.Errorf("kept backups %v, want the last two of %v", kept, paths)
+	}
+
+	data, err := os.ReadFile(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := verifyWalletBackup(data, "backup passphrase", key)
+	if err != nil {
+		t.Fatalf("backup failed verification: %v", err)
+	}
+	if !backup.CreatedAt.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("backup created at %v", backup.CreatedAt)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := verifyWalletBackup(data, "backup passphrase", other); err == nil {
+		t.Error("backup matched another wallet key")
+	}
+	if _, err := verifyWalletBackup(data, "wrong", key); err == nil {
+		t.Error("backup decrypted with the wrong passphrase")
+	}
+	data[len(data)-1] ^= 1
+	if _, err := verifyWalletBackup(data, "backup passphrase", key); err == nil {
+		t.Error("corrupted backup passed verification")
+	}
+}
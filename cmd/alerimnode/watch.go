@@ -0,0 +1,635 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// parseDescriptor converts an output descriptor to the output script it
+// matches. Supported forms are addr(<address>), pk(<hex public key>),
+// raw(<hex script>) and a bare address.
+func parseDescriptor(desc string) ([]byte, error) {
+	desc = strings.TrimSpace(desc)
+	open := strings.IndexByte(desc, '(')
+	if open < 0 {
+		if desc == "" || strings.ContainsAny(desc, "() ") {
+			return nil, fmt.Errorf("invalid descriptor %q", desc)
+		}
+		return []byte(desc), nil
+	}
+	if !strings.HasSuffix(desc, ")") {
+		return nil, fmt.Errorf("invalid descriptor %q: missing ')'", desc)
+	}
+
+	kind, arg := desc[:open], desc[open+1:len(desc)-1]
+	if arg == "" {
+		return nil, fmt.Errorf("invalid descriptor %q: empty argument", desc)
+	}
+	switch kind {
+	case "addr":
+		return []byte(arg), nil
+	case "pk", "raw":
+		script, err := hex.DecodeString(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid descriptor %q: %v", desc, err)
+		}
+		return script, nil
+	default:
+		return nil, fmt.Errorf("unsupported descriptor type %q", kind)
+	}
+}
+
+// WatchList is a named set of descriptors whose outputs are tracked
+type WatchList struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Descriptors []string  `json:"descriptors"`
+	Birthday    time.Time `json:"birthday,omitempty"` // Blocks before it aren't scanned
+	CreatedAt   time.Time `json:"created_at"`
+
+	scripts map[string]string // script -> descriptor
+	utxos   map[string]*WatchedOutput
+	history []*WatchEvent
+	rescan  *RescanProgress
+}
+
+// RescanProgress reports the scan of the chain for a watch list's outputs
+type RescanProgress struct {
+	StartHeight int       `json:"start_height"`
+	Height      int       `json:"height"` // Last block scanned
+	TipHeight   int       `json:"tip_height"`
+	Done        bool      `json:"done"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+
+	last [32]byte // Hash of the last block scanned
+}
+
+// rescanning reports whether the list's outputs are still being scanned
+// for, so new blocks are left to the rescan
+func (l *WatchList) rescanning() bool {
+	return l.rescan != nil && !l.rescan.Done
+}
+
+// WatchedOutput is an unspent output paying a watched script
+type WatchedOutput struct {
+	TxHash     string            `json:"txid"`
+	Index      uint32            `json:"vout"`
+	Value      blockchain.Amount `json:"value"`
+	Descriptor string            `json:"descriptor"`
+	Height     int               `json:"height"`
+}
+
+// WatchEvent is a transaction that paid to or spent from a watch list
+type WatchEvent struct {
+	TxHash    string            `json:"txid"`
+	BlockHash string            `json:"block_hash"`
+	Height    int               `json:"height"`
+	Time      time.Time         `json:"time"`
+	Received  blockchain.Amount `json:"received"`
+	Sent      blockchain.Amount `json:"sent"`
+
+	spent []*WatchedOutput // Outputs this transaction spent, for undo
+}
+
+// errWatchListNotFound is returned for an unknown watch list ID
+var errWatchListNotFound = errors.New("watch list not found")
+
+// outpointKey identifies a transaction output
+func outpointKey(txHash [32]byte, index uint32) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// WatchService tracks the outputs of watch lists independently of the
+// wallet, following the main chain through chain notifications
+type WatchService struct {
+	mu      sync.RWMutex
+	chain   *blockchain.Blockchain
+	path    string
+	lists   map[string]*WatchList
+	applied map[[32]byte]int // Connected block hash -> height
+}
+
+// rescanBatch is the number of blocks a rescan scans at a time, so other
+// watch list operations aren't held up for long
+const rescanBatch = 500
+
+// birthdayWindow is how long before a watch list's birthday blocks are
+// scanned, as block timestamps are neither exact nor in order
+const birthdayWindow = 2 * time.Hour
+
+// NewWatchService loads the watch lists in path and starts scanning the
+// chain for their outputs in the background
+func NewWatchService(bc *blockchain.Blockchain, path string) (*WatchService, error) {
+	w := &WatchService{
+		chain:   bc,
+		path:    path,
+		lists:   make(map[string]*WatchList),
+		applied: make(map[[32]byte]int),
+	}
+
+	var stored []*WatchList
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Subscribe before scanning so no block is missed; notifications for
+	// blocks already scanned are ignored
+	bc.Subscribe(w.handleChainNotification)
+
+	for height, block := range bc.GetBlocks() {
+		w.connectBlock(block, height)
+	}
+	for _, list := range stored {
+		if err := w.prepare(list); err != nil {
+			return nil, fmt.Errorf("watch list %s: %v", list.ID, err)
+		}
+		w.lists[list.ID] = list
+		w.startRescan(list)
+	}
+	return w, nil
+}
+
+// prepare parses a watch list's descriptors and resets its state
+func (w *WatchService) prepare(list *WatchList) error {
+	if len(list.Descriptors) == 0 {
+		return errors.New("at least one descriptor is required")
+	}
+	list.scripts = make(map[string]string)
+	for _, desc := range list.Descriptors {
+		script, err := parseDescriptor(desc)
+		if err != nil {
+			return err
+		}
+		list.scripts[string(script)] = desc
+	}
+	list.utxos = make(map[string]*WatchedOutput)
+	list.history = make([]*WatchEvent, 0)
+	return nil
+}
+
+// Add registers a watch list and starts scanning the chain for its
+// outputs, from its birthday if not zero
+func (w *WatchService) Add(name string, descriptors []string, birthday time.Time) (*WatchList, error) {
+	list := &WatchList{
+		ID:          randomToken()[:16],
+		Name:        name,
+		Descriptors: descriptors,
+		Birthday:    birthday,
+		CreatedAt:   time.Now(),
+	}
+	if err := w.prepare(list); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lists[list.ID] = list
+	if err := w.save(); err != nil {
+		delete(w.lists, list.ID)
+		return nil, err
+	}
+	w.startRescan(list)
+	return list, nil
+}
+
+// Rescan scans the chain for a watch list's outputs again, from a new
+// birthday if not nil, e.g. after funds older than the birthday turned up
+func (w *WatchService) Rescan(id string, birthday *time.Time) (*RescanProgress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	list, ok := w.lists[id]
+	if !ok {
+		return nil, errWatchListNotFound
+	}
+	if birthday != nil {
+		previous := list.Birthday
+		list.Birthday = *birthday
+		if err := w.save(); err != nil {
+			list.Birthday = previous
+			return nil, err
+		}
+	}
+	w.startRescan(list)
+	progress := *list.rescan
+	return &progress, nil
+}
+
+// RescanStatus returns the progress of the last scan for a watch list's
+// outputs
+func (w *WatchService) RescanStatus(id string) (*RescanProgress, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	list, ok := w.lists[id]
+	if !ok || list.rescan == nil {
+		return nil, ok
+	}
+	progress := *list.rescan
+	return &progress, true
+}
+
+// birthdayHeight returns the height of the first block timestamped within
+// birthdayWindow of birthday, or len(blocks) if there is none
+func birthdayHeight(blocks []*blockchain.Block, birthday time.Time) int {
+	if birthday.IsZero() {
+		return 0
+	}
+	cutoff := birthday.Add(-birthdayWindow).Unix()
+	return sort.Search(len(blocks), func(i int) bool { return blocks[i].Timestamp >= cutoff })
+}
+
+// startRescan clears what a watch list found and scans the blocks from its
+// birthday on in the background. Until the scan catches up, new blocks are
+// left to it. The caller must hold w.mu.
+func (w *WatchService) startRescan(list *WatchList) {
+	list.utxos = make(map[string]*WatchedOutput)
+	list.history = make([]*WatchEvent, 0)
+
+	blocks := w.chain.GetBlocks()
+	start := birthdayHeight(blocks, list.Birthday)
+	progress := &RescanProgress{
+		StartHeight: start,
+		Height:      start - 1,
+		TipHeight:   len(blocks) - 1,
+		StartedAt:   time.Now(),
+	}
+	if start == 0 {
+		// Blocks are scanned after the last one; the genesis block has none
+		if _, ok := w.applied[blocks[0].Hash]; ok {
+			w.connectBlockToList(list, blocks[0], 0)
+		}
+		progress.Height = 0
+	}
+	progress.last = blocks[progress.Height].Hash
+	list.rescan = progress
+	go w.rescan(list, progress)
+}
+
+// rescan scans the chain for a watch list's outputs in batches, until the
+// list is removed or rescanned again or the scan catches up
+func (w *WatchService) rescan(list *WatchList, progress *RescanProgress) {
+	for {
+		w.mu.Lock()
+		if w.lists[list.ID] != list || list.rescan != progress {
+			w.mu.Unlock()
+			return
+		}
+		done := w.rescanBatch(list, progress)
+		w.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// rescanBatch scans the blocks following the last one scanned. It reports
+// whether the scan caught up with the blocks the service applied, and the
+// list follows new blocks from then on. The caller must hold w.mu.
+func (w *WatchService) rescanBatch(list *WatchList, progress *RescanProgress) bool {
+	blocks := w.chain.GetBlocksAfter([][32]byte{progress.last}, rescanBatch)
+	progress.TipHeight = w.chain.GetHeight()
+	for i, block := range blocks {
+		// A block not applied yet or not following the last is left to the
+		// chain notifications
+		height, ok := w.applied[block.Hash]
+		if !ok || block.PrevHash != progress.last {
+			blocks = blocks[:i]
+			break
+		}
+		w.connectBlockToList(list, block, height)
+		progress.Height, progress.last = height, block.Hash
+	}
+	if len(blocks) == rescanBatch {
+		return false
+	}
+	progress.Done = true
+	progress.FinishedAt = time.Now()
+	log.Printf("Rescanned blocks %d-%d for watch list %s", progress.StartHeight, progress.Height, list.ID)
+	return true
+}
+
+// Remove deletes a watch list
+func (w *WatchService) Remove(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.lists[id]; !ok {
+		return false
+	}
+	delete(w.lists, id)
+	if err := w.save(); err != nil {
+		log.Printf("Error saving watch lists: %v", err)
+	}
+	return true
+}
+
+// save persists the watch list definitions; the caller must hold w.mu
+func (w *WatchService) save() error {
+	lists := make([]*WatchList, 0, len(w.lists))
+	for _, list := range w.lists {
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].CreatedAt.Before(lists[j].CreatedAt) })
+	return saveJSONFile(w.path, lists)
+}
+
+// handleChainNotification applies connected and disconnected blocks
+func (w *WatchService) handleChainNotification(n *blockchain.Notification) {
+	block, ok := n.Data.(*blockchain.Block)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		if _, ok := w.applied[block.Hash]; ok {
+			return
+		}
+		height := 0
+		if prev, ok := w.applied[block.PrevHash]; ok {
+			height = prev + 1
+		}
+		w.connectBlock(block, height)
+	case blockchain.NTBlockDisconnected:
+		w.disconnectBlock(block)
+	}
+}
+
+// connectBlock applies a block to all watch lists; the caller must hold
+// w.mu
+func (w *WatchService) connectBlock(block *blockchain.Block, height int) {
+	w.applied[block.Hash] = height
+	for _, list := range w.lists {
+		if !list.rescanning() {
+			w.connectBlockToList(list, block, height)
+		}
+	}
+}
+
+// connectBlockToList records the outputs a block pays to and spends from
+// a watch list; the caller must hold w.mu
+func (w *WatchService) connectBlockToList(list *WatchList, block *blockchain.Block, height int) {
+	for _, tx := range block.Transactions {
+		event := &WatchEvent{
+			TxHash:    hex.EncodeToString(tx.Hash[:]),
+			BlockHash: hex.EncodeToString(block.Hash[:]),
+			Height:    height,
+			Time:      time.Unix(block.Timestamp, 0),
+		}
+
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				key := outpointKey(in.PrevTxHash, in.PrevTxIndex)
+				if out, ok := list.utxos[key]; ok {
+					event.Sent += out.Value
+					event.spent = append(event.spent, out)
+					delete(list.utxos, key)
+				}
+			}
+		}
+
+		for i, out := range tx.Outputs {
+			desc, ok := list.scripts[string(out.Script)]
+			if !ok {
+				continue
+			}
+			event.Received += blockchain.Amount(out.Value)
+			list.utxos[outpointKey(tx.Hash, uint32(i))] = &WatchedOutput{
+				TxHash:     event.TxHash,
+				Index:      uint32(i),
+				Value:      blockchain.Amount(out.Value),
+				Descriptor: desc,
+				Height:     height,
+			}
+		}
+
+		if event.Received > 0 || len(event.spent) > 0 {
+			list.history = append(list.history, event)
+		}
+	}
+}
+
+// disconnectBlock undoes a block's effect on all watch lists; the caller
+// must hold w.mu
+func (w *WatchService) disconnectBlock(block *blockchain.Block) {
+	if _, ok := w.applied[block.Hash]; !ok {
+		return
+	}
+	delete(w.applied, block.Hash)
+
+	blockHash := hex.EncodeToString(block.Hash[:])
+	created := make(map[string]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		created[hex.EncodeToString(tx.Hash[:])] = true
+	}
+
+	for _, list := range w.lists {
+		// Restore what the block spent, then drop what it created
+		for i := len(list.history) - 1; i >= 0; i-- {
+			event := list.history[i]
+			if event.BlockHash != blockHash {
+				continue
+			}
+			for _, out := range event.spent {
+				hash, _ := decodeHash(out.TxHash)
+				list.utxos[outpointKey(hash, out.Index)] = out
+			}
+			list.history = append(list.history[:i], list.history[i+1:]...)
+		}
+		for key, out := range list.utxos {
+			if created[out.TxHash] {
+				delete(list.utxos, key)
+			}
+		}
+		if list.rescanning() && list.rescan.last == block.Hash {
+			list.rescan.Height--
+			list.rescan.last = block.PrevHash
+		}
+	}
+}
+
+// WatchBalance summarizes the unspent outputs of a watch list
+type WatchBalance struct {
+	Balance blockchain.Amount `json:"balance"`
+	UTXOs   int               `json:"utxos"`
+}
+
+// List returns all watch lists
+func (w *WatchService) List() []*WatchList {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	lists := make([]*WatchList, 0, len(w.lists))
+	for _, list := range w.lists {
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].CreatedAt.Before(lists[j].CreatedAt) })
+	return lists
+}
+
+// Balance returns the balance of a watch list
+func (w *WatchService) Balance(id string) (*WatchBalance, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	list, ok := w.lists[id]
+	if !ok {
+		return nil, false
+	}
+	balance := &WatchBalance{UTXOs: len(list.utxos)}
+	for _, out := range list.utxos {
+		balance.Balance += out.Value
+	}
+	return balance, true
+}
+
+// UTXOs returns the unspent outputs of a watch list, oldest first
+func (w *WatchService) UTXOs(id string) ([]*WatchedOutput, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	list, ok := w.lists[id]
+	if !ok {
+		return nil, false
+	}
+	utxos := make([]*WatchedOutput, 0, len(list.utxos))
+	for _, out := range list.utxos {
+		utxos = append(utxos, out)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].Height != utxos[j].Height {
+			return utxos[i].Height < utxos[j].Height
+		}
+		if utxos[i].TxHash != utxos[j].TxHash {
+			return utxos[i].TxHash < utxos[j].TxHash
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
+	return utxos, true
+}
+
+// History returns the transactions of a watch list, most recent first
+func (w *WatchService) History(id string) ([]*WatchEvent, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	list, ok := w.lists[id]
+	if !ok {
+		return nil, false
+	}
+	history := make([]*WatchEvent, 0, len(list.history))
+	for i := len(list.history) - 1; i >= 0; i-- {
+		history = append(history, list.history[i])
+	}
+	return history, true
+}
+
+// RegisterRoutes adds the watch list endpoints
+func (w *WatchService) RegisterRoutes(api *gin.RouterGroup) {
+	api.GET("/watch", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		c.JSON(http.StatusOK, w.List())
+	})
+
+	api.POST("/watch", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Name        string    `json:"name"`
+			Descriptors []string  `json:"descriptors"`
+			Birthday    time.Time `json:"birthday"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		list, err := w.Add(req.Name, req.Descriptors, req.Birthday)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	api.DELETE("/watch/:id", authMiddleware(""), func(c *gin.Context) {
+		if !w.Remove(c.Param("id")) {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	})
+
+	api.GET("/watch/:id/balance", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		balance, ok := w.Balance(c.Param("id"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		}
+		c.JSON(http.StatusOK, balance)
+	})
+
+	api.GET("/watch/:id/utxos", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		utxos, ok := w.UTXOs(c.Param("id"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		}
+		c.JSON(http.StatusOK, utxos)
+	})
+
+	api.GET("/watch/:id/rescan", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		progress, ok := w.RescanStatus(c.Param("id"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	})
+
+	api.POST("/watch/:id/rescan", authMiddleware(""), func(c *gin.Context) {
+		var req struct {
+			Birthday *time.Time `json:"birthday"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&req); err != nil {
+				respondError(c, apiError(CodeInvalidRequest, err.Error()))
+				return
+			}
+		}
+		progress, err := w.Rescan(c.Param("id"), req.Birthday)
+		if errors.Is(err, errWatchListNotFound) {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		} else if err != nil {
+			respondError(c, apiError(CodeInternal, err.Error()))
+			return
+		}
+		c.JSON(http.StatusAccepted, progress)
+	})
+
+	api.GET("/watch/:id/history", authMiddleware(ScopeReadStats), func(c *gin.Context) {
+		history, ok := w.History(c.Param("id"))
+		if !ok {
+			respondError(c, apiError(CodeNotFound, "Watch list not found"))
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	})
+}
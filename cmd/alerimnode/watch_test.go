@@ -0,0 +1,175 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestParseDescriptor(t *testing.T) {
+	tests := []struct {
+		desc    string
+		want    string
+		wantErr bool
+	}{
+		{"addr(AIMcold1)", "AIMcold1", false},
+		{"AIMcold1", "AIMcold1", false},
+		{"pk(0a0b)", "\x0a\x0b", false},
+		{"raw(ff)", "\xff", false},
+		{"pk(zz)", "", true},
+		{"addr()", "", true},
+		{"addr(AIMcold1", "", true},
+		{"wpkh(0a0b)", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseDescriptor(tt.desc)
+		if (err != nil) != tt.wantErr || string(got) != tt.want {
+			t.Errorf("parseDescriptor(%q) = %q, %v; want %q, error %v", tt.desc, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWatchServiceFollowsChain(t *testing.T) {
+	w := &WatchService{
+		lists:   make(map[string]*WatchList),
+		applied: make(map[[32]byte]int),
+	}
+	list := &WatchList{ID: "cold", Descriptors: []string{"addr(cold)"}}
+	if err := w.prepare(list); err != nil {
+		t.Fatal(err)
+	}
+	w.lists[list.ID] = list
+
+	fund := blockchain.NewTransaction(
+		[]blockchain.TxInput{{PrevTxHash: [32]byte{7}, Sequence: 0xFFFFFFFF}},
+		[]blockchain.TxOutput{{Value: 500, Script: []byte("cold")}, {Value: 9, Script: []byte("other")}},
+	)
+	block1 := &blockchain.Block{Hash: [32]byte{1}, Transactions: []blockchain.Transaction{*fund}}
+
+	spend := blockchain.NewTransaction(
+		[]blockchain.TxInput{{PrevTxHash: fund.Hash, PrevTxIndex: 0, Sequence: 0xFFFFFFFF}},
+		[]blockchain.TxOutput{{Value: 120, Script: []byte("cold")}, {Value: 380, Script: []byte("other")}},
+	)
+	block2 := &blockchain.Block{Hash: [32]byte{2}, PrevHash: block1.Hash, Transactions: []blockchain.Transaction{*spend}}
+
+	check := func(stage string, balance blockchain.Amount, events int) {
+		t.Helper()
+		b, _ := w.Balance("cold")
+		h, _ := w.History("cold")
+		if b.Balance != balance || len(h) != events {
+			t.Errorf("%s: balance %d with %d events, want %d with %d", stage, b.Balance, len(h), balance, events)
+		}
+	}
+
+	w.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: block1})
+	check("after funding", 500, 1)
+
+	w.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: block2})
+	check("after spend", 120, 2)
+	if utxos, _ := w.UTXOs("cold"); len(utxos) != 1 || utxos[0].Height != 1 {
+		t.Errorf("unexpected utxos after spend: %+v", utxos)
+	}
+
+	// A repeated notification must not double count
+	w.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockConnected, Data: block2})
+	check("after duplicate", 120, 2)
+
+	w.handleChainNotification(&blockchain.Notification{Type: blockchain.NTBlockDisconnected, Data: block2})
+	check("after disconnect", 500, 1)
+}
+
+func TestBirthdayHeight(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	var blocks []*blockchain.Block
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, &blockchain.Block{Timestamp: base.Add(time.Duration(i) * time.Hour).Unix()})
+	}
+	tests := []struct {
+		birthday time.Time
+		want     int
+	}{
+		{time.Time{}, 0},
+		{base, 0},
+		{base.Add(3 * time.Hour), 1}, // Blocks within the window are scanned
+		{base.Add(5*time.Hour + time.Second), 4},
+		{base.Add(24 * time.Hour), 5},
+	}
+	for _, tt := range tests {
+		if got := birthdayHeight(blocks, tt.birthday); got != tt.want {
+			t.Errorf("birthdayHeight(%v) = %d, want %d", tt.birthday, got, tt.want)
+		}
+	}
+}
+
+func TestWatchServiceRescan(t *testing.T) {
+	bc := blockchain.NewBlockchainWithParams(&blockchain.RegTestParams)
+	for i := 0; i < 3; i++ {
+		if _, err := bc.GenerateBlock([]byte("cold"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := NewWatchService(bc, filepath.Join(t.TempDir(), "watchlists.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitRescan := func(id string) *RescanProgress {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if progress, _ := w.RescanStatus(id); progress != nil && progress.Done {
+				return progress
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("rescan of %s did not finish", id)
+		return nil
+	}
+	balance := func(id string) int {
+		b, _ := w.Balance(id)
+		return b.UTXOs
+	}
+
+	all, err := w.Add("all", []string{"cold"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress := waitRescan(all.ID); progress.StartHeight != 0 || progress.Height != 3 {
+		t.Errorf("full rescan covered %d-%d, want 0-3", progress.StartHeight, progress.Height)
+	}
+	// A birthday after every block skips the scan
+	recent, err := w.Add("recent", []string{"cold"}, time.Now().Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress := waitRescan(recent.ID); progress.StartHeight != 4 {
+		t.Errorf("rescan from a future birthday started at %d, want 4", progress.StartHeight)
+	}
+	if balance(all.ID) != 3 || balance(recent.ID) != 0 {
+		t.Errorf("after rescans: %d and %d outputs, want 3 and 0", balance(all.ID), balance(recent.ID))
+	}
+
+	// Both lists follow new blocks once caught up
+	if _, err := bc.GenerateBlock([]byte("cold"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if balance(all.ID) != 4 || balance(recent.ID) != 1 {
+		t.Errorf("after a new block: %d and %d outputs, want 4 and 1", balance(all.ID), balance(recent.ID))
+	}
+
+	// Moving the birthday back finds the older outputs
+	birthday := time.Time{}
+	if _, err := w.Rescan(recent.ID, &birthday); err != nil {
+		t.Fatal(err)
+	}
+	waitRescan(recent.ID)
+	if balance(recent.ID) != 4 {
+		t.Errorf("after moving the birthday back: %d outputs, want 4", balance(recent.ID))
+	}
+	if _, err := w.Rescan("missing", nil); err != errWatchListNotFound {
+		t.Errorf("rescan of an unknown list: err = %v", err)
+	}
+}
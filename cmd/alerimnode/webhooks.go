@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+	"github.com/gin-gonic/gin"
+)
+
+// Webhook events users can subscribe to
+const (
+	WebhookBalance    = "balance"     // Unpaid balance reached the webhook's threshold
+	WebhookPayout     = "payout"      // A payout was sent to one of the user's workers
+	WebhookBlockFound = "block_found" // One of the user's workers found a block
+)
+
+var validWebhookEvents = map[string]bool{
+	WebhookBalance:    true,
+	WebhookPayout:     true,
+	WebhookBlockFound: true,
+}
+
+// maxWebhooksPerUser bounds the webhooks a user can register
+const maxWebhooksPerUser = 10
+
+// webhookEventHeader and webhookDeliveryHeader name the event of a
+// delivery and its ID, which stays the same across retries so receivers
+// can drop duplicates
+const (
+	webhookEventHeader    = "X-Alerim-Event"
+	webhookDeliveryHeader = "X-Alerim-Delivery"
+)
+
+// webhookRetryDelays are the waits before each retry of a failed delivery
+var webhookRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+// errTooManyWebhooks is returned when a user has maxWebhooksPerUser
+var errTooManyWebhooks = fmt.Errorf("at most %d webhooks per user", maxWebhooksPerUser)
+
+// Webhook is a user's subscription to pool events about their workers.
+// Deliveries are signed with the webhook's secret like the identity
+// verification callbacks: see webhookSignatureHeader.
+type Webhook struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	URL       string            `json:"url"`
+	Events    []string          `json:"events"`
+	Threshold blockchain.Amount `json:"threshold,omitempty"` // For balance events
+	Secret    string            `json:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// Outcome of the last delivery, and failed attempts since the last
+	// success
+	LastDelivery time.Time `json:"last_delivery,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	Failures     int       `json:"failures"`
+
+	// Whether the balance was at or above the threshold when last checked;
+	// a balance event fires as it gets there, once until it drops below
+	AboveThreshold bool `json:"above_threshold,omitempty"`
+}
+
+// subscribes reports whether the webhook wants an event
+func (w *Webhook) subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// storedWebhook is the on-disk form of a webhook, which unlike API
+// responses includes the secret
+type storedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// webhookEvent is a pool event about a worker, queued for delivery to its
+// user's webhooks
+type webhookEvent struct {
+	minerID string
+	event   string // Empty to only check balance thresholds
+	data    map[string]interface{}
+}
+
+// WebhookService keeps users' webhooks and delivers events to them
+type WebhookService struct {
+	mu      sync.Mutex
+	path    string
+	hooks   map[string]*Webhook // By ID
+	rewards *RewardManager
+	events  chan webhookEvent
+	client  *http.Client
+}
+
+// webhooks delivers pool events to users; nil until loaded
+var webhooks *WebhookService
+
+// NewWebhookService loads the webhooks persisted at path and starts
+// delivering events
+func NewWebhookService(path string, rewards *RewardManager) (*WebhookService, error) {
+	s := &WebhookService{
+		path:    path,
+		hooks:   make(map[string]*Webhook),
+		rewards: rewards,
+		events:  make(chan webhookEvent, 1024),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	var stored []*storedWebhook
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, hook := range stored {
+		w := hook.Webhook
+		w.Secret = hook.Secret
+		s.hooks[w.ID] = &w
+	}
+	go s.run()
+	return s, nil
+}
+
+// save persists the webhooks; the caller must hold s.mu
+func (s *WebhookService) save() {
+	if s.path == "" {
+		return
+	}
+	stored := make([]*storedWebhook, 0, len(s.hooks))
+	for _, hook := range s.hooks {
+		stored = append(stored, &storedWebhook{Webhook: *hook, Secret: hook.Secret})
+	}
+	if err := saveJSONFile(s.path, stored); err != nil {
+		log.Printf("Error saving webhooks: %v", err)
+	}
+}
+
+// Register adds a webhook for a user and returns it with its signing
+// secret, which is shown only this once
+func (s *WebhookService) Register(userID, url string, events []string, threshold blockchain.Amount) (*Webhook, string, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, "", errors.New("url must be an http or https URL")
+	}
+	if len(events) == 0 {
+		return nil, "", errors.New("at least one event is required")
+	}
+	for _, event := range events {
+		if !validWebhookEvents[event] {
+			return nil, "", fmt.Errorf("unknown event %q", event)
+		}
+	}
+	hook := &Webhook{
+		ID:        randomToken()[:16],
+		UserID:    userID,
+		URL:       url,
+		Events:    events,
+		Threshold: threshold,
+		Secret:    randomToken(),
+		CreatedAt: time.Now(),
+	}
+	if hook.subscribes(WebhookBalance) && threshold <= 0 {
+		return nil, "", errors.New("balance events need a positive threshold")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, h := range s.hooks {
+		if h.UserID == userID {
+			count++
+		}
+	}
+	if count >= maxWebhooksPerUser {
+		return nil, "", errTooManyWebhooks
+	}
+	s.hooks[hook.ID] = hook
+	s.save()
+	copied := *hook
+	return &copied, hook.Secret, nil
+}
+
+// List returns copies of a user's webhooks
+func (s *WebhookService) List(userID string) []*Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := make([]*Webhook, 0)
+	for _, hook := range s.hooks {
+		if hook.UserID == userID {
+			copied := *hook
+			hooks = append(hooks, &copied)
+		}
+	}
+	return hooks
+}
+
+// Delete removes a user's webhook, reporting whether it existed
+func (s *WebhookService) Delete(userID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.hooks[id]
+	if !ok || hook.UserID != userID {
+		return false
+	}
+	delete(s.hooks, id)
+	s.save()
+	return true
+}
+
+// ForgetUser removes a deleted user's webhooks
+func (s *WebhookService) ForgetUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, hook := range s.hooks {
+		if hook.UserID == userID {
+			delete(s.hooks, id)
+		}
+	}
+	s.save()
+}
+
+// Notify queues an event about a worker for its user's webhooks without
+// blocking, so it may be called with other locks held. An empty event
+// only has balance thresholds checked, after the worker's balance changed.
+func (s *WebhookService) Notify(minerID, event string, data map[string]interface{}) {
+	select {
+	case s.events <- webhookEvent{minerID: minerID, event: event, data: data}:
+	default:
+		log.Printf("Webhook queue full, dropping %s event of %s", event, minerID)
+	}
+}
+
+// notifyWebhooks queues an event for users' webhooks, if enabled
+func notifyWebhooks(minerID, event string, data map[string]interface{}) {
+	if webhooks != nil {
+		webhooks.Notify(minerID, event, data)
+	}
+}
+
+// run turns queued events into deliveries
+func (s *WebhookService) run() {
+	for e := range s.events {
+		miner := findMiner(e.minerID)
+		if miner == nil || miner.UserID == "" {
+			continue
+		}
+		if e.event != "" {
+			data := gin.H{"worker": e.minerID}
+			for k, v := range e.data {
+				data[k] = v
+			}
+			for _, hook := range s.subscribed(miner.UserID, e.event) {
+				go s.deliver(hook, e.event, data)
+			}
+		}
+		s.checkBalance(miner.UserID)
+	}
+}
+
+// subscribed returns copies of a user's webhooks wanting an event
+func (s *WebhookService) subscribed(userID, event string) []*Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hooks []*Webhook
+	for _, hook := range s.hooks {
+		if hook.UserID == userID && hook.subscribes(event) {
+			copied := *hook
+			hooks = append(hooks, &copied)
+		}
+	}
+	return hooks
+}
+
+// checkBalance fires the balance webhooks of a user whose unpaid balance,
+// summed over their workers, reached their threshold since last checked.
+// Checks hold s.mu throughout, so each crossing fires once.
+func (s *WebhookService) checkBalance(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var hooks []*Webhook
+	for _, hook := range s.hooks {
+		if hook.UserID == userID && hook.subscribes(WebhookBalance) {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	var ids []string
+	for _, miner := range minersOfUser(userID) {
+		ids = append(ids, miner.ID)
+	}
+	balance, immature := s.rewards.MinerBalances(ids)
+
+	changed := false
+	for _, hook := range hooks {
+		above := balance >= hook.Threshold
+		if above && !hook.AboveThreshold {
+			copied := *hook
+			go s.deliver(&copied, WebhookBalance, gin.H{
+				"balance":   balance,
+				"immature":  immature,
+				"threshold": hook.Threshold,
+			})
+		}
+		if above != hook.AboveThreshold {
+			hook.AboveThreshold = above
+			changed = true
+		}
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// deliver posts an event to a webhook, retrying after webhookRetryDelays
+// while the receiver can't be reached, fails or asks to slow down. Other
+// client errors are not retried.
+func (s *WebhookService) deliver(hook *Webhook, event string, data gin.H) {
+	delivery := randomToken()[:16]
+	body, err := json.Marshal(gin.H{
+		"id":      delivery,
+		"event":   event,
+		"user_id": hook.UserID,
+		"time":    time.Now().UTC(),
+		"data":    data,
+	})
+	if err != nil {
+		log.Printf("Error encoding %s webhook: %v", event, err)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(hook, event, delivery, body)
+		s.recordDelivery(hook.ID, err)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= len(webhookRetryDelays) {
+			log.Printf("Giving up on %s webhook %s: %v", event, hook.ID, err)
+			return
+		}
+		time.Sleep(webhookRetryDelays[attempt])
+	}
+}
+
+// post makes one delivery attempt, reporting whether a failure is worth
+// retrying
+func (s *WebhookService) post(hook *Webhook, event, delivery string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event)
+	req.Header.Set(webhookDeliveryHeader, delivery)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signPayload([]byte(hook.Secret), timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// recordDelivery notes the outcome of a delivery attempt
+func (s *WebhookService) recordDelivery(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.hooks[id]
+	if !ok {
+		return
+	}
+	hook.LastDelivery = time.Now()
+	if err != nil {
+		hook.LastError = err.Error()
+		hook.Failures++
+	} else {
+		hook.LastError = ""
+		hook.Failures = 0
+	}
+	s.save()
+}
+
+// registerWebhookRoutes adds the endpoints users manage their webhooks
+// with, through API keys with the manage-miners scope
+func registerWebhookRoutes(api *gin.RouterGroup) {
+	user := api.Group("/users/:id/webhooks", authMiddleware(ScopeManageMiners), func(c *gin.Context) {
+		if !authorizeUser(c, c.Param("id")) {
+			respondError(c, apiError(CodeForbidden, "Not allowed to manage this user's webhooks"))
+			c.Abort()
+			return
+		}
+		if findUser(c.Param("id")) == nil {
+			respondError(c, apiError(CodeNotFound, "User not found"))
+			c.Abort()
+		}
+	})
+
+	user.GET("", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks.List(c.Param("id"))})
+	})
+
+	user.POST("", func(c *gin.Context) {
+		var req struct {
+			URL       string            `json:"url"`
+			Events    []string          `json:"events"`
+			Threshold blockchain.Amount `json:"threshold"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		hook, secret, err := webhooks.Register(c.Param("id"), req.URL, req.Events, req.Threshold)
+		if err != nil {
+			respondError(c, apiError(CodeInvalidRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": secret})
+	})
+
+	user.DELETE("/:hookid", func(c *gin.Context) {
+		if !webhooks.Delete(c.Param("id"), c.Param("hookid")) {
+			respondError(c, apiError(CodeNotFound, "Webhook not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrut83/alerimAIM/blockchain"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	defer func(saved []time.Duration) { webhookRetryDelays = saved }(webhookRetryDelays)
+	webhookRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+
+	registryMu.Lock()
+	saved := activeMiners
+	activeMiners = []*Miner{{ID: "rig1", UserID: "u1"}, {ID: "rig2", UserID: "u1"}}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		activeMiners = saved
+		registryMu.Unlock()
+	}()
+
+	type delivery struct {
+		event    string
+		id       string
+		verified bool
+		body     map[string]interface{}
+	}
+	received := make(chan delivery, 10)
+	attempts := 0
+	var secret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails and is retried
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		d := delivery{event: r.Header.Get(webhookEventHeader), id: r.Header.Get(webhookDeliveryHeader)}
+		d.verified = verifyCallback([]byte(secret), r.Header.Get(webhookTimestampHeader), r.Header.Get(webhookSignatureHeader), body, time.Now()) == nil
+		json.Unmarshal(body, &d.body)
+		received <- d
+	}))
+	defer server.Close()
+
+	rm := newTestRewardManager(10)
+	s, err := NewWebhookService("", rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Register("u1", "file:///etc/passwd", []string{WebhookPayout}, 0); err == nil {
+		t.Error("non-HTTP URL accepted")
+	}
+	if _, _, err := s.Register("u1", server.URL, []string{WebhookBalance}, 0); err == nil {
+		t.Error("balance webhook without a threshold accepted")
+	}
+	hook, secret, err := s.Register("u1", server.URL, []string{WebhookPayout, WebhookBalance}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() delivery {
+		t.Helper()
+		select {
+		case d := <-received:
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatal("no delivery")
+			return delivery{}
+		}
+	}
+
+	// Events of other users' workers and unsubscribed events are dropped
+	s.Notify("stranger", WebhookPayout, nil)
+	s.Notify("rig1", WebhookBlockFound, nil)
+	s.Notify("rig1", WebhookPayout, map[string]interface{}{"tx_hash": "ab"})
+	d := next()
+	if d.event != WebhookPayout || !d.verified || d.id == "" || attempts != 2 {
+		t.Fatalf("delivery %+v after %d attempts", d, attempts)
+	}
+	if data := d.body["data"].(map[string]interface{}); data["worker"] != "rig1" || data["tx_hash"] != "ab" {
+		t.Errorf("payout data = %v", data)
+	}
+
+	// Balance events fire once as the user's summed balance reaches the
+	// threshold, and again only after it drops below
+	setBalance := func(minerID string, amount blockchain.Amount) {
+		rm.mu.Lock()
+		rm.balances[minerID] = amount
+		rm.mu.Unlock()
+	}
+	setBalance("rig1", 60)
+	s.checkBalance("u1")
+	setBalance("rig2", 50)
+	s.checkBalance("u1")
+	if d := next(); d.event != WebhookBalance {
+		t.Fatalf("got %s event, want balance", d.event)
+	}
+	s.checkBalance("u1")
+	setBalance("rig1", 0)
+	setBalance("rig2", 0)
+	s.checkBalance("u1")
+	setBalance("rig1", 200)
+	s.checkBalance("u1")
+	if d := next(); d.event != WebhookBalance {
+		t.Fatalf("got %s event, want balance", d.event)
+	}
+	select {
+	case d := <-received:
+		t.Errorf("unexpected %s delivery", d.event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if hooks := s.List("u1"); len(hooks) != 1 || hooks[0].Failures != 0 || hooks[0].LastDelivery.IsZero() {
+		t.Errorf("webhook after deliveries = %+v", hooks)
+	}
+	if !s.Delete("u1", hook.ID) || s.Delete("u1", hook.ID) {
+		t.Error("Delete did not remove the webhook exactly once")
+	}
+}
@@ -8,12 +8,22 @@ let users = [];
 let wallets = [];
 
 // Initialize the admin panel
-document.addEventListener('DOMContentLoaded', () => {
+document.addEventListener('DOMContentLoaded', async () => {
     initializeNavigation();
     initializeHashrateChart();
     loadDashboardData();
     setupEventListeners();
-    
+
+    // Resume an existing session or ask for credentials
+    if (!await restoreSession()) {
+        showLoginModal();
+        return;
+    }
+    startPanel();
+});
+
+// startPanel loads the admin data once a session is established
+function startPanel() {
     // Load initial data
     loadUsers();
     loadWallets();
@@ -22,7 +32,7 @@ document.addEventListener('DOMContentLoaded', () => {
     // Start periodic updates
     setInterval(updateDashboardData, 5000);
     setInterval(updateMinersData, 10000);
-});
+}
 
 // Navigation
 function initializeNavigation() {
@@ -242,6 +252,7 @@ function setupEventListeners() {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    'X-CSRF-Token': sessionStorage.getItem('csrf_token') || '',
                 },
                 body: JSON.stringify(Object.fromEntries(formData))
             });
@@ -263,6 +274,7 @@ function setupEventListeners() {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    'X-CSRF-Token': sessionStorage.getItem('csrf_token') || '',
                 },
                 body: JSON.stringify(Object.fromEntries(formData))
             });
@@ -275,6 +287,21 @@ function setupEventListeners() {
         }
     });
 
+    // Login Form
+    document.getElementById('login-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const formData = new FormData(e.target);
+        try {
+            await login(formData.get('username'), formData.get('password'));
+            e.target.reset();
+            document.getElementById('login-error').textContent = '';
+            closeModal('login-modal');
+            startPanel();
+        } catch (error) {
+            document.getElementById('login-error').textContent = error.message;
+        }
+    });
+
     // User Search
     document.getElementById('user-search').addEventListener('input', (e) => {
         const searchTerm = e.target.value.toLowerCase();
@@ -287,9 +314,58 @@ function setupEventListeners() {
 }
 
 // Authentication
-function logout() {
+function showLoginModal() {
+    document.getElementById('login-modal').style.display = 'block';
+}
+
+// restoreSession fetches the CSRF token of an existing cookie session
+async function restoreSession() {
+    try {
+        const response = await fetch('/api/admin/session');
+        if (!response.ok) {
+            return false;
+        }
+        const data = await response.json();
+        sessionStorage.setItem('csrf_token', data.csrf_token);
+        document.getElementById('admin-name').textContent = data.username;
+        return true;
+    } catch (error) {
+        console.error('Error restoring session:', error);
+        return false;
+    }
+}
+
+async function login(username, password) {
+    const response = await fetch('/api/admin/login', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ username, password })
+    });
+    if (!response.ok) {
+        throw new Error((await response.json()).error);
+    }
+    const data = await response.json();
+    sessionStorage.setItem('csrf_token', data.csrf_token);
+    document.getElementById('admin-name').textContent = username;
+}
+
+async function logout() {
+    // End the server-side session
+    try {
+        await fetch('/api/admin/logout', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': sessionStorage.getItem('csrf_token') || '',
+            }
+        });
+    } catch (error) {
+        console.error('Error logging out:', error);
+    }
     // Clear session/token
+    sessionStorage.removeItem('csrf_token');
     localStorage.removeItem('admin_token');
-    // Redirect to login page
-    window.location.href = '/login.html';
+    // Back to the login form
+    window.location.reload();
 }